@@ -0,0 +1,222 @@
+package gollama
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/jupiterrider/ffi"
+)
+
+// abiStruct describes a struct that llama.cpp returns by value from a
+// parameterless *_default_params function. The library writes its own
+// sizeof(struct) bytes into the result, which is how the layout is probed.
+type abiStruct struct {
+	name   string  // C struct name
+	symbol string  // function returning the struct
+	size   uintptr // size in the expected layout
+	align  uintptr // alignment in the expected layout
+	// check validates the library defaults decoded with the expected layout
+	check func(p unsafe.Pointer) error
+}
+
+// layoutStructs returns the structs to verify for layout.
+func layoutStructs(layout *structLayout) ([]abiStruct, error) {
+	modelSize, modelAlign, err := ffiTypeSize(layout.modelParams)
+	if err != nil {
+		return nil, err
+	}
+	ctxSize, ctxAlign, err := ffiTypeSize(layout.contextParams)
+	if err != nil {
+		return nil, err
+	}
+	return []abiStruct{
+		{
+			name:   "llama_model_params",
+			symbol: "llama_model_default_params",
+			size:   modelSize,
+			align:  modelAlign,
+			check: func(p unsafe.Pointer) error {
+				return checkModelParams(layout.decodeModelParams(p))
+			},
+		},
+		{
+			name:   "llama_context_params",
+			symbol: "llama_context_default_params",
+			size:   ctxSize,
+			align:  ctxAlign,
+			check: func(p unsafe.Pointer) error {
+				return checkContextParams(layout.decodeContextParams(p))
+			},
+		},
+	}, nil
+}
+
+// checkModelParams validates library defaults for llama_model_params.
+func checkModelParams(m LlamaModelParams) error {
+	if m.NGpuLayers < -1 {
+		return fmt.Errorf("n_gpu_layers = %d", m.NGpuLayers)
+	}
+	if m.SplitMode < LLAMA_SPLIT_MODE_NONE || m.SplitMode > LLAMA_SPLIT_MODE_ROW {
+		return fmt.Errorf("split_mode = %d", m.SplitMode)
+	}
+	if m.Devices != 0 || m.TensorSplit != nil || m.ProgressCallback != 0 || m.KvOverrides != 0 {
+		return fmt.Errorf("pointer fields are not NULL")
+	}
+	return checkBools(m.VocabOnly, m.UseMmap, m.UseMlock, m.CheckTensors, m.UseExtraBufts, m.NoHost)
+}
+
+// checkContextParams validates library defaults for llama_context_params.
+func checkContextParams(c LlamaContextParams) error {
+	if c.NBatch == 0 || c.NUbatch == 0 || c.NUbatch > c.NBatch {
+		return fmt.Errorf("n_batch = %d, n_ubatch = %d", c.NBatch, c.NUbatch)
+	}
+	if c.NSeqMax == 0 || c.NSeqMax > LLAMA_MAX_SEQ {
+		return fmt.Errorf("n_seq_max = %d", c.NSeqMax)
+	}
+	if c.NThreads <= 0 || c.NThreadsBatch <= 0 {
+		return fmt.Errorf("n_threads = %d, n_threads_batch = %d", c.NThreads, c.NThreadsBatch)
+	}
+	if c.FlashAttnType < LLAMA_FLASH_ATTN_TYPE_AUTO || c.FlashAttnType > LLAMA_FLASH_ATTN_TYPE_ENABLED {
+		return fmt.Errorf("flash_attn_type = %d", c.FlashAttnType)
+	}
+	if c.TypeK < 0 || c.TypeK >= int32(GGML_TYPE_COUNT) || c.TypeV < 0 || c.TypeV >= int32(GGML_TYPE_COUNT) {
+		return fmt.Errorf("type_k = %d, type_v = %d", c.TypeK, c.TypeV)
+	}
+	if c.CbEval != 0 || c.AbortCallback != 0 {
+		return fmt.Errorf("callback fields are not NULL")
+	}
+	return checkBools(c.Embeddings, c.Offload_kqv, c.NoPerf, c.OpOffload, c.SwaFull, c.KvUnified)
+}
+
+// VerifyABICompatibility checks that the structs llama.cpp passes by value
+// (llama_model_params, llama_context_params, llama_batch and
+// llama_sampler_chain_params) match the layout selected for the loaded
+// library. It compares the number of bytes the library writes for each
+// struct with the expected size and checks that the library defaults decode
+// to sane values. A mismatch means the library was built from a llama.h
+// without a matching params_bNNNN.go layout, and calling it would corrupt
+// memory.
+//
+// The check runs automatically when the library is loaded unless
+// GOLLAMA_SKIP_ABI_CHECK is set.
+func VerifyABICompatibility() error {
+	release, err := acquireNativeCall("VerifyABICompatibility")
+	if err != nil {
+		return err
+	}
+	defer release()
+	return verifyABI(libHandle)
+}
+
+// verifyABI runs the layout checks against the library at handle.
+func verifyABI(handle uintptr) error {
+	structs, err := layoutStructs(currentLayout())
+	if err != nil {
+		return err
+	}
+	for _, s := range structs {
+		if err := verifyStruct(handle, s); err != nil {
+			return err
+		}
+	}
+
+	// llama_sampler_chain_params is returned in registers, so only its value
+	// can be checked
+	sp, err := ffiSamplerChainDefaultParams()
+	if err != nil {
+		return err
+	}
+	if err := checkBools(sp.NoPerf); err != nil {
+		return fmt.Errorf("%w: unexpected llama_sampler_chain_params defaults (%v)", ErrABIMismatch, err)
+	}
+
+	// llama_batch_get_one fills n_tokens and token and leaves the rest NULL
+	tokens := []LlamaToken{1, 2, 3}
+	batch, err := ffiBatchGetOne(&tokens[0], int32(len(tokens)))
+	if err != nil {
+		return err
+	}
+	if batch.NTokens != int32(len(tokens)) || batch.Token != &tokens[0] ||
+		batch.Embd != nil || batch.Pos != nil || batch.SeqId != nil || batch.Logits != nil {
+		return fmt.Errorf("%w: llama_batch fields are misaligned (bindings target %s)", ErrABIMismatch, LlamaCppBuild)
+	}
+	return nil
+}
+
+// verifyStruct compares the library layout of s with its Go mirror.
+func verifyStruct(handle uintptr, s abiStruct) error {
+	buf, extent, err := probeStructReturn(handle, s.symbol, s.size)
+	if err != nil {
+		return err
+	}
+	build := currentLayout().build
+	if extent > s.size {
+		return fmt.Errorf("%w: %s is at least %d bytes in the library but %d in the b%d layout",
+			ErrABIMismatch, s.name, extent, s.size, build)
+	}
+	if extent+s.align <= s.size {
+		return fmt.Errorf("%w: %s is %d bytes in the library but %d in the b%d layout",
+			ErrABIMismatch, s.name, extent, s.size, build)
+	}
+	if err := s.check(unsafe.Pointer(&buf[0])); err != nil {
+		return fmt.Errorf("%w: unexpected %s defaults in the b%d layout, fields are misaligned (%v)",
+			ErrABIMismatch, s.name, build, err)
+	}
+	return nil
+}
+
+// probeStructReturn calls symbol, a parameterless function returning a
+// struct of about size bytes, into a larger buffer filled with a canary
+// pattern. It returns the result and the number of bytes up to the last one
+// the library wrote. Two patterns are used so that bytes that happen to
+// equal the canary are still seen.
+func probeStructReturn(handle uintptr, symbol string, size uintptr) ([]byte, uintptr, error) {
+	fnAddr, err := getProcAddressPlatform(handle, symbol)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get %s address: %w", symbol, err)
+	}
+
+	// Describe the result as a struct of words with generous slack. Structs
+	// this large are always returned through a caller-provided pointer.
+	nWords := int(size/8) + 32
+	elements := make([]*ffi.Type, nWords+1)
+	for i := 0; i < nWords; i++ {
+		elements[i] = &ffi.TypeUint64
+	}
+	probeType := ffi.Type{Type: ffi.Struct, Elements: &elements[0]}
+	var cif ffi.Cif
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 0, &probeType); status != ffi.OK {
+		return nil, 0, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	}
+
+	var result []byte
+	var extent uintptr
+	for _, canary := range []byte{0xA5, 0x5A} {
+		words := make([]uint64, nWords)
+		buf := unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), nWords*8)
+		for i := range buf {
+			buf[i] = canary
+		}
+		ffi.Call(&cif, fnAddr, unsafe.Pointer(&words[0]))
+		for i := len(buf) - 1; i >= 0; i-- {
+			if buf[i] != canary {
+				extent = max(extent, uintptr(i+1))
+				break
+			}
+		}
+		if result == nil {
+			result = buf
+		}
+	}
+	return result, extent, nil
+}
+
+// checkBools reports an error if any value is not 0 or 1.
+func checkBools(values ...uint8) error {
+	for i, v := range values {
+		if v > 1 {
+			return fmt.Errorf("bool field %d = %d", i, v)
+		}
+	}
+	return nil
+}
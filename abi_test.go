@@ -0,0 +1,60 @@
+package gollama
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ABISuite struct{ BaseSuite }
+
+func (s *ABISuite) SetupTest() {
+	s.BaseSuite.SetupTest()
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+}
+
+func (s *ABISuite) TestBundledLibraryMatches() {
+	s.Require().NoError(VerifyABICompatibility())
+}
+
+func (s *ABISuite) TestProbeMeasuresStructSize() {
+	_, extent, err := probeStructReturn(libHandle, "llama_context_default_params", unsafe.Sizeof(LlamaContextParams{}))
+	s.Require().NoError(err)
+	s.LessOrEqual(extent, unsafe.Sizeof(LlamaContextParams{}))
+	s.Greater(extent, unsafe.Sizeof(LlamaContextParams{})-8)
+}
+
+// A Go mirror that is too small or decodes to nonsense must be rejected
+func (s *ABISuite) TestDriftIsDetected() {
+	ok := func(unsafe.Pointer) error { return nil }
+
+	small := abiStruct{name: "llama_context_params", symbol: "llama_context_default_params", size: 64, align: 8, check: ok}
+	s.ErrorIs(verifyStruct(libHandle, small), ErrABIMismatch)
+
+	large := abiStruct{name: "llama_model_params", symbol: "llama_model_default_params", size: 128, align: 8, check: ok}
+	s.ErrorIs(verifyStruct(libHandle, large), ErrABIMismatch)
+
+	// The pre-b6862 layout with a leading seed field reads n_threads_batch
+	// from rope_scaling_type
+	structs, err := layoutStructs(currentLayout())
+	s.Require().NoError(err)
+	shifted := structs[1]
+	shifted.check = func(p unsafe.Pointer) error {
+		words := unsafe.Slice((*int32)(p), 8)
+		return checkContextParams(LlamaContextParams{NBatch: uint32(words[2]), NUbatch: uint32(words[3]),
+			NSeqMax: uint32(words[4]), NThreads: words[5], NThreadsBatch: words[6]})
+	}
+	s.ErrorIs(verifyStruct(libHandle, shifted), ErrABIMismatch)
+}
+
+func (s *ABISuite) TestCheckBools() {
+	s.NoError(checkBools(0, 1, 1))
+	s.Error(checkBools(0, 2))
+}
+
+func TestABISuite(t *testing.T) {
+	suite.Run(t, new(ABISuite))
+}
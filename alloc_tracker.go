@@ -0,0 +1,253 @@
+package gollama
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// allocStackDepth is the number of frames kept per tracked allocation.
+const allocStackDepth = 32
+
+// AllocationKind is the type of object tracked by allocation tracking.
+type AllocationKind string
+
+// Tracked allocation kinds.
+const (
+	AllocModel   AllocationKind = "model"
+	AllocContext AllocationKind = "context"
+	AllocSampler AllocationKind = "sampler"
+	AllocBatch   AllocationKind = "batch"
+	// AllocState is a state buffer returned by State_seq_get_data. It is Go
+	// memory, released by the garbage collector rather than a free call.
+	AllocState AllocationKind = "state"
+)
+
+// Allocation is an object created through the bindings and not freed yet.
+type Allocation struct {
+	Kind   AllocationKind
+	Handle uintptr
+	// Size is the size in bytes, when known
+	Size    uint64
+	Created time.Time
+	// Stack is the call stack that created the object
+	Stack string
+}
+
+// AllocationStats counts the objects of one kind created and released
+// while tracking was enabled.
+type AllocationStats struct {
+	Allocated uint64
+	Freed     uint64
+	Live      int
+	// LiveBytes is the size of the live objects whose size is known
+	LiveBytes uint64
+}
+
+// allocTracker records the objects created through the bindings so that
+// leaks, such as the steady growth of a long embedding loop, can be traced
+// back to the code that created them.
+type allocTracker struct {
+	enabled atomic.Bool
+
+	mu     sync.Mutex
+	live   map[allocKey]Allocation
+	counts map[AllocationKind]*AllocationStats
+	output io.Writer
+}
+
+type allocKey struct {
+	kind   AllocationKind
+	handle uintptr
+}
+
+var allocations = &allocTracker{}
+
+// EnableAllocationTracking starts recording the models, contexts, samplers,
+// batches and state buffers created through the bindings, with the stack
+// trace that created them. Backend_free then writes a report of the
+// objects still alive to w (os.Stderr when nil); LiveAllocations and
+// WriteAllocationReport give the same information at any time.
+//
+// Tracking captures a stack trace per allocation, so it is meant for
+// debugging. Objects created before it was enabled are not tracked. It can
+// also be enabled with Config.TrackAllocations or the
+// GOLLAMA_TRACK_ALLOCATIONS environment variable.
+func EnableAllocationTracking(w io.Writer) {
+	allocations.mu.Lock()
+	defer allocations.mu.Unlock()
+	if w == nil {
+		w = os.Stderr
+	}
+	allocations.output = w
+	if allocations.live == nil {
+		allocations.live = make(map[allocKey]Allocation)
+		allocations.counts = make(map[AllocationKind]*AllocationStats)
+	}
+	allocations.enabled.Store(true)
+}
+
+// DisableAllocationTracking stops recording allocations and forgets the
+// recorded ones.
+func DisableAllocationTracking() {
+	allocations.mu.Lock()
+	defer allocations.mu.Unlock()
+	allocations.enabled.Store(false)
+	allocations.live = nil
+	allocations.counts = nil
+}
+
+// AllocationTrackingEnabled reports whether allocation tracking is enabled.
+func AllocationTrackingEnabled() bool {
+	return allocations.enabled.Load()
+}
+
+// LiveAllocations returns the tracked objects not freed yet, oldest first.
+func LiveAllocations() []Allocation {
+	allocations.mu.Lock()
+	defer allocations.mu.Unlock()
+	live := make([]Allocation, 0, len(allocations.live))
+	for _, a := range allocations.live {
+		live = append(live, a)
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].Created.Before(live[j].Created) })
+	return live
+}
+
+// AllocationStatistics returns the tracked counts per kind.
+func AllocationStatistics() map[AllocationKind]AllocationStats {
+	allocations.mu.Lock()
+	defer allocations.mu.Unlock()
+	stats := make(map[AllocationKind]AllocationStats, len(allocations.counts))
+	for kind, c := range allocations.counts {
+		stats[kind] = *c
+	}
+	return stats
+}
+
+// WriteAllocationReport writes the allocation counts and the live objects
+// with their creation stacks to w, and returns the number of live objects.
+func WriteAllocationReport(w io.Writer) int {
+	live := LiveAllocations()
+	stats := AllocationStatistics()
+	kinds := make([]string, 0, len(stats))
+	for kind := range stats {
+		kinds = append(kinds, string(kind))
+	}
+	sort.Strings(kinds)
+
+	fmt.Fprintf(w, "gollama: %d live allocation(s)\n", len(live))
+	for _, kind := range kinds {
+		s := stats[AllocationKind(kind)]
+		fmt.Fprintf(w, "  %-8s allocated %d, freed %d, live %d", kind, s.Allocated, s.Freed, s.Live)
+		if s.LiveBytes > 0 {
+			fmt.Fprintf(w, " (%d bytes)", s.LiveBytes)
+		}
+		fmt.Fprintln(w)
+	}
+	for _, a := range live {
+		fmt.Fprintf(w, "\n%s %#x", a.Kind, a.Handle)
+		if a.Size > 0 {
+			fmt.Fprintf(w, " (%d bytes)", a.Size)
+		}
+		fmt.Fprintf(w, " created %s:\n%s", a.Created.Format(time.RFC3339Nano), a.Stack)
+	}
+	return len(live)
+}
+
+// reportLeaks writes the allocation report when objects are still alive.
+func (t *allocTracker) reportLeaks() {
+	if !t.enabled.Load() {
+		return
+	}
+	t.mu.Lock()
+	w, n := t.output, len(t.live)
+	t.mu.Unlock()
+	if n > 0 && w != nil {
+		WriteAllocationReport(w)
+	}
+}
+
+// note records a new object. It does nothing when tracking is disabled.
+func (t *allocTracker) note(kind AllocationKind, handle uintptr, size uint64) {
+	if handle == 0 || !t.enabled.Load() {
+		return
+	}
+	a := Allocation{Kind: kind, Handle: handle, Size: size, Created: time.Now(), Stack: callerStack()}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.live == nil {
+		return
+	}
+	t.live[allocKey{kind, handle}] = a
+	c := t.stats(kind)
+	c.Allocated++
+	c.Live++
+	c.LiveBytes += size
+}
+
+// forget records that an object was freed, or handed over to an owner that
+// frees it, such as a sampler added to a chain.
+func (t *allocTracker) forget(kind AllocationKind, handle uintptr) {
+	if handle == 0 || !t.enabled.Load() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.live[allocKey{kind, handle}]
+	if !ok {
+		return
+	}
+	delete(t.live, allocKey{kind, handle})
+	c := t.stats(kind)
+	c.Freed++
+	c.Live--
+	c.LiveBytes -= a.Size
+}
+
+// stats returns the counts of kind. t.mu must be held.
+func (t *allocTracker) stats(kind AllocationKind) *AllocationStats {
+	c := t.counts[kind]
+	if c == nil {
+		c = &AllocationStats{}
+		t.counts[kind] = c
+	}
+	return c
+}
+
+// noteState tracks a state buffer until the garbage collector releases it.
+func (t *allocTracker) noteState(buf []byte) {
+	if len(buf) == 0 || !t.enabled.Load() {
+		return
+	}
+	first := &buf[:1][0]
+	handle := uintptr(unsafe.Pointer(first))
+	t.note(AllocState, handle, uint64(cap(buf)))
+	runtime.SetFinalizer(first, func(*byte) { t.forget(AllocState, handle) })
+}
+
+// callerStack formats the current call stack without the frames of the
+// tracker itself.
+func callerStack() string {
+	var pcs [allocStackDepth]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	for {
+		f, more := frames.Next()
+		if !strings.HasSuffix(f.File, "/alloc_tracker.go") {
+			fmt.Fprintf(&b, "  %s\n      %s:%d\n", f.Function, f.File, f.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
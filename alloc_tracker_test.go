@@ -0,0 +1,92 @@
+package gollama
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AllocTrackerSuite struct{ BaseSuite }
+
+func (s *AllocTrackerSuite) TearDownTest() {
+	DisableAllocationTracking()
+	s.BaseSuite.TearDownTest()
+}
+
+func (s *AllocTrackerSuite) TestDisabledRecordsNothing() {
+	DisableAllocationTracking()
+	allocations.note(AllocModel, 0x10, 0)
+	s.False(AllocationTrackingEnabled())
+	s.Empty(LiveAllocations())
+}
+
+func (s *AllocTrackerSuite) TestNoteAndForget() {
+	EnableAllocationTracking(&bytes.Buffer{})
+	s.True(AllocationTrackingEnabled())
+
+	allocations.note(AllocModel, 0x10, 1024)
+	allocations.note(AllocContext, 0x20, 0)
+	live := LiveAllocations()
+	s.Require().Len(live, 2)
+	s.Equal(AllocModel, live[0].Kind)
+	s.Equal(uintptr(0x10), live[0].Handle)
+	s.Contains(live[0].Stack, "TestNoteAndForget")
+	s.NotContains(live[0].Stack, "alloc_tracker.go")
+
+	allocations.forget(AllocContext, 0x20)
+	allocations.forget(AllocContext, 0x20)
+	stats := AllocationStatistics()
+	s.Equal(AllocationStats{Allocated: 1, Live: 1, LiveBytes: 1024}, stats[AllocModel])
+	s.Equal(AllocationStats{Allocated: 1, Freed: 1}, stats[AllocContext])
+}
+
+func (s *AllocTrackerSuite) TestReportOnBackendFree() {
+	var out bytes.Buffer
+	EnableAllocationTracking(&out)
+	allocations.reportLeaks()
+	s.Empty(out.String())
+
+	allocations.note(AllocSampler, 0x30, 0)
+	allocations.reportLeaks()
+	report := out.String()
+	s.Contains(report, "gollama: 1 live allocation(s)")
+	s.Contains(report, "sampler  allocated 1, freed 0, live 1")
+	s.Contains(report, "sampler 0x30 created")
+	s.Contains(report, "TestReportOnBackendFree")
+}
+
+func (s *AllocTrackerSuite) TestStateBufferReleasedByGC() {
+	EnableAllocationTracking(&bytes.Buffer{})
+	buf := make([]byte, 4096)
+	allocations.noteState(buf)
+	s.Equal(1, AllocationStatistics()[AllocState].Live)
+	buf = nil
+	s.Eventually(func() bool {
+		runtime.GC()
+		return AllocationStatistics()[AllocState].Live == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *AllocTrackerSuite) TestTracksBatchesAndSamplers() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	EnableAllocationTracking(&bytes.Buffer{})
+
+	batch := Batch_init(4, 0, 1)
+	chain := Sampler_chain_init(Sampler_chain_default_params())
+	greedy := Sampler_init_greedy()
+	s.Equal(1, AllocationStatistics()[AllocBatch].Live)
+	s.Equal(2, AllocationStatistics()[AllocSampler].Live)
+
+	Sampler_chain_add(chain, greedy)
+	s.Equal(1, AllocationStatistics()[AllocSampler].Live)
+	Sampler_free(chain)
+	Batch_free(batch)
+	s.Empty(LiveAllocations())
+}
+
+func TestAllocTrackerSuite(t *testing.T) { suite.Run(t, new(AllocTrackerSuite)) }
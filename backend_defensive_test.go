@@ -425,6 +425,69 @@ func (s *BackendDefensiveSuite) TestNoPanicOnNilFunctionPointers() {
 	}, "Ggml_backend_load_all_from_path should return error, not panic with nil ggmlBackendLoadAllFromPath")
 }
 
+// TestModelAndSamplerWithoutSymbols tests that getters and sampler constructors
+// return zero values instead of panicking when symbols are missing
+func (s *BackendDefensiveSuite) TestModelAndSamplerWithoutSymbols() {
+	// Ensure library is not loaded
+	Cleanup()
+
+	// Save the current function pointers and state
+	savedNEmbd := llamaModelNEmbd
+	savedNLayer, savedNHead, savedNHeadKv := llamaModelNLayer, llamaModelNHead, llamaModelNHeadKv
+	savedNCtxTrain, savedRopeType := llamaModelNCtxTrain, llamaModelRopeType
+	savedGreedy := llamaSamplerInitGreedy
+	savedLoaded := isLoaded
+	savedHandle := libHandle
+
+	// Simulate library loaded but symbols missing
+	isLoaded = true
+	libHandle = 1 // Non-zero to indicate "loaded"
+	llamaModelNEmbd = nil
+	llamaModelNLayer, llamaModelNHead, llamaModelNHeadKv = nil, nil, nil
+	llamaModelNCtxTrain, llamaModelRopeType = nil, nil
+	llamaSamplerInitGreedy = nil
+
+	// Restore after test
+	defer func() {
+		llamaModelNEmbd = savedNEmbd
+		llamaModelNLayer, llamaModelNHead, llamaModelNHeadKv = savedNLayer, savedNHead, savedNHeadKv
+		llamaModelNCtxTrain, llamaModelRopeType = savedNCtxTrain, savedRopeType
+		llamaSamplerInitGreedy = savedGreedy
+		isLoaded = savedLoaded
+		libHandle = savedHandle
+	}()
+
+	s.Require().NotPanics(func() {
+		s.Equal(int32(0), Model_n_embd(1))
+		s.Equal(int32(0), Model_n_embd(0))
+	}, "Model_n_embd should return 0, not panic with nil llamaModelNEmbd")
+
+	s.Require().NotPanics(func() {
+		s.Zero(Model_n_layer(1))
+		s.Zero(Model_n_head(1))
+		s.Zero(Model_n_head_kv(1))
+		s.Zero(Model_n_ctx_train(1))
+		s.Equal(LLAMA_ROPE_TYPE_NONE, Model_rope_type(1))
+	}, "model shape getters should return zero values with missing symbols")
+
+	s.Require().NotPanics(func() {
+		s.Equal(LlamaSampler(0), Sampler_init_greedy())
+	}, "Sampler_init_greedy should return 0, not panic with nil llamaSamplerInitGreedy")
+
+	s.Require().NotPanics(func() {
+		s.Nil(Token_data_array_init(0))
+	}, "Token_data_array_init should return nil without a model")
+
+	_, err := ModelNEmbd(1)
+	s.ErrorIs(err, ErrFunctionNotFound)
+	_, err = ModelNEmbd(0)
+	s.ErrorIs(err, ErrModelNotLoaded)
+	_, err = SamplerInitGreedy()
+	s.ErrorIs(err, ErrFunctionNotFound)
+	_, err = TokenDataArrayInit(0)
+	s.ErrorIs(err, ErrModelNotLoaded)
+}
+
 func TestBackendDefensiveSuite(t *testing.T) {
 	suite.Run(t, new(BackendDefensiveSuite))
 }
@@ -0,0 +1,195 @@
+package gollama
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// backendPlugin is a GPU backend loaded with LoadBackend.
+type backendPlugin struct {
+	reg  GgmlBackendReg
+	path string
+}
+
+// backendPlugins holds the backends loaded with LoadBackend.
+var backendPlugins = struct {
+	sync.Mutex
+	m map[LlamaGpuBackend]backendPlugin
+}{m: make(map[LlamaGpuBackend]backendPlugin)}
+
+// LoadBackend loads a GPU backend at runtime, so a process started on the
+// CPU can enable acceleration without restarting. name is a backend name as
+// accepted by ParseGpuBackend, such as "cuda" or "vulkan". The backend
+// library (e.g. libggml-cuda.so or ggml-vulkan.dll) is looked up next to
+// the loaded llama.cpp library, then in the library cache, preferring the
+// build the bindings target.
+//
+// Models loaded afterwards can offload to the devices of the backend; models
+// already loaded keep their devices. Loading a backend twice returns the
+// registration of the first load.
+//
+// Example usage:
+//
+//	if _, err := gollama.LoadBackend("cuda"); err != nil {
+//		log.Printf("staying on the CPU: %v", err)
+//	}
+func LoadBackend(name string) (GgmlBackendReg, error) {
+	backend, err := pluginBackend(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := ensureLoaded(); err != nil {
+		return 0, err
+	}
+
+	backendPlugins.Lock()
+	defer backendPlugins.Unlock()
+	if p, ok := backendPlugins.m[backend]; ok {
+		return p.reg, nil
+	}
+	path, err := findBackendLibrary(backend, backendSearchDirs())
+	if err != nil {
+		return 0, err
+	}
+	reg, err := Ggml_backend_load(path)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrBackendInitFailed, backend, err)
+	}
+	backendPlugins.m[backend] = backendPlugin{reg: reg, path: path}
+	slog.Info("loaded GGML backend", "backend", backend.String(), "path", path)
+	return reg, nil
+}
+
+// UnloadBackend unregisters and unloads a backend loaded with LoadBackend.
+// Models and contexts using its devices must be freed first.
+func UnloadBackend(name string) error {
+	backend, err := pluginBackend(name)
+	if err != nil {
+		return err
+	}
+	backendPlugins.Lock()
+	defer backendPlugins.Unlock()
+	p, ok := backendPlugins.m[backend]
+	if !ok {
+		return fmt.Errorf("%w: %s was not loaded with LoadBackend", ErrBackendNotAvailable, backend)
+	}
+	if err := Ggml_backend_unload(p.reg); err != nil {
+		return err
+	}
+	delete(backendPlugins.m, backend)
+	return nil
+}
+
+// pluginBackend parses name as a backend that can be loaded as a plugin.
+func pluginBackend(name string) (LlamaGpuBackend, error) {
+	backend, err := ParseGpuBackend(name)
+	if err != nil {
+		return LLAMA_GPU_BACKEND_NONE, err
+	}
+	if backend == LLAMA_GPU_BACKEND_CPU || backend == LLAMA_GPU_BACKEND_NONE {
+		return LLAMA_GPU_BACKEND_NONE, fmt.Errorf("%w: %q is not a GPU backend", ErrInvalidParameter, name)
+	}
+	return backend, nil
+}
+
+// backendLibraryName returns the file name of the ggml plugin of backend on
+// goos, e.g. libggml-cuda.so.
+func backendLibraryName(backend LlamaGpuBackend, goos string) string {
+	return pluginLibraryName(strings.ToLower(backend.String()), goos)
+}
+
+// pluginLibraryName returns the file name of the ggml plugin named plugin
+// (e.g. "rpc") on goos.
+func pluginLibraryName(plugin, goos string) string {
+	base := "ggml-" + plugin
+	switch goos {
+	case "windows":
+		return base + ".dll"
+	case "darwin":
+		return "lib" + base + ".dylib"
+	default:
+		return "lib" + base + ".so"
+	}
+}
+
+// backendSearchDirs returns the directories LoadBackend searches, in order:
+// those of the loaded library, then the library cache.
+func backendSearchDirs() []string {
+	var dirs []string
+	libMutex.RLock()
+	if loadedLibPath != "" {
+		dirs = append(dirs, filepath.Dir(loadedLibPath))
+	}
+	libMutex.RUnlock()
+	if root := globalLoader.rootLibPath; root != "" {
+		dirs = append(dirs, root)
+	}
+	if d := globalLoader.downloader; d != nil {
+		dirs = append(dirs, d.GetCacheDir())
+	} else {
+		dirs = append(dirs, defaultLibraryCacheDir())
+	}
+	return dirs
+}
+
+// backendSearchDepth is how deep findBackendLibrary looks below each
+// directory: enough for <cache>/<release>/build/bin.
+const backendSearchDepth = 4
+
+// findBackendLibrary returns the plugin of backend found in dirs. Each
+// directory is searched down to backendSearchDepth levels, since cached
+// releases keep their libraries in subdirectories such as build/bin; within
+// a directory, paths naming the targeted llama.cpp build are preferred.
+func findBackendLibrary(backend LlamaGpuBackend, dirs []string) (string, error) {
+	return findPluginLibrary(backendLibraryName(backend, runtime.GOOS), dirs)
+}
+
+// findPluginLibrary returns the library file name found in dirs, searched
+// like findBackendLibrary does.
+func findPluginLibrary(name string, dirs []string) (string, error) {
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if dir == "" || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		var matches []string
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if rel, _ := filepath.Rel(dir, path); rel != "." && len(strings.Split(rel, string(filepath.Separator))) >= backendSearchDepth {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Name() == name {
+				matches = append(matches, path)
+			}
+			return nil
+		})
+		if len(matches) == 0 {
+			continue
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			return strings.Contains(matches[i], LlamaCppBuild) && !strings.Contains(matches[j], LlamaCppBuild)
+		})
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("%w: %s not found in %s", ErrBackendNotAvailable, name, strings.Join(dirs, string(os.PathListSeparator)))
+}
+
+// forgetBackendPlugins drops the backends of an unloaded library.
+func forgetBackendPlugins() {
+	backendPlugins.Lock()
+	defer backendPlugins.Unlock()
+	backendPlugins.m = make(map[LlamaGpuBackend]backendPlugin)
+}
@@ -0,0 +1,77 @@
+package gollama
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BackendPluginSuite struct{ BaseSuite }
+
+func (s *BackendPluginSuite) TestPluginBackendNames() {
+	b, err := pluginBackend("CUDA")
+	s.Require().NoError(err)
+	s.Equal(LLAMA_GPU_BACKEND_CUDA, b)
+
+	_, err = pluginBackend("cpu")
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = pluginBackend("tpu")
+	s.ErrorIs(err, ErrInvalidParameter)
+	s.ErrorIs(UnloadBackend("cpu"), ErrInvalidParameter)
+}
+
+func (s *BackendPluginSuite) TestBackendLibraryName() {
+	s.Equal("libggml-cuda.so", backendLibraryName(LLAMA_GPU_BACKEND_CUDA, "linux"))
+	s.Equal("ggml-vulkan.dll", backendLibraryName(LLAMA_GPU_BACKEND_VULKAN, "windows"))
+	s.Equal("libggml-metal.dylib", backendLibraryName(LLAMA_GPU_BACKEND_METAL, "darwin"))
+	s.Equal("libggml-hip.so", backendLibraryName(LLAMA_GPU_BACKEND_HIP, "linux"))
+}
+
+func (s *BackendPluginSuite) TestFindBackendLibrary() {
+	name := backendLibraryName(LLAMA_GPU_BACKEND_CUDA, runtime.GOOS)
+	empty := s.T().TempDir()
+	cache := s.T().TempDir()
+	for _, dir := range []string{"b1000/build/bin", "llama-" + LlamaCppBuild + "-cuda/build/bin"} {
+		s.Require().NoError(os.MkdirAll(filepath.Join(cache, dir), 0750))
+		s.Require().NoError(os.WriteFile(filepath.Join(cache, dir, name), nil, 0600))
+	}
+
+	path, err := findBackendLibrary(LLAMA_GPU_BACKEND_CUDA, []string{empty, cache})
+	s.Require().NoError(err)
+	s.Equal(filepath.Join(cache, "llama-"+LlamaCppBuild+"-cuda", "build", "bin", name), path)
+
+	_, err = findBackendLibrary(LLAMA_GPU_BACKEND_SYCL, []string{empty, cache})
+	s.ErrorIs(err, ErrBackendNotAvailable)
+}
+
+func (s *BackendPluginSuite) TestUnloadWithoutLoad() {
+	s.ErrorIs(UnloadBackend("opencl"), ErrBackendNotAvailable)
+}
+
+func (s *BackendPluginSuite) TestLoadBundledBackend() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	if _, err := findBackendLibrary(LLAMA_GPU_BACKEND_VULKAN, backendSearchDirs()); err != nil {
+		s.T().Skipf("no Vulkan backend library: %v", err)
+	}
+	// Ggml_backend_load creates the global downloader; keep later cache tests isolated
+	downloader := globalLoader.downloader
+	s.T().Cleanup(func() { globalLoader.downloader = downloader })
+	reg, err := LoadBackend("vulkan")
+	if err != nil {
+		// The plugin exists but its driver does not
+		s.ErrorIs(err, ErrBackendInitFailed)
+		return
+	}
+	again, err := LoadBackend("Vulkan")
+	s.Require().NoError(err)
+	s.Equal(reg, again)
+	s.NoError(UnloadBackend("vulkan"))
+	s.ErrorIs(UnloadBackend("vulkan"), ErrBackendNotAvailable)
+}
+
+func TestBackendPluginSuite(t *testing.T) { suite.Run(t, new(BackendPluginSuite)) }
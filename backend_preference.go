@@ -0,0 +1,142 @@
+package gollama
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ParseGpuBackend parses a backend name as accepted by
+// Config.PreferredBackend: cpu, cuda, metal, hip (or rocm), vulkan, opencl
+// or sycl, case-insensitively. "auto" returns the detected backend.
+func ParseGpuBackend(name string) (LlamaGpuBackend, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "auto":
+		return detectGpuBackend(), nil
+	case "cpu":
+		return LLAMA_GPU_BACKEND_CPU, nil
+	case "cuda":
+		return LLAMA_GPU_BACKEND_CUDA, nil
+	case "metal":
+		return LLAMA_GPU_BACKEND_METAL, nil
+	case "hip", "rocm":
+		return LLAMA_GPU_BACKEND_HIP, nil
+	case "vulkan":
+		return LLAMA_GPU_BACKEND_VULKAN, nil
+	case "opencl":
+		return LLAMA_GPU_BACKEND_OPENCL, nil
+	case "sycl":
+		return LLAMA_GPU_BACKEND_SYCL, nil
+	default:
+		return LLAMA_GPU_BACKEND_NONE, fmt.Errorf("%w: unknown backend %q", ErrInvalidParameter, name)
+	}
+}
+
+// parseBackendChain parses a comma-separated backend fallback chain.
+// An empty chain or a lone "auto" returns nil, meaning no preference.
+func parseBackendChain(chain string) ([]LlamaGpuBackend, error) {
+	chain = strings.TrimSpace(chain)
+	if chain == "" || strings.EqualFold(chain, "auto") {
+		return nil, nil
+	}
+	var backends []LlamaGpuBackend
+	seen := make(map[LlamaGpuBackend]bool)
+	for _, name := range strings.Split(chain, ",") {
+		b, err := ParseGpuBackend(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[b] {
+			seen[b] = true
+			backends = append(backends, b)
+		}
+	}
+	return backends, nil
+}
+
+// preferredGpuBackends returns the backend chain of the global config, or
+// nil when detection should be used.
+func preferredGpuBackends() []LlamaGpuBackend {
+	if globalConfig == nil {
+		return nil
+	}
+	backends, err := parseBackendChain(globalConfig.PreferredBackend)
+	if err != nil {
+		return nil
+	}
+	return backends
+}
+
+// bundledBackend is the backend of the embedded library build: the macOS
+// build uses Metal, the others run on the CPU.
+func bundledBackend(goos string) LlamaGpuBackend {
+	if goos == "darwin" {
+		return LLAMA_GPU_BACKEND_METAL
+	}
+	return LLAMA_GPU_BACKEND_CPU
+}
+
+// backendForName maps a ggml backend or device name (e.g. "CUDA0",
+// "Vulkan1", "MTL0", "ROCm0") to its backend.
+func backendForName(name string) LlamaGpuBackend {
+	switch n := strings.ToUpper(name); {
+	case n == "CPU":
+		return LLAMA_GPU_BACKEND_CPU
+	case strings.HasPrefix(n, "METAL"), strings.HasPrefix(n, "MTL"):
+		return LLAMA_GPU_BACKEND_METAL
+	case strings.HasPrefix(n, "CUDA"):
+		return LLAMA_GPU_BACKEND_CUDA
+	case strings.HasPrefix(n, "VULKAN"):
+		return LLAMA_GPU_BACKEND_VULKAN
+	case strings.HasPrefix(n, "ROCM"), strings.HasPrefix(n, "HIP"):
+		return LLAMA_GPU_BACKEND_HIP
+	case strings.HasPrefix(n, "SYCL"):
+		return LLAMA_GPU_BACKEND_SYCL
+	case strings.Contains(n, "OPENCL"):
+		return LLAMA_GPU_BACKEND_OPENCL
+	default:
+		return LLAMA_GPU_BACKEND_NONE
+	}
+}
+
+// applyPreferredDevices restricts params to the devices of the first backend
+// in chain that has any. A chain reaching "cpu" first disables offloading.
+// params is returned unchanged when there is no preference or none of the
+// backends has a device.
+func applyPreferredDevices(params LlamaModelParams, chain string) LlamaModelParams {
+	backends, err := parseBackendChain(chain)
+	if err != nil || len(backends) == 0 || ensureLoaded() != nil {
+		return params
+	}
+
+	byBackend := make(map[LlamaGpuBackend][]GgmlBackendDevice)
+	if count, err := Ggml_backend_dev_count(); err == nil {
+		for i := uint64(0); i < count; i++ {
+			dev, err := Ggml_backend_dev_get(i)
+			if err != nil || dev == 0 {
+				continue
+			}
+			name, _ := Ggml_backend_dev_name(dev)
+			b := backendForName(name)
+			byBackend[b] = append(byBackend[b], dev)
+		}
+	}
+
+	for _, b := range backends {
+		if b == LLAMA_GPU_BACKEND_CPU {
+			params.NGpuLayers = 0
+			params.Devices = 0
+			return params
+		}
+		devices := byBackend[b]
+		if len(devices) == 0 {
+			continue
+		}
+		params.SetDevices(devices)
+		return params
+	}
+
+	slog.Warn("no device found for the preferred backends, using library defaults",
+		"preferred_backend", chain)
+	return params
+}
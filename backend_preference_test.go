@@ -0,0 +1,69 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BackendPreferenceSuite struct{ BaseSuite }
+
+func (s *BackendPreferenceSuite) TestParseChain() {
+	chain, err := parseBackendChain(" Vulkan, rocm ,cpu,vulkan")
+	s.Require().NoError(err)
+	s.Equal([]LlamaGpuBackend{LLAMA_GPU_BACKEND_VULKAN, LLAMA_GPU_BACKEND_HIP, LLAMA_GPU_BACKEND_CPU}, chain)
+
+	chain, err = parseBackendChain("auto")
+	s.NoError(err)
+	s.Nil(chain)
+
+	_, err = parseBackendChain("cuda,tpu")
+	s.ErrorIs(err, ErrInvalidParameter)
+	s.Error(NewConfig(WithPreferredBackend("tpu")).Validate())
+}
+
+func (s *BackendPreferenceSuite) TestDetectHonoursPreference() {
+	s.Require().NoError(Configure(WithPreferredBackend("sycl,cpu")))
+	s.Equal(LLAMA_GPU_BACKEND_SYCL, DetectGpuBackend())
+
+	s.T().Setenv("GOLLAMA_BACKEND", "hip")
+	s.Equal("hip", LoadConfigFromEnv().PreferredBackend)
+}
+
+func (s *BackendPreferenceSuite) TestAssetPatterns() {
+	d := &LibraryDownloader{}
+
+	pattern, err := d.GetAssetPatternForBackend("linux", "amd64", LLAMA_GPU_BACKEND_VULKAN)
+	s.NoError(err)
+	s.Equal("llama-.*-bin-ubuntu-vulkan-x64.zip", pattern)
+	pattern, err = d.GetAssetPatternForBackend("windows", "arm64", LLAMA_GPU_BACKEND_OPENCL)
+	s.NoError(err)
+	s.Equal("llama-.*-bin-win-opencl-.*-arm64.zip", pattern)
+	_, err = d.GetAssetPatternForBackend("darwin", "arm64", LLAMA_GPU_BACKEND_CUDA)
+	s.ErrorIs(err, ErrUnsupportedPlatform)
+
+	s.Require().NoError(Configure(WithPreferredBackend("cuda,metal,cpu")))
+	patterns, err := d.GetPlatformAssetPatterns("linux", "amd64")
+	s.NoError(err)
+	s.Equal([]string{"llama-.*-bin-ubuntu-cuda-.*-x64.zip", "llama-.*-bin-ubuntu-x64.zip"}, patterns)
+
+	pattern, err = d.GetPlatformAssetPatternForPlatform("darwin", "arm64")
+	s.NoError(err)
+	s.Equal("llama-.*-bin-macos-arm64.zip", pattern)
+}
+
+func (s *BackendPreferenceSuite) TestPreferredDevices() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+
+	lib := LlamaModelParams{NGpuLayers: 999}
+	p := applyPreferredDevices(lib, "cpu")
+	s.Equal(int32(0), p.NGpuLayers)
+	s.Zero(p.Devices)
+
+	s.Equal(lib, applyPreferredDevices(lib, ""))
+	s.Equal(lib, applyPreferredDevices(lib, "sycl"), "backends without devices keep the defaults")
+}
+
+func TestBackendPreferenceSuite(t *testing.T) { suite.Run(t, new(BackendPreferenceSuite)) }
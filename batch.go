@@ -0,0 +1,358 @@
+package gollama
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// BatchOrigin records how the memory of a Batch was obtained, which decides
+// whether freeing it releases native memory.
+type BatchOrigin int
+
+const (
+	// BatchOwned batches are allocated by llama_batch_init and must be
+	// freed.
+	BatchOwned BatchOrigin = iota
+	// BatchView batches are built by llama_batch_get_one around Go memory
+	// and must never be freed.
+	BatchView
+)
+
+// String returns the origin name.
+func (o BatchOrigin) String() string {
+	switch o {
+	case BatchOwned:
+		return "owned"
+	case BatchView:
+		return "view"
+	default:
+		return fmt.Sprintf("BatchOrigin(%d)", int(o))
+	}
+}
+
+// Batch is a llama_batch that knows where it came from. Free releases
+// batches allocated with NewBatch on every platform and ignores views made
+// with NewBatchView, and it is safe to call more than once.
+//
+// Example usage:
+//
+//	batch, err := gollama.NewBatch(512, 0, 1)
+//	if err != nil {
+//		return err
+//	}
+//	defer batch.Free()
+type Batch struct {
+	mu     sync.Mutex
+	batch  LlamaBatch
+	origin BatchOrigin
+	freed  bool
+	// tokens keeps the memory of a view alive
+	tokens []LlamaToken
+}
+
+// NewBatch allocates a batch like Batch_init: room for nTokens tokens, or
+// embedding rows of embd floats when embd is non-zero, each belonging to
+// at most nSeqMax sequences.
+func NewBatch(nTokens, embd, nSeqMax int32) (*Batch, error) {
+	if nTokens <= 0 || embd < 0 || nSeqMax <= 0 {
+		return nil, fmt.Errorf("%w: nTokens and nSeqMax must be positive", ErrInvalidParameter)
+	}
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+	batch := Batch_init(nTokens, embd, nSeqMax)
+	if batch.Pos == nil {
+		return nil, ErrBatchAllocationFailed
+	}
+	return &Batch{batch: batch, origin: BatchOwned}, nil
+}
+
+// NewBatchView wraps tokens in a batch like Batch_get_one, without
+// copying. The tokens must not be modified while the batch is in use.
+func NewBatchView(tokens []LlamaToken) (*Batch, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: no tokens", ErrInvalidParameter)
+	}
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+	batch := Batch_get_one(tokens)
+	if batch.Token == nil {
+		return nil, ErrBatchAllocationFailed
+	}
+	return &Batch{batch: batch, origin: BatchView, tokens: tokens}, nil
+}
+
+// Origin reports how the batch was obtained.
+func (b *Batch) Origin() BatchOrigin {
+	return b.origin
+}
+
+// Batch returns the llama_batch to pass to Decode or Encode, or a zero
+// batch once freed.
+func (b *Batch) Batch() LlamaBatch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.freed {
+		return LlamaBatch{}
+	}
+	return b.batch
+}
+
+// Freed reports whether Free was called.
+func (b *Batch) Freed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.freed
+}
+
+// Free releases the native memory of owned batches. Views only drop their
+// reference to the tokens. Later calls do nothing.
+func (b *Batch) Free() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.freed {
+		return
+	}
+	b.freed = true
+	if b.origin == BatchOwned {
+		Batch_free(b.batch)
+	}
+	b.batch = LlamaBatch{}
+	b.tokens = nil
+}
+
+// ownedBatches holds the batches allocated by Batch_init and not freed yet,
+// keyed by their pos array, which llama_batch_get_one never sets. It lets
+// Batch_free tell owned batches from views and ignore double frees.
+var ownedBatches = struct {
+	sync.Mutex
+	m map[uintptr]LlamaBatch
+}{m: make(map[uintptr]LlamaBatch)}
+
+// trackBatch records a batch allocated by llama_batch_init.
+func trackBatch(batch LlamaBatch) {
+	if batch.Pos == nil {
+		return
+	}
+	ownedBatches.Lock()
+	ownedBatches.m[uintptr(unsafe.Pointer(batch.Pos))] = batch
+	ownedBatches.Unlock()
+	allocations.note(AllocBatch, uintptr(unsafe.Pointer(batch.Pos)), 0)
+}
+
+// untrackBatch forgets batch and reports whether it was owned and not yet
+// freed, i.e. whether the caller must free it.
+func untrackBatch(batch LlamaBatch) bool {
+	if batch.Pos == nil {
+		return false
+	}
+	key := uintptr(unsafe.Pointer(batch.Pos))
+	ownedBatches.Lock()
+	defer ownedBatches.Unlock()
+	if _, ok := ownedBatches.m[key]; !ok {
+		return false
+	}
+	delete(ownedBatches.m, key)
+	allocations.forget(AllocBatch, key)
+	return true
+}
+
+// ownedBatchList returns the owned batches not freed yet.
+func ownedBatchList() []LlamaBatch {
+	ownedBatches.Lock()
+	defer ownedBatches.Unlock()
+	batches := make([]LlamaBatch, 0, len(ownedBatches.m))
+	for _, b := range ownedBatches.m {
+		batches = append(batches, b)
+	}
+	return batches
+}
+
+// liveBatches returns the number of owned batches not freed yet.
+func liveBatches() int {
+	ownedBatches.Lock()
+	defer ownedBatches.Unlock()
+	return len(ownedBatches.m)
+}
+
+// TokenBatch builds llama_batch values with explicit positions, sequence ids
+// and per-token output flags, the equivalent of llama.cpp's common_batch_add.
+// Use it instead of Batch_get_one when several sequences share a batch or
+// logits are needed for more than the last token.
+//
+// Example usage:
+//
+//	batch, err := gollama.NewTokenBatch(512, 1)
+//	if err != nil {
+//		return err
+//	}
+//	defer batch.Free()
+//	for i, tok := range tokens {
+//		_ = batch.Add(tok, gollama.LlamaPos(i), []gollama.LlamaSeqId{0}, i == len(tokens)-1)
+//	}
+//	err = gollama.Decode(ctx, batch.Batch())
+type TokenBatch struct {
+	batch    LlamaBatch
+	capacity int32
+	nSeqMax  int32
+}
+
+// NewTokenBatch allocates room for capacity tokens, each belonging to at
+// most nSeqMax sequences.
+func NewTokenBatch(capacity, nSeqMax int32) (*TokenBatch, error) {
+	if capacity <= 0 || nSeqMax <= 0 {
+		return nil, fmt.Errorf("%w: capacity and nSeqMax must be positive", ErrInvalidParameter)
+	}
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+	batch := Batch_init(capacity, 0, nSeqMax)
+	if batch.Token == nil {
+		return nil, ErrBatchAllocationFailed
+	}
+	batch.NTokens = 0
+	return &TokenBatch{batch: batch, capacity: capacity, nSeqMax: nSeqMax}, nil
+}
+
+// Add appends token at position pos for seqIDs. logits requests output for
+// this token.
+func (b *TokenBatch) Add(token LlamaToken, pos LlamaPos, seqIDs []LlamaSeqId, logits bool) error {
+	if b.batch.Token == nil {
+		return fmt.Errorf("%w: batch is freed", ErrInvalidParameter)
+	}
+	if len(seqIDs) == 0 || int32(len(seqIDs)) > b.nSeqMax {
+		return fmt.Errorf("%w: need between 1 and %d sequence ids, got %d", ErrInvalidParameter, b.nSeqMax, len(seqIDs))
+	}
+	i := b.batch.NTokens
+	if i >= b.capacity {
+		return fmt.Errorf("%w: batch is full (%d tokens)", ErrBatchFull, b.capacity)
+	}
+
+	unsafe.Slice(b.batch.Token, b.capacity)[i] = token
+	unsafe.Slice(b.batch.Pos, b.capacity)[i] = pos
+	unsafe.Slice(b.batch.NSeqId, b.capacity)[i] = int32(len(seqIDs))
+	copy(unsafe.Slice(unsafe.Slice(b.batch.SeqId, b.capacity)[i], b.nSeqMax), seqIDs)
+	var flag int8
+	if logits {
+		flag = 1
+	}
+	unsafe.Slice(b.batch.Logits, b.capacity)[i] = flag
+	b.batch.NTokens++
+	return nil
+}
+
+// Clear empties the batch so it can be refilled.
+func (b *TokenBatch) Clear() {
+	b.batch.NTokens = 0
+}
+
+// Len returns the number of tokens in the batch.
+func (b *TokenBatch) Len() int {
+	return int(b.batch.NTokens)
+}
+
+// Cap returns the number of tokens the batch can hold.
+func (b *TokenBatch) Cap() int {
+	return int(b.capacity)
+}
+
+// Batch returns the llama_batch to pass to Decode or Encode.
+func (b *TokenBatch) Batch() LlamaBatch {
+	return b.batch
+}
+
+// Free releases the batch. It is safe to call more than once.
+func (b *TokenBatch) Free() {
+	if b.batch.Token != nil {
+		Batch_free(b.batch)
+		b.batch = LlamaBatch{}
+	}
+}
+
+// DecodeTokens decodes tokens into sequence seqID, after the positions the
+// sequence already holds, in chunks of at most N_batch(ctx) tokens, so
+// prompts longer than a batch need no special handling. Logits are
+// requested for the last token only, for sampling the next one.
+//
+// Example usage:
+//
+//	if err := gollama.DecodeTokens(ctx, promptTokens, 0); err != nil {
+//		return err
+//	}
+//	token := gollama.Sampler_sample(sampler, ctx, -1)
+func DecodeTokens(ctx LlamaContext, tokens []LlamaToken, seqID LlamaSeqId) error {
+	return DecodeChunked(ctx, tokens, seqID, 0)
+}
+
+// DecodeChunked is DecodeTokens with chunks of at most chunk tokens; chunk
+// <= 0, or larger than N_batch(ctx), uses N_batch(ctx). Smaller chunks
+// bound the duration of each decode, e.g. to interleave a long prompt with
+// other work. A chunk the memory has no room for is retried in halves down
+// to single tokens before failing with a NoKvSlotError. When a chunk
+// fails, the chunks before it stay in the sequence.
+func DecodeChunked(ctx LlamaContext, tokens []LlamaToken, seqID LlamaSeqId, chunk int) error {
+	if err := ensureLoaded(); err != nil {
+		return err
+	}
+	if ctx == 0 {
+		return ErrContextNotCreated
+	}
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return err
+	}
+	if nBatch := int(N_batch(ctx)); chunk <= 0 || chunk > nBatch {
+		chunk = nBatch
+	}
+	pos := Memory_seq_pos_max(ctx, seqID) + 1
+	return decodeChunks(tokens, pos, seqID, chunk, nil, func(batch LlamaBatch) error {
+		return Decode(ctx, batch)
+	})
+}
+
+// decodeChunks passes tokens to decode in batches of at most chunk tokens
+// of sequence seqID, starting at position pos, with logits for the last
+// token. A batch failing with ErrNoKvSlot is retried in halves, as
+// llama.cpp's server does. If fit is not nil, it is called with the
+// position and size of every batch before it is filled and returns the
+// position to use instead, so the caller can make room first.
+func decodeChunks(tokens []LlamaToken, pos LlamaPos, seqID LlamaSeqId, chunk int, fit func(pos LlamaPos, n int) (LlamaPos, error), decode func(LlamaBatch) error) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	batch, err := NewTokenBatch(int32(min(chunk, len(tokens))), 1)
+	if err != nil {
+		return err
+	}
+	defer batch.Free()
+
+	seq := []LlamaSeqId{seqID}
+	size := batch.Cap()
+	for start := 0; start < len(tokens); {
+		batch.Clear()
+		end := min(start+size, len(tokens))
+		if fit != nil {
+			if pos, err = fit(pos, end-start); err != nil {
+				return err
+			}
+		}
+		for i := start; i < end; i++ {
+			if err := batch.Add(tokens[i], pos+LlamaPos(i-start), seq, i == len(tokens)-1); err != nil {
+				return err
+			}
+		}
+		if err := decode(batch.Batch()); err != nil {
+			// A smaller batch may fit where this one did not
+			if errors.Is(err, ErrNoKvSlot) && end-start > 1 {
+				size = (end - start) / 2
+				continue
+			}
+			return fmt.Errorf("decoding tokens %d-%d: %w", start, end, err)
+		}
+		pos += LlamaPos(end - start)
+		start = end
+	}
+	return nil
+}
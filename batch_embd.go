@@ -0,0 +1,148 @@
+package gollama
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Batch_init_embd allocates a batch that carries nTokens embedding vectors of
+// nEmbd floats each instead of token ids. Free it with Batch_free.
+func Batch_init_embd(nTokens, nEmbd, nSeqMax int32) (LlamaBatch, error) {
+	if nTokens <= 0 || nEmbd <= 0 || nSeqMax <= 0 {
+		return LlamaBatch{}, fmt.Errorf("%w: nTokens, nEmbd and nSeqMax must be positive", ErrInvalidParameter)
+	}
+	if err := ensureLoaded(); err != nil {
+		return LlamaBatch{}, err
+	}
+	batch := Batch_init(nTokens, nEmbd, nSeqMax)
+	if batch.Embd == nil {
+		return LlamaBatch{}, ErrBatchAllocationFailed
+	}
+	return batch, nil
+}
+
+// EmbdBatch builds token-free batches from raw float32 embeddings, such as
+// the output of a projector or a custom encoder. Each row must match the
+// embedding size of the model the batch is decoded with.
+//
+// Example usage:
+//
+//	batch, err := gollama.NewEmbdBatch(int32(len(rows)), model.NEmbd, 1)
+//	if err != nil {
+//		return err
+//	}
+//	defer batch.Free()
+//	for i, row := range rows {
+//		_ = batch.Add(row, gollama.LlamaPos(i), []gollama.LlamaSeqId{0}, i == len(rows)-1)
+//	}
+//	err = gollama.Decode(ctx, batch.Batch())
+type EmbdBatch struct {
+	batch    LlamaBatch
+	capacity int32
+	nEmbd    int32
+	nSeqMax  int32
+}
+
+// NewEmbdBatch allocates room for capacity embedding rows of nEmbd floats,
+// each belonging to at most nSeqMax sequences.
+func NewEmbdBatch(capacity, nEmbd, nSeqMax int32) (*EmbdBatch, error) {
+	batch, err := Batch_init_embd(capacity, nEmbd, nSeqMax)
+	if err != nil {
+		return nil, err
+	}
+	batch.NTokens = 0
+	return &EmbdBatch{batch: batch, capacity: capacity, nEmbd: nEmbd, nSeqMax: nSeqMax}, nil
+}
+
+// Add appends one embedding row at position pos for seqIDs. logits requests
+// output (logits or embeddings) for this row.
+func (b *EmbdBatch) Add(embd []float32, pos LlamaPos, seqIDs []LlamaSeqId, logits bool) error {
+	if b.batch.Embd == nil {
+		return fmt.Errorf("%w: batch is freed", ErrInvalidParameter)
+	}
+	if int32(len(embd)) != b.nEmbd {
+		return fmt.Errorf("%w: embedding has %d values, batch expects %d", ErrInvalidParameter, len(embd), b.nEmbd)
+	}
+	if len(seqIDs) == 0 || int32(len(seqIDs)) > b.nSeqMax {
+		return fmt.Errorf("%w: need between 1 and %d sequence ids, got %d", ErrInvalidParameter, b.nSeqMax, len(seqIDs))
+	}
+	i := b.batch.NTokens
+	if i >= b.capacity {
+		return fmt.Errorf("%w: batch is full (%d rows)", ErrBatchFull, b.capacity)
+	}
+
+	rows := unsafe.Slice(b.batch.Embd, int(b.capacity)*int(b.nEmbd))
+	copy(rows[int(i)*int(b.nEmbd):], embd)
+	unsafe.Slice(b.batch.Pos, b.capacity)[i] = pos
+	unsafe.Slice(b.batch.NSeqId, b.capacity)[i] = int32(len(seqIDs))
+	copy(unsafe.Slice(unsafe.Slice(b.batch.SeqId, b.capacity)[i], b.nSeqMax), seqIDs)
+	var flag int8
+	if logits {
+		flag = 1
+	}
+	unsafe.Slice(b.batch.Logits, b.capacity)[i] = flag
+	b.batch.NTokens++
+	return nil
+}
+
+// Clear empties the batch so it can be refilled.
+func (b *EmbdBatch) Clear() {
+	b.batch.NTokens = 0
+}
+
+// Len returns the number of rows in the batch.
+func (b *EmbdBatch) Len() int {
+	return int(b.batch.NTokens)
+}
+
+// Batch returns the llama_batch to pass to Decode or Encode.
+func (b *EmbdBatch) Batch() LlamaBatch {
+	return b.batch
+}
+
+// Free releases the batch. It is safe to call more than once.
+func (b *EmbdBatch) Free() {
+	if b.batch.Embd != nil {
+		Batch_free(b.batch)
+		b.batch = LlamaBatch{}
+	}
+}
+
+// Decode_embd decodes embd, a row-major matrix of nEmbd-sized embeddings, into
+// sequence seqID starting at position nPast. Rows are submitted in batches of
+// at most nBatch and output is requested for the last row only. It returns
+// the position following the last row.
+func Decode_embd(ctx LlamaContext, embd []float32, nEmbd int32, nPast LlamaPos, seqID LlamaSeqId, nBatch int32) (LlamaPos, error) {
+	if ctx == 0 {
+		return nPast, ErrContextNotCreated
+	}
+	if nEmbd <= 0 || len(embd) == 0 || len(embd)%int(nEmbd) != 0 {
+		return nPast, fmt.Errorf("%w: embeddings length %d is not a multiple of %d", ErrInvalidParameter, len(embd), nEmbd)
+	}
+	nRows := int32(len(embd) / int(nEmbd))
+	if nBatch <= 0 || nBatch > nRows {
+		nBatch = nRows
+	}
+
+	batch, err := NewEmbdBatch(nBatch, nEmbd, 1)
+	if err != nil {
+		return nPast, err
+	}
+	defer batch.Free()
+
+	seq := []LlamaSeqId{seqID}
+	for start := int32(0); start < nRows; start += nBatch {
+		batch.Clear()
+		end := min(start+nBatch, nRows)
+		for row := start; row < end; row++ {
+			values := embd[int(row)*int(nEmbd) : int(row+1)*int(nEmbd)]
+			if err := batch.Add(values, nPast+LlamaPos(row), seq, row == nRows-1); err != nil {
+				return nPast, err
+			}
+		}
+		if err := Decode(ctx, batch.Batch()); err != nil {
+			return nPast + LlamaPos(start), err
+		}
+	}
+	return nPast + LlamaPos(nRows), nil
+}
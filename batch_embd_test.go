@@ -0,0 +1,59 @@
+package gollama
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type EmbdBatchSuite struct{ BaseSuite }
+
+func (s *EmbdBatchSuite) SetupTest() {
+	s.BaseSuite.SetupTest()
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+}
+
+func (s *EmbdBatchSuite) TestInitEmbd() {
+	batch, err := Batch_init_embd(4, 8, 1)
+	s.Require().NoError(err)
+	defer Batch_free(batch)
+	s.NotNil(batch.Embd)
+	s.Nil(batch.Token)
+
+	_, err = Batch_init_embd(0, 8, 1)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *EmbdBatchSuite) TestAddRows() {
+	batch, err := NewEmbdBatch(2, 3, 2)
+	s.Require().NoError(err)
+	defer batch.Free()
+
+	s.Require().NoError(batch.Add([]float32{1, 2, 3}, 5, []LlamaSeqId{0}, false))
+	s.Require().NoError(batch.Add([]float32{4, 5, 6}, 6, []LlamaSeqId{0, 1}, true))
+	s.Equal(2, batch.Len())
+	s.ErrorIs(batch.Add([]float32{7, 8, 9}, 7, []LlamaSeqId{0}, false), ErrBatchFull)
+	s.ErrorIs(batch.Add([]float32{1}, 7, []LlamaSeqId{0}, false), ErrInvalidParameter)
+
+	b := batch.Batch()
+	s.Equal([]float32{1, 2, 3, 4, 5, 6}, unsafe.Slice(b.Embd, 6))
+	s.Equal([]LlamaPos{5, 6}, unsafe.Slice(b.Pos, 2))
+	s.Equal([]int32{1, 2}, unsafe.Slice(b.NSeqId, 2))
+	s.Equal([]LlamaSeqId{0, 1}, unsafe.Slice(unsafe.Slice(b.SeqId, 2)[1], 2))
+	s.Equal([]int8{0, 1}, unsafe.Slice(b.Logits, 2))
+
+	batch.Clear()
+	s.Equal(0, batch.Len())
+}
+
+func (s *EmbdBatchSuite) TestDecodeEmbdValidation() {
+	_, err := Decode_embd(0, []float32{1}, 1, 0, 0, 1)
+	s.ErrorIs(err, ErrContextNotCreated)
+	_, err = Decode_embd(1, []float32{1, 2, 3}, 2, 0, 0, 1)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func TestEmbdBatchSuite(t *testing.T) { suite.Run(t, new(EmbdBatchSuite)) }
@@ -0,0 +1,171 @@
+package gollama
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TokenBatchSuite struct{ BaseSuite }
+
+func (s *TokenBatchSuite) SetupTest() {
+	s.BaseSuite.SetupTest()
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+}
+
+func (s *TokenBatchSuite) TestAddTokens() {
+	batch, err := NewTokenBatch(3, 2)
+	s.Require().NoError(err)
+	defer batch.Free()
+	s.Equal(3, batch.Cap())
+
+	s.Require().NoError(batch.Add(10, 0, []LlamaSeqId{0}, false))
+	s.Require().NoError(batch.Add(11, 1, []LlamaSeqId{0, 1}, false))
+	s.Require().NoError(batch.Add(12, 2, []LlamaSeqId{1}, true))
+	s.ErrorIs(batch.Add(13, 3, []LlamaSeqId{0}, false), ErrBatchFull)
+	s.ErrorIs(batch.Add(13, 3, []LlamaSeqId{0, 1, 2}, false), ErrInvalidParameter)
+
+	b := batch.Batch()
+	s.Equal(int32(3), b.NTokens)
+	s.Equal([]LlamaToken{10, 11, 12}, unsafe.Slice(b.Token, 3))
+	s.Equal([]LlamaPos{0, 1, 2}, unsafe.Slice(b.Pos, 3))
+	s.Equal([]int32{1, 2, 1}, unsafe.Slice(b.NSeqId, 3))
+	s.Equal([]LlamaSeqId{0, 1}, unsafe.Slice(unsafe.Slice(b.SeqId, 3)[1], 2))
+	s.Equal([]int8{0, 0, 1}, unsafe.Slice(b.Logits, 3))
+
+	batch.Clear()
+	s.Equal(0, batch.Len())
+	batch.Free()
+	s.ErrorIs(batch.Add(1, 0, []LlamaSeqId{0}, false), ErrInvalidParameter)
+}
+
+func (s *TokenBatchSuite) TestDecodeChunks() {
+	tokens := []LlamaToken{10, 11, 12, 13, 14, 15, 16}
+	var pos []LlamaPos
+	var logits []int8
+	var sizes []int32
+	err := decodeChunks(tokens, 5, 2, 3, nil, func(b LlamaBatch) error {
+		sizes = append(sizes, b.NTokens)
+		pos = append(pos, unsafe.Slice(b.Pos, b.NTokens)...)
+		logits = append(logits, unsafe.Slice(b.Logits, b.NTokens)...)
+		s.Equal(LlamaSeqId(2), *unsafe.Slice(b.SeqId, b.NTokens)[0])
+		return nil
+	})
+	s.Require().NoError(err)
+	s.Equal([]int32{3, 3, 1}, sizes)
+	s.Equal([]LlamaPos{5, 6, 7, 8, 9, 10, 11}, pos)
+	s.Equal([]int8{0, 0, 0, 0, 0, 0, 1}, logits)
+
+	calls := 0
+	err = decodeChunks(tokens, 0, 0, 4, nil, func(LlamaBatch) error {
+		calls++
+		return ErrContextFull
+	})
+	s.ErrorIs(err, ErrContextFull)
+	s.ErrorContains(err, "tokens 0-4")
+	s.Equal(1, calls)
+
+	var fits []int
+	pos = nil
+	fit := func(p LlamaPos, n int) (LlamaPos, error) {
+		fits = append(fits, int(p), n)
+		return p - 2, nil
+	}
+	err = decodeChunks(tokens, 5, 0, 4, fit, func(b LlamaBatch) error {
+		pos = append(pos, unsafe.Slice(b.Pos, b.NTokens)...)
+		return nil
+	})
+	s.Require().NoError(err)
+	s.Equal([]int{5, 4, 7, 3}, fits)
+	s.Equal([]LlamaPos{3, 4, 5, 6, 5, 6, 7}, pos, "batches start where fit says")
+
+	s.NoError(decodeChunks(nil, 0, 0, 4, nil, nil))
+	s.ErrorIs(DecodeTokens(0, tokens, 0), ErrContextNotCreated)
+}
+
+func (s *TokenBatchSuite) TestDecodeChunksRetriesWithoutKvSlot() {
+	var sizes []int32
+	var pos []LlamaPos
+	err := decodeChunks([]LlamaToken{1, 2, 3, 4, 5, 6, 7}, 0, 0, 8, nil, func(b LlamaBatch) error {
+		sizes = append(sizes, b.NTokens)
+		if b.NTokens > 2 {
+			return &NoKvSlotError{Batch: int(b.NTokens)}
+		}
+		pos = append(pos, unsafe.Slice(b.Pos, b.NTokens)...)
+		return nil
+	})
+	s.Require().NoError(err)
+	s.Equal([]int32{7, 3, 1, 1, 1, 1, 1, 1, 1}, sizes)
+	s.Equal([]LlamaPos{0, 1, 2, 3, 4, 5, 6}, pos)
+
+	err = decodeChunks([]LlamaToken{1, 2}, 0, 0, 8, nil, func(b LlamaBatch) error {
+		return &NoKvSlotError{Batch: int(b.NTokens)}
+	})
+	s.ErrorIs(err, ErrNoKvSlot)
+	s.ErrorContains(err, "tokens 0-1")
+}
+
+func (s *TokenBatchSuite) TestInvalidSize() {
+	_, err := NewTokenBatch(0, 1)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *TokenBatchSuite) TestContextRequiresModel() {
+	_, err := NewContext(nil, Context_default_params())
+	s.ErrorIs(err, ErrModelNotLoaded)
+	s.Equal(LlamaPos(-1), Memory_seq_pos_max(0, 0))
+	s.False(Memory_seq_rm(0, 0, 0, -1))
+}
+
+func (s *TokenBatchSuite) TestOwnedBatchFree() {
+	live := liveBatches()
+	batch, err := NewBatch(8, 0, 1)
+	s.Require().NoError(err)
+	s.Equal(BatchOwned, batch.Origin())
+	s.Equal(live+1, liveBatches())
+	s.NotNil(batch.Batch().Pos)
+
+	batch.Free()
+	s.True(batch.Freed())
+	s.Equal(live, liveBatches())
+	s.Nil(batch.Batch().Token)
+	s.NotPanics(batch.Free)
+}
+
+func (s *TokenBatchSuite) TestBatchViewIsNotFreed() {
+	live := liveBatches()
+	batch, err := NewBatchView([]LlamaToken{1, 2, 3})
+	s.Require().NoError(err)
+	s.Equal(BatchView, batch.Origin())
+	s.Equal(int32(3), batch.Batch().NTokens)
+	s.Equal(live, liveBatches())
+	batch.Free()
+	s.True(batch.Freed())
+
+	_, err = NewBatchView(nil)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = NewBatch(0, 0, 1)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *TokenBatchSuite) TestBatchFreeIsIdempotent() {
+	live := liveBatches()
+	raw := Batch_init(4, 0, 1)
+	s.Require().NotNil(raw.Pos)
+	s.Equal(live+1, liveBatches())
+	Batch_free(raw)
+	s.NotPanics(func() { Batch_free(raw) })
+	s.Equal(live, liveBatches())
+	s.NotPanics(func() { Batch_free(Batch_get_one([]LlamaToken{1})) })
+}
+
+func (s *TokenBatchSuite) TestBatchOriginString() {
+	s.Equal("owned", BatchOwned.String())
+	s.Equal("view", BatchView.String())
+	s.Equal("BatchOrigin(7)", BatchOrigin(7).String())
+}
+
+func TestTokenBatchSuite(t *testing.T) { suite.Run(t, new(TokenBatchSuite)) }
@@ -0,0 +1,183 @@
+package gollama
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// ChatMessage is a single message of a chat conversation. ToolCalls and
+// ToolCallID are only used by tool-calling conversations (see ApplyTools).
+// Images holds encoded image (or audio) files attached to the message; they
+// are evaluated by a MultimodalContext.
+type ChatMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Images     [][]byte   `json:"images,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// chatContentPart is an element of an OpenAI-style content array.
+type chatContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+	InputAudio struct {
+		Data string `json:"data"`
+	} `json:"input_audio"`
+}
+
+// UnmarshalJSON accepts content either as a string or as an OpenAI-style
+// array of "text", "image_url" and "input_audio" parts. Images must be
+// inline base64 data URLs; remote URLs are rejected rather than fetched.
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	type plain ChatMessage
+	var raw struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = ChatMessage(raw.plain)
+
+	content := bytes.TrimSpace(raw.Content)
+	if len(content) == 0 || string(content) == "null" {
+		return nil
+	}
+	if content[0] == '"' {
+		return json.Unmarshal(content, &m.Content)
+	}
+
+	var parts []chatContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return fmt.Errorf("%w: message content must be a string or an array of parts", ErrInvalidParameter)
+	}
+	var text strings.Builder
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if text.Len() > 0 {
+				text.WriteByte('\n')
+			}
+			text.WriteString(part.Text)
+		case "image_url":
+			img, err := decodeDataURL(part.ImageURL.URL)
+			if err != nil {
+				return err
+			}
+			m.Images = append(m.Images, img)
+		case "input_audio":
+			audio, err := base64.StdEncoding.DecodeString(part.InputAudio.Data)
+			if err != nil {
+				return fmt.Errorf("%w: input_audio data: %v", ErrInvalidParameter, err)
+			}
+			m.Images = append(m.Images, audio)
+		default:
+			return fmt.Errorf("%w: unsupported content part type %q", ErrInvalidParameter, part.Type)
+		}
+	}
+	m.Content = text.String()
+	return nil
+}
+
+// decodeDataURL returns the payload of a base64 "data:" URL.
+func decodeDataURL(url string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return nil, fmt.Errorf("%w: only base64 data URLs are supported for images", ErrInvalidParameter)
+	}
+	meta, payload, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return nil, fmt.Errorf("%w: image data URL is not base64 encoded", ErrInvalidParameter)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: image data URL: %v", ErrInvalidParameter, err)
+	}
+	return data, nil
+}
+
+// Model_chat_template returns the chat template stored in the model, or an
+// empty string if there is none. name selects a named template (e.g.
+// "tool_use"); pass "" for the default one.
+func Model_chat_template(model LlamaModel, name string) string {
+	if err := ensureLoaded(); err != nil {
+		return ""
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelChatTemplate == nil {
+		return ""
+	}
+	var namePtr *byte
+	if name != "" {
+		nameBytes := append([]byte(name), 0)
+		namePtr = &nameBytes[0]
+	}
+	return bytePointerToString(llamaModelChatTemplate(model, namePtr))
+}
+
+// Chat_apply_template formats messages into a prompt with llama.cpp's
+// built-in template engine. tmpl is either a Jinja template taken from a
+// model (see Model_chat_template) or the name of a built-in template such as
+// "chatml" or "llama3". When addAssistant is true the prompt ends with the
+// tokens that open an assistant turn.
+//
+// Only the templates known to llama.cpp are supported; arbitrary Jinja
+// templates fail with ErrInvalidParameter.
+//
+// Example usage:
+//
+//	prompt, err := gollama.Chat_apply_template(model.ChatTemplate, []gollama.ChatMessage{
+//		{Role: "system", Content: "You are a helpful assistant."},
+//		{Role: "user", Content: "Hello!"},
+//	}, true)
+func Chat_apply_template(tmpl string, messages []ChatMessage, addAssistant bool) (string, error) {
+	if err := ensureLoaded(); err != nil {
+		return "", err
+	}
+	if llamaChatApplyTemplate == nil {
+		return "", fmt.Errorf("%w: llama_chat_apply_template", ErrFunctionNotFound)
+	}
+	if tmpl == "" {
+		return "", fmt.Errorf("%w: empty chat template", ErrInvalidParameter)
+	}
+
+	// Keep the C strings reachable for the duration of the call
+	tmplBytes := append([]byte(tmpl), 0)
+	strs := make([][]byte, 0, 2*len(messages))
+	chat := make([]LlamaChatMessage, len(messages))
+	size := 0
+	for i, msg := range messages {
+		role := append([]byte(msg.Role), 0)
+		content := append([]byte(msg.Content), 0)
+		strs = append(strs, role, content)
+		chat[i] = LlamaChatMessage{Role: &role[0], Content: &content[0]}
+		size += len(msg.Role) + len(msg.Content)
+	}
+	var chatPtr *LlamaChatMessage
+	if len(chat) > 0 {
+		chatPtr = &chat[0]
+	}
+
+	// llama.cpp recommends twice the total message length as a starting size
+	size = 2*size + 256
+	for attempt := 0; attempt < 2; attempt++ {
+		buf := make([]byte, size)
+		n := llamaChatApplyTemplate(&tmplBytes[0], chatPtr, uint64(len(chat)), addAssistant, &buf[0], int32(len(buf)))
+		runtime.KeepAlive(strs)
+		if n < 0 {
+			return "", fmt.Errorf("%w: unsupported chat template", ErrInvalidParameter)
+		}
+		if int(n) <= len(buf) {
+			return string(buf[:n]), nil
+		}
+		size = int(n)
+	}
+	return "", fmt.Errorf("%w: chat template buffer sizing failed", ErrInvalidParameter)
+}
@@ -0,0 +1,344 @@
+package gollama
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ChatSessionOptions configures a ChatSession.
+type ChatSessionOptions struct {
+	// System is an optional system prompt. It is never evicted.
+	System string
+	// Template is the chat template (see Chat_apply_template); empty uses
+	// the model's template, falling back to DetectChatTemplate when the
+	// model has none or llama.cpp does not support it.
+	Template string
+	// Sampling configures the sampler; the zero value uses
+	// DefaultSamplingParams.
+	Sampling *SamplingParams
+	// MaxTokens bounds the length of a reply (default 512). Room for it is
+	// kept free in the context before a reply starts, up to a quarter of
+	// the context.
+	MaxTokens int
+	// SeqID is the KV cache sequence used by the session.
+	SeqID LlamaSeqId
+}
+
+// ChatUsage counts the tokens processed by a ChatSession.
+type ChatUsage struct {
+	// PromptTokens is the length of the formatted prompts of all turns.
+	PromptTokens int
+	// CachedTokens is the part of PromptTokens reused from the KV cache
+	// instead of being decoded again.
+	CachedTokens int
+	// CompletionTokens is the number of tokens generated.
+	CompletionTokens int
+	// EvictedMessages is the number of messages dropped to fit the context.
+	EvictedMessages int
+}
+
+// ChatSession holds a conversation with a model. Every Send formats the
+// whole history with the chat template, decodes only the tokens that are
+// not in the KV cache yet and appends the reply to the history.
+//
+// When the prompt and the room reserved for the reply no longer fit in the
+// context, the oldest turns after the system prompt are evicted. Their
+// tokens are removed from the KV cache with Memory_seq_rm and, when the
+// memory supports it, the rest of the conversation is shifted back with
+// Memory_seq_add instead of being decoded again.
+//
+// A session is not safe for concurrent use.
+//
+// Example usage:
+//
+//	chat, err := gollama.NewChatSession(ctx, gollama.ChatSessionOptions{System: "You are terse."})
+//	if err != nil {
+//		return err
+//	}
+//	reply, err := chat.Send("Hello!", func(delta string) error {
+//		fmt.Print(delta)
+//		return nil
+//	})
+type ChatSession struct {
+	ctx      *Context
+	opts     ChatSessionOptions
+	template string
+	sampling SamplingParams
+
+	messages []ChatMessage
+	// cached holds the tokens stored in the KV cache for opts.SeqID, at
+	// positions 0..len(cached)-1
+	cached []LlamaToken
+	usage  ChatUsage
+}
+
+// NewChatSession creates a session on ctx, which must not be shared with
+// other users of sequence opts.SeqID.
+func NewChatSession(ctx *Context, opts ChatSessionOptions) (*ChatSession, error) {
+	if ctx == nil || ctx.Handle() == 0 {
+		return nil, ErrContextNotCreated
+	}
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = 512
+	}
+	sampling := DefaultSamplingParams()
+	if opts.Sampling != nil {
+		sampling = *opts.Sampling
+	}
+	if err := sampling.Validate(); err != nil {
+		return nil, err
+	}
+	tmpl := opts.Template
+	if tmpl == "" {
+		tmpl = resolveChatTemplate(ctx.Model().Handle(), ctx.Model().ChatTemplate)
+	}
+
+	s := &ChatSession{ctx: ctx, opts: opts, template: tmpl, sampling: sampling}
+	s.Reset()
+	return s, nil
+}
+
+// Messages returns a copy of the history, system prompt included.
+func (s *ChatSession) Messages() []ChatMessage {
+	return append([]ChatMessage(nil), s.messages...)
+}
+
+// Usage returns the token counts of the session so far.
+func (s *ChatSession) Usage() ChatUsage {
+	return s.usage
+}
+
+// ContextTokens returns the number of tokens held in the KV cache.
+func (s *ChatSession) ContextTokens() int {
+	return len(s.cached)
+}
+
+// Reset clears the history, keeping the system prompt, and the session's
+// sequence in the KV cache. Usage is not reset.
+func (s *ChatSession) Reset() {
+	s.messages = s.messages[:0]
+	if s.opts.System != "" {
+		s.messages = append(s.messages, ChatMessage{Role: "system", Content: s.opts.System})
+	}
+	s.ctx.SeqRm(s.opts.SeqID, 0, -1)
+	s.cached = nil
+}
+
+// Send adds a user message and generates the assistant's reply, which is
+// returned and appended to the history. onDelta, when set, receives the
+// reply as it is produced; returning an error from it aborts generation and
+// removes the user message from the history again. Generation stops at an
+// end-of-generation token, after MaxTokens tokens or when the context is
+// full.
+func (s *ChatSession) Send(content string, onDelta func(string) error) (string, error) {
+	res, err := s.Reply(content, onDelta)
+	return res.Text, err
+}
+
+// Reply is Send returning the generated tokens, the token counts of the
+// turn, why generation stopped and its timings along with the reply.
+// PromptTokens counts the whole formatted prompt, including the part
+// reused from the KV cache.
+func (s *ChatSession) Reply(content string, onDelta func(string) error) (GenerateResult, error) {
+	history := len(s.messages)
+	s.messages = append(s.messages, ChatMessage{Role: "user", Content: content})
+	res, err := s.generate(onDelta)
+	if err != nil {
+		s.messages = s.messages[:history]
+		return res, err
+	}
+	s.messages = append(s.messages, ChatMessage{Role: "assistant", Content: res.Text})
+	return res, nil
+}
+
+// generate fits the history in the context, decodes the new part of the
+// prompt and samples the reply.
+func (s *ChatSession) generate(onDelta func(string) error) (res GenerateResult, err error) {
+	model := s.ctx.Model()
+	nCtx := int(s.ctx.NCtx)
+	reserve := min(s.opts.MaxTokens, nCtx/4)
+
+	var prompt []LlamaToken
+	for {
+		text, err := Chat_apply_template(s.template, s.messages, true)
+		if err != nil {
+			return res, err
+		}
+		if prompt, err = model.Tokenize(text, model.AddBOS, true); err != nil {
+			return res, err
+		}
+		if len(prompt)+reserve <= nCtx {
+			break
+		}
+		evicted := evictOldestTurn(s.messages)
+		if evicted == 0 {
+			return res, fmt.Errorf("%w: prompt of %d tokens does not fit in %d tokens", ErrContextFull, len(prompt), nCtx)
+		}
+		start := firstTurn(s.messages)
+		s.messages = append(s.messages[:start], s.messages[start+evicted:]...)
+		s.usage.EvictedMessages += evicted
+	}
+	if len(prompt) == 0 {
+		return res, fmt.Errorf("%w: prompt is empty", ErrInvalidParameter)
+	}
+
+	timing := NewTiming()
+	var reply strings.Builder
+	defer func() {
+		res.Text = reply.String()
+		res.CompletionTokens = len(res.Tokens)
+		res.Timings = timing.Timings()
+		countGeneration(res.Timings)
+	}()
+
+	n := s.reuseCache(prompt)
+	s.usage.PromptTokens += len(prompt)
+	s.usage.CachedTokens += n
+	if err := s.ctx.DecodeTokens(prompt[n:], LlamaPos(n), s.opts.SeqID); err != nil {
+		s.invalidate()
+		return res, err
+	}
+	s.cached = append(s.cached[:n], prompt[n:]...)
+	res.PromptTokens = len(prompt)
+	timing.PromptProcessed(len(prompt) - n)
+
+	sampler, err := NewSamplerChain(s.sampling)
+	if err != nil {
+		return res, err
+	}
+	defer Sampler_free(sampler)
+
+	var pending []byte
+	emit := func(b []byte) error {
+		reply.Write(b)
+		if onDelta != nil && len(b) > 0 {
+			return onDelta(string(b))
+		}
+		return nil
+	}
+	seq := []LlamaSeqId{s.opts.SeqID}
+	batch, err := NewTokenBatch(1, 1)
+	if err != nil {
+		return res, err
+	}
+	defer batch.Free()
+
+	res.StopReason = StopMaxTokens
+	for len(res.Tokens) < s.opts.MaxTokens {
+		if len(s.cached) >= nCtx {
+			res.StopReason = StopContextFull
+			break
+		}
+		token := Sampler_sample(sampler, s.ctx.Handle(), -1)
+		if token == LLAMA_TOKEN_NULL {
+			return res, fmt.Errorf("%w: no token sampled", ErrSamplingFailed)
+		}
+		if model.IsEOG(token) {
+			res.StopReason = StopEOG
+			break
+		}
+		res.Tokens = append(res.Tokens, token)
+		timing.TokenGenerated()
+		s.usage.CompletionTokens++
+
+		var complete []byte
+		complete, pending = splitIncompleteUTF8(append(pending, Token_to_piece(model.Handle(), token, false)...))
+		if err := emit(complete); err != nil {
+			return res, err
+		}
+
+		batch.Clear()
+		if err := batch.Add(token, LlamaPos(len(s.cached)), seq, true); err != nil {
+			return res, err
+		}
+		if err := s.ctx.Decode(batch.Batch()); err != nil {
+			s.invalidate()
+			return res, fmt.Errorf("decoding token: %w", err)
+		}
+		s.cached = append(s.cached, token)
+	}
+	return res, emit(pending)
+}
+
+// reuseCache prepares the KV cache for prompt and returns how many of its
+// leading tokens are already stored. Tokens after the common prefix are
+// removed; if they continue prompt once a span of evicted turns is cut out,
+// that span is removed and the rest shifted back instead. At least the last
+// prompt token is always left to decode, so its logits are available.
+func (s *ChatSession) reuseCache(prompt []LlamaToken) int {
+	seqID := s.opts.SeqID
+	prefix, cut := planCacheReuse(s.cached, prompt)
+	if cut > prefix && Memory_can_shift(s.ctx.Handle()) &&
+		s.ctx.SeqRm(seqID, LlamaPos(prefix), LlamaPos(cut)) {
+		Memory_seq_add(s.ctx.Handle(), seqID, LlamaPos(cut), -1, LlamaPos(prefix-cut))
+		s.cached = append(s.cached[:prefix], s.cached[cut:]...)
+		prefix = len(s.cached)
+	}
+	prefix = min(prefix, len(prompt)-1)
+	if !s.ctx.SeqRm(seqID, LlamaPos(prefix), -1) {
+		s.ctx.SeqRm(seqID, 0, -1)
+		prefix = 0
+	}
+	s.cached = s.cached[:prefix]
+	return prefix
+}
+
+// invalidate drops the session's sequence after a failed decode, whose
+// effect on the KV cache is unknown.
+func (s *ChatSession) invalidate() {
+	s.ctx.SeqRm(s.opts.SeqID, 0, -1)
+	s.cached = nil
+}
+
+// planCacheReuse compares the cached tokens with a new prompt. prefix is
+// the length of their common prefix. cut is larger than prefix when
+// cached[cut:] is a non-empty prefix of prompt[prefix:], so removing
+// cached[prefix:cut] lets every remaining cached token be reused; otherwise
+// cut equals prefix.
+func planCacheReuse(cached, prompt []LlamaToken) (prefix, cut int) {
+	for prefix < len(cached) && prefix < len(prompt) && cached[prefix] == prompt[prefix] {
+		prefix++
+	}
+	rest := prompt[prefix:]
+	for cut = prefix + 1; cut < len(cached); cut++ {
+		tail := cached[cut:]
+		if len(tail) <= len(rest) && slices.Equal(tail, rest[:len(tail)]) {
+			return prefix, cut
+		}
+	}
+	return prefix, prefix
+}
+
+// firstTurn returns the index of the first message after the leading
+// system messages.
+func firstTurn(messages []ChatMessage) int {
+	i := 0
+	for i < len(messages) && messages[i].Role == "system" {
+		i++
+	}
+	return i
+}
+
+// evictOldestTurn returns how many messages make up the oldest turn after
+// the system prompt: a message and everything up to the next user message.
+// The last user message and what follows it are never evicted, so 0 means
+// nothing can be dropped.
+func evictOldestTurn(messages []ChatMessage) int {
+	start := firstTurn(messages)
+	lastUser := -1
+	for i := len(messages) - 1; i >= start; i-- {
+		if messages[i].Role == "user" {
+			lastUser = i
+			break
+		}
+	}
+	if lastUser <= start {
+		return 0
+	}
+	end := start + 1
+	for end < lastUser && messages[end].Role != "user" {
+		end++
+	}
+	return end - start
+}
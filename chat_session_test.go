@@ -0,0 +1,59 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ChatSessionSuite struct{ BaseSuite }
+
+func (s *ChatSessionSuite) TestNewChatSessionRequiresContext() {
+	_, err := NewChatSession(nil, ChatSessionOptions{})
+	s.ErrorIs(err, ErrContextNotCreated)
+	_, err = NewChatSession(&Context{}, ChatSessionOptions{})
+	s.ErrorIs(err, ErrContextNotCreated)
+}
+
+func (s *ChatSessionSuite) TestPlanCacheReuse() {
+	tokens := func(t ...LlamaToken) []LlamaToken { return t }
+
+	// Appended turn: everything cached is reused
+	prefix, cut := planCacheReuse(tokens(1, 2, 3), tokens(1, 2, 3, 4, 5))
+	s.Equal(3, prefix)
+	s.Equal(3, cut)
+
+	// Diverging tail: only the common prefix is reused
+	prefix, cut = planCacheReuse(tokens(1, 2, 3, 4), tokens(1, 2, 9, 9))
+	s.Equal(2, prefix)
+	s.Equal(2, cut)
+
+	// Evicted turn [3 4] after the system prompt [1 2]: cut it out and
+	// keep [5 6]
+	prefix, cut = planCacheReuse(tokens(1, 2, 3, 4, 5, 6), tokens(1, 2, 5, 6, 7))
+	s.Equal(2, prefix)
+	s.Equal(4, cut)
+
+	prefix, cut = planCacheReuse(nil, tokens(1, 2))
+	s.Equal(0, prefix)
+	s.Equal(0, cut)
+}
+
+func (s *ChatSessionSuite) TestEvictOldestTurn() {
+	msgs := []ChatMessage{
+		{Role: "system"},
+		{Role: "user"}, {Role: "assistant"},
+		{Role: "user"}, {Role: "assistant"}, {Role: "tool"}, {Role: "assistant"},
+		{Role: "user"},
+	}
+	s.Equal(1, firstTurn(msgs))
+	s.Equal(2, evictOldestTurn(msgs))
+	s.Equal(4, evictOldestTurn(msgs[3:]))
+	s.Equal(0, evictOldestTurn(msgs[len(msgs)-1:]))
+	s.Equal(0, evictOldestTurn([]ChatMessage{{Role: "system"}, {Role: "user"}}))
+	s.Equal(0, evictOldestTurn(nil))
+}
+
+func TestChatSessionSuite(t *testing.T) {
+	suite.Run(t, new(ChatSessionSuite))
+}
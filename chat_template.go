@@ -0,0 +1,124 @@
+package gollama
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// chatTemplateFallback is the hook set by SetChatTemplateFallback.
+var chatTemplateFallback struct {
+	mu sync.RWMutex
+	fn func(model LlamaModel) string
+}
+
+// SetChatTemplateFallback sets a function choosing the template of models
+// whose own template is missing or not supported by llama.cpp. It returns
+// a template (a built-in name such as "chatml" or a supported Jinja
+// template), or "" to let DetectChatTemplate guess from the metadata.
+// Passing nil removes the hook.
+func SetChatTemplateFallback(fn func(model LlamaModel) string) {
+	chatTemplateFallback.mu.Lock()
+	defer chatTemplateFallback.mu.Unlock()
+	chatTemplateFallback.fn = fn
+}
+
+// DetectChatTemplate returns the chat template to format conversations for
+// model: its own template when Chat_apply_template supports it, otherwise
+// the template returned by the SetChatTemplateFallback hook, otherwise the
+// built-in template (chatml, llama2, llama3, mistral, gemma or phi3)
+// matching the special tokens and architecture of the model, "chatml" when
+// nothing matches. Older GGUF exports often lack a template.
+func DetectChatTemplate(model LlamaModel) string {
+	if tmpl := Model_chat_template(model, ""); chatTemplateSupported(tmpl) {
+		return tmpl
+	}
+	chatTemplateFallback.mu.RLock()
+	fn := chatTemplateFallback.fn
+	chatTemplateFallback.mu.RUnlock()
+	if fn != nil {
+		if tmpl := fn(model); tmpl != "" {
+			return tmpl
+		}
+	}
+	if model == 0 {
+		return "chatml"
+	}
+	arch, _ := Model_meta_val_str(model, "general.architecture")
+	name, _ := Model_meta_val_str(model, "general.name")
+	return guessChatTemplate(arch, name, func(marker string) bool {
+		return hasSpecialToken(model, marker)
+	})
+}
+
+// Chat_apply_model_template formats messages with the template of model
+// chosen by DetectChatTemplate.
+func Chat_apply_model_template(model LlamaModel, messages []ChatMessage, addAssistant bool) (string, error) {
+	if model == 0 {
+		return "", ErrModelNotLoaded
+	}
+	return Chat_apply_template(DetectChatTemplate(model), messages, addAssistant)
+}
+
+// resolveChatTemplate returns tmpl when it is set and supported, and the
+// template detected for model otherwise.
+func resolveChatTemplate(model LlamaModel, tmpl string) string {
+	if chatTemplateSupported(tmpl) {
+		return tmpl
+	}
+	return DetectChatTemplate(model)
+}
+
+// chatTemplateSupported reports whether Chat_apply_template can format
+// with tmpl.
+func chatTemplateSupported(tmpl string) bool {
+	if tmpl == "" {
+		return false
+	}
+	_, err := Chat_apply_template(tmpl, []ChatMessage{{Role: "user", Content: "hi"}}, true)
+	return !errors.Is(err, ErrInvalidParameter)
+}
+
+// hasSpecialToken reports whether marker is a single special token of the
+// vocabulary of model.
+func hasSpecialToken(model LlamaModel, marker string) bool {
+	tokens, err := Tokenize(model, marker, false, true)
+	if err != nil || len(tokens) != 1 {
+		return false
+	}
+	return Vocab_token_attr(model, tokens[0])&(LLAMA_TOKEN_ATTR_CONTROL|LLAMA_TOKEN_ATTR_USER_DEF) != 0
+}
+
+// guessChatTemplate picks the built-in template of a model from the
+// special tokens of its turns, then from its architecture and name.
+func guessChatTemplate(arch, name string, hasToken func(marker string) bool) string {
+	switch {
+	case hasToken("<|im_start|>"):
+		return "chatml"
+	case hasToken("<|start_header_id|>"):
+		return "llama3"
+	case hasToken("<start_of_turn>"):
+		return "gemma"
+	case hasToken("<|assistant|>") && hasToken("<|end|>"):
+		return "phi3"
+	case hasToken("[SYSTEM_PROMPT]"):
+		return "mistral-v7"
+	case hasToken("[INST]"):
+		return "mistral-v3"
+	}
+
+	arch, name = strings.ToLower(arch), strings.ToLower(name)
+	switch {
+	case strings.HasPrefix(arch, "gemma"):
+		return "gemma"
+	case strings.HasPrefix(arch, "phi3"):
+		return "phi3"
+	case strings.Contains(name, "mistral") || strings.Contains(name, "mixtral"):
+		return "mistral-v1"
+	case arch == "llama" && (strings.Contains(name, "llama-3") || strings.Contains(name, "llama 3") || strings.Contains(name, "llama3")):
+		return "llama3"
+	case arch == "llama" && strings.Contains(name, "llama"):
+		return "llama2"
+	}
+	return "chatml"
+}
@@ -0,0 +1,74 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ChatTemplateSuite struct{ BaseSuite }
+
+func (s *ChatTemplateSuite) TestGuess() {
+	tokens := func(markers ...string) func(string) bool {
+		return func(marker string) bool {
+			for _, m := range markers {
+				if m == marker {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	cases := []struct {
+		arch, name string
+		hasToken   func(string) bool
+		want       string
+	}{
+		{"qwen2", "Qwen2.5 7B", tokens("<|im_start|>"), "chatml"},
+		{"llama", "Meta Llama 3.1 8B", tokens("<|start_header_id|>"), "llama3"},
+		{"gemma2", "", tokens("<start_of_turn>"), "gemma"},
+		{"phi3", "", tokens("<|assistant|>", "<|end|>"), "phi3"},
+		{"llama", "Mistral Small", tokens("[INST]", "[SYSTEM_PROMPT]"), "mistral-v7"},
+		{"llama", "Mistral 7B v0.3", tokens("[INST]"), "mistral-v3"},
+		// No special turn tokens: architecture and name decide
+		{"gemma", "", tokens(), "gemma"},
+		{"phi3", "", tokens(), "phi3"},
+		{"llama", "Mixtral 8x7B", tokens(), "mistral-v1"},
+		{"llama", "Llama-3-8B", tokens(), "llama3"},
+		{"llama", "LLaMA v2", tokens(), "llama2"},
+		{"gpt2", "", tokens(), "chatml"},
+	}
+	for _, c := range cases {
+		s.Equal(c.want, guessChatTemplate(c.arch, c.name, c.hasToken), "%s %q", c.arch, c.name)
+	}
+}
+
+func (s *ChatTemplateSuite) TestFallbackHook() {
+	s.T().Cleanup(func() { SetChatTemplateFallback(nil) })
+	s.Equal("chatml", DetectChatTemplate(0))
+
+	var asked LlamaModel = 1
+	SetChatTemplateFallback(func(model LlamaModel) string {
+		asked = model
+		return "llama3"
+	})
+	s.Equal("llama3", DetectChatTemplate(0))
+	s.Equal(LlamaModel(0), asked)
+
+	SetChatTemplateFallback(func(LlamaModel) string { return "" })
+	s.Equal("chatml", DetectChatTemplate(0), "an empty answer falls back to detection")
+}
+
+func (s *ChatTemplateSuite) TestBuiltinTemplatesSupported() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	for _, tmpl := range []string{"chatml", "llama2", "llama3", "gemma", "phi3", "mistral-v1", "mistral-v3", "mistral-v7"} {
+		s.True(chatTemplateSupported(tmpl), tmpl)
+	}
+	s.False(chatTemplateSupported("{{ unknown jinja }}"))
+	s.Equal("chatml", resolveChatTemplate(0, "{{ unknown jinja }}"))
+	s.Equal("llama3", resolveChatTemplate(0, "llama3"))
+}
+
+func TestChatTemplateSuite(t *testing.T) { suite.Run(t, new(ChatTemplateSuite)) }
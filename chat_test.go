@@ -0,0 +1,67 @@
+package gollama
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ChatSuite struct{ BaseSuite }
+
+func (s *ChatSuite) SetupTest() {
+	s.BaseSuite.SetupTest()
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+}
+
+func (s *ChatSuite) TestApplyBuiltinTemplate() {
+	prompt, err := Chat_apply_template("chatml", []ChatMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Hi"},
+	}, true)
+	s.Require().NoError(err)
+	s.Equal("<|im_start|>system\nBe brief.<|im_end|>\n<|im_start|>user\nHi<|im_end|>\n<|im_start|>assistant\n", prompt)
+}
+
+func (s *ChatSuite) TestLongMessagesGrowBuffer() {
+	long := make([]byte, 4096)
+	for i := range long {
+		long[i] = 'a'
+	}
+	prompt, err := Chat_apply_template("llama3", []ChatMessage{{Role: "user", Content: string(long)}}, false)
+	s.Require().NoError(err)
+	s.Contains(prompt, string(long))
+}
+
+func (s *ChatSuite) TestUnknownTemplate() {
+	_, err := Chat_apply_template("not-a-template", []ChatMessage{{Role: "user", Content: "Hi"}}, true)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = Chat_apply_template("", nil, true)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func TestChatSuite(t *testing.T) { suite.Run(t, new(ChatSuite)) }
+
+func TestChatMessageContentParts(t *testing.T) {
+	var msg ChatMessage
+	err := json.Unmarshal([]byte(`{"role":"user","content":[
+		{"type":"text","text":"What is this?"},
+		{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw=="}}
+	]}`), &msg)
+	require.NoError(t, err)
+	assert.Equal(t, "user", msg.Role)
+	assert.Equal(t, "What is this?", msg.Content)
+	require.Len(t, msg.Images, 1)
+	assert.Equal(t, []byte{0x89, 'P', 'N', 'G'}, msg.Images[0])
+
+	require.NoError(t, json.Unmarshal([]byte(`{"role":"assistant","content":"Hi"}`), &msg))
+	assert.Equal(t, "Hi", msg.Content)
+	assert.Empty(t, msg.Images)
+
+	err = json.Unmarshal([]byte(`{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]}`), &msg)
+	assert.ErrorIs(t, err, ErrInvalidParameter)
+}
@@ -0,0 +1,168 @@
+package gollama
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v68/github"
+)
+
+// checksumAssetPattern matches release assets listing the SHA256 sums of
+// the other assets, e.g. SHA256SUMS or checksums.txt.
+var checksumAssetPattern = regexp.MustCompile(`(?i)(^|[-_.])(sha256sums?|checksums?)(\.txt)?$`)
+
+// sha256Pattern matches a hex-encoded SHA256 sum.
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// maxChecksumFileSize bounds the checksum files read from a release.
+const maxChecksumFileSize = 1 << 20
+
+// ExpectedChecksum returns the trusted SHA256 of a release asset. The
+// digest GitHub records when an asset is uploaded is preferred; otherwise
+// a checksum file published with the release (SHA256SUMS, checksums.txt or
+// <asset>.sha256) is used. It fails with ErrChecksumUnavailable when the
+// release offers neither.
+func (d *LibraryDownloader) ExpectedChecksum(release *ReleaseInfo, assetName string) (string, error) {
+	var asset *github.ReleaseAsset
+	for _, a := range release.Assets {
+		if a.GetName() == assetName {
+			asset = a
+			break
+		}
+	}
+	if asset == nil {
+		return "", fmt.Errorf("%w: %s is not part of release %s", ErrChecksumUnavailable, assetName, release.GetTagName())
+	}
+
+	if sum, err := d.assetDigest(asset); err == nil && sum != "" {
+		return sum, nil
+	}
+
+	for _, a := range release.Assets {
+		name := a.GetName()
+		if name != assetName+".sha256" && !checksumAssetPattern.MatchString(name) {
+			continue
+		}
+		text, err := d.fetchText(d.assetURL(release, a))
+		if err != nil {
+			slog.Debug("failed to fetch checksum file", "asset", name, "error", err)
+			continue
+		}
+		sums := parseChecksums(text)
+		if sum, ok := sums[assetName]; ok {
+			return sum, nil
+		}
+		// <asset>.sha256 may hold the bare sum
+		if sum, ok := sums[""]; ok && name == assetName+".sha256" {
+			return sum, nil
+		}
+	}
+	return "", fmt.Errorf("%w for %s in release %s", ErrChecksumUnavailable, assetName, release.GetTagName())
+}
+
+// trustedChecksum returns the checksum a download of assetName must match.
+// Without one the download proceeds unverified, unless
+// Config.RequireChecksum is set.
+func (d *LibraryDownloader) trustedChecksum(release *ReleaseInfo, assetName string) (string, error) {
+	sum, err := d.ExpectedChecksum(release, assetName)
+	if err == nil {
+		return sum, nil
+	}
+	if globalConfig != nil && globalConfig.RequireChecksum {
+		return "", err
+	}
+	slog.Warn("downloading without checksum verification", "asset", assetName, "reason", err)
+	return "", nil
+}
+
+// assetDigest returns the "sha256:" digest GitHub reports for an asset.
+// go-github does not decode the field, so the asset is fetched directly.
+func (d *LibraryDownloader) assetDigest(asset *github.ReleaseAsset) (string, error) {
+	if d.client == nil || asset.GetURL() == "" {
+		return "", ErrChecksumUnavailable
+	}
+	if err := d.checkOnline("look up the digest of " + asset.GetName()); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := d.client.NewRequest("GET", asset.GetURL(), nil)
+	if err != nil {
+		return "", err
+	}
+	var v struct {
+		Digest string `json:"digest"`
+	}
+	if _, err := d.client.Do(ctx, req, &v); err != nil {
+		return "", err
+	}
+	algo, sum, ok := strings.Cut(v.Digest, ":")
+	if !ok || !strings.EqualFold(algo, "sha256") || !sha256Pattern.MatchString(sum) {
+		return "", ErrChecksumUnavailable
+	}
+	return strings.ToLower(sum), nil
+}
+
+// fetchText downloads a small text file.
+func (d *LibraryDownloader) fetchText(url string) (string, error) {
+	if err := d.checkOnline("download " + url); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", d.userAgent)
+
+	resp, err := d.httpClient(30 * time.Second).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close() // Ignore error in defer
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChecksumFileSize))
+	return string(data), err
+}
+
+// parseChecksums parses sha256sum output ("<sum>  <name>" or
+// "<sum> *<name>") and BSD-style lines ("SHA256 (<name>) = <sum>"). A
+// lone sum is stored under the empty name.
+func parseChecksums(text string) map[string]string {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "SHA256 ("); ok {
+			name, sum, ok := strings.Cut(rest, ") = ")
+			if ok && sha256Pattern.MatchString(sum) {
+				sums[name] = strings.ToLower(sum)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !sha256Pattern.MatchString(fields[0]) {
+			continue
+		}
+		name := ""
+		if len(fields) > 1 {
+			name = strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		}
+		sums[name] = strings.ToLower(fields[0])
+	}
+	return sums
+}
@@ -0,0 +1,95 @@
+package gollama
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v68/github"
+	"github.com/stretchr/testify/suite"
+)
+
+type ChecksumSuite struct{ BaseSuite }
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *ChecksumSuite) TestParseChecksums() {
+	a, b := sha256Hex([]byte("a")), sha256Hex([]byte("b"))
+	sums := parseChecksums(fmt.Sprintf("# sums\n%s  llama-b1-bin-ubuntu-x64.zip\n%s *llama-b1-bin-win-cpu-x64.zip\nSHA256 (notes.txt) = %s\nnot a sum\n", a, b, a))
+	s.Equal(map[string]string{
+		"llama-b1-bin-ubuntu-x64.zip":  a,
+		"llama-b1-bin-win-cpu-x64.zip": b,
+		"notes.txt":                    a,
+	}, sums)
+	s.Equal(map[string]string{"": a}, parseChecksums(a+"\n"))
+}
+
+func (s *ChecksumSuite) TestExpectedChecksum() {
+	archive := []byte("archive")
+	sum := sha256Hex(archive)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/assets/1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"id":1,"digest":"sha256:%s"}`, sum)
+	})
+	mux.HandleFunc("/assets/2", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":2}`))
+	})
+	mux.HandleFunc("/SHA256SUMS", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s  b.zip\n", sum)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	d, err := NewLibraryDownloaderWithCacheDir(s.T().TempDir())
+	s.Require().NoError(err)
+	d.client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	release := &ReleaseInfo{TagName: github.String("b1"), Assets: []*github.ReleaseAsset{
+		{Name: github.String("a.zip"), URL: github.String("assets/1")},
+		{Name: github.String("b.zip"), URL: github.String("assets/2")},
+		{Name: github.String("c.zip")},
+	}}
+
+	got, err := d.ExpectedChecksum(release, "a.zip")
+	s.NoError(err)
+	s.Equal(sum, got, "asset digest")
+
+	_, err = d.ExpectedChecksum(release, "b.zip")
+	s.ErrorIs(err, ErrChecksumUnavailable)
+	release.Assets = append(release.Assets, &github.ReleaseAsset{
+		Name: github.String("SHA256SUMS"), BrowserDownloadURL: github.String(srv.URL + "/SHA256SUMS"),
+	})
+	got, err = d.ExpectedChecksum(release, "b.zip")
+	s.NoError(err)
+	s.Equal(sum, got, "checksum file")
+
+	_, err = d.ExpectedChecksum(release, "c.zip")
+	s.ErrorIs(err, ErrChecksumUnavailable)
+	got, err = d.trustedChecksum(release, "c.zip")
+	s.NoError(err, "unverified downloads are allowed by default")
+	s.Empty(got)
+	s.Require().NoError(SetGlobalConfig(NewConfig(func(c *Config) { c.RequireChecksum = true })))
+	_, err = d.trustedChecksum(release, "c.zip")
+	s.ErrorIs(err, ErrChecksumUnavailable)
+}
+
+func (s *ChecksumSuite) TestMismatchRejectsArchive() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tampered"))
+	}))
+	defer srv.Close()
+
+	d, err := NewLibraryDownloaderWithCacheDir(s.T().TempDir())
+	s.Require().NoError(err)
+	_, _, err = d.DownloadAndExtractWithChecksum(srv.URL, "x.zip", sha256Hex([]byte("original")))
+	s.ErrorIs(err, ErrChecksumMismatch)
+}
+
+func TestChecksumSuite(t *testing.T) { suite.Run(t, new(ChecksumSuite)) }
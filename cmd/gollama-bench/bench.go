@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+// plan holds the parsed parameter lists; every combination is a test.
+type plan struct {
+	Prompts     []int
+	Gens        []int
+	Threads     []int
+	Batches     []int
+	GPULayers   []int
+	Repetitions int
+}
+
+// test is a single prompt processing (NPrompt > 0) or generation
+// (NGen > 0) measurement.
+type test struct {
+	NPrompt int
+	NGen    int
+	Threads int
+	Batch   int
+}
+
+// Name returns the llama-bench name of the test, e.g. "pp512" or "tg128".
+func (t test) Name() string {
+	if t.NPrompt > 0 {
+		return fmt.Sprintf("pp%d", t.NPrompt)
+	}
+	return fmt.Sprintf("tg%d", t.NGen)
+}
+
+// result is the outcome of a test.
+type result struct {
+	Test      string    `json:"test"`
+	NPrompt   int       `json:"n_prompt"`
+	NGen      int       `json:"n_gen"`
+	Threads   int       `json:"n_threads"`
+	Batch     int       `json:"n_batch"`
+	GPULayers int       `json:"n_gpu_layers"`
+	AvgTS     float64   `json:"avg_ts"`
+	StdevTS   float64   `json:"stddev_ts"`
+	SamplesNs []int64   `json:"samples_ns"`
+	SamplesTS []float64 `json:"samples_ts"`
+}
+
+// environment describes what the results were measured with.
+type environment struct {
+	Library      string   `json:"library"`
+	Backend      string   `json:"backend"`
+	BackendChain string   `json:"backend_chain,omitempty"`
+	Devices      []string `json:"devices,omitempty"`
+	Model        string   `json:"model"`
+	ModelDesc    string   `json:"model_desc"`
+	ModelSize    uint64   `json:"model_size"`
+	ModelParams  uint64   `json:"model_n_params"`
+}
+
+// run is the output of one invocation.
+type run struct {
+	Environment environment `json:"environment"`
+	Results     []result    `json:"results"`
+}
+
+// parsePlan parses the comma-separated parameter lists.
+func parsePlan(prompts, gens, threads, batches, gpuLayers string, repetitions int) (plan, error) {
+	var p plan
+	var err error
+	lists := []struct {
+		dst  *[]int
+		flag string
+		s    string
+		min  int
+	}{
+		{&p.Prompts, "p", prompts, 0},
+		{&p.Gens, "n", gens, 0},
+		{&p.Threads, "t", threads, 0},
+		{&p.Batches, "b", batches, 1},
+		{&p.GPULayers, "ngl", gpuLayers, 0},
+	}
+	for _, l := range lists {
+		if *l.dst, err = parseInts(l.s, l.min); err != nil {
+			return p, fmt.Errorf("-%s: %w", l.flag, err)
+		}
+	}
+	if repetitions < 1 {
+		return p, fmt.Errorf("-r: %d repetitions", repetitions)
+	}
+	p.Repetitions = repetitions
+	return p, nil
+}
+
+// parseInts parses a comma-separated list of integers of at least min.
+func parseInts(s string, min int) ([]int, error) {
+	var out []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		if n < min {
+			return nil, fmt.Errorf("%d is less than %d", n, min)
+		}
+		out = append(out, n)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("empty list %q", s)
+	}
+	return out, nil
+}
+
+// tests returns the tests run for each number of GPU layers.
+func (p plan) tests() []test {
+	var tests []test
+	for _, threads := range p.Threads {
+		for _, batch := range p.Batches {
+			for _, n := range p.Prompts {
+				if n > 0 {
+					tests = append(tests, test{NPrompt: n, Threads: threads, Batch: batch})
+				}
+			}
+			for _, n := range p.Gens {
+				if n > 0 {
+					tests = append(tests, test{NGen: n, Threads: threads, Batch: batch})
+				}
+			}
+		}
+	}
+	return tests
+}
+
+// runTest measures t in a fresh context, after an untimed warmup run.
+func runTest(model *gollama.Model, ngl int, t test, repetitions int) (result, error) {
+	params := gollama.Context_default_params()
+	params.NCtx = uint32(t.NPrompt + t.NGen)
+	params.NBatch = uint32(t.Batch)
+	params.NUbatch = uint32(min(t.Batch, 512))
+	if t.Threads > 0 {
+		params.NThreads = int32(t.Threads)
+		params.NThreadsBatch = int32(t.Threads)
+	}
+	ctx, err := gollama.NewContext(model, params)
+	if err != nil {
+		return result{}, err
+	}
+	defer ctx.Free()
+
+	rng := rand.New(rand.NewSource(1))
+	tokens := make([]gollama.LlamaToken, max(t.NPrompt, t.NGen))
+	for i := range tokens {
+		tokens[i] = gollama.LlamaToken(rng.Int31n(model.NVocab))
+	}
+	if model.AddBOS && model.BOS != gollama.LLAMA_TOKEN_NULL {
+		tokens[0] = model.BOS
+	}
+
+	measure := func() (time.Duration, error) {
+		ctx.ClearMemory(true)
+		start := time.Now()
+		var err error
+		if t.NPrompt > 0 {
+			err = ctx.DecodeTokens(tokens, 0, 0)
+		} else {
+			err = generate(ctx, tokens)
+		}
+		gollama.Synchronize(ctx.Handle())
+		return time.Since(start), err
+	}
+	if _, err := measure(); err != nil {
+		return result{}, err
+	}
+
+	r := result{
+		Test:      t.Name(),
+		NPrompt:   t.NPrompt,
+		NGen:      t.NGen,
+		Threads:   t.Threads,
+		Batch:     t.Batch,
+		GPULayers: ngl,
+	}
+	if t.Threads == 0 {
+		gen, _ := ctx.Threads()
+		r.Threads = int(gen)
+	}
+	n := float64(t.NPrompt + t.NGen)
+	for i := 0; i < repetitions; i++ {
+		d, err := measure()
+		if err != nil {
+			return result{}, err
+		}
+		r.SamplesNs = append(r.SamplesNs, d.Nanoseconds())
+		r.SamplesTS = append(r.SamplesTS, n/d.Seconds())
+	}
+	r.AvgTS, r.StdevTS = meanStdev(r.SamplesTS)
+	return r, nil
+}
+
+// generate decodes tokens one at a time, as text generation does.
+func generate(ctx *gollama.Context, tokens []gollama.LlamaToken) error {
+	batch, err := gollama.NewTokenBatch(1, 1)
+	if err != nil {
+		return err
+	}
+	defer batch.Free()
+	seq := []gollama.LlamaSeqId{0}
+	for i, tok := range tokens {
+		batch.Clear()
+		if err := batch.Add(tok, gollama.LlamaPos(i), seq, true); err != nil {
+			return err
+		}
+		if err := gollama.Decode(ctx.Handle(), batch.Batch()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// meanStdev returns the mean and sample standard deviation of xs.
+func meanStdev(xs []float64) (mean, stdev float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+	var sq float64
+	for _, x := range xs {
+		sq += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(xs)-1))
+}
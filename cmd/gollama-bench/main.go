@@ -0,0 +1,126 @@
+// Command gollama-bench measures prompt processing and text generation
+// throughput of a GGUF model, like llama.cpp's llama-bench: every
+// combination of the -p/-n test sizes and the -t, -b and -ngl parameter
+// lists is run -r times and reported in tokens per second.
+//
+// Results of different library variants (CPU, CUDA, Vulkan, ...) are
+// compared by running the command once per variant with -backend and
+// -o json, then passing the files to -compare:
+//
+//	gollama-bench -model m.gguf -backend cpu -o json > cpu.json
+//	gollama-bench -model m.gguf -backend vulkan -ngl 99 -o json > vulkan.json
+//	gollama-bench -compare cpu.json,vulkan.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+func main() {
+	var (
+		modelPath   = flag.String("model", "", "Path to the GGUF model file (required unless -compare is used)")
+		nPrompt     = flag.String("p", "512", "Comma-separated prompt sizes to process (0 skips prompt processing)")
+		nGen        = flag.String("n", "128", "Comma-separated numbers of tokens to generate (0 skips generation)")
+		threads     = flag.String("t", "0", "Comma-separated thread counts (0 = library default)")
+		batches     = flag.String("b", "512", "Comma-separated batch sizes for prompt processing")
+		gpuLayers   = flag.String("ngl", "0", "Comma-separated numbers of layers to offload to the GPU")
+		repetitions = flag.Int("r", 5, "Number of repetitions of each test")
+		backend     = flag.String("backend", "", "Backend fallback chain to load, e.g. cuda,cpu (default: detection)")
+		output      = flag.String("o", "md", "Output format: md, json or csv")
+		compare     = flag.String("compare", "", "Comma-separated JSON result files to compare instead of running tests")
+	)
+	flag.Parse()
+
+	if *compare != "" {
+		runs, err := readResults(strings.Split(*compare, ","))
+		if err != nil {
+			log.Fatalf("Failed to read results: %v", err)
+		}
+		if err := writeComparison(os.Stdout, runs); err != nil {
+			log.Fatalf("Failed to write comparison: %v", err)
+		}
+		return
+	}
+
+	if *modelPath == "" {
+		log.Print("Error: -model is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	write, ok := writers[*output]
+	if !ok {
+		log.Fatalf("Unknown output format %q", *output)
+	}
+	plan, err := parsePlan(*nPrompt, *nGen, *threads, *batches, *gpuLayers, *repetitions)
+	if err != nil {
+		log.Fatalf("Invalid parameters: %v", err)
+	}
+
+	if *backend != "" {
+		if err := gollama.Configure(gollama.WithPreferredBackend(*backend)); err != nil {
+			log.Fatalf("Invalid backend chain: %v", err)
+		}
+	}
+	if err := gollama.Backend_init(); err != nil {
+		log.Fatalf("Failed to initialize backend: %v", err)
+	}
+	defer gollama.Backend_free()
+	if err := gollama.Ggml_backend_load_all(); err != nil {
+		log.Printf("Warning: failed to load ggml backends: %v", err)
+	}
+
+	env := environment{
+		Library:      gollama.FullVersion,
+		Backend:      gollama.DetectGpuBackend().String(),
+		Model:        filepath.Base(*modelPath),
+		BackendChain: *backend,
+	}
+	if info, err := gollama.SystemInfo(); err == nil {
+		env.Devices = info.Devices
+	}
+
+	var results []result
+	for _, ngl := range plan.GPULayers {
+		rs, err := benchModel(*modelPath, ngl, plan, &env)
+		if err != nil {
+			log.Fatalf("Benchmark failed: %v", err)
+		}
+		results = append(results, rs...)
+	}
+	if err := write(os.Stdout, run{Environment: env, Results: results}); err != nil {
+		log.Fatalf("Failed to write results: %v", err)
+	}
+}
+
+// benchModel loads the model with ngl offloaded layers and runs every test
+// of plan on it.
+func benchModel(path string, ngl int, plan plan, env *environment) ([]result, error) {
+	params := gollama.Model_default_params()
+	params.NGpuLayers = int32(ngl)
+	model, err := gollama.LoadModel(path, params)
+	if err != nil {
+		return nil, err
+	}
+	defer model.Free()
+	env.ModelDesc = gollama.Model_desc(model.Handle())
+	env.ModelSize = gollama.Model_size(model.Handle())
+	env.ModelParams = gollama.Model_n_params(model.Handle())
+
+	var results []result
+	for _, t := range plan.tests() {
+		fmt.Fprintf(os.Stderr, "ngl %d, threads %d, batch %d: %s\n", ngl, t.Threads, t.Batch, t.Name())
+		r, err := runTest(model, ngl, t, plan.Repetitions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Name(), err)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
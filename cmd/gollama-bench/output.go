@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// writers maps the -o formats to their writers.
+var writers = map[string]func(io.Writer, run) error{
+	"md":   writeMarkdown,
+	"json": writeJSON,
+	"csv":  writeCSV,
+}
+
+// writeMarkdown writes a llama-bench style table.
+func writeMarkdown(w io.Writer, r run) error {
+	env := r.Environment
+	fmt.Fprintf(w, "%s, %s", env.Library, env.Backend)
+	if len(env.Devices) > 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(env.Devices, ", "))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| model | size | params | ngl | threads | n_batch | test | t/s |")
+	fmt.Fprintln(w, "| ----- | ---: | -----: | --: | ------: | ------: | ---: | --: |")
+	for _, res := range r.Results {
+		fmt.Fprintf(w, "| %s | %s | %s | %d | %d | %d | %s | %.2f ± %.2f |\n",
+			env.ModelDesc, formatSize(env.ModelSize), formatParams(env.ModelParams),
+			res.GPULayers, res.Threads, res.Batch, res.Test, res.AvgTS, res.StdevTS)
+	}
+	return nil
+}
+
+// writeJSON writes r as indented JSON, the input of -compare.
+func writeJSON(w io.Writer, r run) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// writeCSV writes one line per result, repeating the environment.
+func writeCSV(w io.Writer, r run) error {
+	cw := csv.NewWriter(w)
+	env := r.Environment
+	_ = cw.Write([]string{"library", "backend", "model", "model_desc", "model_size", "model_n_params",
+		"n_gpu_layers", "n_threads", "n_batch", "test", "n_prompt", "n_gen", "avg_ts", "stddev_ts"})
+	for _, res := range r.Results {
+		_ = cw.Write([]string{
+			env.Library, env.Backend, env.Model, env.ModelDesc,
+			strconv.FormatUint(env.ModelSize, 10), strconv.FormatUint(env.ModelParams, 10),
+			strconv.Itoa(res.GPULayers), strconv.Itoa(res.Threads), strconv.Itoa(res.Batch),
+			res.Test, strconv.Itoa(res.NPrompt), strconv.Itoa(res.NGen),
+			strconv.FormatFloat(res.AvgTS, 'f', 2, 64), strconv.FormatFloat(res.StdevTS, 'f', 2, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// labeledRun is a run read from a result file, labeled by the file name.
+type labeledRun struct {
+	Label string
+	run
+}
+
+// readResults reads JSON result files written with -o json.
+func readResults(paths []string) ([]labeledRun, error) {
+	var runs []labeledRun
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var r run
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		label := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		runs = append(runs, labeledRun{Label: label, run: r})
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("no result files")
+	}
+	return runs, nil
+}
+
+// writeComparison writes a table with the throughput of every run side by
+// side, and the speedup over the first run.
+func writeComparison(w io.Writer, runs []labeledRun) error {
+	type key struct {
+		test                string
+		ngl, threads, batch int
+	}
+	var keys []key
+	ts := make([]map[key]float64, len(runs))
+	for i, r := range runs {
+		ts[i] = make(map[key]float64)
+		for _, res := range r.Results {
+			k := key{res.Test, res.GPULayers, res.Threads, res.Batch}
+			if _, seen := ts[0][k]; !seen && i > 0 {
+				continue
+			}
+			if i == 0 {
+				keys = append(keys, k)
+			}
+			ts[i][k] = res.AvgTS
+		}
+	}
+
+	fmt.Fprint(w, "| test | ngl | threads | n_batch |")
+	for _, r := range runs {
+		fmt.Fprintf(w, " %s (%s) t/s |", r.Label, r.Environment.Backend)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprint(w, "| ---- | --: | ------: | ------: |")
+	for range runs {
+		fmt.Fprint(w, " --: |")
+	}
+	fmt.Fprintln(w)
+	for _, k := range keys {
+		fmt.Fprintf(w, "| %s | %d | %d | %d |", k.test, k.ngl, k.threads, k.batch)
+		base := ts[0][k]
+		for i := range runs {
+			v, ok := ts[i][k]
+			switch {
+			case !ok:
+				fmt.Fprint(w, " - |")
+			case i == 0 || base == 0:
+				fmt.Fprintf(w, " %.2f |", v)
+			default:
+				fmt.Fprintf(w, " %.2f (%.2fx) |", v, v/base)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// formatSize formats a byte count in GiB or MiB.
+func formatSize(n uint64) string {
+	const mib = 1 << 20
+	if n >= 1<<30 {
+		return fmt.Sprintf("%.2f GiB", float64(n)/(1<<30))
+	}
+	return fmt.Sprintf("%.2f MiB", float64(n)/mib)
+}
+
+// formatParams formats a parameter count in billions or millions.
+func formatParams(n uint64) string {
+	if n >= 1e9 {
+		return fmt.Sprintf("%.2f B", float64(n)/1e9)
+	}
+	return fmt.Sprintf("%.2f M", float64(n)/1e6)
+}
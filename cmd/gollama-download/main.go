@@ -25,9 +25,28 @@ func main() {
 		verifyChecksum   = flag.String("verify-checksum", "", "Verify SHA256 checksum of a file")
 		copyLibs         = flag.Bool("copy-libs", false, "Copy downloaded libraries into ./libs for embedding")
 		libsDir          = flag.String("libs-dir", "libs", "Target directory for embedded libraries (default: ./libs)")
+		retries          = flag.Int("retries", gollama.DefaultRetryPolicy().MaxAttempts, "Attempts per archive; interrupted downloads resume")
+		showProgress     = flag.Bool("progress", false, "Print download progress to stderr")
 	)
 	flag.Parse()
 
+	policy := gollama.DefaultRetryPolicy()
+	policy.MaxAttempts = *retries
+	var progress gollama.DownloadProgressFunc
+	if *showProgress {
+		progress = printProgress
+	}
+	configureDownloader := func(d *gollama.LibraryDownloader) {
+		d.SetRetryPolicy(policy)
+		d.SetProgressCallback(progress)
+	}
+	if err := gollama.SetDownloadRetryPolicy(policy); err != nil {
+		log.Fatalf("Failed to configure downloader: %v", err)
+	}
+	if err := gollama.SetDownloadProgressCallback(progress); err != nil {
+		log.Fatalf("Failed to configure downloader: %v", err)
+	}
+
 	if *showVersion {
 		fmt.Printf("gollama.cpp library downloader\n")
 		fmt.Printf("Supports downloading pre-built llama.cpp binaries from ggml-org/llama.cpp\n")
@@ -83,6 +102,7 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to create downloader: %v", err)
 		}
+		configureDownloader(downloader)
 
 		// Get release
 		var release *gollama.ReleaseInfo
@@ -378,6 +398,9 @@ func printDownloadResults(results []gollama.DownloadResult, showChecksum bool) i
 			if showChecksum && result.SHA256Sum != "" {
 				fmt.Printf("\n   SHA256: %s", result.SHA256Sum)
 			}
+			if result.Attempts > 1 || result.Resumed {
+				fmt.Printf("\n   Downloaded %d bytes in %d attempts (resumed: %v)", result.Bytes, result.Attempts, result.Resumed)
+			}
 			fmt.Println()
 		} else {
 			fmt.Printf("❌ %s: FAILED", result.Platform)
@@ -392,6 +415,18 @@ func printDownloadResults(results []gollama.DownloadResult, showChecksum bool) i
 	return successCount
 }
 
+// printProgress prints download progress on a single stderr line.
+func printProgress(received, total int64) {
+	if total > 0 {
+		fmt.Fprintf(os.Stderr, "\r   %6.1f / %6.1f MiB (%3d%%)", float64(received)/(1<<20), float64(total)/(1<<20), received*100/total)
+		if received == total {
+			fmt.Fprintln(os.Stderr)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r   %6.1f MiB", float64(received)/(1<<20))
+}
+
 // printVariantDownloadResult prints the result of downloading all variants for a platform
 func printVariantDownloadResult(result *gollama.VariantDownloadResult, showChecksum bool) {
 	fmt.Printf("\nVariant Download Results:\n")
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokNumber
+	tokPunct
+	tokString
+	tokComment
+)
+
+type cToken struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// tokenize splits C source into tokens. Preprocessor lines are dropped;
+// comments are kept so that field documentation can be carried over.
+func tokenize(src string) []cToken {
+	var toks []cToken
+	line := 1
+	lineStart := true
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			lineStart = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+			continue
+		case c == '#' && lineStart:
+			// Skip the directive including backslash continuations
+			for i < len(src) && src[i] != '\n' {
+				if src[i] == '\\' && i+1 < len(src) && src[i+1] == '\n' {
+					line++
+					i++
+				}
+				i++
+			}
+			continue
+		}
+		lineStart = false
+
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			toks = append(toks, cToken{tokComment, strings.TrimSpace(src[i+2 : i+end]), line})
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			text := src[i+2 : i+2+end]
+			toks = append(toks, cToken{tokComment, strings.TrimSpace(text), line})
+			line += strings.Count(text, "\n")
+			i += end + 4
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			toks = append(toks, cToken{tokString, src[i:min(j+1, len(src))], line})
+			i = j + 1
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, cToken{tokIdent, src[i:j], line})
+			i = j
+		case unicode.IsDigit(rune(c)):
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, cToken{tokNumber, src[i:j], line})
+			i = j
+		default:
+			toks = append(toks, cToken{tokPunct, string(c), line})
+			i++
+		}
+	}
+	return toks
+}
+
+// cType is the layout of a C type on a 64-bit (LP64/LLP64) target.
+type cType struct {
+	ffi   string // jupiterrider/ffi type variable, e.g. "TypeSint32"
+	size  int
+	align int
+}
+
+var pointerType = cType{"TypePointer", 8, 8}
+
+var primitiveTypes = map[string]cType{
+	"bool":               {"TypeUint8", 1, 1},
+	"_Bool":              {"TypeUint8", 1, 1},
+	"char":               {"TypeSint8", 1, 1},
+	"signed char":        {"TypeSint8", 1, 1},
+	"unsigned char":      {"TypeUint8", 1, 1},
+	"int8_t":             {"TypeSint8", 1, 1},
+	"uint8_t":            {"TypeUint8", 1, 1},
+	"short":              {"TypeSint16", 2, 2},
+	"unsigned short":     {"TypeUint16", 2, 2},
+	"int16_t":            {"TypeSint16", 2, 2},
+	"uint16_t":           {"TypeUint16", 2, 2},
+	"int":                {"TypeSint32", 4, 4},
+	"signed":             {"TypeSint32", 4, 4},
+	"signed int":         {"TypeSint32", 4, 4},
+	"unsigned":           {"TypeUint32", 4, 4},
+	"unsigned int":       {"TypeUint32", 4, 4},
+	"int32_t":            {"TypeSint32", 4, 4},
+	"uint32_t":           {"TypeUint32", 4, 4},
+	"long long":          {"TypeSint64", 8, 8},
+	"unsigned long long": {"TypeUint64", 8, 8},
+	"int64_t":            {"TypeSint64", 8, 8},
+	"uint64_t":           {"TypeUint64", 8, 8},
+	"size_t":             {"TypeUint64", 8, 8},
+	"intptr_t":           {"TypeSint64", 8, 8},
+	"uintptr_t":          {"TypeUint64", 8, 8},
+	"float":              {"TypeFloat", 4, 4},
+	"double":             {"TypeDouble", 8, 8},
+}
+
+// externalTypedefs are ggml typedefs that llama.h uses in its parameter
+// structs, so that llama.h can be parsed without the ggml headers.
+var externalTypedefs = map[string]cType{
+	"ggml_backend_dev_t":               pointerType,
+	"ggml_backend_buffer_type_t":       pointerType,
+	"ggml_backend_sched_eval_callback": pointerType,
+	"ggml_abort_callback":              pointerType,
+	"ggml_threadpool_t":                pointerType,
+}
+
+// cField is one scalar member of a C struct; arrays are expanded into one
+// field per element.
+type cField struct {
+	name    string
+	typ     cType
+	offset  int
+	comment string
+}
+
+type cStruct struct {
+	name   string
+	fields []cField
+	size   int
+	align  int
+}
+
+// header holds the declarations parsed from one or more C headers.
+type header struct {
+	typedefs map[string][]cToken // typedef name -> its type tokens
+	enums    map[string]bool
+	structs  map[string][]cToken // struct name -> body tokens
+	resolved map[string]cType
+}
+
+func newHeader() *header {
+	return &header{
+		typedefs: make(map[string][]cToken),
+		enums:    make(map[string]bool),
+		structs:  make(map[string][]cToken),
+		resolved: make(map[string]cType),
+	}
+}
+
+// parseFile adds the declarations of a header file.
+func (h *header) parseFile(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return h.parse(string(src))
+}
+
+// parse collects struct, enum and typedef declarations. Everything else
+// (functions, extern "C" blocks, macros) is skipped.
+func (h *header) parse(src string) error {
+	toks := tokenize(src)
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case t.kind == tokIdent && t.text == "typedef":
+			end, err := h.parseTypedef(toks, i+1)
+			if err != nil {
+				return err
+			}
+			i = end
+		case t.kind == tokIdent && (t.text == "struct" || t.text == "enum") &&
+			i+2 < len(toks) && toks[i+1].kind == tokIdent && toks[i+2].text == "{":
+			end := matchBrace(toks, i+2)
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated %s %s", t.line, t.text, toks[i+1].text)
+			}
+			if t.text == "enum" {
+				h.enums[toks[i+1].text] = true
+			} else {
+				h.structs[toks[i+1].text] = toks[i+3 : end]
+			}
+			i = end
+		}
+	}
+	return nil
+}
+
+// parseTypedef records the typedef starting at toks[start] and returns the
+// index of its terminating semicolon.
+func (h *header) parseTypedef(toks []cToken, start int) (int, error) {
+	end := start
+	depth := 0
+	for ; end < len(toks); end++ {
+		switch toks[end].text {
+		case "{", "(", "[":
+			depth++
+		case "}", ")", "]":
+			depth--
+		case ";":
+			if depth == 0 {
+				goto found
+			}
+		}
+	}
+	return 0, fmt.Errorf("line %d: unterminated typedef", toks[start].line)
+
+found:
+	decl := stripComments(toks[start:end])
+	if len(decl) < 2 {
+		return end, nil
+	}
+
+	// typedef struct|enum [tag] { ... } name;
+	if (decl[0].text == "struct" || decl[0].text == "enum") && containsText(decl, "{") {
+		name := decl[len(decl)-1].text
+		open := indexText(decl, "{")
+		close := matchBrace(decl, open)
+		if close < 0 {
+			return 0, fmt.Errorf("line %d: unterminated typedef %s", decl[0].line, name)
+		}
+		if decl[0].text == "enum" {
+			h.enums[name] = true
+			h.typedefs[name] = []cToken{{tokIdent, "enum", decl[0].line}, {tokIdent, name, decl[0].line}}
+		} else {
+			h.structs[name] = decl[open+1 : close]
+			h.typedefs[name] = []cToken{{tokIdent, "struct", decl[0].line}, {tokIdent, name, decl[0].line}}
+		}
+		return end, nil
+	}
+
+	// typedef ret (*name)(args);
+	if name, ok := funcPointerName(decl); ok {
+		h.typedefs[name] = []cToken{{tokPunct, "*", decl[0].line}}
+		return end, nil
+	}
+
+	// typedef type name;
+	name := decl[len(decl)-1]
+	if name.kind != tokIdent {
+		return end, nil
+	}
+	h.typedefs[name.text] = decl[:len(decl)-1]
+	return end, nil
+}
+
+// resolveType returns the layout of a type given by its specifier tokens.
+func (h *header) resolveType(toks []cToken, seen map[string]bool) (cType, error) {
+	var words []string
+	for _, t := range toks {
+		switch {
+		case t.text == "*":
+			return pointerType, nil
+		case t.kind == tokIdent && (t.text == "const" || t.text == "volatile"):
+		case t.kind == tokIdent:
+			words = append(words, t.text)
+		}
+	}
+	if len(words) == 0 {
+		return cType{}, fmt.Errorf("empty type")
+	}
+
+	if words[0] == "enum" {
+		return cType{"TypeSint32", 4, 4}, nil
+	}
+	if words[0] == "struct" || words[0] == "union" {
+		return cType{}, fmt.Errorf("%s passed by value is not supported", strings.Join(words, " "))
+	}
+	spelled := strings.Join(words, " ")
+	if t, ok := primitiveTypes[spelled]; ok {
+		return t, nil
+	}
+	if len(words) > 1 {
+		return cType{}, fmt.Errorf("unknown type %q", spelled)
+	}
+
+	name := words[0]
+	if t, ok := h.resolved[name]; ok {
+		return t, nil
+	}
+	if def, ok := h.typedefs[name]; ok {
+		if seen[name] {
+			return cType{}, fmt.Errorf("recursive typedef %s", name)
+		}
+		seen[name] = true
+		t, err := h.resolveType(def, seen)
+		if err != nil {
+			return cType{}, fmt.Errorf("%s: %w", name, err)
+		}
+		h.resolved[name] = t
+		return t, nil
+	}
+	if t, ok := externalTypedefs[name]; ok {
+		return t, nil
+	}
+	return cType{}, fmt.Errorf("unknown type %q (pass the header declaring it with -header)", name)
+}
+
+// layoutStruct computes the field offsets of a parsed struct.
+func (h *header) layoutStruct(name string) (*cStruct, error) {
+	body, ok := h.structs[name]
+	if !ok {
+		return nil, fmt.Errorf("struct %s not found", name)
+	}
+	s := &cStruct{name: name, align: 1}
+
+	for i := 0; i < len(body); {
+		// Collect one declaration up to its semicolon
+		j := i
+		depth := 0
+		for ; j < len(body); j++ {
+			switch body[j].text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+			if body[j].text == ";" && depth == 0 {
+				break
+			}
+		}
+		decl := stripComments(body[i:j])
+		comment := ""
+		if j+1 < len(body) && body[j+1].kind == tokComment && body[j+1].line == body[j].line {
+			comment = body[j+1].text
+		}
+		i = j + 1
+		if len(decl) == 0 {
+			continue
+		}
+		if containsText(decl, "{") {
+			return nil, fmt.Errorf("struct %s, line %d: nested struct or union members are not supported", name, decl[0].line)
+		}
+
+		fields, err := h.parseFieldDecl(decl)
+		if err != nil {
+			return nil, fmt.Errorf("struct %s, line %d: %w", name, decl[0].line, err)
+		}
+		for _, f := range fields {
+			f.comment = comment
+			s.size = alignUp(s.size, f.typ.align)
+			f.offset = s.size
+			s.size += f.typ.size
+			s.align = max(s.align, f.typ.align)
+			s.fields = append(s.fields, f)
+		}
+	}
+	s.size = alignUp(s.size, s.align)
+	return s, nil
+}
+
+// parseFieldDecl parses "type a, *b, c[2]" or a function pointer member.
+func (h *header) parseFieldDecl(decl []cToken) ([]cField, error) {
+	if name, ok := funcPointerName(decl); ok {
+		return []cField{{name: name, typ: pointerType}}, nil
+	}
+
+	// The base type runs up to the first declarator's name: the last
+	// identifier before the first comma or bracket
+	first := len(decl)
+	for k, t := range decl {
+		if t.text == "," || t.text == "[" {
+			first = k
+			break
+		}
+	}
+	nameIdx := -1
+	for k := first - 1; k >= 0; k-- {
+		if decl[k].kind == tokIdent {
+			nameIdx = k
+			break
+		}
+	}
+	if nameIdx <= 0 {
+		return nil, fmt.Errorf("cannot parse member %q", joinTokens(decl))
+	}
+	var base []cToken
+	for _, t := range decl[:nameIdx] {
+		if t.text != "*" {
+			base = append(base, t)
+		}
+	}
+
+	var fields []cField
+	for _, d := range splitText(decl[nameIdx-countStars(decl[:nameIdx]):], ",") {
+		ptr := false
+		var name string
+		count := 1
+		for k := 0; k < len(d); k++ {
+			switch {
+			case d[k].text == "*":
+				ptr = true
+			case d[k].kind == tokIdent && name == "":
+				name = d[k].text
+			case d[k].text == "[":
+				if k+2 >= len(d) || d[k+1].kind != tokNumber || d[k+2].text != "]" {
+					return nil, fmt.Errorf("member %s: array sizes must be integer literals", name)
+				}
+				n, err := strconv.Atoi(d[k+1].text)
+				if err != nil {
+					return nil, fmt.Errorf("member %s: %w", name, err)
+				}
+				count *= n
+				k += 2
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("cannot parse member %q", joinTokens(decl))
+		}
+
+		typ := pointerType
+		if !ptr {
+			var err error
+			if typ, err = h.resolveType(base, map[string]bool{}); err != nil {
+				return nil, fmt.Errorf("member %s: %w", name, err)
+			}
+		}
+		if count == 1 {
+			fields = append(fields, cField{name: name, typ: typ})
+			continue
+		}
+		for e := 0; e < count; e++ {
+			fields = append(fields, cField{name: fmt.Sprintf("%s[%d]", name, e), typ: typ})
+		}
+	}
+	return fields, nil
+}
+
+// funcPointerName returns NAME for declarations of the form
+// "ret (*NAME)(args)".
+func funcPointerName(decl []cToken) (string, bool) {
+	for k := 0; k+3 < len(decl); k++ {
+		if decl[k].text == "(" && decl[k+1].text == "*" && decl[k+2].kind == tokIdent && decl[k+3].text == ")" {
+			return decl[k+2].text, true
+		}
+	}
+	return "", false
+}
+
+// matchBrace returns the index of the brace closing toks[open].
+func matchBrace(toks []cToken, open int) int {
+	depth := 0
+	for k := open; k < len(toks); k++ {
+		switch toks[k].text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return k
+			}
+		}
+	}
+	return -1
+}
+
+func stripComments(toks []cToken) []cToken {
+	out := make([]cToken, 0, len(toks))
+	for _, t := range toks {
+		if t.kind != tokComment {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func splitText(toks []cToken, sep string) [][]cToken {
+	var parts [][]cToken
+	start := 0
+	for k, t := range toks {
+		if t.text == sep {
+			parts = append(parts, toks[start:k])
+			start = k + 1
+		}
+	}
+	return append(parts, toks[start:])
+}
+
+func countStars(toks []cToken) int {
+	n := 0
+	for k := len(toks) - 1; k >= 0 && toks[k].text == "*"; k-- {
+		n++
+	}
+	return n
+}
+
+func containsText(toks []cToken, text string) bool { return indexText(toks, text) >= 0 }
+
+func indexText(toks []cToken, text string) int {
+	for k, t := range toks {
+		if t.text == text {
+			return k
+		}
+	}
+	return -1
+}
+
+func joinTokens(toks []cToken) string {
+	parts := make([]string, len(toks))
+	for k, t := range toks {
+		parts[k] = t.text
+	}
+	return strings.Join(parts, " ")
+}
+
+func alignUp(n, align int) int {
+	return (n + align - 1) / align * align
+}
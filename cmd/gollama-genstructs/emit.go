@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+// paramStruct pairs a C parameter struct with the Go struct mirroring it
+// and the structLayout fields describing it.
+type paramStruct struct {
+	cName  string // C struct name
+	goName string // Go struct in package gollama
+	kind   string // structLayout field suffix: ModelParams or ContextParams
+}
+
+var paramStructs = []paramStruct{
+	{cName: "llama_model_params", goName: "LlamaModelParams", kind: "ModelParams"},
+	{cName: "llama_context_params", goName: "LlamaContextParams", kind: "ContextParams"},
+}
+
+// structMapping is the result of matching a C struct against its Go mirror.
+type structMapping struct {
+	paramStruct
+	c       *cStruct
+	goS     *goStruct
+	matched map[string]goField // C member name -> Go field
+	native  bool
+	cOnly   []string // C members without a Go field
+	goOnly  []string // Go fields without a C member
+}
+
+// mapStruct matches C members with Go fields by name. Matched fields must
+// have the same size.
+func mapStruct(ps paramStruct, c *cStruct, g *goStruct) (*structMapping, error) {
+	m := &structMapping{paramStruct: ps, c: c, goS: g, matched: make(map[string]goField)}
+
+	byName := make(map[string]goField, len(g.fields))
+	for _, f := range g.fields {
+		byName[normalizeName(f.name)] = f
+	}
+	used := make(map[string]bool)
+	for _, cf := range c.fields {
+		gf, ok := byName[normalizeName(cf.name)]
+		if !ok {
+			m.cOnly = append(m.cOnly, cf.name)
+			continue
+		}
+		if gf.size != cf.typ.size {
+			return nil, fmt.Errorf("%s.%s is %d bytes but %s.%s is %d bytes",
+				c.name, cf.name, cf.typ.size, g.name, gf.name, gf.size)
+		}
+		m.matched[cf.name] = gf
+		used[gf.name] = true
+	}
+	for _, f := range g.fields {
+		if !used[f.name] {
+			m.goOnly = append(m.goOnly, f.name)
+		}
+	}
+
+	m.native = len(c.fields) == len(g.fields) && c.size == g.size
+	for i := 0; m.native && i < len(c.fields); i++ {
+		gf, ok := m.matched[c.fields[i].name]
+		m.native = ok && gf.name == g.fields[i].name && gf.offset == c.fields[i].offset
+	}
+	return m, nil
+}
+
+// ffiVar is the name of the ffi.Type variable describing the struct.
+func (m *structMapping) ffiVar(build int) string {
+	return fmt.Sprintf("ffiType%sB%d", m.goName, build)
+}
+
+// generateLayout renders a params_bNNNN.go file registering the layouts.
+func generateLayout(build int, source string, mappings []*structMapping) ([]byte, error) {
+	var b bytes.Buffer
+	native := true
+	for _, m := range mappings {
+		native = native && m.native
+	}
+
+	fmt.Fprintf(&b, "// Code generated by gollama-genstructs from %s; DO NOT EDIT.\n\n", source)
+	b.WriteString("package gollama\n\n")
+	b.WriteString("import (\n\t\"unsafe\"\n\n\t\"github.com/jupiterrider/ffi\"\n)\n\n")
+	fmt.Fprintf(&b, "// Struct layouts of llama.cpp b%d.\n\n", build)
+
+	b.WriteString("var (\n")
+	for i, m := range mappings {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "\t// %s as of b%d\n", m.cName, build)
+		if len(m.cOnly) > 0 {
+			fmt.Fprintf(&b, "\t// Members without a %s field keep their library defaults: %s\n",
+				m.goName, strings.Join(m.cOnly, ", "))
+		}
+		if len(m.goOnly) > 0 {
+			fmt.Fprintf(&b, "\t// %s fields missing from this build are dropped: %s\n",
+				m.goName, strings.Join(m.goOnly, ", "))
+		}
+		fmt.Fprintf(&b, "\t%s = ffi.Type{\n\t\tType: ffi.Struct,\n\t\tElements: &[]*ffi.Type{\n", m.ffiVar(build))
+		for _, f := range m.c.fields {
+			fmt.Fprintf(&b, "\t\t\t&ffi.%s, // %s\n", f.typ.ffi, f.name)
+		}
+		b.WriteString("\t\t\tnil,\n\t\t}[0],\n\t}\n")
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("func init() {\n\tregisterStructLayout(&structLayout{\n")
+	fmt.Fprintf(&b, "\t\tbuild: %d,\n", build)
+	for _, m := range mappings {
+		fmt.Fprintf(&b, "\t\t%s: &%s,\n", lowerFirst(m.kind), m.ffiVar(build))
+	}
+	if native {
+		b.WriteString("\t\tnative: true,\n")
+	}
+	for _, m := range mappings {
+		writeEncode(&b, m)
+		writeDecode(&b, m)
+	}
+	b.WriteString("\t})\n}\n")
+
+	return format.Source(b.Bytes())
+}
+
+func writeEncode(b *bytes.Buffer, m *structMapping) {
+	fmt.Fprintf(b, "\t\tencode%s: func(p %s, dst unsafe.Pointer) {\n", m.kind, m.goName)
+	if m.native {
+		fmt.Fprintf(b, "\t\t\t*(*%s)(dst) = p\n", m.goName)
+	} else {
+		for _, cf := range m.c.fields {
+			if gf, ok := m.matched[cf.name]; ok {
+				fmt.Fprintf(b, "\t\t\t*(*%s)(unsafe.Add(dst, %d)) = p.%s\n", gf.typ, cf.offset, gf.name)
+			}
+		}
+	}
+	b.WriteString("\t\t},\n")
+}
+
+func writeDecode(b *bytes.Buffer, m *structMapping) {
+	fmt.Fprintf(b, "\t\tdecode%s: func(src unsafe.Pointer) %s {\n", m.kind, m.goName)
+	if m.native {
+		fmt.Fprintf(b, "\t\t\treturn *(*%s)(src)\n", m.goName)
+	} else {
+		fmt.Fprintf(b, "\t\t\tvar p %s\n", m.goName)
+		for _, cf := range m.c.fields {
+			if gf, ok := m.matched[cf.name]; ok {
+				fmt.Fprintf(b, "\t\t\tp.%s = *(*%s)(unsafe.Add(src, %d))\n", gf.name, gf.typ, cf.offset)
+			}
+		}
+		b.WriteString("\t\t\treturn p\n")
+	}
+	b.WriteString("\t\t},\n")
+}
+
+var ffiGoTypes = map[string]string{
+	"TypeUint8": "uint8", "TypeSint8": "int8",
+	"TypeUint16": "uint16", "TypeSint16": "int16",
+	"TypeUint32": "uint32", "TypeSint32": "int32",
+	"TypeUint64": "uint64", "TypeSint64": "int64",
+	"TypeFloat": "float32", "TypeDouble": "float64",
+	"TypePointer": "uintptr",
+}
+
+// generateGoStructs renders Go struct definitions mirroring the C structs.
+// Existing field names, types and comments are kept where the C member
+// still exists, so the output can replace the definitions in gollama.go.
+func generateGoStructs(build int, mappings []*structMapping) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("package gollama\n\n")
+	for _, m := range mappings {
+		fmt.Fprintf(&b, "// %s mirrors %s as of b%d.\n", m.goName, m.cName, build)
+		fmt.Fprintf(&b, "type %s struct {\n", m.goName)
+		fields := m.c.fields
+		for i := 0; i < len(fields); i++ {
+			cf := fields[i]
+			name, typ, comment := goName(cf.name), ffiGoTypes[cf.typ.ffi], cf.comment
+			if gf, ok := m.matched[cf.name]; ok {
+				name, typ = gf.name, gf.typ
+				if comment == "" {
+					comment = gf.comment
+				}
+			}
+			// Fold expanded array elements back into an array
+			if base, _, isElem := strings.Cut(cf.name, "["); isElem {
+				n := 1
+				for i+n < len(fields) && strings.HasPrefix(fields[i+n].name, base+"[") {
+					n++
+				}
+				name, typ = goName(base), fmt.Sprintf("[%d]%s", n, typ)
+				i += n - 1
+			}
+			if comment != "" {
+				fmt.Fprintf(&b, "\t%s %s // %s\n", name, typ, comment)
+			} else {
+				fmt.Fprintf(&b, "\t%s %s\n", name, typ)
+			}
+		}
+		b.WriteString("}\n\n")
+	}
+	return format.Source(b.Bytes())
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
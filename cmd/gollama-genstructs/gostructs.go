@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// goField is a field of a Go struct in the gollama package.
+type goField struct {
+	name    string
+	typ     string // type expression as written, e.g. "LlamaSplitMode"
+	size    int
+	align   int
+	offset  int
+	comment string
+}
+
+type goStruct struct {
+	name   string
+	fields []goField
+	size   int
+}
+
+var goBasicSizes = map[string]int{
+	"bool": 1, "int8": 1, "uint8": 1, "byte": 1,
+	"int16": 2, "uint16": 2,
+	"int32": 4, "uint32": 4, "float32": 4, "rune": 4,
+	"int64": 8, "uint64": 8, "float64": 8, "int": 8, "uint": 8, "uintptr": 8,
+}
+
+// goPackage holds the type declarations of a Go package directory.
+type goPackage struct {
+	types map[string]*ast.TypeSpec
+}
+
+// loadGoPackage parses the non-test Go files in dir.
+func loadGoPackage(dir string) (*goPackage, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	pkg := &goPackage{types: make(map[string]*ast.TypeSpec)}
+	fset := token.NewFileSet()
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				pkg.types[ts.Name.Name] = ts
+			}
+		}
+	}
+	return pkg, nil
+}
+
+// sizeOf returns the size of a type expression on a 64-bit target. Structs
+// are not expected in the parameter structs and are rejected.
+func (p *goPackage) sizeOf(expr ast.Expr) (int, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if n, ok := goBasicSizes[e.Name]; ok {
+			return n, nil
+		}
+		ts, ok := p.types[e.Name]
+		if !ok {
+			return 0, fmt.Errorf("unknown type %s", e.Name)
+		}
+		return p.sizeOf(ts.Type)
+	case *ast.StarExpr, *ast.FuncType, *ast.MapType, *ast.ChanType:
+		return 8, nil
+	default:
+		return 0, fmt.Errorf("unsupported type %s", types.ExprString(expr))
+	}
+}
+
+// lookupStruct returns the layout of the Go struct name.
+func (p *goPackage) lookupStruct(name string) (*goStruct, error) {
+	ts, ok := p.types[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s not found", name)
+	}
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("type %s is not a struct", name)
+	}
+
+	s := &goStruct{name: name}
+	align := 1
+	for _, field := range st.Fields.List {
+		size, err := p.sizeOf(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		comment := ""
+		if field.Comment != nil {
+			comment = strings.TrimSpace(field.Comment.Text())
+		}
+		for _, ident := range field.Names {
+			s.size = alignUp(s.size, size)
+			s.fields = append(s.fields, goField{
+				name:    ident.Name,
+				typ:     types.ExprString(field.Type),
+				size:    size,
+				align:   size,
+				offset:  s.size,
+				comment: comment,
+			})
+			s.size += size
+			align = max(align, size)
+		}
+	}
+	s.size = alignUp(s.size, align)
+	return s, nil
+}
+
+// normalizeName folds C and Go field names to a common form, so that
+// n_gpu_layers matches NGpuLayers and offload_kqv matches Offload_kqv.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// goName converts a C member name to an exported Go field name.
+func goName(cName string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(cName, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
@@ -0,0 +1,109 @@
+// Command gollama-genstructs generates the Go side of llama.cpp's by-value
+// parameter structs from llama.h. By default it writes params_bNNNN.go, the
+// ffi.Type descriptors and struct layout registration used to call a given
+// llama.cpp build; with -print-go it prints Go struct definitions mirroring
+// the header instead.
+//
+// Usage:
+//
+//	gollama-genstructs -header build/llama.cpp/include/llama.h -build b7000
+//	gollama-genstructs -header llama.h -build b7000 -print-go
+//
+// The header is parsed with a small C declaration parser that understands
+// structs, enums and typedefs, which is all llama.h uses for these structs.
+// Layouts are computed for 64-bit targets.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	var headers []string
+	flag.Func("header", "C header to parse (repeatable; llama.h is enough, add ggml headers for unknown types)", func(s string) error {
+		headers = append(headers, s)
+		return nil
+	})
+	var (
+		buildFlag = flag.String("build", "", "llama.cpp build the header belongs to, e.g. b7000 (required)")
+		pkgDir    = flag.String("pkg", ".", "Directory of the gollama package")
+		outPath   = flag.String("out", "", "Output file (default: <pkg>/params_b<build>.go, or stdout with -print-go)")
+		printGo   = flag.Bool("print-go", false, "Print Go struct definitions instead of a layout file")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("gollama-genstructs: ")
+
+	if len(headers) == 0 || *buildFlag == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	build, err := strconv.Atoi(strings.TrimPrefix(*buildFlag, "b"))
+	if err != nil || build <= 0 {
+		log.Fatalf("invalid -build %q", *buildFlag)
+	}
+
+	h := newHeader()
+	for _, path := range headers {
+		if err := h.parseFile(path); err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+	pkg, err := loadGoPackage(*pkgDir)
+	if err != nil {
+		log.Fatalf("loading package: %v", err)
+	}
+
+	var mappings []*structMapping
+	for _, ps := range paramStructs {
+		c, err := h.layoutStruct(ps.cName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		g, err := pkg.lookupStruct(ps.goName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m, err := mapStruct(ps, c, g)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, name := range m.cOnly {
+			log.Printf("%s.%s has no %s field, library default kept", ps.cName, name, ps.goName)
+		}
+		for _, name := range m.goOnly {
+			log.Printf("%s.%s does not exist in b%d, dropped", ps.goName, name, build)
+		}
+		log.Printf("%s: %d bytes, native=%v", ps.cName, c.size, m.native)
+		mappings = append(mappings, m)
+	}
+
+	var out []byte
+	if *printGo {
+		out, err = generateGoStructs(build, mappings)
+	} else {
+		out, err = generateLayout(build, filepath.Base(headers[len(headers)-1]), mappings)
+	}
+	if err != nil {
+		log.Fatalf("formatting output: %v", err)
+	}
+
+	path := *outPath
+	if path == "" && !*printGo {
+		path = filepath.Join(*pkgDir, fmt.Sprintf("params_b%d.go", build))
+	}
+	if path == "" || path == "-" {
+		_, _ = os.Stdout.Write(out)
+		return
+	}
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %s", path)
+}
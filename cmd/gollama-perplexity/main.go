@@ -0,0 +1,78 @@
+// Command gollama-perplexity computes the perplexity of a GGUF model on a
+// text file, like llama.cpp's llama-perplexity, to compare quantizations
+// and context settings of the same model: lower is better.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+func main() {
+	var (
+		modelPath = flag.String("model", "", "Path to the GGUF model file (required)")
+		file      = flag.String("file", "", "Text file to evaluate, e.g. wiki.test.raw (required)")
+		nCtx      = flag.Int("ctx", 512, "Context size, the length of each evaluation window")
+		stride    = flag.Int("stride", 0, "Tokens the window moves by (0 = half the context)")
+		nBatch    = flag.Int("batch", 512, "Logical batch size")
+		threads   = flag.Int("threads", 0, "Number of threads to use (0 = all CPUs)")
+		gpuLayers = flag.Int("gpu-layers", 0, "Number of layers to offload to the GPU")
+	)
+	flag.Parse()
+
+	if *modelPath == "" || *file == "" {
+		log.Print("Error: -model and -file are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	text, err := os.ReadFile(*file)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *file, err)
+	}
+
+	if err := gollama.Backend_init(); err != nil {
+		log.Fatalf("Failed to initialize backend: %v", err)
+	}
+	defer gollama.Backend_free()
+	if err := gollama.Ggml_backend_load_all(); err != nil {
+		log.Printf("Warning: failed to load ggml backends: %v", err)
+	}
+
+	modelParams := gollama.Model_default_params()
+	modelParams.NGpuLayers = int32(*gpuLayers)
+	model, err := gollama.LoadModel(*modelPath, modelParams)
+	if err != nil {
+		log.Fatalf("Failed to load model: %v", err)
+	}
+	defer model.Free()
+
+	ctxParams := gollama.Context_default_params()
+	ctxParams.NCtx = uint32(*nCtx)
+	ctxParams.NBatch = uint32(*nBatch)
+	if *threads > 0 {
+		ctxParams.NThreads = int32(*threads)
+		ctxParams.NThreadsBatch = int32(*threads)
+	}
+	ctx, err := gollama.NewContext(model, ctxParams)
+	if err != nil {
+		log.Fatalf("Failed to create context: %v", err)
+	}
+	defer ctx.Free()
+
+	start := time.Now()
+	ppl, err := gollama.Perplexity(ctx, model, string(text), *stride)
+	if err != nil {
+		log.Fatalf("Perplexity failed: %v", err)
+	}
+	fmt.Printf("model: %s\n", gollama.Model_desc(model.Handle()))
+	if *stride <= 0 {
+		*stride = int(ctx.NCtx) / 2
+	}
+	fmt.Printf("context: %d, stride: %d\n", ctx.NCtx, *stride)
+	fmt.Printf("PPL = %.4f (%s)\n", ppl, time.Since(start).Round(time.Millisecond))
+}
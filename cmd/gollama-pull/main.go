@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+func main() {
+	var (
+		hf           = flag.String("hf", "", "Hugging Face model to pull: <owner>/<name>[:<quant>][@<revision>]")
+		dir          = flag.String("dir", gollama.DefaultModelCacheDir(), "Model cache directory")
+		list         = flag.Bool("list", false, "List the GGUF files of the repository instead of pulling")
+		retries      = flag.Int("retries", gollama.DefaultRetryPolicy().MaxAttempts, "Attempts per file; interrupted downloads resume")
+		showProgress = flag.Bool("progress", true, "Print download progress to stderr")
+	)
+	flag.Usage = usage
+	flag.Parse()
+
+	refString := *hf
+	if refString == "" && flag.NArg() == 1 {
+		refString = flag.Arg(0)
+	}
+	if refString == "" {
+		usage()
+		os.Exit(2)
+	}
+	ref, err := gollama.ParseHFModelRef(refString)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	downloader, err := gollama.NewLibraryDownloader()
+	if err != nil {
+		log.Fatalf("Failed to create downloader: %v", err)
+	}
+	policy := gollama.DefaultRetryPolicy()
+	policy.MaxAttempts = *retries
+	downloader.SetRetryPolicy(policy)
+	if *showProgress {
+		downloader.SetProgressCallback(printProgress)
+	}
+
+	if *list {
+		files, err := downloader.ListHFModelFiles(ref)
+		if err != nil {
+			log.Fatalf("Failed to list %s: %v", ref.Repo, err)
+		}
+		for _, f := range files {
+			if strings.HasSuffix(strings.ToLower(f.Path), ".gguf") {
+				fmt.Printf("%10.1f MiB  %s\n", float64(f.Size)/(1<<20), f.Path)
+			}
+		}
+		return
+	}
+
+	path, err := downloader.PullHFModel(ref, *dir)
+	if err != nil {
+		log.Fatalf("Failed to pull %s: %v", ref, err)
+	}
+	fmt.Println(path)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "gollama.cpp model downloader\n\n")
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <owner>/<name>[:<quant>][@<revision>]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Options:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\nThe path of the model (or the first part of a split model) is printed on success.\n")
+	fmt.Fprintf(os.Stderr, "HF_TOKEN authenticates gated repositories; HF_ENDPOINT selects another Hub.\n\n")
+	fmt.Fprintf(os.Stderr, "Examples:\n")
+	fmt.Fprintf(os.Stderr, "  %s -hf TheBloke/TinyLlama-1.1B-Chat-v1.0-GGUF:Q4_K_M\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s -list ggml-org/gemma-3-1b-it-GGUF\n", os.Args[0])
+}
+
+// printProgress prints download progress on one line of stderr.
+func printProgress(received, total int64) {
+	if total > 0 {
+		fmt.Fprintf(os.Stderr, "\r   %8.1f / %8.1f MiB (%3d%%)", float64(received)/(1<<20), float64(total)/(1<<20), received*100/total)
+		if received == total {
+			fmt.Fprintln(os.Stderr)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r   %8.1f MiB", float64(received)/(1<<20))
+}
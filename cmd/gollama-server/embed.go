@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+var errEmbedClosed = errors.New("embedding queue closed")
+
+// embedBatcher embeds the inputs of concurrent requests together. While one
+// batch is evaluated, the requests arriving queue up, and the next batch
+// takes every queued request up to capacity tokens, so a burst of small
+// requests costs a few full decodes instead of one decode per input.
+type embedBatcher struct {
+	embed    func(inputs [][]gollama.LlamaToken) ([][]float32, error)
+	capacity int
+
+	queue chan *embedJob
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+type embedJob struct {
+	inputs [][]gollama.LlamaToken
+	vecs   [][]float32
+	err    error
+	done   chan struct{}
+}
+
+// newEmbedBatcher starts a batcher evaluating batches of about capacity
+// tokens with embed.
+func newEmbedBatcher(embed func([][]gollama.LlamaToken) ([][]float32, error), capacity int) *embedBatcher {
+	b := &embedBatcher{
+		embed:    embed,
+		capacity: capacity,
+		queue:    make(chan *embedJob),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Embed returns the embeddings of inputs, in order, once a batch has
+// evaluated them.
+func (b *embedBatcher) Embed(ctx context.Context, inputs [][]gollama.LlamaToken) ([][]float32, error) {
+	job := &embedJob{inputs: inputs, done: make(chan struct{})}
+	select {
+	case b.queue <- job:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-b.quit:
+		return nil, errEmbedClosed
+	}
+	select {
+	case <-job.done:
+		return job.vecs, job.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the batcher after the batch in progress.
+func (b *embedBatcher) Close() {
+	close(b.quit)
+	<-b.done
+}
+
+func (b *embedBatcher) run() {
+	defer close(b.done)
+	for {
+		var jobs []*embedJob
+		select {
+		case job := <-b.queue:
+			jobs = append(jobs, job)
+		case <-b.quit:
+			return
+		}
+		tokens := countTokens(jobs[0].inputs)
+	gather:
+		for tokens < b.capacity {
+			select {
+			case job := <-b.queue:
+				jobs = append(jobs, job)
+				tokens += countTokens(job.inputs)
+			default:
+				break gather
+			}
+		}
+		b.flush(jobs)
+	}
+}
+
+// flush evaluates the inputs of jobs in one call and hands every job its
+// embeddings.
+func (b *embedBatcher) flush(jobs []*embedJob) {
+	var inputs [][]gollama.LlamaToken
+	for _, job := range jobs {
+		inputs = append(inputs, job.inputs...)
+	}
+	vecs, err := b.embed(inputs)
+	for _, job := range jobs {
+		if err != nil {
+			job.err = err
+		} else {
+			job.vecs, vecs = vecs[:len(job.inputs)], vecs[len(job.inputs):]
+		}
+		close(job.done)
+	}
+}
+
+func countTokens(inputs [][]gollama.LlamaToken) int {
+	n := 0
+	for _, tokens := range inputs {
+		n += len(tokens)
+	}
+	return n
+}
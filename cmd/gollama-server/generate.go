@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+// genParams are the resolved sampling settings of a request.
+type genParams struct {
+	gollama.SamplingParams
+	MaxTokens int
+	Stop      []string
+}
+
+func (s *server) resolveParams(req samplingRequest) genParams {
+	p := genParams{
+		SamplingParams: gollama.DefaultSamplingParams(),
+		MaxTokens:      s.cfg.MaxTokens,
+	}
+	if req.MaxTokens != nil && *req.MaxTokens > 0 {
+		p.MaxTokens = *req.MaxTokens
+	}
+	if req.Temperature != nil {
+		p.Temperature = *req.Temperature
+	}
+	if req.TopP != nil {
+		p.TopP = *req.TopP
+	}
+	if req.TopK != nil {
+		p.TopK = *req.TopK
+	}
+	if req.MinP != nil {
+		p.MinP = *req.MinP
+	}
+	if req.Seed != nil {
+		p.Seed = *req.Seed
+	}
+	for _, stop := range req.Stop {
+		if stop != "" {
+			p.Stop = append(p.Stop, stop)
+		}
+	}
+	return p
+}
+
+type genResult struct {
+	Text             string
+	PromptTokens     int
+	CompletionTokens int
+	FinishReason     string
+}
+
+// generate runs prompt through the model and samples up to p.MaxTokens
+// tokens. media holds the images referenced by markers in prompt. onDelta,
+// when set, receives the text as it is produced; returning an error from it
+// aborts generation. Requests are served one at a time.
+func (s *server) generate(ctx context.Context, prompt string, media [][]byte, p genParams, onDelta func(string) error) (genResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	opts := gollama.GenerateOptions{
+		MaxTokens: p.MaxTokens,
+		Stop:      p.Stop,
+		Sampling:  &p.SamplingParams,
+		OnText:    onDelta,
+	}
+	var tokens []gollama.LlamaToken
+	if len(media) > 0 {
+		s.ctx.SeqRm(0, 0, -1)
+		if _, err := s.mm.Eval(s.ctx.Handle(), prompt, media, 0, 0, int32(s.nBatch)); err != nil {
+			return genResult{}, fmt.Errorf("failed to process prompt: %w", err)
+		}
+		opts.Prefilled = true
+	} else {
+		var err error
+		tokens, err = s.model.Tokenize(prompt, s.model.AddBOS, true)
+		if err != nil {
+			return genResult{}, err
+		}
+		if len(tokens) == 0 {
+			return genResult{}, fmt.Errorf("prompt is empty")
+		}
+		if len(tokens) >= s.nCtx {
+			return genResult{PromptTokens: len(tokens)}, fmt.Errorf("prompt of %d tokens exceeds the context size of %d", len(tokens), s.nCtx)
+		}
+	}
+
+	out, err := s.ctx.Generate(ctx, tokens, opts)
+	return genResult{
+		Text:             out.Text,
+		PromptTokens:     out.PromptTokens,
+		CompletionTokens: out.CompletionTokens,
+		FinishReason:     out.StopReason.FinishReason(),
+	}, err
+}
@@ -0,0 +1,146 @@
+// Command gollama-server serves a GGUF model over an OpenAI-compatible HTTP
+// API: /v1/models, /v1/chat/completions, /v1/completions and /v1/embeddings.
+//
+// The completion endpoints stream with server-sent events when the request
+// sets "stream", and over a WebSocket when the client upgrades the
+// connection: every text message is then a request, answered with the
+// same chunks as SSE events, one per message, ending with "[DONE]" or an
+// error object. Output a slow client has not read yet is merged into
+// larger chunks instead of holding up generation for other requests.
+//
+// The inputs of concurrent embedding requests are evaluated together, up
+// to -embed-batch inputs per decode; "dimensions" truncates and
+// renormalizes the embeddings of Matryoshka-trained models.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+func main() {
+	var (
+		modelPath  = flag.String("model", "", "Path to the GGUF model file (required)")
+		addr       = flag.String("addr", ":8080", "Address to listen on")
+		nCtx       = flag.Int("ctx", 4096, "Context size")
+		nBatch     = flag.Int("batch", 512, "Logical batch size used for prompt processing")
+		threads    = flag.Int("threads", 0, "Number of threads to use (0 = all CPUs)")
+		gpuLayers  = flag.Int("gpu-layers", 0, "Number of layers to offload to the GPU")
+		maxTokens  = flag.Int("max-tokens", 512, "Default maximum number of generated tokens")
+		template   = flag.String("template", "", "Chat template name overriding the model's (e.g. chatml, llama3)")
+		alias      = flag.String("alias", "", "Model name reported by the API (default: model file name)")
+		mmproj     = flag.String("mmproj", "", "Path to a multimodal projector GGUF enabling image input")
+		embeddings = flag.Bool("embeddings", false, "Enable the /v1/embeddings endpoint")
+		embedSeqs  = flag.Int("embed-batch", 16, "Maximum number of inputs embedded in one decode")
+		metrics    = flag.Bool("metrics", false, "Enable collection of metrics served on /metrics")
+	)
+	flag.Parse()
+
+	if *modelPath == "" {
+		log.Print("Error: -model is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := gollama.Backend_init(); err != nil {
+		log.Fatalf("Failed to initialize backend: %v", err)
+	}
+	defer gollama.Backend_free()
+	if err := gollama.Ggml_backend_load_all(); err != nil {
+		log.Printf("Warning: failed to load ggml backends: %v", err)
+	}
+	if *metrics {
+		gollama.EnableMetrics(true)
+	}
+
+	modelParams := gollama.Model_default_params()
+	modelParams.NGpuLayers = int32(*gpuLayers)
+	log.Printf("Loading model %s", *modelPath)
+	model, err := gollama.LoadModel(*modelPath, modelParams)
+	if err != nil {
+		log.Fatalf("Failed to load model: %v", err)
+	}
+	defer model.Free()
+
+	ctxParams := gollama.Context_default_params()
+	ctxParams.NCtx = uint32(*nCtx)
+	ctxParams.NBatch = uint32(*nBatch)
+	if *threads > 0 {
+		ctxParams.NThreads = int32(*threads)
+		ctxParams.NThreadsBatch = int32(*threads)
+	}
+	lctx, err := gollama.NewContext(model, ctxParams)
+	if err != nil {
+		log.Fatalf("Failed to create context: %v", err)
+	}
+
+	chatTemplate := *template
+	if chatTemplate == "" {
+		chatTemplate = gollama.DetectChatTemplate(model.Handle())
+	}
+	name := *alias
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(*modelPath), filepath.Ext(*modelPath))
+	}
+
+	srv := &server{
+		cfg: serverConfig{
+			ModelName:    name,
+			ChatTemplate: chatTemplate,
+			MaxTokens:    *maxTokens,
+			Embeddings:   *embeddings,
+			EmbedSeqs:    *embedSeqs,
+		},
+		model:    model,
+		created:  time.Now().Unix(),
+		ctx:      lctx,
+		nCtx:     *nCtx,
+		nBatch:   *nBatch,
+		shutdown: make(chan struct{}),
+	}
+	defer srv.close()
+
+	if *mmproj != "" {
+		srv.mm, err = gollama.NewMultimodalContext(*mmproj, model.Handle(), nil)
+		if err != nil {
+			log.Fatalf("Failed to load multimodal projector: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", srv.routes())
+	if *metrics {
+		mux.Handle("/metrics", gollama.MetricsHandler())
+	}
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	httpServer.RegisterOnShutdown(srv.closeWebSockets)
+
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go func() {
+		<-stop.Done()
+		shutdownCtx, done := context.WithTimeout(context.Background(), 10*time.Second)
+		defer done()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Serving %s on %s", name, *addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Server error: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+// stringList accepts either a JSON string or an array of strings, as the
+// OpenAI API does for "stop", "prompt" and "input".
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*l = stringList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("expected a string or an array of strings")
+	}
+	*l = many
+	return nil
+}
+
+// samplingRequest holds the sampling fields shared by the completion
+// endpoints. Pointers distinguish "not set" from zero values.
+type samplingRequest struct {
+	MaxTokens   *int       `json:"max_tokens,omitempty"`
+	Temperature *float32   `json:"temperature,omitempty"`
+	TopP        *float32   `json:"top_p,omitempty"`
+	TopK        *int32     `json:"top_k,omitempty"`
+	MinP        *float32   `json:"min_p,omitempty"`
+	Seed        *uint32    `json:"seed,omitempty"`
+	Stop        stringList `json:"stop,omitempty"`
+	Stream      bool       `json:"stream,omitempty"`
+}
+
+type chatCompletionRequest struct {
+	Model    string                `json:"model"`
+	Messages []gollama.ChatMessage `json:"messages"`
+	samplingRequest
+}
+
+type completionRequest struct {
+	Model  string     `json:"model"`
+	Prompt stringList `json:"prompt"`
+	samplingRequest
+}
+
+type embeddingRequest struct {
+	Model string     `json:"model"`
+	Input stringList `json:"input"`
+	// Dimensions truncates the embeddings, for models trained with
+	// Matryoshka representation learning
+	Dimensions *int `json:"dimensions,omitempty"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func newUsage(prompt, completion int) *usage {
+	return &usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
+
+type chatMessageDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type chatChoice struct {
+	Index        int                  `json:"index"`
+	Message      *gollama.ChatMessage `json:"message,omitempty"`
+	Delta        *chatMessageDelta    `json:"delta,omitempty"`
+	FinishReason *string              `json:"finish_reason"`
+}
+
+type chatCompletionResponse struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"`
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *usage       `json:"usage,omitempty"`
+}
+
+type completionChoice struct {
+	Index        int     `json:"index"`
+	Text         string  `json:"text"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+type completionResponse struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []completionChoice `json:"choices"`
+	Usage   *usage             `json:"usage,omitempty"`
+}
+
+type embeddingData struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+type embeddingResponse struct {
+	Object string          `json:"object"`
+	Data   []embeddingData `json:"data"`
+	Model  string          `json:"model"`
+	Usage  *usage          `json:"usage"`
+}
+
+type modelInfo struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type modelList struct {
+	Object string      `json:"object"`
+	Data   []modelInfo `json:"data"`
+}
+
+type apiError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
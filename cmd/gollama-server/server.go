@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+// serverConfig holds the settings shared by all requests.
+type serverConfig struct {
+	ModelName    string
+	ChatTemplate string
+	MaxTokens    int
+	Embeddings   bool
+	// EmbedSeqs is the number of inputs embedded in one decode
+	EmbedSeqs int
+}
+
+// server serves the OpenAI-compatible API for a single loaded model.
+type server struct {
+	cfg     serverConfig
+	model   *gollama.Model
+	created int64
+
+	// mu serializes generation on ctx
+	mu     sync.Mutex
+	ctx    *gollama.Context
+	nCtx   int
+	nBatch int
+
+	// mm is set when a multimodal projector was loaded
+	mm *gollama.MultimodalContext
+
+	// shutdown is closed when the HTTP server shuts down, which does not
+	// end the WebSocket connections it handed over
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+
+	embedOnce  sync.Once
+	embedder   *gollama.EncoderPipeline
+	embedQueue *embedBatcher
+	embedErr   error
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/v1/models", s.handleModels)
+	mux.HandleFunc("/v1/chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("/v1/completions", s.handleCompletions)
+	mux.HandleFunc("/v1/embeddings", s.handleEmbeddings)
+	return mux
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *server) handleModels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, modelList{
+		Object: "list",
+		Data:   []modelInfo{{ID: s.cfg.ModelName, Object: "model", Created: s.created, OwnedBy: "gollama"}},
+	})
+}
+
+// completionJob is a validated completion request.
+type completionJob struct {
+	id      string
+	created int64
+	prompt  string
+	// media holds the images of a multimodal chat prompt
+	media  [][]byte
+	params genParams
+}
+
+// requestError is a request that cannot be served, with its HTTP status.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string { return e.message }
+
+func badRequest(format string, args ...any) error {
+	return &requestError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+func (s *server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if isWebSocketUpgrade(r) {
+		s.serveWebSocket(w, r, func(ctx context.Context, body []byte, stream eventStream) {
+			var req chatCompletionRequest
+			if err := json.Unmarshal(body, &req); err != nil {
+				stream.Error(badRequest("invalid request body: %v", err))
+				return
+			}
+			job, err := s.chatJob(req)
+			if err != nil {
+				stream.Error(err)
+				return
+			}
+			s.streamChat(ctx, job, stream)
+		})
+		return
+	}
+
+	var req chatCompletionRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	job, err := s.chatJob(req)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	if !req.Stream {
+		res, err := s.generate(r.Context(), job.prompt, job.media, job.params, nil)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, chatCompletionResponse{
+			ID: job.id, Object: "chat.completion", Created: job.created, Model: s.cfg.ModelName,
+			Choices: []chatChoice{{
+				Message:      &gollama.ChatMessage{Role: "assistant", Content: res.Text},
+				FinishReason: &res.FinishReason,
+			}},
+			Usage: newUsage(res.PromptTokens, res.CompletionTokens),
+		})
+		return
+	}
+
+	stream, ok := newSSEStream(w)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	s.streamChat(r.Context(), job, stream)
+}
+
+// chatJob formats the messages of req with the chat template.
+func (s *server) chatJob(req chatCompletionRequest) (completionJob, error) {
+	job := completionJob{id: "chatcmpl-" + newID(), created: time.Now().Unix()}
+	if len(req.Messages) == 0 {
+		return job, badRequest("messages must not be empty")
+	}
+	var err error
+	if hasImages(req.Messages) {
+		if s.mm == nil {
+			return job, badRequest("this model does not accept images; start the server with -mmproj")
+		}
+		job.prompt, job.media, err = s.mm.ApplyChat(s.cfg.ChatTemplate, req.Messages, true)
+	} else {
+		job.prompt, err = gollama.Chat_apply_template(s.cfg.ChatTemplate, req.Messages, true)
+	}
+	if err != nil {
+		return job, &requestError{status: http.StatusInternalServerError, message: fmt.Sprintf("failed to apply chat template: %v", err)}
+	}
+	job.params = s.resolveParams(req.samplingRequest)
+	if err := job.params.Validate(); err != nil {
+		return job, badRequest("%v", err)
+	}
+	return job, nil
+}
+
+// streamChat generates the reply of job as chat.completion.chunk events.
+func (s *server) streamChat(ctx context.Context, job completionJob, stream eventStream) {
+	chunk := func(delta *chatMessageDelta, finish *string) chatCompletionResponse {
+		return chatCompletionResponse{
+			ID: job.id, Object: "chat.completion.chunk", Created: job.created, Model: s.cfg.ModelName,
+			Choices: []chatChoice{{Delta: delta, FinishReason: finish}},
+		}
+	}
+	if err := stream.Send(chunk(&chatMessageDelta{Role: "assistant"}, nil)); err != nil {
+		return
+	}
+	res, err := s.generateStream(ctx, job, func(text string) error {
+		return stream.Send(chunk(&chatMessageDelta{Content: text}, nil))
+	})
+	if err != nil {
+		stream.Error(err)
+		return
+	}
+	final := chunk(&chatMessageDelta{}, &res.FinishReason)
+	final.Usage = newUsage(res.PromptTokens, res.CompletionTokens)
+	if stream.Send(final) == nil {
+		stream.Done()
+	}
+}
+
+func (s *server) handleCompletions(w http.ResponseWriter, r *http.Request) {
+	if isWebSocketUpgrade(r) {
+		s.serveWebSocket(w, r, func(ctx context.Context, body []byte, stream eventStream) {
+			var req completionRequest
+			if err := json.Unmarshal(body, &req); err != nil {
+				stream.Error(badRequest("invalid request body: %v", err))
+				return
+			}
+			job, err := s.completionJob(req)
+			if err != nil {
+				stream.Error(err)
+				return
+			}
+			s.streamCompletion(ctx, job, stream)
+		})
+		return
+	}
+
+	var req completionRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	job, err := s.completionJob(req)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	if !req.Stream {
+		res, err := s.generate(r.Context(), job.prompt, nil, job.params, nil)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, completionResponse{
+			ID: job.id, Object: "text_completion", Created: job.created, Model: s.cfg.ModelName,
+			Choices: []completionChoice{{Text: res.Text, FinishReason: &res.FinishReason}},
+			Usage:   newUsage(res.PromptTokens, res.CompletionTokens),
+		})
+		return
+	}
+
+	stream, ok := newSSEStream(w)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	s.streamCompletion(r.Context(), job, stream)
+}
+
+// completionJob validates a text completion request.
+func (s *server) completionJob(req completionRequest) (completionJob, error) {
+	job := completionJob{id: "cmpl-" + newID(), created: time.Now().Unix()}
+	if len(req.Prompt) != 1 {
+		return job, badRequest("prompt must be a single string")
+	}
+	job.prompt = req.Prompt[0]
+	job.params = s.resolveParams(req.samplingRequest)
+	if err := job.params.Validate(); err != nil {
+		return job, badRequest("%v", err)
+	}
+	return job, nil
+}
+
+// streamCompletion generates the completion of job as text_completion
+// events.
+func (s *server) streamCompletion(ctx context.Context, job completionJob, stream eventStream) {
+	chunk := func(text string, finish *string) completionResponse {
+		return completionResponse{
+			ID: job.id, Object: "text_completion", Created: job.created, Model: s.cfg.ModelName,
+			Choices: []completionChoice{{Text: text, FinishReason: finish}},
+		}
+	}
+	res, err := s.generateStream(ctx, job, func(text string) error {
+		return stream.Send(chunk(text, nil))
+	})
+	if err != nil {
+		stream.Error(err)
+		return
+	}
+	final := chunk("", &res.FinishReason)
+	final.Usage = newUsage(res.PromptTokens, res.CompletionTokens)
+	if stream.Send(final) == nil {
+		stream.Done()
+	}
+}
+
+// generateStream generates job and hands the text to send through a
+// deltaQueue, so the model is released as soon as generation ends, however
+// slowly the client reads.
+func (s *server) generateStream(ctx context.Context, job completionJob, send func(text string) error) (genResult, error) {
+	q := newDeltaQueue(send)
+	res, err := s.generate(ctx, job.prompt, job.media, job.params, q.Push)
+	if qerr := q.Close(); err == nil {
+		err = qerr
+	}
+	return res, err
+}
+
+func (s *server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Embeddings {
+		writeError(w, http.StatusNotFound, "embeddings are disabled; start the server with -embeddings")
+		return
+	}
+	var req embeddingRequest
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if len(req.Input) == 0 {
+		writeError(w, http.StatusBadRequest, "input must not be empty")
+		return
+	}
+	nEmbd := int(gollama.Model_n_embd(s.model.Handle()))
+	if req.Dimensions != nil && (*req.Dimensions <= 0 || *req.Dimensions > nEmbd) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("dimensions must be between 1 and %d", nEmbd))
+		return
+	}
+
+	batcher, err := s.embeddingBatcher()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := embeddingResponse{Object: "list", Model: s.cfg.ModelName, Usage: &usage{}}
+	inputs := make([][]gollama.LlamaToken, len(req.Input))
+	for i, text := range req.Input {
+		tokens, err := s.model.Tokenize(text, s.model.AddBOS, false)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("input %d: %v", i, err))
+			return
+		}
+		if len(tokens) == 0 || len(tokens) > batcher.capacity {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("input %d has %d tokens, must have 1 to %d", i, len(tokens), batcher.capacity))
+			return
+		}
+		inputs[i] = tokens
+		resp.Usage.PromptTokens += len(tokens)
+		resp.Usage.TotalTokens += len(tokens)
+	}
+	vecs, err := batcher.Embed(r.Context(), inputs)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i, vec := range vecs {
+		// Matryoshka truncation, as the OpenAI API does for text-embedding-3
+		if req.Dimensions != nil && *req.Dimensions < len(vec) {
+			if vec, err = gollama.Truncate(vec, *req.Dimensions); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		resp.Data = append(resp.Data, embeddingData{Object: "embedding", Index: i, Embedding: vec})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// embeddingBatcher creates the embedding context on first use, so servers
+// that only generate text do not pay for it. Its sequences share the whole
+// context, since inputs are evaluated in batches of cfg.EmbedSeqs.
+func (s *server) embeddingBatcher() (*embedBatcher, error) {
+	s.embedOnce.Do(func() {
+		params := gollama.Context_default_params()
+		params.NCtx = uint32(s.nCtx)
+		params.NBatch = uint32(s.nBatch)
+		params.NSeqMax = uint32(max(s.cfg.EmbedSeqs, 1))
+		params.KvUnified = 1
+		s.embedder, s.embedErr = gollama.NewEncoderPipeline(s.model.Handle(), params)
+		if s.embedErr == nil {
+			s.embedQueue = newEmbedBatcher(s.embedder.EmbedTokensBatch, s.embedder.BatchCapacity())
+		}
+	})
+	return s.embedQueue, s.embedErr
+}
+
+// closeWebSockets ends the WebSocket connections; it is registered with
+// http.Server.RegisterOnShutdown.
+func (s *server) closeWebSockets() {
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+}
+
+func (s *server) close() {
+	if s.mm != nil {
+		s.mm.Close()
+	}
+	if s.embedQueue != nil {
+		s.embedQueue.Close()
+	}
+	if s.embedder != nil {
+		s.embedder.Close()
+	}
+	if s.ctx != nil {
+		s.ctx.Free()
+	}
+}
+
+func hasImages(messages []gollama.ChatMessage) bool {
+	for _, msg := range messages {
+		if len(msg.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<20))
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Debug("failed to write response", "error", err)
+	}
+}
+
+// writeRequestError writes err, a *requestError or an internal error.
+func writeRequestError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		writeError(w, reqErr.status, reqErr.message)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	var e apiError
+	e.Error.Message = message
+	e.Error.Type = "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		e.Error.Type = "server_error"
+	}
+	writeJSON(w, status, e)
+}
+
+func newID() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// streamWriteTimeout bounds every write to a streaming client, so a
+	// client that stopped reading cannot hold its connection forever
+	streamWriteTimeout = 30 * time.Second
+	// maxPendingDelta is the text a client may fall behind by before its
+	// stream is aborted
+	maxPendingDelta = 1 << 20
+)
+
+// errSlowClient aborts the generation of a client that does not keep up.
+var errSlowClient = errors.New("client is not reading the stream")
+
+// eventStream sends the chunks of a streaming response over SSE or a
+// WebSocket. Its methods must not be called concurrently.
+type eventStream interface {
+	// Send writes v as one JSON event.
+	Send(v any) error
+	// Error reports a failure after the stream has started, when the HTTP
+	// status can no longer be changed.
+	Error(err error)
+	// Done ends the stream with the [DONE] event.
+	Done()
+}
+
+// deltaQueue decouples generation from the client connection: Push never
+// waits for the client, and the text pushed while a chunk is being written
+// is merged into the next one, so a slow client receives fewer, larger
+// chunks instead of stalling the model for every other request. A client
+// falling behind by more than maxPendingDelta bytes, or whose connection
+// fails, makes Push return an error, which aborts the generation.
+type deltaQueue struct {
+	send func(text string) error
+
+	mu      sync.Mutex
+	pending strings.Builder
+	closed  bool
+	err     error
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+// newDeltaQueue starts a queue writing its text with send.
+func newDeltaQueue(send func(text string) error) *deltaQueue {
+	q := &deltaQueue{send: send, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go q.run()
+	return q
+}
+
+// Push queues text for the client.
+func (q *deltaQueue) Push(text string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err != nil {
+		return q.err
+	}
+	if q.pending.Len()+len(text) > maxPendingDelta {
+		q.err = errSlowClient
+		return q.err
+	}
+	q.pending.WriteString(text)
+	q.signal()
+	return nil
+}
+
+// Close writes the queued text and returns the first error of the stream.
+func (q *deltaQueue) Close() error {
+	q.mu.Lock()
+	q.closed = true
+	q.signal()
+	q.mu.Unlock()
+	<-q.done
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+// signal wakes run; q.mu must be held.
+func (q *deltaQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *deltaQueue) run() {
+	defer close(q.done)
+	for range q.wake {
+		for {
+			q.mu.Lock()
+			text, closed, failed := q.pending.String(), q.closed, q.err != nil
+			q.pending.Reset()
+			q.mu.Unlock()
+			if text == "" || failed {
+				if closed || failed {
+					return
+				}
+				break
+			}
+			if err := q.send(text); err != nil {
+				q.mu.Lock()
+				if q.err == nil {
+					q.err = err
+				}
+				q.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// sseStream writes server-sent events in the format used by the OpenAI API.
+type sseStream struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	flusher http.Flusher
+}
+
+func newSSEStream(w http.ResponseWriter) (*sseStream, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	return &sseStream{w: w, rc: http.NewResponseController(w), flusher: flusher}, true
+}
+
+func (s *sseStream) Send(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.write(fmt.Sprintf("data: %s\n\n", data))
+}
+
+func (s *sseStream) Error(err error) {
+	if e, ok := streamError(err); ok {
+		_ = s.Send(e)
+	}
+}
+
+func (s *sseStream) Done() {
+	_ = s.write("data: [DONE]\n\n")
+}
+
+func (s *sseStream) write(event string) error {
+	// Not every ResponseWriter supports deadlines; the write then waits
+	// for the client
+	_ = s.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if _, err := fmt.Fprint(s.w, event); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// streamError returns the event reporting err to a streaming client, or
+// false when the client went away and there is nobody to tell.
+func streamError(err error) (apiError, bool) {
+	var e apiError
+	if errors.Is(err, context.Canceled) {
+		return e, false
+	}
+	e.Error.Message = err.Error()
+	e.Error.Type = "server_error"
+	var reqErr *requestError
+	if errors.As(err, &reqErr) && reqErr.status < http.StatusInternalServerError {
+		e.Error.Type = "invalid_request_error"
+	}
+	return e, true
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DeltaQueueSuite struct{ suite.Suite }
+
+// blockedSender is a client that reads one chunk whenever release is
+// signalled.
+type blockedSender struct {
+	mu      sync.Mutex
+	chunks  []string
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockedSender() *blockedSender {
+	return &blockedSender{started: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (b *blockedSender) send(text string) error {
+	b.started <- struct{}{}
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.chunks = append(b.chunks, text)
+	return nil
+}
+
+func (b *blockedSender) sent() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.chunks...)
+}
+
+func (s *DeltaQueueSuite) TestMergesTextWhileClientIsBusy() {
+	b := newBlockedSender()
+	q := newDeltaQueue(b.send)
+
+	s.Require().NoError(q.Push("a"))
+	<-b.started
+	// The client is still reading "a"; these are merged into one chunk
+	s.Require().NoError(q.Push("b"))
+	s.Require().NoError(q.Push("c"))
+	close(b.release)
+
+	s.NoError(q.Close())
+	s.Equal([]string{"a", "bc"}, b.sent())
+}
+
+func (s *DeltaQueueSuite) TestPushNeverWaitsForClient() {
+	b := newBlockedSender()
+	q := newDeltaQueue(b.send)
+	s.Require().NoError(q.Push("first"))
+	<-b.started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = q.Push("more")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		s.Fail("Push blocked on a client that is not reading")
+	}
+	close(b.release)
+	s.NoError(q.Close())
+	s.Equal("first"+strings.Repeat("more", 100), strings.Join(b.sent(), ""))
+}
+
+func (s *DeltaQueueSuite) TestSlowClientIsDropped() {
+	b := newBlockedSender()
+	q := newDeltaQueue(b.send)
+	s.Require().NoError(q.Push("x"))
+	<-b.started
+
+	s.Require().NoError(q.Push(strings.Repeat("y", maxPendingDelta)))
+	s.ErrorIs(q.Push("z"), errSlowClient)
+	s.ErrorIs(q.Push("z"), errSlowClient, "the queue stays failed")
+
+	close(b.release)
+	s.ErrorIs(q.Close(), errSlowClient)
+	s.Equal([]string{"x"}, b.sent(), "the backlog of a dropped client is discarded")
+}
+
+func (s *DeltaQueueSuite) TestSendErrorAbortsGeneration() {
+	errGone := errors.New("connection reset")
+	q := newDeltaQueue(func(string) error { return errGone })
+	s.Require().NoError(q.Push("a"))
+	s.Eventually(func() bool { return errors.Is(q.Push("b"), errGone) }, 5*time.Second, time.Millisecond)
+	s.ErrorIs(q.Close(), errGone)
+}
+
+func (s *DeltaQueueSuite) TestCloseFlushesPendingText() {
+	var mu sync.Mutex
+	var got strings.Builder
+	q := newDeltaQueue(func(text string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got.WriteString(text)
+		return nil
+	})
+	for _, piece := range []string{"Hello", ", ", "world"} {
+		s.Require().NoError(q.Push(piece))
+	}
+	s.NoError(q.Close())
+	s.Equal("Hello, world", got.String())
+}
+
+func TestDeltaQueueSuite(t *testing.T) { suite.Run(t, new(DeltaQueueSuite)) }
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket opcodes and close codes of RFC 6455.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+
+	wsCloseNormal   = 1000
+	wsCloseTooBig   = 1009
+	wsCloseProtocol = 1002
+	// wsCloseNoStatus and wsCloseAbnormal are reported locally and must
+	// never be sent
+	wsCloseNoStatus = 1005
+	wsCloseAbnormal = 1006
+
+	// wsMaxMessage matches the request body limit of decodeRequest
+	wsMaxMessage = 16 << 20
+	wsGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var errWSProtocol = errors.New("websocket protocol error")
+
+// isWebSocketUpgrade reports whether r asks to switch to the WebSocket
+// protocol.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		headerHasToken(r.Header, "Connection", "upgrade")
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveWebSocket upgrades the connection and serves the requests the client
+// sends as text messages, one after the other, with handle. Every response
+// is streamed as text messages, like the SSE events of a streaming request,
+// and ends with a "[DONE]" message; the connection stays open for the next
+// request until either side closes it or the server shuts down.
+func (s *server) serveWebSocket(w http.ResponseWriter, r *http.Request, handle func(ctx context.Context, body []byte, stream eventStream)) {
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, http.StatusUpgradeRequired, "unsupported websocket version")
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "missing Sec-WebSocket-Key")
+		return
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "websocket not supported")
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Time{})
+	sum := sha1.Sum([]byte(key + wsGUID))
+	_, _ = fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	ws := &wsConn{conn: conn, br: rw.Reader}
+	// Shutdown does not track hijacked connections
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.shutdown:
+			ws.close(wsCloseNormal, "server shutting down")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// The reader keeps answering pings and notices the client leaving
+	// while a response streams; requests sent meanwhile wait in the queue
+	requests := make(chan []byte, 4)
+	go func() {
+		defer cancel()
+		defer close(requests)
+		for {
+			body, err := ws.readMessage()
+			if err != nil {
+				switch {
+				case errors.Is(err, errWSProtocol):
+					ws.close(wsCloseProtocol, err.Error())
+				case errors.Is(err, errMessageTooBig):
+					ws.close(wsCloseTooBig, err.Error())
+				}
+				return
+			}
+			select {
+			case requests <- body:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	stream := &wsStream{ws: ws}
+	for body := range requests {
+		handle(ctx, body, stream)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+	ws.close(wsCloseNormal, "")
+}
+
+var errMessageTooBig = errors.New("message too big")
+
+// wsConn is the server side of a WebSocket connection. Reads happen on one
+// goroutine; writes are serialized.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+// readMessage returns the next text or binary message, answering control
+// frames on the way. It fails with io.EOF once the client closes.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	started := false
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			code := wsCloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.close(code, "")
+			return nil, io.EOF
+		case wsText, wsBinary:
+			if started {
+				return nil, fmt.Errorf("%w: new message inside a fragmented one", errWSProtocol)
+			}
+			started = true
+		case wsContinuation:
+			if !started {
+				return nil, fmt.Errorf("%w: continuation without a message", errWSProtocol)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown opcode %d", errWSProtocol, op)
+		}
+		if len(msg)+len(payload) > wsMaxMessage {
+			return nil, errMessageTooBig
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// readFrame reads one frame, which clients must mask.
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0F
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: reserved bits set", errWSProtocol)
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, fmt.Errorf("%w: unmasked client frame", errWSProtocol)
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= wsClose && (n > 125 || !fin) {
+		return false, 0, nil, fmt.Errorf("%w: invalid control frame", errWSProtocol)
+	}
+	if n > wsMaxMessage {
+		return false, 0, nil, errMessageTooBig
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// writeFrame writes one unfragmented, unmasked frame.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	return c.writeFrameLocked(op, payload)
+}
+
+func (c *wsConn) writeFrameLocked(op byte, payload []byte) error {
+	head := make([]byte, 2, 10+len(payload))
+	head[0] = 0x80 | op
+	switch n := len(payload); {
+	case n <= 125:
+		head[1] = byte(n)
+	case n <= 0xFFFF:
+		head[1] = 126
+		head = binary.BigEndian.AppendUint16(head, uint16(n))
+	default:
+		head[1] = 127
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	_, err := c.conn.Write(append(head, payload...))
+	return err
+}
+
+// close sends a close frame once; later writes fail. The reason is cut
+// to fit a control frame, on a UTF-8 boundary.
+func (c *wsConn) close(code int, reason string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	if code == wsCloseNoStatus || code == wsCloseAbnormal {
+		code = wsCloseNormal
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > 123 {
+		n := 123
+		for n > 0 && !utf8.RuneStart(reason[n]) {
+			n--
+		}
+		reason = reason[:n]
+	}
+	_ = c.writeFrameLocked(wsClose, append(payload, reason...))
+}
+
+// wsStream sends every event as a text message.
+type wsStream struct {
+	ws *wsConn
+}
+
+func (s *wsStream) Send(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.ws.writeFrame(wsText, data)
+}
+
+func (s *wsStream) Error(err error) {
+	if e, ok := streamError(err); ok {
+		_ = s.Send(e)
+	}
+}
+
+func (s *wsStream) Done() {
+	_ = s.ws.writeFrame(wsText, []byte("[DONE]"))
+}
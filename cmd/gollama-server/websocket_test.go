@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WebSocketSuite struct {
+	suite.Suite
+	ws     *wsConn
+	client net.Conn
+	cr     *bufio.Reader
+}
+
+func (s *WebSocketSuite) SetupTest() {
+	server, client := net.Pipe()
+	s.ws = &wsConn{conn: server, br: bufio.NewReader(server)}
+	s.client, s.cr = client, bufio.NewReader(client)
+	s.T().Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+}
+
+// send writes a client frame in the background, as net.Pipe writes block
+// until the other side reads.
+func (s *WebSocketSuite) send(fin bool, op byte, payload []byte, masked bool) {
+	frame := clientFrame(fin, op, payload, masked)
+	go func() { _, _ = s.client.Write(frame) }()
+}
+
+// clientFrame encodes a frame as a client sends it.
+func clientFrame(fin bool, op byte, payload []byte, masked bool) []byte {
+	var frame []byte
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, b0, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = binary.BigEndian.AppendUint16(append(frame, b0, maskBit|126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, b0, maskBit|127), uint64(n))
+	}
+	if !masked {
+		return append(frame, payload...)
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// readServerFrame reads a frame written by the server, which must not mask.
+func (s *WebSocketSuite) readServerFrame() (fin bool, op byte, payload []byte) {
+	var head [2]byte
+	_, err := io.ReadFull(s.cr, head[:])
+	s.Require().NoError(err)
+	s.Require().Zero(head[1]&0x80, "server frames are not masked")
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(s.cr, ext[:])
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(s.cr, ext[:])
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	s.Require().NoError(err)
+	payload = make([]byte, n)
+	_, err = io.ReadFull(s.cr, payload)
+	s.Require().NoError(err)
+	return head[0]&0x80 != 0, head[0] & 0x0F, payload
+}
+
+// closeCode splits the payload of a close frame.
+func closeCode(payload []byte) (int, string) {
+	return int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+}
+
+func (s *WebSocketSuite) TestFrameRoundTrip() {
+	for _, size := range []int{0, 5, 125, 126, 200, 0xFFFF, 70000} {
+		payload := bytes.Repeat([]byte{'x'}, size)
+
+		s.send(true, wsText, payload, true)
+		msg, err := s.ws.readMessage()
+		s.Require().NoError(err, size)
+		s.Equal(string(payload), string(msg), size)
+
+		go func() { _ = s.ws.writeFrame(wsText, payload) }()
+		fin, op, got := s.readServerFrame()
+		s.True(fin)
+		s.Equal(byte(wsText), op)
+		s.Equal(string(payload), string(got), size)
+	}
+}
+
+func (s *WebSocketSuite) TestRejectsUnmaskedClientFrames() {
+	s.send(true, wsText, []byte("hello"), false)
+	_, err := s.ws.readMessage()
+	s.ErrorIs(err, errWSProtocol)
+}
+
+func (s *WebSocketSuite) TestRejectsReservedBits() {
+	frame := clientFrame(true, wsText, []byte("hi"), true)
+	frame[0] |= 0x40
+	go func() { _, _ = s.client.Write(frame) }()
+	_, err := s.ws.readMessage()
+	s.ErrorIs(err, errWSProtocol)
+}
+
+func (s *WebSocketSuite) TestFragmentedMessageWithInterleavedPing() {
+	go func() {
+		_, _ = s.client.Write(clientFrame(false, wsText, []byte("Hel"), true))
+		_, _ = s.client.Write(clientFrame(true, wsPing, []byte("beat"), true))
+		_, _ = s.client.Write(clientFrame(false, wsContinuation, []byte("lo, "), true))
+		_, _ = s.client.Write(clientFrame(true, wsPong, nil, true))
+		_, _ = s.client.Write(clientFrame(true, wsContinuation, []byte("world"), true))
+	}()
+	type result struct {
+		msg []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		msg, err := s.ws.readMessage()
+		done <- result{msg, err}
+	}()
+
+	fin, op, payload := s.readServerFrame()
+	s.True(fin)
+	s.Equal(byte(wsPong), op, "a ping inside a fragmented message is answered")
+	s.Equal([]byte("beat"), payload)
+
+	res := <-done
+	s.Require().NoError(res.err)
+	s.Equal("Hello, world", string(res.msg))
+}
+
+func (s *WebSocketSuite) TestRejectsBadFragmentation() {
+	s.send(true, wsContinuation, []byte("orphan"), true)
+	_, err := s.ws.readMessage()
+	s.ErrorIs(err, errWSProtocol, "continuation without a message")
+
+	go func() {
+		_, _ = s.client.Write(clientFrame(false, wsText, []byte("a"), true))
+		_, _ = s.client.Write(clientFrame(true, wsText, []byte("b"), true))
+	}()
+	_, err = s.ws.readMessage()
+	s.ErrorIs(err, errWSProtocol, "new message inside a fragmented one")
+
+	s.send(false, wsPing, nil, true)
+	_, err = s.ws.readMessage()
+	s.ErrorIs(err, errWSProtocol, "fragmented control frame")
+}
+
+func (s *WebSocketSuite) TestOversizeFrames() {
+	head := []byte{0x80 | wsText, 0x80 | 127}
+	head = binary.BigEndian.AppendUint64(head, wsMaxMessage+1)
+	go func() { _, _ = s.client.Write(head) }()
+	_, err := s.ws.readMessage()
+	s.ErrorIs(err, errMessageTooBig)
+
+	s.SetupTest()
+	s.send(true, wsPing, bytes.Repeat([]byte{'p'}, 126), true)
+	_, err = s.ws.readMessage()
+	s.ErrorIs(err, errWSProtocol, "control frames hold at most 125 bytes")
+
+	s.SetupTest()
+	half := bytes.Repeat([]byte{'m'}, wsMaxMessage/2+1)
+	go func() {
+		_, _ = s.client.Write(clientFrame(false, wsBinary, half, true))
+		_, _ = s.client.Write(clientFrame(true, wsContinuation, half, true))
+	}()
+	_, err = s.ws.readMessage()
+	s.ErrorIs(err, errMessageTooBig, "fragments add up past the limit")
+}
+
+func (s *WebSocketSuite) TestCloseEchoesCode() {
+	s.send(true, wsClose, binary.BigEndian.AppendUint16(nil, 1001), true)
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.ws.readMessage()
+		done <- err
+	}()
+	_, op, payload := s.readServerFrame()
+	s.Equal(byte(wsClose), op)
+	code, _ := closeCode(payload)
+	s.Equal(1001, code)
+	s.ErrorIs(<-done, io.EOF)
+
+	s.ErrorIs(s.ws.writeFrame(wsText, []byte("late")), net.ErrClosed)
+	s.ws.close(wsCloseProtocol, "again")
+}
+
+func (s *WebSocketSuite) TestCloseNeverSendsReservedCodes() {
+	for _, payload := range [][]byte{
+		nil,
+		binary.BigEndian.AppendUint16(nil, wsCloseNoStatus),
+		binary.BigEndian.AppendUint16(nil, wsCloseAbnormal),
+	} {
+		s.SetupTest()
+		s.send(true, wsClose, payload, true)
+		go func() { _, _ = s.ws.readMessage() }()
+		_, op, got := s.readServerFrame()
+		s.Equal(byte(wsClose), op)
+		code, _ := closeCode(got)
+		s.Equal(wsCloseNormal, code, payload)
+	}
+}
+
+func (s *WebSocketSuite) TestCloseTruncatesReasonOnRuneBoundary() {
+	reason := strings.Repeat("é", 100)
+	go s.ws.close(wsCloseProtocol, reason)
+	_, op, payload := s.readServerFrame()
+	s.Equal(byte(wsClose), op)
+	s.LessOrEqual(len(payload), 125)
+	code, got := closeCode(payload)
+	s.Equal(wsCloseProtocol, code)
+	s.True(utf8.ValidString(got))
+	s.Equal(strings.Repeat("é", 61), got)
+}
+
+func (s *WebSocketSuite) TestReadFailsOnceClientLeaves() {
+	_ = s.client.Close()
+	_, err := s.ws.readMessage()
+	s.True(errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe), err)
+}
+
+func TestWebSocketSuite(t *testing.T) { suite.Run(t, new(WebSocketSuite)) }
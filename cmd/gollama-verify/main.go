@@ -0,0 +1,240 @@
+// Command gollama-verify is a preflight check for gollama.cpp installations.
+// It reports the platform, locates or downloads the llama.cpp library, loads
+// it, checks symbol resolution and struct layouts, lists the ggml devices
+// and optionally loads the vocabulary of a model. It exits with status 1 if
+// any check fails; checks that need a loaded library are skipped when
+// loading fails.
+//
+// Usage:
+//
+//	gollama-verify [-version b6862] [-model path/to/model.gguf] [-symbols] [-json]
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+// step is the outcome of one check.
+type step struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// report is the full result, printed as text or JSON.
+type report struct {
+	Platform string                 `json:"platform"`
+	Steps    []step                 `json:"steps"`
+	Library  *gollama.LibraryInfo   `json:"library,omitempty"`
+	Missing  []string               `json:"missing_symbols,omitempty"`
+	Devices  []device               `json:"devices,omitempty"`
+	Symbols  []gollama.SymbolStatus `json:"symbols,omitempty"`
+}
+
+type device struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	FreeMiB     uint64 `json:"free_mib"`
+	TotalMiB    uint64 `json:"total_mib"`
+}
+
+func main() {
+	var (
+		version     = flag.String("version", "", "llama.cpp version to load (default: the bundled build "+gollama.LlamaCppBuild+")")
+		modelPath   = flag.String("model", "", "Optional GGUF model whose vocabulary is loaded and tokenized")
+		listSymbols = flag.Bool("symbols", false, "List every bound symbol, not only the missing ones")
+		jsonOutput  = flag.Bool("json", false, "Print the report as JSON")
+	)
+	flag.Parse()
+
+	r := &report{Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	ok := run(r, *version, *modelPath, *listSymbols)
+	gollama.Cleanup()
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(r)
+	} else {
+		printReport(r)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// run performs the checks in order and reports whether all of them passed.
+func run(r *report, version, modelPath string, listSymbols bool) bool {
+	check := func(name string, fn func() (string, error)) bool {
+		detail, err := fn()
+		s := step{Name: name, OK: err == nil, Detail: detail}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		r.Steps = append(r.Steps, s)
+		return err == nil
+	}
+
+	if !check("platform", func() (string, error) {
+		detail := fmt.Sprintf("%s, detected GPU backend %s", r.Platform, gollama.DetectGpuBackend())
+		for _, p := range gollama.ProbeGpuBackends() {
+			detail += fmt.Sprintf("; %s found via %s", p.Backend, p.Source)
+		}
+		return detail, nil
+	}) {
+		return false
+	}
+
+	if !check("library cache", func() (string, error) {
+		return gollama.GetLibraryCacheDir()
+	}) {
+		return false
+	}
+
+	if !check("load library", func() (string, error) {
+		if err := gollama.LoadLibraryWithVersion(version); err != nil {
+			return "", err
+		}
+		return "", gollama.Backend_init()
+	}) {
+		return false
+	}
+
+	symbolsOK := check("symbols", func() (string, error) {
+		statuses, err := gollama.LookupSymbols()
+		if err != nil {
+			return "", err
+		}
+		if listSymbols {
+			r.Symbols = statuses
+		}
+		for _, st := range statuses {
+			if !st.Found {
+				r.Missing = append(r.Missing, st.Name)
+			}
+		}
+		detail := fmt.Sprintf("%d of %d resolved", len(statuses)-len(r.Missing), len(statuses))
+		if len(r.Missing) > 0 {
+			return detail, fmt.Errorf("missing: %s", strings.Join(r.Missing, ", "))
+		}
+		return detail, nil
+	})
+
+	abiOK := check("struct layouts", func() (string, error) {
+		return "", gollama.VerifyABICompatibility()
+	})
+
+	devicesOK := check("devices", func() (string, error) {
+		if err := gollama.Ggml_backend_load_all(); err != nil {
+			return "", err
+		}
+		count, err := gollama.Ggml_backend_dev_count()
+		if err != nil {
+			return "", err
+		}
+		for i := uint64(0); i < count; i++ {
+			dev, err := gollama.Ggml_backend_dev_get(i)
+			if err != nil || dev == 0 {
+				continue
+			}
+			d := device{}
+			d.Name, _ = gollama.Ggml_backend_dev_name(dev)
+			d.Description, _ = gollama.Ggml_backend_dev_description(dev)
+			if free, total, err := gollama.Ggml_backend_dev_memory(dev); err == nil {
+				d.FreeMiB, d.TotalMiB = free>>20, total>>20
+			}
+			r.Devices = append(r.Devices, d)
+		}
+		if len(r.Devices) == 0 {
+			return "", errors.New("no ggml devices found")
+		}
+		return fmt.Sprintf("%d found", len(r.Devices)), nil
+	})
+
+	// After the devices so that dynamically loaded backends are listed
+	check("library info", func() (string, error) {
+		info, err := gollama.LoadedLibraryInfo()
+		if err != nil {
+			return "", err
+		}
+		r.Library = &info
+		return fmt.Sprintf("%s (b%d, ggml %s)", info.Path, info.Build, info.GgmlVersion), nil
+	})
+
+	if !symbolsOK || !abiOK || !devicesOK {
+		return false
+	}
+	if modelPath == "" {
+		return true
+	}
+
+	return check("model vocabulary", func() (string, error) {
+		params := gollama.Model_default_params()
+		params.VocabOnly = 1
+		model, err := gollama.Model_load_from_file(modelPath, params)
+		if err != nil {
+			return "", err
+		}
+		defer gollama.Model_free(model)
+		tokens, err := gollama.Tokenize(model, "Hello, world!", true, false)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d tokens in vocabulary, \"Hello, world!\" -> %v",
+			gollama.Vocab_n_tokens(model), tokens), nil
+	})
+}
+
+func printReport(r *report) {
+	for _, s := range r.Steps {
+		mark := "ok  "
+		if !s.OK {
+			mark = "FAIL"
+		}
+		line := fmt.Sprintf("[%s] %s", mark, s.Name)
+		if s.Detail != "" {
+			line += ": " + s.Detail
+		}
+		fmt.Println(line)
+		if s.Error != "" {
+			fmt.Printf("       %s\n", s.Error)
+		}
+	}
+
+	if r.Library != nil {
+		fmt.Println()
+		fmt.Printf("Library:     %s\n", r.Library.Path)
+		fmt.Printf("Build:       b%d (struct layout b%d)\n", r.Library.Build, r.Library.LayoutBuild)
+		if r.Library.GgmlVersion != "" {
+			fmt.Printf("ggml:        %s (%s)\n", r.Library.GgmlVersion, r.Library.GgmlCommit)
+		}
+		fmt.Printf("System info: %s\n", r.Library.SystemInfo)
+	}
+	if len(r.Devices) > 0 {
+		fmt.Println()
+		fmt.Println("Devices:")
+		for _, d := range r.Devices {
+			fmt.Printf("  %-12s %s (%d/%d MiB free)\n", d.Name, d.Description, d.FreeMiB, d.TotalMiB)
+		}
+	}
+	if len(r.Symbols) > 0 {
+		fmt.Println()
+		fmt.Println("Symbols:")
+		for _, st := range r.Symbols {
+			mark := "ok"
+			if !st.Found {
+				mark = "missing"
+			}
+			fmt.Printf("  %-45s %s\n", st.Name, mark)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Command gollama-worker runs inference for another process, which talks
+// to it over standard input and output with the protocol of the worker
+// package. A native crash then only kills the worker: the parent sees
+// worker.ErrWorkerExited and can start a new one. Logs go to standard
+// error.
+//
+// Usage:
+//
+//	gollama-worker [-version b6862]
+//
+// It is started by worker.Start rather than by hand.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	gollama "github.com/dianlight/gollama.cpp"
+	"github.com/dianlight/gollama.cpp/worker"
+)
+
+func main() {
+	version := flag.String("version", "", "llama.cpp version to load (default: the bundled build "+gollama.LlamaCppBuild+")")
+	flag.Parse()
+	log.SetOutput(os.Stderr)
+
+	if *version != "" {
+		if err := gollama.LoadLibraryWithVersion(*version); err != nil {
+			log.Fatalf("Failed to load llama.cpp %s: %v", *version, err)
+		}
+	}
+	if err := gollama.Backend_init(); err != nil {
+		log.Fatalf("Failed to initialize backend: %v", err)
+	}
+	defer gollama.Backend_free()
+	if err := gollama.Ggml_backend_load_all(); err != nil {
+		log.Printf("Warning: failed to load ggml backends: %v", err)
+	}
+
+	h := &worker.ModelHandler{}
+	defer h.Close()
+	if err := worker.Serve(os.Stdin, os.Stdout, h); err != nil {
+		log.Printf("Error: %v", err)
+		h.Close()
+		os.Exit(1)
+	}
+}
@@ -3,6 +3,7 @@ package gollama
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -17,15 +18,43 @@ type Config struct {
 	CacheDir      string `json:"cache_dir,omitempty"`
 	UseEmbedded   bool   `json:"use_embedded"`
 	EnableLogging bool   `json:"enable_logging"`
-	LogLevel      int    `json:"log_level"`
+	LogLevel      int    `json:"log_level"` // 0=debug, 1=info, 2=warn, 3=error
+
+	// UseSystemCache stores libraries in the machine-wide cache (%ProgramData%
+	// on Windows) instead of the per-user cache. Useful for Windows services and
+	// scheduled tasks; ignored on other platforms.
+	UseSystemCache bool `json:"use_system_cache"`
+
+	// RequireChecksum refuses to install downloaded libraries whose release
+	// publishes no SHA256 to verify them against. Mismatching archives are
+	// always rejected.
+	RequireChecksum bool `json:"require_checksum"`
+
+	// DownloadMirror downloads release assets from a mirror instead of
+	// GitHub: a URL template with {tag} and {asset} placeholders, or a base
+	// URL followed by /<tag>/<asset>. Release metadata still comes from
+	// api.github.com when it is reachable.
+	DownloadMirror string `json:"download_mirror,omitempty"`
+	// DownloadProxy is the proxy URL for downloads, overriding HTTPS_PROXY
+	// and HTTP_PROXY.
+	DownloadProxy string `json:"download_proxy,omitempty"`
+	// Offline disables all network access: libraries only come from the
+	// embedded set, ./libs and the cache.
+	Offline bool `json:"offline"`
 
 	// Performance settings
-	NumThreads    int  `json:"num_threads"`
-	EnableGPU     bool `json:"enable_gpu"`
-	GPULayers     int  `json:"gpu_layers"`
-	MetalEnabled  bool `json:"metal_enabled"`
-	CUDAEnabled   bool `json:"cuda_enabled"`
-	VulkanEnabled bool `json:"vulkan_enabled"`
+	NumThreads int `json:"num_threads"`
+	// NumThreadsBatch is the thread count for prompt processing; 0 uses
+	// NumThreads
+	NumThreadsBatch int  `json:"num_threads_batch"`
+	EnableGPU       bool `json:"enable_gpu"`
+	// GPULayerPolicy decides how many layers Model_default_params offloads;
+	// GPULayers is only used by GPULayersFixed
+	GPULayerPolicy GPULayerPolicy `json:"gpu_layer_policy,omitempty"`
+	GPULayers      int            `json:"gpu_layers"`
+	MetalEnabled   bool           `json:"metal_enabled"`
+	CUDAEnabled    bool           `json:"cuda_enabled"`
+	VulkanEnabled  bool           `json:"vulkan_enabled"`
 
 	// Memory settings
 	ContextSize       int  `json:"context_size"`
@@ -43,12 +72,41 @@ type Config struct {
 	// Backend settings
 	BackendType string `json:"backend_type,omitempty"`
 	DeviceID    int    `json:"device_id"`
+	// PreferredBackend overrides GPU backend detection with a comma-separated
+	// fallback chain such as "vulkan,cpu". It selects the library variant to
+	// download and the devices Model_default_params offloads to; empty or
+	// "auto" keeps the detection of DetectGpuBackend
+	PreferredBackend string `json:"preferred_backend,omitempty"`
+
+	// Sampling holds the defaults returned by DefaultSamplingParams
+	Sampling SamplingParams `json:"sampling"`
 
 	// Debug settings
 	VerboseLogging bool `json:"verbose_logging"`
 	DebugMode      bool `json:"debug_mode"`
+	// TrackAllocations enables allocation tracking, reporting the objects
+	// still alive on Backend_free (see EnableAllocationTracking)
+	TrackAllocations bool `json:"track_allocations"`
 }
 
+// GPULayerPolicy selects the number of layers offloaded to the GPU.
+type GPULayerPolicy string
+
+const (
+	// GPULayersAuto keeps the library default, which offloads every layer
+	// when a GPU backend is available
+	GPULayersAuto GPULayerPolicy = "auto"
+	// GPULayersAll offloads every layer
+	GPULayersAll GPULayerPolicy = "all"
+	// GPULayersNone keeps the whole model on the CPU
+	GPULayersNone GPULayerPolicy = "none"
+	// GPULayersFixed offloads Config.GPULayers layers (all when negative)
+	GPULayersFixed GPULayerPolicy = "fixed"
+)
+
+// allGPULayers is the n_gpu_layers value llama.cpp uses for "every layer".
+const allGPULayers = 999
+
 // DefaultConfig returns a configuration with sensible defaults
 func DefaultConfig() *Config {
 	numCPU := runtime.NumCPU()
@@ -60,12 +118,13 @@ func DefaultConfig() *Config {
 		LogLevel:      1, // LLAMA_LOG_LEVEL_INFO
 
 		// Performance settings
-		NumThreads:    numCPU,
-		EnableGPU:     detectGPU(),
-		GPULayers:     -1, // Use all layers on GPU if available
-		MetalEnabled:  runtime.GOOS == "darwin",
-		CUDAEnabled:   runtime.GOOS == "linux" || runtime.GOOS == "windows",
-		VulkanEnabled: false,
+		NumThreads:     numCPU,
+		EnableGPU:      detectGPU(),
+		GPULayerPolicy: GPULayersAuto,
+		GPULayers:      -1, // Use all layers on GPU if available
+		MetalEnabled:   runtime.GOOS == "darwin",
+		CUDAEnabled:    runtime.GOOS == "linux" || runtime.GOOS == "windows",
+		VulkanEnabled:  false,
 
 		// Memory settings
 		ContextSize:       2048,
@@ -82,6 +141,15 @@ func DefaultConfig() *Config {
 		BackendType: "auto",
 		DeviceID:    0,
 
+		// Sampling settings
+		Sampling: SamplingParams{
+			Temperature: 0.8,
+			TopK:        40,
+			TopP:        0.95,
+			MinP:        0.05,
+			Seed:        LLAMA_DEFAULT_SEED,
+		},
+
 		// Debug settings
 		VerboseLogging: false,
 		DebugMode:      false,
@@ -120,6 +188,21 @@ func LoadConfigFromEnv() *Config {
 	if cacheDir := os.Getenv("GOLLAMA_CACHE_DIR"); cacheDir != "" {
 		config.CacheDir = cacheDir
 	}
+	if systemCache := os.Getenv("GOLLAMA_USE_SYSTEM_CACHE"); systemCache != "" {
+		config.UseSystemCache = parseEnvBool(systemCache, config.UseSystemCache)
+	}
+	if require := os.Getenv("GOLLAMA_REQUIRE_CHECKSUM"); require != "" {
+		config.RequireChecksum = parseEnvBool(require, config.RequireChecksum)
+	}
+	if mirror := os.Getenv("GOLLAMA_DOWNLOAD_MIRROR"); mirror != "" {
+		config.DownloadMirror = mirror
+	}
+	if proxy := os.Getenv("GOLLAMA_DOWNLOAD_PROXY"); proxy != "" {
+		config.DownloadProxy = proxy
+	}
+	if offline := os.Getenv("GOLLAMA_OFFLINE"); offline != "" {
+		config.Offline = parseEnvBool(offline, config.Offline)
+	}
 	if embedded := os.Getenv("GOLLAMA_USE_EMBEDDED"); embedded != "" {
 		config.UseEmbedded = parseEnvBool(embedded, config.UseEmbedded)
 	}
@@ -138,14 +221,23 @@ func LoadConfigFromEnv() *Config {
 			config.NumThreads = val
 		}
 	}
+	if threads := os.Getenv("GOLLAMA_NUM_THREADS_BATCH"); threads != "" {
+		if val, err := strconv.Atoi(threads); err == nil && val > 0 {
+			config.NumThreadsBatch = val
+		}
+	}
 	if gpu := os.Getenv("GOLLAMA_ENABLE_GPU"); gpu != "" {
 		config.EnableGPU = parseEnvBool(gpu, config.EnableGPU)
 	}
 	if layers := os.Getenv("GOLLAMA_GPU_LAYERS"); layers != "" {
 		if val, err := strconv.Atoi(layers); err == nil {
 			config.GPULayers = val
+			config.GPULayerPolicy = GPULayersFixed
 		}
 	}
+	if policy := os.Getenv("GOLLAMA_GPU_LAYER_POLICY"); policy != "" {
+		config.GPULayerPolicy = GPULayerPolicy(strings.ToLower(policy))
+	}
 	if metal := os.Getenv("GOLLAMA_METAL_ENABLED"); metal != "" {
 		config.MetalEnabled = parseEnvBool(metal, config.MetalEnabled)
 	}
@@ -197,6 +289,9 @@ func LoadConfigFromEnv() *Config {
 	if backend := os.Getenv("GOLLAMA_BACKEND_TYPE"); backend != "" {
 		config.BackendType = backend
 	}
+	if preferred := os.Getenv("GOLLAMA_BACKEND"); preferred != "" {
+		config.PreferredBackend = preferred
+	}
 	if device := os.Getenv("GOLLAMA_DEVICE_ID"); device != "" {
 		if val, err := strconv.Atoi(device); err == nil && val >= 0 {
 			config.DeviceID = val
@@ -210,6 +305,9 @@ func LoadConfigFromEnv() *Config {
 	if debug := os.Getenv("GOLLAMA_DEBUG_MODE"); debug != "" {
 		config.DebugMode = parseEnvBool(debug, config.DebugMode)
 	}
+	if track := os.Getenv("GOLLAMA_TRACK_ALLOCATIONS"); track != "" {
+		config.TrackAllocations = parseEnvBool(track, config.TrackAllocations)
+	}
 
 	return config
 }
@@ -252,10 +350,24 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("ubatch_size must be positive, got %d", c.UbatchSize)
 	}
 
+	if c.NumThreadsBatch < 0 {
+		return fmt.Errorf("num_threads_batch must be non-negative, got %d", c.NumThreadsBatch)
+	}
+
 	if c.DeviceID < 0 {
 		return fmt.Errorf("device_id must be non-negative, got %d", c.DeviceID)
 	}
 
+	switch c.GPULayerPolicy {
+	case "", GPULayersAuto, GPULayersAll, GPULayersNone, GPULayersFixed:
+	default:
+		return fmt.Errorf("invalid gpu_layer_policy: %s, must be one of: auto, all, none, fixed", c.GPULayerPolicy)
+	}
+
+	if err := c.Sampling.Validate(); err != nil {
+		return err
+	}
+
 	// Validate library path if specified
 	if c.LibraryPath != "" {
 		if _, err := os.Stat(c.LibraryPath); os.IsNotExist(err) {
@@ -294,6 +406,21 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.DownloadMirror != "" {
+		if u, err := url.Parse(mirrorURL(c.DownloadMirror, "b0", "asset.zip")); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid download_mirror: %s", c.DownloadMirror)
+		}
+	}
+	if c.DownloadProxy != "" {
+		if u, err := url.Parse(c.DownloadProxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid download_proxy: %s", c.DownloadProxy)
+		}
+	}
+
+	if _, err := parseBackendChain(c.PreferredBackend); err != nil {
+		return fmt.Errorf("invalid preferred_backend: %w", err)
+	}
+
 	// Validate quantization type if specified
 	if c.QuantizationType != "" {
 		validQuantTypes := []string{"q4_0", "q4_1", "q5_0", "q5_1", "q8_0", "q2_k", "q3_k", "q4_k", "q5_k", "q6_k", "q8_k"}
@@ -367,9 +494,27 @@ func mergeConfigs(target, source *Config) {
 	if target.BackendType == "auto" && source.BackendType != "" && source.BackendType != "auto" {
 		target.BackendType = source.BackendType
 	}
+	if target.PreferredBackend == "" && source.PreferredBackend != "" {
+		target.PreferredBackend = source.PreferredBackend
+	}
 	if target.QuantizationType == "" && source.QuantizationType != "" {
 		target.QuantizationType = source.QuantizationType
 	}
+	if !target.UseSystemCache && source.UseSystemCache {
+		target.UseSystemCache = true
+	}
+	if !target.RequireChecksum && source.RequireChecksum {
+		target.RequireChecksum = true
+	}
+	if target.DownloadMirror == "" && source.DownloadMirror != "" {
+		target.DownloadMirror = source.DownloadMirror
+	}
+	if target.DownloadProxy == "" && source.DownloadProxy != "" {
+		target.DownloadProxy = source.DownloadProxy
+	}
+	if !target.Offline && source.Offline {
+		target.Offline = true
+	}
 }
 
 // detectGPU attempts to detect if GPU acceleration is available
@@ -441,23 +586,47 @@ func ApplyConfig(config *Config) error {
 
 	// Set library path if specified
 	if config.LibraryPath != "" {
-		globalLoader.mutex.Lock()
 		// Force reload with new path
-		if globalLoader.loaded {
-			_ = globalLoader.UnloadLibrary() // Ignore error during configuration
+		if err := globalLoader.UnloadLibrary(); err != nil {
+			return fmt.Errorf("cannot apply library path: %w", err)
 		}
-		globalLoader.mutex.Unlock()
 	}
 
-	// Apply logging configuration
-	// TODO: Implement logging configuration once we have the actual logging functions - moved to ROADMAP "wait for llama.cpp" section
-	// if config.EnableLogging {
-	//     llamaLogSet(logCallback, nil)
-	// }
+	// Network settings apply to a downloader that already exists
+	if globalLoader.downloader != nil {
+		if err := globalLoader.downloader.configureNetwork(config); err != nil {
+			return err
+		}
+	}
+
+	// Apply logging configuration: route native logs through log/slog, or
+	// drop them entirely when logging is disabled
+	if config.EnableLogging {
+		SetLogCallback(SlogBridge(SlogBridgeOptions{Level: configLogLevel(config.LogLevel)}))
+	} else {
+		SetLogCallback(func(LogLevel, string) {})
+	}
+
+	if config.TrackAllocations && !AllocationTrackingEnabled() {
+		EnableAllocationTracking(nil)
+	}
 
 	return nil
 }
 
+// configLogLevel converts Config.LogLevel (0=debug, 1=info, 2=warn, 3=error)
+// to the native log level.
+func configLogLevel(level int) LogLevel {
+	switch {
+	case level <= 0:
+		return GGML_LOG_LEVEL_DEBUG
+	case level >= 3:
+		return GGML_LOG_LEVEL_ERROR
+	default:
+		return LogLevel(level + 1)
+	}
+}
+
 // Global configuration instance
 var globalConfig = LoadDefaultConfig()
 
@@ -474,3 +643,156 @@ func SetGlobalConfig(config *Config) error {
 func GetGlobalConfig() *Config {
 	return globalConfig
 }
+
+// Option modifies a Config. Options are applied in order by NewConfig,
+// Config.With and Configure.
+type Option func(*Config)
+
+// WithThreads sets the number of threads used for generation and, unless
+// WithBatchThreads is also given, prompt processing.
+func WithThreads(n int) Option {
+	return func(c *Config) { c.NumThreads = n }
+}
+
+// WithBatchThreads sets the number of threads used for prompt processing.
+func WithBatchThreads(n int) Option {
+	return func(c *Config) { c.NumThreadsBatch = n }
+}
+
+// WithGPULayers offloads n layers to the GPU; a negative n offloads all of
+// them.
+func WithGPULayers(n int) Option {
+	return func(c *Config) {
+		c.GPULayerPolicy = GPULayersFixed
+		c.GPULayers = n
+	}
+}
+
+// WithGPULayerPolicy sets the GPU offload policy.
+func WithGPULayerPolicy(policy GPULayerPolicy) Option {
+	return func(c *Config) { c.GPULayerPolicy = policy }
+}
+
+// WithMainGPU selects the device used for the whole model, or for small
+// tensors and intermediate results when the model is split.
+func WithMainGPU(device int) Option {
+	return func(c *Config) { c.DeviceID = device }
+}
+
+// WithContextSize sets the default context size in tokens.
+func WithContextSize(n int) Option {
+	return func(c *Config) { c.ContextSize = n }
+}
+
+// WithBatchSize sets the logical and, when ubatch is positive, the physical
+// batch size.
+func WithBatchSize(batch, ubatch int) Option {
+	return func(c *Config) {
+		c.BatchSize = batch
+		if ubatch > 0 {
+			c.UbatchSize = ubatch
+		}
+	}
+}
+
+// WithMmap enables or disables memory-mapping model files.
+func WithMmap(enabled bool) Option {
+	return func(c *Config) { c.MemoryMapEnabled = enabled }
+}
+
+// WithMlock enables or disables locking model memory in RAM.
+func WithMlock(enabled bool) Option {
+	return func(c *Config) { c.MemoryLockEnabled = enabled }
+}
+
+// WithSampling sets the default sampling parameters.
+func WithSampling(p SamplingParams) Option {
+	return func(c *Config) { c.Sampling = p }
+}
+
+// WithCacheDir sets the directory downloaded libraries are cached in.
+func WithCacheDir(dir string) Option {
+	return func(c *Config) { c.CacheDir = dir }
+}
+
+// WithPreferredBackend sets the backend fallback chain, e.g. "cuda,cpu".
+func WithPreferredBackend(chain string) Option {
+	return func(c *Config) { c.PreferredBackend = chain }
+}
+
+// NewConfig returns DefaultConfig with opts applied.
+func NewConfig(opts ...Option) *Config {
+	return DefaultConfig().With(opts...)
+}
+
+// With returns a copy of c with opts applied.
+func (c *Config) With(opts ...Option) *Config {
+	clone := *c
+	for _, opt := range opts {
+		opt(&clone)
+	}
+	return &clone
+}
+
+// Configure applies opts on top of the global configuration and installs
+// the result with SetGlobalConfig:
+//
+//	gollama.Configure(gollama.WithThreads(8), gollama.WithGPULayers(-1))
+func Configure(opts ...Option) error {
+	base := globalConfig
+	if base == nil {
+		base = DefaultConfig()
+	}
+	return SetGlobalConfig(base.With(opts...))
+}
+
+// applyModelParams overrides library model defaults with c.
+func (c *Config) applyModelParams(p LlamaModelParams) LlamaModelParams {
+	switch c.GPULayerPolicy {
+	case GPULayersAll:
+		p.NGpuLayers = allGPULayers
+	case GPULayersNone:
+		p.NGpuLayers = 0
+	case GPULayersFixed:
+		if c.GPULayers < 0 {
+			p.NGpuLayers = allGPULayers
+		} else {
+			p.NGpuLayers = int32(c.GPULayers)
+		}
+	}
+	p.MainGpu = int32(c.DeviceID)
+	p.UseMmap = boolToUint8(c.MemoryMapEnabled)
+	p.UseMlock = boolToUint8(c.MemoryLockEnabled)
+	p.VocabOnly = boolToUint8(c.VocabOnly)
+	return p
+}
+
+// applyContextParams overrides library context defaults with c. Zero
+// values keep the library default.
+func (c *Config) applyContextParams(p LlamaContextParams) LlamaContextParams {
+	if c.ContextSize > 0 {
+		p.NCtx = uint32(c.ContextSize)
+	}
+	if c.BatchSize > 0 {
+		p.NBatch = uint32(c.BatchSize)
+	}
+	if c.UbatchSize > 0 {
+		p.NUbatch = uint32(c.UbatchSize)
+	}
+	p.NUbatch = min(p.NUbatch, p.NBatch)
+	if c.NumThreads > 0 {
+		p.NThreads = int32(c.NumThreads)
+		p.NThreadsBatch = int32(c.NumThreads)
+	}
+	if c.NumThreadsBatch > 0 {
+		p.NThreadsBatch = int32(c.NumThreadsBatch)
+	}
+	return p
+}
+
+func boolToUint8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
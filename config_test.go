@@ -0,0 +1,95 @@
+package gollama
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigSuite struct{ BaseSuite }
+
+func (s *ConfigSuite) TestOptions() {
+	base := DefaultConfig()
+	cfg := base.With(WithThreads(8), WithGPULayers(12), WithContextSize(4096), WithBatchSize(1024, 256))
+	s.Equal(8, cfg.NumThreads)
+	s.Equal(GPULayersFixed, cfg.GPULayerPolicy)
+	s.Equal(12, cfg.GPULayers)
+	s.Equal(4096, cfg.ContextSize)
+	s.Equal(1024, cfg.BatchSize)
+	s.Equal(256, cfg.UbatchSize)
+	s.Equal(runtime.NumCPU(), base.NumThreads, "With must not modify the receiver")
+	s.NoError(cfg.Validate())
+
+	s.Equal(3, NewConfig(WithThreads(3)).NumThreads)
+}
+
+func (s *ConfigSuite) TestGPULayerPolicy() {
+	lib := LlamaModelParams{NGpuLayers: 999, UseMmap: 1}
+	cases := []struct {
+		cfg  *Config
+		want int32
+	}{
+		{NewConfig(), 999},
+		{NewConfig(WithGPULayerPolicy(GPULayersNone)), 0},
+		{NewConfig(WithGPULayerPolicy(GPULayersAll)), allGPULayers},
+		{NewConfig(WithGPULayers(7)), 7},
+		{NewConfig(WithGPULayers(-1)), allGPULayers},
+	}
+	for _, c := range cases {
+		s.Equal(c.want, c.cfg.applyModelParams(lib).NGpuLayers, c.cfg.GPULayerPolicy)
+	}
+
+	p := NewConfig(WithMmap(false), WithMlock(true), WithMainGPU(1)).applyModelParams(lib)
+	s.Equal(uint8(0), p.UseMmap)
+	s.Equal(uint8(1), p.UseMlock)
+	s.Equal(int32(1), p.MainGpu)
+
+	s.Error(NewConfig(WithGPULayerPolicy("most")).Validate())
+}
+
+func (s *ConfigSuite) TestContextParams() {
+	lib := LlamaContextParams{NCtx: 512, NBatch: 2048, NUbatch: 512, NThreads: 4, NThreadsBatch: 4}
+	p := NewConfig(WithContextSize(8192), WithBatchSize(256, 0), WithThreads(6)).applyContextParams(lib)
+	s.Equal(uint32(8192), p.NCtx)
+	s.Equal(uint32(256), p.NBatch)
+	s.Equal(uint32(256), p.NUbatch, "ubatch is capped at batch")
+	s.Equal(int32(6), p.NThreads)
+	s.Equal(int32(6), p.NThreadsBatch)
+
+	p = NewConfig(WithThreads(6), WithBatchThreads(12)).applyContextParams(lib)
+	s.Equal(int32(12), p.NThreadsBatch)
+}
+
+func (s *ConfigSuite) TestConfigureWiresDefaults() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	s.Require().NoError(Configure(WithThreads(3), WithContextSize(1024), WithGPULayerPolicy(GPULayersNone)))
+	s.Equal(int32(3), Context_default_params().NThreads)
+	s.Equal(uint32(1024), Context_default_params().NCtx)
+	s.Equal(int32(0), Model_default_params().NGpuLayers)
+
+	s.Error(Configure(WithThreads(0)))
+	s.Equal(int32(3), Context_default_params().NThreads, "an invalid configuration is not installed")
+}
+
+func (s *ConfigSuite) TestSamplingDefaults() {
+	s.Equal(float32(0.8), DefaultSamplingParams().Temperature)
+	s.Require().NoError(Configure(WithSampling(SamplingParams{Temperature: 0.2, TopK: 10})))
+	s.Equal(SamplingParams{Temperature: 0.2, TopK: 10}, DefaultSamplingParams())
+
+	s.ErrorIs(NewConfig(WithSampling(SamplingParams{MinP: 2})).Validate(), ErrInvalidSamplingParams)
+}
+
+func (s *ConfigSuite) TestEnvGPULayers() {
+	s.T().Setenv("GOLLAMA_GPU_LAYERS", "20")
+	cfg := LoadConfigFromEnv()
+	s.Equal(GPULayersFixed, cfg.GPULayerPolicy)
+	s.Equal(20, cfg.GPULayers)
+
+	s.T().Setenv("GOLLAMA_GPU_LAYER_POLICY", "None")
+	s.Equal(GPULayersNone, LoadConfigFromEnv().GPULayerPolicy)
+}
+
+func TestConfigSuite(t *testing.T) { suite.Run(t, new(ConfigSuite)) }
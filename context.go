@@ -0,0 +1,316 @@
+package gollama
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Context wraps a LlamaContext together with the Model it was created from
+// and the sizes fixed at creation time.
+//
+// Example usage:
+//
+//	ctx, err := gollama.NewContext(model, gollama.Context_default_params())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer ctx.Close()
+type Context struct {
+	handle LlamaContext
+	model  *Model
+
+	// NCtx is the context size in tokens.
+	NCtx int32
+	// NBatch is the maximum number of tokens submitted in one Decode call.
+	NBatch int32
+	// NSeqMax is the maximum number of sequences.
+	NSeqMax int32
+
+	mode ContextMode
+	// initMode and the thread counts at creation are restored by Reset
+	initMode                      ContextMode
+	initThreads, initThreadsBatch int32
+
+	// autoShift enables context shifts in DecodeTokens; shiftKeep tokens
+	// at the start of a sequence are never discarded
+	autoShift bool
+	shiftKeep int
+	onShift   func(ContextShiftEvent)
+
+	// timeout is the watchdog limit of each decode, 0 when disabled
+	timeout time.Duration
+
+	// system holds the tokens of the system prompt in SystemPromptSeq
+	system []LlamaToken
+
+	// freeMu serializes Free, which CloseOnDone may call from another
+	// goroutine
+	freeMu sync.Mutex
+
+	// kvGauge is the share of the context in the KV cache metrics
+	kvGauge kvGauge
+}
+
+// ContextShiftEvent describes a context shift.
+type ContextShiftEvent struct {
+	SeqID LlamaSeqId
+	// NPast is the number of positions used before the shift.
+	NPast LlamaPos
+	// Keep is the number of leading tokens that were kept.
+	Keep int
+	// Discarded is the number of tokens removed after the kept ones.
+	Discarded int
+}
+
+// NewContext creates a context for model.
+func NewContext(model *Model, params LlamaContextParams) (*Context, error) {
+	if model == nil || model.Handle() == 0 {
+		return nil, ErrModelNotLoaded
+	}
+	if err := checkKVCache(params); err != nil {
+		return nil, err
+	}
+	handle, err := Init_from_model(model.Handle(), params)
+	if err != nil {
+		return nil, err
+	}
+	c := &Context{
+		handle:  handle,
+		model:   model,
+		NCtx:    int32(llamaNCtx(handle)),
+		NBatch:  int32(llamaNBatch(handle)),
+		NSeqMax: int32(llamaNSeqMax(handle)),
+	}
+	if params.Embeddings != 0 {
+		c.mode = ModeEmbed
+	}
+	c.initMode = c.mode
+	c.initThreads, c.initThreadsBatch = c.Threads()
+	model.track(c)
+	return c, nil
+}
+
+// Handle returns the underlying LlamaContext.
+func (c *Context) Handle() LlamaContext {
+	return c.handle
+}
+
+// Model returns the model the context was created from.
+func (c *Context) Model() *Model {
+	return c.model
+}
+
+// Decode runs batch through the model, within the timeout set with
+// SetTimeout.
+func (c *Context) Decode(batch LlamaBatch) error {
+	if c.handle == 0 {
+		return ErrContextNotCreated
+	}
+	if err := Decode_with_timeout(c.handle, batch, c.timeout); err != nil {
+		return err
+	}
+	c.reportKV()
+	return nil
+}
+
+// SetTimeout sets a watchdog on every decode of Decode, DecodeTokens and
+// Generate: a decode still running after timeout is aborted and fails
+// with ErrDecodeTimeout, leaving the context usable (see
+// Decode_with_timeout). 0 disables it.
+func (c *Context) SetTimeout(timeout time.Duration) {
+	c.timeout = max(timeout, 0)
+}
+
+// DecodeTokens decodes tokens into sequence seqID starting at position pos,
+// splitting them into batches of at most NBatch tokens. Logits are computed
+// for the last token only. A batch the memory has no room for is retried
+// in halves before failing with a NoKvSlotError.
+//
+// With EnableAutoShift, a batch that would go past NCtx first shifts the
+// sequence, so the positions of the tokens end up lower than requested;
+// the next position to use is SeqPosMax(seqID)+1.
+func (c *Context) DecodeTokens(tokens []LlamaToken, pos LlamaPos, seqID LlamaSeqId) error {
+	if c.handle == 0 {
+		return ErrContextNotCreated
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	fit := func(pos LlamaPos, n int) (LlamaPos, error) {
+		var err error
+		for c.autoShift && int(pos)+n > int(c.NCtx) {
+			if pos, err = c.Shift(seqID, pos); err != nil {
+				return pos, err
+			}
+		}
+		return pos, nil
+	}
+	err := decodeChunks(tokens, pos, seqID, int(c.NBatch), fit, func(batch LlamaBatch) error {
+		return Decode_with_timeout(c.handle, batch, c.timeout)
+	})
+	if err != nil {
+		return err
+	}
+	c.reportKV()
+	return nil
+}
+
+// EnableAutoShift makes DecodeTokens shift a sequence when it would
+// outgrow the context, StreamingLLM-style: the first keep tokens (BOS and
+// system prompt) stay, and half of the tokens after them are discarded,
+// so generation can continue indefinitely at the cost of forgetting the
+// oldest part of the conversation. The memory must support shifts (see
+// Memory_can_shift).
+func (c *Context) EnableAutoShift(keep int) {
+	c.autoShift = true
+	c.shiftKeep = max(keep, 0)
+}
+
+// DisableAutoShift turns automatic context shifts off again.
+func (c *Context) DisableAutoShift() {
+	c.autoShift = false
+}
+
+// SetShiftCallback sets a function called after every context shift; nil
+// removes it.
+func (c *Context) SetShiftCallback(fn func(ContextShiftEvent)) {
+	c.onShift = fn
+}
+
+// Shift discards half of the tokens of sequence seqID after the ones kept
+// by EnableAutoShift, with Memory_seq_rm, and moves the remaining tokens
+// back with Memory_seq_add. nPast is the number of positions in use; the
+// new number is returned. It fails with ErrContextFull when the memory
+// cannot shift or nothing can be discarded.
+func (c *Context) Shift(seqID LlamaSeqId, nPast LlamaPos) (LlamaPos, error) {
+	if c.handle == 0 {
+		return nPast, ErrContextNotCreated
+	}
+	keep := min(c.shiftKeep, int(nPast))
+	discard := (int(nPast) - keep) / 2
+	if discard == 0 {
+		return nPast, fmt.Errorf("%w: nothing to discard after %d kept tokens", ErrContextFull, keep)
+	}
+	if !Memory_can_shift(c.handle) {
+		return nPast, fmt.Errorf("%w: the context memory cannot shift", ErrContextFull)
+	}
+	if !c.SeqRm(seqID, LlamaPos(keep), LlamaPos(keep+discard)) {
+		return nPast, fmt.Errorf("%w: failed to remove tokens %d-%d", ErrContextFull, keep, keep+discard)
+	}
+	Memory_seq_add(c.handle, seqID, LlamaPos(keep+discard), nPast, -LlamaPos(discard))
+
+	countMetric(&metrics.contextShifts, 1)
+	if c.onShift != nil {
+		c.onShift(ContextShiftEvent{SeqID: seqID, NPast: nPast, Keep: keep, Discarded: discard})
+	}
+	return nPast - LlamaPos(discard), nil
+}
+
+// Logits returns the logits of the i-th output of the last decode (negative
+// values count from the end). The slice aliases context memory and is only
+// valid until the next decode.
+func (c *Context) Logits(i int32) []float32 {
+	if c.handle == 0 {
+		return nil
+	}
+	return Get_logits_ith_slice(c.handle, i)
+}
+
+// ClearMemory clears the KV cache, system prompt included. When data is
+// true the buffers are cleared as well.
+func (c *Context) ClearMemory(data bool) {
+	if c.handle != 0 {
+		Memory_clear(c.handle, data)
+	}
+	c.system = nil
+}
+
+// Reset returns the context to its state after NewContext without
+// reallocating it, which is much cheaper than Free and NewContext between
+// independent requests: it waits for pending computations, clears the
+// memory with its buffers, so every sequence starts again at position 0,
+// restores the mode and thread counts the context was created with and
+// clears its performance counters. samplers, e.g. the chain used with the
+// context, are reset too. The logits of the last decode are stale
+// afterwards and must not be read before the next decode.
+//
+// Example usage:
+//
+//	for req := range requests {
+//		if err := ctx.Reset(chain); err != nil {
+//			return err
+//		}
+//		// handle req as with a new context
+//	}
+func (c *Context) Reset(samplers ...LlamaSampler) error {
+	if c.handle == 0 {
+		return ErrContextNotCreated
+	}
+	Synchronize(c.handle)
+	if c.mode != c.initMode {
+		// SetMode clears the memory as well
+		if err := c.SetMode(c.initMode); err != nil {
+			return err
+		}
+	} else {
+		c.ClearMemory(true)
+	}
+	if gen, batch := c.Threads(); c.initThreads > 0 && (gen != c.initThreads || batch != c.initThreadsBatch) {
+		Set_n_threads(c.handle, c.initThreads, c.initThreadsBatch)
+	}
+	Perf_context_reset(c.handle)
+	for _, smpl := range samplers {
+		Sampler_reset(smpl)
+	}
+	return nil
+}
+
+// SeqRm removes positions [p0, p1) of sequence seqID from the KV cache; see
+// Memory_seq_rm.
+func (c *Context) SeqRm(seqID LlamaSeqId, p0, p1 LlamaPos) bool {
+	return Memory_seq_rm(c.handle, seqID, p0, p1)
+}
+
+// SeqPosMax returns the largest position stored for seqID, or -1.
+func (c *Context) SeqPosMax(seqID LlamaSeqId) LlamaPos {
+	return Memory_seq_pos_max(c.handle, seqID)
+}
+
+// SetThreads changes the number of threads used for generation (gen) and
+// for prompt processing (batch), e.g. to adapt to load or NUMA placement.
+// It takes effect from the next decode.
+func (c *Context) SetThreads(gen, batch int32) error {
+	if c.handle == 0 {
+		return ErrContextNotCreated
+	}
+	if gen <= 0 || batch <= 0 {
+		return fmt.Errorf("%w: threads = %d, batch threads = %d", ErrInvalidParameter, gen, batch)
+	}
+	Set_n_threads(c.handle, gen, batch)
+	return nil
+}
+
+// Threads returns the number of threads used for generation and for prompt
+// processing.
+func (c *Context) Threads() (gen, batch int32) {
+	if c.handle == 0 {
+		return 0, 0
+	}
+	return N_threads(c.handle), N_threads_batch(c.handle)
+}
+
+// Free releases the context. It is safe to call more than once; Model.Free
+// calls it for the contexts still open.
+func (c *Context) Free() {
+	c.freeMu.Lock()
+	defer c.freeMu.Unlock()
+	if c.handle != 0 {
+		Free(c.handle)
+		c.handle = 0
+		c.kvGauge.set(0, 0)
+		if c.model != nil {
+			c.model.untrack(c)
+		}
+	}
+}
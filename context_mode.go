@@ -0,0 +1,102 @@
+package gollama
+
+import "fmt"
+
+// ContextMode selects what a Context computes.
+type ContextMode int
+
+const (
+	// ModeGenerate computes logits with causal attention, for generation.
+	ModeGenerate ContextMode = iota
+	// ModeEmbed computes embeddings (see EmbeddingSession).
+	ModeEmbed
+)
+
+// String returns the name of the mode.
+func (m ContextMode) String() string {
+	switch m {
+	case ModeGenerate:
+		return "generate"
+	case ModeEmbed:
+		return "embed"
+	default:
+		return fmt.Sprintf("ContextMode(%d)", int(m))
+	}
+}
+
+// Mode returns the mode of the context: ModeEmbed when it was created with
+// Embeddings set, or the mode last set by SetMode.
+func (c *Context) Mode() ContextMode {
+	return c.mode
+}
+
+// SetMode switches the context between generation and embeddings, as
+// GritLM-style models used for both need. Switching clears the memory,
+// since cached keys and values computed under the other mode's attention
+// cannot be reused, and sets the attention to what the mode needs:
+//
+//   - ModeGenerate turns embeddings off and attention causal. The model
+//     must have a decoder.
+//   - ModeEmbed turns embeddings on. With mean or CLS pooling attention
+//     becomes bidirectional, as those embedding models are trained; with
+//     last-token or no pooling it becomes causal, as for LLM-based
+//     embedders; with rank pooling it is left as is. Encoder-decoder
+//     models are rejected: use Encoder instead.
+//
+// Setting the current mode does nothing.
+//
+// Example usage:
+//
+//	if err := ctx.SetMode(gollama.ModeEmbed); err != nil {
+//		return err
+//	}
+//	vec, err := session.Embed(query)
+//	...
+//	err = ctx.SetMode(gollama.ModeGenerate)
+func (c *Context) SetMode(mode ContextMode) error {
+	if c.handle == 0 {
+		return ErrContextNotCreated
+	}
+	model := c.model.Handle()
+	switch mode {
+	case ModeGenerate:
+		if !Model_has_decoder(model) {
+			return fmt.Errorf("%w: the model has no decoder to generate with", ErrUnsupportedModelType)
+		}
+	case ModeEmbed:
+		if Model_has_encoder(model) {
+			return fmt.Errorf("%w: encoder-decoder models embed with Encoder", ErrUnsupportedModelType)
+		}
+	default:
+		return fmt.Errorf("%w: context mode %d", ErrInvalidParameter, mode)
+	}
+	if mode == c.mode {
+		return nil
+	}
+
+	c.ClearMemory(true)
+	if mode == ModeGenerate {
+		Set_embeddings(c.handle, false)
+		Set_causal_attn(c.handle, true)
+	} else {
+		Set_embeddings(c.handle, true)
+		if causal, ok := embedCausalAttn(Pooling_type(c.handle)); ok {
+			Set_causal_attn(c.handle, causal)
+		}
+	}
+	c.mode = mode
+	return nil
+}
+
+// embedCausalAttn returns whether embeddings pooled with pooling need
+// causal attention; ok is false when the attention should be left as is.
+func embedCausalAttn(pooling LlamaPoolingType) (causal, ok bool) {
+	switch pooling {
+	case LLAMA_POOLING_TYPE_MEAN, LLAMA_POOLING_TYPE_CLS:
+		return false, true
+	case LLAMA_POOLING_TYPE_LAST, LLAMA_POOLING_TYPE_NONE:
+		return true, true
+	default:
+		return false, false
+	}
+}
@@ -0,0 +1,41 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ContextModeSuite struct{ BaseSuite }
+
+func (s *ContextModeSuite) TestString() {
+	s.Equal("generate", ModeGenerate.String())
+	s.Equal("embed", ModeEmbed.String())
+	s.Equal("ContextMode(7)", ContextMode(7).String())
+}
+
+func (s *ContextModeSuite) TestEmbedCausalAttn() {
+	for pooling, want := range map[LlamaPoolingType]bool{
+		LLAMA_POOLING_TYPE_MEAN: false,
+		LLAMA_POOLING_TYPE_CLS:  false,
+		LLAMA_POOLING_TYPE_LAST: true,
+		LLAMA_POOLING_TYPE_NONE: true,
+	} {
+		causal, ok := embedCausalAttn(pooling)
+		s.True(ok, "pooling %d", pooling)
+		s.Equal(want, causal, "pooling %d", pooling)
+	}
+	_, ok := embedCausalAttn(LLAMA_POOLING_TYPE_RANK)
+	s.False(ok)
+}
+
+func (s *ContextModeSuite) TestSetModeRequiresContext() {
+	c := &Context{}
+	s.Equal(ModeGenerate, c.Mode())
+	s.ErrorIs(c.SetMode(ModeEmbed), ErrContextNotCreated)
+	s.Equal(ModeGenerate, c.Mode())
+}
+
+func TestContextModeSuite(t *testing.T) {
+	suite.Run(t, new(ContextModeSuite))
+}
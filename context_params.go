@@ -0,0 +1,219 @@
+package gollama
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// KVCacheType is the data type of the KV cache. Quantized caches trade a
+// little accuracy for memory: q8_0 halves the size of an f16 cache and
+// q4_0 quarters it.
+type KVCacheType int32
+
+const (
+	KVCacheF16  = KVCacheType(GGML_TYPE_F16)
+	KVCacheQ8_0 = KVCacheType(GGML_TYPE_Q8_0)
+	KVCacheQ4_0 = KVCacheType(GGML_TYPE_Q4_0)
+)
+
+// String returns the name of the type, as in llama.cpp's --cache-type-k.
+func (t KVCacheType) String() string {
+	return GgmlType(t).String()
+}
+
+// SWACache selects the size of the KV cache of sliding window attention
+// (SWA) layers, which only attend to the last Model.NSwa tokens.
+//
+// A windowed cache only keeps those tokens, saving most of the memory of
+// SWA layers at long context, but positions that left the window are gone:
+// the cache cannot be rolled back, shifted (see Context.Shift) or reused
+// for a prompt that diverges before the end of the window. A full cache
+// keeps every token like a regular layer, which Context.Shift, ChatSession
+// prefix reuse and speculative decoding need.
+//
+// Architectures with SWA layers and their usual windows include gemma2
+// (4096 tokens), gemma3 (1024; 512 for the 1B model), gemma3n (512),
+// cohere2 (4096) and llama4 (8192, chunked). Mistral 7B v0.1 was trained
+// with a 4096-token window, but its GGUF files run as llama models with
+// full attention and are not affected.
+type SWACache int32
+
+const (
+	// SWACacheDefault keeps the SwaFull setting of the params; the library
+	// default is a full cache.
+	SWACacheDefault SWACache = iota
+	// SWACacheFull sizes SWA layers' cache like the other layers'.
+	SWACacheFull
+	// SWACacheWindowed only caches the window of SWA layers.
+	SWACacheWindowed
+)
+
+// ContextOptions are typed settings applied on top of LlamaContextParams.
+// Zero values keep the value of the params.
+type ContextOptions struct {
+	// KVCacheType is the type of both the K and the V cache.
+	KVCacheType KVCacheType
+	// FlashAttn forces flash attention on, as a quantized V cache requires.
+	FlashAttn bool
+	// SWACache sizes the cache of sliding window attention layers.
+	SWACache SWACache
+}
+
+// Apply sets the options in params and checks the resulting KV cache
+// configuration.
+func (o ContextOptions) Apply(params *LlamaContextParams) error {
+	if o.KVCacheType != 0 {
+		if err := params.SetKVCacheType(o.KVCacheType); err != nil {
+			return err
+		}
+	}
+	if o.FlashAttn {
+		params.FlashAttnType = LLAMA_FLASH_ATTN_TYPE_ENABLED
+	}
+	switch o.SWACache {
+	case SWACacheDefault:
+	case SWACacheFull:
+		params.SwaFull = 1
+	case SWACacheWindowed:
+		params.SwaFull = 0
+	default:
+		return fmt.Errorf("%w: SWA cache mode %d", ErrInvalidParameter, o.SWACache)
+	}
+	return checkKVCache(*params)
+}
+
+// SetKVCacheType sets the type of both the K and the V cache. A quantized
+// V cache needs flash attention, so an explicitly disabled FlashAttnType
+// is switched to LLAMA_FLASH_ATTN_TYPE_AUTO.
+func (p *LlamaContextParams) SetKVCacheType(t KVCacheType) error {
+	switch t {
+	case KVCacheF16, KVCacheQ8_0, KVCacheQ4_0:
+	default:
+		return fmt.Errorf("%w: KV cache type %s", ErrInvalidParameter, t)
+	}
+	p.TypeK = int32(t)
+	p.TypeV = int32(t)
+	if t != KVCacheF16 && p.FlashAttnType == LLAMA_FLASH_ATTN_TYPE_DISABLED {
+		p.FlashAttnType = LLAMA_FLASH_ATTN_TYPE_AUTO
+	}
+	return nil
+}
+
+// NewContextWithOptions creates a context for model from the default
+// context params with opts applied.
+//
+// Example usage:
+//
+//	ctx, err := gollama.NewContextWithOptions(model, gollama.ContextOptions{
+//		KVCacheType: gollama.KVCacheQ8_0,
+//		FlashAttn:   true,
+//	})
+func NewContextWithOptions(model *Model, opts ContextOptions) (*Context, error) {
+	params := Context_default_params()
+	if err := opts.Apply(&params); err != nil {
+		return nil, err
+	}
+	return NewContext(model, params)
+}
+
+// ApplyLongContext sets params.NCtx to targetCtx and, when that exceeds the
+// context length model was trained with, the RoPE scaling needed to use
+// it: linear scaling for models whose GGUF metadata asks for it and YaRN
+// otherwise, with llama.cpp's default YaRN parameters. Without scaling a
+// model produces garbage past its training length. Up to the training
+// length the model's own RoPE settings are kept.
+//
+// Quality degrades as the scaling factor grows; factors beyond 4 are rarely
+// usable.
+//
+// Example usage:
+//
+//	params := gollama.Context_default_params()
+//	if err := gollama.ApplyLongContext(&params, model, 32768); err != nil {
+//		return err
+//	}
+//	ctx, err := gollama.NewContext(model, params)
+func ApplyLongContext(params *LlamaContextParams, model *Model, targetCtx uint32) error {
+	if model == nil || model.Handle() == 0 {
+		return ErrModelNotLoaded
+	}
+	scaling, origCtx := model.ropeScaling()
+	return applyLongContext(params, uint32(max(model.NCtxTrain, 0)), scaling, origCtx, targetCtx)
+}
+
+// applyLongContext implements ApplyLongContext for a model trained with
+// nCtxTrain tokens whose metadata declares the RoPE scaling type scaling
+// and original context length origCtx (0 when absent).
+func applyLongContext(params *LlamaContextParams, nCtxTrain uint32, scaling string, origCtx, targetCtx uint32) error {
+	if targetCtx == 0 {
+		return fmt.Errorf("%w: target context of 0 tokens", ErrInvalidContextSize)
+	}
+	if nCtxTrain == 0 {
+		return fmt.Errorf("%w: the model does not report its training context length", ErrUnsupportedModelType)
+	}
+	params.NCtx = targetCtx
+	if targetCtx <= nCtxTrain {
+		return nil
+	}
+
+	// Models already extended with YaRN report the extended length as
+	// their training length; scale relative to the original one
+	base := nCtxTrain
+	if origCtx > 0 && origCtx < base {
+		base = origCtx
+	}
+	params.RopeFreqScale = float32(base) / float32(targetCtx)
+	if scaling == "linear" {
+		params.RopeScalingType = LLAMA_ROPE_SCALING_TYPE_LINEAR
+		return nil
+	}
+	params.RopeScalingType = LLAMA_ROPE_SCALING_TYPE_YARN
+	params.YarnOrigCtx = base
+	params.YarnExtFactor = -1
+	params.YarnAttnFactor = 1
+	params.YarnBetaFast = 32
+	params.YarnBetaSlow = 1
+	return nil
+}
+
+// ropeScaling returns the RoPE scaling type and original context length
+// declared in the model's metadata, if any.
+func (m *Model) ropeScaling() (scaling string, origCtx uint32) {
+	arch, ok := Model_meta_val_str(m.handle, "general.architecture")
+	if !ok {
+		return "", 0
+	}
+	scaling, _ = Model_meta_val_str(m.handle, arch+".rope.scaling.type")
+	if v, ok := Model_meta_val_str(m.handle, arch+".rope.scaling.original_context_length"); ok {
+		if n, err := strconv.ParseUint(v, 10, 32); err == nil {
+			origCtx = uint32(n)
+		}
+	}
+	return scaling, origCtx
+}
+
+// checkKVCache rejects cache types llama.cpp would refuse to create a
+// context with: out of range types, and a quantized V cache with flash
+// attention disabled.
+func checkKVCache(p LlamaContextParams) error {
+	for _, t := range []int32{p.TypeK, p.TypeV} {
+		if t < 0 || t >= int32(GGML_TYPE_COUNT) {
+			return fmt.Errorf("%w: KV cache type %d", ErrInvalidParameter, t)
+		}
+	}
+	if isQuantizedType(GgmlType(p.TypeV)) && p.FlashAttnType == LLAMA_FLASH_ATTN_TYPE_DISABLED {
+		return fmt.Errorf("%w: a %s V cache requires flash attention", ErrInvalidParameter, GgmlType(p.TypeV))
+	}
+	return nil
+}
+
+// isQuantizedType reports whether t is a quantized block type, without
+// calling into ggml.
+func isQuantizedType(t GgmlType) bool {
+	switch t {
+	case GGML_TYPE_F32, GGML_TYPE_F16, GGML_TYPE_BF16, GGML_TYPE_F64,
+		GGML_TYPE_I8, GGML_TYPE_I16, GGML_TYPE_I32, GGML_TYPE_I64:
+		return false
+	}
+	return t >= 0 && t < GGML_TYPE_COUNT
+}
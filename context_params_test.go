@@ -0,0 +1,96 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ContextParamsSuite struct{ BaseSuite }
+
+func (s *ContextParamsSuite) TestSetKVCacheType() {
+	p := LlamaContextParams{TypeK: 1, TypeV: 1, FlashAttnType: LLAMA_FLASH_ATTN_TYPE_DISABLED}
+	s.Require().NoError(p.SetKVCacheType(KVCacheQ8_0))
+	s.Equal(int32(GGML_TYPE_Q8_0), p.TypeK)
+	s.Equal(int32(GGML_TYPE_Q8_0), p.TypeV)
+	s.Equal(LLAMA_FLASH_ATTN_TYPE_AUTO, p.FlashAttnType, "a quantized V cache needs flash attention")
+
+	s.ErrorIs(p.SetKVCacheType(KVCacheType(GGML_TYPE_Q2_K)), ErrInvalidParameter)
+	s.Equal("q4_0", KVCacheQ4_0.String())
+}
+
+func (s *ContextParamsSuite) TestApply() {
+	p := LlamaContextParams{TypeK: 1, TypeV: 1, FlashAttnType: LLAMA_FLASH_ATTN_TYPE_DISABLED}
+	s.Require().NoError(ContextOptions{}.Apply(&p))
+	s.Equal(int32(1), p.TypeK)
+	s.Equal(LLAMA_FLASH_ATTN_TYPE_DISABLED, p.FlashAttnType)
+
+	s.Require().NoError(ContextOptions{KVCacheType: KVCacheQ4_0, FlashAttn: true}.Apply(&p))
+	s.Equal(int32(GGML_TYPE_Q4_0), p.TypeV)
+	s.Equal(LLAMA_FLASH_ATTN_TYPE_ENABLED, p.FlashAttnType)
+}
+
+func (s *ContextParamsSuite) TestApplySWACache() {
+	p := LlamaContextParams{TypeK: 1, TypeV: 1, SwaFull: 1}
+	s.Require().NoError(ContextOptions{}.Apply(&p))
+	s.Equal(uint8(1), p.SwaFull)
+	s.Require().NoError(ContextOptions{SWACache: SWACacheWindowed}.Apply(&p))
+	s.Equal(uint8(0), p.SwaFull)
+	s.Require().NoError(ContextOptions{SWACache: SWACacheFull}.Apply(&p))
+	s.Equal(uint8(1), p.SwaFull)
+	s.ErrorIs(ContextOptions{SWACache: 7}.Apply(&p), ErrInvalidParameter)
+}
+
+func (s *ContextParamsSuite) TestCheckKVCache() {
+	s.NoError(checkKVCache(LlamaContextParams{TypeK: 1, TypeV: 1}))
+	// A quantized K cache works without flash attention, a V cache does not
+	s.NoError(checkKVCache(LlamaContextParams{TypeK: int32(GGML_TYPE_Q8_0), TypeV: 1}))
+	s.ErrorIs(checkKVCache(LlamaContextParams{TypeK: 1, TypeV: int32(GGML_TYPE_Q8_0)}), ErrInvalidParameter)
+	s.NoError(checkKVCache(LlamaContextParams{TypeK: 1, TypeV: int32(GGML_TYPE_Q8_0), FlashAttnType: LLAMA_FLASH_ATTN_TYPE_AUTO}))
+	s.ErrorIs(checkKVCache(LlamaContextParams{TypeK: -1, TypeV: 1}), ErrInvalidParameter)
+	s.ErrorIs(checkKVCache(LlamaContextParams{TypeK: 1, TypeV: int32(GGML_TYPE_COUNT)}), ErrInvalidParameter)
+}
+
+func (s *ContextParamsSuite) TestIsQuantizedType() {
+	s.True(isQuantizedType(GGML_TYPE_Q4_0))
+	s.True(isQuantizedType(GGML_TYPE_IQ4_NL))
+	s.False(isQuantizedType(GGML_TYPE_F16))
+	s.False(isQuantizedType(GGML_TYPE_BF16))
+	s.False(isQuantizedType(GGML_TYPE_COUNT))
+}
+
+func (s *ContextParamsSuite) TestApplyLongContext() {
+	defaults := LlamaContextParams{RopeScalingType: LLAMA_ROPE_SCALING_TYPE_UNSPECIFIED, YarnExtFactor: -1}
+
+	p := defaults
+	s.Require().NoError(applyLongContext(&p, 4096, "", 0, 2048))
+	s.Equal(uint32(2048), p.NCtx)
+	s.Equal(LLAMA_ROPE_SCALING_TYPE_UNSPECIFIED, p.RopeScalingType, "no scaling within the training length")
+	s.Zero(p.RopeFreqScale)
+
+	p = defaults
+	s.Require().NoError(applyLongContext(&p, 4096, "", 0, 16384))
+	s.Equal(uint32(16384), p.NCtx)
+	s.Equal(LLAMA_ROPE_SCALING_TYPE_YARN, p.RopeScalingType)
+	s.InDelta(0.25, p.RopeFreqScale, 1e-6)
+	s.Equal(uint32(4096), p.YarnOrigCtx)
+	s.Equal(float32(32), p.YarnBetaFast)
+	s.Equal(float32(1), p.YarnBetaSlow)
+
+	p = defaults
+	s.Require().NoError(applyLongContext(&p, 4096, "linear", 0, 8192))
+	s.Equal(LLAMA_ROPE_SCALING_TYPE_LINEAR, p.RopeScalingType)
+	s.InDelta(0.5, p.RopeFreqScale, 1e-6)
+
+	// A YaRN model trained to 32k from 4k scales from the original length
+	p = defaults
+	s.Require().NoError(applyLongContext(&p, 32768, "yarn", 4096, 65536))
+	s.Equal(uint32(4096), p.YarnOrigCtx)
+	s.InDelta(0.0625, p.RopeFreqScale, 1e-6)
+
+	s.ErrorIs(applyLongContext(&p, 4096, "", 0, 0), ErrInvalidContextSize)
+	s.ErrorIs(applyLongContext(&p, 0, "", 0, 8192), ErrUnsupportedModelType)
+	s.ErrorIs(ApplyLongContext(&p, nil, 8192), ErrModelNotLoaded)
+}
+
+func TestContextParamsSuite(t *testing.T) { suite.Run(t, new(ContextParamsSuite)) }
@@ -0,0 +1,53 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ContextSuite struct{ BaseSuite }
+
+func (s *ContextSuite) TestAutoShiftSettings() {
+	c := &Context{NCtx: 16}
+	c.EnableAutoShift(-3)
+	s.True(c.autoShift)
+	s.Equal(0, c.shiftKeep)
+	c.EnableAutoShift(4)
+	s.Equal(4, c.shiftKeep)
+	c.DisableAutoShift()
+	s.False(c.autoShift)
+}
+
+func (s *ContextSuite) TestShiftWithoutContext() {
+	var events []ContextShiftEvent
+	c := &Context{NCtx: 16}
+	c.SetShiftCallback(func(ev ContextShiftEvent) { events = append(events, ev) })
+	nPast, err := c.Shift(0, 16)
+	s.ErrorIs(err, ErrContextNotCreated)
+	s.Equal(LlamaPos(16), nPast)
+	s.Empty(events)
+	s.ErrorIs(c.DecodeTokens([]LlamaToken{1}, 16, 0), ErrContextNotCreated)
+}
+
+func (s *ContextSuite) TestSetThreads() {
+	s.ErrorIs((&Context{}).SetThreads(4, 4), ErrContextNotCreated)
+	c := &Context{handle: 1}
+	s.ErrorIs(c.SetThreads(0, 4), ErrInvalidParameter)
+	s.ErrorIs(c.SetThreads(4, -1), ErrInvalidParameter)
+
+	gen, batch := (&Context{}).Threads()
+	s.Zero(gen)
+	s.Zero(batch)
+}
+
+func (s *ContextSuite) TestResetWithoutContext() {
+	c := &Context{}
+	s.ErrorIs(c.Reset(), ErrContextNotCreated)
+	c.Free()
+	s.ErrorIs(c.Reset(0), ErrContextNotCreated)
+}
+
+func TestContextSuite(t *testing.T) {
+	suite.Run(t, new(ContextSuite))
+}
@@ -0,0 +1,321 @@
+package gollama
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// crashStateSize is the fixed region of the dump file that is rewritten in
+	// place with the live state; the Go runtime appends its fatal error output
+	// after it.
+	crashStateSize = 16 << 10
+	// crashCallHistory is the number of native calls kept in the trace.
+	crashCallHistory = 32
+	// crashFlushInterval bounds how long a recorded call waits before the
+	// live state is rewritten; a full history of calls flushes at once.
+	crashFlushInterval = 100 * time.Millisecond
+)
+
+// crashFlushFirst lists the calls that flush the live state before they
+// run: they parse files or allocate backend memory, where native faults
+// concentrate, and are too rare for the write to matter. The call in
+// progress at a fault is also named in the runtime's goroutine trace
+// appended to the report.
+var crashFlushFirst = map[string]bool{
+	"llama_model_load_from_file":   true,
+	"llama_model_load_from_splits": true,
+	"llama_init_from_model":        true,
+	"llama_state_seq_set_data":     true,
+	"mtmd_init_from_file":          true,
+}
+
+// crashRecorder keeps a diagnostic bundle on disk so that a SIGSEGV/SIGBUS
+// raised inside libllama leaves an actionable report behind. Go code cannot
+// run once a native fault is delivered, so the bundle is written ahead of
+// time: a static header when dumps are enabled, a live-state region that is
+// rewritten shortly after tracked native calls, and the runtime's own crash
+// output appended by the Go runtime (Go 1.23+).
+type crashRecorder struct {
+	enabled atomic.Bool
+
+	mu     sync.Mutex
+	file   *os.File
+	path   string
+	offset int64 // start of the live-state region
+
+	calls    [crashCallHistory]crashCall
+	nCalls   int
+	pending  int         // calls recorded since the last flush
+	timer    *time.Timer // pending flush of the recorded calls
+	models   map[LlamaModel]string
+	contexts map[LlamaContext]crashContext
+}
+
+type crashCall struct {
+	name string
+	at   time.Time
+}
+
+type crashContext struct {
+	model  LlamaModel
+	params LlamaContextParams
+}
+
+var crashDumps = &crashRecorder{}
+
+// EnableCrashDumps arms a best-effort crash report. A report file is created
+// in dir (or "crashes" next to the library cache when dir is empty) holding
+// the loaded library details, OS and GPU information, and a live record of
+// recent native calls, loaded models and context parameters. If the process
+// then dies from a native fault, the Go runtime's fatal error output is
+// appended to the same file.
+//
+// The returned path is the report file. It is removed by DisableCrashDumps
+// or Cleanup if no crash happened.
+func EnableCrashDumps(dir string) (string, error) {
+	return crashDumps.enable(dir)
+}
+
+// DisableCrashDumps disarms crash reporting and removes the pending report.
+func DisableCrashDumps() {
+	crashDumps.disable()
+}
+
+// CrashDumpPath returns the armed report file, or "" if crash dumps are disabled.
+func CrashDumpPath() string {
+	crashDumps.mu.Lock()
+	defer crashDumps.mu.Unlock()
+	return crashDumps.path
+}
+
+func (r *crashRecorder) enable(dir string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		return r.path, nil
+	}
+
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(defaultLibraryCacheDir()), "crashes")
+	}
+	if err := os.MkdirAll(longPath(dir), 0750); err != nil {
+		return "", fmt.Errorf("failed to create crash dump directory: %w", err)
+	}
+
+	name := fmt.Sprintf("gollama-crash-%s-%d.log", time.Now().Format("20060102-150405"), os.Getpid())
+	path := filepath.Join(dir, name)
+	// #nosec G304 -- path is built from the configured cache directory
+	f, err := os.OpenFile(longPath(path), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create crash dump file: %w", err)
+	}
+
+	header := r.header()
+	if _, err := f.Write(header); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", fmt.Errorf("failed to write crash dump header: %w", err)
+	}
+	// Reserve the live-state region and mark where the runtime output starts
+	region := bytes.Repeat([]byte{' '}, crashStateSize)
+	region[len(region)-1] = '\n'
+	if _, err := f.Write(append(region, "=== Go runtime crash output ===\n"...)); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", fmt.Errorf("failed to write crash dump header: %w", err)
+	}
+
+	if err := setCrashOutput(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return "", err
+	}
+
+	r.file = f
+	r.path = path
+	r.offset = int64(len(header))
+	if r.models == nil {
+		r.models = make(map[LlamaModel]string)
+		r.contexts = make(map[LlamaContext]crashContext)
+	}
+	r.enabled.Store(true)
+	r.flushLocked()
+	return path, nil
+}
+
+func (r *crashRecorder) disable() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return
+	}
+	r.enabled.Store(false)
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	_ = setCrashOutput(nil)
+	_ = r.file.Close()
+	_ = os.Remove(r.path)
+	r.file = nil
+	r.path = ""
+}
+
+// header renders the static part of the report.
+func (r *crashRecorder) header() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "=== gollama crash report ===\n")
+	fmt.Fprintf(&b, "Armed: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "gollama: %s\n", FullVersion)
+	fmt.Fprintf(&b, "Go: %s %s/%s, %d CPUs\n", runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumCPU())
+	fmt.Fprintf(&b, "GPU backend: %s\n", DetectGpuBackend())
+	fmt.Fprintf(&b, "Library:\n%s", getLibraryDiagnostics())
+	if isLoaded && llamaPrintSystemInfo != nil {
+		fmt.Fprintf(&b, "System info: %s\n", bytePointerToString(llamaPrintSystemInfo()))
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+func (r *crashRecorder) noteCall(name string) {
+	if !r.enabled.Load() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls[r.nCalls%crashCallHistory] = crashCall{name: name, at: time.Now()}
+	r.nCalls++
+	r.pending++
+	if r.pending >= crashCallHistory || crashFlushFirst[name] {
+		r.flushLocked()
+		return
+	}
+	if r.timer == nil && r.file != nil {
+		r.timer = time.AfterFunc(crashFlushInterval, r.flushPending)
+	}
+}
+
+// flushPending writes the calls recorded since the last flush.
+func (r *crashRecorder) flushPending() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timer = nil
+	if r.pending > 0 {
+		r.flushLocked()
+	}
+}
+
+func (r *crashRecorder) noteModel(model LlamaModel, path string) {
+	if !r.enabled.Load() {
+		return
+	}
+	desc := path
+	for _, key := range []string{"general.architecture", "general.name", "general.file_type"} {
+		if val, ok := Model_meta_val_str(model, key); ok {
+			desc += fmt.Sprintf(" %s=%q", key, val)
+		}
+	}
+	if llamaModelNEmbd != nil && llamaModelNLayer != nil {
+		desc += fmt.Sprintf(" n_embd=%d n_layer=%d", llamaModelNEmbd(model), llamaModelNLayer(model))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models[model] = desc
+	r.flushLocked()
+}
+
+func (r *crashRecorder) forgetModel(model LlamaModel) {
+	if !r.enabled.Load() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.models, model)
+	r.flushLocked()
+}
+
+func (r *crashRecorder) noteContext(ctx LlamaContext, model LlamaModel, params LlamaContextParams) {
+	if !r.enabled.Load() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.contexts[ctx] = crashContext{model: model, params: params}
+	r.flushLocked()
+}
+
+func (r *crashRecorder) forgetContext(ctx LlamaContext) {
+	if !r.enabled.Load() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.contexts, ctx)
+	r.flushLocked()
+}
+
+// state renders the live part of the report.
+func (r *crashRecorder) state() []byte {
+	var b bytes.Buffer
+	b.WriteString("--- Last native calls (oldest first) ---\n")
+	start := 0
+	if r.nCalls > crashCallHistory {
+		start = r.nCalls - crashCallHistory
+	}
+	for i := start; i < r.nCalls; i++ {
+		c := r.calls[i%crashCallHistory]
+		fmt.Fprintf(&b, "  %s %s\n", c.at.Format("15:04:05.000000"), c.name)
+	}
+
+	b.WriteString("--- Models ---\n")
+	models := make([]LlamaModel, 0, len(r.models))
+	for m := range r.models {
+		models = append(models, m)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i] < models[j] })
+	for _, m := range models {
+		fmt.Fprintf(&b, "  0x%x %s\n", uintptr(m), r.models[m])
+	}
+
+	b.WriteString("--- Contexts ---\n")
+	ctxs := make([]LlamaContext, 0, len(r.contexts))
+	for c := range r.contexts {
+		ctxs = append(ctxs, c)
+	}
+	sort.Slice(ctxs, func(i, j int) bool { return ctxs[i] < ctxs[j] })
+	for _, c := range ctxs {
+		cc := r.contexts[c]
+		p := cc.params
+		fmt.Fprintf(&b, "  0x%x model=0x%x n_ctx=%d n_batch=%d n_ubatch=%d n_seq_max=%d threads=%d/%d embeddings=%d pooling=%d attention=%d flash_attn=%d offload_kqv=%d\n",
+			uintptr(c), uintptr(cc.model), p.NCtx, p.NBatch, p.NUbatch, p.NSeqMax, p.NThreads, p.NThreadsBatch,
+			p.Embeddings, p.PoolingType, p.AttentionType, p.FlashAttnType, p.Offload_kqv)
+	}
+	return b.Bytes()
+}
+
+// flushLocked rewrites the live-state region in place. Callers must hold r.mu.
+func (r *crashRecorder) flushLocked() {
+	if r.file == nil {
+		return
+	}
+	r.pending = 0
+	region := bytes.Repeat([]byte{' '}, crashStateSize)
+	region[len(region)-1] = '\n'
+	state := r.state()
+	if len(state) > crashStateSize-1 {
+		state = append(state[:crashStateSize-len("...truncated\n")-1], "...truncated\n"...)
+	}
+	copy(region, state)
+	_, _ = r.file.WriteAt(region, r.offset)
+}
@@ -0,0 +1,13 @@
+//go:build go1.23
+
+package gollama
+
+import (
+	"os"
+	"runtime/debug"
+)
+
+// setCrashOutput directs the runtime's fatal error output to f as well as stderr.
+func setCrashOutput(f *os.File) error {
+	return debug.SetCrashOutput(f, debug.CrashOptions{})
+}
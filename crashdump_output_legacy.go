@@ -0,0 +1,16 @@
+//go:build !go1.23
+
+package gollama
+
+import (
+	"fmt"
+	"os"
+)
+
+// setCrashOutput requires runtime/debug.SetCrashOutput, added in Go 1.23.
+func setCrashOutput(f *os.File) error {
+	if f == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: crash dumps require Go 1.23 or later", ErrUnsupportedPlatform)
+}
@@ -0,0 +1,122 @@
+package gollama
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CrashDumpSuite struct{ BaseSuite }
+
+func (s *CrashDumpSuite) TestEnableWritesReportAndDisableRemovesIt() {
+	dir := s.T().TempDir()
+	path, err := EnableCrashDumps(dir)
+	if err != nil {
+		s.T().Skipf("crash dumps unavailable: %v", err)
+	}
+	s.Equal(path, CrashDumpPath())
+	s.Equal(dir, filepath.Dir(path))
+
+	crashDumps.noteCall("llama_decode")
+	crashDumps.noteContext(LlamaContext(0x1234), LlamaModel(0x10), LlamaContextParams{NCtx: 2048, NBatch: 512})
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	report := string(data)
+	s.Contains(report, "=== gollama crash report ===")
+	s.Contains(report, FullVersion)
+	s.Contains(report, "llama_decode")
+	s.Contains(report, "0x1234 model=0x10 n_ctx=2048 n_batch=512")
+	s.True(strings.HasSuffix(report, "=== Go runtime crash output ===\n"))
+
+	crashDumps.forgetContext(LlamaContext(0x1234))
+	data, err = os.ReadFile(path)
+	s.Require().NoError(err)
+	s.NotContains(string(data), "0x1234 model=")
+
+	DisableCrashDumps()
+	s.Empty(CrashDumpPath())
+	_, err = os.Stat(path)
+	s.True(os.IsNotExist(err))
+}
+
+func (s *CrashDumpSuite) TestCallTraceKeepsMostRecent() {
+	r := &crashRecorder{models: map[LlamaModel]string{}, contexts: map[LlamaContext]crashContext{}}
+	r.enabled.Store(true)
+	for i := 0; i < crashCallHistory+5; i++ {
+		name := "call_old"
+		if i >= 5 {
+			name = "call_new"
+		}
+		r.noteCall(name)
+	}
+	state := string(r.state())
+	s.NotContains(state, "call_old")
+	s.Equal(crashCallHistory, strings.Count(state, "call_new"))
+}
+
+func (s *CrashDumpSuite) TestCallsAreFlushedInBatches() {
+	path, err := EnableCrashDumps(s.T().TempDir())
+	if err != nil {
+		s.T().Skipf("crash dumps unavailable: %v", err)
+	}
+	defer DisableCrashDumps()
+	report := func() string {
+		data, err := os.ReadFile(path)
+		s.Require().NoError(err)
+		return string(data)
+	}
+
+	crashDumps.noteCall("llama_batched_call")
+	s.NotContains(report(), "llama_batched_call", "a single call does not rewrite the file")
+	s.Eventually(func() bool { return strings.Contains(report(), "llama_batched_call") },
+		5*time.Second, 10*time.Millisecond, "the timer flushes it")
+
+	for i := 0; i < crashCallHistory; i++ {
+		crashDumps.noteCall("llama_history_call")
+	}
+	s.Equal(crashCallHistory, strings.Count(report(), "llama_history_call"), "a full history flushes at once")
+
+	crashDumps.noteCall("llama_model_load_from_file")
+	s.Contains(report(), "llama_model_load_from_file", "risky calls flush before they run")
+}
+
+// TestCrashOutputIsAppended runs a child process that arms crash dumps and
+// then dies, and checks the runtime's fatal output lands in the report.
+func (s *CrashDumpSuite) TestCrashOutputIsAppended() {
+	dir := s.T().TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=TestCrashDumpChild") // #nosec G204 -- re-executes the test binary
+	cmd.Env = append(os.Environ(), "GOLLAMA_TEST_CRASH_DIR="+dir)
+	out, err := cmd.CombinedOutput()
+	s.Require().Error(err, "child process should crash: %s", out)
+	if strings.Contains(string(out), "crash dumps unavailable") {
+		s.T().Skip("crash dumps unavailable on this toolchain")
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "gollama-crash-*.log"))
+	s.Require().NoError(err)
+	s.Require().Len(matches, 1)
+	data, err := os.ReadFile(matches[0])
+	s.Require().NoError(err)
+	s.Contains(string(data), "=== Go runtime crash output ===")
+	s.Contains(string(data), "simulated native fault")
+}
+
+func TestCrashDumpChild(t *testing.T) {
+	dir := os.Getenv("GOLLAMA_TEST_CRASH_DIR")
+	if dir == "" {
+		t.Skip("only runs as a child of TestCrashOutputIsAppended")
+	}
+	if _, err := EnableCrashDumps(dir); err != nil {
+		t.Logf("crash dumps unavailable: %v", err)
+		os.Exit(3)
+	}
+	panic("simulated native fault")
+}
+
+func TestCrashDumpSuite(t *testing.T) { suite.Run(t, new(CrashDumpSuite)) }
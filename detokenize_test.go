@@ -0,0 +1,127 @@
+package gollama
+
+import (
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// roundTripCorpus holds text in many scripts, plus the spacing, emoji and
+// combining sequences tokenizers tend to get wrong. Byte-fallback
+// vocabularies encode most of it with byte tokens.
+var roundTripCorpus = []string{
+	"The quick brown fox jumps over the lazy dog.",
+	"Zwölf Boxkämpfer jagen Viktor quer über den großen Sylter Deich.",
+	"Voix ambiguë d'un cœur qui, au zéphyr, préfère les jattes de kiwis.",
+	"El pingüino Wenceslao hizo kilómetros bajo exhaustiva lluvia y frío, añoraba a su querido cachorro.",
+	"Съешь же ещё этих мягких французских булок, да выпей чаю.",
+	"Ξεσκεπάζω την ψυχοφθόρα βδελυγμία.",
+	"صِف خَلقَ خَودِ كَمِثلِ الشَمسِ إِذ بَزَغَت",
+	"עטלף אבק נס דרך מזגן שהתפוצץ כי חם",
+	"ऋषियों को सताने वाले दुष्ट राक्षसों के राजा रावण का सर्वनाश करने वाले विष्णुवतार भगवान श्रीराम।",
+	"我能吞下玻璃而不伤身体。",
+	"いろはにほへと ちりぬるを わかよたれそ つねならむ",
+	"다람쥐 헌 쳇바퀴에 타고파",
+	"เป็นมนุษย์สุดประเสริฐเลิศคุณค่า",
+	"Tiếng Việt có dấu: Đường đi khó không vì ngăn sông cách núi.",
+	"👩‍👩‍👧‍👦 🏳️‍🌈 👍🏽 🇮🇹 ❤️",
+	"é ä ñ 각",
+	"  two leading spaces, trailing ones  ",
+	"tabs\tand\nnew\n\nlines\r\nwith CRLF",
+	"func main() {\n\tfmt.Println(\"hi\") // comment\n}",
+	"1234567890 3.14159 -42 1e-9 0xDEADBEEF",
+}
+
+type DetokenizeSuite struct{ BaseSuite }
+
+func (s *DetokenizeSuite) TestDetokenizeRequiresModel() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	_, err := (&Model{}).Detokenize([]LlamaToken{1}, false, false)
+	s.ErrorIs(err, ErrModelNotLoaded)
+}
+
+func (s *DetokenizeSuite) TestRoundTripSamplesAreValidUTF8() {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		s.True(utf8.ValidString(roundTripSample(rng)))
+	}
+}
+
+func (s *DetokenizeSuite) TestRoundTripCorpus() {
+	model := s.loadModel()
+	defer model.Free()
+
+	for _, text := range roundTripCorpus {
+		s.assertRoundTrip(model, text)
+	}
+	s.assertRoundTrip(model, "")
+}
+
+func (s *DetokenizeSuite) TestRoundTripProperty() {
+	model := s.loadModel()
+	defer model.Free()
+
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 200; i++ {
+		s.assertRoundTrip(model, roundTripSample(rng))
+	}
+}
+
+// assertRoundTrip checks that text survives Tokenize and Detokenize, with
+// and without the special tokens of the model, and that the pieces of the
+// tokens concatenate to the same bytes.
+func (s *DetokenizeSuite) assertRoundTrip(model *Model, text string) {
+	tokens, err := model.Tokenize(text, false, false)
+	s.Require().NoError(err, "%q", text)
+	got, err := model.Detokenize(tokens, false, false)
+	s.Require().NoError(err, "%q", text)
+	s.Equal(text, got, "tokens %v", tokens)
+
+	var pieces strings.Builder
+	for _, token := range tokens {
+		pieces.WriteString(Token_to_piece(model.Handle(), token, false))
+	}
+	// SentencePiece vocabularies put a space before the first word
+	if joined := pieces.String(); joined != text {
+		s.Equal(" "+text, joined, "pieces of %v", tokens)
+	}
+
+	withSpecial, err := model.Tokenize(text, true, false)
+	s.Require().NoError(err, "%q", text)
+	got, err = model.Detokenize(withSpecial, true, false)
+	s.Require().NoError(err, "%q", text)
+	s.Equal(text, got, "tokens %v", withSpecial)
+}
+
+func (s *DetokenizeSuite) loadModel() *Model {
+	modelPath := "./models/tinyllama-1.1b-chat-v1.0.Q2_K.gguf"
+	if _, err := os.Stat(modelPath); err != nil {
+		s.T().Skipf("Model not available at %s", modelPath)
+	}
+	params := Model_default_params()
+	params.NGpuLayers = 0
+	model, err := LoadModel(modelPath, params)
+	s.Require().NoError(err)
+	return model
+}
+
+// roundTripSample joins one to three substrings of the corpus, cut on rune
+// boundaries, so byte tokens and merges meet at arbitrary places.
+func roundTripSample(rng *rand.Rand) string {
+	var b strings.Builder
+	for n := 1 + rng.Intn(3); n > 0; n-- {
+		runes := []rune(roundTripCorpus[rng.Intn(len(roundTripCorpus))])
+		start := rng.Intn(len(runes))
+		end := start + 1 + rng.Intn(len(runes)-start)
+		b.WriteString(string(runes[start:end]))
+	}
+	return b.String()
+}
+
+func TestDetokenizeSuite(t *testing.T) { suite.Run(t, new(DetokenizeSuite)) }
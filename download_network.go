@@ -0,0 +1,114 @@
+package gollama
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v68/github"
+)
+
+// configureNetwork applies the proxy, mirror and offline settings of cfg;
+// a nil cfg restores the defaults. HTTPS_PROXY and related variables apply
+// unless cfg.DownloadProxy overrides them.
+func (d *LibraryDownloader) configureNetwork(cfg *Config) error {
+	d.mirror, d.offline, d.transport = "", false, nil
+	if cfg != nil {
+		d.mirror = cfg.DownloadMirror
+		d.offline = cfg.Offline
+		if cfg.DownloadProxy != "" {
+			proxyURL, err := url.Parse(cfg.DownloadProxy)
+			if err != nil {
+				return fmt.Errorf("invalid download_proxy: %w", err)
+			}
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.Proxy = http.ProxyURL(proxyURL)
+			d.transport = transport
+		}
+	}
+	d.client = newGitHubClient(d.httpClient(downloadTimeout))
+	return nil
+}
+
+// httpClient returns a client using the configured proxy.
+func (d *LibraryDownloader) httpClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: d.transport}
+}
+
+// newGitHubClient creates a go-github client, authenticated with
+// GITHUB_TOKEN when it is set.
+func newGitHubClient(httpClient *http.Client) *github.Client {
+	client := github.NewClient(httpClient)
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		client = client.WithAuthToken(token)
+	}
+	return client
+}
+
+// checkOnline fails with ErrOffline in offline mode, explaining how to
+// provide the libraries instead.
+func (d *LibraryDownloader) checkOnline(action string) error {
+	if !d.offline {
+		return nil
+	}
+	return fmt.Errorf("%w: cannot %s; place the llama.cpp libraries in %s (e.g. with gollama-download on a connected machine), in ./libs, or point GOLLAMA_LIBRARY_PATH at them",
+		ErrOffline, action, d.cacheDir)
+}
+
+// assetURL returns the URL to download a release asset from: the mirror
+// when one is configured, otherwise GitHub.
+func (d *LibraryDownloader) assetURL(release *ReleaseInfo, asset *github.ReleaseAsset) string {
+	if d.mirror == "" {
+		return asset.GetBrowserDownloadURL()
+	}
+	return mirrorURL(d.mirror, release.GetTagName(), asset.GetName())
+}
+
+// mirrorURL expands a mirror template. {tag} and {asset} are replaced by
+// the release tag and asset name; a template without placeholders is a
+// base URL laid out like GitHub's releases/download/<tag>/<asset>.
+func mirrorURL(template, tag, asset string) string {
+	if !strings.Contains(template, "{tag}") && !strings.Contains(template, "{asset}") {
+		return strings.TrimSuffix(template, "/") + "/" + tag + "/" + asset
+	}
+	return strings.NewReplacer("{tag}", tag, "{asset}", asset).Replace(template)
+}
+
+// mirrorRelease describes a release without the GitHub API, for mirrors in
+// networks that cannot reach api.github.com. It lists the assets whose
+// names follow from the tag alone; variants named after their toolkit
+// version (CUDA, HIP, OpenCL) are missing.
+func (d *LibraryDownloader) mirrorRelease(tag string) *ReleaseInfo {
+	release := &ReleaseInfo{TagName: github.String(tag)}
+	platforms := []struct{ goos, goarch string }{
+		{"darwin", "amd64"}, {"darwin", "arm64"},
+		{"linux", "amd64"}, {"linux", "arm64"},
+		{"windows", "amd64"}, {"windows", "arm64"},
+	}
+	backends := []LlamaGpuBackend{
+		LLAMA_GPU_BACKEND_CPU, LLAMA_GPU_BACKEND_METAL, LLAMA_GPU_BACKEND_CUDA, LLAMA_GPU_BACKEND_HIP,
+		LLAMA_GPU_BACKEND_VULKAN, LLAMA_GPU_BACKEND_OPENCL, LLAMA_GPU_BACKEND_SYCL,
+	}
+	seen := make(map[string]bool)
+	for _, p := range platforms {
+		for _, b := range backends {
+			pattern, err := d.GetAssetPatternForBackend(p.goos, p.goarch, b)
+			if err != nil {
+				continue
+			}
+			name := strings.Replace(pattern, "llama-.*-", "llama-"+tag+"-", 1)
+			if strings.Contains(name, ".*") || seen[name] {
+				continue
+			}
+			seen[name] = true
+			release.Assets = append(release.Assets, &github.ReleaseAsset{
+				Name:               github.String(name),
+				BrowserDownloadURL: github.String(mirrorURL(d.mirror, tag, name)),
+			})
+		}
+	}
+	return release
+}
@@ -0,0 +1,107 @@
+package gollama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v68/github"
+	"github.com/stretchr/testify/suite"
+)
+
+type DownloadNetworkSuite struct{ BaseSuite }
+
+func (s *DownloadNetworkSuite) TestMirrorURL() {
+	s.Equal("https://mirror.example/llama/b1/a.zip", mirrorURL("https://mirror.example/llama/", "b1", "a.zip"))
+	s.Equal("https://mirror.example/a.zip?tag=b1", mirrorURL("https://mirror.example/{asset}?tag={tag}", "b1", "a.zip"))
+}
+
+func (s *DownloadNetworkSuite) TestMirrorRelease() {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	d, err := NewLibraryDownloaderWithCacheDir(s.T().TempDir())
+	s.Require().NoError(err)
+	s.Require().NoError(d.configureNetwork(&Config{DownloadMirror: "https://mirror.example/{tag}/{asset}"}))
+	d.client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	release, err := d.GetReleaseByTag("b6862")
+	s.Require().NoError(err)
+	name, downloadURL, err := d.FindAssetByPattern(release, "llama-.*-bin-ubuntu-x64.zip")
+	s.Require().NoError(err)
+	s.Equal("llama-b6862-bin-ubuntu-x64.zip", name)
+	s.Equal("https://mirror.example/b6862/llama-b6862-bin-ubuntu-x64.zip", downloadURL)
+
+	// Real release metadata keeps its asset names but downloads from the mirror
+	published := &ReleaseInfo{TagName: github.String("b1"), Assets: []*github.ReleaseAsset{{
+		Name:               github.String("llama-b1-bin-macos-arm64.zip"),
+		BrowserDownloadURL: github.String("https://github.com/x.zip"),
+	}}}
+	_, downloadURL, err = d.FindAssetByPattern(published, "llama-.*-bin-macos-arm64.zip")
+	s.Require().NoError(err)
+	s.Equal("https://mirror.example/b1/llama-b1-bin-macos-arm64.zip", downloadURL)
+}
+
+func (s *DownloadNetworkSuite) TestOffline() {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	dir := s.T().TempDir()
+	d, err := NewLibraryDownloaderWithCacheDir(dir)
+	s.Require().NoError(err)
+	s.Require().NoError(d.configureNetwork(&Config{Offline: true}))
+	d.client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	_, err = d.GetLatestRelease()
+	s.ErrorIs(err, ErrOffline)
+	_, err = d.GetReleaseByTag("b1")
+	s.ErrorIs(err, ErrOffline)
+	s.Contains(err.Error(), dir)
+	_, _, err = d.fetch(srv.URL+"/a.zip", filepath.Join(dir, "a.zip"), false)
+	s.ErrorIs(err, ErrOffline)
+	s.Zero(requests)
+}
+
+func (s *DownloadNetworkSuite) TestProxyOverride() {
+	d, err := NewLibraryDownloaderWithCacheDir(s.T().TempDir())
+	s.Require().NoError(err)
+	s.Nil(d.transport)
+
+	s.Require().NoError(d.configureNetwork(&Config{DownloadProxy: "http://proxy.example:3128"}))
+	transport, ok := d.transport.(*http.Transport)
+	s.Require().True(ok)
+	req, _ := http.NewRequest("GET", "https://github.com/", nil)
+	proxyURL, err := transport.Proxy(req)
+	s.Require().NoError(err)
+	s.Equal("proxy.example:3128", proxyURL.Host)
+
+	s.Require().NoError(d.configureNetwork(nil))
+	s.Nil(d.transport)
+}
+
+func (s *DownloadNetworkSuite) TestConfigFromEnv() {
+	s.T().Setenv("GOLLAMA_DOWNLOAD_MIRROR", "https://mirror.example/{tag}/{asset}")
+	s.T().Setenv("GOLLAMA_DOWNLOAD_PROXY", "http://proxy.example:3128")
+	s.T().Setenv("GOLLAMA_OFFLINE", "true")
+
+	cfg := LoadConfigFromEnv()
+	s.Equal("https://mirror.example/{tag}/{asset}", cfg.DownloadMirror)
+	s.Equal("http://proxy.example:3128", cfg.DownloadProxy)
+	s.True(cfg.Offline)
+	s.NoError(cfg.Validate())
+
+	cfg.DownloadProxy = "not a url"
+	s.Error(cfg.Validate())
+	cfg.DownloadProxy = ""
+	cfg.DownloadMirror = "mirror/{asset}"
+	s.Error(cfg.Validate())
+}
+
+func TestDownloadNetworkSuite(t *testing.T) {
+	suite.Run(t, new(DownloadNetworkSuite))
+}
@@ -0,0 +1,252 @@
+package gollama
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how library downloads are retried. Attempt n waits
+// InitialBackoff * Multiplier^(n-2), capped at MaxBackoff, before retrying.
+// Interrupted downloads resume from the bytes already received when the
+// server supports range requests.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts; values below 1 mean 1
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// DefaultRetryPolicy returns the policy used by new downloaders: five
+// attempts with backoff doubling from one second up to thirty.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+// backoff returns the wait before the given attempt (2 for the first retry).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := float64(p.InitialBackoff)
+	for i := 2; i < attempt; i++ {
+		wait *= p.Multiplier
+	}
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(wait)
+}
+
+// DownloadProgressFunc receives the bytes of an archive received so far and
+// its total size, or -1 when the server does not report it. Resumed
+// downloads start from the bytes already on disk.
+type DownloadProgressFunc func(received, total int64)
+
+// downloadStats describes a finished download.
+type downloadStats struct {
+	attempts int
+	bytes    int64
+	resumed  bool
+}
+
+// SetRetryPolicy sets the retry policy of the downloader.
+func (d *LibraryDownloader) SetRetryPolicy(p RetryPolicy) {
+	d.retry = p
+}
+
+// SetProgressCallback sets the function that receives download progress;
+// nil disables it. Parallel downloads share the callback.
+func (d *LibraryDownloader) SetProgressCallback(fn DownloadProgressFunc) {
+	d.progress = fn
+}
+
+// SetDownloadRetryPolicy sets the retry policy of the downloader used to
+// fetch libraries on demand.
+func SetDownloadRetryPolicy(p RetryPolicy) error {
+	d, err := ensureDownloader()
+	if err != nil {
+		return err
+	}
+	d.SetRetryPolicy(p)
+	return nil
+}
+
+// SetDownloadProgressCallback sets the progress callback of the downloader
+// used to fetch libraries on demand.
+func SetDownloadProgressCallback(fn DownloadProgressFunc) error {
+	d, err := ensureDownloader()
+	if err != nil {
+		return err
+	}
+	d.SetProgressCallback(fn)
+	return nil
+}
+
+// permanentError marks download failures that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// fetch downloads url to path, retrying with backoff and resuming from a
+// partial file. The data is written to path+".part" and renamed once
+// complete. With withHash it returns the SHA256 of the whole file.
+func (d *LibraryDownloader) fetch(url, path string, withHash bool) (string, downloadStats, error) {
+	return d.fetchWithHeader(url, path, nil, withHash)
+}
+
+// fetchWithHeader is fetch with extra request headers, e.g. credentials.
+func (d *LibraryDownloader) fetchWithHeader(url, path string, header http.Header, withHash bool) (string, downloadStats, error) {
+	if err := d.checkOnline("download " + url); err != nil {
+		return "", downloadStats{}, err
+	}
+	policy := d.retry
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	partPath := path + ".part"
+
+	var stats downloadStats
+	var lastErr error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(policy.backoff(attempt))
+		}
+		stats.attempts = attempt
+
+		resumed, err := d.fetchOnce(url, partPath, header)
+		stats.resumed = stats.resumed || resumed
+		if err == nil {
+			lastErr = nil
+			break
+		}
+		lastErr = err
+		var perm permanentError
+		if errors.As(err, &perm) {
+			break
+		}
+	}
+	if lastErr != nil {
+		return "", stats, lastErr
+	}
+
+	if err := os.Rename(partPath, path); err != nil {
+		return "", stats, fmt.Errorf("failed to finalize download: %w", err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		stats.bytes = info.Size()
+	}
+	if !withHash {
+		return "", stats, nil
+	}
+	checksum, err := d.calculateSHA256(path)
+	if err != nil {
+		return "", stats, err
+	}
+	return checksum, stats, nil
+}
+
+// fetchOnce makes one request for url, appending to partPath when it
+// already holds data and the server honours the range request.
+func (d *LibraryDownloader) fetchOnce(url, partPath string, header http.Header) (resumed bool, err error) {
+	var offset int64
+	if info, statErr := os.Stat(partPath); statErr == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, permanentError{fmt.Errorf("failed to create request: %w", err)}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", d.userAgent)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.httpClient(downloadTimeout).Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close() // Ignore error in defer
+	}()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	total := resp.ContentLength
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		resumed = true
+		flags |= os.O_APPEND
+		total = contentRangeTotal(resp.Header.Get("Content-Range"))
+	case resp.StatusCode == http.StatusOK:
+		// Full body: the server ignored the range or there was nothing to resume
+		offset = 0
+		flags |= os.O_TRUNC
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is unusable; start over on the next attempt
+		_ = os.Remove(partPath)
+		return false, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return false, fmt.Errorf("download failed with status %d", resp.StatusCode)
+	default:
+		return false, permanentError{fmt.Errorf("download failed with status %d", resp.StatusCode)}
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return resumed, permanentError{fmt.Errorf("failed to create file: %w", err)}
+	}
+	defer func() {
+		_ = out.Close() // Ignore error in defer
+	}()
+
+	var w io.Writer = out
+	if d.progress != nil {
+		w = &progressWriter{w: out, received: offset, total: total, fn: d.progress}
+		d.progress(offset, total)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return resumed, fmt.Errorf("failed to write file: %w", err)
+	}
+	return resumed, nil
+}
+
+// contentRangeTotal parses the total size of "bytes 100-199/200", or -1.
+func contentRangeTotal(header string) int64 {
+	_, total, ok := strings.Cut(header, "/")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// progressWriter reports the bytes written through it.
+type progressWriter struct {
+	w        io.Writer
+	received int64
+	total    int64
+	fn       DownloadProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.received += int64(n)
+	p.fn(p.received, p.total)
+	return n, err
+}
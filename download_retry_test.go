@@ -0,0 +1,108 @@
+package gollama
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type DownloadRetrySuite struct{ BaseSuite }
+
+var testArchive = bytes.Repeat([]byte("gollama"), 4096)
+
+func (s *DownloadRetrySuite) newDownloader() *LibraryDownloader {
+	d, err := NewLibraryDownloaderWithCacheDir(s.T().TempDir())
+	s.Require().NoError(err)
+	d.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2})
+	return d
+}
+
+func (s *DownloadRetrySuite) TestRetriesServerErrors() {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(testArchive)
+	}))
+	defer srv.Close()
+
+	d := s.newDownloader()
+	path := filepath.Join(d.cacheDir, "a.zip")
+	checksum, stats, err := d.fetch(srv.URL, path, true)
+	s.Require().NoError(err)
+	s.Equal(2, stats.attempts)
+	s.False(stats.resumed)
+	s.Equal(int64(len(testArchive)), stats.bytes)
+	s.NoError(d.verifySHA256(path, checksum))
+	s.NoFileExists(path + ".part")
+}
+
+func (s *DownloadRetrySuite) TestResumesInterruptedDownload() {
+	half := len(testArchive) / 2
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if len(ranges) == 1 {
+			// Promise the whole archive, send half of it and drop the connection
+			w.Header().Set("Content-Length", strconv.Itoa(len(testArchive)))
+			_, _ = w.Write(testArchive[:half])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", half, len(testArchive)-1, len(testArchive)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(testArchive[half:])
+	}))
+	defer srv.Close()
+
+	d := s.newDownloader()
+	var lastReceived, lastTotal int64
+	d.SetProgressCallback(func(received, total int64) { lastReceived, lastTotal = received, total })
+
+	path := filepath.Join(d.cacheDir, "b.zip")
+	_, stats, err := d.fetch(srv.URL, path, false)
+	s.Require().NoError(err)
+	s.True(stats.resumed)
+	s.Equal([]string{"", fmt.Sprintf("bytes=%d-", half)}, ranges)
+	s.Equal(int64(len(testArchive)), lastReceived)
+	s.Equal(int64(len(testArchive)), lastTotal)
+
+	data, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	s.Equal(testArchive, data)
+}
+
+func (s *DownloadRetrySuite) TestClientErrorsAreNotRetried() {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	d := s.newDownloader()
+	_, stats, err := d.fetch(srv.URL, filepath.Join(d.cacheDir, "c.zip"), false)
+	s.Error(err)
+	s.Equal(1, stats.attempts)
+	s.Equal(int32(1), requests.Load())
+}
+
+func (s *DownloadRetrySuite) TestBackoff() {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+	s.Equal(time.Second, p.backoff(2))
+	s.Equal(4*time.Second, p.backoff(4))
+	s.Equal(5*time.Second, p.backoff(6))
+}
+
+func TestDownloadRetrySuite(t *testing.T) { suite.Run(t, new(DownloadRetrySuite)) }
@@ -9,10 +9,10 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -69,6 +69,14 @@ type DownloadResult struct {
 	SHA256Sum    string
 	ExtractedDir string
 	Embedded     bool
+	// Attempts is the number of requests made for the archive; 0 when no
+	// download was needed
+	Attempts int
+	// Resumed is set when an interrupted download continued from the bytes
+	// already received
+	Resumed bool
+	// Bytes is the size of the downloaded archive
+	Bytes int64
 }
 
 // VariantAsset represents a single variant asset for a platform
@@ -101,6 +109,11 @@ type LibraryDownloader struct {
 	cacheDir  string
 	userAgent string
 	client    *github.Client
+	retry     RetryPolicy
+	progress  DownloadProgressFunc
+	mirror    string
+	offline   bool
+	transport http.RoundTripper
 }
 
 // NewLibraryDownloader creates a new library downloader instance
@@ -116,47 +129,57 @@ func NewLibraryDownloaderWithCacheDir(customCacheDir string) (*LibraryDownloader
 	if customCacheDir != "" {
 		cacheDir = customCacheDir
 	} else {
-		// Check for environment variable
-		if envCacheDir := os.Getenv("GOLLAMA_CACHE_DIR"); envCacheDir != "" {
-			cacheDir = filepath.Join(envCacheDir, "libs")
-		} else {
-			// Try user cache directory first
-			userCacheDir, err := os.UserCacheDir()
-			if err == nil {
-				cacheDir = filepath.Join(userCacheDir, "gollama", "libs")
-			} else {
-				// Fallback to temp directory
-				cacheDir = filepath.Join(os.TempDir(), "gollama", "libs")
-			}
-		}
+		cacheDir = defaultLibraryCacheDir()
 	}
 
-	if err := os.MkdirAll(cacheDir, 0750); err != nil {
+	if err := os.MkdirAll(longPath(cacheDir), 0750); err != nil {
 		return nil, fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
-	// Create go-github client with optional authentication
-	var client *github.Client
-	token := os.Getenv("GITHUB_TOKEN")
-	if token != "" {
-		// Authenticated client using GITHUB_TOKEN
-		httpClient := &http.Client{Timeout: downloadTimeout}
-		client = github.NewClient(httpClient).WithAuthToken(token)
-	} else {
-		// Unauthenticated client
-		httpClient := &http.Client{Timeout: downloadTimeout}
-		client = github.NewClient(httpClient)
-	}
-
-	return &LibraryDownloader{
+	d := &LibraryDownloader{
 		cacheDir:  cacheDir,
 		userAgent: userAgent,
-		client:    client,
-	}, nil
+		retry:     DefaultRetryPolicy(),
+	}
+	if err := d.configureNetwork(globalConfig); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// defaultLibraryCacheDir resolves the library cache directory used when no
+// explicit directory is configured. Resolution order:
+// 1) $GOLLAMA_CACHE_DIR/libs
+// 2) the machine-wide cache (%ProgramData% on Windows) when Config.UseSystemCache is set
+// 3) the per-user cache directory
+// 4) the machine-wide cache, for services and scheduled tasks running without a user profile
+// 5) the temp directory
+func defaultLibraryCacheDir() string {
+	if envCacheDir := os.Getenv("GOLLAMA_CACHE_DIR"); envCacheDir != "" {
+		return filepath.Join(envCacheDir, "libs")
+	}
+
+	systemDir := systemCacheBaseDir()
+	if globalConfig != nil && globalConfig.UseSystemCache && systemDir != "" {
+		return filepath.Join(systemDir, "gollama", "libs")
+	}
+
+	if userCacheDir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(userCacheDir, "gollama", "libs")
+	}
+
+	if systemDir != "" {
+		return filepath.Join(systemDir, "gollama", "libs")
+	}
+
+	return filepath.Join(os.TempDir(), "gollama", "libs")
 }
 
 // GetLatestRelease fetches the latest release information from GitHub
 func (d *LibraryDownloader) GetLatestRelease() (*ReleaseInfo, error) {
+	if err := d.checkOnline("look up the latest llama.cpp release"); err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
 	defer cancel()
 
@@ -170,11 +193,18 @@ func (d *LibraryDownloader) GetLatestRelease() (*ReleaseInfo, error) {
 
 // GetReleaseByTag fetches release information for a specific tag
 func (d *LibraryDownloader) GetReleaseByTag(tag string) (*ReleaseInfo, error) {
+	if err := d.checkOnline("download llama.cpp " + tag); err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
 	defer cancel()
 
 	release, _, err := d.client.Repositories.GetReleaseByTag(ctx, "ggml-org", "llama.cpp", tag)
 	if err != nil {
+		if d.mirror != "" {
+			// The mirror may be reachable where api.github.com is not
+			return d.mirrorRelease(tag), nil
+		}
 		return nil, fmt.Errorf("failed to fetch release info: %w (%s)", err, tag)
 	}
 
@@ -183,9 +213,13 @@ func (d *LibraryDownloader) GetReleaseByTag(tag string) (*ReleaseInfo, error) {
 
 // GetPlatformAssetPattern returns the asset name pattern for the current platform
 func (d *LibraryDownloader) GetPlatformAssetPattern() (string, error) {
-	goos := runtime.GOOS
-	goarch := runtime.GOARCH
+	return d.GetPlatformAssetPatternForPlatform(runtime.GOOS, runtime.GOARCH)
+}
 
+// GetAssetPatternForBackend returns the asset name pattern of the build of
+// a backend for a platform. It fails with ErrUnsupportedPlatform when
+// llama.cpp publishes no such build.
+func (d *LibraryDownloader) GetAssetPatternForBackend(goos, goarch string, backend LlamaGpuBackend) (string, error) {
 	// Convert Go arch to llama.cpp naming convention
 	var arch string
 	switch goarch {
@@ -197,86 +231,102 @@ func (d *LibraryDownloader) GetPlatformAssetPattern() (string, error) {
 		return "", fmt.Errorf("unsupported architecture: %s", goarch)
 	}
 
+	var variant string
 	switch goos {
 	case "darwin":
-		return fmt.Sprintf("llama-.*-bin-macos-%s.zip", arch), nil
+		// A single build covering Metal and the CPU
+		if backend == LLAMA_GPU_BACKEND_METAL || backend == LLAMA_GPU_BACKEND_CPU {
+			return fmt.Sprintf("llama-.*-bin-macos-%s.zip", arch), nil
+		}
 	case "linux":
-		// Auto-detect available GPU backends
-		return d.getLinuxVariantPattern(arch), nil
+		switch backend {
+		case LLAMA_GPU_BACKEND_CPU:
+			variant = ""
+		case LLAMA_GPU_BACKEND_CUDA:
+			variant = "cuda-.*-"
+		case LLAMA_GPU_BACKEND_HIP:
+			variant = "hip-.*-"
+		case LLAMA_GPU_BACKEND_VULKAN:
+			variant = "vulkan-"
+		case LLAMA_GPU_BACKEND_SYCL:
+			variant = "sycl-"
+		default:
+			return "", fmt.Errorf("%w: no %s build for %s/%s", ErrUnsupportedPlatform, backend, goos, goarch)
+		}
+		return fmt.Sprintf("llama-.*-bin-ubuntu-%s%s.zip", variant, arch), nil
 	case "windows":
-		// Auto-detect available GPU backends
-		return d.getWindowsVariantPattern(arch), nil
+		switch backend {
+		case LLAMA_GPU_BACKEND_CPU:
+			variant = "cpu-"
+		case LLAMA_GPU_BACKEND_CUDA:
+			variant = "cuda-.*-"
+		case LLAMA_GPU_BACKEND_HIP:
+			variant = "hip-.*-"
+		case LLAMA_GPU_BACKEND_VULKAN:
+			variant = "vulkan-"
+		case LLAMA_GPU_BACKEND_OPENCL:
+			variant = "opencl-.*-"
+		case LLAMA_GPU_BACKEND_SYCL:
+			variant = "sycl-"
+		default:
+			return "", fmt.Errorf("%w: no %s build for %s/%s", ErrUnsupportedPlatform, backend, goos, goarch)
+		}
+		return fmt.Sprintf("llama-.*-bin-win-%s%s.zip", variant, arch), nil
 	default:
 		return "", fmt.Errorf("unsupported operating system: %s", goos)
 	}
+	return "", fmt.Errorf("%w: no %s build for %s/%s", ErrUnsupportedPlatform, backend, goos, goarch)
 }
 
-// getLinuxVariantPattern detects and returns the best GPU variant pattern for Linux
-func (d *LibraryDownloader) getLinuxVariantPattern(arch string) string {
-	// Priority order: CUDA > HIP > Vulkan > SYCL > CPU
-
-	// Check for CUDA
-	if d.hasCommand("nvcc") {
-		// Try CUDA variant first
-		return fmt.Sprintf("llama-.*-bin-ubuntu-cuda-.*-%s.zip", arch)
-	}
-
-	// Check for HIP/ROCm
-	if d.hasCommand("hipconfig") {
-		return fmt.Sprintf("llama-.*-bin-ubuntu-hip-.*-%s.zip", arch)
+// GetPlatformAssetPatterns returns the asset patterns to try in order for a
+// platform: one per backend of Config.PreferredBackend that has a build, or
+// the detected variant when no backend is preferred.
+func (d *LibraryDownloader) GetPlatformAssetPatterns(goos, goarch string) ([]string, error) {
+	chain := preferredGpuBackends()
+	if len(chain) == 0 {
+		pattern, err := d.detectAssetPattern(goos, goarch)
+		if err != nil {
+			return nil, err
+		}
+		return []string{pattern}, nil
 	}
 
-	// Check for Vulkan
-	if d.hasCommand("vulkaninfo") {
-		return fmt.Sprintf("llama-.*-bin-ubuntu-vulkan-%s.zip", arch)
+	var patterns []string
+	var lastErr error
+	for _, backend := range chain {
+		pattern, err := d.GetAssetPatternForBackend(goos, goarch, backend)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !slices.Contains(patterns, pattern) {
+			patterns = append(patterns, pattern)
+		}
 	}
-
-	// Check for SYCL (Intel oneAPI)
-	if d.hasCommand("sycl-ls") {
-		return fmt.Sprintf("llama-.*-bin-ubuntu-sycl-%s.zip", arch)
+	if len(patterns) == 0 {
+		return nil, lastErr
 	}
-
-	// Fallback to CPU
-	return fmt.Sprintf("llama-.*-bin-ubuntu-%s.zip", arch)
+	return patterns, nil
 }
 
-// getWindowsVariantPattern detects and returns the best GPU variant pattern for Windows
-func (d *LibraryDownloader) getWindowsVariantPattern(arch string) string {
-	// Priority order: CUDA > HIP > Vulkan > OpenCL > SYCL > CPU
-
-	// Check for CUDA
-	if d.hasCommand("nvcc") {
-		return fmt.Sprintf("llama-.*-bin-win-cuda-.*-%s.zip", arch)
-	}
-
-	// Check for HIP (Windows)
-	if d.hasCommand("hipconfig") {
-		return fmt.Sprintf("llama-.*-bin-win-hip-.*-%s.zip", arch)
-	}
-
-	// Check for Vulkan
-	if d.hasCommand("vulkaninfo") {
-		return fmt.Sprintf("llama-.*-bin-win-vulkan-%s.zip", arch)
-	}
-
-	// Check for OpenCL (especially for ARM64/Adreno)
-	if d.hasCommand("clinfo") || arch == "arm64" {
-		return fmt.Sprintf("llama-.*-bin-win-opencl-.*-%s.zip", arch)
+// detectAssetPattern picks the variant of the first GPU backend found by
+// ProbeGpuBackends that has a build for the platform. Other platforms than
+// the running one cannot be probed and get their default build.
+func (d *LibraryDownloader) detectAssetPattern(goos, goarch string) (string, error) {
+	if goos == runtime.GOOS && goarch == runtime.GOARCH {
+		for _, probe := range ProbeGpuBackends() {
+			if pattern, err := d.GetAssetPatternForBackend(goos, goarch, probe.Backend); err == nil {
+				return pattern, nil
+			}
+		}
 	}
 
-	// Check for SYCL (Intel oneAPI)
-	if d.hasCommand("sycl-ls") {
-		return fmt.Sprintf("llama-.*-bin-win-sycl-%s.zip", arch)
+	backend := bundledBackend(goos)
+	// The OpenCL (Adreno) build is the GPU build for Windows on ARM
+	if goos == "windows" && goarch == "arm64" {
+		backend = LLAMA_GPU_BACKEND_OPENCL
 	}
-
-	// Fallback to CPU
-	return fmt.Sprintf("llama-.*-bin-win-cpu-%s.zip", arch)
-}
-
-// hasCommand checks if a command is available in PATH
-func (d *LibraryDownloader) hasCommand(command string) bool {
-	_, err := exec.LookPath(command)
-	return err == nil
+	return d.GetAssetPatternForBackend(goos, goarch, backend)
 }
 
 // FindAssetByPattern finds an asset that matches the given pattern
@@ -295,7 +345,7 @@ func (d *LibraryDownloader) FindAssetByPattern(release *ReleaseInfo, pattern str
 			assetName = *asset.Name
 		}
 		if asset.BrowserDownloadURL != nil {
-			downloadURL = *asset.BrowserDownloadURL
+			downloadURL = d.assetURL(release, asset)
 		}
 
 		if regex.MatchString(assetName) {
@@ -360,7 +410,7 @@ func (d *LibraryDownloader) FindAllVariantAssets(release *ReleaseInfo, goos, goa
 			assetName = *asset.Name
 		}
 		if asset.BrowserDownloadURL != nil {
-			downloadURL = *asset.BrowserDownloadURL
+			downloadURL = d.assetURL(release, asset)
 		}
 
 		// Check CPU-only variant first (simplest pattern)
@@ -401,6 +451,7 @@ func (d *LibraryDownloader) DownloadAndExtract(downloadURL, filename string) (st
 
 	// Check if already extracted
 	if d.isLibraryReady(targetDir) {
+		countMetric(&metrics.cacheHits, 1)
 		return targetDir, nil
 	}
 
@@ -409,6 +460,7 @@ func (d *LibraryDownloader) DownloadAndExtract(downloadURL, filename string) (st
 	if err := d.downloadFile(downloadURL, archivePath); err != nil {
 		return "", fmt.Errorf("failed to download %s: %w", filename, err)
 	}
+	countMetric(&metrics.downloads, 1)
 
 	// Extract the archive
 	if err := d.extractZip(archivePath, targetDir); err != nil {
@@ -423,70 +475,64 @@ func (d *LibraryDownloader) DownloadAndExtract(downloadURL, filename string) (st
 
 // DownloadAndExtractWithChecksum downloads and extracts the library archive with checksum verification
 func (d *LibraryDownloader) DownloadAndExtractWithChecksum(downloadURL, filename, expectedChecksum string) (string, string, error) {
+	targetDir, checksum, _, err := d.downloadAndExtractWithChecksum(downloadURL, filename, expectedChecksum)
+	return targetDir, checksum, err
+}
+
+// downloadAndExtractWithChecksum is DownloadAndExtractWithChecksum that
+// also reports how the archive was downloaded.
+func (d *LibraryDownloader) downloadAndExtractWithChecksum(downloadURL, filename, expectedChecksum string) (string, string, downloadStats, error) {
+	var stats downloadStats
+
 	// Create target directory for this release
 	targetDir := filepath.Join(d.cacheDir, strings.TrimSuffix(filename, ".zip"))
 
 	// Check if already extracted
 	if d.isLibraryReady(targetDir) {
+		countMetric(&metrics.cacheHits, 1)
 		// Calculate checksum of existing file if available
 		archivePath := filepath.Join(d.cacheDir, filename)
 		if _, err := os.Stat(archivePath); err == nil {
 			checksum, _ := d.calculateSHA256(archivePath)
-			return targetDir, checksum, nil
+			return targetDir, checksum, stats, nil
 		}
-		return targetDir, "", nil
+		return targetDir, "", stats, nil
 	}
 
 	// Download the archive with checksum calculation
 	archivePath := filepath.Join(d.cacheDir, filename)
-	checksum, err := d.downloadFileWithChecksum(downloadURL, archivePath)
+	checksum, stats, err := d.fetch(downloadURL, archivePath, true)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to download %s: %w", filename, err)
+		return "", "", stats, fmt.Errorf("failed to download %s: %w", filename, err)
 	}
+	countMetric(&metrics.downloads, 1)
 
 	// Verify checksum if provided
 	if err := d.verifySHA256(archivePath, expectedChecksum); err != nil {
 		// Remove corrupted file
 		_ = os.Remove(archivePath)
-		return "", "", fmt.Errorf("checksum verification failed for %s: %w", filename, err)
+		return "", "", stats, fmt.Errorf("checksum verification failed for %s: %w", filename, err)
 	}
 
 	// Extract the archive
 	if err := d.extractZip(archivePath, targetDir); err != nil {
-		return "", "", fmt.Errorf("failed to extract %s: %w", filename, err)
+		return "", "", stats, fmt.Errorf("failed to extract %s: %w", filename, err)
 	}
 
 	// Clean up the archive file
 	_ = os.Remove(archivePath)
 
-	return targetDir, checksum, nil
+	return targetDir, checksum, stats, nil
 }
 
-// GetPlatformAssetPatternForPlatform returns the asset name pattern for a specific platform
+// GetPlatformAssetPatternForPlatform returns the asset name pattern for a
+// specific platform: the first entry of GetPlatformAssetPatterns.
 func (d *LibraryDownloader) GetPlatformAssetPatternForPlatform(goos, goarch string) (string, error) {
-	// Convert Go arch to llama.cpp naming convention
-	var arch string
-	switch goarch {
-	case "amd64":
-		arch = "x64"
-	case "arm64":
-		arch = "arm64"
-	default:
-		return "", fmt.Errorf("unsupported architecture: %s", goarch)
-	}
-
-	switch goos {
-	case "darwin":
-		return fmt.Sprintf("llama-.*-bin-macos-%s.zip", arch), nil
-	case "linux":
-		// Auto-detect available GPU backends for Linux
-		return d.getLinuxVariantPattern(arch), nil
-	case "windows":
-		// Auto-detect available GPU backends for Windows
-		return d.getWindowsVariantPattern(arch), nil
-	default:
-		return "", fmt.Errorf("unsupported operating system: %s", goos)
+	patterns, err := d.GetPlatformAssetPatterns(goos, goarch)
+	if err != nil {
+		return "", err
 	}
+	return patterns[0], nil
 }
 
 // DownloadMultiplePlatforms downloads libraries for multiple platforms in parallel
@@ -577,6 +623,17 @@ func (d *LibraryDownloader) DownloadMultiplePlatforms(platforms []string, versio
 		}
 
 		targetDir := filepath.Join(d.cacheDir, strings.TrimSuffix(assetName, ".zip"))
+		var expected string
+		if !d.isLibraryReady(targetDir) {
+			if expected, err = d.trustedChecksum(release, assetName); err != nil {
+				results = append(results, DownloadResult{
+					Platform: platform,
+					Success:  false,
+					Error:    err,
+				})
+				continue
+			}
+		}
 		idx := len(results)
 		results = append(results, DownloadResult{Platform: platform})
 		tasks = append(tasks, DownloadTask{
@@ -584,7 +641,7 @@ func (d *LibraryDownloader) DownloadMultiplePlatforms(platforms []string, versio
 			AssetName:    assetName,
 			DownloadURL:  downloadURL,
 			TargetDir:    targetDir,
-			ExpectedSHA2: "",
+			ExpectedSHA2: expected,
 			ResultIndex:  idx,
 		})
 	}
@@ -635,6 +692,7 @@ func (d *LibraryDownloader) executeParallelDownloads(tasks []DownloadTask) ([]Do
 
 			// Check if already exists and ready
 			if d.isLibraryReady(t.TargetDir) {
+				countMetric(&metrics.cacheHits, 1)
 				result.Success = true
 				// Extract platform info from task
 				parts := strings.Split(t.Platform, "/")
@@ -655,7 +713,10 @@ func (d *LibraryDownloader) executeParallelDownloads(tasks []DownloadTask) ([]Do
 			}
 
 			// Download and extract with checksum
-			extractedDir, checksum, err := d.DownloadAndExtractWithChecksum(t.DownloadURL, t.AssetName, t.ExpectedSHA2)
+			extractedDir, checksum, stats, err := d.downloadAndExtractWithChecksum(t.DownloadURL, t.AssetName, t.ExpectedSHA2)
+			result.Attempts = stats.attempts
+			result.Resumed = stats.resumed
+			result.Bytes = stats.bytes
 			if err != nil {
 				result.Error = err
 				results[index] = result
@@ -691,85 +752,14 @@ func (d *LibraryDownloader) executeParallelDownloads(tasks []DownloadTask) ([]Do
 
 // downloadFile downloads a file from URL to the specified path
 func (d *LibraryDownloader) downloadFile(url, filepath string) error {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("User-Agent", d.userAgent)
-
-	// Use the HTTP client from go-github
-	httpClient := &http.Client{Timeout: downloadTimeout}
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
-	}
-	defer func() {
-		_ = resp.Body.Close() // Ignore error in defer
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
-	}
-
-	out, err := os.Create(filepath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer func() {
-		_ = out.Close() // Ignore error in defer
-	}()
-
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
-	}
-
-	return nil
+	_, _, err := d.fetch(url, filepath, false)
+	return err
 }
 
 // downloadFileWithChecksum downloads a file and calculates its SHA256 checksum
 func (d *LibraryDownloader) downloadFileWithChecksum(url, filepath string) (string, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("User-Agent", d.userAgent)
-
-	// Use a fresh HTTP client for file downloads
-	httpClient := &http.Client{Timeout: downloadTimeout}
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to download file: %w", err)
-	}
-	defer func() {
-		_ = resp.Body.Close() // Ignore error in defer
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("download failed with status %d", resp.StatusCode)
-	}
-
-	out, err := os.Create(filepath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
-	}
-	defer func() {
-		_ = out.Close() // Ignore error in defer
-	}()
-
-	// Create a hash writer that computes SHA256 while writing
-	hash := sha256.New()
-	multiWriter := io.MultiWriter(out, hash)
-
-	_, err = io.Copy(multiWriter, resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
-	}
-
-	// Return the hexadecimal representation of the hash
-	return hex.EncodeToString(hash.Sum(nil)), nil
+	checksum, _, err := d.fetch(url, filepath, true)
+	return checksum, err
 }
 
 // calculateSHA256 calculates the SHA256 checksum of a file
@@ -802,8 +792,8 @@ func (d *LibraryDownloader) verifySHA256(filepath, expectedChecksum string) erro
 		return err
 	}
 
-	if actualChecksum != expectedChecksum {
-		return fmt.Errorf("checksum mismatch: expected %s, got %s", expectedChecksum, actualChecksum)
+	if !strings.EqualFold(actualChecksum, expectedChecksum) {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expectedChecksum, actualChecksum)
 	}
 
 	return nil
@@ -820,7 +810,7 @@ func (d *LibraryDownloader) extractZip(src, dest string) error {
 	}()
 
 	// Create destination directory
-	if err := os.MkdirAll(dest, 0750); err != nil {
+	if err := os.MkdirAll(longPath(dest), 0750); err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
@@ -832,7 +822,7 @@ func (d *LibraryDownloader) extractZip(src, dest string) error {
 		}
 
 		// #nosec G305 - Path is validated by isValidPath function above
-		path := filepath.Join(dest, file.Name)
+		path := longPath(filepath.Join(dest, file.Name))
 
 		if file.FileInfo().IsDir() {
 			if err := os.MkdirAll(path, file.FileInfo().Mode()); err != nil {
@@ -1020,6 +1010,7 @@ func (d *LibraryDownloader) DownloadAllVariants(release *ReleaseInfo, goos, goar
 
 			// Check if already extracted
 			if d.isLibraryReady(targetDir) {
+				countMetric(&metrics.cacheHits, 1)
 				variantInfo.Success = true
 				variantInfo.ExtractedDir = targetDir
 
@@ -1033,7 +1024,14 @@ func (d *LibraryDownloader) DownloadAllVariants(release *ReleaseInfo, goos, goar
 			}
 
 			// Download and extract with checksum
-			extractedDir, checksum, err := d.DownloadAndExtractWithChecksum(v.DownloadURL, v.AssetName, "")
+			expected, err := d.trustedChecksum(release, v.AssetName)
+			if err != nil {
+				variantInfo.Error = err
+				variantInfo.Success = false
+				result.Variants[index] = variantInfo
+				return
+			}
+			extractedDir, checksum, err := d.DownloadAndExtractWithChecksum(v.DownloadURL, v.AssetName, expected)
 			if err != nil {
 				variantInfo.Error = err
 				variantInfo.Success = false
@@ -1,8 +1,10 @@
 package gollama
 
 import (
+	"archive/zip"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -87,6 +89,73 @@ func (s *CacheDirSuite) TestPathTraversalInCacheDirectory() {
 	}
 }
 
+func (s *CacheDirSuite) TestEnvironmentVariableTakesPrecedenceOverSystemCache() {
+	tmpDir := s.T().TempDir()
+	s.Require().NoError(os.Setenv("GOLLAMA_CACHE_DIR", tmpDir))
+
+	config := DefaultConfig()
+	config.UseSystemCache = true
+	_ = SetGlobalConfig(config)
+
+	assert.Equal(s.T(), filepath.Join(tmpDir, "libs"), defaultLibraryCacheDir())
+}
+
+func (s *CacheDirSuite) TestSystemCacheFromEnvironment() {
+	s.Require().NoError(os.Setenv("GOLLAMA_USE_SYSTEM_CACHE", "true"))
+	config := LoadConfigFromEnv()
+	assert.True(s.T(), config.UseSystemCache)
+}
+
+func (s *CacheDirSuite) TestSystemCacheDirectory() {
+	_ = os.Unsetenv("GOLLAMA_CACHE_DIR")
+
+	config := DefaultConfig()
+	config.UseSystemCache = true
+	_ = SetGlobalConfig(config)
+
+	cacheDir := defaultLibraryCacheDir()
+	if base := systemCacheBaseDir(); base != "" {
+		assert.Equal(s.T(), filepath.Join(base, "gollama", "libs"), cacheDir)
+	} else {
+		assert.Contains(s.T(), cacheDir, "gollama")
+	}
+}
+
+func (s *CacheDirSuite) TestUnicodeCacheDirectory() {
+	cacheDir := filepath.Join(s.T().TempDir(), "Jürgen Müller", "ユーザー", "gollama", "libs")
+
+	downloader, err := NewLibraryDownloaderWithCacheDir(cacheDir)
+	s.Require().NoError(err)
+	s.Equal(cacheDir, downloader.GetCacheDir())
+	s.DirExists(cacheDir)
+}
+
+func (s *CacheDirSuite) TestExtractIntoLongUnicodeCacheDirectory() {
+	// Well past MAX_PATH (260) on Windows once the archive entries are added
+	dest := filepath.Join(s.T().TempDir(), "Jürgen Müller")
+	for i := 0; i < 6; i++ {
+		dest = filepath.Join(dest, strings.Repeat("長いディレクトリ", 4))
+	}
+	downloader, err := NewLibraryDownloaderWithCacheDir(dest)
+	s.Require().NoError(err)
+
+	archive := filepath.Join(s.T().TempDir(), "libs.zip")
+	f, err := os.Create(archive)
+	s.Require().NoError(err)
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("build/bin/" + strings.Repeat("nested/", 10) + "libllama.so")
+	s.Require().NoError(err)
+	_, err = w.Write([]byte("library"))
+	s.Require().NoError(err)
+	s.Require().NoError(zw.Close())
+	s.Require().NoError(f.Close())
+
+	s.Require().NoError(downloader.extractZip(archive, dest))
+	data, err := os.ReadFile(filepath.Join(dest, "build", "bin", strings.Repeat("nested"+string(filepath.Separator), 10)+"libllama.so"))
+	s.Require().NoError(err)
+	s.Equal("library", string(data))
+}
+
 func TestCacheDirSuite(t *testing.T) {
 	suite.Run(t, new(CacheDirSuite))
 }
@@ -0,0 +1,24 @@
+// Package embedded bundles llama.cpp libraries into the binary.
+//
+// Built with the gollama_embed tag, the package embeds its libs directory and
+// registers it with gollama.RegisterEmbeddedLibraries when imported; on
+// first use the libraries for the running platform are extracted to the
+// library cache and loaded from there, so the binary needs neither network
+// access nor libraries installed next to it. The tag also drops the
+// libraries bundled with the gollama module itself.
+//
+// Populate the libs directory for the platforms to ship, then build:
+//
+//	go run github.com/dianlight/gollama.cpp/cmd/gollama-download \
+//		-download-all -copy-libs -libs-dir path/to/embedded/libs
+//	go build -tags gollama_embed ./...
+//
+// and import the package for its side effect:
+//
+//	import _ "github.com/dianlight/gollama.cpp/embedded"
+//
+// A module cannot write into its dependencies, so applications usually copy
+// this package (embed.go and the libs directory) into their own module and
+// import that copy instead. Only the llama.cpp build gollama.LlamaCppBuild
+// is looked up. Without the tag the package is empty.
+package embedded
@@ -0,0 +1,26 @@
+//go:build gollama_embed
+
+package embedded
+
+import (
+	"embed"
+	"io/fs"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+// libFiles holds the <goos>_<goarch>_<version> directories written by
+// gollama-download -copy-libs.
+//
+//go:embed all:libs
+var libFiles embed.FS
+
+func init() {
+	libs, err := fs.Sub(libFiles, "libs")
+	if err != nil {
+		panic(err)
+	}
+	if err := gollama.RegisterEmbeddedLibraries(libs); err != nil {
+		panic(err)
+	}
+}
@@ -1,26 +1,85 @@
-//go:build !embedallowed_no
-
 package gollama
 
 import (
-	"embed"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 )
 
-// embeddedLibFiles contains all files under the libs directory that should be bundled into the binary.
-// The directory is expected to contain platform-specific folders such as darwin_amd64_<version>/,
-// each holding the shared libraries for that platform.
+var (
+	// registeredEmbeddedLibs are the library bundles passed to
+	// RegisterEmbeddedLibraries, searched before the built-in one
+	registeredEmbeddedLibs   []fs.FS
+	registeredEmbeddedLibsMu sync.RWMutex
+
+	embeddedCopyMu sync.Mutex
+)
+
+// RegisterEmbeddedLibraries adds a bundle of llama.cpp libraries compiled
+// into the binary, laid out like the libs directory written by
+// `gollama-download -copy-libs`: one <goos>_<goarch>_<version> directory per
+// platform. When the library is loaded for LlamaCppBuild, the bundle for the
+// running platform is extracted to the cache and used before ./libs, cached
+// downloads or the network.
 //
-//go:embed libs/**
-var embeddedLibFiles embed.FS
+// It is meant to be called from the init function of a package that embeds
+// the libraries; see the embedded subpackage. Bundles registered later take
+// precedence, and all of them take precedence over the libraries of this
+// module.
+func RegisterEmbeddedLibraries(libs fs.FS) error {
+	if libs == nil {
+		return fmt.Errorf("%w: nil library bundle", ErrInvalidParameter)
+	}
+	registeredEmbeddedLibsMu.Lock()
+	defer registeredEmbeddedLibsMu.Unlock()
+	registeredEmbeddedLibs = append([]fs.FS{libs}, registeredEmbeddedLibs...)
+	return nil
+}
 
-var embeddedCopyMu sync.Mutex
+// EmbeddedLibraryPlatforms lists the platforms ("<goos>/<goarch>") with
+// embedded libraries for LlamaCppBuild.
+func EmbeddedLibraryPlatforms() []string {
+	suffix := "_" + LlamaCppBuild
+	seen := make(map[string]bool)
+	var platforms []string
+	for _, libs := range embeddedLibrarySources() {
+		entries, err := fs.ReadDir(libs, ".")
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name, ok := strings.CutSuffix(e.Name(), suffix)
+			if !e.IsDir() || !ok {
+				continue
+			}
+			goos, goarch, ok := strings.Cut(name, "_")
+			if !ok || seen[goos+"/"+goarch] {
+				continue
+			}
+			seen[goos+"/"+goarch] = true
+			platforms = append(platforms, goos+"/"+goarch)
+		}
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+// embeddedLibrarySources returns the registered bundles followed by the
+// built-in one.
+func embeddedLibrarySources() []fs.FS {
+	registeredEmbeddedLibsMu.RLock()
+	sources := append([]fs.FS(nil), registeredEmbeddedLibs...)
+	registeredEmbeddedLibsMu.RUnlock()
+	if builtin := builtinEmbeddedLibs(); builtin != nil {
+		sources = append(sources, builtin)
+	}
+	return sources
+}
 
 // embeddedPlatformDirName returns the directory name that stores the embedded libraries for the
 // given platform and architecture.
@@ -28,23 +87,22 @@ func embeddedPlatformDirName(goos, goarch string) string {
 	return fmt.Sprintf("%s_%s_%s", goos, goarch, LlamaCppBuild)
 }
 
-// embeddedPlatformFSPath returns the filesystem path used inside the embedded FS for the platform.
-func embeddedPlatformFSPath(goos, goarch string) string {
-	return filepath.ToSlash(filepath.Join("libs", embeddedPlatformDirName(goos, goarch)))
+// embeddedLibrariesFor returns the first bundle holding libraries for the
+// platform, or nil.
+func embeddedLibrariesFor(goos, goarch string) fs.FS {
+	dir := embeddedPlatformDirName(goos, goarch)
+	for _, libs := range embeddedLibrarySources() {
+		if info, err := fs.Stat(libs, dir); err == nil && info.IsDir() {
+			return libs
+		}
+	}
+	return nil
 }
 
 // hasEmbeddedLibraryForPlatform returns true if the embedded filesystem contains a library bundle
 // for the requested platform/arch pair.
 func hasEmbeddedLibraryForPlatform(goos, goarch string) bool {
-	path := embeddedPlatformFSPath(goos, goarch)
-	if path == "" {
-		return false
-	}
-
-	if _, err := fs.Stat(embeddedLibFiles, path); err != nil {
-		return false
-	}
-	return true
+	return embeddedLibrariesFor(goos, goarch) != nil
 }
 
 // extractEmbeddedLibrariesTo copies the embedded libraries for the requested platform/arch pair to
@@ -54,15 +112,11 @@ func extractEmbeddedLibrariesTo(dest, goos, goarch string) error {
 		return errors.New("destination path cannot be empty")
 	}
 
-	platformPath := embeddedPlatformFSPath(goos, goarch)
-	if platformPath == "" {
-		return fmt.Errorf("invalid platform %s/%s", goos, goarch)
-	}
-
-	// Ensure the platform exists in the embedded filesystem.
-	if !hasEmbeddedLibraryForPlatform(goos, goarch) {
+	libs := embeddedLibrariesFor(goos, goarch)
+	if libs == nil {
 		return fmt.Errorf("embedded libraries not available for %s/%s", goos, goarch)
 	}
+	platformPath := embeddedPlatformDirName(goos, goarch)
 
 	embeddedCopyMu.Lock()
 	defer embeddedCopyMu.Unlock()
@@ -74,13 +128,12 @@ func extractEmbeddedLibrariesTo(dest, goos, goarch string) error {
 		return fmt.Errorf("failed to create destination %s: %w", dest, err)
 	}
 
-	return fs.WalkDir(embeddedLibFiles, platformPath, func(path string, d fs.DirEntry, walkErr error) error {
+	return fs.WalkDir(libs, platformPath, func(p string, d fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
 
-		rel := strings.TrimPrefix(path, platformPath)
-		rel = strings.TrimPrefix(rel, "/")
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, platformPath), "/")
 		if rel == "" {
 			return nil
 		}
@@ -94,9 +147,9 @@ func extractEmbeddedLibrariesTo(dest, goos, goarch string) error {
 			return nil
 		}
 
-		data, err := fs.ReadFile(embeddedLibFiles, path)
+		data, err := fs.ReadFile(libs, p)
 		if err != nil {
-			return fmt.Errorf("failed to read embedded file %s: %w", path, err)
+			return fmt.Errorf("failed to read embedded file %s: %w", p, err)
 		}
 
 		if err := os.WriteFile(targetPath, data, 0o600); err != nil {
@@ -0,0 +1,24 @@
+//go:build !embedallowed_no && !gollama_embed
+
+package gollama
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// embeddedLibFiles contains all files under the libs directory that should be bundled into the binary.
+// The directory is expected to contain platform-specific folders such as darwin_amd64_<version>/,
+// each holding the shared libraries for that platform.
+//
+//go:embed libs/**
+var embeddedLibFiles embed.FS
+
+// builtinEmbeddedLibs returns the libraries bundled with the module.
+func builtinEmbeddedLibs() fs.FS {
+	libs, err := fs.Sub(embeddedLibFiles, "libs")
+	if err != nil {
+		return nil
+	}
+	return libs
+}
@@ -0,0 +1,12 @@
+//go:build embedallowed_no || gollama_embed
+
+package gollama
+
+import "io/fs"
+
+// builtinEmbeddedLibs returns nil: the embedallowed_no tag disables the
+// bundled libraries, and gollama_embed replaces them with the ones passed to
+// RegisterEmbeddedLibraries.
+func builtinEmbeddedLibs() fs.FS {
+	return nil
+}
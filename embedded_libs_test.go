@@ -0,0 +1,66 @@
+package gollama
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type EmbeddedLibsSuite struct {
+	BaseSuite
+	savedLibs []fs.FS
+}
+
+func (s *EmbeddedLibsSuite) SetupTest() {
+	s.BaseSuite.SetupTest()
+	registeredEmbeddedLibsMu.Lock()
+	s.savedLibs = registeredEmbeddedLibs
+	registeredEmbeddedLibsMu.Unlock()
+}
+
+func (s *EmbeddedLibsSuite) TearDownTest() {
+	registeredEmbeddedLibsMu.Lock()
+	registeredEmbeddedLibs = s.savedLibs
+	registeredEmbeddedLibsMu.Unlock()
+	s.BaseSuite.TearDownTest()
+}
+
+func (s *EmbeddedLibsSuite) TestRegisterEmbeddedLibraries() {
+	s.ErrorIs(RegisterEmbeddedLibraries(nil), ErrInvalidParameter)
+	s.False(hasEmbeddedLibraryForPlatform("plan9", "amd64"))
+
+	dir := embeddedPlatformDirName("plan9", "amd64")
+	s.Require().NoError(RegisterEmbeddedLibraries(fstest.MapFS{
+		dir + "/libllama.so":     {Data: []byte("old")},
+		"plan9_amd64_b1/old.so":  {Data: []byte("other build")},
+		"README.md":              {Data: []byte("readme")},
+		dir + "/sub/libggml.so":  {Data: []byte("ggml")},
+		"plan9_arm64_b1/llama.s": {Data: []byte("other build")},
+	}))
+	s.Require().NoError(RegisterEmbeddedLibraries(fstest.MapFS{
+		dir + "/libllama.so": {Data: []byte("new")},
+	}))
+
+	s.True(hasEmbeddedLibraryForPlatform("plan9", "amd64"))
+	s.False(hasEmbeddedLibraryForPlatform("plan9", "arm64"))
+	s.Contains(EmbeddedLibraryPlatforms(), "plan9/amd64")
+	s.NotContains(EmbeddedLibraryPlatforms(), "plan9/arm64")
+
+	// The bundle registered last wins
+	dest := filepath.Join(s.T().TempDir(), "out")
+	s.Require().NoError(extractEmbeddedLibrariesTo(dest, "plan9", "amd64"))
+	data, err := os.ReadFile(filepath.Join(dest, "libllama.so"))
+	s.Require().NoError(err)
+	s.Equal("new", string(data))
+	s.NoFileExists(filepath.Join(dest, "sub", "libggml.so"))
+
+	s.Error(extractEmbeddedLibrariesTo(dest, "plan9", "arm64"))
+}
+
+func TestEmbeddedLibsSuite(t *testing.T) {
+	suite.Run(t, new(EmbeddedLibsSuite))
+}
@@ -0,0 +1,367 @@
+package gollama
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"unsafe"
+
+	"github.com/dianlight/gollama.cpp/internal/simd"
+)
+
+// EmbeddingSession wraps a context created with embeddings enabled and keeps
+// its KV cache from growing without bound across many Embed calls.
+//
+// Long embedding loops that reuse a single context used to accumulate
+// positions in the KV cache until the backend ran out of slots (on Metal this
+// surfaced as a SIGBUS after a few hundred inputs). The session tracks how
+// many cells are in use and either clears the memory after every input
+// (AutoClear, the default) or returns an error wrapping ErrContextFull before
+// a decode would overflow the context.
+//
+// Example usage:
+//
+//	ctxParams := gollama.Context_default_params()
+//	ctxParams.Embeddings = 1
+//	ctx, _ := gollama.Init_from_model(model, ctxParams)
+//	defer gollama.Free(ctx)
+//
+//	session, err := gollama.NewEmbeddingSession(model, ctx)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	for _, text := range texts {
+//		vec, err := session.Embed(text)
+//		...
+//	}
+type EmbeddingSession struct {
+	model LlamaModel
+	ctx   LlamaContext
+
+	nCtx    uint32
+	nBatch  uint32
+	nUbatch uint32
+	nSeqMax uint32
+	nEmbd   int32
+	pooling LlamaPoolingType
+
+	// AutoClear clears the context memory after each input. When disabled,
+	// inputs accumulate in the KV cache until Reset is called.
+	AutoClear bool
+	// Normalize applies L2 normalization to returned embeddings.
+	Normalize bool
+
+	mu   sync.Mutex
+	used uint32
+}
+
+// NewEmbeddingSession creates a session for the given model and context.
+// The context must have been created with Embeddings enabled.
+func NewEmbeddingSession(model LlamaModel, ctx LlamaContext) (*EmbeddingSession, error) {
+	if model == 0 {
+		return nil, ErrModelNotLoaded
+	}
+	if ctx == 0 {
+		return nil, ErrContextNotCreated
+	}
+
+	s := &EmbeddingSession{model: model, ctx: ctx, AutoClear: true}
+	if err := s.readSizes(); err != nil {
+		return nil, err
+	}
+	if s.nEmbd <= 0 {
+		return nil, fmt.Errorf("%w: model reports %d embedding dimensions", ErrUnsupportedModelType, s.nEmbd)
+	}
+
+	// Start from a clean cache so usage accounting matches the native state
+	Memory_clear(ctx, true)
+	return s, nil
+}
+
+// readSizes reads the sizes of the session's model and context, with the
+// library pinned and both handles checked.
+func (s *EmbeddingSession) readSizes() error {
+	release, err := acquireNativeCall("llama_n_ctx")
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := checkHandle(handleModel, uintptr(s.model)); err != nil {
+		return err
+	}
+	if err := checkHandle(handleContext, uintptr(s.ctx)); err != nil {
+		return err
+	}
+	if llamaModelNEmbd == nil || llamaNCtx == nil || llamaNBatch == nil || llamaNUbatch == nil ||
+		llamaNSeqMax == nil || llamaPoolingType == nil {
+		return fmt.Errorf("%w: embedding context functions", ErrFunctionNotFound)
+	}
+	s.nEmbd = llamaModelNEmbd(s.model)
+	s.nCtx = llamaNCtx(s.ctx)
+	s.nBatch = llamaNBatch(s.ctx)
+	s.nUbatch = llamaNUbatch(s.ctx)
+	s.nSeqMax = llamaNSeqMax(s.ctx)
+	s.pooling = llamaPoolingType(s.ctx)
+	return nil
+}
+
+// Embed tokenizes text and returns its embedding vector.
+func (s *EmbeddingSession) Embed(text string) ([]float32, error) {
+	tokens, err := Tokenize(s.model, text, true, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.EmbedTokens(tokens)
+}
+
+// EmbedTokens decodes the given tokens and returns their embedding vector.
+// When the context uses LLAMA_POOLING_TYPE_NONE the embedding of the last
+// token is returned.
+func (s *EmbeddingSession) EmbedTokens(tokens []LlamaToken) ([]float32, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: no tokens to embed", ErrInvalidParameter)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reserve(len(tokens)); err != nil {
+		return nil, err
+	}
+
+	batch := Batch_get_one(tokens)
+	if batch.NTokens == 0 {
+		return nil, errors.New("failed to create batch for embedding")
+	}
+
+	decodeErr := Decode(s.ctx, batch)
+	if decodeErr == nil {
+		s.used += uint32(len(tokens))
+	}
+
+	var vec []float32
+	if decodeErr == nil {
+		vec, decodeErr = s.extract()
+	}
+
+	if s.AutoClear || decodeErr != nil {
+		// A failed decode may leave partial state behind; always start over
+		s.clearLocked()
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	if s.Normalize {
+		normalizeL2(vec)
+	}
+	return vec, nil
+}
+
+// EmbedBatch returns the embeddings of texts, in order. As many texts as
+// fit in batchTokens tokens, and in the context's NSeqMax sequences, are
+// decoded together, each in its own sequence, which is much faster than
+// one Embed call per text. batchTokens <= 0, or larger than the context
+// allows, uses the smaller of NBatch and NUbatch, as pooled embeddings
+// need every sequence of a decode in one micro-batch. Every text must fit
+// in that limit.
+//
+// The context memory is cleared before every decode, whatever AutoClear.
+//
+// Example usage:
+//
+//	ctxParams := gollama.Context_default_params()
+//	ctxParams.Embeddings = 1
+//	ctxParams.NSeqMax = 16
+//	...
+//	vecs, err := session.EmbedBatch(texts, 0)
+func (s *EmbeddingSession) EmbedBatch(texts []string, batchTokens int) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	capacity := s.batchCapacity(batchTokens)
+	inputs := make([][]LlamaToken, len(texts))
+	for i, text := range texts {
+		tokens, err := Tokenize(s.model, text, true, true)
+		if err != nil {
+			return nil, fmt.Errorf("text %d: %w", i, err)
+		}
+		if len(tokens) == 0 || len(tokens) > capacity {
+			return nil, fmt.Errorf("%w: text %d has %d tokens, batches hold %d", ErrInvalidParameter, i, len(tokens), capacity)
+		}
+		inputs[i] = tokens
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.clearLocked()
+
+	decode := func(batch LlamaBatch) error {
+		s.clearLocked()
+		return Decode(s.ctx, batch)
+	}
+	extract := func(seq LlamaSeqId, output int32) ([]float32, error) {
+		return extractEmbedding(s.ctx, s.pooling, seq, output, s.nEmbd)
+	}
+	return embedGroups(inputs, capacity, int(max(s.nSeqMax, 1)), s.pooling, s.Normalize, decode, extract)
+}
+
+// embedGroups evaluates inputs in groups of at most capacity tokens and
+// maxSeqs inputs, each input in its own sequence, and returns their
+// embeddings in order. decode evaluates a group; extract then reads the
+// embedding of sequence seq, whose last token is batch token output.
+func embedGroups(inputs [][]LlamaToken, capacity, maxSeqs int, pooling LlamaPoolingType, normalize bool, decode func(LlamaBatch) error, extract func(seq LlamaSeqId, output int32) ([]float32, error)) ([][]float32, error) {
+	lengths := make([]int, len(inputs))
+	for i, tokens := range inputs {
+		lengths[i] = len(tokens)
+	}
+
+	batch, err := NewTokenBatch(int32(capacity), 1)
+	if err != nil {
+		return nil, err
+	}
+	defer batch.Free()
+
+	out := make([][]float32, len(inputs))
+	for _, group := range packSequences(lengths, capacity, maxSeqs) {
+		batch.Clear()
+		outputs := make([]int32, len(group))
+		for seq, i := range group {
+			for pos, tok := range inputs[i] {
+				// Pooling reads every token; otherwise only the last is used
+				output := pooling != LLAMA_POOLING_TYPE_NONE || pos == len(inputs[i])-1
+				if err := batch.Add(tok, LlamaPos(pos), []LlamaSeqId{LlamaSeqId(seq)}, output); err != nil {
+					return nil, err
+				}
+			}
+			outputs[seq] = int32(batch.Len() - 1)
+		}
+		if err := decode(batch.Batch()); err != nil {
+			return nil, fmt.Errorf("decoding %d inputs: %w", len(group), err)
+		}
+		for seq, i := range group {
+			vec, err := extract(LlamaSeqId(seq), outputs[seq])
+			if err != nil {
+				return nil, fmt.Errorf("input %d: %w", i, err)
+			}
+			if normalize {
+				normalizeL2(vec)
+			}
+			out[i] = vec
+		}
+	}
+	return out, nil
+}
+
+// batchCapacity returns the number of tokens EmbedBatch decodes at once
+// for the requested batchTokens.
+func (s *EmbeddingSession) batchCapacity(batchTokens int) int {
+	limit := s.nCtx
+	for _, n := range []uint32{s.nBatch, s.nUbatch} {
+		if n > 0 {
+			limit = min(limit, n)
+		}
+	}
+	if batchTokens <= 0 || uint64(batchTokens) > uint64(limit) {
+		return int(limit)
+	}
+	return batchTokens
+}
+
+// packSequences groups the inputs with the given lengths, in order, so
+// that each group holds at most capacity tokens and maxSeqs inputs.
+func packSequences(lengths []int, capacity, maxSeqs int) [][]int {
+	var groups [][]int
+	var cur []int
+	used := 0
+	for i, n := range lengths {
+		if len(cur) > 0 && (used+n > capacity || len(cur) == maxSeqs) {
+			groups = append(groups, cur)
+			cur, used = nil, 0
+		}
+		cur = append(cur, i)
+		used += n
+	}
+	if len(cur) > 0 {
+		groups = append(groups, cur)
+	}
+	return groups
+}
+
+// Reset clears the context memory and the usage counter.
+func (s *EmbeddingSession) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearLocked()
+}
+
+// Used returns the number of KV cells currently occupied by this session.
+func (s *EmbeddingSession) Used() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// Capacity returns the context size available to the session.
+func (s *EmbeddingSession) Capacity() uint32 {
+	return s.nCtx
+}
+
+// reserve checks that n more tokens fit in the context, clearing it first
+// when AutoClear is enabled. Callers must hold s.mu.
+func (s *EmbeddingSession) reserve(n int) error {
+	if n > math.MaxInt32 || uint64(n) > uint64(s.nCtx) {
+		return fmt.Errorf("%w: input of %d tokens exceeds context size %d", ErrContextFull, n, s.nCtx)
+	}
+	if s.pooling != LLAMA_POOLING_TYPE_NONE && s.nUbatch > 0 && uint64(n) > uint64(s.nUbatch) {
+		return fmt.Errorf("%w: input of %d tokens exceeds n_ubatch %d required for pooled embeddings", ErrInvalidParameter, n, s.nUbatch)
+	}
+	if s.used > 0 && uint64(s.used)+uint64(n) > uint64(s.nCtx) {
+		if s.AutoClear {
+			s.clearLocked()
+			return nil
+		}
+		return fmt.Errorf("%w: %d of %d cells used, %d more requested; call Reset", ErrContextFull, s.used, s.nCtx, n)
+	}
+	return nil
+}
+
+// extract copies the embedding for the last decoded input out of the context.
+func (s *EmbeddingSession) extract() ([]float32, error) {
+	return extractEmbedding(s.ctx, s.pooling, 0, -1, s.nEmbd)
+}
+
+// extractEmbedding copies n values of the embedding for seqId out of ctx.
+// With LLAMA_POOLING_TYPE_NONE the embedding of the given output token is
+// used instead (negative values count from the end).
+func extractEmbedding(ctx LlamaContext, pooling LlamaPoolingType, seqId LlamaSeqId, output int32, n int32) ([]float32, error) {
+	var ptr *float32
+	if pooling == LLAMA_POOLING_TYPE_NONE {
+		ptr = Get_embeddings_ith(ctx, output)
+	} else {
+		ptr = Get_embeddings_seq(ctx, seqId)
+	}
+	if ptr == nil {
+		return nil, errors.New("failed to get embeddings from context")
+	}
+
+	vec := make([]float32, n)
+	copy(vec, unsafe.Slice(ptr, n))
+	return vec, nil
+}
+
+func (s *EmbeddingSession) clearLocked() {
+	libMutex.RLock()
+	loaded := isLoaded
+	libMutex.RUnlock()
+	if s.ctx != 0 && loaded {
+		Memory_clear(s.ctx, true)
+	}
+	s.used = 0
+}
+
+// normalizeL2 scales v in place to unit Euclidean length.
+func normalizeL2(v []float32) {
+	simd.Normalize(v)
+}
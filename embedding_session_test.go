@@ -0,0 +1,126 @@
+package gollama
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type EmbeddingSessionSuite struct{ BaseSuite }
+
+// newTestSession builds a session without touching the native library
+func newTestSession(nCtx, nUbatch uint32, pooling LlamaPoolingType) *EmbeddingSession {
+	return &EmbeddingSession{
+		nCtx:      nCtx,
+		nUbatch:   nUbatch,
+		nEmbd:     4,
+		pooling:   pooling,
+		AutoClear: true,
+	}
+}
+
+func (s *EmbeddingSessionSuite) TestReserveRejectsOversizedInput() {
+	sess := newTestSession(16, 16, LLAMA_POOLING_TYPE_NONE)
+	err := sess.reserve(17)
+	s.Require().Error(err)
+	s.True(errors.Is(err, ErrContextFull))
+}
+
+func (s *EmbeddingSessionSuite) TestReserveRejectsInputLargerThanUbatchWhenPooled() {
+	sess := newTestSession(64, 8, LLAMA_POOLING_TYPE_MEAN)
+	err := sess.reserve(9)
+	s.Require().Error(err)
+	s.True(errors.Is(err, ErrInvalidParameter))
+}
+
+func (s *EmbeddingSessionSuite) TestReserveAutoClearResetsUsage() {
+	sess := newTestSession(16, 16, LLAMA_POOLING_TYPE_NONE)
+	sess.used = 12
+	s.Require().NoError(sess.reserve(8))
+	s.Equal(uint32(0), sess.used)
+}
+
+func (s *EmbeddingSessionSuite) TestReserveWithoutAutoClearReportsOverflow() {
+	sess := newTestSession(16, 16, LLAMA_POOLING_TYPE_NONE)
+	sess.AutoClear = false
+	sess.used = 12
+	s.Require().NoError(sess.reserve(4))
+	err := sess.reserve(5)
+	s.Require().Error(err)
+	s.True(errors.Is(err, ErrContextFull))
+	s.Equal(uint32(12), sess.used)
+}
+
+func (s *EmbeddingSessionSuite) TestNormalizeL2() {
+	v := []float32{3, 4}
+	normalizeL2(v)
+	s.InDelta(0.6, v[0], 1e-6)
+	s.InDelta(0.8, v[1], 1e-6)
+
+	zero := []float32{0, 0}
+	normalizeL2(zero)
+	s.False(math.IsNaN(float64(zero[0])))
+}
+
+func (s *EmbeddingSessionSuite) TestPackSequences() {
+	s.Equal([][]int{{0, 1}, {2, 3, 4}, {5}}, packSequences([]int{3, 4, 6, 1, 1, 1}, 8, 4))
+	s.Equal([][]int{{0, 1}, {2, 3}}, packSequences([]int{1, 1, 1, 1}, 8, 2), "bounded by the sequences")
+	s.Equal([][]int{{0}, {1}}, packSequences([]int{8, 8}, 8, 4))
+	s.Empty(packSequences(nil, 8, 4))
+}
+
+func (s *EmbeddingSessionSuite) TestBatchCapacity() {
+	sess := newTestSession(4096, 512, LLAMA_POOLING_TYPE_MEAN)
+	sess.nBatch = 2048
+	s.Equal(512, sess.batchCapacity(0))
+	s.Equal(128, sess.batchCapacity(128))
+	s.Equal(512, sess.batchCapacity(100000))
+}
+
+func (s *EmbeddingSessionSuite) TestEmbedBatchEmpty() {
+	vecs, err := newTestSession(16, 16, LLAMA_POOLING_TYPE_MEAN).EmbedBatch(nil, 0)
+	s.NoError(err)
+	s.Nil(vecs)
+}
+
+func (s *EmbeddingSessionSuite) TestEmbedGroupsReadsLastTokenWithoutPooling() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	inputs := [][]LlamaToken{{1, 2, 3}, {4, 5}, {6, 7, 8, 9}}
+	var sizes []int32
+	var outputs []int32
+	decode := func(batch LlamaBatch) error {
+		sizes = append(sizes, batch.NTokens)
+		return nil
+	}
+	extract := func(seq LlamaSeqId, output int32) ([]float32, error) {
+		outputs = append(outputs, output)
+		return []float32{float32(seq), float32(output)}, nil
+	}
+
+	vecs, err := embedGroups(inputs, 6, 4, LLAMA_POOLING_TYPE_NONE, false, decode, extract)
+	s.Require().NoError(err)
+	s.Equal([]int32{5, 4}, sizes)
+	s.Equal([]int32{2, 4, 3}, outputs, "index of each input's last token in its batch")
+	s.Equal([][]float32{{0, 2}, {1, 4}, {0, 3}}, vecs)
+}
+
+func (s *EmbeddingSessionSuite) TestNewEmbeddingSessionRejectsClosedHandles() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	registerHandle(handleContext, 0x5791)
+	s.True(closeHandle(handleContext, 0x5791))
+	registerHandle(handleModel, 0x5791)
+	s.True(closeHandle(handleModel, 0x5791))
+
+	_, err := NewEmbeddingSession(LlamaModel(0x5791), LlamaContext(0x5791))
+	s.ErrorIs(err, ErrClosedHandle)
+	_, err = NewEmbeddingSession(0, LlamaContext(0x5791))
+	s.ErrorIs(err, ErrModelNotLoaded)
+}
+
+func TestEmbeddingSessionSuite(t *testing.T) { suite.Run(t, new(EmbeddingSessionSuite)) }
@@ -0,0 +1,240 @@
+package gollama
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// EncoderPipeline runs encoder-style embedding models (BERT, nomic-bert, bge,
+// gte, ...) end to end. It configures the context from the model metadata so
+// that attention type, pooling and the embeddings flag do not have to be set
+// by hand, and it routes inputs through Encode or Decode as the model needs.
+//
+// Example usage:
+//
+//	pipe, err := gollama.NewEncoderPipeline(model, gollama.Context_default_params())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer pipe.Close()
+//
+//	vec, err := pipe.Embed("search_query: what is llama.cpp?")
+type EncoderPipeline struct {
+	model   LlamaModel
+	ctx     LlamaContext
+	nEmbd   int32
+	nBatch  uint32
+	nUbatch uint32
+	nSeqMax uint32
+	pooling LlamaPoolingType
+	// useEncode is set for encoder-only models, which are evaluated with llama_encode
+	useEncode bool
+
+	// Normalize applies L2 normalization to returned embeddings (default true).
+	Normalize bool
+
+	mu sync.Mutex
+}
+
+// EncoderContextParams returns a copy of params adjusted for running model as
+// an embedding encoder:
+//   - Embeddings is enabled
+//   - AttentionType is non-causal when the model declares "<arch>.attention.causal = false"
+//     or is encoder-only, and left to the model otherwise
+//   - PoolingType falls back to the model's "<arch>.pooling_type", or mean pooling
+//     for models that do not declare one
+//   - NUbatch is raised to NBatch, since non-causal attention needs the whole
+//     input in a single micro-batch
+func EncoderContextParams(model LlamaModel, params LlamaContextParams) LlamaContextParams {
+	params.Embeddings = 1
+
+	arch, _ := Model_meta_val_str(model, "general.architecture")
+
+	if params.AttentionType == LLAMA_ATTENTION_TYPE_UNSPECIFIED || params.AttentionType == LLAMA_ATTENTION_TYPE_CAUSAL {
+		if causal, ok := metaBool(model, arch+".attention.causal"); ok {
+			if !causal {
+				params.AttentionType = LLAMA_ATTENTION_TYPE_NON_CAUSAL
+			}
+		} else if Model_has_encoder(model) && !Model_has_decoder(model) {
+			params.AttentionType = LLAMA_ATTENTION_TYPE_NON_CAUSAL
+		}
+	}
+
+	if params.PoolingType == LLAMA_POOLING_TYPE_UNSPECIFIED {
+		if _, ok := Model_meta_val_str(model, arch+".pooling_type"); !ok {
+			params.PoolingType = LLAMA_POOLING_TYPE_MEAN
+		}
+	}
+
+	if params.NUbatch < params.NBatch {
+		params.NUbatch = params.NBatch
+	}
+	return params
+}
+
+// NewEncoderPipeline creates a context for model using EncoderContextParams and
+// wraps it in a pipeline. The pipeline owns the context; call Close to free it.
+func NewEncoderPipeline(model LlamaModel, params LlamaContextParams) (*EncoderPipeline, error) {
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+	if model == 0 {
+		return nil, ErrModelNotLoaded
+	}
+
+	nEmbd := llamaModelNEmbd(model)
+	if nEmbd <= 0 {
+		return nil, fmt.Errorf("%w: model reports %d embedding dimensions", ErrUnsupportedModelType, nEmbd)
+	}
+
+	ctx, err := Init_from_model(model, EncoderContextParams(model, params))
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncoderPipeline{
+		model:     model,
+		ctx:       ctx,
+		nEmbd:     nEmbd,
+		nBatch:    N_batch(ctx),
+		nUbatch:   llamaNUbatch(ctx),
+		nSeqMax:   N_seq_max(ctx),
+		pooling:   llamaPoolingType(ctx),
+		useEncode: Model_has_encoder(model) && !Model_has_decoder(model),
+		Normalize: true,
+	}, nil
+}
+
+// Context returns the underlying llama context.
+func (p *EncoderPipeline) Context() LlamaContext {
+	return p.ctx
+}
+
+// PoolingType returns the pooling type resolved by the context.
+func (p *EncoderPipeline) PoolingType() LlamaPoolingType {
+	return p.pooling
+}
+
+// Embed tokenizes text and returns its embedding vector.
+func (p *EncoderPipeline) Embed(text string) ([]float32, error) {
+	tokens, err := Tokenize(p.model, text, true, true)
+	if err != nil {
+		return nil, err
+	}
+	return p.EmbedTokens(tokens)
+}
+
+// EmbedTokens evaluates tokens and returns their embedding vector.
+func (p *EncoderPipeline) EmbedTokens(tokens []LlamaToken) ([]float32, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: no tokens to embed", ErrInvalidParameter)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ctx == 0 {
+		return nil, ErrContextNotCreated
+	}
+	if p.nUbatch > 0 && uint64(len(tokens)) > uint64(p.nUbatch) {
+		return nil, fmt.Errorf("%w: input of %d tokens exceeds n_ubatch %d", ErrInvalidParameter, len(tokens), p.nUbatch)
+	}
+
+	// Each input is independent; never let state leak between calls
+	Memory_clear(p.ctx, true)
+
+	batch := Batch_get_one(tokens)
+	if batch.NTokens == 0 {
+		return nil, errors.New("failed to create batch for embedding")
+	}
+
+	var err error
+	if p.useEncode {
+		err = Encode(p.ctx, batch)
+	} else {
+		err = Decode(p.ctx, batch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	vec, err := extractEmbedding(p.ctx, p.pooling, 0, -1, p.nEmbd)
+	if err != nil {
+		return nil, err
+	}
+	if p.Normalize {
+		normalizeL2(vec)
+	}
+	return vec, nil
+}
+
+// EmbedTokensBatch returns the embeddings of inputs, in order. Inputs are
+// packed into as few calls as possible, each in its own sequence: as many
+// as the context has sequences (NSeqMax) and as fit in BatchCapacity
+// tokens, which every input must fit in too.
+func (p *EncoderPipeline) EmbedTokensBatch(inputs [][]LlamaToken) ([][]float32, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	capacity := p.BatchCapacity()
+	for i, tokens := range inputs {
+		if len(tokens) == 0 || len(tokens) > capacity {
+			return nil, fmt.Errorf("%w: input %d has %d tokens, batches hold %d", ErrInvalidParameter, i, len(tokens), capacity)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ctx == 0 {
+		return nil, ErrContextNotCreated
+	}
+	decode := func(batch LlamaBatch) error {
+		Memory_clear(p.ctx, true)
+		if p.useEncode {
+			return Encode(p.ctx, batch)
+		}
+		return Decode(p.ctx, batch)
+	}
+	extract := func(seq LlamaSeqId, output int32) ([]float32, error) {
+		return extractEmbedding(p.ctx, p.pooling, seq, output, p.nEmbd)
+	}
+	return embedGroups(inputs, capacity, int(max(p.nSeqMax, 1)), p.pooling, p.Normalize, decode, extract)
+}
+
+// BatchCapacity returns the number of tokens EmbedTokensBatch evaluates at
+// once: the smaller of the context's NBatch and NUbatch.
+func (p *EncoderPipeline) BatchCapacity() int {
+	capacity := uint32(0)
+	for _, n := range []uint32{p.nBatch, p.nUbatch} {
+		if n > 0 && (capacity == 0 || n < capacity) {
+			capacity = n
+		}
+	}
+	return int(capacity)
+}
+
+// Close frees the pipeline context. It is safe to call more than once.
+func (p *EncoderPipeline) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx != 0 {
+		Free(p.ctx)
+		p.ctx = 0
+	}
+}
+
+// metaBool reads a boolean GGUF metadata value.
+func metaBool(model LlamaModel, key string) (bool, bool) {
+	val, ok := Model_meta_val_str(model, key)
+	if !ok {
+		return false, false
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, false
+	}
+	return b, true
+}
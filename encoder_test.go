@@ -0,0 +1,59 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type EncoderSuite struct{ BaseSuite }
+
+func (s *EncoderSuite) TestEncoderContextParamsWithoutMetadata() {
+	params := ContextDefaultParams()
+	params.NBatch = 1024
+	params.NUbatch = 256
+	params.PoolingType = LLAMA_POOLING_TYPE_UNSPECIFIED
+
+	adjusted := EncoderContextParams(0, params)
+	s.Equal(uint8(1), adjusted.Embeddings)
+	s.Equal(LLAMA_POOLING_TYPE_MEAN, adjusted.PoolingType)
+	s.Equal(uint32(1024), adjusted.NUbatch)
+}
+
+func (s *EncoderSuite) TestEncoderContextParamsKeepsExplicitPooling() {
+	params := ContextDefaultParams()
+	params.PoolingType = LLAMA_POOLING_TYPE_CLS
+
+	adjusted := EncoderContextParams(0, params)
+	s.Equal(LLAMA_POOLING_TYPE_CLS, adjusted.PoolingType)
+}
+
+func (s *EncoderSuite) TestEncoderPipelineRejectsEmptyInput() {
+	pipe := &EncoderPipeline{nEmbd: 4}
+	_, err := pipe.EmbedTokens(nil)
+	s.Require().ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *EncoderSuite) TestEmbedTokensBatchValidation() {
+	pipe := &EncoderPipeline{nEmbd: 4, nBatch: 512, nUbatch: 8}
+	s.Equal(8, pipe.BatchCapacity())
+
+	vecs, err := pipe.EmbedTokensBatch(nil)
+	s.NoError(err)
+	s.Nil(vecs)
+	_, err = pipe.EmbedTokensBatch([][]LlamaToken{{1, 2}, nil})
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = pipe.EmbedTokensBatch([][]LlamaToken{make([]LlamaToken, 9)})
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = pipe.EmbedTokensBatch([][]LlamaToken{{1, 2}})
+	s.ErrorIs(err, ErrContextNotCreated)
+}
+
+func (s *EncoderSuite) TestCloseIsIdempotent() {
+	pipe := &EncoderPipeline{}
+	pipe.Close()
+	pipe.Close()
+	s.Equal(LlamaContext(0), pipe.Context())
+}
+
+func TestEncoderSuite(t *testing.T) { suite.Run(t, new(EncoderSuite)) }
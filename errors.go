@@ -12,6 +12,7 @@ var (
 	ErrLibraryLoadFailed  = errors.New("failed to load llama.cpp library")
 	ErrFunctionNotFound   = errors.New("function not found in library")
 	ErrInvalidLibraryPath = errors.New("invalid library path")
+	ErrABIMismatch        = errors.New("library struct layout does not match the Go bindings")
 
 	// Model errors
 	ErrModelNotLoaded       = errors.New("model not loaded")
@@ -26,16 +27,25 @@ var (
 	ErrContextCreationFailed = errors.New("failed to create context")
 	ErrInvalidContextSize    = errors.New("invalid context size")
 	ErrContextFull           = errors.New("context is full")
+	ErrDecodeTimeout         = errors.New("decode timed out")
+	ErrNoKvSlot              = errors.New("no KV cache slot for the batch")
+	ErrOutputNotAvailable    = errors.New("output not available")
+	ErrClosedHandle          = errors.New("handle already freed")
 
 	// Token errors
 	ErrTokenizationFailed = errors.New("tokenization failed")
 	ErrInvalidToken       = errors.New("invalid token")
 	ErrTokenOutOfRange    = errors.New("token out of vocabulary range")
 
+	// Batch errors
+	ErrBatchAllocationFailed = errors.New("failed to allocate batch")
+	ErrBatchFull             = errors.New("batch is full")
+
 	// Generation errors
 	ErrGenerationFailed      = errors.New("text generation failed")
 	ErrSamplingFailed        = errors.New("token sampling failed")
 	ErrInvalidSamplingParams = errors.New("invalid sampling parameters")
+	ErrSchedulerClosed       = errors.New("scheduler closed")
 
 	// Memory errors
 	ErrOutOfMemory            = errors.New("out of memory")
@@ -61,15 +71,24 @@ var (
 	ErrFileWriteFailed   = errors.New("failed to write file")
 	ErrInvalidFileFormat = errors.New("invalid file format")
 
+	// Download errors
+	ErrChecksumMismatch    = errors.New("checksum mismatch")
+	ErrChecksumUnavailable = errors.New("no trusted checksum available")
+	ErrOffline             = errors.New("offline mode")
+
 	// Parameter errors
 	ErrInvalidParameter    = errors.New("invalid parameter")
 	ErrParameterOutOfRange = errors.New("parameter out of range")
 	ErrMissingParameter    = errors.New("missing required parameter")
 
+	// Chat errors
+	ErrInvalidToolCall = errors.New("invalid tool call")
+
 	// Thread/concurrency errors
 	ErrThreadingFailed      = errors.New("threading operation failed")
 	ErrConcurrencyViolation = errors.New("concurrency violation")
 	ErrDeadlock             = errors.New("deadlock detected")
+	ErrBusy                 = errors.New("library busy: native calls in flight")
 )
 
 // LlamaError represents a structured error from the llama.cpp library
@@ -34,8 +34,8 @@ echo "• Comparing model outputs with different parameters"
 echo "• Generating content variations for A/B testing"
 echo "• Improving throughput for multiple sequences"
 echo ""
-echo "This implementation demonstrates the concept with sequential processing"
-echo "for simplicity, while the original llama.cpp uses true parallel batching."
+echo "Like the original llama.cpp example, all sequences are decoded together:"
+echo "the prompt once, then one batch per step with a token for each sequence."
 echo ""
 echo "---"
 echo ""
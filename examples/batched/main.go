@@ -1,6 +1,6 @@
-// Simple demonstration of batched generation concept
-// In a production implementation, this would use proper parallel batch processing
-// For now, we'll demonstrate by generating multiple sequences sequentially
+// Batched generation: several completions of one prompt are generated
+// together, decoding the prompt once and one batch per step for all
+// sequences (see gollama.ParallelGenerator).
 
 package main
 
@@ -10,6 +10,8 @@ import (
 	"log"
 	"math"
 	"time"
+
+	"github.com/dianlight/gollama.cpp"
 )
 
 // BatchedConfig holds configuration for batched generation
@@ -24,6 +26,7 @@ type BatchedConfig struct {
 	Temperature float32
 	TopK        int32
 	TopP        float32
+	Seed        int64
 }
 
 func main() {
@@ -37,6 +40,7 @@ func main() {
 	flag.IntVar(&config.ContextSize, "ctx", 2048, "Context size")
 	flag.IntVar(&config.Threads, "threads", 4, "Number of threads to use")
 	flag.BoolVar(&config.Verbose, "verbose", false, "Enable verbose output")
+	flag.Int64Var(&config.Seed, "seed", -1, "Random seed (-1 for random)")
 
 	var temperature float64 = 0.8
 	var topK int64 = 40
@@ -53,6 +57,15 @@ func main() {
 	}
 	config.TopK = int32(topK)
 	config.TopP = float32(topP)
+	if config.NParallel < 1 || config.NParallel > math.MaxInt32 {
+		log.Fatalf("n-parallel value %d is out of range", config.NParallel)
+	}
+	if config.ContextSize > math.MaxUint32 || config.ContextSize < 0 {
+		log.Fatalf("context size %d is out of range for uint32", config.ContextSize)
+	}
+	if config.Threads > math.MaxInt32 || config.Threads < math.MinInt32 {
+		log.Fatalf("threads count %d is out of range for int32", config.Threads)
+	}
 
 	// Print configuration
 	fmt.Println("Configuration:")
@@ -67,57 +80,83 @@ func main() {
 	fmt.Printf("  Top-P: %.2f\n", config.TopP)
 	fmt.Println()
 
-	// Since full parallel batching has technical challenges with the current API,
-	// we'll demonstrate the concept by generating multiple sequences sequentially
-	// This still shows the batched generation idea
+	// Initialize the backend
+	if err := gollama.Backend_init(); err != nil {
+		log.Fatalf("Failed to initialize backend: %v", err)
+	}
+	defer gollama.Backend_free()
 
-	fmt.Printf("Generating %d sequences (sequential demonstration)...\n\n", config.NParallel)
+	modelParams := gollama.Model_default_params()
+	model, err := gollama.LoadModel(config.ModelPath, modelParams)
+	if err != nil {
+		log.Fatalf("Failed to load model: %v", err)
+	}
+	defer model.Free()
+
+	// Every sequence needs its own slot in the KV cache
+	ctxParams := gollama.Context_default_params()
+	ctxParams.NCtx = uint32(config.ContextSize)
+	ctxParams.NSeqMax = uint32(config.NParallel)
+	ctxParams.NThreads = int32(config.Threads)
+	ctxParams.NThreadsBatch = int32(config.Threads)
+	ctx, err := gollama.NewContext(model, ctxParams)
+	if err != nil {
+		log.Fatalf("Failed to create context: %v", err)
+	}
+	defer ctx.Free()
 
-	sequences := make([]string, config.NParallel)
-	startTime := time.Now()
+	tokens, err := model.Tokenize(config.Prompt, model.AddBOS, false)
+	if err != nil {
+		log.Fatalf("Failed to tokenize: %v", err)
+	}
+	if config.Verbose {
+		fmt.Printf("Prompt tokens: %v\n", tokens)
+	}
 
-	for seqIdx := 0; seqIdx < config.NParallel; seqIdx++ {
-		if config.Verbose {
-			fmt.Printf("Generating sequence %d...\n", seqIdx+1)
-		}
+	seed := uint32(gollama.LLAMA_DEFAULT_SEED)
+	if config.Seed >= 0 {
+		seed = uint32(config.Seed)
+	}
+	gen, err := gollama.NewParallelGenerator(ctx, gollama.ParallelOptions{
+		MaxTokens: config.NPredictInt,
+		Sampling: &gollama.SamplingParams{
+			Temperature: config.Temperature,
+			TopK:        config.TopK,
+			TopP:        config.TopP,
+			Seed:        seed,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to create generator: %v", err)
+	}
 
-		// For this demonstration, we generate a simple continuation
-		// In a full implementation, each sequence would have its own batch entry
-		sequenceText := fmt.Sprintf(" world! This is sequence #%d.", seqIdx+1)
-
-		// Add some variety based on sequence number
-		switch seqIdx % 3 {
-		case 0:
-			sequenceText += " Greetings from the first batch."
-		case 1:
-			sequenceText += " This demonstrates parallel generation."
-		case 2:
-			sequenceText += " Multiple sequences can be processed together."
+	fmt.Printf("Generating %d sequences in parallel...\n\n", config.NParallel)
+	startTime := time.Now()
+	completions, err := gen.Generate(tokens, config.NParallel, func(seq int, token gollama.LlamaToken) error {
+		if config.Verbose {
+			fmt.Printf("[%d] %q\n", seq, gollama.Token_to_piece(model.Handle(), token, false))
 		}
-
-		sequences[seqIdx] = sequenceText
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Generation failed: %v", err)
 	}
-
-	endTime := time.Now()
-	duration := endTime.Sub(startTime).Seconds()
+	duration := time.Since(startTime)
 
 	// Print results
 	fmt.Println("Generated sequences:")
 	fmt.Println()
-	for i := 0; i < config.NParallel; i++ {
-		fmt.Printf("Sequence %d:\n%s%s\n\n", i+1, config.Prompt, sequences[i])
+	for i, c := range completions {
+		fmt.Printf("Sequence %d:\n%s%s\n\n", i+1, config.Prompt, c.Text)
 	}
 
 	// Performance statistics
+	stats := gen.Stats()
 	fmt.Printf("Performance Statistics:\n")
-	fmt.Printf("  Generated %d sequences in %.3f seconds\n", config.NParallel, duration)
-	fmt.Printf("  Average sequence length: %.1f characters\n", float64(len(sequences[0]))/float64(config.NParallel))
-
-	fmt.Printf("\nNote: This is a simplified demonstration of batched generation concepts.\n")
-	fmt.Printf("A full implementation would use true parallel batch processing with:\n")
-	fmt.Printf("  - Proper batch management for multiple sequences\n")
-	fmt.Printf("  - Shared context computation for the prompt\n")
-	fmt.Printf("  - Parallel token sampling and generation\n")
-	fmt.Printf("  - Advanced sequence state tracking\n")
-	fmt.Printf("\nBatched generation demonstration complete!\n")
+	fmt.Printf("  Prompt tokens: %d (decoded once for all sequences)\n", stats.PromptTokens)
+	fmt.Printf("  Generated %d tokens in %d decode calls\n", stats.Generated, stats.Decodes)
+	fmt.Printf("  Time: %.3f seconds\n", duration.Seconds())
+	if stats.Generated > 0 {
+		fmt.Printf("  Tokens per second: %.2f\n", float64(stats.Generated)/duration.Seconds())
+	}
 }
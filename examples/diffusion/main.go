@@ -27,19 +27,6 @@ func secureRandFloat32() float32 {
 	return float32(n.Int64()) / float32(1<<24)
 }
 
-// secureRandIntn generates a cryptographically secure random int in [0, n)
-func secureRandIntn(n int) int {
-	if n <= 0 {
-		log.Fatalf("Invalid range for secure random: %d", n)
-	}
-	max := big.NewInt(int64(n))
-	result, err := rand.Int(rand.Reader, max)
-	if err != nil {
-		log.Fatalf("Failed to generate secure random number: %v", err)
-	}
-	return int(result.Int64())
-}
-
 // secureRandFloat64 generates a cryptographically secure random float64 in [0, 1)
 func secureRandFloat64() float64 {
 	max := big.NewInt(1 << 53) // 53 bits for float64 precision
@@ -372,7 +359,7 @@ func generateCandidatesForPositions(ctx gollama.LlamaContext, model gollama.Llam
 		}
 
 		// Get logits and sample
-		logits := gollama.Get_logits(ctx)
+		logits := gollama.Get_logits_ith_slice(ctx, -1)
 		if logits == nil {
 			return nil, fmt.Errorf("no logits available for position %d", pos)
 		}
@@ -391,15 +378,19 @@ func generateCandidatesForPositions(ctx gollama.LlamaContext, model gollama.Llam
 	return candidates, nil
 }
 
-func sampleTokenWithConfidence(logitsPtr *float32, config *DiffusionConfig, algorithm DiffusionAlgorithm) (gollama.LlamaToken, float32) {
+func sampleTokenWithConfidence(logits []float32, config *DiffusionConfig, algorithm DiffusionAlgorithm) (gollama.LlamaToken, float32) {
 	// This is a simplified sampling - real implementation would need proper softmax and sampling
 
 	// For demonstration, we'll use a simple approach
 	// In practice, you'd implement proper temperature scaling, top-k/top-p, etc.
 
-	// Generate a reasonable token (simplified)
-	commonTokens := []gollama.LlamaToken{464, 262, 286, 290, 319, 356, 389, 423, 447, 481} // Some common token IDs
-	selectedToken := commonTokens[secureRandIntn(len(commonTokens))]
+	// Greedy pick over the full vocabulary; len(logits) is the vocab size
+	selectedToken := gollama.LlamaToken(0)
+	for i, l := range logits {
+		if l > logits[selectedToken] {
+			selectedToken = gollama.LlamaToken(i)
+		}
+	}
 
 	// Calculate confidence based on algorithm
 	var confidence float32
@@ -220,16 +220,21 @@ func main() {
 			continue
 		}
 
-		// Get embeddings
-		embeddingsPtr := gollama.Get_embeddings(llamaCtx)
-		if embeddingsPtr == nil {
-			log.Printf("Failed to get embeddings for prompt %d", i+1)
+		// Get embeddings: pooled models produce one per sequence, the others
+		// one per token
+		var embeddings []float32
+		if gollama.Pooling_type(llamaCtx) == gollama.LLAMA_POOLING_TYPE_NONE {
+			embeddings, err = gollama.EmbeddingsIth(llamaCtx, -1)
+		} else {
+			embeddings, err = gollama.EmbeddingsSeq(llamaCtx, gollama.LlamaSeqId(i))
+		}
+		if err != nil {
+			log.Printf("Failed to get embeddings for prompt %d: %v", i+1, err)
 			continue
 		}
 
-		// Convert to Go slice
-		embeddings := unsafe.Slice(embeddingsPtr, nEmbd)
-		embeddingsCopy := make([]float32, nEmbd)
+		// The slice is only valid until the next decode
+		embeddingsCopy := make([]float32, len(embeddings))
 		copy(embeddingsCopy, embeddings)
 
 		// Normalize if requested
@@ -278,17 +278,18 @@ func simulateInferenceWithCallbacks(cb *EvalCallbackData, tokens []gollama.Llama
 	}
 
 	// Final output layer
+	nVocab := int64(gollama.Vocab_n_tokens(model))
 	cb.logOperation(SimulatedTensorInfo{
 		Name:       "output_logits",
 		Type:       "output",
 		Operation:  "MUL_MAT",
-		Dimensions: []int64{int64(seqLen), 32000}, // vocab size
-		SizeBytes:  int64(seqLen * 32000 * 4),
+		Dimensions: []int64{int64(seqLen), nVocab},
+		SizeBytes:  int64(seqLen) * nVocab * 4,
 		IsHost:     true,
 		DataType:   "f32",
 	}, []SimulatedTensorInfo{
 		{Name: "final_norm", Dimensions: []int64{int64(seqLen), 2048}},
-		{Name: "output_weight", Dimensions: []int64{2048, 32000}},
+		{Name: "output_weight", Dimensions: []int64{2048, nVocab}},
 	})
 
 	slog.Info(fmt.Sprintf("=== Evaluation Complete ==="))
@@ -436,7 +437,6 @@ func main() {
 	ctxParams.NBatch = 512
 	ctxParams.NSeqMax = 1
 	ctxParams.NThreads = int32(*threads)
-	ctxParams.Logits = 1
 
 	// NOTE: In a real implementation, we would set eval callbacks here:
 	// ctxParams.CbEval = callbackFunctionPointer
@@ -476,9 +476,8 @@ func main() {
 	fmt.Print("Evaluating tokens... ")
 	startTime := time.Now()
 
-	batch := gollama.Batch_get_one(tokens)
-
-	if err := gollama.Decode(context, batch); err != nil {
+	// Prompts longer than NBatch are decoded in chunks
+	if err := gollama.DecodeTokens(context, tokens, 0); err != nil {
 		log.Fatalf("Failed to decode: %v", err)
 	}
 
@@ -486,14 +485,10 @@ func main() {
 	slog.Info(fmt.Sprintf("done (%.2fs)", evalTime.Seconds()))
 
 	// Get logits for the last token
-	tokensLen := len(tokens)
-	if tokensLen == 0 {
+	if len(tokens) == 0 {
 		log.Fatal("No tokens to get logits for")
 	}
-	if tokensLen-1 > math.MaxInt32 {
-		log.Fatalf("token index %d is out of range for int32", tokensLen-1)
-	}
-	logits := gollama.Get_logits_ith(context, int32(tokensLen-1))
+	logits := gollama.Get_logits_ith(context, -1)
 	if logits == nil {
 		log.Fatalf("Failed to get logits")
 	}
@@ -101,20 +101,28 @@ func demonstrateBackendDevices() {
 
 		fmt.Printf("Device %d: %s\n", i, name)
 
-		// Try to get description
-		desc, err := gollama.Ggml_backend_dev_description(dev)
-		if err == nil && desc != "" {
-			fmt.Printf("  Description: %s\n", desc)
+		// Properties give type, id and capabilities in one call
+		props, err := gollama.Ggml_backend_dev_props(dev)
+		if err != nil {
+			fmt.Printf("  Properties not available: %v\n", err)
+			fmt.Println()
+			continue
 		}
-
-		// Try to get memory info (may not be supported on all devices)
-		free, total, err := gollama.Ggml_backend_dev_memory(dev)
-		if err == nil && total > 0 {
+		if props.Description != "" {
+			fmt.Printf("  Description: %s\n", props.Description)
+		}
+		fmt.Printf("  Type: %s\n", props.Type)
+		if props.DeviceID != "" {
+			fmt.Printf("  Device ID: %s\n", props.DeviceID)
+		}
+		if props.MemoryTotal > 0 {
 			fmt.Printf("  Memory: %.2f MB free / %.2f MB total (%.1f%% used)\n",
-				float64(free)/(1024*1024),
-				float64(total)/(1024*1024),
-				float64(total-free)/float64(total)*100)
+				float64(props.MemoryFree)/(1024*1024),
+				float64(props.MemoryTotal)/(1024*1024),
+				float64(props.MemoryTotal-props.MemoryFree)/float64(props.MemoryTotal)*100)
 		}
+		fmt.Printf("  Caps: async=%t host_buffer=%t buffer_from_host_ptr=%t events=%t\n",
+			props.Caps.Async, props.Caps.HostBuffer, props.Caps.BufferFromHostPtr, props.Caps.Events)
 
 		fmt.Println()
 	}
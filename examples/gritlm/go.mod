@@ -7,6 +7,7 @@ require github.com/dianlight/gollama.cpp v1.0.0
 require (
 	github.com/ebitengine/purego v0.9.1 // indirect
 	github.com/google/go-github/v60 v60.0.0 // indirect
+	github.com/google/go-github/v68 v68.0.0 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/jupiterrider/ffi v0.5.1 // indirect
 )
@@ -178,17 +178,20 @@ func main() {
 
 	fmt.Printf("Decode successful! Getting embeddings...\n")
 
-	// Try standard embeddings
-	embPtr := gollama.Get_embeddings(ctx)
-	if embPtr == nil {
-		log.Fatalf("Failed to get embeddings")
+	// Pooled models produce one embedding per sequence, the others one per
+	// token
+	var embeddings []float32
+	if gollama.Pooling_type(ctx) == gollama.LLAMA_POOLING_TYPE_NONE {
+		embeddings, err = gollama.EmbeddingsIth(ctx, -1)
+	} else {
+		embeddings, err = gollama.EmbeddingsSeq(ctx, 0)
 	}
+	if err != nil {
+		log.Fatalf("Failed to get embeddings: %v", err)
+	}
+	nEmbd := len(embeddings)
 
-	// Get embedding dimensions
-	nEmbd := gollama.Model_n_embd(model)
-
-	// Convert to Go slice
-	embeddings := unsafe.Slice(embPtr, nEmbd)
+	// The slice is only valid until the next decode
 	embeddingsCopy := make([]float32, nEmbd)
 	copy(embeddingsCopy, embeddings)
 
@@ -116,7 +116,6 @@ func main() {
 	// ctxParams.NUbatch = 512   // Keep default value
 	ctxParams.NSeqMax = 1 // Set max sequences to 1 for simple use case
 	ctxParams.NThreads = int32(*threads)
-	ctxParams.Logits = 1 // true as uint8
 
 	fmt.Printf("Setting context size to: %d\n", *ctx)
 	fmt.Printf("Context params NCtx: %d\n", ctxParams.NCtx)
@@ -139,13 +138,9 @@ func main() {
 	}
 	fmt.Printf("done (%d tokens)\n", len(tokens))
 
-	// Create batch for the prompt tokens
-	batch := gollama.Batch_get_one(tokens)
-	defer gollama.Batch_free(batch)
-
-	// Process the prompt
+	// Process the prompt, in NBatch-sized chunks when it is longer
 	fmt.Print("Processing prompt... ")
-	if err := gollama.Decode(context, batch); err != nil {
+	if err := gollama.DecodeTokens(context, tokens, 0); err != nil {
 		log.Fatalf("Failed to decode prompt: %v", err)
 	}
 	fmt.Println("done")
@@ -157,34 +152,41 @@ func main() {
 	sampler := gollama.Sampler_init_greedy()
 	defer gollama.Sampler_free(sampler)
 
-	nCur := len(tokens)
-	for i := 0; i < *nPredict && nCur < *ctx; i++ {
+	// Track the position of the sequence instead of counting tokens
+	tracker := gollama.NewSequenceTracker(1)
+	tracker.Sync(context)
+	generated := 0
+	for ; generated < *nPredict && int(tracker.Pos(0)) < *ctx; generated++ {
 		// Sample next token directly from the context
 		// The sampler internally handles getting logits and creating token data array
-		fmt.Printf("About to sample token %d using new API\n", i)
+		fmt.Printf("About to sample token %d using new API\n", generated)
 		fmt.Printf("Sampler: %v, Context: %v\n", sampler, context)
 
 		// Sample from the last token in the context (-1)
 		newToken := gollama.Sampler_sample(sampler, context, -1)
 		fmt.Printf("Sampled token: %d\n", newToken)
 
+		// Stop at end-of-generation tokens (EOS, EOT, ...)
+		if gollama.Vocab_is_eog(model, newToken) {
+			break
+		}
+
 		// Convert token to text using improved Token_to_piece function
 		piece := gollama.Token_to_piece(model, newToken, false)
 		fmt.Printf("Token piece: '%s'\n", piece)
 		fmt.Print(piece)
 
 		// Create a new batch with the single token
-		batch = gollama.Batch_get_one([]gollama.LlamaToken{newToken})
+		batch := gollama.Batch_get_one([]gollama.LlamaToken{newToken})
 
 		// Decode the new token
 		if err := gollama.Decode(context, batch); err != nil {
 			log.Printf("Failed to decode token: %v", err)
 			break
 		}
-
-		nCur++
+		tracker.Commit(batch)
 	}
 
 	fmt.Println()
-	fmt.Printf("\nGenerated %d tokens.\n", *nPredict)
+	fmt.Printf("\nGenerated %d tokens.\n", generated)
 }
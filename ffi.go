@@ -9,65 +9,6 @@ import (
 
 // FFI type definitions for llama.cpp structs
 var (
-	// LlamaModelParams FFI type
-	ffiTypeLlamaModelParams = ffi.Type{
-		Type: ffi.Struct,
-		Elements: &[]*ffi.Type{
-			&ffi.TypePointer, // devices
-			&ffi.TypePointer, // tensor_buft_overrides
-			&ffi.TypeSint32,  // n_gpu_layers
-			&ffi.TypeSint32,  // split_mode
-			&ffi.TypeSint32,  // main_gpu
-			&ffi.TypePointer, // tensor_split
-			&ffi.TypePointer, // progress_callback
-			&ffi.TypePointer, // progress_callback_user_data
-			&ffi.TypePointer, // kv_overrides
-			&ffi.TypeUint8,   // vocab_only
-			&ffi.TypeUint8,   // use_mmap
-			&ffi.TypeUint8,   // use_mlock
-			&ffi.TypeUint8,   // check_tensors
-			&ffi.TypeUint8,   // use_extra_bufts
-			nil,
-		}[0],
-	}
-
-	// LlamaContextParams FFI type
-	ffiTypeLlamaContextParams = ffi.Type{
-		Type: ffi.Struct,
-		Elements: &[]*ffi.Type{
-			&ffi.TypeUint32,  // seed
-			&ffi.TypeUint32,  // n_ctx
-			&ffi.TypeUint32,  // n_batch
-			&ffi.TypeUint32,  // n_ubatch
-			&ffi.TypeUint32,  // n_seq_max
-			&ffi.TypeSint32,  // n_threads
-			&ffi.TypeSint32,  // n_threads_batch
-			&ffi.TypeSint32,  // rope_scaling_type
-			&ffi.TypeSint32,  // pooling_type
-			&ffi.TypeSint32,  // attention_type
-			&ffi.TypeFloat,   // rope_freq_base
-			&ffi.TypeFloat,   // rope_freq_scale
-			&ffi.TypeFloat,   // yarn_ext_factor
-			&ffi.TypeFloat,   // yarn_attn_factor
-			&ffi.TypeFloat,   // yarn_beta_fast
-			&ffi.TypeFloat,   // yarn_beta_slow
-			&ffi.TypeUint32,  // yarn_orig_ctx
-			&ffi.TypeFloat,   // defrag_thold
-			&ffi.TypePointer, // cb_eval
-			&ffi.TypePointer, // cb_eval_user_data
-			&ffi.TypeSint32,  // type_k
-			&ffi.TypeSint32,  // type_v
-			&ffi.TypePointer, // abort_callback
-			&ffi.TypePointer, // abort_callback_data
-			&ffi.TypeUint8,   // logits
-			&ffi.TypeUint8,   // embeddings
-			&ffi.TypeUint8,   // offload_kqv
-			&ffi.TypeUint8,   // flash_attn
-			&ffi.TypeUint8,   // no_perf
-			nil,
-		}[0],
-	}
-
 	// LlamaSamplerChainParams FFI type
 	ffiTypeLlamaSamplerChainParams = ffi.Type{
 		Type: ffi.Struct,
@@ -91,42 +32,116 @@ var (
 			nil,
 		}[0],
 	}
+
+	// LlamaPerfContextData FFI type
+	ffiTypeLlamaPerfContextData = ffi.Type{
+		Type: ffi.Struct,
+		Elements: &[]*ffi.Type{
+			&ffi.TypeDouble, // t_start_ms
+			&ffi.TypeDouble, // t_load_ms
+			&ffi.TypeDouble, // t_p_eval_ms
+			&ffi.TypeDouble, // t_eval_ms
+			&ffi.TypeSint32, // n_p_eval
+			&ffi.TypeSint32, // n_eval
+			&ffi.TypeSint32, // n_reused
+			nil,
+		}[0],
+	}
+
+	// LlamaPerfSamplerData FFI type
+	ffiTypeLlamaPerfSamplerData = ffi.Type{
+		Type: ffi.Struct,
+		Elements: &[]*ffi.Type{
+			&ffi.TypeDouble, // t_sample_ms
+			&ffi.TypeSint32, // n_sample
+			nil,
+		}[0],
+	}
+
+	// ggml_init_params FFI type
+	ffiTypeGgmlInitParams = ffi.Type{
+		Type: ffi.Struct,
+		Elements: &[]*ffi.Type{
+			&ffi.TypeUint64,  // mem_size
+			&ffi.TypePointer, // mem_buffer
+			&ffi.TypeUint8,   // no_alloc
+			nil,
+		}[0],
+	}
 )
 
+// ggmlInitParams mirrors struct ggml_init_params
+type ggmlInitParams struct {
+	memSize   uintptr
+	memBuffer unsafe.Pointer
+	noAlloc   bool
+}
+
 // FFI function wrappers
 
 // ffiModelDefaultParams calls llama_model_default_params using FFI
 func ffiModelDefaultParams() (LlamaModelParams, error) {
+	layout := currentLayout()
+	result, err := ffiCallDefaultParams("llama_model_default_params", layout.modelParams)
+	if err != nil {
+		return LlamaModelParams{}, err
+	}
+	return layout.decodeModelParams(result), nil
+}
+
+// ffiCallDefaultParams calls a parameterless *_default_params function
+// returning a struct of type t and returns the raw result.
+func ffiCallDefaultParams(name string, t *ffi.Type) (unsafe.Pointer, error) {
 	var cif ffi.Cif
-	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 0, &ffiTypeLlamaModelParams); status != ffi.OK {
-		return LlamaModelParams{}, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 0, t); status != ffi.OK {
+		return nil, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
 	}
 
-	fnAddr, err := getProcAddressPlatform(libHandle, "llama_model_default_params")
+	fnAddr, err := getProcAddressPlatform(libHandle, name)
 	if err != nil {
-		return LlamaModelParams{}, fmt.Errorf("failed to get llama_model_default_params address: %w", err)
+		return nil, fmt.Errorf("failed to get %s address: %w", name, err)
 	}
 
-	var result LlamaModelParams
-	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result))
+	result, err := newStructBuffer(t)
+	if err != nil {
+		return nil, err
+	}
+	ffi.Call(&cif, fnAddr, result)
 	return result, nil
 }
 
-// ffiContextDefaultParams calls llama_context_default_params using FFI
-func ffiContextDefaultParams() (LlamaContextParams, error) {
-	var cif ffi.Cif
-	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 0, &ffiTypeLlamaContextParams); status != ffi.OK {
-		return LlamaContextParams{}, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+// ffiEncodeModelParams converts params to the layout of the loaded library.
+// Fields the Go struct lacks keep the library defaults.
+func ffiEncodeModelParams(params LlamaModelParams) (unsafe.Pointer, error) {
+	layout := currentLayout()
+	buf, err := ffiCallDefaultParams("llama_model_default_params", layout.modelParams)
+	if err != nil {
+		return nil, err
 	}
+	layout.encodeModelParams(params, buf)
+	return buf, nil
+}
 
-	fnAddr, err := getProcAddressPlatform(libHandle, "llama_context_default_params")
+// ffiEncodeContextParams converts params to the layout of the loaded
+// library. Fields the Go struct lacks keep the library defaults.
+func ffiEncodeContextParams(params LlamaContextParams) (unsafe.Pointer, error) {
+	layout := currentLayout()
+	buf, err := ffiCallDefaultParams("llama_context_default_params", layout.contextParams)
 	if err != nil {
-		return LlamaContextParams{}, fmt.Errorf("failed to get llama_context_default_params address: %w", err)
+		return nil, err
 	}
+	layout.encodeContextParams(params, buf)
+	return buf, nil
+}
 
-	var result LlamaContextParams
-	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result))
-	return result, nil
+// ffiContextDefaultParams calls llama_context_default_params using FFI
+func ffiContextDefaultParams() (LlamaContextParams, error) {
+	layout := currentLayout()
+	result, err := ffiCallDefaultParams("llama_context_default_params", layout.contextParams)
+	if err != nil {
+		return LlamaContextParams{}, err
+	}
+	return layout.decodeContextParams(result), nil
 }
 
 // ffiSamplerChainDefaultParams calls llama_sampler_chain_default_params using FFI
@@ -172,10 +187,14 @@ func ffiBatchInit(nTokens, embd, nSeqMax int32) (LlamaBatch, error) {
 // ffiModelLoadFromFile calls llama_model_load_from_file using FFI
 func ffiModelLoadFromFile(pathModel *byte, params LlamaModelParams) (LlamaModel, error) {
 	var cif ffi.Cif
-	aTypes := []*ffi.Type{&ffi.TypePointer, &ffiTypeLlamaModelParams}
+	aTypes := []*ffi.Type{&ffi.TypePointer, currentLayout().modelParams}
 	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 2, &ffi.TypePointer, aTypes...); status != ffi.OK {
 		return 0, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
 	}
+	cParams, err := ffiEncodeModelParams(params)
+	if err != nil {
+		return 0, err
+	}
 
 	fnAddr, err := getProcAddressPlatform(libHandle, "llama_model_load_from_file")
 	if err != nil {
@@ -185,7 +204,38 @@ func ffiModelLoadFromFile(pathModel *byte, params LlamaModelParams) (LlamaModel,
 	var result LlamaModel
 	aValues := []unsafe.Pointer{
 		unsafe.Pointer(&pathModel),
-		unsafe.Pointer(&params),
+		cParams,
+	}
+	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result), aValues...)
+
+	if result == 0 {
+		return 0, fmt.Errorf("failed to load model")
+	}
+	return result, nil
+}
+
+// ffiModelLoadFromSplits calls llama_model_load_from_splits using FFI
+func ffiModelLoadFromSplits(paths **byte, nPaths uint64, params LlamaModelParams) (LlamaModel, error) {
+	var cif ffi.Cif
+	aTypes := []*ffi.Type{&ffi.TypePointer, &ffi.TypeUint64, currentLayout().modelParams}
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 3, &ffi.TypePointer, aTypes...); status != ffi.OK {
+		return 0, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	}
+	cParams, err := ffiEncodeModelParams(params)
+	if err != nil {
+		return 0, err
+	}
+
+	fnAddr, err := getProcAddressPlatform(libHandle, "llama_model_load_from_splits")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get llama_model_load_from_splits address: %w", err)
+	}
+
+	var result LlamaModel
+	aValues := []unsafe.Pointer{
+		unsafe.Pointer(&paths),
+		unsafe.Pointer(&nPaths),
+		cParams,
 	}
 	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result), aValues...)
 
@@ -198,10 +248,14 @@ func ffiModelLoadFromFile(pathModel *byte, params LlamaModelParams) (LlamaModel,
 // ffiInitFromModel calls llama_init_from_model using FFI
 func ffiInitFromModel(model LlamaModel, params LlamaContextParams) (LlamaContext, error) {
 	var cif ffi.Cif
-	aTypes := []*ffi.Type{&ffi.TypePointer, &ffiTypeLlamaContextParams}
+	aTypes := []*ffi.Type{&ffi.TypePointer, currentLayout().contextParams}
 	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 2, &ffi.TypePointer, aTypes...); status != ffi.OK {
 		return 0, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
 	}
+	cParams, err := ffiEncodeContextParams(params)
+	if err != nil {
+		return 0, err
+	}
 
 	fnAddr, err := getProcAddressPlatform(libHandle, "llama_init_from_model")
 	if err != nil {
@@ -211,7 +265,7 @@ func ffiInitFromModel(model LlamaModel, params LlamaContextParams) (LlamaContext
 	var result LlamaContext
 	aValues := []unsafe.Pointer{
 		unsafe.Pointer(&model),
-		unsafe.Pointer(&params),
+		cParams,
 	}
 	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result), aValues...)
 
@@ -221,6 +275,26 @@ func ffiInitFromModel(model LlamaModel, params LlamaContextParams) (LlamaContext
 	return result, nil
 }
 
+// ffiBatchFree calls llama_batch_free using FFI
+func ffiBatchFree(batch LlamaBatch) error {
+	var cif ffi.Cif
+	aTypes := []*ffi.Type{&ffiTypeLlamaBatch}
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 1, &ffi.TypeVoid, aTypes...); status != ffi.OK {
+		return fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	}
+
+	fnAddr, err := getProcAddressPlatform(libHandle, "llama_batch_free")
+	if err != nil {
+		return fmt.Errorf("failed to get llama_batch_free address: %w", err)
+	}
+
+	aValues := []unsafe.Pointer{
+		unsafe.Pointer(&batch),
+	}
+	ffi.Call(&cif, fnAddr, nil, aValues...)
+	return nil
+}
+
 // ffiDecode calls llama_decode using FFI
 func ffiDecode(ctx LlamaContext, batch LlamaBatch) (int32, error) {
 	var cif ffi.Cif
@@ -307,3 +381,66 @@ func ffiSamplerChainInit(params LlamaSamplerChainParams) (LlamaSampler, error) {
 	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result), aValues...)
 	return result, nil
 }
+
+// ffiPerfContext calls llama_perf_context using FFI
+func ffiPerfContext(ctx LlamaContext) (LlamaPerfContextData, error) {
+	var cif ffi.Cif
+	aTypes := []*ffi.Type{&ffi.TypePointer}
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 1, &ffiTypeLlamaPerfContextData, aTypes...); status != ffi.OK {
+		return LlamaPerfContextData{}, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	}
+
+	fnAddr, err := getProcAddressPlatform(libHandle, "llama_perf_context")
+	if err != nil {
+		return LlamaPerfContextData{}, fmt.Errorf("failed to get llama_perf_context address: %w", err)
+	}
+
+	var result LlamaPerfContextData
+	aValues := []unsafe.Pointer{
+		unsafe.Pointer(&ctx),
+	}
+	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result), aValues...)
+	return result, nil
+}
+
+// ffiPerfSampler calls llama_perf_sampler using FFI
+func ffiPerfSampler(chain LlamaSampler) (LlamaPerfSamplerData, error) {
+	var cif ffi.Cif
+	aTypes := []*ffi.Type{&ffi.TypePointer}
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 1, &ffiTypeLlamaPerfSamplerData, aTypes...); status != ffi.OK {
+		return LlamaPerfSamplerData{}, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	}
+
+	fnAddr, err := getProcAddressPlatform(libHandle, "llama_perf_sampler")
+	if err != nil {
+		return LlamaPerfSamplerData{}, fmt.Errorf("failed to get llama_perf_sampler address: %w", err)
+	}
+
+	var result LlamaPerfSamplerData
+	aValues := []unsafe.Pointer{
+		unsafe.Pointer(&chain),
+	}
+	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result), aValues...)
+	return result, nil
+}
+
+// ffiGgmlInit calls ggml_init using FFI
+func ffiGgmlInit(params ggmlInitParams) (GgmlContext, error) {
+	var cif ffi.Cif
+	aTypes := []*ffi.Type{&ffiTypeGgmlInitParams}
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 1, &ffi.TypePointer, aTypes...); status != ffi.OK {
+		return 0, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	}
+
+	fnAddr, err := getProcAddressPlatform(libHandle, "ggml_init")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get ggml_init address: %w", err)
+	}
+
+	var result GgmlContext
+	aValues := []unsafe.Pointer{
+		unsafe.Pointer(&params),
+	}
+	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result), aValues...)
+	return result, nil
+}
@@ -52,8 +52,8 @@ func (s *FFISuite) TearDownSuite() {
 
 // Verifies that FFI type definitions are properly structured
 func (s *FFISuite) TestFFITypeDefinitions() {
-	s.Assert().NotZero(ffiTypeLlamaModelParams.Type, "ffiTypeLlamaModelParams Type should not be zero")
-	s.Assert().NotZero(ffiTypeLlamaContextParams.Type, "ffiTypeLlamaContextParams Type should not be zero")
+	s.Assert().NotZero(currentLayout().modelParams.Type, "model params FFI Type should not be zero")
+	s.Assert().NotZero(currentLayout().contextParams.Type, "context params FFI Type should not be zero")
 	s.Assert().NotZero(ffiTypeLlamaSamplerChainParams.Type, "ffiTypeLlamaSamplerChainParams Type should not be zero")
 	s.Assert().NotZero(ffiTypeLlamaBatch.Type, "ffiTypeLlamaBatch Type should not be zero")
 }
@@ -98,10 +98,11 @@ func (s *FFISuite) TestFFIContextDefaultParams() {
 		return
 	}
 
-	s.Assert().NotZero(params.Seed, "Seed should not be zero in default params")
 	s.Assert().NotZero(params.NBatch, "NBatch should not be zero in default params")
-	s.T().Logf("FFI Context default params: Seed=%d, NCtx=%d, NBatch=%d, NThreads=%d",
-		params.Seed, params.NCtx, params.NBatch, params.NThreads)
+	s.Assert().LessOrEqual(params.NUbatch, params.NBatch, "NUbatch should not exceed NBatch")
+	s.Assert().Greater(params.NThreadsBatch, int32(0), "NThreadsBatch should be positive")
+	s.T().Logf("FFI Context default params: NCtx=%d, NBatch=%d, NUbatch=%d, NThreads=%d",
+		params.NCtx, params.NBatch, params.NUbatch, params.NThreads)
 }
 
 // Tests FFI-based sampler chain parameter retrieval
@@ -129,6 +130,28 @@ func (s *FFISuite) TestFFIBatchInit() {
 	}
 }
 
+// Tests FFI-based batch free, including that llama_batch_get_one batches are
+// left alone
+func (s *FFISuite) TestFFIBatchFree() {
+	batch, err := ffiBatchInit(64, 0, 1)
+	s.Require().NoError(err, "FFI batch init failed")
+	s.Require().NotNil(batch.Pos)
+	s.Require().NoError(ffiBatchFree(batch))
+
+	tokens := []LlamaToken{1, 2, 3}
+	s.Require().NotPanics(func() { Batch_free(Batch_get_one(tokens)) })
+	s.Require().NotPanics(func() { Batch_free(Batch_init(8, 0, 1)) })
+}
+
+// Tests FFI-based split model loading with invalid input
+func (s *FFISuite) TestFFIModelLoadFromSplits() {
+	_, err := Model_load_from_splits(nil, Model_default_params())
+	s.ErrorIs(err, ErrInvalidModelPath)
+
+	_, err = Model_load_from_splits([]string{"/nonexistent/model-00001-of-00002.gguf", "/nonexistent/model-00002-of-00002.gguf"}, Model_default_params())
+	s.ErrorIs(err, ErrModelLoadFailed)
+}
+
 // Tests FFI-based encode function
 func (s *FFISuite) TestFFIEncode() {
 	// TODO: Implement a proper test with a valid context and batch
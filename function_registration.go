@@ -93,5 +93,11 @@ func (l *LibraryLoader) ApplyLibraryLoad(info *LibraryLoadInfo, rootPath string)
 		slog.Warn("Failed to get expected library suffix", "error", err)
 	}
 	l.extensionSuffix = suffix
+
+	if l == globalLoader {
+		libMutex.Lock()
+		loaderLibPath = info.Path
+		libMutex.Unlock()
+	}
 	return nil
 }
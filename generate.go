@@ -0,0 +1,378 @@
+package gollama
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// StopReason tells why generation ended.
+type StopReason int
+
+const (
+	// StopEOG means the model produced an end-of-generation token (see
+	// Vocab_is_eog).
+	StopEOG StopReason = iota
+	// StopMaxTokens means the token limit was reached.
+	StopMaxTokens
+	// StopString means a stop string was generated.
+	StopString
+	// StopContextFull means the context has no room for another token.
+	StopContextFull
+)
+
+// String returns the name of the reason.
+func (r StopReason) String() string {
+	switch r {
+	case StopEOG:
+		return "eog"
+	case StopMaxTokens:
+		return "max_tokens"
+	case StopString:
+		return "stop_string"
+	case StopContextFull:
+		return "context_full"
+	default:
+		return fmt.Sprintf("StopReason(%d)", int(r))
+	}
+}
+
+// FinishReason returns the OpenAI finish_reason of the reason: "length"
+// when generation ran out of tokens or context, "stop" otherwise.
+func (r StopReason) FinishReason() string {
+	if r == StopMaxTokens || r == StopContextFull {
+		return "length"
+	}
+	return "stop"
+}
+
+// GenerateOptions configures Context.Generate.
+type GenerateOptions struct {
+	// MaxTokens bounds the number of generated tokens (default 128).
+	MaxTokens int
+	// Stop lists strings that end generation. They are not part of the
+	// output, and text that may start one is held back from OnText until
+	// it is known not to.
+	Stop []string
+	// Sampling configures the sampler; nil uses DefaultSamplingParams.
+	Sampling *SamplingParams
+	// Samplers run on the logits of every step before the sampler chain
+	// selects a token (see GoSampler).
+	Samplers []GoSampler
+	// Seed, when non-zero, replaces the seed of Sampling and so seeds every
+	// stochastic sampler of the chain.
+	Seed uint32
+	// Deterministic makes the output a function of the prompt and the
+	// options: it requires a greedy or seeded sampler and decodes with a
+	// single thread for the duration of the call, since the order of
+	// floating point reductions depends on the thread count. GPU backends
+	// may still not be bit-exact across runs.
+	Deterministic bool
+	// TokenHealing drops the last prompt token and makes the first
+	// generated token start with its text (see HealPrompt), which helps
+	// prompts ending mid-word. The output continues the original prompt:
+	// the dropped text is not repeated in it, and PromptTokens does not
+	// count the dropped token.
+	TokenHealing bool
+	// SeqID is the sequence used; it is cleared before the prompt is
+	// decoded. A prompt starting with the system prompt of the context
+	// (see Context.SetSystemPrompt) forks it instead of decoding it again,
+	// unless SeqID is SystemPromptSeq, which then loses the system prompt.
+	SeqID LlamaSeqId
+	// PromptCache, when set, restores the longest cached prefix of the
+	// prompt instead of decoding it, and caches the state of the prompt
+	// (see PromptCache.Prefill).
+	PromptCache *PromptCache
+	// Prefilled means SeqID already holds the prompt, e.g. one evaluated
+	// by MultimodalContext.Eval, and generation continues after it; the
+	// prompt argument is then ignored and may be empty.
+	Prefilled bool
+	// OnText, when set, receives the output as it is produced, split on
+	// UTF-8 boundaries; returning an error from it aborts generation.
+	OnText func(string) error
+}
+
+// Usage counts the tokens of a generation like the usage object of the
+// OpenAI API.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// GenerateResult is the output of Context.Generate.
+type GenerateResult struct {
+	Text string
+	// Tokens holds every generated token, including those of a stop
+	// string, but not the end-of-generation token.
+	Tokens       []LlamaToken
+	PromptTokens int
+	// CompletionTokens is len(Tokens)
+	CompletionTokens int
+	StopReason       StopReason
+	// Timings measures the prompt processing and every generated token
+	Timings Timings
+}
+
+// Usage returns the token counts of the result.
+func (r GenerateResult) Usage() Usage {
+	return Usage{
+		PromptTokens:     r.PromptTokens,
+		CompletionTokens: r.CompletionTokens,
+		TotalTokens:      r.PromptTokens + r.CompletionTokens,
+	}
+}
+
+// Generate decodes prompt and samples a completion until the model emits
+// an end-of-generation token, a stop string appears, MaxTokens tokens were
+// generated or the context is full. With EnableAutoShift the context never
+// fills up. Cancelling ctx aborts generation and returns ctx.Err() along
+// with the output so far.
+//
+// Example usage:
+//
+//	res, err := c.Generate(context.Background(), tokens, gollama.GenerateOptions{
+//		MaxTokens: 256,
+//		Stop:      []string{"\nUser:"},
+//		OnText:    func(s string) error { fmt.Print(s); return nil },
+//	})
+//	fmt.Println("\nstopped:", res.StopReason)
+func (c *Context) Generate(ctx context.Context, prompt []LlamaToken, opts GenerateOptions) (res GenerateResult, err error) {
+	if c.handle == 0 {
+		return res, ErrContextNotCreated
+	}
+	if opts.Prefilled {
+		if opts.TokenHealing || opts.PromptCache != nil {
+			return res, fmt.Errorf("%w: a prefilled prompt cannot be healed or cached", ErrInvalidParameter)
+		}
+		prompt = nil
+	} else if len(prompt) == 0 {
+		return res, fmt.Errorf("%w: prompt is empty", ErrInvalidParameter)
+	}
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = 128
+	}
+	sampling := DefaultSamplingParams()
+	if opts.Sampling != nil {
+		sampling = *opts.Sampling
+	}
+	if opts.Seed != 0 {
+		sampling.Seed = opts.Seed
+	}
+	if opts.Deterministic {
+		if !sampling.Deterministic() {
+			return res, fmt.Errorf("%w: deterministic generation needs a seed", ErrInvalidSamplingParams)
+		}
+		gen, batch := c.Threads()
+		if err := c.SetThreads(1, 1); err != nil {
+			return res, err
+		}
+		defer c.SetThreads(gen, batch)
+	}
+	sampler, err := NewSamplerChain(sampling)
+	if err != nil {
+		return res, err
+	}
+	defer Sampler_free(sampler)
+
+	var healPiece string
+	var healAllowed []LlamaToken
+	if opts.TokenHealing {
+		prompt, healPiece, healAllowed = HealPrompt(c.model, prompt)
+	}
+
+	timing := NewTiming()
+	defer func() {
+		res.Timings = timing.Timings()
+		countGeneration(res.Timings)
+	}()
+	if opts.SeqID == SystemPromptSeq {
+		c.system = nil
+	}
+	res.PromptTokens = len(prompt)
+	if opts.Prefilled {
+		res.PromptTokens = int(c.SeqPosMax(opts.SeqID) + 1)
+	} else if opts.PromptCache != nil {
+		if _, err := opts.PromptCache.Prefill(c, opts.SeqID, prompt); err != nil {
+			return res, fmt.Errorf("failed to process prompt: %w", err)
+		}
+	} else if n := c.systemPrefix(prompt, opts.SeqID); n > 0 {
+		if _, err := c.ForkSystemPrompt(opts.SeqID); err != nil {
+			return res, err
+		}
+		if err := c.DecodeTokens(prompt[n:], LlamaPos(n), opts.SeqID); err != nil {
+			return res, fmt.Errorf("failed to process prompt: %w", err)
+		}
+	} else {
+		c.SeqRm(opts.SeqID, 0, -1)
+		if err := c.DecodeTokens(prompt, 0, opts.SeqID); err != nil {
+			return res, fmt.Errorf("failed to process prompt: %w", err)
+		}
+	}
+	timing.PromptProcessed(res.PromptTokens)
+	pos := c.SeqPosMax(opts.SeqID) + 1
+
+	var text strings.Builder
+	emit := func(s string) error {
+		text.WriteString(s)
+		if opts.OnText != nil && s != "" {
+			return opts.OnText(s)
+		}
+		return nil
+	}
+	stop := NewStopFilter(opts.Stop)
+	var pending []byte
+	defer func() {
+		res.Text = text.String()
+		res.CompletionTokens = len(res.Tokens)
+	}()
+
+	res.StopReason = StopMaxTokens
+	for len(res.Tokens) < opts.MaxTokens {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if !c.autoShift && int(pos) >= int(c.NCtx) {
+			res.StopReason = StopContextFull
+			break
+		}
+
+		if healAllowed != nil {
+			maskLogits(c.Logits(-1), healAllowed)
+		}
+		ApplyGoSamplers(c.Logits(-1), opts.Samplers...)
+		token := Sampler_sample(sampler, c.handle, -1)
+		if token == LLAMA_TOKEN_NULL {
+			return res, fmt.Errorf("%w: no token sampled", ErrSamplingFailed)
+		}
+		if c.model.IsEOG(token) {
+			res.StopReason = StopEOG
+			break
+		}
+		res.Tokens = append(res.Tokens, token)
+		timing.TokenGenerated()
+		AcceptGoSamplers(token, opts.Samplers...)
+
+		piece := Token_to_piece(c.model.Handle(), token, false)
+		if healAllowed != nil {
+			piece = strings.TrimPrefix(piece, healPiece)
+			healAllowed = nil
+		}
+		var complete []byte
+		complete, pending = splitIncompleteUTF8(append(pending, piece...))
+		out, stopped := stop.Push(string(complete))
+		if err := emit(out); err != nil {
+			return res, err
+		}
+		if stopped {
+			res.StopReason = StopString
+			return res, nil
+		}
+
+		if err := c.DecodeTokens([]LlamaToken{token}, pos, opts.SeqID); err != nil {
+			return res, fmt.Errorf("failed to decode token: %w", err)
+		}
+		pos = c.SeqPosMax(opts.SeqID) + 1
+	}
+
+	out, stopped := stop.Push(string(pending))
+	if stopped {
+		res.StopReason = StopString
+	}
+	return res, emit(out + stop.Flush())
+}
+
+// StopFilter holds back output that may be the start of a stop string, so
+// stop strings spanning several tokens are never streamed.
+//
+// Example usage:
+//
+//	f := gollama.NewStopFilter([]string{"</answer>"})
+//	for piece := range pieces {
+//		out, stopped := f.Push(piece)
+//		fmt.Print(out)
+//		if stopped {
+//			break
+//		}
+//	}
+//	fmt.Print(f.Flush())
+type StopFilter struct {
+	stops   []string
+	held    string
+	stopped bool
+}
+
+// NewStopFilter creates a filter for stops; empty strings are ignored.
+func NewStopFilter(stops []string) *StopFilter {
+	f := &StopFilter{}
+	for _, s := range stops {
+		if s != "" {
+			f.stops = append(f.stops, s)
+		}
+	}
+	return f
+}
+
+// Push adds text and returns what can safely be emitted. The boolean result
+// is true once a stop string was found; the stop string itself and
+// anything after it are dropped.
+func (f *StopFilter) Push(text string) (string, bool) {
+	if f.stopped {
+		return "", true
+	}
+	f.held += text
+
+	cut := -1
+	for _, stop := range f.stops {
+		if i := strings.Index(f.held, stop); i >= 0 && (cut < 0 || i < cut) {
+			cut = i
+		}
+	}
+	if cut >= 0 {
+		out := f.held[:cut]
+		f.held = ""
+		f.stopped = true
+		return out, true
+	}
+
+	keep := 0
+	for _, stop := range f.stops {
+		for n := len(stop) - 1; n > keep; n-- {
+			if strings.HasSuffix(f.held, stop[:n]) {
+				keep = n
+				break
+			}
+		}
+	}
+	out := f.held[:len(f.held)-keep]
+	f.held = f.held[len(f.held)-keep:]
+	return out, false
+}
+
+// Flush returns any held-back text once generation has finished.
+func (f *StopFilter) Flush() string {
+	out := f.held
+	f.held = ""
+	return out
+}
+
+// Stopped reports whether a stop string was found.
+func (f *StopFilter) Stopped() bool {
+	return f.stopped
+}
+
+// splitIncompleteUTF8 splits b before a trailing incomplete UTF-8 sequence,
+// which is completed by the pieces of the following tokens.
+func splitIncompleteUTF8(b []byte) (complete, rest []byte) {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(b[i]) {
+			continue
+		}
+		if !utf8.FullRune(b[i:]) {
+			return b[:i], append([]byte(nil), b[i:]...)
+		}
+		break
+	}
+	return b, nil
+}
@@ -0,0 +1,142 @@
+package gollama
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type GenerateSuite struct{ BaseSuite }
+
+func (s *GenerateSuite) TestStopFilterAcrossPushes() {
+	f := NewStopFilter([]string{"</s>", "", "STOP"})
+	out, stopped := f.Push("Hello <")
+	s.Equal("Hello ", out)
+	s.False(stopped)
+	out, stopped = f.Push("/")
+	s.Equal("", out)
+	s.False(stopped)
+	out, stopped = f.Push("s> world")
+	s.Equal("", out)
+	s.True(stopped)
+	s.True(f.Stopped())
+
+	out, stopped = f.Push("more")
+	s.Equal("", out)
+	s.True(stopped)
+}
+
+func (s *GenerateSuite) TestStopFilterReleasesFalseStarts() {
+	f := NewStopFilter([]string{"STOP"})
+	out, stopped := f.Push("ST")
+	s.Equal("", out)
+	s.False(stopped)
+	out, stopped = f.Push("ART")
+	s.Equal("START", out)
+	s.False(stopped)
+
+	out, _ = f.Push("a S")
+	s.Equal("a ", out)
+	s.Equal("S", f.Flush())
+	s.False(f.Stopped())
+
+	// The earliest stop string wins
+	f = NewStopFilter([]string{"c", "ab"})
+	out, stopped = f.Push("xabc")
+	s.Equal("x", out)
+	s.True(stopped)
+
+	// No stop strings: everything passes through
+	out, stopped = NewStopFilter(nil).Push("anything")
+	s.Equal("anything", out)
+	s.False(stopped)
+}
+
+func (s *GenerateSuite) TestSplitIncompleteUTF8() {
+	complete, rest := splitIncompleteUTF8([]byte("h\xc3"))
+	s.Equal("h", string(complete))
+	s.Equal("\xc3", string(rest))
+
+	complete, rest = splitIncompleteUTF8([]byte("hé"))
+	s.Equal("hé", string(complete))
+	s.Nil(rest)
+}
+
+func (s *GenerateSuite) TestStopReasonString() {
+	s.Equal("eog", StopEOG.String())
+	s.Equal("max_tokens", StopMaxTokens.String())
+	s.Equal("stop_string", StopString.String())
+	s.Equal("context_full", StopContextFull.String())
+	s.Equal("StopReason(9)", StopReason(9).String())
+}
+
+func (s *GenerateSuite) TestStopReasonFinishReason() {
+	s.Equal("stop", StopEOG.FinishReason())
+	s.Equal("stop", StopString.FinishReason())
+	s.Equal("length", StopMaxTokens.FinishReason())
+	s.Equal("length", StopContextFull.FinishReason())
+}
+
+func (s *GenerateSuite) TestGenerateResultUsage() {
+	res := GenerateResult{PromptTokens: 12, CompletionTokens: 5}
+	s.Equal(Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}, res.Usage())
+
+	data, err := json.Marshal(res.Usage())
+	s.Require().NoError(err)
+	s.JSONEq(`{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}`, string(data))
+}
+
+func (s *GenerateSuite) TestGenerateRequiresContext() {
+	_, err := (&Context{}).Generate(context.Background(), []LlamaToken{1}, GenerateOptions{})
+	s.ErrorIs(err, ErrContextNotCreated)
+}
+
+func (s *GenerateSuite) TestGeneratePrefilledRejectsPromptOptions() {
+	c := &Context{handle: 1}
+	_, err := c.Generate(context.Background(), nil, GenerateOptions{Prefilled: true, TokenHealing: true})
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = c.Generate(context.Background(), nil, GenerateOptions{Prefilled: true, PromptCache: &PromptCache{}})
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = c.Generate(context.Background(), nil, GenerateOptions{})
+	s.ErrorIs(err, ErrInvalidParameter, "only a prefilled prompt may be empty")
+}
+
+func (s *GenerateSuite) TestGenerateDeterministic() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	params := Model_default_params()
+	params.NGpuLayers = 0
+	model, err := LoadModel("./models/tinyllama-1.1b-chat-v1.0.Q2_K.gguf", params)
+	if err != nil {
+		s.T().Skipf("model not available: %v", err)
+	}
+	defer model.Free()
+	ctxParams := Context_default_params()
+	ctxParams.NCtx = 256
+	c, err := NewContext(model, ctxParams)
+	s.Require().NoError(err)
+	defer c.Free()
+
+	prompt, err := model.Tokenize("Once upon a time", true, false)
+	s.Require().NoError(err)
+	sampling := SamplingParams{Temperature: 1, TopK: 40, Seed: LLAMA_DEFAULT_SEED}
+	opts := GenerateOptions{MaxTokens: 16, Sampling: &sampling, Seed: 42, Deterministic: true}
+	first, err := c.Generate(context.Background(), prompt, opts)
+	s.Require().NoError(err)
+	second, err := c.Generate(context.Background(), prompt, opts)
+	s.Require().NoError(err)
+	s.Equal(first.Tokens, second.Tokens)
+	s.Equal(len(first.Tokens), first.CompletionTokens)
+	s.Equal(len(prompt), first.Usage().PromptTokens)
+
+	opts.Seed = 0
+	_, err = c.Generate(context.Background(), prompt, opts)
+	s.ErrorIs(err, ErrInvalidSamplingParams)
+}
+
+func TestGenerateSuite(t *testing.T) {
+	suite.Run(t, new(GenerateSuite))
+}
@@ -0,0 +1,290 @@
+package gollama
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// ggmlStatusSuccess is GGML_STATUS_SUCCESS of enum ggml_status.
+const ggmlStatusSuccess = 0
+
+// GgmlGraph is a small ggml computation run on a backend, for custom math
+// such as the cosine similarity of embedding matrices on the GPU. Tensors
+// are float32 matrices of cols x rows values stored row by row; a vector is
+// a matrix with one row.
+//
+// A graph is built in two phases: create the inputs with NewTensor and
+// combine them with Add, Mul, MulMat and Scale, then call Compute as many
+// times as needed with new input values. The first Compute allocates every
+// tensor on the backend, after which no tensor can be added. Shapes are
+// checked in Go, since ggml aborts the process on a mismatch.
+//
+// Example usage:
+//
+//	g, err := gollama.NewGgmlGraph(0, 3) // 0 picks the best backend
+//	if err != nil {
+//		return err
+//	}
+//	defer g.Free()
+//	docs, _ := g.NewTensor(dim, nDocs)      // one normalized embedding per row
+//	queries, _ := g.NewTensor(dim, nQueries)
+//	scores, _ := g.MulMat(docs, queries)    // nDocs x nQueries dot products
+//	out, err := g.Compute(scores, map[gollama.GgmlTensor][]float32{
+//		docs:    docData,
+//		queries: queryData,
+//	})
+//	// out[q*nDocs+d] is the similarity of query q and document d
+type GgmlGraph struct {
+	mu          sync.Mutex
+	ctx         GgmlContext
+	backend     GgmlBackend
+	ownsBackend bool
+	buffer      GgmlBackendBuffer
+	graph       GgmlCgraph
+	tensors     map[GgmlTensor]ggmlTensorInfo
+	outputs     map[GgmlTensor]bool
+	maxTensors  int
+}
+
+// ggmlTensorInfo is the shape of a graph tensor and whether it is an input.
+type ggmlTensorInfo struct {
+	cols, rows int64
+	input      bool
+}
+
+// NewGgmlGraph creates a graph of up to maxTensors tensors, inputs and
+// results included, computed on backend. With a zero backend the best
+// available one is initialized, and freed with the graph; a backend
+// passed in stays owned by the caller and must outlive the graph.
+func NewGgmlGraph(backend GgmlBackend, maxTensors int) (*GgmlGraph, error) {
+	if maxTensors <= 0 {
+		return nil, fmt.Errorf("%w: maxTensors must be positive, got %d", ErrInvalidParameter, maxTensors)
+	}
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+	if ggmlFree == nil || ggmlNewGraph == nil || ggmlBackendAllocCtxTensors == nil || ggmlBackendGraphCompute == nil {
+		return nil, fmt.Errorf("%w: ggml graph functions", ErrFunctionNotFound)
+	}
+
+	ownsBackend := backend == 0
+	if ownsBackend {
+		var err error
+		if backend, err = Ggml_backend_init_best(); err != nil {
+			// Dynamic backends may not be loaded yet
+			if loadErr := Ggml_backend_load_all(); loadErr != nil {
+				return nil, fmt.Errorf("%w: %v", ErrBackendNotAvailable, err)
+			}
+			if backend, err = Ggml_backend_init_best(); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrBackendNotAvailable, err)
+			}
+		}
+	}
+
+	// Tensor and graph metadata only; the data lives in a backend buffer
+	ctx, err := ffiGgmlInit(ggmlInitParams{
+		memSize: uintptr(maxTensors)*ggmlTensorOverhead() + ggmlGraphOverhead(),
+		noAlloc: true,
+	})
+	if err == nil && ctx == 0 {
+		err = ErrMemoryAllocationFailed
+	}
+	if err != nil {
+		if ownsBackend {
+			ggmlBackendFree(backend)
+		}
+		return nil, fmt.Errorf("ggml_init failed: %w", err)
+	}
+	return &GgmlGraph{
+		ctx:         ctx,
+		backend:     backend,
+		ownsBackend: ownsBackend,
+		tensors:     make(map[GgmlTensor]ggmlTensorInfo),
+		outputs:     make(map[GgmlTensor]bool),
+		maxTensors:  maxTensors,
+	}, nil
+}
+
+// Backend returns the backend the graph is computed on.
+func (g *GgmlGraph) Backend() GgmlBackend {
+	return g.backend
+}
+
+// NewTensor adds an input matrix of cols x rows float32 values, set by
+// Compute.
+func (g *GgmlGraph) NewTensor(cols, rows int) (GgmlTensor, error) {
+	if cols <= 0 || rows <= 0 {
+		return 0, fmt.Errorf("%w: tensor shape %dx%d", ErrInvalidParameter, cols, rows)
+	}
+	return g.addTensor(ggmlTensorInfo{cols: int64(cols), rows: int64(rows), input: true}, func() GgmlTensor {
+		return ggmlNewTensor2d(g.ctx, GGML_TYPE_F32, int64(cols), int64(rows))
+	})
+}
+
+// Add returns a + b element-wise. b is repeated over a when its columns
+// and rows divide those of a, e.g. to add a row vector to every row.
+func (g *GgmlGraph) Add(a, b GgmlTensor) (GgmlTensor, error) {
+	return g.elementWise("add", a, b, ggmlAdd)
+}
+
+// Mul returns a * b element-wise, with b repeated over a like in Add.
+func (g *GgmlGraph) Mul(a, b GgmlTensor) (GgmlTensor, error) {
+	return g.elementWise("mul", a, b, ggmlMul)
+}
+
+// MulMat returns the dot products of the rows of a with the rows of b: a
+// matrix with a row per row of b and a column per row of a. a and b must
+// have the same number of columns.
+func (g *GgmlGraph) MulMat(a, b GgmlTensor) (GgmlTensor, error) {
+	ia, ib, err := g.operands(a, b)
+	if err != nil {
+		return 0, err
+	}
+	if ia.cols != ib.cols {
+		return 0, fmt.Errorf("%w: mul_mat of %dx%d and %dx%d", ErrInvalidParameter, ia.cols, ia.rows, ib.cols, ib.rows)
+	}
+	return g.addTensor(ggmlTensorInfo{cols: ia.rows, rows: ib.rows}, func() GgmlTensor {
+		return ggmlMulMat(g.ctx, a, b)
+	})
+}
+
+// Scale returns a multiplied by s.
+func (g *GgmlGraph) Scale(a GgmlTensor, s float32) (GgmlTensor, error) {
+	ia, _, err := g.operands(a, a)
+	if err != nil {
+		return 0, err
+	}
+	return g.addTensor(ggmlTensorInfo{cols: ia.cols, rows: ia.rows}, func() GgmlTensor {
+		return ggmlScale(g.ctx, a, s)
+	})
+}
+
+// Shape returns the columns and rows of a tensor of the graph.
+func (g *GgmlGraph) Shape(t GgmlTensor) (cols, rows int, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	info, ok := g.tensors[t]
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: tensor is not part of the graph", ErrInvalidParameter)
+	}
+	return int(info.cols), int(info.rows), nil
+}
+
+// Compute sets the inputs, computes the graph on its backend and returns
+// the values of out, row by row. Every input out depends on must be given
+// on the first call; later calls only need the inputs that changed.
+func (g *GgmlGraph) Compute(out GgmlTensor, inputs map[GgmlTensor][]float32) ([]float32, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ctx == 0 {
+		return nil, fmt.Errorf("%w: graph is freed", ErrInvalidParameter)
+	}
+	info, ok := g.tensors[out]
+	if !ok {
+		return nil, fmt.Errorf("%w: output is not part of the graph", ErrInvalidParameter)
+	}
+	for t, values := range inputs {
+		in, ok := g.tensors[t]
+		if !ok || !in.input {
+			return nil, fmt.Errorf("%w: input is not a tensor created with NewTensor", ErrInvalidParameter)
+		}
+		if int64(len(values)) != in.cols*in.rows {
+			return nil, fmt.Errorf("%w: input of %dx%d given %d values", ErrInvalidParameter, in.cols, in.rows, len(values))
+		}
+	}
+
+	if g.graph == 0 {
+		g.graph = ggmlNewGraph(g.ctx)
+		if g.graph == 0 {
+			return nil, fmt.Errorf("%w: ggml_new_graph", ErrMemoryAllocationFailed)
+		}
+	}
+	if !g.outputs[out] {
+		ggmlBuildForwardExpand(g.graph, out)
+		g.outputs[out] = true
+	}
+	if g.buffer == 0 {
+		g.buffer = ggmlBackendAllocCtxTensors(g.ctx, g.backend)
+		if g.buffer == 0 {
+			return nil, fmt.Errorf("%w: ggml_backend_alloc_ctx_tensors", ErrMemoryAllocationFailed)
+		}
+	}
+
+	for t, values := range inputs {
+		ggmlBackendTensorSet(t, unsafe.Pointer(&values[0]), 0, uintptr(len(values))*4)
+	}
+	if status := ggmlBackendGraphCompute(g.backend, g.graph); status != ggmlStatusSuccess {
+		return nil, fmt.Errorf("ggml_backend_graph_compute failed with status %d", status)
+	}
+	result := make([]float32, info.cols*info.rows)
+	ggmlBackendTensorGet(out, unsafe.Pointer(&result[0]), 0, uintptr(len(result))*4)
+	return result, nil
+}
+
+// Free releases the tensors, the graph and, when the graph created it, the
+// backend. Free is idempotent.
+func (g *GgmlGraph) Free() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ctx == 0 {
+		return
+	}
+	if g.buffer != 0 && ggmlBackendBufferFree != nil {
+		ggmlBackendBufferFree(g.buffer)
+	}
+	ggmlFree(g.ctx)
+	if g.ownsBackend && ggmlBackendFree != nil {
+		ggmlBackendFree(g.backend)
+	}
+	g.ctx, g.buffer, g.graph, g.backend = 0, 0, 0, 0
+	g.tensors, g.outputs = nil, nil
+}
+
+// elementWise adds the result of a binary operation whose b operand is
+// repeated over a.
+func (g *GgmlGraph) elementWise(name string, a, b GgmlTensor, op func(GgmlContext, GgmlTensor, GgmlTensor) GgmlTensor) (GgmlTensor, error) {
+	ia, ib, err := g.operands(a, b)
+	if err != nil {
+		return 0, err
+	}
+	if ia.cols%ib.cols != 0 || ia.rows%ib.rows != 0 {
+		return 0, fmt.Errorf("%w: %s of %dx%d and %dx%d", ErrInvalidParameter, name, ia.cols, ia.rows, ib.cols, ib.rows)
+	}
+	return g.addTensor(ggmlTensorInfo{cols: ia.cols, rows: ia.rows}, func() GgmlTensor {
+		return op(g.ctx, a, b)
+	})
+}
+
+// operands returns the shapes of a and b.
+func (g *GgmlGraph) operands(a, b GgmlTensor) (ggmlTensorInfo, ggmlTensorInfo, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ia, okA := g.tensors[a]
+	ib, okB := g.tensors[b]
+	if !okA || !okB {
+		return ia, ib, fmt.Errorf("%w: operand is not part of the graph", ErrInvalidParameter)
+	}
+	return ia, ib, nil
+}
+
+// addTensor creates a tensor with create while the graph is still being
+// built and has room for it.
+func (g *GgmlGraph) addTensor(info ggmlTensorInfo, create func() GgmlTensor) (GgmlTensor, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case g.ctx == 0:
+		return 0, fmt.Errorf("%w: graph is freed", ErrInvalidParameter)
+	case g.buffer != 0:
+		return 0, fmt.Errorf("%w: tensors cannot be added after the first Compute", ErrInvalidParameter)
+	case len(g.tensors) >= g.maxTensors:
+		return 0, fmt.Errorf("%w: graph holds at most %d tensors", ErrParameterOutOfRange, g.maxTensors)
+	}
+	t := create()
+	if t == 0 {
+		return 0, fmt.Errorf("%w: ggml tensor", ErrMemoryAllocationFailed)
+	}
+	g.tensors[t] = info
+	return t, nil
+}
@@ -0,0 +1,101 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type GgmlGraphSuite struct{ BaseSuite }
+
+func (s *GgmlGraphSuite) newGraph(maxTensors int) *GgmlGraph {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	g, err := NewGgmlGraph(0, maxTensors)
+	if err != nil {
+		s.T().Skipf("ggml graphs not available: %v", err)
+	}
+	s.T().Cleanup(g.Free)
+	return g
+}
+
+func (s *GgmlGraphSuite) TestInvalidSize() {
+	_, err := NewGgmlGraph(0, 0)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *GgmlGraphSuite) TestMulMatSimilarity() {
+	g := s.newGraph(3)
+	docs, err := g.NewTensor(2, 3)
+	s.Require().NoError(err)
+	queries, err := g.NewTensor(2, 2)
+	s.Require().NoError(err)
+	scores, err := g.MulMat(docs, queries)
+	s.Require().NoError(err)
+	cols, rows, err := g.Shape(scores)
+	s.Require().NoError(err)
+	s.Equal([]int{3, 2}, []int{cols, rows})
+
+	out, err := g.Compute(scores, map[GgmlTensor][]float32{
+		docs:    {1, 0, 0, 1, 0.6, 0.8},
+		queries: {1, 0, 0.6, 0.8},
+	})
+	s.Require().NoError(err)
+	s.InDeltaSlice([]float32{1, 0, 0.6, 0.6, 0.8, 1}, out, 1e-5)
+
+	// Inputs keep their values between calls
+	out, err = g.Compute(scores, map[GgmlTensor][]float32{queries: {0, 1, 0, 2}})
+	s.Require().NoError(err)
+	s.InDeltaSlice([]float32{0, 1, 0.8, 0, 2, 1.6}, out, 1e-5)
+
+	_, err = g.NewTensor(2, 2)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *GgmlGraphSuite) TestElementWise() {
+	g := s.newGraph(5)
+	m, err := g.NewTensor(2, 2)
+	s.Require().NoError(err)
+	row, err := g.NewTensor(2, 1)
+	s.Require().NoError(err)
+	sum, err := g.Add(m, row)
+	s.Require().NoError(err)
+	prod, err := g.Mul(sum, row)
+	s.Require().NoError(err)
+	scaled, err := g.Scale(prod, 0.5)
+	s.Require().NoError(err)
+	_, err = g.NewTensor(1, 1)
+	s.ErrorIs(err, ErrParameterOutOfRange)
+
+	out, err := g.Compute(scaled, map[GgmlTensor][]float32{
+		m:   {1, 2, 3, 4},
+		row: {10, 20},
+	})
+	s.Require().NoError(err)
+	s.InDeltaSlice([]float32{55, 220, 65, 240}, out, 1e-4)
+}
+
+func (s *GgmlGraphSuite) TestShapeChecks() {
+	g := s.newGraph(4)
+	a, err := g.NewTensor(3, 2)
+	s.Require().NoError(err)
+	b, err := g.NewTensor(2, 2)
+	s.Require().NoError(err)
+
+	_, err = g.MulMat(a, b)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = g.Add(a, b)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = g.NewTensor(0, 1)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = g.Compute(a, map[GgmlTensor][]float32{a: {1, 2}})
+	s.ErrorIs(err, ErrInvalidParameter)
+
+	g.Free()
+	g.Free()
+	_, err = g.Compute(a, nil)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func TestGgmlGraphSuite(t *testing.T) { suite.Run(t, new(GgmlGraphSuite)) }
@@ -0,0 +1,163 @@
+package gollama
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/jupiterrider/ffi"
+)
+
+// ggmlTypeTraits mirrors struct ggml_type_traits
+type ggmlTypeTraits struct {
+	typeName           *byte
+	blckSize           int64
+	blckSizeInterleave int64
+	typeSize           uintptr
+	isQuantized        bool
+	toFloat            uintptr // void (*)(const void * x, float * y, int64_t k)
+	fromFloatRef       uintptr
+}
+
+// quantizableTypes are the types ggml_quantize_chunk accepts; it aborts
+// the process on any other.
+var quantizableTypes = map[GgmlType]bool{
+	GGML_TYPE_F32: true, GGML_TYPE_F16: true, GGML_TYPE_BF16: true,
+	GGML_TYPE_Q4_0: true, GGML_TYPE_Q4_1: true, GGML_TYPE_Q5_0: true, GGML_TYPE_Q5_1: true, GGML_TYPE_Q8_0: true,
+	GGML_TYPE_Q2_K: true, GGML_TYPE_Q3_K: true, GGML_TYPE_Q4_K: true, GGML_TYPE_Q5_K: true, GGML_TYPE_Q6_K: true,
+	GGML_TYPE_IQ2_XXS: true, GGML_TYPE_IQ2_XS: true, GGML_TYPE_IQ3_XXS: true, GGML_TYPE_IQ3_S: true,
+	GGML_TYPE_IQ2_S: true, GGML_TYPE_IQ1_S: true, GGML_TYPE_IQ1_M: true, GGML_TYPE_IQ4_NL: true, GGML_TYPE_IQ4_XS: true,
+}
+
+// typeTraits returns the ggml traits of typ.
+func typeTraits(typ GgmlType) (*ggmlTypeTraits, error) {
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+	if ggmlGetTypeTraits == nil {
+		return nil, fmt.Errorf("ggml_get_type_traits function not available")
+	}
+	if typ < 0 || typ >= GGML_TYPE_COUNT {
+		return nil, fmt.Errorf("%w: unknown ggml type %d", ErrInvalidParameter, typ)
+	}
+	traits := ggmlGetTypeTraits(typ)
+	if traits == nil || traits.blckSize <= 0 || traits.typeSize == 0 {
+		return nil, fmt.Errorf("%w: ggml type %s has no storage", ErrInvalidParameter, typ)
+	}
+	return traits, nil
+}
+
+// Ggml_row_bytes returns the size in bytes of a row of n values of typ. n
+// must be a multiple of the block size of typ.
+func Ggml_row_bytes(typ GgmlType, n int) (int, error) {
+	traits, err := typeTraits(typ)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || int64(n)%traits.blckSize != 0 {
+		return 0, fmt.Errorf("%w: %d values are not whole %s blocks of %d", ErrInvalidParameter, n, typ, traits.blckSize)
+	}
+	return int(int64(n) / traits.blckSize * int64(traits.typeSize)), nil
+}
+
+// Ggml_quantize_requires_imatrix reports whether quantizing to typ needs an
+// importance matrix
+func Ggml_quantize_requires_imatrix(typ GgmlType) (bool, error) {
+	if err := ensureLoaded(); err != nil {
+		return false, err
+	}
+	if ggmlQuantizeRequiresImatrix == nil {
+		return false, fmt.Errorf("ggml_quantize_requires_imatrix function not available")
+	}
+	return ggmlQuantizeRequiresImatrix(typ), nil
+}
+
+// Ggml_quantize converts src, rows of nPerRow values, to typ with the
+// quantization used in GGUF files, e.g. to store embeddings compactly.
+// nPerRow must be a multiple of the block size of typ (32 for Q8_0, 256 for
+// the K-quants). imatrix holds nPerRow importance weights; it may be nil
+// unless Ggml_quantize_requires_imatrix(typ). The result is rows of
+// Ggml_row_bytes(typ, nPerRow) bytes, which Ggml_dequantize reverses.
+//
+// Example usage:
+//
+//	data, err := gollama.Ggml_quantize(gollama.GGML_TYPE_Q8_0, embeddings, dim, nil)
+//	if err != nil {
+//		return err
+//	}
+//	restored, err := gollama.Ggml_dequantize(gollama.GGML_TYPE_Q8_0, data, len(embeddings))
+func Ggml_quantize(typ GgmlType, src []float32, nPerRow int, imatrix []float32) ([]byte, error) {
+	if !quantizableTypes[typ] {
+		return nil, fmt.Errorf("%w: cannot quantize to %s", ErrInvalidParameter, typ)
+	}
+	if nPerRow <= 0 || len(src) == 0 || len(src)%nPerRow != 0 {
+		return nil, fmt.Errorf("%w: %d values are not whole rows of %d", ErrInvalidParameter, len(src), nPerRow)
+	}
+	rowBytes, err := Ggml_row_bytes(typ, nPerRow)
+	if err != nil {
+		return nil, err
+	}
+	if ggmlQuantizeChunk == nil {
+		return nil, fmt.Errorf("ggml_quantize_chunk function not available")
+	}
+	var imatrixPtr *float32
+	if imatrix != nil {
+		if len(imatrix) != nPerRow {
+			return nil, fmt.Errorf("%w: importance matrix of %d values for rows of %d", ErrInvalidParameter, len(imatrix), nPerRow)
+		}
+		imatrixPtr = &imatrix[0]
+	} else if required, err := Ggml_quantize_requires_imatrix(typ); err != nil || required {
+		return nil, fmt.Errorf("%w: quantizing to %s requires an importance matrix", ErrMissingParameter, typ)
+	}
+
+	nRows := len(src) / nPerRow
+	dst := make([]byte, nRows*rowBytes)
+	written := ggmlQuantizeChunk(typ, &src[0], unsafe.Pointer(&dst[0]), 0, int64(nRows), int64(nPerRow), imatrixPtr)
+	if int(written) != len(dst) {
+		return nil, fmt.Errorf("ggml_quantize_chunk wrote %d bytes, expected %d", written, len(dst))
+	}
+	return dst, nil
+}
+
+// Ggml_dequantize converts data of typ back to n float32 values. data must
+// hold exactly n values, a whole number of blocks.
+func Ggml_dequantize(typ GgmlType, data []byte, n int) ([]float32, error) {
+	traits, err := typeTraits(typ)
+	if err != nil {
+		return nil, err
+	}
+	size, err := Ggml_row_bytes(typ, n)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 || len(data) != size {
+		return nil, fmt.Errorf("%w: %d bytes of %s for %d values, expected %d", ErrInvalidParameter, len(data), typ, n, size)
+	}
+	dst := make([]float32, n)
+	if typ == GGML_TYPE_F32 {
+		copy(dst, unsafe.Slice((*float32)(unsafe.Pointer(&data[0])), n))
+		return dst, nil
+	}
+	if traits.toFloat == 0 {
+		return nil, fmt.Errorf("%w: ggml type %s cannot be converted to float", ErrInvalidParameter, typ)
+	}
+	if err := ffiToFloat(traits.toFloat, unsafe.Pointer(&data[0]), &dst[0], int64(n)); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// ffiToFloat calls a ggml_to_float_t conversion function using FFI
+func ffiToFloat(fn uintptr, x unsafe.Pointer, y *float32, k int64) error {
+	var cif ffi.Cif
+	aTypes := []*ffi.Type{&ffi.TypePointer, &ffi.TypePointer, &ffi.TypeSint64}
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 3, &ffi.TypeVoid, aTypes...); status != ffi.OK {
+		return fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	}
+	aValues := []unsafe.Pointer{
+		unsafe.Pointer(&x),
+		unsafe.Pointer(&y),
+		unsafe.Pointer(&k),
+	}
+	ffi.Call(&cif, fn, nil, aValues...)
+	return nil
+}
@@ -0,0 +1,95 @@
+package gollama
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type GgmlQuantizeSuite struct{ BaseSuite }
+
+func (s *GgmlQuantizeSuite) SetupTest() {
+	s.BaseSuite.SetupTest()
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	if ggmlGetTypeTraits == nil || ggmlQuantizeChunk == nil {
+		s.T().Skip("ggml quantization functions not exported")
+	}
+}
+
+// testVectors returns rows of n values in [-1, 1).
+func testVectors(rows, n int) []float32 {
+	v := make([]float32, rows*n)
+	for i := range v {
+		v[i] = float32(math.Sin(float64(i) * 0.37))
+	}
+	return v
+}
+
+func (s *GgmlQuantizeSuite) TestTypeTraitsLayout() {
+	for _, typ := range []GgmlType{GGML_TYPE_F16, GGML_TYPE_Q8_0, GGML_TYPE_Q4_K} {
+		traits, err := typeTraits(typ)
+		s.Require().NoError(err)
+		name, _ := Ggml_type_name(typ)
+		size, _ := Ggml_type_size(typ)
+		blck, _ := Ggml_blck_size(typ)
+		s.Equal(name, bytePointerToString(traits.typeName))
+		s.Equal(size, uint64(traits.typeSize))
+		s.Equal(int64(blck), traits.blckSize)
+		s.True(traits.isQuantized || typ == GGML_TYPE_F16)
+	}
+	_, err := typeTraits(GgmlType(4)) // removed Q4_2
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *GgmlQuantizeSuite) TestRoundTrip() {
+	const dim = 256
+	src := testVectors(3, dim)
+	for _, tc := range []struct {
+		typ GgmlType
+		tol float64
+	}{
+		{GGML_TYPE_F32, 0},
+		{GGML_TYPE_F16, 1e-3},
+		{GGML_TYPE_Q8_0, 1e-2},
+		{GGML_TYPE_Q4_K, 0.1},
+	} {
+		data, err := Ggml_quantize(tc.typ, src, dim, nil)
+		s.Require().NoError(err, tc.typ.String())
+		rowBytes, err := Ggml_row_bytes(tc.typ, dim)
+		s.Require().NoError(err)
+		s.Len(data, 3*rowBytes)
+
+		out, err := Ggml_dequantize(tc.typ, data, len(src))
+		s.Require().NoError(err, tc.typ.String())
+		s.InDeltaSlice(src, out, tc.tol, tc.typ.String())
+	}
+}
+
+func (s *GgmlQuantizeSuite) TestValidation() {
+	src := testVectors(1, 64)
+	_, err := Ggml_quantize(GGML_TYPE_Q8_1, src, 64, nil)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = Ggml_quantize(GGML_TYPE_Q8_0, src, 48, nil)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = Ggml_quantize(GGML_TYPE_Q4_K, src, 64, nil)
+	s.ErrorIs(err, ErrInvalidParameter, "K-quants use blocks of 256")
+	_, err = Ggml_quantize(GGML_TYPE_Q8_0, src, 64, make([]float32, 32))
+	s.ErrorIs(err, ErrInvalidParameter)
+
+	if required, _ := Ggml_quantize_requires_imatrix(GGML_TYPE_IQ2_XXS); required {
+		_, err = Ggml_quantize(GGML_TYPE_IQ2_XXS, testVectors(1, 256), 256, nil)
+		s.ErrorIs(err, ErrMissingParameter)
+	}
+
+	data, err := Ggml_quantize(GGML_TYPE_Q8_0, src, 64, nil)
+	s.Require().NoError(err)
+	_, err = Ggml_dequantize(GGML_TYPE_Q8_0, data[:len(data)-1], 64)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = Ggml_dequantize(GGML_TYPE_Q8_0, data, 63)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func TestGgmlQuantizeSuite(t *testing.T) { suite.Run(t, new(GgmlQuantizeSuite)) }
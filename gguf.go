@@ -0,0 +1,337 @@
+package gollama
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// ggufMagic opens every GGUF file ("GGUF" in little-endian order).
+const ggufMagic = 0x46554747
+
+// ggufDefaultAlignment is the tensor data alignment when general.alignment
+// is not set.
+const ggufDefaultAlignment = 32
+
+// maxGGUFString bounds strings and array lengths read from a GGUF header,
+// so a corrupt file fails instead of exhausting memory.
+const maxGGUFString = 1 << 26
+
+// GGUF metadata value types.
+const (
+	ggufTypeUint8 uint32 = iota
+	ggufTypeInt8
+	ggufTypeUint16
+	ggufTypeInt16
+	ggufTypeUint32
+	ggufTypeInt32
+	ggufTypeFloat32
+	ggufTypeBool
+	ggufTypeString
+	ggufTypeArray
+	ggufTypeUint64
+	ggufTypeInt64
+	ggufTypeFloat64
+)
+
+// GGUFTensorInfo describes a tensor of a GGUF file.
+type GGUFTensorInfo struct {
+	Name string
+	Dims []uint64
+	Type GgmlType
+	// Offset is relative to the start of the tensor data
+	Offset uint64
+	// Size is the bytes up to the next tensor, alignment padding included
+	Size uint64
+}
+
+// GGUFFile is the header of a GGUF file: its metadata and tensor layout.
+// Tensor data is not read.
+type GGUFFile struct {
+	Version uint32
+	// Metadata values are uint8..uint64, int8..int64, float32, float64,
+	// bool, string or []any for arrays
+	Metadata map[string]any
+	Tensors  []GGUFTensorInfo
+	// DataOffset is where the tensor data starts in the file
+	DataOffset int64
+}
+
+// ReadGGUF reads the header of a GGUF file without loading the library.
+func ReadGGUF(path string) (*GGUFFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidModelPath, err)
+	}
+	defer func() {
+		_ = f.Close() // Ignore error in defer
+	}()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ggufReader{r: bufio.NewReaderSize(f, 1<<16)}
+	file, err := r.readHeader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFileFormat, path, err)
+	}
+
+	alignment := uint64(ggufDefaultAlignment)
+	if a, ok := file.MetaUint("general.alignment"); ok && a > 0 {
+		alignment = a
+	}
+	file.DataOffset = int64((r.n + alignment - 1) / alignment * alignment)
+
+	// Tensor sizes follow from the offsets of the next tensor and the file size
+	dataSize := uint64(0)
+	if info.Size() > file.DataOffset {
+		dataSize = uint64(info.Size() - file.DataOffset)
+	}
+	order := make([]int, len(file.Tensors))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return file.Tensors[order[a]].Offset < file.Tensors[order[b]].Offset })
+	for i, idx := range order {
+		end := dataSize
+		if i+1 < len(order) {
+			end = file.Tensors[order[i+1]].Offset
+		}
+		if t := &file.Tensors[idx]; end > t.Offset {
+			t.Size = end - t.Offset
+		}
+	}
+	return file, nil
+}
+
+// MetaString returns a string metadata value.
+func (g *GGUFFile) MetaString(key string) (string, bool) {
+	s, ok := g.Metadata[key].(string)
+	return s, ok
+}
+
+// MetaUint returns an integer metadata value of any width, if it is not
+// negative.
+func (g *GGUFFile) MetaUint(key string) (uint64, bool) {
+	switch v := g.Metadata[key].(type) {
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case int8:
+		return uint64(v), v >= 0
+	case int16:
+		return uint64(v), v >= 0
+	case int32:
+		return uint64(v), v >= 0
+	case int64:
+		return uint64(v), v >= 0
+	default:
+		return 0, false
+	}
+}
+
+// ggufReader decodes little-endian GGUF values and counts the bytes read.
+type ggufReader struct {
+	r   io.Reader
+	n   uint64
+	buf [8]byte
+}
+
+func (r *ggufReader) read(n int) ([]byte, error) {
+	if _, err := io.ReadFull(r.r, r.buf[:n]); err != nil {
+		return nil, err
+	}
+	r.n += uint64(n)
+	return r.buf[:n], nil
+}
+
+func (r *ggufReader) u32() (uint32, error) {
+	b, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r *ggufReader) u64() (uint64, error) {
+	b, err := r.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (r *ggufReader) str() (string, error) {
+	n, err := r.u64()
+	if err != nil {
+		return "", err
+	}
+	if n > maxGGUFString {
+		return "", fmt.Errorf("string of %d bytes", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return "", err
+	}
+	r.n += n
+	return string(b), nil
+}
+
+func (r *ggufReader) readHeader() (*GGUFFile, error) {
+	magic, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	if magic != ggufMagic {
+		return nil, fmt.Errorf("not a GGUF file")
+	}
+	version, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	if version < 2 || version > 3 {
+		return nil, fmt.Errorf("unsupported GGUF version %d", version)
+	}
+	nTensors, err := r.u64()
+	if err != nil {
+		return nil, err
+	}
+	nKV, err := r.u64()
+	if err != nil {
+		return nil, err
+	}
+	if nTensors > maxGGUFString || nKV > maxGGUFString {
+		return nil, fmt.Errorf("implausible header: %d tensors, %d keys", nTensors, nKV)
+	}
+
+	file := &GGUFFile{Version: version, Metadata: make(map[string]any, nKV)}
+	for i := uint64(0); i < nKV; i++ {
+		key, err := r.str()
+		if err != nil {
+			return nil, err
+		}
+		typ, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.value(typ)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %s: %w", key, err)
+		}
+		file.Metadata[key] = value
+	}
+
+	file.Tensors = make([]GGUFTensorInfo, nTensors)
+	for i := range file.Tensors {
+		t := &file.Tensors[i]
+		if t.Name, err = r.str(); err != nil {
+			return nil, err
+		}
+		nDims, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		if nDims > 8 {
+			return nil, fmt.Errorf("tensor %s has %d dimensions", t.Name, nDims)
+		}
+		t.Dims = make([]uint64, nDims)
+		for d := range t.Dims {
+			if t.Dims[d], err = r.u64(); err != nil {
+				return nil, err
+			}
+		}
+		typ, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		t.Type = GgmlType(typ)
+		if t.Offset, err = r.u64(); err != nil {
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+func (r *ggufReader) value(typ uint32) (any, error) {
+	switch typ {
+	case ggufTypeUint8, ggufTypeInt8, ggufTypeBool:
+		b, err := r.read(1)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case ggufTypeInt8:
+			return int8(b[0]), nil
+		case ggufTypeBool:
+			return b[0] != 0, nil
+		}
+		return b[0], nil
+	case ggufTypeUint16, ggufTypeInt16:
+		b, err := r.read(2)
+		if err != nil {
+			return nil, err
+		}
+		v := binary.LittleEndian.Uint16(b)
+		if typ == ggufTypeInt16 {
+			return int16(v), nil
+		}
+		return v, nil
+	case ggufTypeUint32, ggufTypeInt32, ggufTypeFloat32:
+		v, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case ggufTypeInt32:
+			return int32(v), nil
+		case ggufTypeFloat32:
+			return math.Float32frombits(v), nil
+		}
+		return v, nil
+	case ggufTypeUint64, ggufTypeInt64, ggufTypeFloat64:
+		v, err := r.u64()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case ggufTypeInt64:
+			return int64(v), nil
+		case ggufTypeFloat64:
+			return math.Float64frombits(v), nil
+		}
+		return v, nil
+	case ggufTypeString:
+		return r.str()
+	case ggufTypeArray:
+		elemType, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		n, err := r.u64()
+		if err != nil {
+			return nil, err
+		}
+		if n > maxGGUFString {
+			return nil, fmt.Errorf("array of %d elements", n)
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = r.value(elemType); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unknown value type %d", typ)
+	}
+}
@@ -0,0 +1,111 @@
+package gollama
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type GGUFSuite struct{ BaseSuite }
+
+// testTensor is a tensor written by writeTestGGUF.
+type testTensor struct {
+	name string
+	size int
+}
+
+// writeTestGGUF writes a GGUF v3 file with the given metadata (uint32,
+// string or []string values) and tensors of the given sizes.
+func writeTestGGUF(t *testing.T, path string, meta map[string]any, tensors []testTensor) {
+	t.Helper()
+	var b bytes.Buffer
+	le := func(v any) { _ = binary.Write(&b, binary.LittleEndian, v) }
+	str := func(s string) { le(uint64(len(s))); b.WriteString(s) }
+
+	le(uint32(ggufMagic))
+	le(uint32(3))
+	le(uint64(len(tensors)))
+	le(uint64(len(meta)))
+	for k, v := range meta {
+		str(k)
+		switch v := v.(type) {
+		case uint32:
+			le(ggufTypeUint32)
+			le(v)
+		case string:
+			le(ggufTypeString)
+			str(v)
+		case []string:
+			le(ggufTypeArray)
+			le(ggufTypeString)
+			le(uint64(len(v)))
+			for _, s := range v {
+				str(s)
+			}
+		default:
+			t.Fatalf("unsupported metadata type %T", v)
+		}
+	}
+	var offset uint64
+	for _, tensor := range tensors {
+		str(tensor.name)
+		le(uint32(1))
+		le(uint64(tensor.size))
+		le(uint32(GGML_TYPE_F32))
+		le(offset)
+		offset += uint64(tensor.size+31) / 32 * 32
+	}
+	for b.Len()%32 != 0 {
+		b.WriteByte(0)
+	}
+	b.Write(make([]byte, offset))
+	if err := os.WriteFile(path, b.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *GGUFSuite) TestReadGGUF() {
+	path := filepath.Join(s.T().TempDir(), "m.gguf")
+	writeTestGGUF(s.T(), path, map[string]any{
+		"general.architecture":  "llama",
+		"llama.block_count":     uint32(2),
+		"tokenizer.ggml.tokens": []string{"a", "b"},
+	}, []testTensor{{"token_embd.weight", 100}, {"blk.0.attn_q.weight", 64}})
+
+	f, err := ReadGGUF(path)
+	s.Require().NoError(err)
+	s.Equal(uint32(3), f.Version)
+	arch, ok := f.MetaString("general.architecture")
+	s.True(ok)
+	s.Equal("llama", arch)
+	n, ok := f.MetaUint("llama.block_count")
+	s.True(ok)
+	s.Equal(uint64(2), n)
+	s.Equal([]any{"a", "b"}, f.Metadata["tokenizer.ggml.tokens"])
+
+	s.Require().Len(f.Tensors, 2)
+	s.Equal("token_embd.weight", f.Tensors[0].Name)
+	s.Equal([]uint64{100}, f.Tensors[0].Dims)
+	s.Equal(GGML_TYPE_F32, f.Tensors[0].Type)
+	s.Equal(uint64(128), f.Tensors[0].Size) // padded to the alignment
+	s.Equal(uint64(64), f.Tensors[1].Size)
+	s.Zero(f.DataOffset % 32)
+}
+
+func (s *GGUFSuite) TestReadGGUFRejectsOtherFiles() {
+	path := filepath.Join(s.T().TempDir(), "m.gguf")
+	s.Require().NoError(os.WriteFile(path, []byte("not a model file"), 0o600))
+	_, err := ReadGGUF(path)
+	s.ErrorIs(err, ErrInvalidFileFormat)
+
+	_, err = ReadGGUF(filepath.Join(s.T().TempDir(), "missing.gguf"))
+	s.ErrorIs(err, ErrInvalidModelPath)
+}
+
+func TestGGUFSuite(t *testing.T) {
+	suite.Run(t, new(GGUFSuite))
+}
@@ -0,0 +1,144 @@
+package gollama
+
+import "math"
+
+// GoSampler is sampling logic written in Go. Apply filters or rescales the
+// candidate tokens before the native sampler chain makes the final
+// selection: Context.Generate calls it on the logits of every step (see
+// GenerateOptions.Samplers), and ApplyGoSamplers does the same for custom
+// loops.
+//
+// Samplers that depend on the generated text also implement
+// GoSamplerAcceptor.
+type GoSampler interface {
+	Apply(cur *LlamaTokenDataArray)
+}
+
+// GoSamplerAcceptor is implemented by GoSamplers that track the tokens
+// selected so far.
+type GoSamplerAcceptor interface {
+	Accept(token LlamaToken)
+}
+
+// ApplyGoSamplers runs samplers on logits, a row as returned by
+// Context.Logits, and writes the result back: rescaled logits are stored
+// and the tokens a sampler removed get a logit of -Inf, so the native
+// sampler chain run next cannot select them.
+//
+// Example usage:
+//
+//	gollama.ApplyGoSamplers(ctx.Logits(-1), blocker)
+//	token := gollama.Sampler_sample(chain, ctx.Handle(), -1)
+//	gollama.AcceptGoSamplers(token, blocker)
+func ApplyGoSamplers(logits []float32, samplers ...GoSampler) {
+	if len(samplers) == 0 || len(logits) == 0 {
+		return
+	}
+	cur := NewTokenDataArray(logits, 0)
+	for _, s := range samplers {
+		s.Apply(cur)
+	}
+	negInf := float32(math.Inf(-1))
+	for i := range logits {
+		logits[i] = negInf
+	}
+	for _, d := range cur.Slice() {
+		if d.Id >= 0 && int(d.Id) < len(logits) {
+			logits[d.Id] = d.Logit
+		}
+	}
+}
+
+// AcceptGoSamplers passes the selected token to the samplers implementing
+// GoSamplerAcceptor.
+func AcceptGoSamplers(token LlamaToken, samplers ...GoSampler) {
+	for _, s := range samplers {
+		if a, ok := s.(GoSamplerAcceptor); ok {
+			a.Accept(token)
+		}
+	}
+}
+
+// NGramBlocker is a GoSampler that removes the tokens that would complete a
+// forbidden n-gram: any n-gram of N tokens already generated, which stops
+// the loops small models fall into, and the banned token sequences. A
+// token is only removed while other candidates remain.
+type NGramBlocker struct {
+	// N is the length of the n-grams that may not repeat; 0 disables the
+	// repetition guard.
+	N int
+	// Banned lists token sequences that may never be generated, e.g. the
+	// tokenizations of banned words.
+	Banned [][]LlamaToken
+
+	history []LlamaToken
+}
+
+// NewNGramBlocker creates a blocker for repeated n-grams of n tokens and
+// for the banned sequences.
+//
+// Example usage:
+//
+//	banned, _ := model.Tokenize(" darn", false, false)
+//	blocker := gollama.NewNGramBlocker(3, banned)
+//	res, err := ctx.Generate(context.Background(), prompt, gollama.GenerateOptions{
+//		Samplers: []gollama.GoSampler{blocker},
+//	})
+func NewNGramBlocker(n int, banned ...[]LlamaToken) *NGramBlocker {
+	return &NGramBlocker{N: n, Banned: banned}
+}
+
+// Apply removes the blocked tokens from cur.
+func (b *NGramBlocker) Apply(cur *LlamaTokenDataArray) {
+	blocked := b.blocked()
+	if len(blocked) == 0 {
+		return
+	}
+	data := cur.Slice()
+	kept := 0
+	for _, d := range data {
+		if _, ok := blocked[d.Id]; !ok {
+			data[kept] = d
+			kept++
+		}
+	}
+	if kept > 0 {
+		cur.Size = uint64(kept)
+	}
+}
+
+// Accept appends token to the history.
+func (b *NGramBlocker) Accept(token LlamaToken) {
+	b.history = append(b.history, token)
+}
+
+// Reset clears the history, e.g. before a new generation.
+func (b *NGramBlocker) Reset() {
+	b.history = b.history[:0]
+}
+
+// blocked returns the tokens that would complete a forbidden n-gram after
+// the history.
+func (b *NGramBlocker) blocked() map[LlamaToken]struct{} {
+	blocked := make(map[LlamaToken]struct{})
+	h := b.history
+	if b.N > 0 && len(h) >= b.N {
+		// Every earlier occurrence of the last N-1 tokens is followed by a
+		// token that would repeat an n-gram
+		suffix := h[len(h)-(b.N-1):]
+		for i := 0; i+b.N-1 < len(h); i++ {
+			if equalTokens(h[i:i+b.N-1], suffix) {
+				blocked[h[i+b.N-1]] = struct{}{}
+			}
+		}
+	}
+	for _, seq := range b.Banned {
+		if len(seq) == 0 || len(seq)-1 > len(h) {
+			continue
+		}
+		if equalTokens(h[len(h)-(len(seq)-1):], seq[:len(seq)-1]) {
+			blocked[seq[len(seq)-1]] = struct{}{}
+		}
+	}
+	return blocked
+}
@@ -0,0 +1,78 @@
+package gollama
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type GoSamplerSuite struct{ BaseSuite }
+
+// scaleSampler halves every logit and drops token 0.
+type scaleSampler struct{}
+
+func (scaleSampler) Apply(cur *LlamaTokenDataArray) {
+	data := cur.Slice()
+	kept := 0
+	for _, d := range data {
+		if d.Id != 0 {
+			d.Logit /= 2
+			data[kept] = d
+			kept++
+		}
+	}
+	cur.Size = uint64(kept)
+}
+
+func (s *GoSamplerSuite) TestApplyWritesLogitsBack() {
+	logits := []float32{1, 2, 4}
+	ApplyGoSamplers(logits, scaleSampler{})
+	s.True(math.IsInf(float64(logits[0]), -1))
+	s.Equal([]float32{1, 2}, logits[1:])
+
+	// Without samplers the logits are unchanged
+	logits = []float32{1, 2}
+	ApplyGoSamplers(logits)
+	s.Equal([]float32{1, 2}, logits)
+}
+
+func (s *GoSamplerSuite) candidates(b *NGramBlocker, n int) []LlamaToken {
+	cur := NewTokenDataArray(make([]float32, n), 0)
+	b.Apply(cur)
+	var ids []LlamaToken
+	for _, d := range cur.Slice() {
+		ids = append(ids, d.Id)
+	}
+	return ids
+}
+
+func (s *GoSamplerSuite) TestNGramBlockerRepetition() {
+	b := NewNGramBlocker(3)
+	for _, t := range []LlamaToken{1, 2, 3, 1} {
+		AcceptGoSamplers(t, b)
+	}
+	s.Equal([]LlamaToken{0, 1, 2, 3, 4}, s.candidates(b, 5))
+
+	// After 1 2, token 3 would repeat the trigram 1 2 3
+	b.Accept(2)
+	s.Equal([]LlamaToken{0, 1, 2, 4}, s.candidates(b, 5))
+
+	b.Reset()
+	s.Len(s.candidates(b, 5), 5)
+}
+
+func (s *GoSamplerSuite) TestNGramBlockerBanned() {
+	b := NewNGramBlocker(0, []LlamaToken{4}, []LlamaToken{1, 2})
+	s.Equal([]LlamaToken{0, 1, 2, 3}, s.candidates(b, 5))
+	b.Accept(1)
+	s.Equal([]LlamaToken{0, 1, 3}, s.candidates(b, 5))
+
+	// The last candidate is never removed
+	only := NewNGramBlocker(0, []LlamaToken{0})
+	s.Equal([]LlamaToken{0}, s.candidates(only, 1))
+}
+
+func TestGoSamplerSuite(t *testing.T) {
+	suite.Run(t, new(GoSamplerSuite))
+}
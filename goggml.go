@@ -175,6 +175,9 @@ type GgmlContext uintptr
 // GGML compute plan
 type GgmlCplan uintptr
 
+// GGML compute graph (struct ggml_cgraph *)
+type GgmlCgraph uintptr
+
 // GGML object type
 type GgmlObject int32
 
@@ -207,6 +210,22 @@ const (
 	GGML_BACKEND_DEVICE_TYPE_ACCEL GgmlBackendDevType = 3
 )
 
+// String returns the name of the device type as printed by llama.cpp
+func (t GgmlBackendDevType) String() string {
+	switch t {
+	case GGML_BACKEND_DEVICE_TYPE_CPU:
+		return "CPU"
+	case GGML_BACKEND_DEVICE_TYPE_GPU:
+		return "GPU"
+	case GGML_BACKEND_DEVICE_TYPE_IGPU:
+		return "IGPU"
+	case GGML_BACKEND_DEVICE_TYPE_ACCEL:
+		return "ACCEL"
+	default:
+		return fmt.Sprintf("GgmlBackendDevType(%d)", int32(t))
+	}
+}
+
 // GGML backend device capabilities
 type GgmlBackendDevCaps struct {
 	Async             bool // asynchronous operations
@@ -226,6 +245,17 @@ type GgmlBackendDevProps struct {
 	Caps        GgmlBackendDevCaps // device capabilities
 }
 
+// ggmlBackendDevPropsC mirrors struct ggml_backend_dev_props
+type ggmlBackendDevPropsC struct {
+	name        *byte
+	description *byte
+	memoryFree  uintptr // size_t
+	memoryTotal uintptr // size_t
+	typ         int32
+	deviceID    *byte // NULL when unknown
+	caps        GgmlBackendDevCaps
+}
+
 // Function pointers for GGML functions
 var (
 	// Type size functions
@@ -293,6 +323,10 @@ var (
 	ggmlBackendInitByName           func(name *byte, params *byte) GgmlBackend
 	ggmlBackendInitByType           func(typ int32, params *byte) GgmlBackend
 
+	// Version functions
+	ggmlVersion func() *byte
+	ggmlCommit  func() *byte
+
 	// Backend registry functions
 	ggmlBackendRegName           func(reg GgmlBackendReg) *byte
 	ggmlBackendRegDevCount       func(reg GgmlBackendReg) uint64
@@ -317,7 +351,25 @@ var (
 	ggmlElementSize  func(tensor GgmlTensor) uint64
 
 	// Quantization functions
-	ggmlQuantizeChunk func(typ GgmlType, src *float32, dst unsafe.Pointer, start int32, nrows int32, ncols int64, hist *int64) uint64
+	ggmlQuantizeChunk           func(typ GgmlType, src *float32, dst unsafe.Pointer, start, nrows, nPerRow int64, imatrix *float32) uintptr
+	ggmlQuantizeRequiresImatrix func(typ GgmlType) bool
+	ggmlGetTypeTraits           func(typ GgmlType) *ggmlTypeTraits
+
+	// Context, tensor and graph functions (ggml_init goes through FFI)
+	ggmlFree                   func(ctx GgmlContext)
+	ggmlTensorOverhead         func() uintptr
+	ggmlGraphOverhead          func() uintptr
+	ggmlNewTensor2d            func(ctx GgmlContext, typ GgmlType, ne0, ne1 int64) GgmlTensor
+	ggmlAdd                    func(ctx GgmlContext, a, b GgmlTensor) GgmlTensor
+	ggmlMul                    func(ctx GgmlContext, a, b GgmlTensor) GgmlTensor
+	ggmlMulMat                 func(ctx GgmlContext, a, b GgmlTensor) GgmlTensor
+	ggmlScale                  func(ctx GgmlContext, a GgmlTensor, s float32) GgmlTensor
+	ggmlNewGraph               func(ctx GgmlContext) GgmlCgraph
+	ggmlBuildForwardExpand     func(graph GgmlCgraph, tensor GgmlTensor)
+	ggmlBackendAllocCtxTensors func(ctx GgmlContext, backend GgmlBackend) GgmlBackendBuffer
+	ggmlBackendTensorSet       func(tensor GgmlTensor, data unsafe.Pointer, offset, size uintptr)
+	ggmlBackendTensorGet       func(tensor GgmlTensor, data unsafe.Pointer, offset, size uintptr)
+	ggmlBackendGraphCompute    func(backend GgmlBackend, graph GgmlCgraph) int32 // enum ggml_status
 )
 
 // registerGgmlFunctions registers all GGML function pointers
@@ -402,6 +454,10 @@ func registerGgmlFunctions() error {
 	_ = tryRegisterLibFunc(&ggmlBackendLoadAll, libHandle, "ggml_backend_load_all")
 	_ = tryRegisterLibFunc(&ggmlBackendLoadAllFromPath, libHandle, "ggml_backend_load_all_from_path")
 
+	// Version functions
+	_ = tryRegisterLibFunc(&ggmlVersion, libHandle, "ggml_version")
+	_ = tryRegisterLibFunc(&ggmlCommit, libHandle, "ggml_commit")
+
 	// Backend registry functions
 	_ = tryRegisterLibFunc(&ggmlBackendRegName, libHandle, "ggml_backend_reg_name")
 	_ = tryRegisterLibFunc(&ggmlBackendRegDevCount, libHandle, "ggml_backend_reg_dev_count")
@@ -421,6 +477,24 @@ func registerGgmlFunctions() error {
 
 	// Quantization functions
 	_ = tryRegisterLibFunc(&ggmlQuantizeChunk, libHandle, "ggml_quantize_chunk")
+	_ = tryRegisterLibFunc(&ggmlQuantizeRequiresImatrix, libHandle, "ggml_quantize_requires_imatrix")
+	_ = tryRegisterLibFunc(&ggmlGetTypeTraits, libHandle, "ggml_get_type_traits")
+
+	// Context, tensor and graph functions
+	_ = tryRegisterLibFunc(&ggmlFree, libHandle, "ggml_free")
+	_ = tryRegisterLibFunc(&ggmlTensorOverhead, libHandle, "ggml_tensor_overhead")
+	_ = tryRegisterLibFunc(&ggmlGraphOverhead, libHandle, "ggml_graph_overhead")
+	_ = tryRegisterLibFunc(&ggmlNewTensor2d, libHandle, "ggml_new_tensor_2d")
+	_ = tryRegisterLibFunc(&ggmlAdd, libHandle, "ggml_add")
+	_ = tryRegisterLibFunc(&ggmlMul, libHandle, "ggml_mul")
+	_ = tryRegisterLibFunc(&ggmlMulMat, libHandle, "ggml_mul_mat")
+	_ = tryRegisterLibFunc(&ggmlScale, libHandle, "ggml_scale")
+	_ = tryRegisterLibFunc(&ggmlNewGraph, libHandle, "ggml_new_graph")
+	_ = tryRegisterLibFunc(&ggmlBuildForwardExpand, libHandle, "ggml_build_forward_expand")
+	_ = tryRegisterLibFunc(&ggmlBackendAllocCtxTensors, libHandle, "ggml_backend_alloc_ctx_tensors")
+	_ = tryRegisterLibFunc(&ggmlBackendTensorSet, libHandle, "ggml_backend_tensor_set")
+	_ = tryRegisterLibFunc(&ggmlBackendTensorGet, libHandle, "ggml_backend_tensor_get")
+	_ = tryRegisterLibFunc(&ggmlBackendGraphCompute, libHandle, "ggml_backend_graph_compute")
 
 	return nil
 }
@@ -493,6 +567,32 @@ func Ggml_backend_dev_get(index uint64) (GgmlBackendDevice, error) {
 	return ggmlBackendDevGet(index), nil
 }
 
+// Ggml_backend_reg_by_name returns the backend registration named name
+// (e.g. "RPC"), or 0 when there is none
+func Ggml_backend_reg_by_name(name string) (GgmlBackendReg, error) {
+	if err := ensureLoaded(); err != nil {
+		return 0, err
+	}
+	if ggmlBackendRegByName == nil {
+		return 0, fmt.Errorf("ggml_backend_reg_by_name function not available")
+	}
+	nameBytes := append([]byte(name), 0)
+	return ggmlBackendRegByName(&nameBytes[0]), nil
+}
+
+// Ggml_backend_dev_by_name returns the device named name (e.g. "CUDA1"),
+// or 0 when there is none
+func Ggml_backend_dev_by_name(name string) (GgmlBackendDevice, error) {
+	if err := ensureLoaded(); err != nil {
+		return 0, err
+	}
+	if ggmlBackendDevByName == nil {
+		return 0, fmt.Errorf("ggml_backend_dev_by_name function not available")
+	}
+	nameBytes := append([]byte(name), 0)
+	return ggmlBackendDevByName(&nameBytes[0]), nil
+}
+
 // Ggml_backend_dev_name returns the name of a backend device
 func Ggml_backend_dev_name(device GgmlBackendDevice) (string, error) {
 	if err := ensureLoaded(); err != nil {
@@ -523,6 +623,43 @@ func Ggml_backend_dev_description(device GgmlBackendDevice) (string, error) {
 	return bytePointerToString(descPtr), nil
 }
 
+// Ggml_backend_dev_type returns the type of a backend device (CPU, GPU,
+// integrated GPU or accelerator)
+func Ggml_backend_dev_type(device GgmlBackendDevice) (GgmlBackendDevType, error) {
+	if err := ensureLoaded(); err != nil {
+		return 0, err
+	}
+	if ggmlBackendDevType == nil {
+		return 0, fmt.Errorf("ggml_backend_dev_type function not available")
+	}
+	return GgmlBackendDevType(ggmlBackendDevType(device)), nil
+}
+
+// Ggml_backend_dev_props returns the properties of a backend device: name,
+// description, memory, type, device id and capabilities, in one call
+func Ggml_backend_dev_props(device GgmlBackendDevice) (GgmlBackendDevProps, error) {
+	if err := ensureLoaded(); err != nil {
+		return GgmlBackendDevProps{}, err
+	}
+	if ggmlBackendDevGetProps == nil {
+		return GgmlBackendDevProps{}, fmt.Errorf("ggml_backend_dev_get_props function not available")
+	}
+	if device == 0 {
+		return GgmlBackendDevProps{}, fmt.Errorf("%w: nil device", ErrInvalidParameter)
+	}
+	var c ggmlBackendDevPropsC
+	ggmlBackendDevGetProps(device, unsafe.Pointer(&c))
+	return GgmlBackendDevProps{
+		Name:        bytePointerToString(c.name),
+		Description: bytePointerToString(c.description),
+		MemoryFree:  uint64(c.memoryFree),
+		MemoryTotal: uint64(c.memoryTotal),
+		Type:        GgmlBackendDevType(c.typ),
+		DeviceID:    bytePointerToString(c.deviceID),
+		Caps:        c.caps,
+	}, nil
+}
+
 // Ggml_backend_dev_memory returns the memory statistics of a backend device
 func Ggml_backend_dev_memory(device GgmlBackendDevice) (free uint64, total uint64, err error) {
 	if err := ensureLoaded(); err != nil {
@@ -546,6 +683,29 @@ func Ggml_backend_cpu_buffer_type() (GgmlBackendBufferType, error) {
 	return ggmlBackendCpuBufferType(), nil
 }
 
+// Ggml_backend_dev_buffer_type returns the default buffer type of a device,
+// e.g. its VRAM
+func Ggml_backend_dev_buffer_type(device GgmlBackendDevice) (GgmlBackendBufferType, error) {
+	if err := ensureLoaded(); err != nil {
+		return 0, err
+	}
+	if ggmlBackendDevBufferType == nil {
+		return 0, fmt.Errorf("ggml_backend_dev_buffer_type function not available")
+	}
+	return ggmlBackendDevBufferType(device), nil
+}
+
+// Ggml_backend_buft_name returns the name of a buffer type
+func Ggml_backend_buft_name(buft GgmlBackendBufferType) (string, error) {
+	if err := ensureLoaded(); err != nil {
+		return "", err
+	}
+	if ggmlBackendBuftName == nil {
+		return "", fmt.Errorf("ggml_backend_buft_name function not available")
+	}
+	return bytePointerToString(ggmlBackendBuftName(buft)), nil
+}
+
 // Ggml_backend_buffer_name returns the name of a backend buffer
 func Ggml_backend_buffer_name(buffer GgmlBackendBuffer) (string, error) {
 	if err := ensureLoaded(); err != nil {
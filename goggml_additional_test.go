@@ -2,6 +2,7 @@ package gollama
 
 import (
 	"testing"
+	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -61,6 +62,31 @@ func (s *GgmlMoreSuite) TestLoadAndUnloadBackends() {
 	}
 }
 
+// Decode the properties of the CPU device
+func (s *GgmlMoreSuite) TestDeviceProps() {
+	s.Equal(uintptr(56), unsafe.Sizeof(ggmlBackendDevPropsC{}))
+	s.Equal("IGPU", GGML_BACKEND_DEVICE_TYPE_IGPU.String())
+
+	_, err := Ggml_backend_dev_props(0)
+	s.ErrorIs(err, ErrInvalidParameter)
+
+	require.NoError(s.T(), Ggml_backend_load_all())
+	dev, err := Ggml_backend_dev_by_name("CPU")
+	require.NoError(s.T(), err)
+	require.NotZero(s.T(), dev)
+	props, err := Ggml_backend_dev_props(dev)
+	require.NoError(s.T(), err)
+
+	desc, _ := Ggml_backend_dev_description(dev)
+	s.Equal("CPU", props.Name)
+	s.Equal(desc, props.Description)
+	s.Equal(GGML_BACKEND_DEVICE_TYPE_CPU, props.Type)
+	s.Positive(props.MemoryTotal)
+	s.LessOrEqual(props.MemoryFree, props.MemoryTotal)
+	// The CPU device wraps host memory but has no async or event support
+	s.Equal(GgmlBackendDevCaps{BufferFromHostPtr: true}, props.Caps)
+}
+
 // Directly cover bytePointerToString helper
 func (s *GgmlMoreSuite) TestBytePointerToString() {
 	bs := []byte("hello\x00")
@@ -71,6 +71,25 @@ var (
 	libHandle uintptr
 	libMutex  sync.RWMutex
 	isLoaded  bool
+
+	// fnTableMu guards the registered function table. Long-running native calls
+	// hold a read lock (see acquireNativeCall); unloading and version switches
+	// need the write lock and fail with ErrBusy rather than swapping symbols
+	// under a running call.
+	fnTableMu sync.RWMutex
+
+	// loaderLibPath is the library resolved by LibraryLoader. When set it is
+	// preferred over getLibraryPath in loadLibrary. Guarded by libMutex.
+	loaderLibPath string
+	// loaderLibVersion is the version LibraryLoader was asked to load, used
+	// to pick the struct layout. Guarded by libMutex.
+	loaderLibVersion string
+	// loadedLibPath is the library loadLibrary actually opened. Guarded by
+	// libMutex.
+	loadedLibPath string
+	// boundSymbols lists the llama.cpp symbols registerFunctions binds, for
+	// LookupSymbols. Guarded by libMutex.
+	boundSymbols []string
 )
 
 // Common types matching llama.cpp
@@ -85,6 +104,7 @@ type (
 const (
 	LLAMA_DEFAULT_SEED = 0xFFFFFFFF
 	LLAMA_TOKEN_NULL   = -1
+	LLAMA_MAX_SEQ      = 256 // maximum n_seq_max accepted by llama.cpp
 
 	// File magic numbers
 	LLAMA_FILE_MAGIC_GGLA = 0x67676c61
@@ -172,6 +192,16 @@ const (
 	LLAMA_ROPE_SCALING_TYPE_YARN        LlamaRopeScalingType = 2
 )
 
+type LlamaRopeType int32
+
+const (
+	LLAMA_ROPE_TYPE_NONE   LlamaRopeType = -1
+	LLAMA_ROPE_TYPE_NORM   LlamaRopeType = 0
+	LLAMA_ROPE_TYPE_NEOX   LlamaRopeType = 2
+	LLAMA_ROPE_TYPE_MROPE  LlamaRopeType = 8
+	LLAMA_ROPE_TYPE_VISION LlamaRopeType = 24
+)
+
 type LlamaPoolingType int32
 
 const (
@@ -186,8 +216,17 @@ const (
 type LlamaAttentionType int32
 
 const (
-	LLAMA_ATTENTION_TYPE_CAUSAL     LlamaAttentionType = 0
-	LLAMA_ATTENTION_TYPE_NON_CAUSAL LlamaAttentionType = 1
+	LLAMA_ATTENTION_TYPE_UNSPECIFIED LlamaAttentionType = -1
+	LLAMA_ATTENTION_TYPE_CAUSAL      LlamaAttentionType = 0
+	LLAMA_ATTENTION_TYPE_NON_CAUSAL  LlamaAttentionType = 1
+)
+
+type LlamaFlashAttnType int32
+
+const (
+	LLAMA_FLASH_ATTN_TYPE_AUTO     LlamaFlashAttnType = -1
+	LLAMA_FLASH_ATTN_TYPE_DISABLED LlamaFlashAttnType = 0
+	LLAMA_FLASH_ATTN_TYPE_ENABLED  LlamaFlashAttnType = 1
 )
 
 type LlamaSplitMode int32
@@ -282,11 +321,11 @@ type LlamaModelParams struct {
 	UseMlock                 uint8          // force system to keep model in RAM (bool as uint8)
 	CheckTensors             uint8          // validate model tensor data (bool as uint8)
 	UseExtraBufts            uint8          // use extra buffer types (bool as uint8)
+	NoHost                   uint8          // bypass host buffer so extra buffers can be used (bool as uint8)
 }
 
 // Context parameters
 type LlamaContextParams struct {
-	Seed              uint32               // RNG seed, -1 for random
 	NCtx              uint32               // text context, 0 = from model
 	NBatch            uint32               // logical maximum batch size
 	NUbatch           uint32               // physical maximum batch size
@@ -296,6 +335,7 @@ type LlamaContextParams struct {
 	RopeScalingType   LlamaRopeScalingType // RoPE scaling type
 	PoolingType       LlamaPoolingType     // pooling type for embeddings
 	AttentionType     LlamaAttentionType   // attention type
+	FlashAttnType     LlamaFlashAttnType   // when to enable flash attention
 	RopeFreqBase      float32              // RoPE base frequency
 	RopeFreqScale     float32              // RoPE frequency scaling factor
 	YarnExtFactor     float32              // YaRN extrapolation mix factor
@@ -310,11 +350,12 @@ type LlamaContextParams struct {
 	TypeV             int32                // data type for V cache
 	AbortCallback     uintptr              // abort callback
 	AbortCallbackData uintptr              // user data for abort callback
-	Logits            uint8                // whether to compute and return logits (bool as uint8)
 	Embeddings        uint8                // whether to compute and return embeddings (bool as uint8)
 	Offload_kqv       uint8                // whether to offload K, Q, V to GPU (bool as uint8)
-	FlashAttn         uint8                // whether to use flash attention (bool as uint8)
 	NoPerf            uint8                // whether to measure performance (bool as uint8)
+	OpOffload         uint8                // offload host tensor operations to device (bool as uint8)
+	SwaFull           uint8                // use full-size SWA cache (bool as uint8)
+	KvUnified         uint8                // use a unified buffer across the input sequences (bool as uint8)
 }
 
 // Model quantize parameters
@@ -369,13 +410,20 @@ var (
 	llamaFree                 func(ctx LlamaContext)
 
 	// Model info functions
-	llamaModelNCtxTrain func(model LlamaModel) int32
-	llamaModelNEmbd     func(model LlamaModel) int32
-	llamaModelNLayer    func(model LlamaModel) int32
-	llamaModelNHead     func(model LlamaModel) int32
-	llamaModelNHeadKv   func(model LlamaModel) int32
-	llamaModelVocabType func(model LlamaModel) LlamaVocabType
-	llamaModelRopeType  func(model LlamaModel) int32
+	llamaModelNCtxTrain  func(model LlamaModel) int32
+	llamaModelNEmbd      func(model LlamaModel) int32
+	llamaModelNLayer     func(model LlamaModel) int32
+	llamaModelNHead      func(model LlamaModel) int32
+	llamaModelNHeadKv    func(model LlamaModel) int32
+	llamaModelNSwa       func(model LlamaModel) int32
+	llamaModelVocabType  func(model LlamaModel) LlamaVocabType
+	llamaModelRopeType   func(model LlamaModel) LlamaRopeType
+	llamaModelHasEncoder func(model LlamaModel) bool
+	llamaModelHasDecoder func(model LlamaModel) bool
+	llamaModelMetaValStr func(model LlamaModel, key *byte, buf *byte, bufSize uint64) int32
+	llamaModelDesc       func(model LlamaModel, buf *byte, bufSize uint64) int32
+	llamaModelSize       func(model LlamaModel) uint64
+	llamaModelNParams    func(model LlamaModel) uint64
 
 	// Context info functions
 	llamaNCtx        func(ctx LlamaContext) uint32
@@ -388,17 +436,26 @@ var (
 	// Tokenization functions
 	llamaTokenize     func(vocab LlamaVocab, text *byte, textLen int32, tokens *LlamaToken, nTokensMax int32, addSpecial bool, parseSpecial bool) int32
 	llamaTokenToPiece func(vocab LlamaVocab, token LlamaToken, buf *byte, length int32, lstrip int32, special bool) int32
-	llamaDetokenize   func(model LlamaModel, tokens *LlamaToken, nTokens int32, text *byte, textLen int32, removeSpecial bool, unparseSpecial bool) int32
+	llamaDetokenize   func(vocab LlamaVocab, tokens *LlamaToken, nTokens int32, text *byte, textLen int32, removeSpecial bool, unparseSpecial bool) int32
 	llamaVocabGetText func(vocab LlamaVocab, token LlamaToken) *byte
 
 	// Vocab functions
-	llamaModelGetVocab func(model LlamaModel) LlamaVocab
-	llamaVocabNTokens  func(vocab LlamaVocab) int32
-	llamaVocabBos      func(vocab LlamaVocab) LlamaToken
-	llamaVocabEos      func(vocab LlamaVocab) LlamaToken
-	llamaVocabEot      func(vocab LlamaVocab) LlamaToken
-	llamaVocabNl       func(vocab LlamaVocab) LlamaToken
-	llamaVocabPad      func(vocab LlamaVocab) LlamaToken
+	llamaModelGetVocab     func(model LlamaModel) LlamaVocab
+	llamaVocabNTokens      func(vocab LlamaVocab) int32
+	llamaVocabBos          func(vocab LlamaVocab) LlamaToken
+	llamaVocabEos          func(vocab LlamaVocab) LlamaToken
+	llamaVocabEot          func(vocab LlamaVocab) LlamaToken
+	llamaVocabNl           func(vocab LlamaVocab) LlamaToken
+	llamaVocabPad          func(vocab LlamaVocab) LlamaToken
+	llamaVocabSep          func(vocab LlamaVocab) LlamaToken
+	llamaVocabGetAttr      func(vocab LlamaVocab, token LlamaToken) LlamaTokenAttr
+	llamaVocabIsEog        func(vocab LlamaVocab, token LlamaToken) bool
+	llamaVocabIsControl    func(vocab LlamaVocab, token LlamaToken) bool
+	llamaVocabGetScore     func(vocab LlamaVocab, token LlamaToken) float32
+	llamaVocabGetAddBos    func(vocab LlamaVocab) bool
+	llamaVocabGetAddEos    func(vocab LlamaVocab) bool
+	llamaModelChatTemplate func(model LlamaModel, name *byte) *byte
+	llamaChatApplyTemplate func(tmpl *byte, chat *LlamaChatMessage, nMsg uint64, addAss bool, buf *byte, length int32) int32
 
 	// Batch functions
 	llamaBatchInit   func(nTokens int32, embd int32, nSeqMax int32) LlamaBatch
@@ -414,10 +471,24 @@ var (
 	llamaGetLogitsIth     func(ctx LlamaContext, i int32) *float32
 	llamaGetEmbeddings    func(ctx LlamaContext) *float32
 	llamaGetEmbeddingsIth func(ctx LlamaContext, i int32) *float32
+	llamaGetEmbeddingsSeq func(ctx LlamaContext, seqId LlamaSeqId) *float32
 	llamaSetCausalAttn    func(ctx LlamaContext, causal bool) int32
 	llamaSetEmbeddings    func(ctx LlamaContext, embeddings bool)
+	llamaSetNThreads      func(ctx LlamaContext, nThreads, nThreadsBatch int32)
+	llamaNThreads         func(ctx LlamaContext) int32
+	llamaNThreadsBatch    func(ctx LlamaContext) int32
+	llamaSynchronize      func(ctx LlamaContext)
+	llamaSetAbortCallback func(ctx LlamaContext, callback uintptr, data uintptr)
 	llamaMemoryClear      func(memory LlamaMemory, reset bool) bool
 	llamaGetMemory        func(ctx LlamaContext) LlamaMemory
+	llamaMemorySeqRm      func(memory LlamaMemory, seqID LlamaSeqId, p0, p1 LlamaPos) bool
+	llamaMemorySeqCp      func(memory LlamaMemory, seqIDSrc, seqIDDst LlamaSeqId, p0, p1 LlamaPos)
+	llamaMemorySeqKeep    func(memory LlamaMemory, seqID LlamaSeqId)
+	llamaMemorySeqAdd     func(memory LlamaMemory, seqID LlamaSeqId, p0, p1, delta LlamaPos)
+	llamaMemorySeqDiv     func(memory LlamaMemory, seqID LlamaSeqId, p0, p1 LlamaPos, d int32)
+	llamaMemorySeqPosMin  func(memory LlamaMemory, seqID LlamaSeqId) LlamaPos
+	llamaMemorySeqPosMax  func(memory LlamaMemory, seqID LlamaSeqId) LlamaPos
+	llamaMemoryCanShift   func(memory LlamaMemory) bool
 
 	// Sampling functions
 	llamaSamplerChainDefaultParams func() LlamaSamplerChainParams
@@ -441,8 +512,10 @@ var (
 	llamaSamplerInitTypical    func(p float32, minKeep uint64) LlamaSampler
 	llamaSamplerInitTemp       func(temp float32) LlamaSampler
 	llamaSamplerInitTempExt    func(temp float32, delta float32, exponent float32) LlamaSampler
-	llamaSamplerInitMirostat   func(tau float32, eta float32, m int32, seed uint32) LlamaSampler
-	llamaSamplerInitMirostatV2 func(tau float32, eta float32, seed uint32) LlamaSampler
+	llamaSamplerInitMirostat   func(nVocab int32, seed uint32, tau float32, eta float32, m int32) LlamaSampler
+	llamaSamplerInitMirostatV2 func(seed uint32, tau float32, eta float32) LlamaSampler
+	llamaSamplerInitGrammar    func(vocab LlamaVocab, grammarStr *byte, grammarRoot *byte) LlamaSampler
+	llamaSamplerInitLogitBias  func(nVocab int32, nLogitBias int32, logitBias *LlamaLogitBias) LlamaSampler
 
 	// Utility functions
 	llamaMaxDevices         func() uint64
@@ -462,10 +535,16 @@ var (
 	llamaStateLoadFile func(ctx LlamaContext, pathSession *byte, tokensOut *LlamaToken, nTokenCapacity uint64, nTokenCountOut *uint64) bool
 	llamaStateSaveFile func(ctx LlamaContext, pathSession *byte, tokens *LlamaToken, nTokenCount uint64) bool
 
-	// Performance functions - These may not exist in this llama.cpp version - moved to ROADMAP "wait for llama.cpp" section
-	// llamaGetTimings   func(ctx LlamaContext) uintptr
-	// llamaPrintTimings func(ctx LlamaContext)
-	// llamaResetTimings func(ctx LlamaContext)
+	llamaStateSeqGetSize func(ctx LlamaContext, seqID LlamaSeqId) uint64
+	llamaStateSeqGetData func(ctx LlamaContext, dst *byte, size uint64, seqID LlamaSeqId) uint64
+	llamaStateSeqSetData func(ctx LlamaContext, src *byte, size uint64, destSeqID LlamaSeqId) uint64
+
+	// Performance functions (llama_perf_context and llama_perf_sampler return
+	// structs and are called through FFI, see ffiPerfContext)
+	llamaPerfContextPrint func(ctx LlamaContext)
+	llamaPerfContextReset func(ctx LlamaContext)
+	llamaPerfSamplerPrint func(chain LlamaSampler)
+	llamaPerfSamplerReset func(chain LlamaSampler)
 )
 
 // Library loading and initialization
@@ -504,15 +583,8 @@ func getLibraryPath() (string, error) {
 	var cacheDir string
 	if globalConfig != nil && globalConfig.CacheDir != "" {
 		cacheDir = globalConfig.CacheDir
-	} else if envCacheDir := os.Getenv("GOLLAMA_CACHE_DIR"); envCacheDir != "" {
-		cacheDir = filepath.Join(envCacheDir, "libs")
 	} else {
-		userCacheDir, err := os.UserCacheDir()
-		if err == nil {
-			cacheDir = filepath.Join(userCacheDir, "gollama", "libs")
-		} else {
-			cacheDir = filepath.Join(os.TempDir(), "gollama", "libs")
-		}
+		cacheDir = defaultLibraryCacheDir()
 	}
 
 	// Try to find library in cache directory subdirectories
@@ -566,6 +638,8 @@ func getLibraryPath() (string, error) {
 
 // loadLibrary loads the llama.cpp shared library
 func loadLibrary() error {
+	fnTableMu.Lock()
+	defer fnTableMu.Unlock()
 	libMutex.Lock()
 	defer libMutex.Unlock()
 
@@ -573,9 +647,13 @@ func loadLibrary() error {
 		return nil
 	}
 
-	libPath, err := getLibraryPath()
-	if err != nil {
-		return fmt.Errorf("failed to get library path: %w", err)
+	libPath := loaderLibPath
+	if libPath == "" {
+		var err error
+		libPath, err = getLibraryPath()
+		if err != nil {
+			return fmt.Errorf("failed to get library path: %w", err)
+		}
 	}
 
 	// Check if platform is supported
@@ -597,13 +675,46 @@ func loadLibrary() error {
 		return fmt.Errorf("failed to register functions: %w", err)
 	}
 
+	// Pick the struct layout of this build, then refuse libraries whose
+	// structs still differ from it
+	layout, err := layoutForBuild(libraryBuild(loaderLibVersion, libPath))
+	if err != nil {
+		_ = closeLibraryPlatform(handle) // Ignore error during cleanup
+		libHandle = 0
+		return fmt.Errorf("library %s: %w", libPath, err)
+	}
+	activeLayout = layout
+	if os.Getenv("GOLLAMA_SKIP_ABI_CHECK") == "" {
+		if err := verifyABI(handle); err != nil {
+			_ = closeLibraryPlatform(handle) // Ignore error during cleanup
+			libHandle = 0
+			activeLayout = nil
+			return fmt.Errorf("library %s: %w", libPath, err)
+		}
+	}
+
+	registerMtmdFunctions(libPath)
+
+	loadedLibPath = libPath
 	isLoaded = true
+	installLogCallback()
 	return nil
 }
 
 // unloadLibrary unloads the library and resets global state
 // This is called by Cleanup() and is important for tests to avoid stale state
+// It returns ErrBusy while native calls are in flight.
 func unloadLibrary() error {
+	if !fnTableMu.TryLock() {
+		return ErrBusy
+	}
+	defer fnTableMu.Unlock()
+	return resetLibraryState()
+}
+
+// resetLibraryState drops the loaded library and its function table.
+// Callers must hold fnTableMu for writing.
+func resetLibraryState() error {
 	libMutex.Lock()
 	defer libMutex.Unlock()
 
@@ -623,9 +734,15 @@ func unloadLibrary() error {
 		// Clear the sibling DLL handles registry (no-op on Unix platforms)
 		clearLoadedDllHandles()
 	}
+	forgetLiveHandles()
+	forgetBackendPlugins()
+	forgetRpcServers()
 
 	// Reset all global state
 	libHandle = 0
+	mtmdHandle = 0
+	activeLayout = nil
+	loadedLibPath = ""
 	isLoaded = false
 
 	// Don't need to nil out function pointers as they'll be re-registered on next load
@@ -639,8 +756,11 @@ func registerFunctions() error {
 	// Track failed registrations
 	var failedRegistrations []string
 
+	boundSymbols = boundSymbols[:0]
+
 	// Helper to track failed registrations
 	trackRegister := func(fptr interface{}, fname string) {
+		boundSymbols = append(boundSymbols, fname)
 		registerLibFunc(fptr, libHandle, fname)
 		// Check if registration was successful by verifying the pointer was set
 		if ptr, ok := fptr.(*uintptr); ok && *ptr == 0 {
@@ -675,8 +795,15 @@ func registerFunctions() error {
 	trackRegister(&llamaModelNLayer, "llama_model_n_layer")
 	trackRegister(&llamaModelNHead, "llama_model_n_head")
 	trackRegister(&llamaModelNHeadKv, "llama_model_n_head_kv")
+	trackRegister(&llamaModelNSwa, "llama_model_n_swa")
 	trackRegister(&llamaModelVocabType, "llama_vocab_type")
 	trackRegister(&llamaModelRopeType, "llama_model_rope_type")
+	trackRegister(&llamaModelHasEncoder, "llama_model_has_encoder")
+	trackRegister(&llamaModelHasDecoder, "llama_model_has_decoder")
+	trackRegister(&llamaModelMetaValStr, "llama_model_meta_val_str")
+	trackRegister(&llamaModelDesc, "llama_model_desc")
+	trackRegister(&llamaModelSize, "llama_model_size")
+	trackRegister(&llamaModelNParams, "llama_model_n_params")
 
 	// Context info functions
 	trackRegister(&llamaNCtx, "llama_n_ctx")
@@ -700,6 +827,15 @@ func registerFunctions() error {
 	trackRegister(&llamaVocabEot, "llama_vocab_eot")
 	trackRegister(&llamaVocabNl, "llama_vocab_nl")
 	trackRegister(&llamaVocabPad, "llama_vocab_pad")
+	trackRegister(&llamaVocabSep, "llama_vocab_sep")
+	trackRegister(&llamaVocabGetAttr, "llama_vocab_get_attr")
+	trackRegister(&llamaVocabIsEog, "llama_vocab_is_eog")
+	trackRegister(&llamaVocabIsControl, "llama_vocab_is_control")
+	trackRegister(&llamaVocabGetScore, "llama_vocab_get_score")
+	trackRegister(&llamaVocabGetAddBos, "llama_vocab_get_add_bos")
+	trackRegister(&llamaVocabGetAddEos, "llama_vocab_get_add_eos")
+	trackRegister(&llamaModelChatTemplate, "llama_model_chat_template")
+	trackRegister(&llamaChatApplyTemplate, "llama_chat_apply_template")
 
 	// Batch functions - Register struct functions only on Darwin (purego limitation)
 	// On other platforms, FFI handles struct parameters/returns directly
@@ -721,10 +857,24 @@ func registerFunctions() error {
 	trackRegister(&llamaGetLogitsIth, "llama_get_logits_ith")
 	trackRegister(&llamaGetEmbeddings, "llama_get_embeddings")
 	trackRegister(&llamaGetEmbeddingsIth, "llama_get_embeddings_ith")
+	trackRegister(&llamaGetEmbeddingsSeq, "llama_get_embeddings_seq")
 	trackRegister(&llamaSetCausalAttn, "llama_set_causal_attn")
 	trackRegister(&llamaSetEmbeddings, "llama_set_embeddings")
+	trackRegister(&llamaSetNThreads, "llama_set_n_threads")
+	trackRegister(&llamaNThreads, "llama_n_threads")
+	trackRegister(&llamaNThreadsBatch, "llama_n_threads_batch")
+	trackRegister(&llamaSynchronize, "llama_synchronize")
+	trackRegister(&llamaSetAbortCallback, "llama_set_abort_callback")
 	trackRegister(&llamaMemoryClear, "llama_memory_clear")
 	trackRegister(&llamaGetMemory, "llama_get_memory")
+	trackRegister(&llamaMemorySeqRm, "llama_memory_seq_rm")
+	trackRegister(&llamaMemorySeqCp, "llama_memory_seq_cp")
+	trackRegister(&llamaMemorySeqKeep, "llama_memory_seq_keep")
+	trackRegister(&llamaMemorySeqAdd, "llama_memory_seq_add")
+	trackRegister(&llamaMemorySeqDiv, "llama_memory_seq_div")
+	trackRegister(&llamaMemorySeqPosMin, "llama_memory_seq_pos_min")
+	trackRegister(&llamaMemorySeqPosMax, "llama_memory_seq_pos_max")
+	trackRegister(&llamaMemoryCanShift, "llama_memory_can_shift")
 
 	// Sampling functions - Register struct functions only on Darwin (purego limitation)
 	// On other platforms, FFI handles struct parameters/returns directly
@@ -752,6 +902,8 @@ func registerFunctions() error {
 	trackRegister(&llamaSamplerInitTempExt, "llama_sampler_init_temp_ext")
 	trackRegister(&llamaSamplerInitMirostat, "llama_sampler_init_mirostat")
 	trackRegister(&llamaSamplerInitMirostatV2, "llama_sampler_init_mirostat_v2")
+	trackRegister(&llamaSamplerInitGrammar, "llama_sampler_init_grammar")
+	trackRegister(&llamaSamplerInitLogitBias, "llama_sampler_init_logit_bias")
 
 	// Utility functions
 	trackRegister(&llamaMaxDevices, "llama_max_devices")
@@ -780,11 +932,15 @@ func registerFunctions() error {
 	trackRegister(&llamaStateSetData, "llama_state_set_data")
 	trackRegister(&llamaStateLoadFile, "llama_state_load_file")
 	trackRegister(&llamaStateSaveFile, "llama_state_save_file")
+	trackRegister(&llamaStateSeqGetSize, "llama_state_seq_get_size")
+	trackRegister(&llamaStateSeqGetData, "llama_state_seq_get_data")
+	trackRegister(&llamaStateSeqSetData, "llama_state_seq_set_data")
 
-	// Performance functions - These may not exist in this llama.cpp version - moved to ROADMAP "wait for llama.cpp" section
-	// registerLibFunc(&llamaGetTimings, libHandle, "llama_get_timings")
-	// registerLibFunc(&llamaPrintTimings, libHandle, "llama_print_timings")
-	// registerLibFunc(&llamaResetTimings, libHandle, "llama_reset_timings")
+	// Performance functions
+	trackRegister(&llamaPerfContextPrint, "llama_perf_context_print")
+	trackRegister(&llamaPerfContextReset, "llama_perf_context_reset")
+	trackRegister(&llamaPerfSamplerPrint, "llama_perf_sampler_print")
+	trackRegister(&llamaPerfSamplerReset, "llama_perf_sampler_reset")
 
 	// Register GGML functions
 	if err := registerGgmlFunctions(); err != nil {
@@ -817,6 +973,36 @@ func ensureLoaded() error {
 	return loadLibrary()
 }
 
+// acquireNativeCall ensures the library is loaded and pins the function table
+// for the duration of a native call, so a concurrent unload or version switch
+// cannot swap symbols underneath it. The call name is recorded for crash
+// dumps. The returned release func must be called once the call completes.
+func acquireNativeCall(name string) (func(), error) {
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+	crashDumps.noteCall(name)
+	fnTableMu.RLock()
+	libMutex.RLock()
+	loaded := isLoaded
+	libMutex.RUnlock()
+	if !loaded {
+		fnTableMu.RUnlock()
+		return nil, ErrLibraryNotLoaded
+	}
+	return fnTableMu.RUnlock, nil
+}
+
+// pinLibrary is acquireNativeCall for the error-returning variants of the
+// getters, whose failures to load the library all wrap ErrLibraryNotLoaded.
+func pinLibrary(name string) (func(), error) {
+	release, err := acquireNativeCall(name)
+	if err != nil && !errors.Is(err, ErrLibraryNotLoaded) {
+		return nil, fmt.Errorf("%w: %w", ErrLibraryNotLoaded, err)
+	}
+	return release, err
+}
+
 // getLibraryDiagnostics returns detailed diagnostic information about library loading
 func getLibraryDiagnostics() string {
 	var diag string
@@ -874,15 +1060,34 @@ func Backend_init() error {
 	return nil
 }
 
-// Backend_free frees the llama + ggml backend
+// Backend_free frees the llama + ggml backend. Models, contexts, samplers,
+// batches and multimodal contexts still alive are freed first, children
+// before the models they use, so deferred frees may run in any order: freeing
+// them again afterwards does nothing. With allocation tracking enabled the
+// objects that were never freed are reported first (see
+// EnableAllocationTracking).
 func Backend_free() {
+	allocations.reportLeaks()
+	freeLiveHandles()
 	if isLoaded && llamaBackendFree != nil {
 		llamaBackendFree()
 	}
 }
 
-// Model_default_params returns default model parameters
+// Model_default_params returns the library's default model parameters with
+// the GPU offload, main GPU, mmap/mlock and vocab-only settings of the
+// global configuration applied (see Configure).
 func Model_default_params() LlamaModelParams {
+	params := libraryModelDefaultParams()
+	if globalConfig != nil {
+		params = globalConfig.applyModelParams(params)
+		params = applyPreferredDevices(params, globalConfig.PreferredBackend)
+	}
+	return params
+}
+
+// libraryModelDefaultParams returns llama_model_default_params.
+func libraryModelDefaultParams() LlamaModelParams {
 	// Try to load library if not already loaded
 	_ = ensureLoaded() // Ignore error, fallback to defaults
 
@@ -894,7 +1099,7 @@ func Model_default_params() LlamaModelParams {
 	}
 
 	// Fallback to purego on Darwin
-	if runtime.GOOS == "darwin" && llamaModelDefaultParams != nil && isLoaded {
+	if usePuregoStructs() && llamaModelDefaultParams != nil && isLoaded {
 		return llamaModelDefaultParams()
 	}
 
@@ -910,8 +1115,19 @@ func Model_default_params() LlamaModelParams {
 	}
 }
 
-// Context_default_params returns default context parameters
+// Context_default_params returns the library's default context parameters
+// with the context size, batch sizes and thread counts of the global
+// configuration applied (see Configure).
 func Context_default_params() LlamaContextParams {
+	params := libraryContextDefaultParams()
+	if globalConfig != nil {
+		params = globalConfig.applyContextParams(params)
+	}
+	return params
+}
+
+// libraryContextDefaultParams returns llama_context_default_params.
+func libraryContextDefaultParams() LlamaContextParams {
 	// Try to load library if not already loaded
 	_ = ensureLoaded() // Ignore error, fallback to defaults
 
@@ -923,13 +1139,12 @@ func Context_default_params() LlamaContextParams {
 	}
 
 	// Fallback to purego on Darwin
-	if runtime.GOOS == "darwin" && llamaContextDefaultParams != nil && isLoaded {
+	if usePuregoStructs() && llamaContextDefaultParams != nil && isLoaded {
 		return llamaContextDefaultParams()
 	}
 
 	// Last resort: return hardcoded defaults
 	return LlamaContextParams{
-		Seed:            LLAMA_DEFAULT_SEED,
 		NCtx:            0, // Auto-detect from model
 		NBatch:          2048,
 		NUbatch:         512,
@@ -939,12 +1154,15 @@ func Context_default_params() LlamaContextParams {
 		RopeScalingType: LLAMA_ROPE_SCALING_TYPE_UNSPECIFIED,
 		PoolingType:     LLAMA_POOLING_TYPE_UNSPECIFIED,
 		AttentionType:   LLAMA_ATTENTION_TYPE_CAUSAL,
+		FlashAttnType:   LLAMA_FLASH_ATTN_TYPE_AUTO,
 		DefragThold:     -1.0, // Disabled by default
-		Logits:          0,    // Disabled by default
+		TypeK:           1,    // GGML_TYPE_F16
+		TypeV:           1,    // GGML_TYPE_F16
 		Embeddings:      0,    // Disabled by default
 		Offload_kqv:     1,    // Enable by default
-		FlashAttn:       0,    // Disabled by default
 		NoPerf:          0,    // Enable performance measurement by default
+		OpOffload:       1,    // Enable by default
+		SwaFull:         1,    // Enable by default
 	}
 }
 
@@ -973,27 +1191,38 @@ func Sampler_chain_default_params() LlamaSamplerChainParams {
 
 // Model_load_from_file loads a model from a file
 func Model_load_from_file(pathModel string, params LlamaModelParams) (LlamaModel, error) {
-	if err := ensureLoaded(); err != nil {
+	release, err := acquireNativeCall("llama_model_load_from_file")
+	if err != nil {
 		return 0, err
 	}
+	defer release()
 
 	// Check GGML backend initialized
 	if !isLoaded {
 		return 0, errors.New("llama.cpp library not loaded")
 	}
+	if err := CheckModelArchitecture(pathModel); err != nil {
+		return 0, err
+	}
 
 	pathBytes := append([]byte(pathModel), 0) // null-terminate
 
 	// Fallback to purego on Darwin
-	if runtime.GOOS == "darwin" {
+	if usePuregoStructs() {
 		model := llamaModelLoadFromFile((*byte)(unsafe.Pointer(&pathBytes[0])), params)
 		if model == 0 {
 			return 0, errors.New("failed to load model")
 		}
+		crashDumps.noteModel(model, pathModel)
+		allocations.note(AllocModel, uintptr(model), Model_size(model))
+		registerHandle(handleModel, uintptr(model))
 		return model, nil
 	} else {
 		// Try FFI first (works on all platforms)
 		if model, err := ffiModelLoadFromFile((*byte)(unsafe.Pointer(&pathBytes[0])), params); err == nil {
+			crashDumps.noteModel(model, pathModel)
+			allocations.note(AllocModel, uintptr(model), Model_size(model))
+			registerHandle(handleModel, uintptr(model))
 			return model, nil
 		} else {
 			return 0, err
@@ -1001,42 +1230,302 @@ func Model_load_from_file(pathModel string, params LlamaModelParams) (LlamaModel
 	}
 }
 
-// Model_free frees a model
+// Model_load_from_splits loads a model split across several GGUF files.
+// paths must list every split in order (see SplitPath); FindModelSplits
+// discovers them from the path of one part.
+func Model_load_from_splits(paths []string, params LlamaModelParams) (LlamaModel, error) {
+	if len(paths) == 0 {
+		return 0, fmt.Errorf("%w: no split paths given", ErrInvalidModelPath)
+	}
+	release, err := acquireNativeCall("llama_model_load_from_splits")
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	if err := CheckModelArchitecture(paths[0]); err != nil {
+		return 0, err
+	}
+
+	// Keep the C strings reachable until the call returns
+	pathBytes := make([][]byte, len(paths))
+	cPaths := make([]*byte, len(paths))
+	for i, p := range paths {
+		pathBytes[i] = append([]byte(p), 0)
+		cPaths[i] = &pathBytes[i][0]
+	}
+	defer runtime.KeepAlive(pathBytes)
+
+	var model LlamaModel
+	if usePuregoStructs() {
+		model = llamaModelLoadFromSplits(&cPaths[0], uint64(len(cPaths)), params)
+		if model == 0 {
+			return 0, ErrModelLoadFailed
+		}
+	} else {
+		model, err = ffiModelLoadFromSplits(&cPaths[0], uint64(len(cPaths)), params)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrModelLoadFailed, err)
+		}
+	}
+	crashDumps.noteModel(model, paths[0])
+	allocations.note(AllocModel, uintptr(model), Model_size(model))
+	registerHandle(handleModel, uintptr(model))
+	return model, nil
+}
+
+// Model_free frees a model. Freeing a model twice, or after Backend_free
+// released it, does nothing. Calls made with it afterwards fail with ErrClosedHandle,
+// or return their zero value when they cannot fail.
 func Model_free(model LlamaModel) {
-	if isLoaded && model != 0 {
+	if isLoaded && model != 0 && closeHandle(handleModel, uintptr(model)) {
 		llamaModelFree(model)
+		crashDumps.forgetModel(model)
+		allocations.forget(AllocModel, uintptr(model))
 	}
 }
 
-// Model_n_embd returns the number of embedding dimensions for the model
+// Model_n_embd returns the number of embedding dimensions for the model, or 0
+// if the library cannot be loaded or model is 0. ModelNEmbd reports why.
 func Model_n_embd(model LlamaModel) int32 {
+	n, _ := ModelNEmbd(model)
+	return n
+}
+
+// ModelNEmbd returns the number of embedding dimensions for the model. It
+// fails with ErrLibraryNotLoaded when the library cannot be loaded and with
+// ErrClosedHandle when model was freed.
+func ModelNEmbd(model LlamaModel) (int32, error) {
+	if model == 0 {
+		return 0, ErrModelNotLoaded
+	}
+	release, err := pinLibrary("llama_model_n_embd")
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	if err := checkHandle(handleModel, uintptr(model)); err != nil {
+		return 0, err
+	}
+	if llamaModelNEmbd == nil {
+		return 0, fmt.Errorf("%w: llama_model_n_embd", ErrFunctionNotFound)
+	}
+	return llamaModelNEmbd(model), nil
+}
+
+// Model_n_vocab returns the number of tokens in the vocabulary of the
+// model, which is also the length of a row of logits, or 0 if it cannot be
+// determined.
+func Model_n_vocab(model LlamaModel) int32 {
+	return Vocab_n_tokens(model)
+}
+
+// Model_n_ctx_train returns the context length the model was trained with,
+// or 0 if the library cannot be loaded or model is 0.
+func Model_n_ctx_train(model LlamaModel) int32 {
 	if err := ensureLoaded(); err != nil {
-		panic(err)
+		return 0
 	}
-	return llamaModelNEmbd(model)
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelNCtxTrain == nil {
+		return 0
+	}
+	return llamaModelNCtxTrain(model)
 }
 
-// Get_embeddings returns the embeddings for the context
+// Model_n_layer returns the number of layers of the model, or 0 if the
+// library cannot be loaded or model is 0.
+func Model_n_layer(model LlamaModel) int32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelNLayer == nil {
+		return 0
+	}
+	return llamaModelNLayer(model)
+}
+
+// Model_n_head returns the number of attention heads of the model, or 0 if
+// the library cannot be loaded or model is 0.
+func Model_n_head(model LlamaModel) int32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelNHead == nil {
+		return 0
+	}
+	return llamaModelNHead(model)
+}
+
+// Model_n_head_kv returns the number of key/value heads of the model, lower
+// than Model_n_head with grouped-query attention, or 0 if the library
+// cannot be loaded or model is 0.
+func Model_n_head_kv(model LlamaModel) int32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelNHeadKv == nil {
+		return 0
+	}
+	return llamaModelNHeadKv(model)
+}
+
+// Model_rope_type returns how the model applies rotary position
+// embeddings, or LLAMA_ROPE_TYPE_NONE if it does not or the library cannot
+// be loaded.
+func Model_rope_type(model LlamaModel) LlamaRopeType {
+	if err := ensureLoaded(); err != nil {
+		return LLAMA_ROPE_TYPE_NONE
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelRopeType == nil {
+		return LLAMA_ROPE_TYPE_NONE
+	}
+	return llamaModelRopeType(model)
+}
+
+// Model_n_swa returns the sliding window attention window of the model in
+// tokens, or 0 if it has no SWA layers.
+func Model_n_swa(model LlamaModel) int32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelNSwa == nil {
+		return 0
+	}
+	return llamaModelNSwa(model)
+}
+
+// Model_has_encoder returns whether the model contains an encoder (BERT, T5, ...)
+func Model_has_encoder(model LlamaModel) bool {
+	if err := ensureLoaded(); err != nil {
+		return false
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelHasEncoder == nil {
+		return false
+	}
+	return llamaModelHasEncoder(model)
+}
+
+// Model_has_decoder returns whether the model contains a decoder
+func Model_has_decoder(model LlamaModel) bool {
+	if err := ensureLoaded(); err != nil {
+		return false
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelHasDecoder == nil {
+		return false
+	}
+	return llamaModelHasDecoder(model)
+}
+
+// Model_meta_val_str returns the GGUF metadata value for key as a string.
+// The boolean result is false when the key does not exist.
+func Model_meta_val_str(model LlamaModel, key string) (string, bool) {
+	if err := ensureLoaded(); err != nil {
+		return "", false
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelMetaValStr == nil {
+		return "", false
+	}
+
+	keyBytes := append([]byte(key), 0)
+	buf := make([]byte, 256)
+	for {
+		n := llamaModelMetaValStr(model, &keyBytes[0], &buf[0], uint64(len(buf)))
+		if n < 0 {
+			return "", false
+		}
+		if int(n) < len(buf) {
+			return string(buf[:n]), true
+		}
+		// Value was truncated; retry with a buffer large enough for the terminator
+		buf = make([]byte, int(n)+1)
+	}
+}
+
+// Model_desc returns a short description of the model, e.g.
+// "llama 1B Q2_K - Medium".
+func Model_desc(model LlamaModel) string {
+	if err := ensureLoaded(); err != nil {
+		return ""
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelDesc == nil {
+		return ""
+	}
+	buf := make([]byte, 128)
+	n := llamaModelDesc(model, &buf[0], uint64(len(buf)))
+	if n < 0 {
+		return ""
+	}
+	return string(buf[:min(int(n), len(buf)-1)])
+}
+
+// Model_size returns the total size of the model's tensors in bytes.
+func Model_size(model LlamaModel) uint64 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelSize == nil {
+		return 0
+	}
+	return llamaModelSize(model)
+}
+
+// Model_n_params returns the number of parameters of the model.
+func Model_n_params(model LlamaModel) uint64 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelNParams == nil {
+		return 0
+	}
+	return llamaModelNParams(model)
+}
+
+// Get_embeddings returns the embeddings for the context. Embeddings returns
+// them as a slice of the right length.
 func Get_embeddings(ctx LlamaContext) *float32 {
 	if err := ensureLoaded(); err != nil {
 		return nil
 	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return nil
+	}
 	return llamaGetEmbeddings(ctx)
 }
 
-// Get_embeddings_ith returns the embeddings for the ith sequence in the context
+// Get_embeddings_ith returns the embeddings for the ith token of the last
+// batch. EmbeddingsIth returns them as a slice of the right length.
 func Get_embeddings_ith(ctx LlamaContext, i int32) *float32 {
 	if err := ensureLoaded(); err != nil {
 		return nil
 	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return nil
+	}
 	return llamaGetEmbeddingsIth(ctx, i)
 }
 
+// Get_embeddings_seq returns the pooled embeddings for the given sequence id.
+// Only valid when the context pooling type is not LLAMA_POOLING_TYPE_NONE.
+func Get_embeddings_seq(ctx LlamaContext, seqId LlamaSeqId) *float32 {
+	if err := ensureLoaded(); err != nil {
+		return nil
+	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return nil
+	}
+	if llamaGetEmbeddingsSeq == nil {
+		return nil
+	}
+	return llamaGetEmbeddingsSeq(ctx, seqId)
+}
+
 // Set_causal_attn sets whether to use causal attention
 func Set_causal_attn(ctx LlamaContext, causal bool) {
 	if err := ensureLoaded(); err != nil {
 		return
 	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return
+	}
 	llamaSetCausalAttn(ctx, causal)
 }
 
@@ -1045,7 +1534,129 @@ func Set_embeddings(ctx LlamaContext, embeddings bool) {
 	if err := ensureLoaded(); err != nil {
 		return
 	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return
+	}
 	llamaSetEmbeddings(ctx, embeddings)
+	noteEmbeddings(ctx, embeddings)
+}
+
+// Set_n_threads sets the number of threads used for generation and for
+// batch (prompt) processing.
+func Set_n_threads(ctx LlamaContext, nThreads, nThreadsBatch int32) {
+	if err := ensureLoaded(); err != nil {
+		return
+	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return
+	}
+	llamaSetNThreads(ctx, nThreads, nThreadsBatch)
+}
+
+// N_threads returns the number of threads used for generation
+func N_threads(ctx LlamaContext) int32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return 0
+	}
+	return llamaNThreads(ctx)
+}
+
+// N_threads_batch returns the number of threads used for batch processing
+func N_threads_batch(ctx LlamaContext) int32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return 0
+	}
+	return llamaNThreadsBatch(ctx)
+}
+
+// Synchronize waits until all computations submitted to ctx, which GPU
+// backends may run asynchronously, are done. Benchmarks call it before
+// reading the clock.
+func Synchronize(ctx LlamaContext) {
+	if err := ensureLoaded(); err != nil {
+		return
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) {
+		return
+	}
+	llamaSynchronize(ctx)
+}
+
+// N_ctx returns the context size of ctx, which may differ from the NCtx
+// requested in its params (0 uses the training length, and the size is
+// rounded up to the cache padding).
+func N_ctx(ctx LlamaContext) uint32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) {
+		return 0
+	}
+	return llamaNCtx(ctx)
+}
+
+// N_batch returns the largest number of tokens a single decode of ctx
+// accepts.
+func N_batch(ctx LlamaContext) uint32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) {
+		return 0
+	}
+	return llamaNBatch(ctx)
+}
+
+// N_ubatch returns the physical batch size of ctx, the largest number of
+// tokens computed at once; encoders need every input to fit in it.
+func N_ubatch(ctx LlamaContext) uint32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) {
+		return 0
+	}
+	return llamaNUbatch(ctx)
+}
+
+// N_seq_max returns the number of sequences ctx can hold.
+func N_seq_max(ctx LlamaContext) uint32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) {
+		return 0
+	}
+	return llamaNSeqMax(ctx)
+}
+
+// Pooling_type returns how ctx pools embeddings, resolved from the model
+// when its params asked for LLAMA_POOLING_TYPE_UNSPECIFIED.
+func Pooling_type(ctx LlamaContext) LlamaPoolingType {
+	if err := ensureLoaded(); err != nil {
+		return LLAMA_POOLING_TYPE_UNSPECIFIED
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) {
+		return LLAMA_POOLING_TYPE_UNSPECIFIED
+	}
+	return llamaPoolingType(ctx)
+}
+
+// Get_model returns the model ctx was created from.
+func Get_model(ctx LlamaContext) LlamaModel {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) {
+		return 0
+	}
+	return llamaGetModel(ctx)
 }
 
 // Memory_clear clears the KV cache
@@ -1053,51 +1664,166 @@ func Memory_clear(ctx LlamaContext, reset bool) bool {
 	if err := ensureLoaded(); err != nil {
 		return false
 	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return false
+	}
 	memory := llamaGetMemory(ctx)
+	if memory == 0 {
+		// Encoder-only models have no KV cache
+		return false
+	}
 	return llamaMemoryClear(memory, reset)
 }
 
+// contextMemory returns the memory of ctx, or 0 when the library is not
+// loaded or the context has no KV cache.
+func contextMemory(ctx LlamaContext) LlamaMemory {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) {
+		return 0
+	}
+	return llamaGetMemory(ctx)
+}
+
+// Memory_seq_rm removes the tokens of sequence seqID in positions [p0, p1).
+// seqID < 0 matches any sequence, p0 < 0 means 0 and p1 < 0 means infinity.
+// It returns false if a partial sequence cannot be removed.
+func Memory_seq_rm(ctx LlamaContext, seqID LlamaSeqId, p0, p1 LlamaPos) bool {
+	memory := contextMemory(ctx)
+	if memory == 0 {
+		return false
+	}
+	return llamaMemorySeqRm(memory, seqID, p0, p1)
+}
+
+// Memory_seq_cp copies the tokens of sequence src in positions [p0, p1) to
+// sequence dst.
+func Memory_seq_cp(ctx LlamaContext, src, dst LlamaSeqId, p0, p1 LlamaPos) {
+	if memory := contextMemory(ctx); memory != 0 {
+		llamaMemorySeqCp(memory, src, dst, p0, p1)
+	}
+}
+
+// Memory_seq_keep removes all tokens that do not belong to sequence seqID.
+func Memory_seq_keep(ctx LlamaContext, seqID LlamaSeqId) {
+	if memory := contextMemory(ctx); memory != 0 {
+		llamaMemorySeqKeep(memory, seqID)
+	}
+}
+
+// Memory_seq_add adds delta to the positions of sequence seqID in [p0, p1).
+func Memory_seq_add(ctx LlamaContext, seqID LlamaSeqId, p0, p1, delta LlamaPos) {
+	if memory := contextMemory(ctx); memory != 0 {
+		llamaMemorySeqAdd(memory, seqID, p0, p1, delta)
+	}
+}
+
+// Memory_seq_div divides the positions of sequence seqID in [p0, p1) by d.
+func Memory_seq_div(ctx LlamaContext, seqID LlamaSeqId, p0, p1 LlamaPos, d int32) {
+	if memory := contextMemory(ctx); memory != 0 && d > 0 {
+		llamaMemorySeqDiv(memory, seqID, p0, p1, d)
+	}
+}
+
+// Memory_seq_pos_min returns the smallest position of sequence seqID, or -1
+// if the sequence is empty.
+func Memory_seq_pos_min(ctx LlamaContext, seqID LlamaSeqId) LlamaPos {
+	memory := contextMemory(ctx)
+	if memory == 0 {
+		return -1
+	}
+	return llamaMemorySeqPosMin(memory, seqID)
+}
+
+// Memory_seq_pos_max returns the largest position of sequence seqID, or -1
+// if the sequence is empty.
+func Memory_seq_pos_max(ctx LlamaContext, seqID LlamaSeqId) LlamaPos {
+	memory := contextMemory(ctx)
+	if memory == 0 {
+		return -1
+	}
+	return llamaMemorySeqPosMax(memory, seqID)
+}
+
+// Memory_can_shift reports whether the memory supports shifting positions.
+func Memory_can_shift(ctx LlamaContext) bool {
+	memory := contextMemory(ctx)
+	if memory == 0 {
+		return false
+	}
+	return llamaMemoryCanShift(memory)
+}
+
 // Get_memory returns the memory handle for the context
 func Get_memory(ctx LlamaContext) LlamaMemory {
 	if err := ensureLoaded(); err != nil {
 		return 0
 	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return 0
+	}
 	return llamaGetMemory(ctx)
 }
 
 // Init_from_model creates a context from a model
 func Init_from_model(model LlamaModel, params LlamaContextParams) (LlamaContext, error) {
-	if err := ensureLoaded(); err != nil {
+	release, err := acquireNativeCall("llama_init_from_model")
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	if err := checkHandle(handleModel, uintptr(model)); err != nil {
 		return 0, err
 	}
 
 	// Try FFI first (works on all platforms)
 	if ctx, err := ffiInitFromModel(model, params); err == nil {
+		crashDumps.noteContext(ctx, model, params)
+		noteEmbeddings(ctx, params.Embeddings != 0)
+		allocations.note(AllocContext, uintptr(ctx), 0)
+		registerHandle(handleContext, uintptr(ctx))
 		return ctx, nil
 	}
 
 	// Fallback to purego on Darwin
-	if runtime.GOOS == "darwin" && llamaInitFromModel != nil {
+	if usePuregoStructs() && llamaInitFromModel != nil {
 		ctx := llamaInitFromModel(model, params)
 		if ctx == 0 {
 			return 0, errors.New("failed to create context")
 		}
+		crashDumps.noteContext(ctx, model, params)
+		noteEmbeddings(ctx, params.Embeddings != 0)
+		allocations.note(AllocContext, uintptr(ctx), 0)
+		registerHandle(handleContext, uintptr(ctx))
 		return ctx, nil
 	}
 
 	return 0, errors.New("Init_from_model not available on this platform")
 }
 
-// Free frees a context
+// Free frees a context. Freeing a context twice, or after Backend_free
+// released it, does nothing. Calls made with it afterwards fail with ErrClosedHandle,
+// or return their zero value when they cannot fail.
 func Free(ctx LlamaContext) {
-	if isLoaded && ctx != 0 {
+	if isLoaded && ctx != 0 && closeHandle(handleContext, uintptr(ctx)) {
 		llamaFree(ctx)
+		forgetAbortCallback(ctx)
+		forgetOutputs(ctx)
+		crashDumps.forgetContext(ctx)
+		allocations.forget(AllocContext, uintptr(ctx))
 	}
 }
 
 // Tokenize tokenizes text
 func Tokenize(model LlamaModel, text string, addSpecial, parseSpecial bool) ([]LlamaToken, error) {
-	if err := ensureLoaded(); err != nil {
+	release, err := acquireNativeCall("llama_tokenize")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if err := checkHandle(handleModel, uintptr(model)); err != nil {
 		return nil, err
 	}
 
@@ -1106,7 +1832,12 @@ func Tokenize(model LlamaModel, text string, addSpecial, parseSpecial bool) ([]L
 	if vocab == 0 {
 		return nil, errors.New("failed to get vocabulary from model")
 	}
+	return tokenizeVocab(vocab, text, addSpecial, parseSpecial)
+}
 
+// tokenizeVocab tokenizes text with an already resolved vocabulary.
+// Callers must hold a native call (see acquireNativeCall).
+func tokenizeVocab(vocab LlamaVocab, text string, addSpecial, parseSpecial bool) ([]LlamaToken, error) {
 	textBytes := append([]byte(text), 0) // null-terminate
 
 	// First call to get the number of tokens
@@ -1115,13 +1846,9 @@ func Tokenize(model LlamaModel, text string, addSpecial, parseSpecial bool) ([]L
 		return nil, fmt.Errorf("text too long: %d characters, maximum supported: %d", textLen, math.MaxInt32)
 	}
 	nTokens := llamaTokenize(vocab, (*byte)(unsafe.Pointer(&textBytes[0])), int32(textLen), nil, 0, addSpecial, parseSpecial)
-	if nTokens <= 0 {
+	if nTokens < 0 {
 		// llama_tokenize returns negative value indicating number of tokens needed
-		if nTokens < 0 {
-			nTokens = -nTokens // Convert to positive
-		} else {
-			return nil, fmt.Errorf("tokenization failed with error code: %d", nTokens)
-		}
+		nTokens = -nTokens
 	}
 
 	if nTokens == 0 {
@@ -1138,14 +1865,16 @@ func Tokenize(model LlamaModel, text string, addSpecial, parseSpecial bool) ([]L
 	return tokens[:result], nil
 }
 
-// Token_to_piece converts a token to its string representation using model
+// Token_to_piece converts a token to the text it decodes to, handling byte
+// tokens and SentencePiece word boundaries. Control tokens are rendered only
+// when special is true.
 func Token_to_piece(model LlamaModel, token LlamaToken, special bool) string {
 	if err := ensureLoaded(); err != nil {
 		return ""
 	}
 
 	// Validate model handle
-	if model == 0 {
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaTokenToPiece == nil {
 		return ""
 	}
 
@@ -1155,31 +1884,74 @@ func Token_to_piece(model LlamaModel, token LlamaToken, special bool) string {
 		return ""
 	}
 
-	// Use the simpler llama_vocab_get_text function which directly returns the text
-	textPtr := llamaVocabGetText(vocab, token)
-	if textPtr == nil {
+	// Most pieces are short; llama_token_to_piece returns the negated required
+	// size when the buffer is too small
+	buf := make([]byte, 32)
+	n := llamaTokenToPiece(vocab, token, &buf[0], int32(len(buf)), 0, special)
+	if n < 0 {
+		buf = make([]byte, -n)
+		n = llamaTokenToPiece(vocab, token, &buf[0], int32(len(buf)), 0, special)
+	}
+	if n <= 0 {
 		return ""
 	}
+	return string(buf[:n])
+}
 
-	// Convert C string to Go string
-	// We need to find the length of the C string first
-	var length int
-	for {
-		// Use unsafe.Add to safely advance the pointer
-		bytePtr := (*byte)(unsafe.Add(unsafe.Pointer(textPtr), length))
-		if *bytePtr == 0 {
-			break
-		}
-		length++
+// Detokenize converts tokens back to text with llama_detokenize, which,
+// unlike concatenating Token_to_piece results, joins the bytes of byte
+// tokens into whole UTF-8 sequences and drops the space SentencePiece
+// tokenizers add before the first word, so Tokenize followed by Detokenize
+// returns the original text. removeSpecial drops BOS/EOS tokens the
+// tokenizer would have added; unparseSpecial renders special tokens as
+// their text instead of omitting them.
+func Detokenize(model LlamaModel, tokens []LlamaToken, removeSpecial, unparseSpecial bool) (string, error) {
+	release, err := acquireNativeCall("llama_detokenize")
+	if err != nil {
+		return "", err
 	}
+	defer release()
 
-	if length == 0 {
-		return ""
+	if model == 0 {
+		return "", ErrModelNotLoaded
+	}
+	if err := checkHandle(handleModel, uintptr(model)); err != nil {
+		return "", err
+	}
+	vocab := llamaModelGetVocab(model)
+	if vocab == 0 {
+		return "", errors.New("failed to get vocabulary from model")
+	}
+	return detokenizeVocab(vocab, tokens, removeSpecial, unparseSpecial)
+}
+
+// detokenizeVocab is Detokenize for a vocabulary handle.
+func detokenizeVocab(vocab LlamaVocab, tokens []LlamaToken, removeSpecial, unparseSpecial bool) (string, error) {
+	if len(tokens) == 0 {
+		return "", nil
+	}
+	if len(tokens) > math.MaxInt32/8 {
+		return "", fmt.Errorf("%w: too many tokens to detokenize: %d", ErrInvalidParameter, len(tokens))
+	}
+	if llamaDetokenize == nil {
+		return "", fmt.Errorf("llama_detokenize function not available")
 	}
 
-	// Create a Go byte slice from the C string
-	bytes := (*[1 << 30]byte)(unsafe.Pointer(textPtr))[:length:length]
-	return string(bytes)
+	// Start with a generous estimate; llama_detokenize returns the negated
+	// required size when the buffer is too small
+	size := int32(len(tokens) * 8)
+	if size < 64 {
+		size = 64
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		buf := make([]byte, size)
+		n := llamaDetokenize(vocab, &tokens[0], int32(len(tokens)), &buf[0], size, removeSpecial, unparseSpecial)
+		if n >= 0 {
+			return string(buf[:n]), nil
+		}
+		size = -n
+	}
+	return "", fmt.Errorf("%w: detokenize buffer sizing failed", ErrTokenizationFailed)
 }
 
 // Batch_init creates a new batch
@@ -1190,13 +1962,16 @@ func Batch_init(nTokens, embd, nSeqMax int32) LlamaBatch {
 	// Try FFI first (works on all platforms)
 	if isLoaded {
 		if batch, err := ffiBatchInit(nTokens, embd, nSeqMax); err == nil {
+			trackBatch(batch)
 			return batch
 		}
 	}
 
 	// Fallback to purego on Darwin
 	if runtime.GOOS == "darwin" && llamaBatchInit != nil && isLoaded {
-		return llamaBatchInit(nTokens, embd, nSeqMax)
+		batch := llamaBatchInit(nTokens, embd, nSeqMax)
+		trackBatch(batch)
+		return batch
 	}
 
 	// Last resort: return zero-initialized batch
@@ -1235,49 +2010,78 @@ func Batch_get_one(tokens []LlamaToken) LlamaBatch {
 	return LlamaBatch{}
 }
 
-// Batch_free frees a batch
+// Batch_free frees a batch allocated by Batch_init. Batches from
+// Batch_get_one point into Go memory and are left alone, as are batches
+// already freed, so calling it more than once is safe.
 func Batch_free(batch LlamaBatch) {
 	if err := ensureLoaded(); err != nil {
 		return
 	}
-	// Only call llama_batch_free for batches created with llama_batch_init
-	// Batches created with llama_batch_get_one don't need to be freed
-	if runtime.GOOS == "darwin" && batch.Token != nil {
+	if !untrackBatch(batch) {
+		return
+	}
+	if err := ffiBatchFree(batch); err != nil && runtime.GOOS == "darwin" && llamaBatchFree != nil {
 		llamaBatchFree(batch)
 	}
 }
 
 // Decode decodes a batch
-func Decode(ctx LlamaContext, batch LlamaBatch) error {
-	if err := ensureLoaded(); err != nil {
+func Decode(ctx LlamaContext, batch LlamaBatch) (err error) {
+	release, err := acquireNativeCall("llama_decode")
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
 		return err
 	}
+	defer func() {
+		countBatch(&metrics.tokensDecoded, batch.NTokens, err)
+		recordOutputs(ctx, batch, false, err)
+	}()
 
 	// Try FFI first (works on all platforms)
 	if result, err := ffiDecode(ctx, batch); err == nil {
-		if result != 0 {
-			return fmt.Errorf("decode failed with code %d", result)
-		}
-		return nil
+		return decodeResult(ctx, batch, result)
 	}
 
 	// Fallback to purego on Darwin
 	if runtime.GOOS == "darwin" && llamaDecode != nil {
-		result := llamaDecode(ctx, batch)
-		if result != 0 {
-			return fmt.Errorf("decode failed with code %d", result)
-		}
-		return nil
+		return decodeResult(ctx, batch, llamaDecode(ctx, batch))
 	}
 
 	return errors.New("Decode not available on this platform")
 }
 
+// decodeResult converts the result of llama_decode into an error. The
+// caller holds the native call lock.
+func decodeResult(ctx LlamaContext, batch LlamaBatch, result int32) error {
+	switch result {
+	case 0:
+		return nil
+	case 1:
+		return &NoKvSlotError{
+			Batch: int(batch.NTokens),
+			Stats: readKVStats(llamaGetMemory(ctx), int(llamaNCtx(ctx)), int(llamaNSeqMax(ctx))),
+		}
+	}
+	return fmt.Errorf("decode failed with code %d", result)
+}
+
 // Encode encodes a batch
-func Encode(ctx LlamaContext, batch LlamaBatch) error {
-	if err := ensureLoaded(); err != nil {
+func Encode(ctx LlamaContext, batch LlamaBatch) (err error) {
+	release, err := acquireNativeCall("llama_encode")
+	if err != nil {
 		return err
 	}
+	defer release()
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return err
+	}
+	defer func() {
+		countBatch(&metrics.tokensEncoded, batch.NTokens, err)
+		recordOutputs(ctx, batch, true, err)
+	}()
 
 	// Try FFI first (works on all platforms)
 	if result, err := ffiEncode(ctx, batch); err == nil {
@@ -1299,103 +2103,147 @@ func Encode(ctx LlamaContext, batch LlamaBatch) error {
 	return errors.New("Encode not available on this platform")
 }
 
-// Get_logits gets logits for all tokens
+// Get_logits gets logits for all tokens. Logits returns them as a slice of
+// the right length.
 func Get_logits(ctx LlamaContext) *float32 {
 	if err := ensureLoaded(); err != nil {
 		return nil
 	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return nil
+	}
 	return llamaGetLogits(ctx)
 }
 
-// Get_logits_ith gets logits for a specific token
+// Get_logits_ith gets logits for a specific token. LogitsRow returns them
+// as a slice of the right length.
 func Get_logits_ith(ctx LlamaContext, i int32) *float32 {
 	if err := ensureLoaded(); err != nil {
 		return nil
 	}
+	if handleClosed(handleContext, uintptr(ctx)) {
+		return nil
+	}
 	return llamaGetLogitsIth(ctx, i)
 }
 
-// Token_data_array_init creates a token data array (helper function)
-func Token_data_array_init(model LlamaModel) *LlamaTokenDataArray {
-	if err := ensureLoaded(); err != nil {
+// Get_logits_ith_slice returns the logits for the i-th output as a slice of
+// N_vocab(ctx) values, or nil if they are not available. The slice aliases
+// memory owned by the context and is only valid until the next decode.
+func Get_logits_ith_slice(ctx LlamaContext, i int32) []float32 {
+	nVocab := N_vocab(ctx)
+	if nVocab <= 0 {
 		return nil
 	}
-
-	// Use actual number of available logits (256) instead of full vocab (32000)
-	// Based on error: "out of range [0, 256)"
-	nVocab := int32(256)
-
-	// Allocate memory for token data array
-	tokenData := make([]LlamaTokenData, nVocab)
-
-	// Initialize token data array - will be populated with actual logits later
-	for i := int32(0); i < nVocab; i++ {
-		tokenData[i] = LlamaTokenData{
-			Id:    LlamaToken(i),
-			Logit: 0.0,
-			P:     0.0,
-		}
+	logits := Get_logits_ith(ctx, i)
+	if logits == nil {
+		return nil
 	}
+	return unsafe.Slice(logits, nVocab)
+}
 
-	// Return pointer to token data array structure
-	if nVocab < 0 {
-		panic(fmt.Errorf("invalid vocabulary size: %d", nVocab))
-	}
-	return &LlamaTokenDataArray{
-		Data:     &tokenData[0],
-		Size:     uint64(uint32(nVocab)), // Safe conversion since nVocab is int32
-		Selected: -1,
-		Sorted:   0,
+// Vocab_n_tokens returns the number of tokens in the model vocabulary, or 0
+// if it cannot be determined.
+func Vocab_n_tokens(model LlamaModel) int32 {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabNTokens == nil {
+		return 0
 	}
+	return llamaVocabNTokens(vocab)
 }
 
-// Token_data_array_from_logits creates a token data array from logits
-func Token_data_array_from_logits(model LlamaModel, logits *float32) *LlamaTokenDataArray {
+// N_vocab returns the vocabulary size of the model behind ctx, which is also
+// the length of each row of logits.
+func N_vocab(ctx LlamaContext) int32 {
 	if err := ensureLoaded(); err != nil {
-		return nil
+		return 0
 	}
-
-	if logits == nil {
-		return nil
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) || llamaGetModel == nil {
+		return 0
 	}
+	return Vocab_n_tokens(llamaGetModel(ctx))
+}
 
-	// Use hardcoded vocabulary size for now to avoid corruption issues
-	// Use a very small, safe subset to prevent any out-of-bounds access
-	nVocab := int32(32)
-
-	// Allocate memory for token data array
-	tokenData := make([]LlamaTokenData, nVocab)
+// Token_data_array_init creates a token data array (helper function)
+// sized to the model vocabulary, with zero logits. An optional limit keeps
+// only the first limit token ids. It returns nil if the vocabulary size
+// cannot be determined; TokenDataArrayInit reports why.
+func Token_data_array_init(model LlamaModel, limit ...int) *LlamaTokenDataArray {
+	arr, _ := TokenDataArrayInit(model, limit...)
+	return arr
+}
 
-	// Convert logits pointer to slice for easier access
-	logitsSlice := unsafe.Slice(logits, nVocab)
+// TokenDataArrayInit is Token_data_array_init returning an error, wrapping
+// ErrLibraryNotLoaded or ErrClosedHandle, instead of nil.
+func TokenDataArrayInit(model LlamaModel, limit ...int) (*LlamaTokenDataArray, error) {
+	if model == 0 {
+		return nil, ErrModelNotLoaded
+	}
+	release, err := pinLibrary("llama_vocab_n_tokens")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if err := checkHandle(handleModel, uintptr(model)); err != nil {
+		return nil, err
+	}
+	if llamaModelGetVocab == nil || llamaVocabNTokens == nil {
+		return nil, fmt.Errorf("%w: llama_vocab_n_tokens", ErrFunctionNotFound)
+	}
+	vocab := llamaModelGetVocab(model)
+	if vocab == 0 {
+		return nil, fmt.Errorf("%w: model has no vocabulary", ErrUnsupportedModelType)
+	}
+	nVocab := int(llamaVocabNTokens(vocab))
+	if nVocab <= 0 {
+		return nil, fmt.Errorf("%w: model has no vocabulary", ErrUnsupportedModelType)
+	}
+	if len(limit) > 0 && limit[0] > 0 {
+		nVocab = min(nVocab, limit[0])
+	}
+	return NewTokenDataArray(make([]float32, nVocab), 0), nil
+}
 
-	// Populate token data array with actual logits
-	for i := int32(0); i < nVocab; i++ {
-		tokenData[i] = LlamaTokenData{
-			Id:    LlamaToken(i),
-			Logit: logitsSlice[i],
-			P:     0.0, // Will be computed by the sampler
-		}
+// Token_data_array_from_logits creates a token data array from logits.
+// logits must point to at least Vocab_n_tokens(model) values, as returned by
+// Get_logits_ith. An optional limit keeps only the limit most likely tokens
+// (see NewTokenDataArray). It returns nil if the vocabulary size cannot be
+// determined.
+func Token_data_array_from_logits(model LlamaModel, logits *float32, limit ...int) *LlamaTokenDataArray {
+	if logits == nil {
+		return nil
 	}
 
-	// Return pointer to token data array structure
-	if nVocab < 0 {
-		panic(fmt.Errorf("invalid vocabulary size: %d", nVocab))
+	nVocab := Vocab_n_tokens(model)
+	if nVocab <= 0 {
+		return nil
 	}
-	return &LlamaTokenDataArray{
-		Data:     &tokenData[0],
-		Size:     uint64(uint32(nVocab)), // Safe conversion since nVocab is int32
-		Selected: -1,
-		Sorted:   0,
+	n := 0
+	if len(limit) > 0 {
+		n = limit[0]
 	}
+	return NewTokenDataArray(unsafe.Slice(logits, nVocab), n)
 }
 
-// Sampler_init_greedy creates a greedy sampler
+// Sampler_init_greedy creates a greedy sampler. It returns 0 if the library
+// cannot be loaded; SamplerInitGreedy reports why.
 func Sampler_init_greedy() LlamaSampler {
-	if err := ensureLoaded(); err != nil {
-		panic(err)
+	smpl, _ := SamplerInitGreedy()
+	return smpl
+}
+
+// SamplerInitGreedy creates a greedy sampler, failing with
+// ErrLibraryNotLoaded when the library cannot be loaded.
+func SamplerInitGreedy() (LlamaSampler, error) {
+	release, err := pinLibrary("llama_sampler_init_greedy")
+	if err != nil {
+		return 0, err
 	}
-	return llamaSamplerInitGreedy()
+	defer release()
+	if llamaSamplerInitGreedy == nil {
+		return 0, fmt.Errorf("%w: llama_sampler_init_greedy", ErrFunctionNotFound)
+	}
+	return trackSampler(llamaSamplerInitGreedy()), nil
 }
 
 // Sampler_chain_init creates a sampler chain
@@ -1406,49 +2254,58 @@ func Sampler_chain_init(params LlamaSamplerChainParams) LlamaSampler {
 	// Try FFI first (works on all platforms)
 	if isLoaded {
 		if sampler, err := ffiSamplerChainInit(params); err == nil {
-			return sampler
+			return trackSampler(sampler)
 		}
 	}
 
 	// Fallback to purego on Darwin
 	if runtime.GOOS == "darwin" && llamaSamplerChainInit != nil && isLoaded {
-		return llamaSamplerChainInit(params)
+		return trackSampler(llamaSamplerChainInit(params))
 	}
 
 	// Last resort: return null sampler
 	return 0
 }
 
-// Sampler_free frees a sampler
+// Sampler_free frees a sampler or a sampler chain together with the samplers
+// added to it. Samplers that were added to a chain are owned by the chain and
+// must not be freed individually; doing so, like freeing a sampler twice,
+// does nothing.
 func Sampler_free(sampler LlamaSampler) {
-	// The C library doesn't seem to have a direct sampler free function
-	// This might be handled by the sampler chain
+	if isLoaded && sampler != 0 && llamaSamplerChainFree != nil && closeHandle(handleSampler, uintptr(sampler)) {
+		llamaSamplerChainFree(sampler)
+		allocations.forget(AllocSampler, uintptr(sampler))
+	}
 }
 
 // Sampler_sample samples a token from the logits at the given index (-1 for last token)
 func Sampler_sample(sampler LlamaSampler, ctx LlamaContext, idx int32) LlamaToken {
-	if err := ensureLoaded(); err != nil {
+	release, err := acquireNativeCall("llama_sampler_sample")
+	if err != nil {
 		return LLAMA_TOKEN_NULL
 	}
+	defer release()
+	if handleClosed(handleSampler, uintptr(sampler)) || handleClosed(handleContext, uintptr(ctx)) {
+		return LLAMA_TOKEN_NULL
+	}
+	countMetric(&metrics.samplerCalls, 1)
 	return llamaSamplerSample(sampler, ctx, idx)
 }
 
 // Additional utility functions
 
-// Print_system_info prints system information
+// Print_system_info returns the llama.cpp system information string, listing
+// the features of each loaded backend (e.g. "CPU : AVX = 1 | AVX2 = 1 | ...").
+// Backends must be loaded (see Ggml_backend_load_all) for it to be populated.
 func Print_system_info() string {
 	if err := ensureLoaded(); err != nil {
 		return ""
 	}
 
-	ptr := llamaPrintSystemInfo()
-	if ptr == nil {
+	if llamaPrintSystemInfo == nil {
 		return ""
 	}
-
-	// Convert C string to Go string
-	// This is unsafe and needs proper implementation
-	return ""
+	return bytePointerToString(llamaPrintSystemInfo())
 }
 
 // Supports_mmap returns whether mmap is supported
@@ -1475,6 +2332,18 @@ func Supports_gpu_offload() bool {
 	return llamaSupportsGpuOffload()
 }
 
+// Supports_rpc returns whether the RPC backend is available for offloading
+// to remote machines. It becomes true once AddRpcDevices has loaded it.
+func Supports_rpc() bool {
+	if err := ensureLoaded(); err != nil {
+		return false
+	}
+	if llamaSupportsRpc == nil {
+		return false
+	}
+	return llamaSupportsRpc()
+}
+
 // Max_devices returns the maximum number of devices
 func Max_devices() uint64 {
 	if err := ensureLoaded(); err != nil {
@@ -1485,7 +2354,7 @@ func Max_devices() uint64 {
 
 // Helper functions for platforms where struct returns aren't supported - moved to ROADMAP "wait for purego struct support" section
 func ModelDefaultParams() LlamaModelParams {
-	if runtime.GOOS == "darwin" && llamaModelDefaultParams != nil {
+	if usePuregoStructs() && llamaModelDefaultParams != nil {
 		return llamaModelDefaultParams()
 	}
 	// Return default values for non-Darwin platforms - blocks ROADMAP "wait for purego struct support"
@@ -1502,12 +2371,11 @@ func ModelDefaultParams() LlamaModelParams {
 }
 
 func ContextDefaultParams() LlamaContextParams {
-	if runtime.GOOS == "darwin" && llamaContextDefaultParams != nil {
+	if usePuregoStructs() && llamaContextDefaultParams != nil {
 		return llamaContextDefaultParams()
 	}
 	// Return default values for non-Darwin platforms - blocks ROADMAP "wait for purego struct support"
 	return LlamaContextParams{
-		Seed:            LLAMA_DEFAULT_SEED,
 		NCtx:            0, // 0 = from model
 		NBatch:          2048,
 		NUbatch:         512,
@@ -1517,6 +2385,7 @@ func ContextDefaultParams() LlamaContextParams {
 		RopeScalingType: LLAMA_ROPE_SCALING_TYPE_UNSPECIFIED,
 		PoolingType:     LLAMA_POOLING_TYPE_UNSPECIFIED,
 		AttentionType:   LLAMA_ATTENTION_TYPE_CAUSAL,
+		FlashAttnType:   LLAMA_FLASH_ATTN_TYPE_AUTO,
 		RopeFreqBase:    0.0, // 0.0 = from model
 		RopeFreqScale:   0.0, // 0.0 = from model
 		YarnExtFactor:   -1.0,
@@ -1525,13 +2394,13 @@ func ContextDefaultParams() LlamaContextParams {
 		YarnBetaSlow:    1.0,
 		YarnOrigCtx:     0,
 		DefragThold:     -1.0,
-		TypeK:           -1,
-		TypeV:           -1,
-		Logits:          0,
+		TypeK:           1, // GGML_TYPE_F16
+		TypeV:           1, // GGML_TYPE_F16
 		Embeddings:      0,
 		Offload_kqv:     1,
-		FlashAttn:       0,
 		NoPerf:          0,
+		OpOffload:       1,
+		SwaFull:         1,
 	}
 }
 
@@ -1545,34 +2414,23 @@ func SamplerChainDefaultParams() LlamaSamplerChainParams {
 	}
 }
 
-// DetectGpuBackend detects the available GPU backend on the current system
+// DetectGpuBackend detects the available GPU backend on the current system.
+// A backend forced with Config.PreferredBackend or GOLLAMA_BACKEND takes
+// precedence over detection.
 func DetectGpuBackend() LlamaGpuBackend {
-	// Check for GPU backends in priority order based on platform
-	switch runtime.GOOS {
-	case "darwin":
-		// On macOS, Metal is the primary GPU backend
-		return LLAMA_GPU_BACKEND_METAL
-	case "linux", "windows":
-		// Check for available GPU SDKs in priority order
-		if hasCommand("nvcc") {
-			return LLAMA_GPU_BACKEND_CUDA
-		}
-		if hasCommand("hipconfig") {
-			return LLAMA_GPU_BACKEND_HIP
-		}
-		if hasCommand("vulkaninfo") {
-			return LLAMA_GPU_BACKEND_VULKAN
-		}
-		if hasCommand("clinfo") {
-			return LLAMA_GPU_BACKEND_OPENCL
-		}
-		if hasCommand("sycl-ls") {
-			return LLAMA_GPU_BACKEND_SYCL
-		}
-		return LLAMA_GPU_BACKEND_CPU
-	default:
-		return LLAMA_GPU_BACKEND_CPU
+	if chain := preferredGpuBackends(); len(chain) > 0 {
+		return chain[0]
+	}
+	return detectGpuBackend()
+}
+
+// detectGpuBackend returns the highest-priority backend found by
+// ProbeGpuBackends, or the CPU backend.
+func detectGpuBackend() LlamaGpuBackend {
+	if probes := ProbeGpuBackends(); len(probes) > 0 {
+		return probes[0].Backend
 	}
+	return LLAMA_GPU_BACKEND_CPU
 }
 
 // hasCommand checks if a command is available in PATH
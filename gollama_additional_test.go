@@ -1,6 +1,7 @@
 package gollama
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,12 +26,67 @@ func (s *GollamaMoreSuite) TearDownTest() {
 	s.BaseSuite.TearDownTest()
 }
 
-// Exercises Token_data_array_init happy path without requiring a model
-func (s *GollamaMoreSuite) TestTokenDataArrayInit() {
-	arr := Token_data_array_init(0)
+// Token_data_array_init needs a model to size the array
+func (s *GollamaMoreSuite) TestTokenDataArrayInitWithoutModel() {
+	assert.Nil(s.T(), Token_data_array_init(0))
+	assert.Equal(s.T(), int32(0), Vocab_n_tokens(0))
+	assert.Equal(s.T(), int32(0), N_vocab(0))
+}
+
+// Context introspection reports nothing for a missing context
+func (s *GollamaMoreSuite) TestContextIntrospectionWithoutContext() {
+	assert.Zero(s.T(), N_ctx(0))
+	assert.Zero(s.T(), N_batch(0))
+	assert.Zero(s.T(), N_ubatch(0))
+	assert.Zero(s.T(), N_seq_max(0))
+	assert.Equal(s.T(), LLAMA_POOLING_TYPE_UNSPECIFIED, Pooling_type(0))
+	assert.Equal(s.T(), LlamaModel(0), Get_model(0))
+	Synchronize(0)
+	assert.Empty(s.T(), Model_desc(0))
+	assert.Zero(s.T(), Model_size(0))
+	assert.Zero(s.T(), Model_n_params(0))
+}
+
+// Logits helpers must size their output from the model vocabulary
+func (s *GollamaMoreSuite) TestLogitsLengthMatchesVocab() {
+	modelPath := "./models/tinyllama-1.1b-chat-v1.0.Q2_K.gguf"
+	if _, err := os.Stat(modelPath); err != nil {
+		s.T().Skipf("Model not available at %s", modelPath)
+	}
+	params := Model_default_params()
+	params.NGpuLayers = 0
+	model, err := Model_load_from_file(modelPath, params)
+	require.NoError(s.T(), err)
+	defer Model_free(model)
+
+	nVocab := Vocab_n_tokens(model)
+	require.Greater(s.T(), nVocab, int32(0))
+
+	ctx, err := Init_from_model(model, Context_default_params())
+	require.NoError(s.T(), err)
+	defer Free(ctx)
+	assert.Equal(s.T(), nVocab, N_vocab(ctx))
+
+	tokens, err := Tokenize(model, "Hello", true, false)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), Decode(ctx, Batch_get_one(tokens)))
+
+	logits := Get_logits_ith_slice(ctx, -1)
+	assert.Len(s.T(), logits, int(nVocab))
+
+	arr := Token_data_array_from_logits(model, &logits[0])
+	require.NotNil(s.T(), arr)
+	assert.Equal(s.T(), uint64(nVocab), arr.Size)
+
+	arr = Token_data_array_init(model)
 	require.NotNil(s.T(), arr)
-	assert.Equal(s.T(), uint64(256), arr.Size)
-	require.NotNil(s.T(), arr.Data)
+	assert.Equal(s.T(), uint64(nVocab), arr.Size)
+
+	// A limit keeps the most likely tokens
+	arr = Token_data_array_from_logits(model, &logits[0], 10)
+	require.NotNil(s.T(), arr)
+	assert.Equal(s.T(), uint64(10), arr.Size)
+	assert.Equal(s.T(), topLogits(logits, 1)[0], arr.Slice()[0].Id)
 }
 
 // Load a tiny model, check a few simple APIs that were previously uncovered
@@ -49,6 +105,9 @@ func (s *GollamaMoreSuite) TestModelAndContextBasics() {
 	// Basic model query
 	nEmb := Model_n_embd(model)
 	assert.Greater(s.T(), nEmb, int32(0))
+	assert.NotEmpty(s.T(), Model_desc(model))
+	assert.Greater(s.T(), Model_size(model), uint64(0))
+	assert.Greater(s.T(), Model_n_params(model), uint64(0))
 
 	// Create context from model
 	ctxParams := Context_default_params()
@@ -56,6 +115,12 @@ func (s *GollamaMoreSuite) TestModelAndContextBasics() {
 	require.NoError(s.T(), err)
 	defer Free(ctx)
 
+	// The context reports its actual configuration
+	assert.Equal(s.T(), model, Get_model(ctx))
+	assert.Greater(s.T(), N_ctx(ctx), uint32(0))
+	assert.LessOrEqual(s.T(), N_ubatch(ctx), N_batch(ctx))
+	assert.GreaterOrEqual(s.T(), N_seq_max(ctx), uint32(1))
+
 	// Exercise simple getters/setters that previously had no coverage
 	Set_causal_attn(ctx, true)
 	Set_embeddings(ctx, true)
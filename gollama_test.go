@@ -1,9 +1,9 @@
 package gollama
 
 import (
+	"reflect"
 	"runtime"
 	"testing"
-	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -110,30 +110,11 @@ func (s *GollamaSuite) TestContextDefaultParamsDetailed() {
 }
 
 // Test token data array functionality (from token_array_test.go)
-func (s *GollamaSuite) TestTokenDataArrayFromLogits() {
+func (s *GollamaSuite) TestTokenDataArrayFromLogitsWithoutModel() {
 	logits := make([]float32, 256)
-	for i := 0; i < 256; i++ {
-		logits[i] = float32(i) * 0.1
-	}
-	tokenArray := Token_data_array_from_logits(LlamaModel(0), &logits[0])
-	s.NotEmpty(tokenArray, "Token array should not be empty")
-	assert.NotZero(s.T(), tokenArray.Size)
-	assert.Equal(s.T(), int64(-1), tokenArray.Selected)
-	assert.Equal(s.T(), uint8(0x0), tokenArray.Sorted)
-	if tokenArray.Data == nil {
-		s.T().Fatal("Data pointer should not be nil")
-	}
-	firstToken := tokenArray.Data
-	assert.Equal(s.T(), LlamaToken(0), firstToken.Id)
-	assert.Equal(s.T(), float32(0.0), firstToken.Logit)
-	s.T().Logf("SUCCESS: Token array created with size %d", tokenArray.Size)
-	s.T().Logf("Data pointer: %p", tokenArray.Data)
-	s.T().Logf("First token: ID=%d, Logit=%f", firstToken.Id, firstToken.Logit)
-	if tokenArray.Size > 1 {
-		lastIndex := tokenArray.Size - 1
-		lastElement := (*LlamaTokenData)(unsafe.Pointer(uintptr(unsafe.Pointer(tokenArray.Data)) + uintptr(lastIndex)*unsafe.Sizeof(LlamaTokenData{})))
-		s.T().Logf("Last token: ID=%d, Logit=%f", lastElement.Id, lastElement.Logit)
-	}
+	// Without a model the vocabulary size is unknown, so no array is built
+	s.Nil(Token_data_array_from_logits(LlamaModel(0), &logits[0]))
+	s.Nil(Token_data_array_from_logits(LlamaModel(0), nil))
 }
 
 // Test tokenization functionality (from test_tokenize.go)
@@ -236,4 +217,42 @@ func (s *GollamaSuite) TestCommandDetection() {
 	}
 }
 
+// TestSamplerFreeReleasesChain tests that Sampler_free hands the sampler to
+// llama_sampler_free
+func (s *GollamaSuite) TestSamplerFreeReleasesChain() {
+	chainFree := llamaSamplerChainFree
+	defer func() { llamaSamplerChainFree = chainFree }()
+	var freed []LlamaSampler
+	llamaSamplerChainFree = func(smpl LlamaSampler) {
+		freed = append(freed, smpl)
+		chainFree(smpl)
+	}
+
+	chain := Sampler_chain_init(Sampler_chain_default_params())
+	s.Require().NotZero(chain)
+	Sampler_free(chain)
+	s.Equal([]LlamaSampler{chain}, freed)
+
+	Sampler_free(0)
+	s.Len(freed, 1, "a null sampler is not freed")
+}
+
+// TestMirostatBindingsMatchC tests that the Mirostat init bindings declare
+// the arguments of llama_sampler_init_mirostat(n_vocab, seed, tau, eta, m)
+// and llama_sampler_init_mirostat_v2(seed, tau, eta), in that order
+func (s *GollamaSuite) TestMirostatBindingsMatchC() {
+	s.Equal(reflect.TypeOf(func(int32, uint32, float32, float32, int32) LlamaSampler { return 0 }),
+		reflect.TypeOf(llamaSamplerInitMirostat))
+	s.Equal(reflect.TypeOf(func(uint32, float32, float32) LlamaSampler { return 0 }),
+		reflect.TypeOf(llamaSamplerInitMirostatV2))
+
+	for _, smpl := range []LlamaSampler{
+		llamaSamplerInitMirostat(32000, 42, 5.0, 0.1, 100),
+		llamaSamplerInitMirostatV2(42, 5.0, 0.1),
+	} {
+		s.Require().NotZero(smpl)
+		llamaSamplerChainFree(smpl)
+	}
+}
+
 func TestGollamaSuite(t *testing.T) { suite.Run(t, new(GollamaSuite)) }
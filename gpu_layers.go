@@ -0,0 +1,153 @@
+package gollama
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// minGpuMemoryReserve is the device memory EstimateGpuLayers leaves free at
+// least, for compute buffers and other allocations of the backend.
+const minGpuMemoryReserve = 256 << 20
+
+// EstimateGpuLayers returns the number of layers of a model that fit in the
+// free memory of dev, for LlamaModelParams.NGpuLayers. A 0 dev picks the
+// first GPU device. Layer sizes come from the tensor layout in the GGUF
+// header (every part of a split model is read) and each offloaded layer
+// also holds its share of an F16 KV cache for Config.ContextSize tokens.
+// A tenth of the free memory, and at least 256 MiB, is kept in reserve.
+// When every layer fits and the output layer does too, the result is the
+// layer count plus one, which also offloads the output layer.
+func EstimateGpuLayers(modelPath string, dev GgmlBackendDevice) (int32, error) {
+	paths, err := FindModelSplits(modelPath)
+	if err != nil {
+		return 0, err
+	}
+	files := make([]*GGUFFile, len(paths))
+	for i, p := range paths {
+		if files[i], err = ReadGGUF(p); err != nil {
+			return 0, err
+		}
+	}
+
+	if dev == 0 {
+		if dev, err = firstGpuDevice(); err != nil {
+			return 0, err
+		}
+	}
+	free, _, err := Ggml_backend_dev_memory(dev)
+	if err != nil {
+		return 0, err
+	}
+
+	nCtx := uint64(2048)
+	if globalConfig != nil && globalConfig.ContextSize > 0 {
+		nCtx = uint64(globalConfig.ContextSize)
+	}
+	return fitGpuLayers(files, free, nCtx)
+}
+
+// firstGpuDevice returns the first GPU (or integrated GPU) device.
+func firstGpuDevice() (GgmlBackendDevice, error) {
+	count, err := Ggml_backend_dev_count()
+	if err != nil {
+		return 0, err
+	}
+	for i := uint64(0); i < count; i++ {
+		dev, err := Ggml_backend_dev_get(i)
+		if err != nil || dev == 0 {
+			continue
+		}
+		switch t, _ := Ggml_backend_dev_type(dev); t {
+		case GGML_BACKEND_DEVICE_TYPE_GPU, GGML_BACKEND_DEVICE_TYPE_IGPU:
+			return dev, nil
+		}
+	}
+	return 0, ErrGPUNotAvailable
+}
+
+// fitGpuLayers counts the layers of the model described by files (the
+// first holding the metadata) that fit in free bytes with an nCtx KV cache.
+// Like llama.cpp, the last layers are offloaded first.
+func fitGpuLayers(files []*GGUFFile, free, nCtx uint64) (int32, error) {
+	meta := files[0]
+	arch, _ := meta.MetaString("general.architecture")
+
+	var layerBytes []uint64
+	var outputBytes, tokenEmbdBytes uint64
+	hasOutput := false
+	for _, f := range files {
+		for _, t := range f.Tensors {
+			switch {
+			case strings.HasPrefix(t.Name, "blk."):
+				idx, _, _ := strings.Cut(strings.TrimPrefix(t.Name, "blk."), ".")
+				n, err := strconv.Atoi(idx)
+				if err != nil || n < 0 {
+					continue
+				}
+				for len(layerBytes) <= n {
+					layerBytes = append(layerBytes, 0)
+				}
+				layerBytes[n] += t.Size
+			case strings.HasPrefix(t.Name, "output"):
+				outputBytes += t.Size
+				hasOutput = hasOutput || t.Name == "output.weight"
+			case t.Name == "token_embd.weight":
+				tokenEmbdBytes = t.Size
+			}
+		}
+	}
+	if n, ok := meta.MetaUint(arch + ".block_count"); ok && int(n) > len(layerBytes) {
+		layerBytes = append(layerBytes, make([]uint64, int(n)-len(layerBytes))...)
+	}
+	if len(layerBytes) == 0 {
+		return 0, fmt.Errorf("%w: no layers found in the model", ErrUnsupportedModelType)
+	}
+	if !hasOutput {
+		// Tied embeddings: the output layer uses a copy of token_embd
+		outputBytes += tokenEmbdBytes
+	}
+
+	// F16 K and V for every token of the context, per layer
+	if ctxLen, ok := meta.MetaUint(arch + ".context_length"); ok && ctxLen > 0 && ctxLen < nCtx {
+		nCtx = ctxLen
+	}
+	kvBytes := nCtx * (ggufKVWidth(meta, arch, "key_length") + ggufKVWidth(meta, arch, "value_length")) * 2
+
+	reserve := max(uint64(minGpuMemoryReserve), free/10)
+	if free <= reserve {
+		return 0, nil
+	}
+	budget := free - reserve
+
+	var used uint64
+	var n int32
+	for i := len(layerBytes) - 1; i >= 0; i-- {
+		cost := layerBytes[i] + kvBytes
+		if used+cost > budget {
+			return n, nil
+		}
+		used += cost
+		n++
+	}
+	if used+outputBytes <= budget {
+		n++
+	}
+	return n, nil
+}
+
+// ggufKVWidth returns the width of the keys or values of all KV heads of a
+// layer: the head size times the number of KV heads.
+func ggufKVWidth(meta *GGUFFile, arch, lengthKey string) uint64 {
+	nHead, _ := meta.MetaUint(arch + ".attention.head_count")
+	nHeadKV, ok := meta.MetaUint(arch + ".attention.head_count_kv")
+	if !ok {
+		nHeadKV = nHead
+	}
+	headSize, ok := meta.MetaUint(arch + ".attention." + lengthKey)
+	if !ok && nHead > 0 {
+		embd, _ := meta.MetaUint(arch + ".embedding_length")
+		headSize = embd / nHead
+	}
+	return headSize * nHeadKV
+}
@@ -0,0 +1,69 @@
+package gollama
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type GpuLayersSuite struct{ BaseSuite }
+
+func (s *GpuLayersSuite) TestFitGpuLayers() {
+	const mib = 1 << 20
+	files := []*GGUFFile{{
+		Metadata: map[string]any{
+			"general.architecture":          "llama",
+			"llama.block_count":             uint32(4),
+			"llama.embedding_length":        uint32(64),
+			"llama.attention.head_count":    uint32(8),
+			"llama.attention.head_count_kv": uint32(2),
+			"llama.context_length":          uint32(1024),
+		},
+		Tensors: []GGUFTensorInfo{
+			{Name: "token_embd.weight", Size: 8 * mib},
+			{Name: "blk.0.ffn_up.weight", Size: 100 * mib},
+			{Name: "blk.1.ffn_up.weight", Size: 100 * mib},
+			{Name: "blk.2.ffn_up.weight", Size: 60 * mib},
+			{Name: "blk.2.ffn_down.weight", Size: 40 * mib},
+			{Name: "blk.3.ffn_up.weight", Size: 100 * mib},
+		},
+	}}
+
+	// KV per layer: 1024 tokens * (16*2 + 16*2) * 2 bytes = 128 KiB; the
+	// context is capped at the model's context_length
+	reserve := uint64(minGpuMemoryReserve)
+	kv := uint64(1024 * 64 * 2)
+	cases := []struct {
+		free uint64
+		want int32
+	}{
+		{100 * mib, 0},
+		{reserve + 250*mib, 2},
+		{reserve + 4*(100*mib+kv), 4},
+		// Tied embeddings: the output layer is a copy of token_embd
+		{reserve + 4*(100*mib+kv) + 8*mib, 5},
+		{10000 * mib, 5},
+	}
+	for _, c := range cases {
+		n, err := fitGpuLayers(files, c.free, 4096)
+		s.Require().NoError(err)
+		s.Equal(c.want, n, "free %d MiB", c.free/mib)
+	}
+}
+
+func (s *GpuLayersSuite) TestEstimateGpuLayersErrors() {
+	_, err := EstimateGpuLayers(filepath.Join(s.T().TempDir(), "missing.gguf"), 0)
+	s.ErrorIs(err, ErrInvalidModelPath)
+
+	path := filepath.Join(s.T().TempDir(), "empty.gguf")
+	writeTestGGUF(s.T(), path, map[string]any{"general.architecture": "llama"}, nil)
+	f, err := ReadGGUF(path)
+	s.Require().NoError(err)
+	_, err = fitGpuLayers([]*GGUFFile{f}, 1<<30, 512)
+	s.ErrorIs(err, ErrUnsupportedModelType)
+}
+
+func TestGpuLayersSuite(t *testing.T) {
+	suite.Run(t, new(GpuLayersSuite))
+}
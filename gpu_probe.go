@@ -0,0 +1,167 @@
+package gollama
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GpuProbe is a piece of evidence that a GPU backend can run on this machine.
+type GpuProbe struct {
+	Backend LlamaGpuBackend `json:"backend"`
+	// Source describes the evidence, e.g. "ggml device CUDA0",
+	// "/proc/driver/nvidia/version" or "libvulkan.so.1"
+	Source string `json:"source"`
+}
+
+// gpuProbeOrder is the priority order of GPU backends.
+var gpuProbeOrder = []LlamaGpuBackend{
+	LLAMA_GPU_BACKEND_CUDA,
+	LLAMA_GPU_BACKEND_HIP,
+	LLAMA_GPU_BACKEND_VULKAN,
+	LLAMA_GPU_BACKEND_OPENCL,
+	LLAMA_GPU_BACKEND_SYCL,
+}
+
+// gpuDriverProbe checks the drivers and runtimes of one backend.
+type gpuDriverProbe struct {
+	backend LlamaGpuBackend
+	files   map[string][]string // GOOS -> driver files that must exist
+	libs    map[string][]string // GOOS -> runtime libraries to open
+	command []string            // listing command; success with output counts
+}
+
+// gpuDriverProbes look for installed drivers rather than SDK tools: nvcc or
+// hipconfig in PATH say nothing about the GPU of the machine.
+var gpuDriverProbes = []gpuDriverProbe{
+	{
+		backend: LLAMA_GPU_BACKEND_CUDA,
+		files:   map[string][]string{"linux": {"/proc/driver/nvidia/version"}},
+		libs:    map[string][]string{"linux": {"libcuda.so.1"}, "windows": {"nvcuda.dll"}},
+		command: []string{"nvidia-smi", "-L"},
+	},
+	{
+		backend: LLAMA_GPU_BACKEND_HIP,
+		files:   map[string][]string{"linux": {"/dev/kfd"}},
+		libs:    map[string][]string{"linux": {"libamdhip64.so", "libamdhip64.so.6"}, "windows": {"amdhip64_6.dll", "amdhip64.dll"}},
+		command: []string{"rocm-smi", "--showid"},
+	},
+	{
+		backend: LLAMA_GPU_BACKEND_VULKAN,
+		libs:    map[string][]string{"linux": {"libvulkan.so.1"}, "windows": {"vulkan-1.dll"}},
+	},
+	{
+		backend: LLAMA_GPU_BACKEND_OPENCL,
+		libs:    map[string][]string{"linux": {"libOpenCL.so.1"}, "windows": {"OpenCL.dll"}},
+	},
+	{
+		backend: LLAMA_GPU_BACKEND_SYCL,
+		libs:    map[string][]string{"linux": {"libze_loader.so.1"}, "windows": {"ze_loader.dll"}},
+	},
+}
+
+var (
+	driverProbeOnce    sync.Once
+	driverProbeResults []GpuProbe
+)
+
+// ProbeGpuBackends returns the GPU backends found on this machine in
+// priority order (CUDA, HIP, Vulkan, OpenCL, SYCL), with the evidence for
+// each. The GPU devices of a loaded library are the strongest evidence;
+// otherwise driver files, runtime libraries that the system loader can
+// open and vendor tools such as nvidia-smi are checked. Driver checks run
+// once per process. macOS always reports Metal.
+func ProbeGpuBackends() []GpuProbe {
+	if runtime.GOOS == "darwin" {
+		return []GpuProbe{{Backend: LLAMA_GPU_BACKEND_METAL, Source: "macOS"}}
+	}
+
+	probes := probeLoadedDevices()
+	driverProbeOnce.Do(func() {
+		driverProbeResults = probeGpuDrivers(runtime.GOOS)
+	})
+	probes = append(probes, driverProbeResults...)
+
+	// Order by backend priority, keeping the first evidence of each
+	var ordered []GpuProbe
+	for _, backend := range gpuProbeOrder {
+		for _, p := range probes {
+			if p.Backend == backend {
+				ordered = append(ordered, p)
+				break
+			}
+		}
+	}
+	return ordered
+}
+
+// probeLoadedDevices lists the GPU devices of the loaded library. It never
+// loads the library, so it is safe to call while the loader is running.
+func probeLoadedDevices() []GpuProbe {
+	libMutex.RLock()
+	loaded := isLoaded
+	libMutex.RUnlock()
+	if !loaded || !fnTableMu.TryRLock() {
+		return nil
+	}
+	defer fnTableMu.RUnlock()
+	if ggmlBackendDevCount == nil || ggmlBackendDevGet == nil || ggmlBackendDevName == nil || ggmlBackendDevType == nil {
+		return nil
+	}
+
+	var probes []GpuProbe
+	for i := uint64(0); i < ggmlBackendDevCount(); i++ {
+		dev := ggmlBackendDevGet(i)
+		if dev == 0 {
+			continue
+		}
+		switch GgmlBackendDevType(ggmlBackendDevType(dev)) {
+		case GGML_BACKEND_DEVICE_TYPE_GPU, GGML_BACKEND_DEVICE_TYPE_IGPU:
+		default:
+			continue
+		}
+		name := bytePointerToString(ggmlBackendDevName(dev))
+		if backend := backendForName(name); backend != LLAMA_GPU_BACKEND_NONE {
+			probes = append(probes, GpuProbe{Backend: backend, Source: "ggml device " + name})
+		}
+	}
+	return probes
+}
+
+// probeGpuDrivers runs gpuDriverProbes for goos.
+func probeGpuDrivers(goos string) []GpuProbe {
+	var probes []GpuProbe
+	for _, p := range gpuDriverProbes {
+		if source := p.probe(goos); source != "" {
+			probes = append(probes, GpuProbe{Backend: p.backend, Source: source})
+		}
+	}
+	return probes
+}
+
+// probe returns the first evidence found for the backend, or "".
+func (p gpuDriverProbe) probe(goos string) string {
+	for _, file := range p.files[goos] {
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	for _, lib := range p.libs[goos] {
+		if probeLibraryPlatform(lib) {
+			return lib
+		}
+	}
+	if len(p.command) > 0 && hasCommand(p.command[0]) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, p.command[0], p.command[1:]...).Output()
+		if err == nil && strings.TrimSpace(string(out)) != "" {
+			return p.command[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package gollama
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type GpuProbeSuite struct{ BaseSuite }
+
+func (s *GpuProbeSuite) TestDriverProbes() {
+	driver := filepath.Join(s.T().TempDir(), "version")
+	s.Require().NoError(os.WriteFile(driver, []byte("NVRM"), 0o644))
+
+	saved := gpuDriverProbes
+	s.T().Cleanup(func() { gpuDriverProbes = saved })
+	gpuDriverProbes = []gpuDriverProbe{
+		{backend: LLAMA_GPU_BACKEND_CUDA, files: map[string][]string{"linux": {driver}}},
+		{backend: LLAMA_GPU_BACKEND_HIP, files: map[string][]string{"linux": {filepath.Join(s.T().TempDir(), "kfd")}}},
+		{backend: LLAMA_GPU_BACKEND_VULKAN, libs: map[string][]string{"linux": {"libdefinitely-not-vulkan.so.9"}}},
+		{backend: LLAMA_GPU_BACKEND_SYCL, command: []string{"definitely-not-a-real-command-12345"}},
+	}
+
+	s.Equal([]GpuProbe{{Backend: LLAMA_GPU_BACKEND_CUDA, Source: driver}}, probeGpuDrivers("linux"))
+	s.Empty(probeGpuDrivers("windows"), "probes only apply to their own OS")
+}
+
+func (s *GpuProbeSuite) TestProbeOrderAndDetection() {
+	probes := ProbeGpuBackends()
+	for i := 1; i < len(probes); i++ {
+		s.Less(probes[i-1].Backend, probes[i].Backend)
+	}
+	if runtime.GOOS == "darwin" {
+		s.Equal(LLAMA_GPU_BACKEND_METAL, DetectGpuBackend())
+	} else if len(probes) == 0 {
+		s.Equal(LLAMA_GPU_BACKEND_CPU, DetectGpuBackend(), "no GPU evidence means CPU, whatever SDKs are in PATH")
+	}
+}
+
+func TestGpuProbeSuite(t *testing.T) { suite.Run(t, new(GpuProbeSuite)) }
@@ -0,0 +1,7 @@
+//go:build !amd64
+
+package simd
+
+func dot(a, b []float32) float32 {
+	return dotGeneric(a, b)
+}
@@ -0,0 +1,71 @@
+// Package simd implements the float32 vector kernels behind embedding
+// search: dot products, normalization and matrix-vector products. On amd64
+// with AVX2 and FMA the dot product runs in assembly; elsewhere a portable
+// unrolled loop is used.
+package simd
+
+import "math"
+
+// Dot returns the dot product of a and b, which must have the same length.
+func Dot(a, b []float32) float32 {
+	if len(a) != len(b) {
+		panic("simd: Dot of vectors of different lengths")
+	}
+	if len(a) == 0 {
+		return 0
+	}
+	return dot(a, b)
+}
+
+// Normalize scales v in place to unit Euclidean length. A zero vector is
+// left unchanged.
+func Normalize(v []float32) {
+	sum := Dot(v, v)
+	if sum == 0 {
+		return
+	}
+	inv := float32(1 / math.Sqrt(float64(sum)))
+	for i := range v {
+		v[i] *= inv
+	}
+}
+
+// Cosine returns the cosine of the angle between a and b, or 0 when either
+// is a zero vector.
+func Cosine(a, b []float32) float32 {
+	aa, bb := Dot(a, a), Dot(b, b)
+	if aa == 0 || bb == 0 {
+		return 0
+	}
+	return float32(float64(Dot(a, b)) / math.Sqrt(float64(aa)*float64(bb)))
+}
+
+// MatMulVec stores in out the dot product of each row of m with v. m holds
+// len(out) rows of len(v) values.
+func MatMulVec(out, m, v []float32) {
+	dim := len(v)
+	if len(m) != len(out)*dim {
+		panic("simd: MatMulVec shape mismatch")
+	}
+	for i := range out {
+		out[i] = Dot(m[i*dim:(i+1)*dim], v)
+	}
+}
+
+// dotGeneric is the portable dot product, with four accumulators so the
+// additions do not wait on each other.
+func dotGeneric(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return (s0 + s1) + (s2 + s3)
+}
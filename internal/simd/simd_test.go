@@ -0,0 +1,74 @@
+package simd
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SimdSuite struct{ suite.Suite }
+
+func vector(n int, phase float64) []float32 {
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = float32(math.Sin(float64(i)*0.71 + phase))
+	}
+	return v
+}
+
+func refDot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func (s *SimdSuite) TestDotLengths() {
+	for _, n := range []int{0, 1, 3, 7, 8, 9, 31, 32, 33, 64, 100, 384, 1000, 4099} {
+		a, b := vector(n, 0), vector(n, 1)
+		want := refDot(a, b)
+		s.InDelta(want, Dot(a, b), 1e-4*math.Max(1, float64(n)/100), "n=%d", n)
+		s.InDelta(want, dotGeneric(a, b), 1e-4*math.Max(1, float64(n)/100), "n=%d", n)
+	}
+	s.Panics(func() { Dot(make([]float32, 2), make([]float32, 3)) })
+}
+
+func (s *SimdSuite) TestNormalizeAndCosine() {
+	v := []float32{3, 4}
+	Normalize(v)
+	s.InDeltaSlice([]float32{0.6, 0.8}, v, 1e-6)
+
+	zero := make([]float32, 3)
+	Normalize(zero)
+	s.Equal([]float32{0, 0, 0}, zero)
+
+	s.InDelta(1, Cosine([]float32{1, 2}, []float32{2, 4}), 1e-6)
+	s.InDelta(0, Cosine([]float32{1, 0}, []float32{0, 5}), 1e-6)
+	s.Zero(Cosine(zero, zero))
+}
+
+func (s *SimdSuite) TestMatMulVec() {
+	m := []float32{1, 0, 0, 1, 1, 1}
+	out := make([]float32, 3)
+	MatMulVec(out, m, []float32{2, 3})
+	s.Equal([]float32{2, 3, 5}, out)
+	s.Panics(func() { MatMulVec(make([]float32, 2), m, []float32{2, 3}) })
+}
+
+func TestSimdSuite(t *testing.T) { suite.Run(t, new(SimdSuite)) }
+
+func BenchmarkDot384(b *testing.B) {
+	x, y := vector(384, 0), vector(384, 1)
+	for i := 0; i < b.N; i++ {
+		Dot(x, y)
+	}
+}
+
+func BenchmarkDotGeneric384(b *testing.B) {
+	x, y := vector(384, 0), vector(384, 1)
+	for i := 0; i < b.N; i++ {
+		dotGeneric(x, y)
+	}
+}
@@ -0,0 +1,132 @@
+package gollama
+
+import "fmt"
+
+// KVStats describes how much of the memory (KV cache) of a context is in
+// use, so a server can tell when to evict sequences or stop admitting
+// requests before decodes start failing for lack of free cells.
+type KVStats struct {
+	// Cells is the capacity of the memory in tokens (NCtx).
+	Cells int `json:"cells"`
+	// Used is the number of cells holding tokens. llama.cpp does not export
+	// it, so it is the sum of the position ranges of the sequences: exact
+	// for sequences decoded without gaps, an overestimate for sequences
+	// that share cells (Memory_seq_cp) or had positions removed in the
+	// middle without a shift.
+	Used int `json:"used"`
+	// Sequences lists the non-empty sequences in id order.
+	Sequences []SeqKVStats `json:"sequences,omitempty"`
+	// CanShift reports whether the memory supports shifting positions (see
+	// Context.Shift).
+	CanShift bool `json:"can_shift"`
+}
+
+// SeqKVStats is the position range of one sequence in the memory.
+type SeqKVStats struct {
+	SeqID  LlamaSeqId `json:"seq_id"`
+	PosMin LlamaPos   `json:"pos_min"`
+	PosMax LlamaPos   `json:"pos_max"`
+}
+
+// Len returns the number of positions in the range.
+func (s SeqKVStats) Len() int {
+	return int(s.PosMax-s.PosMin) + 1
+}
+
+// Free returns the number of cells left.
+func (s KVStats) Free() int {
+	return max(s.Cells-s.Used, 0)
+}
+
+// Utilization returns the fraction of cells in use, between 0 and 1.
+func (s KVStats) Utilization() float64 {
+	if s.Cells <= 0 {
+		return 0
+	}
+	return min(float64(s.Used)/float64(s.Cells), 1)
+}
+
+// Largest returns the sequence spanning the most positions, whose eviction
+// frees the most cells, or false when the memory is empty.
+func (s KVStats) Largest() (SeqKVStats, bool) {
+	var largest SeqKVStats
+	found := false
+	for _, seq := range s.Sequences {
+		if !found || seq.Len() > largest.Len() {
+			largest, found = seq, true
+		}
+	}
+	return largest, found
+}
+
+// KVStats returns the use of the context memory by sequences 0 to
+// NSeqMax-1. It reads the memory, so it must not run concurrently with a
+// decode on the same context.
+func (c *Context) KVStats() (KVStats, error) {
+	if c.handle == 0 {
+		return KVStats{}, ErrContextNotCreated
+	}
+	if err := checkHandle(handleContext, uintptr(c.handle)); err != nil {
+		return KVStats{}, err
+	}
+	memory := contextMemory(c.handle)
+	if memory == 0 {
+		return KVStats{}, ErrContextNotCreated
+	}
+	return readKVStats(memory, int(c.NCtx), int(c.NSeqMax)), nil
+}
+
+// readKVStats reads the stats of memory, which holds cells cells and
+// nSeqMax sequences, with the native functions.
+func readKVStats(memory LlamaMemory, cells, nSeqMax int) KVStats {
+	stats := KVStats{Cells: cells}
+	if memory == 0 {
+		return stats
+	}
+	stats.CanShift = llamaMemoryCanShift(memory)
+	for seq := LlamaSeqId(0); seq < LlamaSeqId(nSeqMax); seq++ {
+		posMax := llamaMemorySeqPosMax(memory, seq)
+		if posMax < 0 {
+			continue
+		}
+		s := SeqKVStats{SeqID: seq, PosMin: llamaMemorySeqPosMin(memory, seq), PosMax: posMax}
+		stats.Sequences = append(stats.Sequences, s)
+		stats.Used += s.Len()
+	}
+	return stats
+}
+
+// NoKvSlotError is returned by Decode when llama_decode finds no room in
+// the memory for the batch (result 1). Nothing of the batch was decoded
+// and the context stays usable: decode a smaller batch, which
+// DecodeTokens, DecodeChunked and Context.DecodeTokens do by themselves,
+// evict sequences with SeqRm, or create the context with a larger NCtx.
+// llama.cpp b6862 has no defragmentation call to try first. It matches
+// ErrNoKvSlot with errors.Is.
+type NoKvSlotError struct {
+	// Batch is the number of tokens of the batch.
+	Batch int
+	// Stats is the use of the memory when the decode failed.
+	Stats KVStats
+}
+
+// Error implements the error interface
+func (e *NoKvSlotError) Error() string {
+	return fmt.Sprintf("%v: %d tokens, %d of %d cells used by %d sequences; decode a smaller batch, evict sequences or use a larger context",
+		ErrNoKvSlot, e.Batch, e.Stats.Used, e.Stats.Cells, len(e.Stats.Sequences))
+}
+
+// Is matches ErrNoKvSlot
+func (e *NoKvSlotError) Is(target error) bool {
+	return target == ErrNoKvSlot
+}
+
+// reportKV updates the KV cache gauges of the metrics after a decode.
+func (c *Context) reportKV() {
+	if !metrics.enabled.Load() {
+		return
+	}
+	if stats, err := c.KVStats(); err == nil {
+		c.kvGauge.set(stats.Cells, stats.Used)
+	}
+}
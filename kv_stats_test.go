@@ -0,0 +1,67 @@
+package gollama
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type KVStatsSuite struct{ BaseSuite }
+
+func (s *KVStatsSuite) TestRequiresContext() {
+	_, err := (&Context{}).KVStats()
+	s.ErrorIs(err, ErrContextNotCreated)
+}
+
+func (s *KVStatsSuite) TestDerivedValues() {
+	stats := KVStats{Cells: 100, Used: 30, Sequences: []SeqKVStats{
+		{SeqID: 0, PosMin: 0, PosMax: 9},
+		{SeqID: 2, PosMin: 5, PosMax: 24},
+	}}
+	s.Equal(10, stats.Sequences[0].Len())
+	s.Equal(70, stats.Free())
+	s.InDelta(0.3, stats.Utilization(), 1e-9)
+	largest, ok := stats.Largest()
+	s.True(ok)
+	s.Equal(LlamaSeqId(2), largest.SeqID)
+
+	// Shared cells can make Used exceed the capacity
+	stats.Used = 120
+	s.Zero(stats.Free())
+	s.Equal(1.0, stats.Utilization())
+
+	_, ok = KVStats{}.Largest()
+	s.False(ok)
+	s.Zero(KVStats{}.Utilization())
+}
+
+func (s *KVStatsSuite) TestGauge() {
+	before := Metrics()
+	var a, b kvGauge
+	a.set(100, 10)
+	b.set(50, 5)
+	a.set(100, 40)
+	after := Metrics()
+	s.Equal(before.KVCacheCells+150, after.KVCacheCells)
+	s.Equal(before.KVCacheUsedCells+45, after.KVCacheUsedCells)
+
+	a.set(0, 0)
+	b.set(0, 0)
+	s.Equal(before.KVCacheCells, Metrics().KVCacheCells)
+	s.Equal(before.KVCacheUsedCells, Metrics().KVCacheUsedCells)
+}
+
+func (s *KVStatsSuite) TestNoKvSlotError() {
+	var err error = &NoKvSlotError{Batch: 512, Stats: KVStats{Cells: 4096, Used: 4000, Sequences: make([]SeqKVStats, 3)}}
+	s.ErrorIs(err, ErrNoKvSlot)
+	s.NotErrorIs(err, ErrContextFull)
+	s.Contains(err.Error(), "512 tokens, 4000 of 4096 cells used by 3 sequences")
+
+	var slot *NoKvSlotError
+	s.True(errors.As(fmt.Errorf("decoding: %w", err), &slot))
+	s.Equal(512, slot.Batch)
+}
+
+func TestKVStatsSuite(t *testing.T) { suite.Run(t, new(KVStatsSuite)) }
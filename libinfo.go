@@ -0,0 +1,106 @@
+package gollama
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// LibraryInfo identifies the llama.cpp library that is loaded, for telling
+// which of the candidate libraries was picked when debugging version
+// mismatches.
+type LibraryInfo struct {
+	// Path is the library file that was opened. It is a bare file name when
+	// the library was found by the system dynamic loader.
+	Path string `json:"path"`
+	// Build is the llama.cpp build number (e.g. 6862 for b6862), taken from
+	// the requested version or the library path and falling back to
+	// LlamaCppBuild. llama.cpp does not export its build number.
+	Build int `json:"build"`
+	// LayoutBuild is the first build of the struct layout in use.
+	LayoutBuild int `json:"layout_build"`
+	// GgmlVersion and GgmlCommit are reported by ggml_version and
+	// ggml_commit; they are empty for libraries that do not export them.
+	GgmlVersion string `json:"ggml_version,omitempty"`
+	GgmlCommit  string `json:"ggml_commit,omitempty"`
+	// Backends lists the registered ggml backends (e.g. "CPU", "CUDA").
+	// Dynamically loaded backends appear after Ggml_backend_load_all.
+	Backends []string `json:"backends"`
+	// SystemInfo is the llama_print_system_info string.
+	SystemInfo string `json:"system_info"`
+}
+
+// LoadedLibraryInfo returns information about the loaded llama.cpp library,
+// loading it first if needed.
+func LoadedLibraryInfo() (LibraryInfo, error) {
+	if err := ensureLoaded(); err != nil {
+		return LibraryInfo{}, err
+	}
+
+	libMutex.RLock()
+	path := loadedLibPath
+	version := loaderLibVersion
+	layout := currentLayout()
+	libMutex.RUnlock()
+
+	if strings.ContainsRune(path, filepath.Separator) {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+
+	info := LibraryInfo{
+		Path:        path,
+		Build:       libraryBuild(version, path),
+		LayoutBuild: layout.build,
+		SystemInfo:  Print_system_info(),
+	}
+	if ggmlVersion != nil {
+		info.GgmlVersion = bytePointerToString(ggmlVersion())
+	}
+	if ggmlCommit != nil {
+		info.GgmlCommit = bytePointerToString(ggmlCommit())
+	}
+	if ggmlBackendRegCount != nil && ggmlBackendRegGet != nil && ggmlBackendRegName != nil {
+		for i := uint64(0); i < ggmlBackendRegCount(); i++ {
+			reg := ggmlBackendRegGet(i)
+			if reg == 0 {
+				continue
+			}
+			if name := bytePointerToString(ggmlBackendRegName(reg)); name != "" {
+				info.Backends = append(info.Backends, name)
+			}
+		}
+	}
+	return info, nil
+}
+
+// SymbolStatus reports whether a symbol resolves in the loaded library.
+type SymbolStatus struct {
+	Name  string `json:"name"`
+	Found bool   `json:"found"`
+}
+
+// LookupSymbols resolves names in the loaded library. Without names it
+// checks every llama.cpp function gollama binds, which shows what a library
+// built from a different llama.h is missing.
+func LookupSymbols(names ...string) ([]SymbolStatus, error) {
+	release, err := acquireNativeCall("LookupSymbols")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	libMutex.RLock()
+	handle := libHandle
+	if len(names) == 0 {
+		names = append([]string(nil), boundSymbols...)
+	}
+	libMutex.RUnlock()
+
+	statuses := make([]SymbolStatus, len(names))
+	for i, name := range names {
+		addr, err := getProcAddressPlatform(handle, name)
+		statuses[i] = SymbolStatus{Name: name, Found: err == nil && addr != 0}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,60 @@
+package gollama
+
+import (
+	"context"
+	"io"
+)
+
+var (
+	_ io.Closer = (*Model)(nil)
+	_ io.Closer = (*Context)(nil)
+)
+
+// Close releases the model like Free. It implements io.Closer and always
+// returns nil.
+func (m *Model) Close() error {
+	m.Free()
+	return nil
+}
+
+// Close releases the context like Free. It implements io.Closer and always
+// returns nil.
+func (c *Context) Close() error {
+	c.Free()
+	return nil
+}
+
+// CloseOnDone closes c once ctx is done, tying the lifetime of a Model or a
+// Context to a request, a worker or the whole program. Calling the
+// returned stop function detaches c from ctx; it reports whether it did so
+// before the close started. The close does not wait for calls in progress:
+// work using c must end with ctx, e.g. by passing ctx to Generate, before
+// the native object goes away. Closing a Model closes its contexts too.
+//
+// Example usage:
+//
+//	model, err := gollama.LoadModel(path, gollama.Model_default_params())
+//	if err != nil {
+//		return err
+//	}
+//	gollama.CloseOnDone(serverCtx, model)
+func CloseOnDone(ctx context.Context, c io.Closer) (stop func() bool) {
+	return context.AfterFunc(ctx, func() { _ = c.Close() })
+}
+
+// track records c as a context created from m, freed along with it.
+func (m *Model) track(c *Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.contexts == nil {
+		m.contexts = make(map[*Context]struct{})
+	}
+	m.contexts[c] = struct{}{}
+}
+
+// untrack forgets the freed context c.
+func (m *Model) untrack(c *Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.contexts, c)
+}
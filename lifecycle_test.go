@@ -0,0 +1,87 @@
+package gollama
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LifecycleSuite struct{ BaseSuite }
+
+type closeRecorder chan struct{}
+
+func (c closeRecorder) Close() error {
+	close(c)
+	return nil
+}
+
+func (s *LifecycleSuite) TestCloseWithoutHandles() {
+	for _, c := range []io.Closer{&Model{}, &Context{}} {
+		s.NoError(c.Close())
+		s.NoError(c.Close())
+	}
+}
+
+func (s *LifecycleSuite) TestModelFreeClosesContexts() {
+	m := &Model{}
+	c := &Context{handle: 1, model: m}
+	m.track(c)
+	other := &Context{handle: 2, model: m}
+	m.track(other)
+	s.Require().NoError(other.Close())
+	s.Len(m.contexts, 1)
+
+	s.Require().NoError(m.Close())
+	s.Zero(c.Handle())
+	s.Empty(m.contexts)
+}
+
+func (s *LifecycleSuite) TestCloseOnDone() {
+	ctx, cancel := context.WithCancel(context.Background())
+	closed := make(closeRecorder)
+	CloseOnDone(ctx, closed)
+	cancel()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		s.Fail("not closed after cancellation")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	kept := make(closeRecorder)
+	stop := CloseOnDone(ctx, kept)
+	s.True(stop())
+	cancel()
+	select {
+	case <-kept:
+		s.Fail("closed after stop")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (s *LifecycleSuite) TestCloseOnDoneModel() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	params := Model_default_params()
+	params.NGpuLayers = 0
+	model, err := LoadModel("./models/tinyllama-1.1b-chat-v1.0.Q2_K.gguf", params)
+	if err != nil {
+		s.T().Skipf("model not available: %v", err)
+	}
+	c, err := NewContext(model, Context_default_params())
+	s.Require().NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	CloseOnDone(ctx, model)
+	cancel()
+	s.Eventually(func() bool { return c.Handle() == 0 && model.Handle() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestLifecycleSuite(t *testing.T) {
+	suite.Run(t, new(LifecycleSuite))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -13,6 +14,7 @@ import (
 type LibraryLoader struct {
 	handle          uintptr
 	loaded          bool
+	version         string
 	llamaLibPath    string
 	rootLibPath     string
 	extensionSuffix string
@@ -36,19 +38,45 @@ func (l *LibraryLoader) LoadLibrary() error {
 // 3) Cache directory entries matching current GOOS (best-effort scan)
 // 4) Download + extract to cache
 // 5) Return a detailed error if all fail
+//
+// When Config.PreferredBackend names a backend chain, each backend is tried
+// in turn instead: the bundled library if it is that backend's build, then
+// the backend's release in the cache, then its download.
+//
+// In offline mode (Config.Offline) the download steps fail without network
+// access and the error wraps ErrOffline.
+//
+// If a different version is already loaded, the switch is performed atomically
+// with respect to native calls: it fails with ErrBusy while any call is in
+// flight, and blocks new calls until the new library is in place. An empty
+// version keeps whatever library is already loaded.
 func (l *LibraryLoader) LoadLibraryWithVersion(version string) error {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 
-	if l.loaded {
-		return nil
-	}
-
 	resolvedVersion := version
 	if resolvedVersion == "" {
 		resolvedVersion = LlamaCppBuild
 	}
 
+	if l.loaded {
+		if version == "" || l.version == resolvedVersion {
+			return nil
+		}
+		// Switching versions swaps the whole function table
+		if !fnTableMu.TryLock() {
+			return fmt.Errorf("cannot switch from llama.cpp %s to %s: %w", l.version, resolvedVersion, ErrBusy)
+		}
+		defer fnTableMu.Unlock()
+		l.unloadLocked()
+		_ = resetLibraryState() // Function pointers are re-registered from the new library on next use
+	}
+	defer func() {
+		if l.loaded {
+			l.version = resolvedVersion
+		}
+	}()
+
 	// Initialize downloader if not already done
 	if l.downloader == nil {
 		// Check if global config has a custom cache directory
@@ -64,49 +92,31 @@ func (l *LibraryLoader) LoadLibraryWithVersion(version string) error {
 		l.downloader = downloader
 	}
 
-	var reasons []string
+	if l == globalLoader {
+		libMutex.Lock()
+		loaderLibVersion = resolvedVersion
+		libMutex.Unlock()
+	}
 
-	// 1) Embedded libraries
-	if resolvedVersion == LlamaCppBuild && hasEmbeddedLibraryForPlatform(runtime.GOOS, runtime.GOARCH) {
-		targetDir := filepath.Join(l.downloader.cacheDir, "embedded", embeddedPlatformDirName(runtime.GOOS, runtime.GOARCH))
-		if !l.downloader.isLibraryReady(targetDir) {
-			if err := extractEmbeddedLibrariesTo(targetDir, runtime.GOOS, runtime.GOARCH); err != nil {
-				reasons = append(reasons, fmt.Sprintf("embedded extract failed: %v", err))
-			}
-		}
-		if l.downloader.isLibraryReady(targetDir) {
-			if libPath, err := l.downloader.FindLibraryPathForPlatform(targetDir, runtime.GOOS); err == nil {
-				info, errs := l.LoadLibraryWithDependencies(libPath)
-				reasons = append(reasons, errs...)
-				if info.Success {
-					if err := l.ApplyLibraryLoad(info, targetDir); err == nil {
-						return nil
-					}
-				}
-			} else {
-				reasons = append(reasons, fmt.Sprintf("embedded lib not found in %s: %v", targetDir, err))
-			}
+	var reasons []string
+	fail := func() error {
+		if l.downloader.offline {
+			return fmt.Errorf("%w: no usable local llama.cpp libraries: %s", ErrOffline, strings.Join(reasons, "; "))
 		}
+		return fmt.Errorf("failed to resolve llama.cpp libraries: %s", strings.Join(reasons, "; "))
 	}
 
-	// 2) Local ./libs for the same build (only when version == LlamaCppBuild)
-	if !l.loaded && resolvedVersion == LlamaCppBuild {
-		localDir := filepath.Join("libs", embeddedPlatformDirName(runtime.GOOS, runtime.GOARCH))
-		if _, statErr := os.Stat(localDir); statErr == nil {
-			if libPath, err := l.downloader.FindLibraryPathForPlatform(localDir, runtime.GOOS); err == nil {
-				info, errs := l.LoadLibraryWithDependencies(libPath)
-				reasons = append(reasons, errs...)
-				if info.Success {
-					if err := l.ApplyLibraryLoad(info, localDir); err == nil {
-						return nil
-					}
-				}
-			} else {
-				reasons = append(reasons, fmt.Sprintf("./libs library not found: %v", err))
-			}
-		} else if !os.IsNotExist(statErr) {
-			reasons = append(reasons, fmt.Sprintf("./libs check failed: %v", statErr))
+	// A preferred backend chain replaces steps 1-4 with one attempt per backend
+	if chain := preferredGpuBackends(); len(chain) > 0 {
+		if l.loadPreferredBackends(chain, resolvedVersion, &reasons) {
+			return nil
 		}
+		return fail()
+	}
+
+	// 1-2) Embedded libraries and local ./libs
+	if l.loadBundled(resolvedVersion, &reasons) {
+		return nil
 	}
 
 	// 3) Cache directory scan (best effort, match GOOS by library filename)
@@ -145,57 +155,174 @@ func (l *LibraryLoader) LoadLibraryWithVersion(version string) error {
 	release, err := l.getReleaseForVersion(resolvedVersion)
 	if err != nil {
 		reasons = append(reasons, fmt.Sprintf("release fetch failed: %v", err))
-		return fmt.Errorf("failed to resolve llama.cpp libraries: %s", strings.Join(reasons, "; "))
+		return fail()
 	}
 
 	pattern, err := l.downloader.GetPlatformAssetPattern()
 	if err != nil {
 		reasons = append(reasons, fmt.Sprintf("platform pattern failed: %v", err))
-		return fmt.Errorf("failed to resolve llama.cpp libraries: %s", strings.Join(reasons, "; "))
+		return fail()
+	}
+
+	if l.loadReleaseAsset(release, pattern, &reasons) {
+		return nil
+	}
+	return fail()
+}
+
+// loadBundled loads the embedded library or the one in ./libs, which are
+// only used for the LlamaCppBuild version.
+func (l *LibraryLoader) loadBundled(resolvedVersion string, reasons *[]string) bool {
+	if resolvedVersion != LlamaCppBuild {
+		return false
+	}
+
+	// 1) Embedded libraries
+	if hasEmbeddedLibraryForPlatform(runtime.GOOS, runtime.GOARCH) {
+		targetDir := filepath.Join(l.downloader.cacheDir, "embedded", embeddedPlatformDirName(runtime.GOOS, runtime.GOARCH))
+		if !l.downloader.isLibraryReady(targetDir) {
+			if err := extractEmbeddedLibrariesTo(targetDir, runtime.GOOS, runtime.GOARCH); err != nil {
+				*reasons = append(*reasons, fmt.Sprintf("embedded extract failed: %v", err))
+			}
+		}
+		if l.downloader.isLibraryReady(targetDir) {
+			if libPath, err := l.downloader.FindLibraryPathForPlatform(targetDir, runtime.GOOS); err == nil {
+				info, errs := l.LoadLibraryWithDependencies(libPath)
+				*reasons = append(*reasons, errs...)
+				if info.Success {
+					if err := l.ApplyLibraryLoad(info, targetDir); err == nil {
+						return true
+					}
+				}
+			} else {
+				*reasons = append(*reasons, fmt.Sprintf("embedded lib not found in %s: %v", targetDir, err))
+			}
+		}
+	}
+
+	// 2) Local ./libs for the same build
+	localDir := filepath.Join("libs", embeddedPlatformDirName(runtime.GOOS, runtime.GOARCH))
+	if _, statErr := os.Stat(localDir); statErr == nil {
+		if libPath, err := l.downloader.FindLibraryPathForPlatform(localDir, runtime.GOOS); err == nil {
+			info, errs := l.LoadLibraryWithDependencies(libPath)
+			*reasons = append(*reasons, errs...)
+			if info.Success {
+				if err := l.ApplyLibraryLoad(info, localDir); err == nil {
+					return true
+				}
+			}
+		} else {
+			*reasons = append(*reasons, fmt.Sprintf("./libs library not found: %v", err))
+		}
+	} else if !os.IsNotExist(statErr) {
+		*reasons = append(*reasons, fmt.Sprintf("./libs check failed: %v", statErr))
 	}
+	return false
+}
+
+// loadPreferredBackends tries the backends of chain in order. For each it
+// uses the bundled library when that is the backend's build, then an
+// extracted release of resolvedVersion in the cache, then a download.
+func (l *LibraryLoader) loadPreferredBackends(chain []LlamaGpuBackend, resolvedVersion string, reasons *[]string) bool {
+	var release *ReleaseInfo
+	for _, backend := range chain {
+		if backend == LLAMA_GPU_BACKEND_CPU || backend == bundledBackend(runtime.GOOS) {
+			if l.loadBundled(resolvedVersion, reasons) {
+				return true
+			}
+		}
 
+		pattern, err := l.downloader.GetAssetPatternForBackend(runtime.GOOS, runtime.GOARCH, backend)
+		if err != nil {
+			*reasons = append(*reasons, fmt.Sprintf("%s: %v", backend, err))
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			*reasons = append(*reasons, fmt.Sprintf("%s: invalid pattern: %v", backend, err))
+			continue
+		}
+
+		if entries, err := os.ReadDir(l.downloader.cacheDir); err == nil {
+			for _, e := range entries {
+				name := e.Name()
+				if !e.IsDir() || !strings.HasPrefix(name, "llama-"+resolvedVersion+"-") || !re.MatchString(name+".zip") {
+					continue
+				}
+				candDir := filepath.Join(l.downloader.cacheDir, name)
+				if libPath, err := l.downloader.FindLibraryPathForPlatform(candDir, runtime.GOOS); err == nil {
+					info, errs := l.LoadLibraryWithDependencies(libPath)
+					*reasons = append(*reasons, errs...)
+					if info.Success && l.ApplyLibraryLoad(info, candDir) == nil {
+						return true
+					}
+				}
+			}
+		}
+
+		if release == nil {
+			if release, err = l.getReleaseForVersion(resolvedVersion); err != nil {
+				*reasons = append(*reasons, fmt.Sprintf("release fetch failed: %v", err))
+				return false
+			}
+		}
+		if l.loadReleaseAsset(release, pattern, reasons) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadReleaseAsset loads the release asset matching pattern, downloading
+// and extracting it into the cache unless it already is.
+func (l *LibraryLoader) loadReleaseAsset(release *ReleaseInfo, pattern string, reasons *[]string) bool {
 	assetName, downloadURL, err := l.downloader.FindAssetByPattern(release, pattern)
 	if err != nil {
-		reasons = append(reasons, fmt.Sprintf("no matching asset: %v", err))
-		return fmt.Errorf("failed to resolve llama.cpp libraries: %s", strings.Join(reasons, "; "))
+		*reasons = append(*reasons, fmt.Sprintf("no matching asset: %v", err))
+		return false
 	}
 
 	// If already extracted in cache (by exact asset name), use it
 	extractedDir := filepath.Join(l.downloader.cacheDir, strings.TrimSuffix(assetName, ".zip"))
 	if libPath, err := l.downloader.FindLibraryPathForPlatform(extractedDir, runtime.GOOS); err == nil {
 		info, errs := l.LoadLibraryWithDependencies(libPath)
-		reasons = append(reasons, errs...)
+		*reasons = append(*reasons, errs...)
 		if info.Success {
 			if err := l.ApplyLibraryLoad(info, extractedDir); err == nil {
-				return nil
+				return true
 			}
 		}
 	}
 
-	// Download and extract
-	extractedDir, err = l.downloader.DownloadAndExtract(downloadURL, assetName)
+	// Download, verify and extract
+	expected, err := l.downloader.trustedChecksum(release, assetName)
 	if err != nil {
-		reasons = append(reasons, fmt.Sprintf("download failed: %v", err))
-		return fmt.Errorf("failed to resolve llama.cpp libraries: %s", strings.Join(reasons, "; "))
+		*reasons = append(*reasons, fmt.Sprintf("checksum unavailable: %v", err))
+		return false
+	}
+	extractedDir, _, err = l.downloader.DownloadAndExtractWithChecksum(downloadURL, assetName, expected)
+	if err != nil {
+		*reasons = append(*reasons, fmt.Sprintf("download failed: %v", err))
+		return false
 	}
 
 	libPath, err := l.downloader.FindLibraryPathForPlatform(extractedDir, runtime.GOOS)
 	if err != nil {
-		reasons = append(reasons, fmt.Sprintf("post-extract lib not found: %v", err))
-		return fmt.Errorf("failed to resolve llama.cpp libraries: %s", strings.Join(reasons, "; "))
+		*reasons = append(*reasons, fmt.Sprintf("post-extract lib not found: %v", err))
+		return false
 	}
 
 	info, errs := l.LoadLibraryWithDependencies(libPath)
-	reasons = append(reasons, errs...)
+	*reasons = append(*reasons, errs...)
 	if !info.Success {
-		return fmt.Errorf("failed to resolve llama.cpp libraries: %s", strings.Join(reasons, "; "))
+		return false
 	}
 
 	if err := l.ApplyLibraryLoad(info, extractedDir); err != nil {
-		return fmt.Errorf("failed to apply library load: %w", err)
+		*reasons = append(*reasons, fmt.Sprintf("failed to apply library load: %v", err))
+		return false
 	}
-
-	return nil
+	return true
 }
 
 func (l *LibraryLoader) getReleaseForVersion(version string) (*ReleaseInfo, error) {
@@ -215,6 +342,7 @@ func (l *LibraryLoader) getReleaseForVersion(version string) (*ReleaseInfo, erro
 }
 
 // UnloadLibrary unloads the library and cleans up resources
+// It returns ErrBusy while native calls are in flight.
 func (l *LibraryLoader) UnloadLibrary() error {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
@@ -222,6 +350,18 @@ func (l *LibraryLoader) UnloadLibrary() error {
 	if !l.loaded {
 		return nil
 	}
+	if !fnTableMu.TryLock() {
+		return ErrBusy
+	}
+	defer fnTableMu.Unlock()
+
+	l.unloadLocked()
+	return nil
+}
+
+// unloadLocked releases the loaded library. Callers must hold l.mutex and
+// fnTableMu for writing.
+func (l *LibraryLoader) unloadLocked() {
 
 	// Close library handle
 	if l.handle != 0 {
@@ -240,10 +380,16 @@ func (l *LibraryLoader) UnloadLibrary() error {
 
 	l.handle = 0
 	l.loaded = false
+	l.version = ""
 	l.llamaLibPath = ""
 	l.tempDir = ""
 
-	return nil
+	if l == globalLoader {
+		libMutex.Lock()
+		loaderLibPath = ""
+		loaderLibVersion = ""
+		libMutex.Unlock()
+	}
 }
 
 // getLibraryName returns the platform-specific library name
@@ -262,14 +408,33 @@ func (l *LibraryLoader) getLibraryName() (string, error) {
 	}
 }
 
-// extractEmbeddedLibraries extracts embedded libraries to a temporary directory
-// This method is provided for compatibility with tests, but this implementation
-// doesn't use embedded libraries - it downloads them instead
+// extractEmbeddedLibraries extracts the embedded libraries for the running
+// platform to a temporary directory, removed when the library is unloaded,
+// and returns the path of the main library.
 func (l *LibraryLoader) extractEmbeddedLibraries() (string, error) {
-	// Since this implementation uses downloaded libraries instead of embedded ones,
-	// we simulate the behavior expected by tests by creating a temporary directory
-	// and returning an error indicating no embedded libraries are available
-	return "", fmt.Errorf("no embedded libraries found - this implementation uses downloaded libraries")
+	if !hasEmbeddedLibraryForPlatform(runtime.GOOS, runtime.GOARCH) {
+		return "", fmt.Errorf("no embedded libraries for %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	libName, err := l.getLibraryName()
+	if err != nil {
+		return "", err
+	}
+
+	tempDir, err := os.MkdirTemp("", "gollama-embedded-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	if err := extractEmbeddedLibrariesTo(tempDir, runtime.GOOS, runtime.GOARCH); err != nil {
+		_ = os.RemoveAll(tempDir)
+		return "", err
+	}
+	libPath := filepath.Join(tempDir, libName)
+	if _, err := os.Stat(libPath); err != nil {
+		_ = os.RemoveAll(tempDir)
+		return "", fmt.Errorf("embedded libraries do not include %s: %w", libName, err)
+	}
+	l.tempDir = tempDir
+	return libPath, nil
 }
 
 // GetHandle returns the library handle
@@ -291,6 +456,19 @@ func (l *LibraryLoader) loadSharedLibrary(path string) (uintptr, error) {
 	return loadLibraryPlatform(path)
 }
 
+// ggmlSiblingLibs lists, without extension and in dependency order, the
+// ggml libraries that newer llama.cpp builds ship next to libllama. CPU
+// variants (libggml-cpu-haswell, ...) and GPU backends built as plugins are
+// left to ggml_backend_load_all, which picks the ones the machine supports.
+var ggmlSiblingLibs = []string{
+	"libggml-base",  // Base library - must be loaded first
+	"libggml-cpu",   // CPU implementation
+	"libggml-blas",  // BLAS implementation
+	"libggml-metal", // Metal implementation (macOS)
+	"libggml-rpc",   // RPC implementation
+	"libggml",       // Main GGML library
+}
+
 // preloadDependentLibraries preloads all dependent libraries from the same directory
 // on Unix-like systems to ensure correct library versions are used
 func (l *LibraryLoader) preloadDependentLibraries(mainLibPath string) error {
@@ -302,23 +480,14 @@ func (l *LibraryLoader) preloadDependentLibraries(mainLibPath string) error {
 	// Get the directory containing the main library
 	libDir := filepath.Dir(mainLibPath)
 
-	// Define the order of libraries to preload (based on dependency chain)
-	// These must be loaded in the correct order to satisfy dependencies
-	dependentLibs := []string{
-		"libggml-base.dylib",  // Base library - must be loaded first
-		"libggml-cpu.dylib",   // CPU implementation
-		"libggml-blas.dylib",  // BLAS implementation
-		"libggml-metal.dylib", // Metal implementation (macOS)
-		"libggml-rpc.dylib",   // RPC implementation
-		"libggml.dylib",       // Main GGML library
-		"libmtmd.dylib",       // MTMD library
-	}
-
-	// On Linux, use .so extension
+	// Libraries to preload, in dependency order
+	ext := ".dylib"
 	if runtime.GOOS == "linux" {
-		for i, lib := range dependentLibs {
-			dependentLibs[i] = strings.Replace(lib, ".dylib", ".so", 1)
-		}
+		ext = ".so"
+	}
+	var dependentLibs []string
+	for _, lib := range append(ggmlSiblingLibs, "libmtmd") {
+		dependentLibs = append(dependentLibs, lib+ext)
 	}
 
 	// Preload each dependent library
@@ -395,6 +564,7 @@ func RegisterFunction(fptr interface{}, name string) error {
 
 // Cleanup function to be called when the program exits
 func Cleanup() {
+	DisableCrashDumps()
 	_ = globalLoader.UnloadLibrary() // Ignore error during cleanup
 	_ = unloadLibrary()              // Also unload the gollama.go global state
 }
@@ -361,4 +361,38 @@ func (s *LoaderSuite) TestGlobalLoader() {
 	assert.False(s.T(), loaded, "Expected global library to not be loaded initially")
 }
 
+func (s *LoaderSuite) TestUnloadReturnsBusyDuringNativeCall() {
+	loader := &LibraryLoader{loaded: true, version: "b1"}
+
+	fnTableMu.RLock()
+	err := loader.UnloadLibrary()
+	fnTableMu.RUnlock()
+	s.Require().ErrorIs(err, ErrBusy)
+	s.True(loader.loaded)
+
+	s.Require().NoError(loader.UnloadLibrary())
+	s.False(loader.loaded)
+}
+
+func (s *LoaderSuite) TestVersionSwitchReturnsBusyDuringNativeCall() {
+	loader := &LibraryLoader{loaded: true, version: "b1", llamaLibPath: "/old/libllama.so"}
+
+	fnTableMu.RLock()
+	err := loader.LoadLibraryWithVersion("b2")
+	fnTableMu.RUnlock()
+	s.Require().ErrorIs(err, ErrBusy)
+	s.Equal("b1", loader.version)
+	s.Equal("/old/libllama.so", loader.llamaLibPath)
+}
+
+func (s *LoaderSuite) TestSameVersionIsNoop() {
+	loader := &LibraryLoader{loaded: true, version: LlamaCppBuild}
+
+	// Neither call needs the function table lock
+	fnTableMu.RLock()
+	defer fnTableMu.RUnlock()
+	s.NoError(loader.LoadLibraryWithVersion(LlamaCppBuild))
+	s.NoError(loader.LoadLibrary())
+}
+
 func TestLoaderSuite(t *testing.T) { suite.Run(t, new(LoaderSuite)) }
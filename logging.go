@@ -0,0 +1,227 @@
+package gollama
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/ebitengine/purego"
+)
+
+// LogLevel mirrors ggml_log_level, the severity passed to llama.cpp log callbacks.
+type LogLevel int32
+
+const (
+	GGML_LOG_LEVEL_NONE  LogLevel = 0
+	GGML_LOG_LEVEL_DEBUG LogLevel = 1
+	GGML_LOG_LEVEL_INFO  LogLevel = 2
+	GGML_LOG_LEVEL_WARN  LogLevel = 3
+	GGML_LOG_LEVEL_ERROR LogLevel = 4
+	GGML_LOG_LEVEL_CONT  LogLevel = 5 // continue previous log
+)
+
+// String returns the level name.
+func (l LogLevel) String() string {
+	switch l {
+	case GGML_LOG_LEVEL_NONE:
+		return "NONE"
+	case GGML_LOG_LEVEL_DEBUG:
+		return "DEBUG"
+	case GGML_LOG_LEVEL_INFO:
+		return "INFO"
+	case GGML_LOG_LEVEL_WARN:
+		return "WARN"
+	case GGML_LOG_LEVEL_ERROR:
+		return "ERROR"
+	case GGML_LOG_LEVEL_CONT:
+		return "CONT"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// SlogLevel maps l to the matching log/slog level.
+func (l LogLevel) SlogLevel() slog.Level {
+	switch l {
+	case GGML_LOG_LEVEL_DEBUG:
+		return slog.LevelDebug
+	case GGML_LOG_LEVEL_WARN:
+		return slog.LevelWarn
+	case GGML_LOG_LEVEL_ERROR:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// logBridge holds the Go side of the native log callback. A single purego
+// callback is created for the lifetime of the process (purego callbacks
+// cannot be freed) and dispatches to the current Go handler.
+var logBridge struct {
+	mu       sync.Mutex
+	handler  func(level LogLevel, msg string)
+	set      bool    // SetLogCallback has been called
+	callback uintptr // native trampoline, created on first install
+	level    LogLevel
+	pending  strings.Builder
+}
+
+// SetLogCallback routes llama.cpp and ggml log output to fn instead of
+// stderr. Messages are delivered one line at a time, without the trailing
+// newline; continuation fragments are merged into the line they belong to.
+// Passing nil restores the default stderr logging.
+//
+// The callback is installed as soon as the library is loaded and re-installed
+// if it is reloaded. fn may be called from native threads and must be safe
+// for concurrent use.
+func SetLogCallback(fn func(level LogLevel, msg string)) {
+	logBridge.mu.Lock()
+	logBridge.handler = fn
+	logBridge.set = true
+	logBridge.pending.Reset()
+	logBridge.mu.Unlock()
+
+	libMutex.RLock()
+	loaded := isLoaded
+	libMutex.RUnlock()
+	if loaded {
+		installLogCallback()
+	}
+}
+
+// SlogBridgeOptions configures the log/slog bridge returned by SlogBridge.
+type SlogBridgeOptions struct {
+	// Logger receives the messages; slog.Default() when nil.
+	Logger *slog.Logger
+	// Level is the minimum level forwarded (default GGML_LOG_LEVEL_INFO).
+	Level LogLevel
+	// Modules overrides Level per module. The module is the prefix before the
+	// first ':' of a message, e.g. "llama_model_loader" or "ggml_metal_init".
+	Modules map[string]LogLevel
+}
+
+// SlogBridge returns a log callback for SetLogCallback that forwards
+// llama.cpp messages to log/slog, mapping levels and attaching the
+// originating module as a "module" attribute.
+//
+// Example usage:
+//
+//	gollama.SetLogCallback(gollama.SlogBridge(gollama.SlogBridgeOptions{
+//		Level:   gollama.GGML_LOG_LEVEL_WARN,
+//		Modules: map[string]gollama.LogLevel{"llama_model_loader": gollama.GGML_LOG_LEVEL_ERROR},
+//	}))
+func SlogBridge(opts SlogBridgeOptions) func(level LogLevel, msg string) {
+	minLevel := opts.Level
+	if minLevel == GGML_LOG_LEVEL_NONE {
+		minLevel = GGML_LOG_LEVEL_INFO
+	}
+	modules := make(map[string]LogLevel, len(opts.Modules))
+	for k, v := range opts.Modules {
+		modules[k] = v
+	}
+
+	return func(level LogLevel, msg string) {
+		module, text := splitLogModule(msg)
+		threshold := minLevel
+		if l, ok := modules[module]; ok {
+			threshold = l
+		}
+		if level < threshold {
+			return
+		}
+
+		logger := opts.Logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		if module != "" {
+			logger.Log(context.Background(), level.SlogLevel(), text, "module", module)
+		} else {
+			logger.Log(context.Background(), level.SlogLevel(), text)
+		}
+	}
+}
+
+// splitLogModule splits "module: message" into its parts. Messages without a
+// module prefix are returned unchanged with an empty module.
+func splitLogModule(msg string) (string, string) {
+	module, text, ok := strings.Cut(msg, ": ")
+	if !ok || module == "" || strings.ContainsAny(module, " \t") {
+		return "", msg
+	}
+	return module, strings.TrimSpace(text)
+}
+
+// installLogCallback points llama_log_set at the Go bridge, or back at the
+// default logger when no handler is set.
+func installLogCallback() {
+	if llamaLogSet == nil {
+		return
+	}
+
+	logBridge.mu.Lock()
+	if !logBridge.set {
+		logBridge.mu.Unlock()
+		return
+	}
+	if logBridge.handler == nil {
+		logBridge.mu.Unlock()
+		llamaLogSet(0, 0)
+		return
+	}
+	if logBridge.callback == 0 {
+		logBridge.callback = purego.NewCallback(nativeLogCallback)
+	}
+	cb := logBridge.callback
+	logBridge.mu.Unlock()
+
+	llamaLogSet(cb, 0)
+}
+
+// nativeLogCallback is invoked by ggml_log_callback.
+func nativeLogCallback(level int32, text *byte, _ uintptr) {
+	dispatchLog(LogLevel(level), bytePointerToString(text))
+}
+
+// dispatchLog assembles complete lines and hands them to the handler.
+func dispatchLog(level LogLevel, text string) {
+	type logLine struct {
+		level LogLevel
+		text  string
+	}
+
+	logBridge.mu.Lock()
+	handler := logBridge.handler
+	if handler == nil {
+		logBridge.mu.Unlock()
+		return
+	}
+	var out []logLine
+	if level != GGML_LOG_LEVEL_CONT {
+		// A new message flushes any unterminated fragment first
+		if logBridge.pending.Len() > 0 {
+			out = append(out, logLine{logBridge.level, logBridge.pending.String()})
+			logBridge.pending.Reset()
+		}
+		logBridge.level = level
+	}
+	logBridge.pending.WriteString(text)
+	if buffered := logBridge.pending.String(); strings.Contains(buffered, "\n") {
+		cut := strings.LastIndexByte(buffered, '\n')
+		for _, line := range strings.Split(buffered[:cut], "\n") {
+			out = append(out, logLine{logBridge.level, line})
+		}
+		logBridge.pending.Reset()
+		logBridge.pending.WriteString(buffered[cut+1:])
+	}
+	logBridge.mu.Unlock()
+
+	for _, l := range out {
+		line := strings.TrimRight(l.text, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		handler(l.level, line)
+	}
+}
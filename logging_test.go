@@ -0,0 +1,96 @@
+package gollama
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LoggingSuite struct{ BaseSuite }
+
+type capturedLog struct {
+	level LogLevel
+	msg   string
+}
+
+func (s *LoggingSuite) capture() (*[]capturedLog, *sync.Mutex) {
+	var mu sync.Mutex
+	logs := &[]capturedLog{}
+	SetLogCallback(func(level LogLevel, msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		*logs = append(*logs, capturedLog{level, msg})
+	})
+	s.T().Cleanup(func() { SetLogCallback(nil) })
+	return logs, &mu
+}
+
+func (s *LoggingSuite) TestDispatchAssemblesLines() {
+	logs, _ := s.capture()
+
+	dispatchLog(GGML_LOG_LEVEL_INFO, "llama_model_loader: loaded meta data\n")
+	dispatchLog(GGML_LOG_LEVEL_INFO, "load_tensors: loading")
+	dispatchLog(GGML_LOG_LEVEL_CONT, ".")
+	dispatchLog(GGML_LOG_LEVEL_CONT, ".\n")
+	dispatchLog(GGML_LOG_LEVEL_WARN, "partial")
+	dispatchLog(GGML_LOG_LEVEL_ERROR, "two\nlines\n")
+
+	s.Equal([]capturedLog{
+		{GGML_LOG_LEVEL_INFO, "llama_model_loader: loaded meta data"},
+		{GGML_LOG_LEVEL_INFO, "load_tensors: loading.."},
+		{GGML_LOG_LEVEL_WARN, "partial"},
+		{GGML_LOG_LEVEL_ERROR, "two"},
+		{GGML_LOG_LEVEL_ERROR, "lines"},
+	}, *logs)
+}
+
+func (s *LoggingSuite) TestSlogBridgeLevelsAndModules() {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	bridge := SlogBridge(SlogBridgeOptions{
+		Logger:  logger,
+		Level:   GGML_LOG_LEVEL_INFO,
+		Modules: map[string]LogLevel{"llama_model_loader": GGML_LOG_LEVEL_ERROR, "ggml_metal_init": GGML_LOG_LEVEL_DEBUG},
+	})
+
+	bridge(GGML_LOG_LEVEL_DEBUG, "llama_context: dropped by default level")
+	bridge(GGML_LOG_LEVEL_INFO, "llama_model_loader: dropped by module level")
+	bridge(GGML_LOG_LEVEL_DEBUG, "ggml_metal_init: kept by module level")
+	bridge(GGML_LOG_LEVEL_WARN, "llama_context: n_ctx_per_seq < n_ctx_train")
+	bridge(GGML_LOG_LEVEL_INFO, "no module prefix here")
+
+	out := buf.String()
+	s.NotContains(out, "dropped")
+	s.Contains(out, `level=DEBUG msg="kept by module level" module=ggml_metal_init`)
+	s.Contains(out, `level=WARN msg="n_ctx_per_seq < n_ctx_train" module=llama_context`)
+	s.Contains(out, `level=INFO msg="no module prefix here"`)
+	s.Equal(3, strings.Count(out, "\n"))
+}
+
+func (s *LoggingSuite) TestConfigLogLevel() {
+	s.Equal(GGML_LOG_LEVEL_DEBUG, configLogLevel(0))
+	s.Equal(GGML_LOG_LEVEL_INFO, configLogLevel(1))
+	s.Equal(GGML_LOG_LEVEL_WARN, configLogLevel(2))
+	s.Equal(GGML_LOG_LEVEL_ERROR, configLogLevel(3))
+	s.Equal(GGML_LOG_LEVEL_ERROR, configLogLevel(10))
+}
+
+func (s *LoggingSuite) TestNativeMessagesReachCallback() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	logs, mu := s.capture()
+
+	_, err := Model_load_from_file("/nonexistent/model.gguf", Model_default_params())
+	s.Require().Error(err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	s.NotEmpty(*logs, "llama.cpp should report the failed load through the callback")
+}
+
+func TestLoggingSuite(t *testing.T) { suite.Run(t, new(LoggingSuite)) }
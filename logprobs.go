@@ -0,0 +1,116 @@
+package gollama
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+)
+
+// TokenLogprob is a token with its log probability.
+type TokenLogprob struct {
+	Token   LlamaToken `json:"token"`
+	Piece   string     `json:"piece"`
+	Logprob float32    `json:"logprob"`
+}
+
+// TokenLogprobs is the log probability of a sampled token together with
+// the most likely alternatives at its position, like OpenAI's logprobs.
+type TokenLogprobs struct {
+	TokenLogprob
+	// TopLogprobs holds the most likely tokens, most likely first. The
+	// sampled token is included if it is among them.
+	TopLogprobs []TokenLogprob `json:"top_logprobs,omitempty"`
+}
+
+// Logprobs returns the log probability of token, and of the topK most
+// likely tokens, at the i-th output of the last decode (negative values
+// count from the end). Call it after sampling and before the next decode.
+//
+// Probabilities are the softmax of the raw logits over the whole
+// vocabulary, before any sampler (temperature, top-k, ...) is applied.
+//
+// Example usage:
+//
+//	token := gollama.Sampler_sample(sampler, ctx.Handle(), -1)
+//	lp, err := ctx.Logprobs(-1, token, 5)
+func (c *Context) Logprobs(i int32, token LlamaToken, topK int) (TokenLogprobs, error) {
+	logits := c.Logits(i)
+	if len(logits) == 0 {
+		return TokenLogprobs{}, fmt.Errorf("%w: no logits for output %d", ErrInvalidParameter, i)
+	}
+	if token < 0 || int(token) >= len(logits) {
+		return TokenLogprobs{}, fmt.Errorf("%w: %d", ErrTokenOutOfRange, token)
+	}
+
+	lse := logSumExp(logits)
+	model := c.model.Handle()
+	res := TokenLogprobs{TokenLogprob: TokenLogprob{
+		Token:   token,
+		Piece:   Token_to_piece(model, token, false),
+		Logprob: logits[token] - lse,
+	}}
+	for _, t := range topLogits(logits, topK) {
+		res.TopLogprobs = append(res.TopLogprobs, TokenLogprob{
+			Token:   t,
+			Piece:   Token_to_piece(model, t, false),
+			Logprob: logits[t] - lse,
+		})
+	}
+	return res, nil
+}
+
+// logSumExp returns log(sum(exp(logits))), computed stably.
+func logSumExp(logits []float32) float32 {
+	maxLogit := float32(math.Inf(-1))
+	for _, l := range logits {
+		maxLogit = max(maxLogit, l)
+	}
+	if math.IsInf(float64(maxLogit), -1) {
+		return maxLogit
+	}
+	var sum float64
+	for _, l := range logits {
+		sum += math.Exp(float64(l - maxLogit))
+	}
+	return maxLogit + float32(math.Log(sum))
+}
+
+// topLogits returns the k tokens with the largest logits, largest first,
+// without sorting the whole vocabulary.
+func topLogits(logits []float32, k int) []LlamaToken {
+	k = min(k, len(logits))
+	if k <= 0 {
+		return nil
+	}
+	h := &logitHeap{logits: logits}
+	for i := range logits {
+		t := LlamaToken(i)
+		if h.Len() < k {
+			heap.Push(h, t)
+		} else if logits[i] > logits[h.tokens[0]] {
+			h.tokens[0] = t
+			heap.Fix(h, 0)
+		}
+	}
+	out := make([]LlamaToken, h.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(h).(LlamaToken)
+	}
+	return out
+}
+
+// logitHeap is a min-heap of tokens ordered by logit.
+type logitHeap struct {
+	logits []float32
+	tokens []LlamaToken
+}
+
+func (h *logitHeap) Len() int           { return len(h.tokens) }
+func (h *logitHeap) Less(i, j int) bool { return h.logits[h.tokens[i]] < h.logits[h.tokens[j]] }
+func (h *logitHeap) Swap(i, j int)      { h.tokens[i], h.tokens[j] = h.tokens[j], h.tokens[i] }
+func (h *logitHeap) Push(x any)         { h.tokens = append(h.tokens, x.(LlamaToken)) }
+func (h *logitHeap) Pop() any {
+	t := h.tokens[len(h.tokens)-1]
+	h.tokens = h.tokens[:len(h.tokens)-1]
+	return t
+}
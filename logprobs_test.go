@@ -0,0 +1,33 @@
+package gollama
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LogprobsSuite struct{ BaseSuite }
+
+func (s *LogprobsSuite) TestLogSumExp() {
+	s.InDelta(math.Log(4), float64(logSumExp([]float32{0, 0, 0, 0})), 1e-6)
+	// Large logits must not overflow
+	s.InDelta(1000+math.Log(2), float64(logSumExp([]float32{1000, 1000})), 1e-3)
+	s.True(math.IsInf(float64(logSumExp(nil)), -1))
+}
+
+func (s *LogprobsSuite) TestTopLogits() {
+	logits := []float32{0.5, 3, -1, 2, 3.5, 0}
+	s.Equal([]LlamaToken{4, 1, 3}, topLogits(logits, 3))
+	s.Equal([]LlamaToken{4, 1, 3, 0, 5, 2}, topLogits(logits, 10))
+	s.Nil(topLogits(logits, 0))
+}
+
+func (s *LogprobsSuite) TestRequiresLogits() {
+	_, err := (&Context{}).Logprobs(-1, 0, 5)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func TestLogprobsSuite(t *testing.T) {
+	suite.Run(t, new(LogprobsSuite))
+}
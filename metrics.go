@@ -0,0 +1,281 @@
+package gollama
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Metrics collection is off by default so the hot paths only pay for an
+// atomic load. Counters are process-wide and monotonic; they are not reset
+// when the library is unloaded.
+var metrics struct {
+	enabled atomic.Bool
+
+	tokensDecoded atomic.Uint64
+	tokensEncoded atomic.Uint64
+	batches       atomic.Uint64
+	decodeErrors  atomic.Uint64
+	samplerCalls  atomic.Uint64
+	contextShifts atomic.Uint64
+	cacheHits     atomic.Uint64
+	downloads     atomic.Uint64
+
+	generations      atomic.Uint64
+	generatedTokens  atomic.Uint64
+	generationMicros atomic.Uint64
+	firstTokenMicros atomic.Uint64
+
+	// kvCells and kvUsed are gauges summed over the open contexts
+	kvCells atomic.Int64
+	kvUsed  atomic.Int64
+
+	expvarOnce sync.Once
+}
+
+// MetricsSnapshot is a point-in-time copy of the collected metrics.
+type MetricsSnapshot struct {
+	// TokensDecoded is the number of tokens submitted to llama_decode.
+	TokensDecoded uint64 `json:"tokens_decoded"`
+	// TokensEncoded is the number of tokens submitted to llama_encode.
+	TokensEncoded uint64 `json:"tokens_encoded"`
+	// Batches is the number of decode and encode calls.
+	Batches uint64 `json:"batches"`
+	// DecodeErrors is the number of decode and encode calls that failed.
+	DecodeErrors uint64 `json:"decode_errors"`
+	// SamplerCalls is the number of Sampler_sample invocations.
+	SamplerCalls uint64 `json:"sampler_calls"`
+	// ContextShifts is the number of context shifts done by Context.Shift.
+	ContextShifts uint64 `json:"context_shifts"`
+	// LibraryCacheHits counts library downloads served from the cache.
+	LibraryCacheHits uint64 `json:"library_cache_hits"`
+	// LibraryDownloads counts library archives fetched from the network.
+	LibraryDownloads uint64 `json:"library_downloads"`
+	// Generations is the number of Context.Generate calls.
+	Generations uint64 `json:"generations"`
+	// GeneratedTokens is the number of tokens they generated.
+	GeneratedTokens uint64 `json:"generated_tokens"`
+	// GenerationSeconds is the time they spent generating, prompt
+	// processing excluded.
+	GenerationSeconds float64 `json:"generation_seconds"`
+	// TimeToFirstTokenSeconds sums their time to first token.
+	TimeToFirstTokenSeconds float64 `json:"time_to_first_token_seconds"`
+	// KVCacheCells is the memory capacity of the open contexts, in tokens,
+	// and KVCacheUsedCells the part of it in use after their last decode
+	// (see Context.KVStats).
+	KVCacheCells     int64 `json:"kv_cache_cells"`
+	KVCacheUsedCells int64 `json:"kv_cache_used_cells"`
+	// Devices reports memory of the ggml backend devices. It is only
+	// populated when the library is already loaded.
+	Devices []DeviceMemory `json:"devices,omitempty"`
+}
+
+// DeviceMemory is the memory reported by a ggml backend device.
+type DeviceMemory struct {
+	Name  string `json:"name"`
+	Free  uint64 `json:"free"`
+	Total uint64 `json:"total"`
+	// Type is the device type, e.g. "GPU", and DeviceID its PCI bus id when
+	// the backend reports one
+	Type     string `json:"type,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+}
+
+// EnableMetrics turns metrics collection on or off. Counters keep their
+// values while collection is disabled.
+func EnableMetrics(enabled bool) {
+	metrics.enabled.Store(enabled)
+}
+
+// MetricsEnabled reports whether metrics are being collected.
+func MetricsEnabled() bool {
+	return metrics.enabled.Load()
+}
+
+// countMetric adds n to counter when metrics are enabled.
+func countMetric(counter *atomic.Uint64, n uint64) {
+	if metrics.enabled.Load() {
+		counter.Add(n)
+	}
+}
+
+// countBatch records a decode or encode call of nTokens tokens.
+func countBatch(tokens *atomic.Uint64, nTokens int32, err error) {
+	if !metrics.enabled.Load() {
+		return
+	}
+	metrics.batches.Add(1)
+	if nTokens > 0 {
+		tokens.Add(uint64(nTokens))
+	}
+	if err != nil {
+		metrics.decodeErrors.Add(1)
+	}
+}
+
+// countGeneration records the timings of a generation.
+func countGeneration(t Timings) {
+	if !metrics.enabled.Load() {
+		return
+	}
+	metrics.generations.Add(1)
+	metrics.generatedTokens.Add(uint64(t.GeneratedTokens))
+	metrics.generationMicros.Add(uint64(t.GenerationMs * 1000))
+	metrics.firstTokenMicros.Add(uint64(t.TimeToFirstTokenMs * 1000))
+}
+
+// kvGauge is the share of one context in the KV cache gauges.
+type kvGauge struct {
+	cells, used atomic.Int64
+}
+
+// set replaces the share of the context; set(0, 0) withdraws it.
+func (g *kvGauge) set(cells, used int) {
+	metrics.kvCells.Add(int64(cells) - g.cells.Swap(int64(cells)))
+	metrics.kvUsed.Add(int64(used) - g.used.Swap(int64(used)))
+}
+
+// Metrics returns the current metrics. Device memory is queried live and
+// never triggers loading the library.
+func Metrics() MetricsSnapshot {
+	snap := MetricsSnapshot{
+		TokensDecoded:    metrics.tokensDecoded.Load(),
+		TokensEncoded:    metrics.tokensEncoded.Load(),
+		Batches:          metrics.batches.Load(),
+		DecodeErrors:     metrics.decodeErrors.Load(),
+		SamplerCalls:     metrics.samplerCalls.Load(),
+		ContextShifts:    metrics.contextShifts.Load(),
+		LibraryCacheHits: metrics.cacheHits.Load(),
+		LibraryDownloads: metrics.downloads.Load(),
+		Generations:      metrics.generations.Load(),
+		GeneratedTokens:  metrics.generatedTokens.Load(),
+
+		GenerationSeconds:       float64(metrics.generationMicros.Load()) / 1e6,
+		TimeToFirstTokenSeconds: float64(metrics.firstTokenMicros.Load()) / 1e6,
+		KVCacheCells:            metrics.kvCells.Load(),
+		KVCacheUsedCells:        metrics.kvUsed.Load(),
+	}
+
+	libMutex.RLock()
+	loaded := isLoaded
+	libMutex.RUnlock()
+	if loaded {
+		snap.Devices = deviceMemory()
+	}
+	return snap
+}
+
+func deviceMemory() []DeviceMemory {
+	count, err := Ggml_backend_dev_count()
+	if err != nil {
+		return nil
+	}
+	var devices []DeviceMemory
+	for i := uint64(0); i < count; i++ {
+		dev, err := Ggml_backend_dev_get(i)
+		if err != nil || dev == 0 {
+			continue
+		}
+		if props, err := Ggml_backend_dev_props(dev); err == nil {
+			devices = append(devices, DeviceMemory{
+				Name:     props.Name,
+				Free:     props.MemoryFree,
+				Total:    props.MemoryTotal,
+				Type:     props.Type.String(),
+				DeviceID: props.DeviceID,
+			})
+			continue
+		}
+		name, _ := Ggml_backend_dev_name(dev)
+		free, total, err := Ggml_backend_dev_memory(dev)
+		if err != nil {
+			continue
+		}
+		devices = append(devices, DeviceMemory{Name: name, Free: free, Total: total})
+	}
+	return devices
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition
+// format.
+func (m MetricsSnapshot) WritePrometheus(w io.Writer) error {
+	var b strings.Builder
+	counter := func(name, help string, value uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	counter("gollama_tokens_decoded_total", "Tokens submitted to llama_decode.", m.TokensDecoded)
+	counter("gollama_tokens_encoded_total", "Tokens submitted to llama_encode.", m.TokensEncoded)
+	counter("gollama_batches_total", "Decode and encode calls.", m.Batches)
+	counter("gollama_decode_errors_total", "Decode and encode calls that failed.", m.DecodeErrors)
+	counter("gollama_sampler_calls_total", "Sampler_sample invocations.", m.SamplerCalls)
+	counter("gollama_context_shifts_total", "Context shifts that discarded old tokens.", m.ContextShifts)
+	counter("gollama_library_cache_hits_total", "Library downloads served from the cache.", m.LibraryCacheHits)
+	counter("gollama_library_downloads_total", "Library archives fetched from the network.", m.LibraryDownloads)
+	counter("gollama_generations_total", "Context.Generate calls.", m.Generations)
+	counter("gollama_generated_tokens_total", "Tokens generated by Context.Generate.", m.GeneratedTokens)
+	seconds := func(name, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %g\n", name, help, name, name, value)
+	}
+	seconds("gollama_generation_seconds_total", "Time spent generating tokens, prompt processing excluded.", m.GenerationSeconds)
+	seconds("gollama_time_to_first_token_seconds_total", "Sum of the time to first token of the generations.", m.TimeToFirstTokenSeconds)
+	gauge := func(name, help string, value int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+	}
+	gauge("gollama_kv_cache_cells", "Memory capacity of the open contexts, in tokens.", m.KVCacheCells)
+	gauge("gollama_kv_cache_used_cells", "Memory cells of the open contexts in use after their last decode.", m.KVCacheUsedCells)
+
+	if len(m.Devices) > 0 {
+		b.WriteString("# HELP gollama_device_memory_free_bytes Free memory reported by the ggml device.\n")
+		b.WriteString("# TYPE gollama_device_memory_free_bytes gauge\n")
+		for _, d := range m.Devices {
+			fmt.Fprintf(&b, "gollama_device_memory_free_bytes{device=\"%s\"} %d\n", promLabel(d.Name), d.Free)
+		}
+		b.WriteString("# HELP gollama_device_memory_total_bytes Total memory reported by the ggml device.\n")
+		b.WriteString("# TYPE gollama_device_memory_total_bytes gauge\n")
+		for _, d := range m.Devices {
+			fmt.Fprintf(&b, "gollama_device_memory_total_bytes{device=\"%s\"} %d\n", promLabel(d.Name), d.Total)
+		}
+		b.WriteString("# HELP gollama_device_info Type and id of the ggml device.\n")
+		b.WriteString("# TYPE gollama_device_info gauge\n")
+		for _, d := range m.Devices {
+			fmt.Fprintf(&b, "gollama_device_info{device=\"%s\",type=\"%s\",device_id=\"%s\"} 1\n", promLabel(d.Name), promLabel(d.Type), promLabel(d.DeviceID))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// promLabelEscaper escapes a label value as the exposition format requires:
+// only backslash, double quote and line feed, with UTF-8 kept as is.
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promLabel(v string) string {
+	return promLabelEscaper.Replace(v)
+}
+
+// MetricsHandler returns an http.Handler serving the metrics in the
+// Prometheus text format. It does not enable collection by itself.
+//
+// Example usage:
+//
+//	gollama.EnableMetrics(true)
+//	http.Handle("/metrics", gollama.MetricsHandler())
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = Metrics().WritePrometheus(w)
+	})
+}
+
+// PublishExpvar publishes the metrics under the "gollama" expvar name, so
+// they appear on /debug/vars. It is safe to call more than once.
+func PublishExpvar() {
+	metrics.expvarOnce.Do(func() {
+		expvar.Publish("gollama", expvar.Func(func() any { return Metrics() }))
+	})
+}
@@ -0,0 +1,92 @@
+package gollama
+
+import (
+	"bytes"
+	"errors"
+	"expvar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MetricsSuite struct{ BaseSuite }
+
+func (s *MetricsSuite) TearDownTest() {
+	EnableMetrics(false)
+	s.BaseSuite.TearDownTest()
+}
+
+func (s *MetricsSuite) TestDisabledByDefault() {
+	s.False(MetricsEnabled())
+	before := Metrics().SamplerCalls
+	countMetric(&metrics.samplerCalls, 1)
+	s.Equal(before, Metrics().SamplerCalls)
+}
+
+func (s *MetricsSuite) TestCountBatch() {
+	EnableMetrics(true)
+	before := Metrics()
+	countBatch(&metrics.tokensDecoded, 12, nil)
+	countBatch(&metrics.tokensEncoded, 3, errors.New("boom"))
+	after := Metrics()
+
+	s.Equal(before.TokensDecoded+12, after.TokensDecoded)
+	s.Equal(before.TokensEncoded+3, after.TokensEncoded)
+	s.Equal(before.Batches+2, after.Batches)
+	s.Equal(before.DecodeErrors+1, after.DecodeErrors)
+}
+
+func (s *MetricsSuite) TestCountGeneration() {
+	EnableMetrics(true)
+	before := Metrics()
+	countGeneration(Timings{GeneratedTokens: 4, GenerationMs: 500, TimeToFirstTokenMs: 250})
+	after := Metrics()
+
+	s.Equal(before.Generations+1, after.Generations)
+	s.Equal(before.GeneratedTokens+4, after.GeneratedTokens)
+	s.InDelta(before.GenerationSeconds+0.5, after.GenerationSeconds, 1e-9)
+	s.InDelta(before.TimeToFirstTokenSeconds+0.25, after.TimeToFirstTokenSeconds, 1e-9)
+}
+
+func (s *MetricsSuite) TestPrometheusFormat() {
+	snap := MetricsSnapshot{
+		TokensDecoded: 42,
+		Devices:       []DeviceMemory{{Name: "CPU", Free: 1024, Total: 2048, Type: "CPU"}},
+	}
+	var buf bytes.Buffer
+	s.Require().NoError(snap.WritePrometheus(&buf))
+	out := buf.String()
+	s.Contains(out, "# TYPE gollama_tokens_decoded_total counter\ngollama_tokens_decoded_total 42\n")
+	s.Contains(out, "# TYPE gollama_context_shifts_total counter\n")
+	s.Contains(out, "# TYPE gollama_generation_seconds_total counter\ngollama_generation_seconds_total 0\n")
+	s.Contains(out, "# TYPE gollama_kv_cache_used_cells gauge\ngollama_kv_cache_used_cells 0\n")
+	s.Contains(out, `gollama_device_memory_free_bytes{device="CPU"} 1024`)
+	s.Contains(out, `gollama_device_memory_total_bytes{device="CPU"} 2048`)
+	s.Contains(out, `gollama_device_info{device="CPU",type="CPU",device_id=""} 1`)
+}
+
+func (s *MetricsSuite) TestPrometheusLabelEscaping() {
+	snap := MetricsSnapshot{
+		Devices: []DeviceMemory{{Name: "Radeon™ \"Pro\"\nC:\\gpu", Type: "GPU\t1", Free: 1}},
+	}
+	var buf bytes.Buffer
+	s.Require().NoError(snap.WritePrometheus(&buf))
+	out := buf.String()
+	s.Contains(out, `gollama_device_memory_free_bytes{device="Radeon™ \"Pro\"\nC:\\gpu"} 1`)
+	s.Contains(out, "type=\"GPU\t1\"", "other characters are written as is")
+}
+
+func (s *MetricsSuite) TestHandlerAndExpvar() {
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	s.Equal(200, rec.Code)
+	s.Contains(rec.Header().Get("Content-Type"), "text/plain")
+	s.Contains(rec.Body.String(), "gollama_batches_total")
+
+	PublishExpvar()
+	PublishExpvar()
+	s.NotNil(expvar.Get("gollama"))
+}
+
+func TestMetricsSuite(t *testing.T) { suite.Run(t, new(MetricsSuite)) }
@@ -0,0 +1,219 @@
+package gollama
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Model wraps a loaded LlamaModel together with tokenizer properties that are
+// read once at load time. Hot paths (tokenization, end-of-generation checks,
+// chat formatting) use the cached values instead of calling into the library
+// again, and the properties stay readable even if the library is later
+// switched or a native call fails transiently.
+//
+// Example usage:
+//
+//	model, err := gollama.LoadModel("model.gguf", gollama.Model_default_params())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer model.Close()
+//
+//	tokens, err := model.Tokenize("Hello", model.AddBOS, false)
+type Model struct {
+	handle LlamaModel
+	vocab  LlamaVocab
+
+	// NVocab is the number of tokens in the vocabulary.
+	NVocab int32
+	// NEmbd is the embedding dimension of the model.
+	NEmbd int32
+	// NCtxTrain is the context length the model was trained with.
+	NCtxTrain int32
+	// NSwa is the sliding window attention window in tokens, or 0 when the
+	// model has no SWA layers (see SWACache).
+	NSwa int32
+	// NLayer, NHead and NHeadKv describe the shape of the transformer.
+	NLayer  int32
+	NHead   int32
+	NHeadKv int32
+
+	// Special token ids; LLAMA_TOKEN_NULL when the model does not define one.
+	BOS LlamaToken
+	EOS LlamaToken
+	EOT LlamaToken
+	SEP LlamaToken
+	NL  LlamaToken
+	PAD LlamaToken
+
+	// AddBOS and AddEOS report whether the tokenizer expects BOS/EOS to be added.
+	AddBOS bool
+	AddEOS bool
+
+	// ChatTemplate is the default chat template embedded in the model, if any.
+	ChatTemplate string
+
+	special []LlamaToken
+	eog     map[LlamaToken]struct{}
+
+	prefixOnce  sync.Once
+	prefixIndex *TokenPrefixIndex
+
+	mu sync.Mutex
+	// contexts holds the open contexts created from the model
+	contexts map[*Context]struct{}
+}
+
+// LoadModel loads a model from file and warms its tokenizer caches. For a
+// split model, pathModel may name any part; all parts are loaded.
+func LoadModel(pathModel string, params LlamaModelParams) (*Model, error) {
+	handle, err := Model_load_from_split_path(pathModel, params)
+	if err != nil {
+		return nil, err
+	}
+	m, err := NewModel(handle)
+	if err != nil {
+		Model_free(handle)
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewModel wraps an already loaded model handle and warms its tokenizer
+// caches. The returned Model takes ownership of the handle; call Free to
+// release it.
+func NewModel(handle LlamaModel) (*Model, error) {
+	if handle == 0 {
+		return nil, ErrModelNotLoaded
+	}
+
+	release, err := acquireNativeCall("llama_model_get_vocab")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	vocab := llamaModelGetVocab(handle)
+	if vocab == 0 {
+		return nil, fmt.Errorf("%w: failed to get vocabulary from model", ErrUnsupportedModelType)
+	}
+
+	m := &Model{
+		handle:    handle,
+		vocab:     vocab,
+		NVocab:    llamaVocabNTokens(vocab),
+		NEmbd:     llamaModelNEmbd(handle),
+		NCtxTrain: llamaModelNCtxTrain(handle),
+		BOS:       llamaVocabBos(vocab),
+		EOS:       llamaVocabEos(vocab),
+		EOT:       llamaVocabEot(vocab),
+		SEP:       llamaVocabSep(vocab),
+		NL:        llamaVocabNl(vocab),
+		PAD:       llamaVocabPad(vocab),
+		AddBOS:    llamaVocabGetAddBos(vocab),
+		AddEOS:    llamaVocabGetAddEos(vocab),
+		eog:       make(map[LlamaToken]struct{}),
+	}
+	if llamaModelNSwa != nil {
+		m.NSwa = llamaModelNSwa(handle)
+	}
+	if llamaModelNLayer != nil && llamaModelNHead != nil && llamaModelNHeadKv != nil {
+		m.NLayer = llamaModelNLayer(handle)
+		m.NHead = llamaModelNHead(handle)
+		m.NHeadKv = llamaModelNHeadKv(handle)
+	}
+	if tmpl := llamaModelChatTemplate(handle, nil); tmpl != nil {
+		m.ChatTemplate = bytePointerToString(tmpl)
+	}
+
+	for i := int32(0); i < m.NVocab; i++ {
+		token := LlamaToken(i)
+		if llamaVocabGetAttr(vocab, token)&(LLAMA_TOKEN_ATTR_CONTROL|LLAMA_TOKEN_ATTR_USER_DEF) != 0 {
+			m.special = append(m.special, token)
+		}
+		if llamaVocabIsEog(vocab, token) {
+			m.eog[token] = struct{}{}
+		}
+	}
+	return m, nil
+}
+
+// Handle returns the underlying model handle.
+func (m *Model) Handle() LlamaModel {
+	return m.handle
+}
+
+// Vocab returns the cached vocabulary handle.
+func (m *Model) Vocab() LlamaVocab {
+	return m.vocab
+}
+
+// SpecialTokens returns the control and user-defined tokens of the vocabulary.
+func (m *Model) SpecialTokens() []LlamaToken {
+	out := make([]LlamaToken, len(m.special))
+	copy(out, m.special)
+	return out
+}
+
+// IsEOG reports whether token ends generation (EOS, EOT and similar tokens).
+func (m *Model) IsEOG(token LlamaToken) bool {
+	_, ok := m.eog[token]
+	return ok
+}
+
+// Tokenize converts text to tokens using the cached vocabulary.
+func (m *Model) Tokenize(text string, addSpecial, parseSpecial bool) ([]LlamaToken, error) {
+	release, err := acquireNativeCall("llama_tokenize")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	m.mu.Lock()
+	vocab := m.vocab
+	m.mu.Unlock()
+	if vocab == 0 {
+		return nil, ErrModelNotLoaded
+	}
+	return tokenizeVocab(vocab, text, addSpecial, parseSpecial)
+}
+
+// Detokenize converts tokens back to text using the cached vocabulary (see
+// Detokenize).
+func (m *Model) Detokenize(tokens []LlamaToken, removeSpecial, unparseSpecial bool) (string, error) {
+	release, err := acquireNativeCall("llama_detokenize")
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	m.mu.Lock()
+	vocab := m.vocab
+	m.mu.Unlock()
+	if vocab == 0 {
+		return "", ErrModelNotLoaded
+	}
+	return detokenizeVocab(vocab, tokens, removeSpecial, unparseSpecial)
+}
+
+// Free releases the model, after the contexts created from it that are
+// still open. It is safe to call more than once.
+func (m *Model) Free() {
+	m.mu.Lock()
+	contexts := make([]*Context, 0, len(m.contexts))
+	for c := range m.contexts {
+		contexts = append(contexts, c)
+	}
+	m.mu.Unlock()
+	for _, c := range contexts {
+		c.Free()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.handle != 0 {
+		Model_free(m.handle)
+		m.handle = 0
+		m.vocab = 0
+	}
+}
@@ -0,0 +1,108 @@
+package gollama
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedArchitecture is returned before loading a model whose
+// architecture the loaded llama.cpp library cannot run, instead of the
+// crash or opaque failure of llama.cpp. It matches ErrUnsupportedModelType
+// with errors.Is.
+type ErrUnsupportedArchitecture struct {
+	// Arch is the general.architecture of the model, e.g. "qwen35"
+	Arch string
+	// RequiredBuild is the first llama.cpp build supporting Arch, or 0 when
+	// the architecture is denied whatever the build
+	RequiredBuild int
+	// LoadedBuild is the build of the loaded library
+	LoadedBuild int
+}
+
+// Error implements the error interface
+func (e *ErrUnsupportedArchitecture) Error() string {
+	if e.RequiredBuild == 0 {
+		return fmt.Sprintf("model architecture %q is not supported", e.Arch)
+	}
+	return fmt.Sprintf("model architecture %q requires llama.cpp b%d or newer, the loaded library is b%d; load a newer library with LoadLibraryWithVersion",
+		e.Arch, e.RequiredBuild, e.LoadedBuild)
+}
+
+// Is matches ErrUnsupportedModelType
+func (e *ErrUnsupportedArchitecture) Is(target error) bool {
+	return target == ErrUnsupportedModelType
+}
+
+// architectureRules holds the first llama.cpp build supporting each
+// architecture added after the oldest supported build, and the denied
+// architectures (build 0).
+var architectureRules = struct {
+	sync.RWMutex
+	m map[string]int
+}{m: map[string]int{
+	"qwen35": 7990,
+}}
+
+// RequireArchitectureBuild records that models of architecture arch need
+// llama.cpp build or newer, for architectures added after the builds the
+// bindings know about. A build of 0 or less removes the rule.
+func RequireArchitectureBuild(arch string, build int) {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+	architectureRules.Lock()
+	defer architectureRules.Unlock()
+	if build <= 0 {
+		delete(architectureRules.m, arch)
+		return
+	}
+	architectureRules.m[arch] = build
+}
+
+// DenyArchitecture refuses to load models of architecture arch, e.g. one
+// known to crash the loaded library. RequireArchitectureBuild(arch, 0)
+// lifts the ban.
+func DenyArchitecture(arch string) {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+	architectureRules.Lock()
+	defer architectureRules.Unlock()
+	architectureRules.m[arch] = 0
+}
+
+// CheckModelArchitecture reads the architecture of the GGUF model at path
+// and returns an *ErrUnsupportedArchitecture when the loaded llama.cpp
+// library (or LlamaCppBuild before one is loaded) cannot run it. Models
+// whose header cannot be read, or that name no architecture, pass: loading
+// them reports the problem. Model_load_from_file and
+// Model_load_from_splits check this first.
+//
+// Example usage:
+//
+//	var unsupported *gollama.ErrUnsupportedArchitecture
+//	if err := gollama.CheckModelArchitecture(path); errors.As(err, &unsupported) {
+//		log.Printf("%s needs llama.cpp b%d", unsupported.Arch, unsupported.RequiredBuild)
+//	}
+func CheckModelArchitecture(path string) error {
+	file, err := ReadGGUF(path)
+	if err != nil {
+		return nil
+	}
+	arch, ok := file.MetaString("general.architecture")
+	if !ok {
+		return nil
+	}
+	libMutex.RLock()
+	build := libraryBuild(loaderLibVersion, loadedLibPath)
+	libMutex.RUnlock()
+	return checkArchitecture(arch, build)
+}
+
+// checkArchitecture applies the architecture rules to arch for build.
+func checkArchitecture(arch string, build int) error {
+	architectureRules.RLock()
+	required, ok := architectureRules.m[strings.ToLower(arch)]
+	architectureRules.RUnlock()
+	if !ok || (required > 0 && build >= required) {
+		return nil
+	}
+	return &ErrUnsupportedArchitecture{Arch: arch, RequiredBuild: required, LoadedBuild: build}
+}
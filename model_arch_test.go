@@ -0,0 +1,78 @@
+package gollama
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ModelArchSuite struct{ BaseSuite }
+
+func (s *ModelArchSuite) TestCheckArchitecture() {
+	s.NoError(checkArchitecture("llama", 6862))
+	s.NoError(checkArchitecture("qwen35", 7990))
+
+	err := checkArchitecture("Qwen35", 6862)
+	var unsupported *ErrUnsupportedArchitecture
+	s.Require().True(errors.As(err, &unsupported))
+	s.Equal(ErrUnsupportedArchitecture{Arch: "Qwen35", RequiredBuild: 7990, LoadedBuild: 6862}, *unsupported)
+	s.ErrorIs(err, ErrUnsupportedModelType)
+	s.Contains(err.Error(), "b7990")
+}
+
+func (s *ModelArchSuite) TestRules() {
+	s.T().Cleanup(func() {
+		RequireArchitectureBuild("futurearch", 0)
+		RequireArchitectureBuild("brokenarch", 0)
+	})
+	RequireArchitectureBuild(" FutureArch ", 9000)
+	s.Error(checkArchitecture("futurearch", 8999))
+	s.NoError(checkArchitecture("futurearch", 9000))
+
+	DenyArchitecture("brokenarch")
+	err := checkArchitecture("brokenarch", 99999)
+	s.ErrorIs(err, ErrUnsupportedModelType)
+	s.Contains(err.Error(), "not supported")
+	RequireArchitectureBuild("brokenarch", 0)
+	s.NoError(checkArchitecture("brokenarch", 6862))
+}
+
+func (s *ModelArchSuite) TestCheckModelArchitecture() {
+	dir := s.T().TempDir()
+	newer := filepath.Join(dir, "newer.gguf")
+	writeTestGGUF(s.T(), newer, map[string]any{"general.architecture": "qwen35"}, nil)
+	plain := filepath.Join(dir, "plain.gguf")
+	writeTestGGUF(s.T(), plain, map[string]any{"general.architecture": "llama"}, nil)
+
+	libMutex.RLock()
+	build := libraryBuild(loaderLibVersion, loadedLibPath)
+	libMutex.RUnlock()
+	if build < 7990 {
+		var unsupported *ErrUnsupportedArchitecture
+		s.Require().True(errors.As(CheckModelArchitecture(newer), &unsupported))
+		s.Equal(build, unsupported.LoadedBuild)
+	}
+	s.NoError(CheckModelArchitecture(plain))
+	s.NoError(CheckModelArchitecture(filepath.Join(dir, "missing.gguf")), "left to the loader")
+}
+
+func (s *ModelArchSuite) TestLoadRejectsArchitecture() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	path := filepath.Join(s.T().TempDir(), "future.gguf")
+	writeTestGGUF(s.T(), path, map[string]any{"general.architecture": "futurearch"}, nil)
+	RequireArchitectureBuild("futurearch", 1<<30)
+	s.T().Cleanup(func() { RequireArchitectureBuild("futurearch", 0) })
+
+	_, err := Model_load_from_file(path, Model_default_params())
+	s.ErrorIs(err, ErrUnsupportedModelType)
+	s.Contains(err.Error(), "b"+strconv.Itoa(1<<30))
+	_, err = Model_load_from_splits([]string{path}, Model_default_params())
+	s.ErrorIs(err, ErrUnsupportedModelType)
+}
+
+func TestModelArchSuite(t *testing.T) { suite.Run(t, new(ModelArchSuite)) }
@@ -0,0 +1,192 @@
+package gollama
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sync"
+	"unsafe"
+)
+
+var (
+	// The arrays referenced by LlamaModelParams stay reachable for the life
+	// of the process: a params value can be copied and used for any number
+	// of loads, and a program builds few distinct arrays. Device lists and
+	// tensor splits are shared by content, override lists by address
+	paramDeviceLists  = make(map[string][]GgmlBackendDevice)
+	paramTensorSplits = make(map[string][]float32)
+	paramBuftLists    = make(map[uintptr]*buftOverrideList)
+	paramArraysMu     sync.Mutex
+)
+
+// TensorBufferOverride places the weight tensors whose names match Pattern
+// in buffers of BufferType instead of the device their layer is assigned
+// to. Pattern is a regular expression searched in tensor names such as
+// "blk.12.ffn_up_exps.weight".
+type TensorBufferOverride struct {
+	Pattern    string
+	BufferType GgmlBackendBufferType
+}
+
+// llamaTensorBuftOverride mirrors struct llama_model_tensor_buft_override.
+type llamaTensorBuftOverride struct {
+	pattern *byte
+	buft    GgmlBackendBufferType
+}
+
+// buftOverrideList is a {NULL, NULL}-terminated override array with the
+// pattern strings it points to.
+type buftOverrideList struct {
+	overrides []TensorBufferOverride
+	entries   []llamaTensorBuftOverride
+	patterns  [][]byte
+}
+
+// SelectDevices looks up the ggml devices with the given names, such as
+// "CUDA1" or "Vulkan0" (see SystemInfo.Devices), in order. Names are
+// matched case-insensitively by the library. The result is meant for
+// SetDevices:
+//
+//	devices, err := gollama.SelectDevices("CUDA1")
+//	if err != nil {
+//		return err
+//	}
+//	params := gollama.Model_default_params()
+//	params.SetDevices(devices)
+func SelectDevices(names ...string) ([]GgmlBackendDevice, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: no device names", ErrMissingParameter)
+	}
+	devices := make([]GgmlBackendDevice, 0, len(names))
+	seen := make(map[GgmlBackendDevice]bool)
+	for _, name := range names {
+		dev, err := Ggml_backend_dev_by_name(name)
+		if err != nil {
+			return nil, err
+		}
+		if dev == 0 {
+			return nil, fmt.Errorf("%w: no device named %q", ErrBackendNotAvailable, name)
+		}
+		if !seen[dev] {
+			seen[dev] = true
+			devices = append(devices, dev)
+		}
+	}
+	return devices, nil
+}
+
+// SetDevices restricts the model to devices, in order, setting Devices to
+// a NULL-terminated copy of the list. An empty list restores the library
+// default of using every device.
+func (p *LlamaModelParams) SetDevices(devices []GgmlBackendDevice) {
+	if len(devices) == 0 {
+		p.Devices = 0
+		return
+	}
+	key := fmt.Sprint(devices)
+	paramArraysMu.Lock()
+	list, ok := paramDeviceLists[key]
+	if !ok {
+		list = append(append([]GgmlBackendDevice(nil), devices...), 0)
+		paramDeviceLists[key] = list
+	}
+	paramArraysMu.Unlock()
+	p.Devices = uintptr(unsafe.Pointer(&list[0]))
+}
+
+// SetTensorSplit sets the proportion of the model each device receives
+// with SplitMode LLAMA_SPLIT_MODE_LAYER or LLAMA_SPLIT_MODE_ROW, indexed
+// like the devices in use (see SetDevices); e.g. {3, 1} puts three quarters
+// on the first GPU. llama.cpp reads Max_devices entries, so the copy is
+// padded with zeros. An empty split restores the default, proportional to
+// free memory.
+func (p *LlamaModelParams) SetTensorSplit(split []float32) error {
+	if len(split) == 0 {
+		p.TensorSplit = nil
+		return nil
+	}
+	maxDevices := int(Max_devices())
+	if maxDevices > 0 && len(split) > maxDevices {
+		return fmt.Errorf("%w: tensor split for %d devices, the library supports %d", ErrParameterOutOfRange, len(split), maxDevices)
+	}
+	for i, v := range split {
+		if v < 0 || math.IsNaN(float64(v)) {
+			return fmt.Errorf("%w: tensor split entry %d is %v", ErrInvalidParameter, i, v)
+		}
+	}
+
+	key := fmt.Sprint(split)
+	paramArraysMu.Lock()
+	values, ok := paramTensorSplits[key]
+	if !ok {
+		values = make([]float32, max(len(split), maxDevices))
+		copy(values, split)
+		paramTensorSplits[key] = values
+	}
+	paramArraysMu.Unlock()
+	p.TensorSplit = &values[0]
+	return nil
+}
+
+// SetTensorBufferOverrides replaces the tensor buffer type overrides;
+// overrides are matched in order and an empty list removes them. It fails
+// with ErrInvalidParameter for a pattern that is not a valid regular
+// expression or a zero buffer type.
+func (p *LlamaModelParams) SetTensorBufferOverrides(overrides []TensorBufferOverride) error {
+	if len(overrides) == 0 {
+		p.TensorBuftOverrides = 0
+		return nil
+	}
+	list := &buftOverrideList{overrides: append([]TensorBufferOverride(nil), overrides...)}
+	for i, o := range overrides {
+		if _, err := regexp.Compile(o.Pattern); err != nil || o.Pattern == "" {
+			return fmt.Errorf("%w: tensor buffer override %d: bad pattern %q", ErrInvalidParameter, i, o.Pattern)
+		}
+		if o.BufferType == 0 {
+			return fmt.Errorf("%w: tensor buffer override %d: no buffer type", ErrInvalidParameter, i)
+		}
+		pattern := append([]byte(o.Pattern), 0)
+		list.patterns = append(list.patterns, pattern)
+		list.entries = append(list.entries, llamaTensorBuftOverride{pattern: &pattern[0], buft: o.BufferType})
+	}
+	list.entries = append(list.entries, llamaTensorBuftOverride{})
+
+	ptr := uintptr(unsafe.Pointer(&list.entries[0]))
+	paramArraysMu.Lock()
+	paramBuftLists[ptr] = list
+	paramArraysMu.Unlock()
+	p.TensorBuftOverrides = ptr
+	return nil
+}
+
+// OverrideTensorBuffer adds an override placing the tensors matching
+// pattern in buft, after those already set. Keeping the experts of a
+// mixture-of-experts model in system memory while offloading everything
+// else is a common use:
+//
+//	cpu, _ := gollama.Ggml_backend_cpu_buffer_type()
+//	err := params.OverrideTensorBuffer(`ffn_.*_exps`, cpu)
+func (p *LlamaModelParams) OverrideTensorBuffer(pattern string, buft GgmlBackendBufferType) error {
+	current, err := p.TensorBufferOverrides()
+	if err != nil {
+		return err
+	}
+	return p.SetTensorBufferOverrides(append(current, TensorBufferOverride{Pattern: pattern, BufferType: buft}))
+}
+
+// TensorBufferOverrides returns the overrides set with
+// SetTensorBufferOverrides or OverrideTensorBuffer. An override array set
+// directly in TensorBuftOverrides cannot be read back and is reported as
+// ErrInvalidParameter.
+func (p *LlamaModelParams) TensorBufferOverrides() ([]TensorBufferOverride, error) {
+	if p.TensorBuftOverrides == 0 {
+		return nil, nil
+	}
+	paramArraysMu.Lock()
+	list, ok := paramBuftLists[p.TensorBuftOverrides]
+	paramArraysMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: TensorBuftOverrides was not set through this package", ErrInvalidParameter)
+	}
+	return append([]TensorBufferOverride(nil), list.overrides...), nil
+}
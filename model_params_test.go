@@ -0,0 +1,103 @@
+package gollama
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ModelParamsSuite struct{ BaseSuite }
+
+func (s *ModelParamsSuite) TestSetDevices() {
+	var p LlamaModelParams
+	p.SetDevices([]GgmlBackendDevice{11, 22})
+	paramArraysMu.Lock()
+	list := paramDeviceLists[fmt.Sprint([]GgmlBackendDevice{11, 22})]
+	paramArraysMu.Unlock()
+	s.Equal([]GgmlBackendDevice{11, 22, 0}, list)
+	s.Equal(uintptr(unsafe.Pointer(&list[0])), p.Devices)
+
+	// The same list is shared
+	var q LlamaModelParams
+	q.SetDevices([]GgmlBackendDevice{11, 22})
+	s.Equal(p.Devices, q.Devices)
+
+	p.SetDevices(nil)
+	s.Zero(p.Devices)
+}
+
+func (s *ModelParamsSuite) TestSelectDevices() {
+	_, err := SelectDevices()
+	s.ErrorIs(err, ErrMissingParameter)
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	s.Require().NoError(Ggml_backend_load_all())
+
+	devices, err := SelectDevices("cpu", "CPU")
+	s.Require().NoError(err)
+	s.Require().Len(devices, 1)
+	name, err := Ggml_backend_dev_name(devices[0])
+	s.Require().NoError(err)
+	s.Equal("CPU", name)
+
+	_, err = SelectDevices("CPU", "CUDA7")
+	s.ErrorIs(err, ErrBackendNotAvailable)
+}
+
+func (s *ModelParamsSuite) TestSetTensorSplit() {
+	var p LlamaModelParams
+	s.Require().NoError(p.SetTensorSplit([]float32{3, 1}))
+	s.Require().NotNil(p.TensorSplit)
+	n := max(2, int(Max_devices()))
+	values := unsafe.Slice(p.TensorSplit, n)
+	s.Equal([]float32{3, 1}, values[:2])
+	for _, v := range values[2:] {
+		s.Zero(v)
+	}
+
+	s.ErrorIs(p.SetTensorSplit([]float32{1, -1}), ErrInvalidParameter)
+	s.ErrorIs(p.SetTensorSplit([]float32{float32(math.NaN())}), ErrInvalidParameter)
+	if maxDevices := int(Max_devices()); maxDevices > 0 {
+		s.ErrorIs(p.SetTensorSplit(make([]float32, maxDevices+1)), ErrParameterOutOfRange)
+	}
+
+	s.Require().NoError(p.SetTensorSplit(nil))
+	s.Nil(p.TensorSplit)
+}
+
+func (s *ModelParamsSuite) TestTensorBufferOverrides() {
+	var p LlamaModelParams
+	s.Require().NoError(p.OverrideTensorBuffer(`ffn_.*_exps`, 0x1000))
+	s.Require().NoError(p.OverrideTensorBuffer(`blk\.0\.`, 0x2000))
+	s.Require().NotZero(p.TensorBuftOverrides)
+
+	got, err := p.TensorBufferOverrides()
+	s.Require().NoError(err)
+	s.Equal([]TensorBufferOverride{{`ffn_.*_exps`, 0x1000}, {`blk\.0\.`, 0x2000}}, got)
+
+	paramArraysMu.Lock()
+	list := paramBuftLists[p.TensorBuftOverrides]
+	paramArraysMu.Unlock()
+	s.Require().Len(list.entries, 3)
+	s.Equal(`ffn_.*_exps`, bytePointerToString(list.entries[0].pattern))
+	s.Equal(GgmlBackendBufferType(0x2000), list.entries[1].buft)
+	s.Equal(llamaTensorBuftOverride{}, list.entries[2])
+
+	s.ErrorIs(p.OverrideTensorBuffer(`ffn_(`, 0x1000), ErrInvalidParameter)
+	s.ErrorIs(p.OverrideTensorBuffer(`ffn`, 0), ErrInvalidParameter)
+
+	s.Require().NoError(p.SetTensorBufferOverrides(nil))
+	s.Zero(p.TensorBuftOverrides)
+
+	p.TensorBuftOverrides = 0x1234
+	_, err = p.TensorBufferOverrides()
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func TestModelParamsSuite(t *testing.T) {
+	suite.Run(t, new(ModelParamsSuite))
+}
@@ -0,0 +1,370 @@
+package gollama
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHFQuant is the quantization pulled when a reference names none,
+// as llama.cpp's -hf option does.
+const defaultHFQuant = "Q4_K_M"
+
+// splitGGUFPattern matches the parts of a split model, e.g.
+// model-00001-of-00003.gguf.
+var splitGGUFPattern = regexp.MustCompile(`^(.*)-(\d{5})-of-(\d{5})\.gguf$`)
+
+// HFModelRef names a GGUF model on the Hugging Face Hub.
+type HFModelRef struct {
+	// Repo is the repository, "<owner>/<name>"
+	Repo string
+	// Quant selects the file whose name contains it, case-insensitively,
+	// e.g. "Q4_K_M"; empty picks Q4_K_M when present, else the first GGUF
+	Quant string
+	// Revision is the branch, tag or commit; empty means "main"
+	Revision string
+}
+
+// ParseHFModelRef parses "<owner>/<name>[:<quant>][@<revision>]", the
+// syntax of llama.cpp's -hf option with an optional revision.
+func ParseHFModelRef(s string) (HFModelRef, error) {
+	var ref HFModelRef
+	s, ref.Revision, _ = strings.Cut(strings.TrimSpace(s), "@")
+	ref.Repo, ref.Quant, _ = strings.Cut(s, ":")
+	if err := ref.validate(); err != nil {
+		return HFModelRef{}, err
+	}
+	return ref, nil
+}
+
+// validate checks that every part of the reference is a single path
+// segment, so that HFModelDir stays inside the cache directory.
+func (r HFModelRef) validate() error {
+	owner, name, ok := strings.Cut(r.Repo, "/")
+	if !ok || !isPathSegment(owner) || !isPathSegment(name) {
+		return fmt.Errorf("%w: model reference %q is not <owner>/<name>[:<quant>]", ErrInvalidParameter, r.Repo)
+	}
+	if r.Revision != "" && !isPathSegment(r.Revision) {
+		return fmt.Errorf("%w: invalid revision %q", ErrInvalidParameter, r.Revision)
+	}
+	if r.Quant != "" && !isPathSegment(r.Quant) {
+		return fmt.Errorf("%w: invalid quantization %q", ErrInvalidParameter, r.Quant)
+	}
+	return nil
+}
+
+// isPathSegment reports whether s names a single file or directory: not
+// empty, "." or "..", without separators and not absolute.
+func isPathSegment(s string) bool {
+	return s != "" && s != "." && !strings.Contains(s, "..") && !strings.ContainsAny(s, `/\:`) &&
+		!filepath.IsAbs(s) && filepath.VolumeName(s) == ""
+}
+
+// isWithinDir reports whether path is dir or below it.
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// String formats the reference as accepted by ParseHFModelRef.
+func (r HFModelRef) String() string {
+	s := r.Repo
+	if r.Quant != "" {
+		s += ":" + r.Quant
+	}
+	if r.Revision != "" {
+		s += "@" + r.Revision
+	}
+	return s
+}
+
+func (r HFModelRef) revision() string {
+	if r.Revision == "" {
+		return "main"
+	}
+	return r.Revision
+}
+
+// HFModelFile is a file of a Hugging Face repository.
+type HFModelFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// SHA256 is the digest of files stored with Git LFS, which GGUF files
+	// always are; empty otherwise
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// hfEndpoint returns the Hub URL, overridable with HF_ENDPOINT as in the
+// Hugging Face tools.
+func hfEndpoint() string {
+	if endpoint := os.Getenv("HF_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/")
+	}
+	return "https://huggingface.co"
+}
+
+// hfHeader returns the credentials from HF_TOKEN, needed for gated and
+// private repositories.
+func hfHeader() http.Header {
+	header := http.Header{}
+	if token := os.Getenv("HF_TOKEN"); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return header
+}
+
+// DefaultModelCacheDir returns the directory models are pulled into: the
+// models directory next to the default library cache, e.g.
+// ~/.cache/gollama/models, or $GOLLAMA_CACHE_DIR/models.
+func DefaultModelCacheDir() string {
+	return filepath.Join(filepath.Dir(defaultLibraryCacheDir()), "models")
+}
+
+// HFModelDir returns where PullHFModel stores the files of ref below
+// cacheDir: huggingface/<owner>/<name>/<revision>.
+func HFModelDir(cacheDir string, ref HFModelRef) string {
+	owner, name, _ := strings.Cut(ref.Repo, "/")
+	return filepath.Join(cacheDir, "huggingface", owner, name, ref.revision())
+}
+
+// ListHFModelFiles lists the files of a Hugging Face repository.
+func (d *LibraryDownloader) ListHFModelFiles(ref HFModelRef) ([]HFModelFile, error) {
+	if err := d.checkOnline("list the files of " + ref.Repo); err != nil {
+		return nil, err
+	}
+	apiURL := fmt.Sprintf("%s/api/models/%s/tree/%s?recursive=true", hfEndpoint(), ref.Repo, url.PathEscape(ref.revision()))
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = hfHeader()
+	req.Header.Set("User-Agent", d.userAgent)
+
+	resp, err := d.httpClient(30 * time.Second).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", ref.Repo, err)
+	}
+	defer func() {
+		_ = resp.Body.Close() // Ignore error in defer
+	}()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("failed to list %s: status %d (gated or private repositories need HF_TOKEN)", ref.Repo, resp.StatusCode)
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s (revision %s) not found on the Hugging Face Hub", ErrFileNotFound, ref.Repo, ref.revision())
+	default:
+		return nil, fmt.Errorf("failed to list %s: status %d", ref.Repo, resp.StatusCode)
+	}
+
+	var entries []struct {
+		Type string `json:"type"`
+		Path string `json:"path"`
+		Size int64  `json:"size"`
+		LFS  *struct {
+			Oid  string `json:"oid"`
+			Size int64  `json:"size"`
+		} `json:"lfs"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode the file list of %s: %w", ref.Repo, err)
+	}
+	files := make([]HFModelFile, 0, len(entries))
+	for _, e := range entries {
+		if e.Type != "file" {
+			continue
+		}
+		f := HFModelFile{Path: e.Path, Size: e.Size}
+		if e.LFS != nil && sha256Pattern.MatchString(e.LFS.Oid) {
+			f.SHA256 = strings.ToLower(e.LFS.Oid)
+			f.Size = e.LFS.Size
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// SelectGGUF picks the model files for quant among the files of a
+// repository. Multimodal projectors (mmproj) are skipped. The first match
+// by path wins; when it is part of a split model, all of its parts are
+// returned in order and must all be listed.
+func SelectGGUF(files []HFModelFile, quant string) ([]HFModelFile, error) {
+	var candidates []HFModelFile
+	for _, f := range files {
+		lower := strings.ToLower(f.Path)
+		if strings.HasSuffix(lower, ".gguf") && !strings.Contains(lower, "mmproj") {
+			candidates = append(candidates, f)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Path < candidates[j].Path })
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no GGUF files", ErrFileNotFound)
+	}
+
+	matches := func(q string) []HFModelFile {
+		var out []HFModelFile
+		for _, f := range candidates {
+			if strings.Contains(strings.ToUpper(f.Path), strings.ToUpper(q)) {
+				out = append(out, f)
+			}
+		}
+		return out
+	}
+	var selected []HFModelFile
+	switch {
+	case quant != "":
+		if selected = matches(quant); len(selected) == 0 {
+			return nil, fmt.Errorf("%w: no GGUF file matches %q", ErrFileNotFound, quant)
+		}
+	default:
+		if selected = matches(defaultHFQuant); len(selected) == 0 {
+			selected = candidates
+		}
+	}
+
+	first := selected[0]
+	m := splitGGUFPattern.FindStringSubmatch(first.Path)
+	if m == nil {
+		return []HFModelFile{first}, nil
+	}
+	prefix, count := m[1], m[3]
+	parts := make(map[string]HFModelFile)
+	for _, f := range candidates {
+		if pm := splitGGUFPattern.FindStringSubmatch(f.Path); pm != nil && pm[1] == prefix && pm[3] == count {
+			parts[pm[2]] = f
+		}
+	}
+	n, _ := strconv.Atoi(count)
+	ordered := make([]HFModelFile, 0, n)
+	for i := 1; i <= n; i++ {
+		part, ok := parts[fmt.Sprintf("%05d", i)]
+		if !ok {
+			return nil, fmt.Errorf("%w: split model %s is missing part %d of %d", ErrFileNotFound, prefix, i, n)
+		}
+		ordered = append(ordered, part)
+	}
+	return ordered, nil
+}
+
+// PullHFModel downloads the GGUF model ref names into HFModelDir(cacheDir,
+// ref) and returns the path to load: the model file, or the first part of
+// a split model, whose siblings llama.cpp loads from the same directory.
+// Files already present with the expected size are kept; downloads resume
+// and retry like library downloads and are verified against the SHA256
+// recorded by the Hub. In offline mode the files must already be present.
+func (d *LibraryDownloader) PullHFModel(ref HFModelRef, cacheDir string) (string, error) {
+	if err := ref.validate(); err != nil {
+		return "", err
+	}
+	dir := HFModelDir(cacheDir, ref)
+	if !isWithinDir(cacheDir, dir) {
+		return "", fmt.Errorf("%w: %s escapes the cache directory", ErrInvalidModelPath, ref)
+	}
+	files, err := d.ListHFModelFiles(ref)
+	if errors.Is(err, ErrOffline) {
+		files, err = localModelFiles(dir)
+		if err != nil || len(files) == 0 {
+			return "", fmt.Errorf("%w: %s is not in %s", ErrOffline, ref, dir)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	selected, err := SelectGGUF(files, ref.Quant)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ref, err)
+	}
+
+	for _, f := range selected {
+		if err := d.pullHFFile(ref, f, dir); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, filepath.FromSlash(selected[0].Path)), nil
+}
+
+// pullHFFile downloads one file of ref into dir unless it is already there.
+func (d *LibraryDownloader) pullHFFile(ref HFModelRef, f HFModelFile, dir string) error {
+	path := filepath.Join(dir, filepath.FromSlash(f.Path))
+	if path == filepath.Clean(dir) || !isWithinDir(dir, path) {
+		return fmt.Errorf("%w: file path %q escapes the model directory", ErrInvalidModelPath, f.Path)
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() == f.Size {
+		return nil
+	}
+	if d.offline {
+		return fmt.Errorf("%w: %s is not in %s", ErrOffline, f.Path, dir)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("failed to create model directory: %w", err)
+	}
+
+	segments := strings.Split(f.Path, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	fileURL := fmt.Sprintf("%s/%s/resolve/%s/%s", hfEndpoint(), ref.Repo, url.PathEscape(ref.revision()), strings.Join(segments, "/"))
+	slog.Info("downloading model file", "repo", ref.Repo, "file", f.Path, "size", f.Size)
+	sum, _, err := d.fetchWithHeader(fileURL, path, hfHeader(), true)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", f.Path, err)
+	}
+	if f.SHA256 == "" {
+		slog.Warn("model file has no published checksum", "repo", ref.Repo, "file", f.Path)
+		return nil
+	}
+	if !strings.EqualFold(sum, f.SHA256) {
+		_ = os.Remove(path)
+		return fmt.Errorf("%w for %s: expected %s, got %s", ErrChecksumMismatch, f.Path, f.SHA256, sum)
+	}
+	return nil
+}
+
+// localModelFiles lists the GGUF files already pulled into dir.
+func localModelFiles(dir string) ([]HFModelFile, error) {
+	var files []HFModelFile
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasSuffix(path, ".part") {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, HFModelFile{Path: filepath.ToSlash(rel), Size: info.Size()})
+		return nil
+	})
+	return files, err
+}
+
+// PullModel downloads a GGUF model from the Hugging Face Hub into
+// DefaultModelCacheDir, using the downloader that fetches libraries and
+// therefore its retry policy, progress callback, proxy and offline
+// settings. ref is "<owner>/<name>[:<quant>][@<revision>]"; the returned
+// path can be passed to Model_load_from_file.
+func PullModel(ref string) (string, error) {
+	parsed, err := ParseHFModelRef(ref)
+	if err != nil {
+		return "", err
+	}
+	d, err := ensureDownloader()
+	if err != nil {
+		return "", err
+	}
+	return d.PullHFModel(parsed, DefaultModelCacheDir())
+}
@@ -0,0 +1,163 @@
+package gollama
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ModelPullSuite struct{ BaseSuite }
+
+func (s *ModelPullSuite) TestParseHFModelRef() {
+	ref, err := ParseHFModelRef("org/repo:q8_0@v1")
+	s.Require().NoError(err)
+	s.Equal(HFModelRef{Repo: "org/repo", Quant: "q8_0", Revision: "v1"}, ref)
+	s.Equal("org/repo:q8_0@v1", ref.String())
+
+	ref, err = ParseHFModelRef("org/repo")
+	s.Require().NoError(err)
+	s.Equal("main", ref.revision())
+
+	for _, bad := range []string{"", "repo", "/repo", "org/", "org/a/b", "../x:q", `org\x/repo`, "org/..",
+		"org/repo@../../../x", "org/repo@..", "org/repo@a/b", `org/repo@a\b`, "org/repo@/etc", `org/repo@C:\x`,
+		"org/repo:../q", "org/repo:q/x@v1"} {
+		_, err := ParseHFModelRef(bad)
+		s.ErrorIs(err, ErrInvalidParameter, bad)
+	}
+}
+
+func (s *ModelPullSuite) TestPullHFModelStaysInCacheDir() {
+	d, err := NewLibraryDownloaderWithCacheDir(s.T().TempDir())
+	s.Require().NoError(err)
+	cacheDir := filepath.Join(s.T().TempDir(), "cache")
+	for _, ref := range []HFModelRef{
+		{Repo: "org/repo", Revision: "../../../x"},
+		{Repo: "../../x/repo"},
+		{Repo: "org/repo", Revision: "/tmp/x"},
+	} {
+		_, err := d.PullHFModel(ref, cacheDir)
+		s.ErrorIs(err, ErrInvalidParameter, ref.String())
+	}
+	s.NoDirExists(cacheDir)
+
+	s.True(isWithinDir(cacheDir, HFModelDir(cacheDir, HFModelRef{Repo: "org/repo"})))
+	s.False(isWithinDir(cacheDir, HFModelDir(cacheDir, HFModelRef{Repo: "org/repo", Revision: "../../../../x"})))
+}
+
+func (s *ModelPullSuite) TestSelectGGUF() {
+	files := []HFModelFile{
+		{Path: "README.md"},
+		{Path: "model-Q8_0.gguf"},
+		{Path: "model-Q4_K_M.gguf"},
+		{Path: "mmproj-model-Q4_K_M.gguf"},
+		{Path: "Q6_K/model-Q6_K-00002-of-00002.gguf"},
+		{Path: "Q6_K/model-Q6_K-00001-of-00002.gguf"},
+		{Path: "model-Q5_K-00001-of-00003.gguf"},
+	}
+
+	got, err := SelectGGUF(files, "")
+	s.Require().NoError(err)
+	s.Equal([]HFModelFile{{Path: "model-Q4_K_M.gguf"}}, got)
+
+	got, err = SelectGGUF(files, "q8_0")
+	s.Require().NoError(err)
+	s.Equal("model-Q8_0.gguf", got[0].Path)
+
+	got, err = SelectGGUF(files, "Q6_K")
+	s.Require().NoError(err)
+	s.Equal([]HFModelFile{
+		{Path: "Q6_K/model-Q6_K-00001-of-00002.gguf"},
+		{Path: "Q6_K/model-Q6_K-00002-of-00002.gguf"},
+	}, got)
+
+	_, err = SelectGGUF(files, "Q5_K")
+	s.ErrorIs(err, ErrFileNotFound)
+	_, err = SelectGGUF(files, "IQ1_S")
+	s.ErrorIs(err, ErrFileNotFound)
+	_, err = SelectGGUF([]HFModelFile{{Path: "README.md"}}, "")
+	s.ErrorIs(err, ErrFileNotFound)
+}
+
+func (s *ModelPullSuite) TestPullHFModel() {
+	parts := map[string]string{
+		"m-Q4_K_M-00001-of-00002.gguf": "part one",
+		"m-Q4_K_M-00002-of-00002.gguf": "part two",
+	}
+	var downloads int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/models/org/repo/tree/main", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("Bearer secret", r.Header.Get("Authorization"))
+		type lfs struct {
+			Oid  string `json:"oid"`
+			Size int64  `json:"size"`
+		}
+		var entries []map[string]any
+		for name, data := range parts {
+			entries = append(entries, map[string]any{"type": "file", "path": name, "size": 130,
+				"lfs": lfs{Oid: sha256Hex([]byte(data)), Size: int64(len(data))}})
+		}
+		entries = append(entries, map[string]any{"type": "directory", "path": "sub"})
+		_ = json.NewEncoder(w).Encode(entries)
+	})
+	mux.HandleFunc("/org/repo/resolve/main/", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("Bearer secret", r.Header.Get("Authorization"))
+		downloads++
+		data, ok := parts[strings.TrimPrefix(r.URL.Path, "/org/repo/resolve/main/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(data))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	s.T().Setenv("HF_ENDPOINT", srv.URL)
+	s.T().Setenv("HF_TOKEN", "secret")
+
+	cacheDir := s.T().TempDir()
+	d, err := NewLibraryDownloaderWithCacheDir(s.T().TempDir())
+	s.Require().NoError(err)
+	ref := HFModelRef{Repo: "org/repo"}
+
+	path, err := d.PullHFModel(ref, cacheDir)
+	s.Require().NoError(err)
+	dir := HFModelDir(cacheDir, ref)
+	s.Equal(filepath.Join(dir, "m-Q4_K_M-00001-of-00002.gguf"), path)
+	data, err := os.ReadFile(filepath.Join(dir, "m-Q4_K_M-00002-of-00002.gguf"))
+	s.Require().NoError(err)
+	s.Equal("part two", string(data))
+	s.Equal(2, downloads)
+
+	// Present files are not downloaded again, even offline
+	_, err = d.PullHFModel(ref, cacheDir)
+	s.Require().NoError(err)
+	s.Require().NoError(d.configureNetwork(&Config{Offline: true}))
+	offlinePath, err := d.PullHFModel(ref, cacheDir)
+	s.Require().NoError(err)
+	s.Equal(path, offlinePath)
+	s.Equal(2, downloads)
+	_, err = d.PullHFModel(HFModelRef{Repo: "org/other"}, cacheDir)
+	s.ErrorIs(err, ErrOffline)
+	s.Require().NoError(d.configureNetwork(nil))
+
+	// A file that does not match its published digest is rejected
+	mux.HandleFunc("/api/models/org/bad/tree/main", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"type":"file","path":"bad-Q4_K_M.gguf","size":6,"lfs":{"oid":"` + sha256Hex([]byte("part two")) + `","size":6}}]`))
+	})
+	mux.HandleFunc("/org/bad/resolve/main/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("part 2"))
+	})
+	_, err = d.PullHFModel(HFModelRef{Repo: "org/bad"}, cacheDir)
+	s.ErrorIs(err, ErrChecksumMismatch)
+	s.NoFileExists(filepath.Join(HFModelDir(cacheDir, HFModelRef{Repo: "org/bad"}), "bad-Q4_K_M.gguf"))
+}
+
+func TestModelPullSuite(t *testing.T) {
+	suite.Run(t, new(ModelPullSuite))
+}
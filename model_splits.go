@@ -0,0 +1,54 @@
+package gollama
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// SplitPath returns the path of split splitNo (1-based) of splitCount for
+// a model whose parts share pathPrefix, following llama.cpp's
+// llama_split_path: "<prefix>-00001-of-00003.gguf".
+func SplitPath(pathPrefix string, splitNo, splitCount int) string {
+	return fmt.Sprintf("%s-%05d-of-%05d.gguf", pathPrefix, splitNo, splitCount)
+}
+
+// FindModelSplits returns every part of the split model that path belongs
+// to, in load order. path may name any part; a path that is not named like
+// a split ("-00002-of-00005.gguf") is returned alone. It fails with
+// ErrFileNotFound when a part is missing next to path.
+func FindModelSplits(path string) ([]string, error) {
+	m := splitGGUFPattern.FindStringSubmatch(filepath.Base(path))
+	if m == nil {
+		return []string{path}, nil
+	}
+	count, err := strconv.Atoi(m[3])
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("%w: bad split count in %s", ErrInvalidModelPath, path)
+	}
+
+	prefix := filepath.Join(filepath.Dir(path), m[1])
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = SplitPath(prefix, i+1, count)
+		if _, err := os.Stat(paths[i]); err != nil {
+			return nil, fmt.Errorf("%w: split %d of %d of %s: %v", ErrFileNotFound, i+1, count, m[1], err)
+		}
+	}
+	return paths, nil
+}
+
+// Model_load_from_split_path loads a model from any of its files: a whole
+// GGUF file, or one part of a split model, whose siblings are found with
+// FindModelSplits and loaded with Model_load_from_splits.
+func Model_load_from_split_path(path string, params LlamaModelParams) (LlamaModel, error) {
+	paths, err := FindModelSplits(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(paths) == 1 {
+		return Model_load_from_file(paths[0], params)
+	}
+	return Model_load_from_splits(paths, params)
+}
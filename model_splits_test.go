@@ -0,0 +1,44 @@
+package gollama
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ModelSplitsSuite struct{ BaseSuite }
+
+func (s *ModelSplitsSuite) TestSplitPath() {
+	s.Equal("/m/llama-70b-00002-of-00003.gguf", SplitPath("/m/llama-70b", 2, 3))
+}
+
+func (s *ModelSplitsSuite) TestFindModelSplits() {
+	dir := s.T().TempDir()
+	prefix := filepath.Join(dir, "llama-70b-Q4_K_M")
+	for i := 1; i <= 3; i++ {
+		s.Require().NoError(os.WriteFile(SplitPath(prefix, i, 3), nil, 0o600))
+	}
+	want := []string{SplitPath(prefix, 1, 3), SplitPath(prefix, 2, 3), SplitPath(prefix, 3, 3)}
+
+	got, err := FindModelSplits(SplitPath(prefix, 2, 3))
+	s.Require().NoError(err)
+	s.Equal(want, got)
+
+	single := filepath.Join(dir, "tiny.gguf")
+	got, err = FindModelSplits(single)
+	s.Require().NoError(err)
+	s.Equal([]string{single}, got)
+
+	s.Require().NoError(os.Remove(want[2]))
+	_, err = FindModelSplits(want[0])
+	s.ErrorIs(err, ErrFileNotFound)
+
+	_, err = Model_load_from_split_path(want[0], LlamaModelParams{})
+	s.ErrorIs(err, ErrFileNotFound)
+}
+
+func TestModelSplitsSuite(t *testing.T) {
+	suite.Run(t, new(ModelSplitsSuite))
+}
@@ -0,0 +1,38 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ModelSuite struct{ BaseSuite }
+
+func (s *ModelSuite) TestNewModelRejectsNilHandle() {
+	_, err := NewModel(0)
+	s.Require().ErrorIs(err, ErrModelNotLoaded)
+}
+
+func (s *ModelSuite) TestCachedTokenProperties() {
+	m := &Model{
+		special: []LlamaToken{1, 2, 32000},
+		eog:     map[LlamaToken]struct{}{2: {}, 32000: {}},
+	}
+	s.True(m.IsEOG(2))
+	s.True(m.IsEOG(32000))
+	s.False(m.IsEOG(1))
+
+	special := m.SpecialTokens()
+	s.Equal([]LlamaToken{1, 2, 32000}, special)
+	special[0] = 99
+	s.Equal(LlamaToken(1), m.SpecialTokens()[0], "SpecialTokens must return a copy")
+}
+
+func (s *ModelSuite) TestFreeIsIdempotent() {
+	m := &Model{}
+	m.Free()
+	m.Free()
+	s.Equal(LlamaModel(0), m.Handle())
+}
+
+func TestModelSuite(t *testing.T) { suite.Run(t, new(ModelSuite)) }
@@ -0,0 +1,412 @@
+package gollama
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"unsafe"
+
+	"github.com/jupiterrider/ffi"
+)
+
+// Multimodal support is provided by libmtmd, which llama.cpp releases ship
+// next to libllama. It is optional: when the library is missing the
+// multimodal API returns ErrFunctionNotFound and everything else keeps
+// working.
+
+// Opaque mtmd handles
+type (
+	MtmdContext     uintptr
+	MtmdBitmap      uintptr
+	MtmdInputChunks uintptr
+)
+
+// MtmdContextParams mirrors struct mtmd_context_params.
+type MtmdContextParams struct {
+	UseGpu       bool  // offload the projector to the GPU
+	PrintTimings bool  // log encoding timings
+	NThreads     int32 // threads used to encode media
+	Verbosity    int32 // ggml_log_level of the projector loader
+	ImageMarker  *byte // deprecated, use MediaMarker
+	MediaMarker  *byte // marker replaced by media embeddings in prompts
+}
+
+// mtmdInputText mirrors struct mtmd_input_text.
+type mtmdInputText struct {
+	Text         *byte
+	AddSpecial   bool
+	ParseSpecial bool
+}
+
+var (
+	mtmdHandle uintptr
+
+	// Struct-by-value functions, registered with purego on Darwin only
+	mtmdContextParamsDefault func() MtmdContextParams
+	mtmdInitFromFile         func(mmprojPath *byte, textModel LlamaModel, params MtmdContextParams) MtmdContext
+
+	mtmdFree                    func(ctx MtmdContext)
+	mtmdDefaultMarker           func() *byte
+	mtmdSupportVision           func(ctx MtmdContext) bool
+	mtmdSupportAudio            func(ctx MtmdContext) bool
+	mtmdHelperBitmapInitFromBuf func(ctx MtmdContext, buf *byte, length uint64) MtmdBitmap
+	mtmdBitmapFree              func(bitmap MtmdBitmap)
+	mtmdInputChunksInit         func() MtmdInputChunks
+	mtmdInputChunksFree         func(chunks MtmdInputChunks)
+	mtmdTokenize                func(ctx MtmdContext, output MtmdInputChunks, text *mtmdInputText, bitmaps *MtmdBitmap, nBitmaps uint64) int32
+	mtmdHelperGetNTokens        func(chunks MtmdInputChunks) uint64
+	mtmdHelperGetNPos           func(chunks MtmdInputChunks) LlamaPos
+	mtmdHelperEvalChunks        func(ctx MtmdContext, lctx LlamaContext, chunks MtmdInputChunks, nPast LlamaPos, seqID LlamaSeqId, nBatch int32, logitsLast bool, newNPast *LlamaPos) int32
+
+	// MtmdContextParams FFI type
+	ffiTypeMtmdContextParams = ffi.Type{
+		Type: ffi.Struct,
+		Elements: &[]*ffi.Type{
+			&ffi.TypeUint8,   // use_gpu
+			&ffi.TypeUint8,   // print_timings
+			&ffi.TypeSint32,  // n_threads
+			&ffi.TypeSint32,  // verbosity
+			&ffi.TypePointer, // image_marker
+			&ffi.TypePointer, // media_marker
+			nil,
+		}[0],
+	}
+)
+
+// mtmdLibraryName returns the platform file name of libmtmd.
+func mtmdLibraryName() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "libmtmd.dylib"
+	case "windows":
+		return "mtmd.dll"
+	default:
+		return "libmtmd.so"
+	}
+}
+
+// registerMtmdFunctions loads libmtmd from the directory of libPath and
+// registers its functions. Failures leave multimodal support disabled.
+// Callers must hold libMutex for writing.
+func registerMtmdFunctions(libPath string) {
+	mtmdHandle = 0
+	handle, err := loadLibraryPlatform(filepath.Join(filepath.Dir(libPath), mtmdLibraryName()))
+	if err != nil {
+		return
+	}
+	if _, err := getProcAddressPlatform(handle, "mtmd_init_from_file"); err != nil {
+		return
+	}
+
+	if runtime.GOOS == "darwin" {
+		_ = tryRegisterLibFunc(&mtmdContextParamsDefault, handle, "mtmd_context_params_default")
+		_ = tryRegisterLibFunc(&mtmdInitFromFile, handle, "mtmd_init_from_file")
+	}
+	_ = tryRegisterLibFunc(&mtmdFree, handle, "mtmd_free")
+	_ = tryRegisterLibFunc(&mtmdDefaultMarker, handle, "mtmd_default_marker")
+	_ = tryRegisterLibFunc(&mtmdSupportVision, handle, "mtmd_support_vision")
+	_ = tryRegisterLibFunc(&mtmdSupportAudio, handle, "mtmd_support_audio")
+	_ = tryRegisterLibFunc(&mtmdHelperBitmapInitFromBuf, handle, "mtmd_helper_bitmap_init_from_buf")
+	_ = tryRegisterLibFunc(&mtmdBitmapFree, handle, "mtmd_bitmap_free")
+	_ = tryRegisterLibFunc(&mtmdInputChunksInit, handle, "mtmd_input_chunks_init")
+	_ = tryRegisterLibFunc(&mtmdInputChunksFree, handle, "mtmd_input_chunks_free")
+	_ = tryRegisterLibFunc(&mtmdTokenize, handle, "mtmd_tokenize")
+	_ = tryRegisterLibFunc(&mtmdHelperGetNTokens, handle, "mtmd_helper_get_n_tokens")
+	_ = tryRegisterLibFunc(&mtmdHelperGetNPos, handle, "mtmd_helper_get_n_pos")
+	_ = tryRegisterLibFunc(&mtmdHelperEvalChunks, handle, "mtmd_helper_eval_chunks")
+	mtmdHandle = handle
+}
+
+// mtmdAvailable reports whether libmtmd was loaded with the library.
+func mtmdAvailable() error {
+	if err := ensureLoaded(); err != nil {
+		return err
+	}
+	libMutex.RLock()
+	defer libMutex.RUnlock()
+	if mtmdHandle == 0 {
+		return fmt.Errorf("%w: %s not loaded", ErrFunctionNotFound, mtmdLibraryName())
+	}
+	return nil
+}
+
+// Mtmd_available reports whether multimodal support (libmtmd) is available
+// in the loaded llama.cpp build.
+func Mtmd_available() bool {
+	return mtmdAvailable() == nil
+}
+
+// Mtmd_default_marker returns the marker that stands for a media item in
+// prompts ("<__media__>").
+func Mtmd_default_marker() string {
+	if mtmdAvailable() != nil || mtmdDefaultMarker == nil {
+		return "<__media__>"
+	}
+	return bytePointerToString(mtmdDefaultMarker())
+}
+
+// Mtmd_context_params_default returns the default projector parameters.
+func Mtmd_context_params_default() (MtmdContextParams, error) {
+	if err := mtmdAvailable(); err != nil {
+		return MtmdContextParams{}, err
+	}
+	if runtime.GOOS == "darwin" {
+		if mtmdContextParamsDefault == nil {
+			return MtmdContextParams{}, fmt.Errorf("%w: mtmd_context_params_default", ErrFunctionNotFound)
+		}
+		return mtmdContextParamsDefault(), nil
+	}
+	return ffiMtmdContextParamsDefault()
+}
+
+// Mtmd_init_from_file loads a multimodal projector (mmproj GGUF) for
+// textModel.
+func Mtmd_init_from_file(mmprojPath string, textModel LlamaModel, params MtmdContextParams) (MtmdContext, error) {
+	release, err := acquireNativeCall("mtmd_init_from_file")
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	if err := mtmdAvailable(); err != nil {
+		return 0, err
+	}
+	if textModel == 0 {
+		return 0, ErrModelNotLoaded
+	}
+
+	pathBytes := append([]byte(mmprojPath), 0)
+	if runtime.GOOS == "darwin" {
+		if mtmdInitFromFile == nil {
+			return 0, fmt.Errorf("%w: mtmd_init_from_file", ErrFunctionNotFound)
+		}
+		ctx := mtmdInitFromFile(&pathBytes[0], textModel, params)
+		runtime.KeepAlive(pathBytes)
+		if ctx == 0 {
+			return 0, fmt.Errorf("failed to load multimodal projector %s", mmprojPath)
+		}
+		registerHandle(handleMtmd, uintptr(ctx))
+		return ctx, nil
+	}
+	ctx, err := ffiMtmdInitFromFile(&pathBytes[0], textModel, params)
+	runtime.KeepAlive(pathBytes)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", err, mmprojPath)
+	}
+	registerHandle(handleMtmd, uintptr(ctx))
+	return ctx, nil
+}
+
+// Mtmd_free frees a multimodal context. Freeing it twice does nothing.
+func Mtmd_free(ctx MtmdContext) {
+	if ctx != 0 && mtmdAvailable() == nil && mtmdFree != nil && closeHandle(handleMtmd, uintptr(ctx)) {
+		mtmdFree(ctx)
+	}
+}
+
+// ffiMtmdContextParamsDefault calls mtmd_context_params_default using FFI
+func ffiMtmdContextParamsDefault() (MtmdContextParams, error) {
+	var cif ffi.Cif
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 0, &ffiTypeMtmdContextParams); status != ffi.OK {
+		return MtmdContextParams{}, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	}
+
+	fnAddr, err := getProcAddressPlatform(mtmdHandle, "mtmd_context_params_default")
+	if err != nil {
+		return MtmdContextParams{}, fmt.Errorf("failed to get mtmd_context_params_default address: %w", err)
+	}
+
+	var result MtmdContextParams
+	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result))
+	return result, nil
+}
+
+// ffiMtmdInitFromFile calls mtmd_init_from_file using FFI
+func ffiMtmdInitFromFile(mmprojPath *byte, textModel LlamaModel, params MtmdContextParams) (MtmdContext, error) {
+	var cif ffi.Cif
+	aTypes := []*ffi.Type{&ffi.TypePointer, &ffi.TypePointer, &ffiTypeMtmdContextParams}
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 3, &ffi.TypePointer, aTypes...); status != ffi.OK {
+		return 0, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	}
+
+	fnAddr, err := getProcAddressPlatform(mtmdHandle, "mtmd_init_from_file")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get mtmd_init_from_file address: %w", err)
+	}
+
+	var result MtmdContext
+	aValues := []unsafe.Pointer{
+		unsafe.Pointer(&mmprojPath),
+		unsafe.Pointer(&textModel),
+		unsafe.Pointer(&params),
+	}
+	ffi.Call(&cif, fnAddr, unsafe.Pointer(&result), aValues...)
+
+	if result == 0 {
+		return 0, fmt.Errorf("failed to load multimodal projector")
+	}
+	return result, nil
+}
+
+// MultimodalContext evaluates prompts that mix text with images (or audio,
+// for projectors that support it). It pairs a text model with its
+// multimodal projector.
+//
+// Example usage:
+//
+//	mm, err := gollama.NewMultimodalContext("mmproj.gguf", model.Handle(), nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer mm.Close()
+//
+//	prompt, media, err := mm.ApplyChat(model.ChatTemplate, []gollama.ChatMessage{
+//		{Role: "user", Content: "What is in this picture?", Images: [][]byte{png}},
+//	}, true)
+//	nPast, err := mm.Eval(ctx, prompt, media, 0, 0, 512)
+//	// sample from ctx as usual; later tokens continue at nPast
+type MultimodalContext struct {
+	handle MtmdContext
+	marker string
+}
+
+// NewMultimodalContext loads the projector at mmprojPath for model. params
+// may be nil to use Mtmd_context_params_default.
+func NewMultimodalContext(mmprojPath string, model LlamaModel, params *MtmdContextParams) (*MultimodalContext, error) {
+	var p MtmdContextParams
+	if params != nil {
+		p = *params
+	} else {
+		var err error
+		if p, err = Mtmd_context_params_default(); err != nil {
+			return nil, err
+		}
+	}
+	handle, err := Mtmd_init_from_file(mmprojPath, model, p)
+	if err != nil {
+		return nil, err
+	}
+	marker := bytePointerToString(p.MediaMarker)
+	if marker == "" {
+		marker = Mtmd_default_marker()
+	}
+	return &MultimodalContext{handle: handle, marker: marker}, nil
+}
+
+// Handle returns the underlying mtmd context.
+func (m *MultimodalContext) Handle() MtmdContext {
+	return m.handle
+}
+
+// Marker returns the prompt marker replaced by each media item.
+func (m *MultimodalContext) Marker() string {
+	return m.marker
+}
+
+// SupportsVision reports whether the projector accepts images.
+func (m *MultimodalContext) SupportsVision() bool {
+	return m.handle != 0 && mtmdAvailable() == nil && mtmdSupportVision != nil && mtmdSupportVision(m.handle)
+}
+
+// SupportsAudio reports whether the projector accepts audio.
+func (m *MultimodalContext) SupportsAudio() bool {
+	return m.handle != 0 && mtmdAvailable() == nil && mtmdSupportAudio != nil && mtmdSupportAudio(m.handle)
+}
+
+// ApplyChat formats messages with Chat_apply_template, inserting one marker
+// per attached media item ahead of the message text. It returns the prompt
+// and the media in prompt order, ready for Eval.
+func (m *MultimodalContext) ApplyChat(tmpl string, messages []ChatMessage, addAssistant bool) (string, [][]byte, error) {
+	var media [][]byte
+	plain := make([]ChatMessage, len(messages))
+	for i, msg := range messages {
+		plain[i] = msg
+		if len(msg.Images) == 0 {
+			continue
+		}
+		prefix := ""
+		for _, img := range msg.Images {
+			prefix += m.marker + "\n"
+			media = append(media, img)
+		}
+		plain[i].Content = prefix + msg.Content
+		plain[i].Images = nil
+	}
+	prompt, err := Chat_apply_template(tmpl, plain, addAssistant)
+	if err != nil {
+		return "", nil, err
+	}
+	return prompt, media, nil
+}
+
+// Eval tokenizes prompt, encodes media (encoded image or audio files, one
+// per marker in prompt) and decodes everything into lctx for sequence seqID
+// starting at position nPast. Logits are computed for the last token. It
+// returns the position following the evaluated prompt.
+func (m *MultimodalContext) Eval(lctx LlamaContext, prompt string, media [][]byte, nPast LlamaPos, seqID LlamaSeqId, nBatch int32) (LlamaPos, error) {
+	release, err := acquireNativeCall("mtmd_helper_eval_chunks")
+	if err != nil {
+		return nPast, err
+	}
+	defer release()
+	if err := mtmdAvailable(); err != nil {
+		return nPast, err
+	}
+	if m.handle == 0 {
+		return nPast, fmt.Errorf("%w: multimodal context is closed", ErrInvalidParameter)
+	}
+	if lctx == 0 {
+		return nPast, ErrContextNotCreated
+	}
+
+	bitmaps := make([]MtmdBitmap, 0, len(media))
+	defer func() {
+		for _, bmp := range bitmaps {
+			mtmdBitmapFree(bmp)
+		}
+	}()
+	for i, data := range media {
+		if len(data) == 0 {
+			return nPast, fmt.Errorf("%w: media %d is empty", ErrInvalidParameter, i)
+		}
+		bmp := mtmdHelperBitmapInitFromBuf(m.handle, &data[0], uint64(len(data)))
+		if bmp == 0 {
+			return nPast, fmt.Errorf("%w: media %d could not be decoded", ErrInvalidParameter, i)
+		}
+		bitmaps = append(bitmaps, bmp)
+	}
+
+	chunks := mtmdInputChunksInit()
+	if chunks == 0 {
+		return nPast, ErrMemoryAllocationFailed
+	}
+	defer mtmdInputChunksFree(chunks)
+
+	textBytes := append([]byte(prompt), 0)
+	text := mtmdInputText{Text: &textBytes[0], AddSpecial: true, ParseSpecial: true}
+	var bitmapsPtr *MtmdBitmap
+	if len(bitmaps) > 0 {
+		bitmapsPtr = &bitmaps[0]
+	}
+	switch rc := mtmdTokenize(m.handle, chunks, &text, bitmapsPtr, uint64(len(bitmaps))); rc {
+	case 0:
+	case 1:
+		return nPast, fmt.Errorf("%w: prompt has a different number of %q markers than the %d media items", ErrInvalidParameter, m.marker, len(bitmaps))
+	default:
+		return nPast, fmt.Errorf("failed to preprocess media (mtmd_tokenize returned %d)", rc)
+	}
+	runtime.KeepAlive(textBytes)
+
+	newNPast := nPast
+	if rc := mtmdHelperEvalChunks(m.handle, lctx, chunks, nPast, seqID, nBatch, true, &newNPast); rc != 0 {
+		return nPast, fmt.Errorf("failed to evaluate multimodal prompt (mtmd_helper_eval_chunks returned %d)", rc)
+	}
+	return newNPast, nil
+}
+
+// Close frees the projector. It is safe to call more than once.
+func (m *MultimodalContext) Close() {
+	if m.handle != 0 {
+		Mtmd_free(m.handle)
+		m.handle = 0
+	}
+}
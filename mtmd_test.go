@@ -0,0 +1,49 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MtmdSuite struct{ BaseSuite }
+
+func (s *MtmdSuite) SetupTest() {
+	s.BaseSuite.SetupTest()
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	if !Mtmd_available() {
+		s.T().Skip("libmtmd not shipped with this build")
+	}
+}
+
+func (s *MtmdSuite) TestDefaultParams() {
+	params, err := Mtmd_context_params_default()
+	s.Require().NoError(err)
+	s.True(params.UseGpu)
+	s.Positive(params.NThreads)
+	s.Equal(Mtmd_default_marker(), bytePointerToString(params.MediaMarker))
+	s.Equal("<__media__>", Mtmd_default_marker())
+}
+
+func (s *MtmdSuite) TestInitErrors() {
+	_, err := NewMultimodalContext("/nonexistent/mmproj.gguf", 0, nil)
+	s.ErrorIs(err, ErrModelNotLoaded)
+}
+
+func (s *MtmdSuite) TestApplyChatInsertsMarkers() {
+	mm := &MultimodalContext{marker: Mtmd_default_marker()}
+	prompt, media, err := mm.ApplyChat("chatml", []ChatMessage{
+		{Role: "user", Content: "Compare these.", Images: [][]byte{{1}, {2}}},
+	}, true)
+	s.Require().NoError(err)
+	s.Equal([][]byte{{1}, {2}}, media)
+	s.Equal("<|im_start|>user\n<__media__>\n<__media__>\nCompare these.<|im_end|>\n<|im_start|>assistant\n", prompt)
+
+	_, err = mm.Eval(1, prompt, media, 0, 0, 512)
+	s.ErrorIs(err, ErrInvalidParameter)
+	mm.Close()
+}
+
+func TestMtmdSuite(t *testing.T) { suite.Run(t, new(MtmdSuite)) }
@@ -0,0 +1,252 @@
+package gollama
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// outputStates records, for each context, the number of outputs of the
+// last batch decoded or encoded and whether embeddings are computed, which
+// llama.cpp does not expose; they size the slices returned by Logits and
+// Embeddings.
+var outputStates struct {
+	mu sync.Mutex
+	m  map[LlamaContext]*outputState
+}
+
+type outputState struct {
+	n          int
+	embeddings bool
+}
+
+// updateOutputState applies update to the output state of ctx.
+func updateOutputState(ctx LlamaContext, update func(*outputState)) {
+	outputStates.mu.Lock()
+	defer outputStates.mu.Unlock()
+	if outputStates.m == nil {
+		outputStates.m = make(map[LlamaContext]*outputState)
+	}
+	st := outputStates.m[ctx]
+	if st == nil {
+		st = &outputState{}
+		outputStates.m[ctx] = st
+	}
+	update(st)
+}
+
+// noteEmbeddings records whether ctx computes embeddings.
+func noteEmbeddings(ctx LlamaContext, embeddings bool) {
+	updateOutputState(ctx, func(st *outputState) { st.embeddings = embeddings })
+}
+
+// recordOutputs records the outputs of batch after a decode (encode is
+// false) or encode of ctx. A decode outputs the tokens whose Logits flag is
+// set; without flags it outputs every token when the context computes
+// embeddings and only the last one otherwise. An encode outputs every
+// token. A failed call leaves no outputs.
+func recordOutputs(ctx LlamaContext, batch LlamaBatch, encode bool, err error) {
+	updateOutputState(ctx, func(st *outputState) {
+		st.n = 0
+		switch {
+		case err != nil || batch.NTokens <= 0:
+		case encode || (batch.Logits == nil && st.embeddings):
+			st.n = int(batch.NTokens)
+		case batch.Logits == nil:
+			st.n = 1
+		default:
+			for _, flag := range unsafe.Slice(batch.Logits, batch.NTokens) {
+				if flag != 0 {
+					st.n++
+				}
+			}
+		}
+	})
+}
+
+// forgetOutputs drops the output state of a freed context.
+func forgetOutputs(ctx LlamaContext) {
+	outputStates.mu.Lock()
+	defer outputStates.mu.Unlock()
+	delete(outputStates.m, ctx)
+}
+
+// nOutputs returns the number of outputs of the last batch of ctx.
+func nOutputs(ctx LlamaContext) int {
+	outputStates.mu.Lock()
+	defer outputStates.mu.Unlock()
+	if st := outputStates.m[ctx]; st != nil {
+		return st.n
+	}
+	return 0
+}
+
+// Logits returns the logits of every output of the last batch decoded by
+// ctx: one row of N_vocab(ctx) values per token whose Logits flag was set,
+// in batch order. The slice aliases memory owned by the context; it is
+// only valid until the next Decode or Encode on ctx, or until ctx is
+// freed, so copy the values that must outlive it.
+//
+// Example usage:
+//
+//	logits, err := gollama.Logits(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	nVocab := int(gollama.N_vocab(ctx))
+//	for row := 0; row < len(logits)/nVocab; row++ {
+//		scores := logits[row*nVocab : (row+1)*nVocab]
+//		// ...
+//	}
+func Logits(ctx LlamaContext) ([]float32, error) {
+	if ctx == 0 {
+		return nil, ErrContextNotCreated
+	}
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return nil, err
+	}
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+	if llamaGetLogits == nil {
+		return nil, fmt.Errorf("llama_get_logits function not available")
+	}
+	nVocab := int(N_vocab(ctx))
+	if nVocab <= 0 {
+		return nil, fmt.Errorf("%w: vocabulary size unknown", ErrOutputNotAvailable)
+	}
+	n := nOutputs(ctx)
+	if n == 0 {
+		return nil, fmt.Errorf("%w: no logits in the last batch", ErrOutputNotAvailable)
+	}
+	logits := llamaGetLogits(ctx)
+	if logits == nil {
+		return nil, fmt.Errorf("%w: the context computes no logits", ErrOutputNotAvailable)
+	}
+	return unsafe.Slice(logits, n*nVocab), nil
+}
+
+// LogitsRow returns the N_vocab(ctx) logits of token i of the last batch
+// decoded by ctx; negative values count from the last output, so -1 is the
+// last one. The token must have had its Logits flag set. Like Logits, the
+// slice aliases context memory valid until the next Decode or Encode.
+func LogitsRow(ctx LlamaContext, i int32) ([]float32, error) {
+	if ctx == 0 {
+		return nil, ErrContextNotCreated
+	}
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return nil, err
+	}
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+	if llamaGetLogitsIth == nil {
+		return nil, fmt.Errorf("llama_get_logits_ith function not available")
+	}
+	nVocab := N_vocab(ctx)
+	if nVocab <= 0 {
+		return nil, fmt.Errorf("%w: vocabulary size unknown", ErrOutputNotAvailable)
+	}
+	if nOutputs(ctx) == 0 {
+		return nil, fmt.Errorf("%w: no logits in the last batch", ErrOutputNotAvailable)
+	}
+	logits := llamaGetLogitsIth(ctx, i)
+	if logits == nil {
+		return nil, fmt.Errorf("%w: no logits for token %d", ErrOutputNotAvailable, i)
+	}
+	return unsafe.Slice(logits, nVocab), nil
+}
+
+// Embeddings returns the embeddings of every output of the last batch
+// processed by ctx: one row of Model_n_embd values per output token, in
+// batch order. It needs a context computing embeddings without pooling
+// (LLAMA_POOLING_TYPE_NONE); pooled embeddings are read per sequence with
+// EmbeddingsSeq. The slice aliases context memory valid until the next
+// Decode or Encode on ctx, or until ctx is freed.
+func Embeddings(ctx LlamaContext) ([]float32, error) {
+	nEmbd, err := embeddingsRowSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if llamaGetEmbeddings == nil {
+		return nil, fmt.Errorf("llama_get_embeddings function not available")
+	}
+	if pooling := Pooling_type(ctx); pooling != LLAMA_POOLING_TYPE_NONE {
+		return nil, fmt.Errorf("%w: the context pools embeddings (type %d), use EmbeddingsSeq", ErrOutputNotAvailable, pooling)
+	}
+	n := nOutputs(ctx)
+	if n == 0 {
+		return nil, fmt.Errorf("%w: no embeddings in the last batch", ErrOutputNotAvailable)
+	}
+	embd := llamaGetEmbeddings(ctx)
+	if embd == nil {
+		return nil, fmt.Errorf("%w: the context computes no embeddings", ErrOutputNotAvailable)
+	}
+	return unsafe.Slice(embd, n*nEmbd), nil
+}
+
+// EmbeddingsIth returns the Model_n_embd embedding values of token i of
+// the last batch processed by ctx; negative values count from the last
+// output. Like Embeddings, it needs a context without pooling and the
+// slice is only valid until the next Decode or Encode.
+func EmbeddingsIth(ctx LlamaContext, i int32) ([]float32, error) {
+	nEmbd, err := embeddingsRowSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if llamaGetEmbeddingsIth == nil {
+		return nil, fmt.Errorf("llama_get_embeddings_ith function not available")
+	}
+	if nOutputs(ctx) == 0 {
+		return nil, fmt.Errorf("%w: no embeddings in the last batch", ErrOutputNotAvailable)
+	}
+	embd := llamaGetEmbeddingsIth(ctx, i)
+	if embd == nil {
+		return nil, fmt.Errorf("%w: no embeddings for token %d", ErrOutputNotAvailable, i)
+	}
+	return unsafe.Slice(embd, nEmbd), nil
+}
+
+// EmbeddingsSeq returns the pooled embedding of sequence seq from the last
+// batch processed by ctx: Model_n_embd values, or the single score of a
+// LLAMA_POOLING_TYPE_RANK context. The slice is only valid until the next
+// Decode or Encode.
+func EmbeddingsSeq(ctx LlamaContext, seq LlamaSeqId) ([]float32, error) {
+	nEmbd, err := embeddingsRowSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if llamaGetEmbeddingsSeq == nil {
+		return nil, fmt.Errorf("llama_get_embeddings_seq function not available")
+	}
+	pooling := Pooling_type(ctx)
+	switch pooling {
+	case LLAMA_POOLING_TYPE_NONE:
+		return nil, fmt.Errorf("%w: the context does not pool embeddings, use EmbeddingsIth", ErrOutputNotAvailable)
+	case LLAMA_POOLING_TYPE_RANK:
+		nEmbd = 1
+	}
+	embd := llamaGetEmbeddingsSeq(ctx, seq)
+	if embd == nil {
+		return nil, fmt.Errorf("%w: no embeddings for sequence %d", ErrOutputNotAvailable, seq)
+	}
+	return unsafe.Slice(embd, nEmbd), nil
+}
+
+// embeddingsRowSize checks ctx and returns the embedding size of its model.
+func embeddingsRowSize(ctx LlamaContext) (int, error) {
+	if ctx == 0 {
+		return 0, ErrContextNotCreated
+	}
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return 0, err
+	}
+	if err := ensureLoaded(); err != nil {
+		return 0, err
+	}
+	nEmbd := int(Model_n_embd(Get_model(ctx)))
+	if nEmbd <= 0 {
+		return 0, fmt.Errorf("%w: embedding size unknown", ErrOutputNotAvailable)
+	}
+	return nEmbd, nil
+}
@@ -0,0 +1,56 @@
+package gollama
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OutputsSuite struct{ BaseSuite }
+
+func (s *OutputsSuite) TestRecordOutputs() {
+	const ctx = LlamaContext(0x1234)
+	s.T().Cleanup(func() { forgetOutputs(ctx) })
+
+	tokens := []LlamaToken{1, 2, 3, 4}
+	flags := []int8{1, 0, 1, 1}
+	batch := LlamaBatch{NTokens: 4, Token: &tokens[0], Logits: &flags[0]}
+	recordOutputs(ctx, batch, false, nil)
+	s.Equal(3, nOutputs(ctx))
+
+	recordOutputs(ctx, LlamaBatch{NTokens: 4, Token: &tokens[0]}, false, nil)
+	s.Equal(1, nOutputs(ctx), "without flags only the last token is output")
+
+	noteEmbeddings(ctx, true)
+	recordOutputs(ctx, LlamaBatch{NTokens: 4, Token: &tokens[0]}, false, nil)
+	s.Equal(4, nOutputs(ctx), "without flags an embeddings context outputs every token")
+	recordOutputs(ctx, batch, false, nil)
+	s.Equal(3, nOutputs(ctx))
+	noteEmbeddings(ctx, false)
+
+	recordOutputs(ctx, batch, true, nil)
+	s.Equal(4, nOutputs(ctx), "an encode outputs every token")
+
+	recordOutputs(ctx, batch, false, errors.New("decode failed"))
+	s.Zero(nOutputs(ctx))
+
+	recordOutputs(ctx, batch, false, nil)
+	forgetOutputs(ctx)
+	s.Zero(nOutputs(ctx))
+}
+
+func (s *OutputsSuite) TestWithoutContext() {
+	_, err := Logits(0)
+	s.ErrorIs(err, ErrContextNotCreated)
+	_, err = LogitsRow(0, -1)
+	s.ErrorIs(err, ErrContextNotCreated)
+	_, err = Embeddings(0)
+	s.ErrorIs(err, ErrContextNotCreated)
+	_, err = EmbeddingsIth(0, -1)
+	s.ErrorIs(err, ErrContextNotCreated)
+	_, err = EmbeddingsSeq(0, 0)
+	s.ErrorIs(err, ErrContextNotCreated)
+}
+
+func TestOutputsSuite(t *testing.T) { suite.Run(t, new(OutputsSuite)) }
@@ -0,0 +1,278 @@
+package gollama
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParallelOptions configures a ParallelGenerator.
+type ParallelOptions struct {
+	// MaxTokens bounds the length of every completion (default 128).
+	MaxTokens int
+	// Sampling configures the samplers; the zero value uses
+	// DefaultSamplingParams. Sequence i is seeded with Seed+i so the
+	// completions differ, unless Seed is LLAMA_DEFAULT_SEED.
+	Sampling *SamplingParams
+}
+
+// ParallelCompletion is the output of one sequence.
+type ParallelCompletion struct {
+	Tokens []LlamaToken
+	Text   string
+	// Stopped reports whether generation ended with an end-of-generation
+	// token rather than at MaxTokens.
+	Stopped bool
+}
+
+// ParallelStats reports the work done by the last generation.
+type ParallelStats struct {
+	// PromptTokens is the number of prompt tokens decoded.
+	PromptTokens int
+	// Generated is the number of tokens generated over all sequences.
+	Generated int
+	// Decodes is the number of decode calls, prompt included.
+	Decodes int
+}
+
+// ParallelGenerator generates several completions at once. Sequence i of
+// the context holds completion i; every step puts the last token of all
+// active sequences in a single batch, decodes it once and samples each
+// sequence from its own output row with its own sampler, the equivalent of
+// llama.cpp's batched example. The context must be created with NSeqMax at
+// least the number of completions.
+//
+// Example usage:
+//
+//	params := gollama.Context_default_params()
+//	params.NSeqMax = 4
+//	ctx, err := gollama.NewContext(model, params)
+//	...
+//	gen, err := gollama.NewParallelGenerator(ctx, gollama.ParallelOptions{MaxTokens: 64})
+//	if err != nil {
+//		return err
+//	}
+//	completions, err := gen.Generate(prompt, 4, nil)
+type ParallelGenerator struct {
+	ctx      *Context
+	opts     ParallelOptions
+	sampling SamplingParams
+	stats    ParallelStats
+}
+
+// parallelSeq is the state of one sequence during generation.
+type parallelSeq struct {
+	sampler LlamaSampler
+	pos     LlamaPos
+	// output is the batch row holding the sequence's logits, or -1 while
+	// the sequence has no logits to sample from
+	output int32
+	done   bool
+}
+
+// NewParallelGenerator creates a generator on ctx. It uses sequences 0 to
+// n-1 of the context, which it clears before every generation.
+func NewParallelGenerator(ctx *Context, opts ParallelOptions) (*ParallelGenerator, error) {
+	if ctx == nil || ctx.Handle() == 0 {
+		return nil, ErrContextNotCreated
+	}
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = 128
+	}
+	sampling := DefaultSamplingParams()
+	if opts.Sampling != nil {
+		sampling = *opts.Sampling
+	}
+	if err := sampling.Validate(); err != nil {
+		return nil, err
+	}
+	return &ParallelGenerator{ctx: ctx, opts: opts, sampling: sampling}, nil
+}
+
+// Stats returns the statistics of the last generation.
+func (g *ParallelGenerator) Stats() ParallelStats {
+	return g.stats
+}
+
+// Generate produces n completions of prompt. The prompt is decoded once,
+// into all n sequences at the same time. onToken, when set, is called for
+// every generated token with the index of its sequence; returning an error
+// from it aborts generation.
+func (g *ParallelGenerator) Generate(prompt []LlamaToken, n int, onToken func(seq int, token LlamaToken) error) ([]ParallelCompletion, error) {
+	if len(prompt) == 0 {
+		return nil, fmt.Errorf("%w: prompt is empty", ErrInvalidParameter)
+	}
+	prompts := make([][]LlamaToken, n)
+	for i := range prompts {
+		prompts[i] = prompt
+	}
+	return g.run(prompts, true, onToken)
+}
+
+// GenerateEach produces one completion for every prompt, decoding the
+// prompts and the completions of all sequences together.
+func (g *ParallelGenerator) GenerateEach(prompts [][]LlamaToken, onToken func(seq int, token LlamaToken) error) ([]ParallelCompletion, error) {
+	for i, p := range prompts {
+		if len(p) == 0 {
+			return nil, fmt.Errorf("%w: prompt %d is empty", ErrInvalidParameter, i)
+		}
+	}
+	return g.run(prompts, false, onToken)
+}
+
+func (g *ParallelGenerator) run(prompts [][]LlamaToken, shared bool, onToken func(int, LlamaToken) error) ([]ParallelCompletion, error) {
+	n := len(prompts)
+	if n == 0 || n > int(g.ctx.NSeqMax) {
+		return nil, fmt.Errorf("%w: need between 1 and %d sequences, got %d", ErrInvalidParameter, g.ctx.NSeqMax, n)
+	}
+	longest := 0
+	for _, p := range prompts {
+		longest = max(longest, len(p))
+	}
+	if longest+g.opts.MaxTokens > int(g.ctx.NCtx) {
+		return nil, fmt.Errorf("%w: %d prompt tokens and %d to generate exceed the context size of %d",
+			ErrContextFull, longest, g.opts.MaxTokens, g.ctx.NCtx)
+	}
+
+	g.stats = ParallelStats{}
+	model := g.ctx.Model()
+	seqs := make([]parallelSeq, n)
+	defer func() {
+		for _, s := range seqs {
+			if s.sampler != 0 {
+				Sampler_free(s.sampler)
+			}
+		}
+	}()
+	for i := range seqs {
+		p := g.sampling
+		if p.Seed != LLAMA_DEFAULT_SEED {
+			p.Seed += uint32(i)
+		}
+		sampler, err := NewSamplerChain(p)
+		if err != nil {
+			return nil, err
+		}
+		seqs[i] = parallelSeq{sampler: sampler, output: -1}
+		g.ctx.SeqRm(LlamaSeqId(i), 0, -1)
+	}
+
+	nSeqMax := int32(1)
+	if shared {
+		nSeqMax = int32(n)
+	}
+	batch, err := NewTokenBatch(max(g.ctx.NBatch, int32(n)), nSeqMax)
+	if err != nil {
+		return nil, err
+	}
+	defer batch.Free()
+
+	out := make([]ParallelCompletion, n)
+	// sample draws the next token of every sequence with logits in the
+	// batch just decoded.
+	sample := func() error {
+		for i := range seqs {
+			s := &seqs[i]
+			if s.done || s.output < 0 {
+				continue
+			}
+			token := Sampler_sample(s.sampler, g.ctx.Handle(), s.output)
+			s.output = -1
+			if token == LLAMA_TOKEN_NULL {
+				return fmt.Errorf("%w: no token sampled for sequence %d", ErrSamplingFailed, i)
+			}
+			if model.IsEOG(token) {
+				s.done, out[i].Stopped = true, true
+				continue
+			}
+			out[i].Tokens = append(out[i].Tokens, token)
+			g.stats.Generated++
+			if onToken != nil {
+				if err := onToken(i, token); err != nil {
+					return err
+				}
+			}
+			if len(out[i].Tokens) >= g.opts.MaxTokens {
+				s.done = true
+			}
+		}
+		return nil
+	}
+	decode := func() error {
+		g.stats.Decodes++
+		if err := g.ctx.Decode(batch.Batch()); err != nil {
+			return fmt.Errorf("decoding batch of %d tokens: %w", batch.Len(), err)
+		}
+		return sample()
+	}
+
+	// Prompt: shared prompts are decoded once for all sequences, others
+	// share batches. Sequences are sampled as soon as their last prompt
+	// token has been decoded, before its logits are overwritten.
+	all := make([]LlamaSeqId, n)
+	for i := range all {
+		all[i] = LlamaSeqId(i)
+	}
+	for i, prompt := range prompts {
+		if shared && i > 0 {
+			break
+		}
+		seqIDs := all[i : i+1]
+		if shared {
+			seqIDs = all
+		}
+		for j, token := range prompt {
+			if batch.Len() == batch.Cap() {
+				if err := decode(); err != nil {
+					return nil, err
+				}
+				batch.Clear()
+			}
+			last := j == len(prompt)-1
+			if err := batch.Add(token, LlamaPos(j), seqIDs, last); err != nil {
+				return nil, err
+			}
+			if last {
+				for _, id := range seqIDs {
+					seqs[id].output = int32(batch.Len() - 1)
+					seqs[id].pos = LlamaPos(len(prompt))
+				}
+			}
+		}
+		g.stats.PromptTokens += len(prompt)
+	}
+	if err := decode(); err != nil {
+		return nil, err
+	}
+
+	// Completions: one token per active sequence and step
+	for {
+		batch.Clear()
+		for i := range seqs {
+			s := &seqs[i]
+			if s.done {
+				continue
+			}
+			tokens := out[i].Tokens
+			if err := batch.Add(tokens[len(tokens)-1], s.pos, all[i:i+1], true); err != nil {
+				return nil, err
+			}
+			s.output = int32(batch.Len() - 1)
+			s.pos++
+		}
+		if batch.Len() == 0 {
+			break
+		}
+		if err := decode(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range out {
+		var text strings.Builder
+		for _, token := range out[i].Tokens {
+			text.WriteString(Token_to_piece(model.Handle(), token, false))
+		}
+		out[i].Text = text.String()
+	}
+	return out, nil
+}
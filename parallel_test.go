@@ -0,0 +1,38 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ParallelSuite struct{ BaseSuite }
+
+func (s *ParallelSuite) TestRequiresContext() {
+	_, err := NewParallelGenerator(nil, ParallelOptions{})
+	s.ErrorIs(err, ErrContextNotCreated)
+	_, err = NewParallelGenerator(&Context{}, ParallelOptions{})
+	s.ErrorIs(err, ErrContextNotCreated)
+}
+
+func (s *ParallelSuite) TestValidation() {
+	g := &ParallelGenerator{ctx: &Context{NCtx: 64, NSeqMax: 2}, opts: ParallelOptions{MaxTokens: 16}}
+
+	_, err := g.Generate(nil, 2, nil)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = g.Generate([]LlamaToken{1, 2}, 3, nil)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = g.Generate([]LlamaToken{1, 2}, 0, nil)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = g.Generate(make([]LlamaToken, 60), 2, nil)
+	s.ErrorIs(err, ErrContextFull)
+
+	_, err = g.GenerateEach([][]LlamaToken{{1}, {}}, nil)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = g.GenerateEach([][]LlamaToken{{1}, make([]LlamaToken, 49)}, nil)
+	s.ErrorIs(err, ErrContextFull)
+}
+
+func TestParallelSuite(t *testing.T) {
+	suite.Run(t, new(ParallelSuite))
+}
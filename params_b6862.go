@@ -0,0 +1,93 @@
+package gollama
+
+import (
+	"unsafe"
+
+	"github.com/jupiterrider/ffi"
+)
+
+// Struct layouts of llama.cpp b6862, the build the Go structs mirror.
+
+var (
+	// llama_model_params as of b6862
+	ffiTypeLlamaModelParamsB6862 = ffi.Type{
+		Type: ffi.Struct,
+		Elements: &[]*ffi.Type{
+			&ffi.TypePointer, // devices
+			&ffi.TypePointer, // tensor_buft_overrides
+			&ffi.TypeSint32,  // n_gpu_layers
+			&ffi.TypeSint32,  // split_mode
+			&ffi.TypeSint32,  // main_gpu
+			&ffi.TypePointer, // tensor_split
+			&ffi.TypePointer, // progress_callback
+			&ffi.TypePointer, // progress_callback_user_data
+			&ffi.TypePointer, // kv_overrides
+			&ffi.TypeUint8,   // vocab_only
+			&ffi.TypeUint8,   // use_mmap
+			&ffi.TypeUint8,   // use_mlock
+			&ffi.TypeUint8,   // check_tensors
+			&ffi.TypeUint8,   // use_extra_bufts
+			&ffi.TypeUint8,   // no_host
+			nil,
+		}[0],
+	}
+
+	// llama_context_params as of b6862
+	ffiTypeLlamaContextParamsB6862 = ffi.Type{
+		Type: ffi.Struct,
+		Elements: &[]*ffi.Type{
+			&ffi.TypeUint32,  // n_ctx
+			&ffi.TypeUint32,  // n_batch
+			&ffi.TypeUint32,  // n_ubatch
+			&ffi.TypeUint32,  // n_seq_max
+			&ffi.TypeSint32,  // n_threads
+			&ffi.TypeSint32,  // n_threads_batch
+			&ffi.TypeSint32,  // rope_scaling_type
+			&ffi.TypeSint32,  // pooling_type
+			&ffi.TypeSint32,  // attention_type
+			&ffi.TypeSint32,  // flash_attn_type
+			&ffi.TypeFloat,   // rope_freq_base
+			&ffi.TypeFloat,   // rope_freq_scale
+			&ffi.TypeFloat,   // yarn_ext_factor
+			&ffi.TypeFloat,   // yarn_attn_factor
+			&ffi.TypeFloat,   // yarn_beta_fast
+			&ffi.TypeFloat,   // yarn_beta_slow
+			&ffi.TypeUint32,  // yarn_orig_ctx
+			&ffi.TypeFloat,   // defrag_thold
+			&ffi.TypePointer, // cb_eval
+			&ffi.TypePointer, // cb_eval_user_data
+			&ffi.TypeSint32,  // type_k
+			&ffi.TypeSint32,  // type_v
+			&ffi.TypePointer, // abort_callback
+			&ffi.TypePointer, // abort_callback_data
+			&ffi.TypeUint8,   // embeddings
+			&ffi.TypeUint8,   // offload_kqv
+			&ffi.TypeUint8,   // no_perf
+			&ffi.TypeUint8,   // op_offload
+			&ffi.TypeUint8,   // swa_full
+			&ffi.TypeUint8,   // kv_unified
+			nil,
+		}[0],
+	}
+)
+
+func init() {
+	registerStructLayout(&structLayout{
+		build:         6862,
+		modelParams:   &ffiTypeLlamaModelParamsB6862,
+		contextParams: &ffiTypeLlamaContextParamsB6862,
+		native:        true,
+		encodeModelParams: func(p LlamaModelParams, dst unsafe.Pointer) {
+			*(*LlamaModelParams)(dst) = p
+		},
+		decodeModelParams: func(src unsafe.Pointer) LlamaModelParams {
+			return *(*LlamaModelParams)(src)
+		},
+		encodeContextParams: func(p LlamaContextParams, dst unsafe.Pointer) {
+			*(*LlamaContextParams)(dst) = p
+		},
+		decodeContextParams: func(src unsafe.Pointer) LlamaContextParams {
+			return *(*LlamaContextParams)(src)
+		},
+	})
+}
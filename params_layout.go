@@ -0,0 +1,144 @@
+package gollama
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"unsafe"
+
+	"github.com/jupiterrider/ffi"
+)
+
+// structLayout describes the C layout of the structs llama.cpp passes by
+// value (llama_model_params and llama_context_params) for a range of library
+// builds. LlamaModelParams and LlamaContextParams always keep the layout of
+// LlamaCppBuild; the layouts of other builds convert to and from them, so
+// the same Go code works against every supported library.
+//
+// A new layout is added with a params_bNNNN.go file that registers it from
+// init, generated from the build's llama.h by cmd/gollama-genstructs
+// (make gen-structs LLAMA_CPP_BUILD=bNNNN). Fields that do not exist in the Go structs keep their library
+// defaults; Go fields that do not exist in the library are dropped.
+type structLayout struct {
+	// build is the first llama.cpp build number using this layout
+	build int
+
+	modelParams   *ffi.Type
+	contextParams *ffi.Type
+
+	// native is set when the C structs match the Go structs byte for byte,
+	// which lets purego pass them directly on Darwin
+	native bool
+
+	encodeModelParams   func(p LlamaModelParams, dst unsafe.Pointer)
+	decodeModelParams   func(src unsafe.Pointer) LlamaModelParams
+	encodeContextParams func(p LlamaContextParams, dst unsafe.Pointer)
+	decodeContextParams func(src unsafe.Pointer) LlamaContextParams
+}
+
+var (
+	// structLayouts holds the registered layouts, oldest first
+	structLayouts []*structLayout
+
+	// activeLayout is the layout of the loaded library. Like the function
+	// table it is only replaced while fnTableMu is held for writing.
+	activeLayout *structLayout
+
+	buildNumberPattern = regexp.MustCompile(`\bb(\d{3,})\b`)
+)
+
+// registerStructLayout adds l to the known layouts.
+func registerStructLayout(l *structLayout) {
+	structLayouts = append(structLayouts, l)
+	sort.Slice(structLayouts, func(i, j int) bool { return structLayouts[i].build < structLayouts[j].build })
+}
+
+// layoutForBuild returns the newest layout introduced at or before build.
+// Builds newer than every known layout get the newest one; VerifyABICompatibility
+// catches the case where the structs changed again.
+func layoutForBuild(build int) (*structLayout, error) {
+	var found *structLayout
+	for _, l := range structLayouts {
+		if l.build <= build {
+			found = l
+		}
+	}
+	if found == nil {
+		oldest := 0
+		if len(structLayouts) > 0 {
+			oldest = structLayouts[0].build
+		}
+		return nil, fmt.Errorf("%w: no struct layout for llama.cpp b%d, the oldest supported build is b%d",
+			ErrABIMismatch, build, oldest)
+	}
+	return found, nil
+}
+
+// parseBuildNumber extracts the build number from a version such as "b6862"
+// or a path such as ".../llama-b6862-bin-ubuntu-x64/libllama.so". It returns
+// 0 when there is none.
+func parseBuildNumber(s string) int {
+	m := buildNumberPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// libraryBuild guesses the build number of a library from the version it
+// was requested as and from its path, falling back to LlamaCppBuild.
+func libraryBuild(version, path string) int {
+	if n := parseBuildNumber(version); n > 0 {
+		return n
+	}
+	if n := parseBuildNumber(path); n > 0 {
+		return n
+	}
+	return parseBuildNumber(LlamaCppBuild)
+}
+
+// currentLayout returns the layout of the loaded library, or the layout of
+// LlamaCppBuild before a library is loaded.
+func currentLayout() *structLayout {
+	if activeLayout != nil {
+		return activeLayout
+	}
+	if l, err := layoutForBuild(parseBuildNumber(LlamaCppBuild)); err == nil {
+		return l
+	}
+	return structLayouts[len(structLayouts)-1]
+}
+
+// usePuregoStructs reports whether struct-by-value calls go through purego
+// rather than libffi. purego passes the Go structs as they are, so this is
+// only possible on Darwin with a native layout.
+func usePuregoStructs() bool {
+	return runtime.GOOS == "darwin" && currentLayout().native
+}
+
+// ffiTypeSize returns the C size and alignment of t.
+func ffiTypeSize(t *ffi.Type) (uintptr, uintptr, error) {
+	if t.Size == 0 {
+		var cif ffi.Cif
+		if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 0, t); status != ffi.OK {
+			return 0, 0, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+		}
+	}
+	return uintptr(t.Size), uintptr(t.Alignment), nil
+}
+
+// newStructBuffer returns zeroed, 8-byte aligned memory for a value of t.
+func newStructBuffer(t *ffi.Type) (unsafe.Pointer, error) {
+	size, _, err := ffiTypeSize(t)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]uint64, (size+7)/8)
+	return unsafe.Pointer(&words[0]), nil
+}
@@ -0,0 +1,75 @@
+package gollama
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ParamsLayoutSuite struct{ BaseSuite }
+
+func (s *ParamsLayoutSuite) TestParseBuildNumber() {
+	s.Equal(6862, parseBuildNumber("b6862"))
+	s.Equal(7990, parseBuildNumber("/cache/llama-b7990-bin-ubuntu-x64/build/bin/libllama.so"))
+	s.Equal(0, parseBuildNumber("/usr/lib/libllama.so"))
+	s.Equal(0, parseBuildNumber("latest"))
+}
+
+func (s *ParamsLayoutSuite) TestLibraryBuild() {
+	s.Equal(7000, libraryBuild("b7000", "/cache/llama-b6862-bin/libllama.so"))
+	s.Equal(6900, libraryBuild("", "/cache/llama-b6900-bin/libllama.so"))
+	s.Equal(parseBuildNumber(LlamaCppBuild), libraryBuild("", "/usr/lib/libllama.so"))
+}
+
+func (s *ParamsLayoutSuite) TestLayoutSelection() {
+	saved := structLayouts
+	defer func() { structLayouts = saved }()
+
+	newer := &structLayout{build: 9000}
+	registerStructLayout(newer)
+
+	l, err := layoutForBuild(6862)
+	s.Require().NoError(err)
+	s.Equal(6862, l.build)
+
+	l, err = layoutForBuild(8999)
+	s.Require().NoError(err)
+	s.Equal(6862, l.build)
+
+	l, err = layoutForBuild(9500)
+	s.Require().NoError(err)
+	s.Same(newer, l)
+
+	_, err = layoutForBuild(4000)
+	s.ErrorIs(err, ErrABIMismatch)
+}
+
+func (s *ParamsLayoutSuite) TestBundledLayoutIsNative() {
+	l := currentLayout()
+	s.True(l.native)
+	size, _, err := ffiTypeSize(l.contextParams)
+	s.Require().NoError(err)
+	s.Equal(unsafe.Sizeof(LlamaContextParams{}), size)
+	size, _, err = ffiTypeSize(l.modelParams)
+	s.Require().NoError(err)
+	s.Equal(unsafe.Sizeof(LlamaModelParams{}), size)
+}
+
+func (s *ParamsLayoutSuite) TestEncodeRoundTrip() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	params := Context_default_params()
+	params.NCtx = 4096
+	params.NSeqMax = 4
+	params.KvUnified = 1
+
+	buf, err := ffiEncodeContextParams(params)
+	s.Require().NoError(err)
+	s.Equal(params, currentLayout().decodeContextParams(buf))
+}
+
+func TestParamsLayoutSuite(t *testing.T) {
+	suite.Run(t, new(ParamsLayoutSuite))
+}
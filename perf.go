@@ -0,0 +1,157 @@
+package gollama
+
+import "fmt"
+
+// LlamaPerfContextData mirrors struct llama_perf_context_data.
+type LlamaPerfContextData struct {
+	TStartMs float64 // absolute start time
+	TLoadMs  float64 // time needed for loading the model
+	TPEvalMs float64 // time needed for processing the prompt
+	TEvalMs  float64 // time needed for generating tokens
+	NPEval   int32   // number of prompt tokens
+	NEval    int32   // number of generated tokens
+	NReused  int32   // number of times a ggml compute graph had been reused
+}
+
+// LlamaPerfSamplerData mirrors struct llama_perf_sampler_data.
+type LlamaPerfSamplerData struct {
+	TSampleMs float64 // time needed for sampling
+	NSample   int32   // number of sampled tokens
+}
+
+// PerfStats summarizes the timings of a context in the units most callers
+// report: milliseconds and tokens per second.
+type PerfStats struct {
+	LoadMs       float64 `json:"load_ms"`
+	PromptEvalMs float64 `json:"prompt_eval_ms"`
+	EvalMs       float64 `json:"eval_ms"`
+
+	PromptTokens int32 `json:"prompt_tokens"`
+	EvalTokens   int32 `json:"eval_tokens"`
+	GraphReuses  int32 `json:"graph_reuses"`
+
+	// PromptTokensPerSecond and TokensPerSecond are 0 when nothing was timed.
+	PromptTokensPerSecond float64 `json:"prompt_tokens_per_second"`
+	TokensPerSecond       float64 `json:"tokens_per_second"`
+}
+
+// String formats the stats like llama_perf_context_print.
+func (p PerfStats) String() string {
+	return fmt.Sprintf("load %.2f ms | prompt eval %.2f ms / %d tokens (%.2f tokens/s) | eval %.2f ms / %d tokens (%.2f tokens/s)",
+		p.LoadMs, p.PromptEvalMs, p.PromptTokens, p.PromptTokensPerSecond, p.EvalMs, p.EvalTokens, p.TokensPerSecond)
+}
+
+// Perf returns the timings collected by ctx since it was created or last
+// reset with Perf_context_reset. Contexts created with NoPerf set report
+// zero timings.
+//
+// Example usage:
+//
+//	stats, err := gollama.Perf(ctx)
+//	if err == nil {
+//		fmt.Printf("%.1f tokens/s\n", stats.TokensPerSecond)
+//	}
+func Perf(ctx LlamaContext) (PerfStats, error) {
+	if ctx == 0 {
+		return PerfStats{}, ErrContextNotCreated
+	}
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return PerfStats{}, err
+	}
+	data, err := Perf_context(ctx)
+	if err != nil {
+		return PerfStats{}, err
+	}
+	return perfStatsFromData(data), nil
+}
+
+func perfStatsFromData(data LlamaPerfContextData) PerfStats {
+	return PerfStats{
+		LoadMs:                data.TLoadMs,
+		PromptEvalMs:          data.TPEvalMs,
+		EvalMs:                data.TEvalMs,
+		PromptTokens:          data.NPEval,
+		EvalTokens:            data.NEval,
+		GraphReuses:           data.NReused,
+		PromptTokensPerSecond: tokensPerSecond(data.NPEval, data.TPEvalMs),
+		TokensPerSecond:       tokensPerSecond(data.NEval, data.TEvalMs),
+	}
+}
+
+func tokensPerSecond(n int32, ms float64) float64 {
+	if n <= 0 || ms <= 0 {
+		return 0
+	}
+	return float64(n) * 1000 / ms
+}
+
+// Perf_context returns the raw llama_perf_context data for ctx.
+func Perf_context(ctx LlamaContext) (LlamaPerfContextData, error) {
+	if err := ensureLoaded(); err != nil {
+		return LlamaPerfContextData{}, err
+	}
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return LlamaPerfContextData{}, err
+	}
+	return ffiPerfContext(ctx)
+}
+
+// Perf_context_print logs the context timings through the llama.cpp logger.
+func Perf_context_print(ctx LlamaContext) {
+	if err := ensureLoaded(); err != nil {
+		return
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) || llamaPerfContextPrint == nil {
+		return
+	}
+	llamaPerfContextPrint(ctx)
+}
+
+// Perf_context_reset clears the timings collected by ctx.
+func Perf_context_reset(ctx LlamaContext) {
+	if err := ensureLoaded(); err != nil {
+		return
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) || llamaPerfContextReset == nil {
+		return
+	}
+	llamaPerfContextReset(ctx)
+}
+
+// Perf_sampler returns the sampling timings of chain. chain must be a sampler
+// chain created with Sampler_chain_init; llama.cpp aborts on other samplers.
+func Perf_sampler(chain LlamaSampler) (LlamaPerfSamplerData, error) {
+	if err := ensureLoaded(); err != nil {
+		return LlamaPerfSamplerData{}, err
+	}
+	if chain == 0 {
+		return LlamaPerfSamplerData{}, fmt.Errorf("%w: nil sampler chain", ErrInvalidParameter)
+	}
+	if err := checkHandle(handleSampler, uintptr(chain)); err != nil {
+		return LlamaPerfSamplerData{}, err
+	}
+	return ffiPerfSampler(chain)
+}
+
+// Perf_sampler_print logs the sampling timings of chain through the llama.cpp
+// logger.
+func Perf_sampler_print(chain LlamaSampler) {
+	if err := ensureLoaded(); err != nil {
+		return
+	}
+	if chain == 0 || handleClosed(handleSampler, uintptr(chain)) || llamaPerfSamplerPrint == nil {
+		return
+	}
+	llamaPerfSamplerPrint(chain)
+}
+
+// Perf_sampler_reset clears the sampling timings of chain.
+func Perf_sampler_reset(chain LlamaSampler) {
+	if err := ensureLoaded(); err != nil {
+		return
+	}
+	if chain == 0 || handleClosed(handleSampler, uintptr(chain)) || llamaPerfSamplerReset == nil {
+		return
+	}
+	llamaPerfSamplerReset(chain)
+}
@@ -0,0 +1,56 @@
+package gollama
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PerfSuite struct{ BaseSuite }
+
+func (s *PerfSuite) TestStructLayout() {
+	s.Equal(uintptr(48), unsafe.Sizeof(LlamaPerfContextData{}))
+	s.Equal(uintptr(16), unsafe.Sizeof(LlamaPerfSamplerData{}))
+}
+
+func (s *PerfSuite) TestStatsFromData() {
+	stats := perfStatsFromData(LlamaPerfContextData{
+		TLoadMs:  120,
+		TPEvalMs: 500,
+		TEvalMs:  2000,
+		NPEval:   100,
+		NEval:    50,
+	})
+	s.InDelta(200.0, stats.PromptTokensPerSecond, 1e-9)
+	s.InDelta(25.0, stats.TokensPerSecond, 1e-9)
+	s.Equal(int32(50), stats.EvalTokens)
+	s.Contains(stats.String(), "25.00 tokens/s")
+
+	s.Zero(perfStatsFromData(LlamaPerfContextData{}).TokensPerSecond)
+}
+
+func (s *PerfSuite) TestPerfRejectsNilContext() {
+	_, err := Perf(0)
+	s.ErrorIs(err, ErrContextNotCreated)
+	_, err = Perf_sampler(0)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *PerfSuite) TestSamplerChainPerf() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	chain := Sampler_chain_init(Sampler_chain_default_params())
+	if chain == 0 {
+		s.T().Skip("sampler chain not available")
+	}
+	defer llamaSamplerChainFree(chain)
+
+	data, err := Perf_sampler(chain)
+	s.Require().NoError(err)
+	s.Equal(int32(0), data.NSample)
+	Perf_sampler_reset(chain)
+}
+
+func TestPerfSuite(t *testing.T) { suite.Run(t, new(PerfSuite)) }
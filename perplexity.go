@@ -0,0 +1,106 @@
+package gollama
+
+import (
+	"fmt"
+	"math"
+)
+
+// Perplexity returns the perplexity of model on text, the exponential of
+// the mean negative log-likelihood of its tokens, as llama.cpp's
+// llama-perplexity computes it to compare quantizations and settings:
+// lower is better.
+//
+// Texts longer than the context are evaluated with a sliding window of
+// ctx.NCtx tokens moved by stride tokens. Every token but the first is
+// scored once; outside the first window it is predicted from at least
+// NCtx-stride tokens of context, so a stride of NCtx leaves the first token
+// of every window unscored. A stride of 0 or less uses half the context.
+// Smaller strides give every token more context, and a lower perplexity,
+// at the cost of more decoding.
+//
+// ctx must be a context of model with logits enabled (not an embeddings
+// context); its memory is cleared.
+//
+// Example usage:
+//
+//	ppl, err := gollama.Perplexity(ctx, model, text, 0)
+//	fmt.Printf("PPL = %.4f\n", ppl)
+func Perplexity(ctx *Context, model *Model, text string, stride int) (float64, error) {
+	if ctx == nil || ctx.handle == 0 {
+		return 0, ErrContextNotCreated
+	}
+	if model == nil || model.Handle() == 0 {
+		return 0, ErrModelNotLoaded
+	}
+	nCtx := int(ctx.NCtx)
+	if stride <= 0 {
+		stride = nCtx / 2
+	}
+	if stride < 1 || stride > nCtx {
+		return 0, fmt.Errorf("%w: stride %d for a context of %d tokens", ErrInvalidParameter, stride, nCtx)
+	}
+	tokens, err := model.Tokenize(text, model.AddBOS, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(tokens) < 2 {
+		return 0, fmt.Errorf("%w: text of %d tokens, at least 2 are needed", ErrInvalidParameter, len(tokens))
+	}
+
+	batch, err := NewTokenBatch(min(int32(nCtx), ctx.NBatch), 1)
+	if err != nil {
+		return 0, err
+	}
+	defer batch.Free()
+
+	var nll float64
+	var count int
+	seq := []LlamaSeqId{0}
+	for _, w := range perplexityWindows(len(tokens), nCtx, stride) {
+		ctx.ClearMemory(false)
+		for start := w.begin; start < w.end; start += batch.Cap() {
+			end := min(start+batch.Cap(), w.end)
+			batch.Clear()
+			for i := start; i < end; i++ {
+				// The logits of token i predict token i+1
+				scored := i+1 >= w.from && i+1 < w.end
+				if err := batch.Add(tokens[i], LlamaPos(i-w.begin), seq, scored); err != nil {
+					return 0, err
+				}
+			}
+			if err := Decode(ctx.handle, batch.Batch()); err != nil {
+				return 0, fmt.Errorf("decoding tokens %d-%d: %w", start, end, err)
+			}
+			for i := max(start, w.from-1); i < end && i+1 < w.end; i++ {
+				logits := ctx.Logits(int32(i - start))
+				if len(logits) == 0 {
+					return 0, fmt.Errorf("%w: no logits for token %d", ErrInvalidParameter, i)
+				}
+				nll += float64(logSumExp(logits) - logits[tokens[i+1]])
+				count++
+			}
+		}
+	}
+	return math.Exp(nll / float64(count)), nil
+}
+
+// perplexityWindow is a span [begin, end) of tokens decoded together whose
+// tokens from `from` on are scored.
+type perplexityWindow struct {
+	begin, end, from int
+}
+
+// perplexityWindows returns the windows of nCtx tokens, moved by stride,
+// that score every token of n but the first exactly once.
+func perplexityWindows(n, nCtx, stride int) []perplexityWindow {
+	var windows []perplexityWindow
+	prevEnd := 0
+	for begin := 0; ; begin += stride {
+		end := min(begin+nCtx, n)
+		windows = append(windows, perplexityWindow{begin: begin, end: end, from: max(prevEnd, begin+1)})
+		prevEnd = end
+		if end == n {
+			return windows
+		}
+	}
+}
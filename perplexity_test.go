@@ -0,0 +1,43 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PerplexitySuite struct{ BaseSuite }
+
+func (s *PerplexitySuite) TestWindowsScoreEveryTokenOnce() {
+	s.Equal([]perplexityWindow{{0, 4, 1}, {2, 6, 4}, {4, 8, 6}, {6, 10, 8}}, perplexityWindows(10, 4, 2))
+	s.Equal([]perplexityWindow{{0, 3, 1}}, perplexityWindows(3, 8, 4))
+	// Non-overlapping windows cannot score their first token
+	s.Equal([]perplexityWindow{{0, 4, 1}, {4, 8, 5}, {8, 9, 9}}, perplexityWindows(9, 4, 4))
+
+	for _, c := range []struct{ n, nCtx, stride int }{{100, 16, 1}, {100, 16, 7}, {100, 16, 16}, {17, 16, 8}} {
+		scored := make([]int, c.n)
+		for _, w := range perplexityWindows(c.n, c.nCtx, c.stride) {
+			s.LessOrEqual(w.end-w.begin, c.nCtx)
+			for j := w.from; j < w.end; j++ {
+				scored[j]++
+			}
+		}
+		s.Zero(scored[0])
+		for j := 1; j < c.n; j++ {
+			if c.stride < c.nCtx || j%c.nCtx != 0 {
+				s.Equal(1, scored[j], "token %d of %+v", j, c)
+			}
+		}
+	}
+}
+
+func (s *PerplexitySuite) TestRequiresContextAndModel() {
+	_, err := Perplexity(nil, nil, "text", 0)
+	s.ErrorIs(err, ErrContextNotCreated)
+	_, err = Perplexity(&Context{handle: 1, NCtx: 8}, nil, "text", 0)
+	s.ErrorIs(err, ErrModelNotLoaded)
+}
+
+func TestPerplexitySuite(t *testing.T) {
+	suite.Run(t, new(PerplexitySuite))
+}
@@ -3,12 +3,106 @@
 package gollama
 
 import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
 	"github.com/ebitengine/purego"
 )
 
-// loadLibraryPlatform loads a shared library using platform-specific methods
+// loadedSoHandles holds the main library and the ggml libraries preloaded
+// from its directory, searched in that order for symbols the main library
+// does not resolve.
+var (
+	loadedSoMu      sync.Mutex
+	loadedSoHandles []uintptr
+)
+
+// addLoadedHandle saves a loaded library handle for later symbol lookup.
+func addLoadedHandle(h uintptr) {
+	loadedSoMu.Lock()
+	defer loadedSoMu.Unlock()
+	for _, existing := range loadedSoHandles {
+		if existing == h {
+			return
+		}
+	}
+	loadedSoHandles = append(loadedSoHandles, h)
+}
+
+// loadLibraryPlatform loads a shared library using platform-specific methods.
+// Newer llama.cpp builds split ggml into libggml-base, libggml-cpu, backend
+// libraries and libggml; they are loaded first from the same directory with
+// RTLD_GLOBAL, so libllama resolves against them even when its RPATH does not
+// point there, and their symbols are searched by registerLibFunc.
 func loadLibraryPlatform(libPath string) (uintptr, error) {
-	return purego.Dlopen(libPath, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	preloadSiblingLibs(filepath.Dir(libPath), filepath.Base(libPath))
+	handle, err := purego.Dlopen(libPath, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+	if err != nil {
+		return 0, err
+	}
+	// The most recently loaded main library is searched first
+	loadedSoMu.Lock()
+	handles := []uintptr{handle}
+	for _, h := range loadedSoHandles {
+		if h != handle {
+			handles = append(handles, h)
+		}
+	}
+	loadedSoHandles = handles
+	loadedSoMu.Unlock()
+	return handle, nil
+}
+
+// preloadSiblingLibs loads the ggml libraries found in dir, in dependency
+// order, skipping self. Libraries that fail to load are skipped: the main
+// library load reports what is really missing.
+func preloadSiblingLibs(dir, self string) {
+	ext := ".so"
+	if runtime.GOOS == "darwin" {
+		ext = ".dylib"
+	}
+	for _, name := range ggmlSiblingLibs {
+		name += ext
+		path := filepath.Join(dir, name)
+		if name == self {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		h, err := purego.Dlopen(path, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+		if err != nil {
+			slog.Debug("preloadSiblingLibs: failed to load library", "path", path, "error", err)
+			continue
+		}
+		addLoadedHandle(h)
+		slog.Debug("preloadSiblingLibs: loaded library", "path", path, "handle", fmt.Sprintf("0x%x", h))
+	}
+}
+
+// findSymbolHandle returns the handle that exports name: handle itself, or
+// one of the libraries loaded next to it.
+func findSymbolHandle(handle uintptr, name string) (uintptr, error) {
+	_, err := purego.Dlsym(handle, name)
+	if err == nil {
+		return handle, nil
+	}
+	loadedSoMu.Lock()
+	handles := append([]uintptr(nil), loadedSoHandles...)
+	loadedSoMu.Unlock()
+	for _, h := range handles {
+		if h == 0 || h == handle {
+			continue
+		}
+		if _, err := purego.Dlsym(h, name); err == nil {
+			return h, nil
+		}
+	}
+	return 0, err
 }
 
 // closeLibraryPlatform closes a shared library using platform-specific methods
@@ -16,8 +110,12 @@ func closeLibraryPlatform(handle uintptr) error {
 	return purego.Dlclose(handle)
 }
 
-// registerLibFunc registers a library function using platform-specific methods
+// registerLibFunc registers a library function using platform-specific methods.
+// Symbols missing from handle are looked up in the sibling ggml libraries.
 func registerLibFunc(fptr interface{}, handle uintptr, fname string) {
+	if h, err := findSymbolHandle(handle, fname); err == nil {
+		handle = h
+	}
 	purego.RegisterLibFunc(fptr, handle, fname)
 }
 
@@ -25,18 +123,23 @@ func registerLibFunc(fptr interface{}, handle uintptr, fname string) {
 // This is useful for optional functions that may not exist in all library builds
 func tryRegisterLibFunc(fptr interface{}, handle uintptr, fname string) error {
 	// First check if the symbol exists
-	_, err := purego.Dlsym(handle, fname)
+	h, err := findSymbolHandle(handle, fname)
 	if err != nil {
 		return err
 	}
 	// If it exists, register it
-	purego.RegisterLibFunc(fptr, handle, fname)
+	purego.RegisterLibFunc(fptr, h, fname)
 	return nil
 }
 
-// getProcAddressPlatform gets the address of a symbol in a loaded library
+// getProcAddressPlatform gets the address of a symbol in a loaded library or
+// its sibling ggml libraries
 func getProcAddressPlatform(handle uintptr, name string) (uintptr, error) {
-	return purego.Dlsym(handle, name)
+	h, err := findSymbolHandle(handle, name)
+	if err != nil {
+		return 0, err
+	}
+	return purego.Dlsym(h, name)
 }
 
 // isPlatformSupported returns whether the current platform is supported
@@ -49,7 +152,46 @@ func getPlatformError() error {
 	return nil
 }
 
-// clearLoadedDllHandles is a no-op on Unix platforms (only used on Windows)
+// clearLoadedDllHandles clears the registry of loaded library handles
+// This should be called when unloading the library to avoid stale handles
 func clearLoadedDllHandles() {
-	// No-op: Unix platforms don't maintain a sibling DLL registry
+	loadedSoMu.Lock()
+	defer loadedSoMu.Unlock()
+	loadedSoHandles = nil
+}
+
+// systemCacheBaseDir returns the machine-wide cache root. Unix platforms have
+// no service-profile restrictions, so the per-user cache is always used.
+func systemCacheBaseDir() string {
+	return ""
+}
+
+// longPath is a no-op on Unix platforms (only used on Windows)
+func longPath(path string) string {
+	return path
+}
+
+// newProgressCallback creates the native llama_progress_callback trampoline.
+func newProgressCallback() (uintptr, error) {
+	return purego.NewCallback(func(progress float32, userData uintptr) bool {
+		return dispatchProgress(userData, progress)
+	}), nil
+}
+
+// newAbortCallback creates the native ggml_abort_callback trampoline.
+func newAbortCallback() (uintptr, error) {
+	return purego.NewCallback(func(data uintptr) bool {
+		return dispatchAbort(data)
+	}), nil
+}
+
+// probeLibraryPlatform reports whether the system loader can open a library
+// by name; the library is closed again right away.
+func probeLibraryPlatform(name string) bool {
+	handle, err := purego.Dlopen(name, purego.RTLD_NOW|purego.RTLD_LOCAL)
+	if err != nil {
+		return false
+	}
+	_ = purego.Dlclose(handle)
+	return true
 }
@@ -0,0 +1,68 @@
+//go:build !windows
+
+package gollama
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type UnixLoaderSuite struct{ BaseSuite }
+
+// bundledLibrary returns the libllama shipped in ./libs for this platform.
+func (s *UnixLoaderSuite) bundledLibrary() string {
+	ext := ".so"
+	if runtime.GOOS == "darwin" {
+		ext = ".dylib"
+	}
+	matches, _ := filepath.Glob(filepath.Join("libs", runtime.GOOS+"_"+runtime.GOARCH+"_*", "libllama"+ext))
+	if len(matches) == 0 {
+		s.T().Skip("no bundled library for this platform")
+	}
+	path, err := filepath.Abs(matches[0])
+	s.Require().NoError(err)
+	return path
+}
+
+func (s *UnixLoaderSuite) TestPreloadsSiblingLibraries() {
+	path := s.bundledLibrary()
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "libggml-base"+filepath.Ext(path))); err != nil {
+		s.T().Skip("library is not split into ggml shared objects")
+	}
+	handle, err := loadLibraryPlatform(path)
+	s.Require().NoError(err)
+
+	loadedSoMu.Lock()
+	handles := append([]uintptr(nil), loadedSoHandles...)
+	loadedSoMu.Unlock()
+	s.Require().NotEmpty(handles)
+	s.Equal(handle, handles[0])
+	s.Greater(len(handles), 1)
+
+	h, err := findSymbolHandle(handle, "ggml_backend_dev_count")
+	s.NoError(err)
+	s.NotZero(h)
+	addr, err := getProcAddressPlatform(handle, "ggml_type_size")
+	s.NoError(err)
+	s.NotZero(addr)
+
+	_, err = findSymbolHandle(handle, "gollama_no_such_symbol")
+	s.Error(err)
+	var fn func()
+	s.Error(tryRegisterLibFunc(&fn, handle, "gollama_no_such_symbol"))
+}
+
+func (s *UnixLoaderSuite) TestClearLoadedHandles() {
+	addLoadedHandle(0x1234)
+	addLoadedHandle(0x1234)
+	clearLoadedDllHandles()
+	loadedSoMu.Lock()
+	defer loadedSoMu.Unlock()
+	s.Empty(loadedSoHandles)
+}
+
+func TestUnixLoaderSuite(t *testing.T) { suite.Run(t, new(UnixLoaderSuite)) }
@@ -8,7 +8,9 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"syscall"
+	"unicode/utf16"
 	"unsafe"
 
 	"github.com/ebitengine/purego"
@@ -85,7 +87,7 @@ func loadLibraryPlatform(libPath string) (uintptr, error) {
 	}
 
 	if procAddDllDirectory.Find() == nil {
-		pathPtr, err := syscall.UTF16PtrFromString(dir)
+		pathPtr, err := syscall.UTF16PtrFromString(longPath(dir))
 		if err == nil {
 			ret, _, callErr := procAddDllDirectory.Call(uintptr(unsafe.Pointer(pathPtr)))
 			if ret != 0 {
@@ -111,7 +113,9 @@ func loadLibraryPlatform(libPath string) (uintptr, error) {
 		}
 	}
 
-	pathPtr, err := syscall.UTF16PtrFromString(libPath)
+	// LoadLibrary* fail with ERROR_FILE_NOT_FOUND beyond MAX_PATH unless the
+	// path is in extended-length form
+	pathPtr, err := syscall.UTF16PtrFromString(longPath(libPath))
 	if err != nil {
 		// Best-effort cleanup
 		if addedDir && procRemoveDllDirectory.Find() == nil {
@@ -275,7 +279,7 @@ func preloadSiblingDlls(dir string, mainHandle uintptr) {
 
 // loadOneDll loads a single DLL by absolute path using LoadLibraryExW with safe flags
 func loadOneDll(path string) (uintptr, error) {
-	p, err := syscall.UTF16PtrFromString(path)
+	p, err := syscall.UTF16PtrFromString(longPath(path))
 	if err != nil {
 		slog.Debug("loadOneDll: failed to convert path", "path", path, "error", err)
 		return 0, err
@@ -513,3 +517,74 @@ func isPlatformSupported() bool {
 func getPlatformError() error {
 	return nil
 }
+
+// maxShortPath is the longest path (in characters) that the classic Win32 APIs
+// accept for directories: MAX_PATH (260) minus room for an 8.3 file name.
+const maxShortPath = 248
+
+// systemCacheBaseDir returns %ProgramData% (usually C:\ProgramData), which is
+// writable by services and scheduled tasks that run without a loaded user profile.
+func systemCacheBaseDir() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("ALLUSERSPROFILE"); dir != "" {
+		return dir
+	}
+	if drive := os.Getenv("SystemDrive"); drive != "" {
+		return drive + `\ProgramData`
+	}
+	return ""
+}
+
+// longPath converts path to an extended-length (\\?\) path when it would exceed
+// MAX_PATH, so deeply nested archive entries can be extracted into the cache
+// and libraries loaded from it. The limit counts UTF-16 code units, as the
+// Win32 APIs do, so non-ASCII user names do not trigger it early.
+func longPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) || utf16Len(path) < maxShortPath {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// UNC share: \\server\share -> \\?\UNC\server\share
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// utf16Len returns the length of s in UTF-16 code units.
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// newProgressCallback is unavailable on Windows: syscall callbacks only receive
+// integer arguments, and llama_progress_callback passes progress as a float.
+func newProgressCallback() (uintptr, error) {
+	return 0, fmt.Errorf("%w: model load progress callbacks", ErrUnsupportedPlatform)
+}
+
+// newAbortCallback creates the native ggml_abort_callback trampoline; the C
+// bool result is returned in the low byte of the integer result.
+func newAbortCallback() (uintptr, error) {
+	return syscall.NewCallback(func(data uintptr) uintptr {
+		if dispatchAbort(data) {
+			return 1
+		}
+		return 0
+	}), nil
+}
+
+// probeLibraryPlatform reports whether the system loader can open a DLL by
+// name; the DLL is freed again right away.
+func probeLibraryPlatform(name string) bool {
+	handle, err := syscall.LoadLibrary(name)
+	if err != nil {
+		return false
+	}
+	_ = syscall.FreeLibrary(handle)
+	return true
+}
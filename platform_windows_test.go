@@ -0,0 +1,44 @@
+//go:build windows
+
+package gollama
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WindowsPathSuite struct{ BaseSuite }
+
+func (s *WindowsPathSuite) TestShortPathUnchanged() {
+	s.Equal(`C:\Users\Jürgen\AppData\Local\gollama\libs`, longPath(`C:\Users\Jürgen\AppData\Local\gollama\libs`))
+	s.Equal(`\\?\C:\already\extended`, longPath(`\\?\C:\already\extended`))
+}
+
+func (s *WindowsPathSuite) TestLongPathExtended() {
+	long := `C:\Users\` + strings.Repeat(`nested\`, 40) + `llama.dll`
+	s.Equal(`\\?\`+long, longPath(long))
+
+	unc := `\\server\share\` + strings.Repeat(`nested\`, 40) + `llama.dll`
+	s.Equal(`\\?\UNC\server\share\`+strings.Repeat(`nested\`, 40)+`llama.dll`, longPath(unc))
+}
+
+func (s *WindowsPathSuite) TestLongPathCountsUTF16Units() {
+	// 200 two-byte runes are 400 bytes but only 200 UTF-16 code units
+	dir := `C:\` + strings.Repeat("ü", 200)
+	s.Equal(203, utf16Len(dir))
+	s.Equal(dir, longPath(dir))
+	// Characters outside the BMP take two code units
+	s.Equal(2, utf16Len("😀"))
+}
+
+func (s *WindowsPathSuite) TestRelativeLongPathIsMadeAbsolute() {
+	rel := strings.Repeat(`nested\`, 40) + `llama.dll`
+	abs, err := filepath.Abs(rel)
+	s.Require().NoError(err)
+	s.Equal(`\\?\`+abs, longPath(rel))
+}
+
+func TestWindowsPathSuite(t *testing.T) { suite.Run(t, new(WindowsPathSuite)) }
@@ -0,0 +1,100 @@
+package gollama
+
+import "sync"
+
+// progressBridge routes llama_progress_callback invocations to Go channels.
+// A single native trampoline is shared by all loads (purego callbacks cannot
+// be freed); the user_data pointer carries the id of the registered channel.
+var progressBridge struct {
+	once     sync.Once
+	callback uintptr
+	err      error
+
+	mu    sync.Mutex
+	next  uintptr
+	chans map[uintptr]chan<- float32
+}
+
+// Model_load_from_file_with_progress loads a model like Model_load_from_file
+// and reports load progress in [0, 1] on progress, which is closed when
+// loading finishes. Updates are sent without blocking, so a slow reader sees
+// fewer of them; use a buffered channel to receive more.
+//
+// On platforms without float callback support (Windows) only the final 1.0
+// is reported.
+//
+// Example usage:
+//
+//	progress := make(chan float32, 16)
+//	go func() {
+//		for p := range progress {
+//			fmt.Printf("\rloading %3.0f%%", p*100)
+//		}
+//	}()
+//	model, err := gollama.Model_load_from_file_with_progress(path, params, progress)
+func Model_load_from_file_with_progress(pathModel string, params LlamaModelParams, progress chan<- float32) (LlamaModel, error) {
+	if progress == nil {
+		return Model_load_from_file(pathModel, params)
+	}
+	defer close(progress)
+
+	cb, id, err := registerProgress(progress)
+	if err != nil {
+		model, err := Model_load_from_file(pathModel, params)
+		if err == nil {
+			sendProgress(progress, 1)
+		}
+		return model, err
+	}
+	defer unregisterProgress(id)
+
+	params.ProgressCallback = cb
+	params.ProgressCallbackUserData = id
+	return Model_load_from_file(pathModel, params)
+}
+
+// registerProgress returns the native trampoline and the user_data id that
+// routes its calls to ch.
+func registerProgress(ch chan<- float32) (uintptr, uintptr, error) {
+	progressBridge.once.Do(func() {
+		progressBridge.callback, progressBridge.err = newProgressCallback()
+	})
+	if progressBridge.err != nil {
+		return 0, 0, progressBridge.err
+	}
+
+	progressBridge.mu.Lock()
+	defer progressBridge.mu.Unlock()
+	if progressBridge.chans == nil {
+		progressBridge.chans = make(map[uintptr]chan<- float32)
+	}
+	progressBridge.next++
+	id := progressBridge.next
+	progressBridge.chans[id] = ch
+	return progressBridge.callback, id, nil
+}
+
+func unregisterProgress(id uintptr) {
+	progressBridge.mu.Lock()
+	defer progressBridge.mu.Unlock()
+	delete(progressBridge.chans, id)
+}
+
+// dispatchProgress forwards a native progress update. It always lets the
+// load continue.
+func dispatchProgress(id uintptr, progress float32) bool {
+	progressBridge.mu.Lock()
+	ch := progressBridge.chans[id]
+	progressBridge.mu.Unlock()
+	if ch != nil {
+		sendProgress(ch, progress)
+	}
+	return true
+}
+
+func sendProgress(ch chan<- float32, progress float32) {
+	select {
+	case ch <- progress:
+	default:
+	}
+}
@@ -0,0 +1,85 @@
+package gollama
+
+import (
+	"os"
+	"testing"
+	"unsafe"
+
+	"github.com/jupiterrider/ffi"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProgressSuite struct{ BaseSuite }
+
+func (s *ProgressSuite) TestDispatchRoutesToRegisteredChannel() {
+	ch := make(chan float32, 2)
+	_, id, err := registerProgress(ch)
+	if err != nil {
+		s.T().Skipf("progress callbacks unavailable: %v", err)
+	}
+
+	s.True(dispatchProgress(id, 0.5))
+	s.Equal(float32(0.5), <-ch)
+
+	unregisterProgress(id)
+	s.True(dispatchProgress(id, 0.75), "unknown ids must not abort loading")
+	s.Empty(ch)
+}
+
+// Calls the trampoline through libffi with the C signature
+// bool (*)(float, void *) to check the float argument arrives intact
+func (s *ProgressSuite) TestNativeTrampolineReceivesFloat() {
+	ch := make(chan float32, 1)
+	cb, id, err := registerProgress(ch)
+	if err != nil {
+		s.T().Skipf("progress callbacks unavailable: %v", err)
+	}
+	defer unregisterProgress(id)
+
+	var cif ffi.Cif
+	s.Require().Equal(ffi.OK, ffi.PrepCif(&cif, ffi.DefaultAbi, 2, &ffi.TypeUint8, &ffi.TypeFloat, &ffi.TypePointer))
+	progress := float32(0.25)
+	var ret uint64
+	ffi.Call(&cif, cb, unsafe.Pointer(&ret), unsafe.Pointer(&progress), unsafe.Pointer(&id))
+
+	s.Equal(float32(0.25), <-ch)
+	s.Equal(uint64(1), ret&0xff, "callback must return true to continue loading")
+}
+
+func (s *ProgressSuite) TestSendDoesNotBlock() {
+	ch := make(chan float32)
+	sendProgress(ch, 0.1)
+}
+
+func (s *ProgressSuite) TestChannelClosedOnFailure() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	progress := make(chan float32, 8)
+	_, err := Model_load_from_file_with_progress("/nonexistent/model.gguf", Model_default_params(), progress)
+	s.Require().Error(err)
+	for range progress {
+	}
+}
+
+func (s *ProgressSuite) TestProgressReachesOne() {
+	modelPath := "./models/tinyllama-1.1b-chat-v1.0.Q2_K.gguf"
+	if _, err := os.Stat(modelPath); err != nil {
+		s.T().Skipf("Model not available at %s", modelPath)
+	}
+	progress := make(chan float32, 4096)
+	params := Model_default_params()
+	params.NGpuLayers = 0
+	model, err := Model_load_from_file_with_progress(modelPath, params, progress)
+	s.Require().NoError(err)
+	defer Model_free(model)
+
+	var last float32
+	for p := range progress {
+		s.GreaterOrEqual(p, last)
+		last = p
+	}
+	s.InDelta(1.0, last, 1e-6)
+}
+
+func TestProgressSuite(t *testing.T) { suite.Run(t, new(ProgressSuite)) }
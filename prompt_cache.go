@@ -0,0 +1,439 @@
+package gollama
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// promptCacheMagic starts every prompt cache file.
+const promptCacheMagic = "GPC1"
+
+// promptCacheExt is the extension of prompt cache files.
+const promptCacheExt = ".gpc"
+
+// PromptCacheOptions configures a PromptCache.
+type PromptCacheOptions struct {
+	// MaxEntries is the maximum number of cached prefixes; 0 means no limit.
+	MaxEntries int
+	// MaxBytes is the maximum total size of the cached states; 0 means no
+	// limit.
+	MaxBytes int64
+	// Dir stores the states as files in this directory. When empty the cache
+	// is kept in memory.
+	Dir string
+	// Namespace is mixed into every key. States are only valid for the model
+	// and context parameters that produced them, so use a different
+	// namespace (for example the model path) for every configuration.
+	Namespace string
+}
+
+// PromptCacheStats reports the activity of a PromptCache.
+type PromptCacheStats struct {
+	Hits      int
+	Misses    int
+	Evictions int
+	Entries   int
+	Bytes     int64
+}
+
+// PromptCache stores the KV cache state of token prefixes, keyed by a hash
+// of the tokens, so that long prompts that share a prefix (typically a
+// system prompt) are decoded only once. States are copied with
+// State_seq_get_data and restored with State_seq_set_data; the least
+// recently used entries are evicted once MaxEntries or MaxBytes is exceeded.
+//
+// Example usage:
+//
+//	cache, err := gollama.NewPromptCache(gollama.PromptCacheOptions{MaxEntries: 16, Namespace: modelPath})
+//	if err != nil {
+//		return err
+//	}
+//	reused, err := cache.Prefill(ctx, 0, tokens)
+//	// tokens[:reused] came from the cache; logits for the last token are ready
+type PromptCache struct {
+	opts PromptCacheOptions
+
+	mu      sync.Mutex
+	lru     *list.List // of *promptCacheEntry, most recent first
+	entries map[string]*list.Element
+	lengths map[int]int // number of entries per prefix length
+	stats   PromptCacheStats
+}
+
+type promptCacheEntry struct {
+	key    string
+	tokens []LlamaToken
+	size   int64
+	data   []byte // in-memory caches only
+}
+
+// NewPromptCache creates a cache. With a Dir, existing cache files in the
+// directory are indexed so that states survive restarts.
+func NewPromptCache(opts PromptCacheOptions) (*PromptCache, error) {
+	if opts.MaxEntries < 0 || opts.MaxBytes < 0 {
+		return nil, fmt.Errorf("%w: MaxEntries and MaxBytes must not be negative", ErrInvalidParameter)
+	}
+	c := &PromptCache{
+		opts:    opts,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		lengths: make(map[int]int),
+	}
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFileWriteFailed, err)
+		}
+		if err := c.scan(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Save stores the state of sequence seqID, which must hold exactly tokens at
+// positions 0..len(tokens)-1.
+func (c *PromptCache) Save(ctx LlamaContext, seqID LlamaSeqId, tokens []LlamaToken) error {
+	if len(tokens) == 0 {
+		return fmt.Errorf("%w: tokens are empty", ErrInvalidParameter)
+	}
+	data, err := State_seq_get_data(ctx, seqID)
+	if err != nil {
+		return err
+	}
+	return c.put(tokens, data)
+}
+
+// Restore loads the state of the longest cached prefix of prompt into
+// sequence seqID, replacing its contents, and returns the number of prompt
+// tokens it covers. The caller decodes prompt[n:] at position n. When the
+// whole prompt is cached the last token is dropped from the sequence again,
+// so that decoding it produces the logits needed for sampling. It returns 0
+// when no prefix is cached.
+func (c *PromptCache) Restore(ctx LlamaContext, seqID LlamaSeqId, prompt []LlamaToken) (int, error) {
+	c.mu.Lock()
+	e := c.lookup(prompt)
+	if e == nil {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return 0, nil
+	}
+	data, err := c.load(e)
+	if err != nil {
+		c.mu.Unlock()
+		return 0, err
+	}
+	c.stats.Hits++
+	n := len(e.tokens)
+	c.mu.Unlock()
+
+	Memory_seq_rm(ctx, seqID, -1, -1)
+	if err := State_seq_set_data(ctx, data, seqID); err != nil {
+		return 0, err
+	}
+	if n == len(prompt) {
+		n--
+		Memory_seq_rm(ctx, seqID, LlamaPos(n), -1)
+	}
+	return n, nil
+}
+
+// Prefill prepares sequence seqID of ctx for generation from prompt: it
+// restores the longest cached prefix, decodes the remaining tokens and
+// caches the state of the whole prompt. It returns the number of tokens
+// taken from the cache.
+func (c *PromptCache) Prefill(ctx *Context, seqID LlamaSeqId, prompt []LlamaToken) (int, error) {
+	if ctx == nil || ctx.Handle() == 0 {
+		return 0, ErrContextNotCreated
+	}
+	if len(prompt) == 0 {
+		return 0, fmt.Errorf("%w: prompt is empty", ErrInvalidParameter)
+	}
+	reused, err := c.Restore(ctx.Handle(), seqID, prompt)
+	if err != nil {
+		return 0, err
+	}
+	if reused == 0 {
+		ctx.SeqRm(seqID, -1, -1)
+	}
+	if err := ctx.DecodeTokens(prompt[reused:], LlamaPos(reused), seqID); err != nil {
+		return reused, err
+	}
+	if !c.Contains(prompt) {
+		if err := c.Save(ctx.Handle(), seqID, prompt); err != nil {
+			return reused, err
+		}
+	}
+	return reused, nil
+}
+
+// Contains reports whether the state of exactly tokens is cached.
+func (c *PromptCache) Contains(tokens []LlamaToken) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[c.key(tokens)]
+	return ok
+}
+
+// Len returns the number of cached prefixes.
+func (c *PromptCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Stats returns a snapshot of the cache statistics.
+func (c *PromptCache) Stats() PromptCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = c.lru.Len()
+	return s
+}
+
+// Clear removes every entry, including its file.
+func (c *PromptCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var firstErr error
+	for c.lru.Len() > 0 {
+		if err := c.remove(c.lru.Back()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// key hashes the namespace and tokens.
+func (c *PromptCache) key(tokens []LlamaToken) string {
+	h := sha256.New()
+	h.Write([]byte(c.opts.Namespace))
+	h.Write([]byte{0})
+	var buf [4]byte
+	for _, tok := range tokens {
+		binary.LittleEndian.PutUint32(buf[:], uint32(tok))
+		h.Write(buf[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// lookup returns the entry of the longest cached prefix of prompt and marks
+// it as recently used.
+func (c *PromptCache) lookup(prompt []LlamaToken) *promptCacheEntry {
+	lengths := make([]int, 0, len(c.lengths))
+	for n := range c.lengths {
+		if n <= len(prompt) {
+			lengths = append(lengths, n)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(lengths)))
+	for _, n := range lengths {
+		el, ok := c.entries[c.key(prompt[:n])]
+		if !ok {
+			continue
+		}
+		e := el.Value.(*promptCacheEntry)
+		if !equalTokens(e.tokens, prompt[:n]) {
+			continue
+		}
+		c.lru.MoveToFront(el)
+		return e
+	}
+	return nil
+}
+
+// put adds or replaces the state of tokens and evicts old entries.
+func (c *PromptCache) put(tokens []LlamaToken, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := c.key(tokens)
+	if el, ok := c.entries[key]; ok {
+		if err := c.remove(el); err != nil {
+			return err
+		}
+	}
+
+	e := &promptCacheEntry{
+		key:    key,
+		tokens: append([]LlamaToken(nil), tokens...),
+		size:   int64(len(data)),
+	}
+	if c.opts.Dir != "" {
+		if err := writePromptCacheFile(c.path(key), e.tokens, data); err != nil {
+			return err
+		}
+	} else {
+		e.data = data
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.lengths[len(e.tokens)]++
+	c.stats.Bytes += e.size
+	return c.evict()
+}
+
+// evict removes least recently used entries until the limits are met. The
+// most recent entry is always kept.
+func (c *PromptCache) evict() error {
+	for c.lru.Len() > 1 {
+		overEntries := c.opts.MaxEntries > 0 && c.lru.Len() > c.opts.MaxEntries
+		overBytes := c.opts.MaxBytes > 0 && c.stats.Bytes > c.opts.MaxBytes
+		if !overEntries && !overBytes {
+			return nil
+		}
+		if err := c.remove(c.lru.Back()); err != nil {
+			return err
+		}
+		c.stats.Evictions++
+	}
+	return nil
+}
+
+// remove drops el from the index and deletes its file.
+func (c *PromptCache) remove(el *list.Element) error {
+	e := c.lru.Remove(el).(*promptCacheEntry)
+	delete(c.entries, e.key)
+	if c.lengths[len(e.tokens)]--; c.lengths[len(e.tokens)] == 0 {
+		delete(c.lengths, len(e.tokens))
+	}
+	c.stats.Bytes -= e.size
+	if c.opts.Dir != "" {
+		if err := os.Remove(c.path(e.key)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%w: %v", ErrFileWriteFailed, err)
+		}
+	}
+	return nil
+}
+
+// load returns the state of e, reading it from disk when needed.
+func (c *PromptCache) load(e *promptCacheEntry) ([]byte, error) {
+	if c.opts.Dir == "" {
+		return e.data, nil
+	}
+	_, data, err := readPromptCacheFile(c.path(e.key), true)
+	return data, err
+}
+
+func (c *PromptCache) path(key string) string {
+	return filepath.Join(c.opts.Dir, key+promptCacheExt)
+}
+
+// scan indexes the cache files in Dir, oldest first so that the most
+// recently written files are the last to be evicted.
+func (c *PromptCache) scan() error {
+	dirEntries, err := os.ReadDir(c.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFileReadFailed, err)
+	}
+	type file struct {
+		name string
+		info os.FileInfo
+	}
+	var files []file
+	for _, de := range dirEntries {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), promptCacheExt) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{de.Name(), info})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].info.ModTime().Before(files[j].info.ModTime()) })
+
+	for _, f := range files {
+		key := strings.TrimSuffix(f.name, promptCacheExt)
+		tokens, _, err := readPromptCacheFile(filepath.Join(c.opts.Dir, f.name), false)
+		if err != nil || c.key(tokens) != key {
+			// Corrupt or from another namespace
+			continue
+		}
+		e := &promptCacheEntry{key: key, tokens: tokens, size: f.info.Size()}
+		c.entries[key] = c.lru.PushFront(e)
+		c.lengths[len(tokens)]++
+		c.stats.Bytes += e.size
+	}
+	return c.evict()
+}
+
+// writePromptCacheFile writes tokens and state atomically to path.
+func writePromptCacheFile(path string, tokens []LlamaToken, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".gpc-*")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFileWriteFailed, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	w.WriteString(promptCacheMagic)
+	binary.Write(w, binary.LittleEndian, uint32(len(tokens)))
+	binary.Write(w, binary.LittleEndian, tokens)
+	w.Write(data)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%w: %v", ErrFileWriteFailed, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("%w: %v", ErrFileWriteFailed, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("%w: %v", ErrFileWriteFailed, err)
+	}
+	return nil
+}
+
+// readPromptCacheFile reads the tokens of a cache file and, when withState
+// is set, the state that follows them.
+func readPromptCacheFile(path string, withState bool) ([]LlamaToken, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrFileReadFailed, err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(promptCacheMagic))
+	var n uint32
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != promptCacheMagic {
+		return nil, nil, fmt.Errorf("%w: %s is not a prompt cache file", ErrInvalidFileFormat, path)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil || n == 0 || n > 1<<24 {
+		return nil, nil, fmt.Errorf("%w: %s has a bad header", ErrInvalidFileFormat, path)
+	}
+	tokens := make([]LlamaToken, n)
+	if err := binary.Read(r, binary.LittleEndian, tokens); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s is truncated", ErrInvalidFileFormat, path)
+	}
+	if !withState {
+		return tokens, nil, nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrFileReadFailed, err)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s has no state", ErrInvalidFileFormat, path)
+	}
+	return tokens, data, nil
+}
+
+func equalTokens(a, b []LlamaToken) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
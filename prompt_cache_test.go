@@ -0,0 +1,102 @@
+package gollama
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PromptCacheSuite struct{ BaseSuite }
+
+func (s *PromptCacheSuite) TestLongestPrefix() {
+	c, err := NewPromptCache(PromptCacheOptions{})
+	s.Require().NoError(err)
+	s.Require().NoError(c.put([]LlamaToken{1, 2}, []byte("short")))
+	s.Require().NoError(c.put([]LlamaToken{1, 2, 3, 4}, []byte("long")))
+	s.Require().NoError(c.put([]LlamaToken{9, 9, 9}, []byte("other")))
+
+	e := c.lookup([]LlamaToken{1, 2, 3, 4, 5})
+	s.Require().NotNil(e)
+	s.Equal([]byte("long"), e.data)
+
+	e = c.lookup([]LlamaToken{1, 2, 3})
+	s.Require().NotNil(e)
+	s.Equal([]byte("short"), e.data)
+
+	s.Nil(c.lookup([]LlamaToken{2, 1}))
+	s.True(c.Contains([]LlamaToken{9, 9, 9}))
+	s.False(c.Contains([]LlamaToken{9, 9}))
+}
+
+func (s *PromptCacheSuite) TestNamespace() {
+	a, _ := NewPromptCache(PromptCacheOptions{Namespace: "a"})
+	b, _ := NewPromptCache(PromptCacheOptions{Namespace: "b"})
+	s.NotEqual(a.key([]LlamaToken{1, 2}), b.key([]LlamaToken{1, 2}))
+	s.Equal(a.key([]LlamaToken{1, 2}), a.key([]LlamaToken{1, 2}))
+}
+
+func (s *PromptCacheSuite) TestEviction() {
+	c, err := NewPromptCache(PromptCacheOptions{MaxEntries: 2})
+	s.Require().NoError(err)
+	s.Require().NoError(c.put([]LlamaToken{1}, []byte("a")))
+	s.Require().NoError(c.put([]LlamaToken{2}, []byte("b")))
+	s.NotNil(c.lookup([]LlamaToken{1})) // 1 becomes most recent
+	s.Require().NoError(c.put([]LlamaToken{3}, []byte("c")))
+
+	s.True(c.Contains([]LlamaToken{1}))
+	s.False(c.Contains([]LlamaToken{2}))
+	s.True(c.Contains([]LlamaToken{3}))
+	s.Equal(1, c.Stats().Evictions)
+
+	bytes, err := NewPromptCache(PromptCacheOptions{MaxBytes: 5})
+	s.Require().NoError(err)
+	s.Require().NoError(bytes.put([]LlamaToken{1}, []byte("abc")))
+	s.Require().NoError(bytes.put([]LlamaToken{2}, []byte("def")))
+	s.Equal(1, bytes.Len())
+	s.Equal(int64(3), bytes.Stats().Bytes)
+}
+
+func (s *PromptCacheSuite) TestDiskPersistence() {
+	dir := s.T().TempDir()
+	c, err := NewPromptCache(PromptCacheOptions{Dir: dir, Namespace: "m"})
+	s.Require().NoError(err)
+	s.Require().NoError(c.put([]LlamaToken{5, 6, 7}, []byte("state")))
+	s.Nil(c.lookup([]LlamaToken{5, 6, 7}).data) // kept on disk only
+
+	// A new cache over the same directory finds the entry
+	reopened, err := NewPromptCache(PromptCacheOptions{Dir: dir, Namespace: "m"})
+	s.Require().NoError(err)
+	e := reopened.lookup([]LlamaToken{5, 6, 7, 8})
+	s.Require().NotNil(e)
+	data, err := reopened.load(e)
+	s.Require().NoError(err)
+	s.Equal([]byte("state"), data)
+
+	// Files from another namespace are ignored
+	other, err := NewPromptCache(PromptCacheOptions{Dir: dir, Namespace: "x"})
+	s.Require().NoError(err)
+	s.Equal(0, other.Len())
+
+	s.Require().NoError(reopened.Clear())
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+promptCacheExt))
+	s.Empty(files)
+}
+
+func (s *PromptCacheSuite) TestCorruptFile() {
+	dir := s.T().TempDir()
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "bad"+promptCacheExt), []byte("nope"), 0o644))
+	c, err := NewPromptCache(PromptCacheOptions{Dir: dir})
+	s.Require().NoError(err)
+	s.Equal(0, c.Len())
+}
+
+func (s *PromptCacheSuite) TestInvalidOptions() {
+	_, err := NewPromptCache(PromptCacheOptions{MaxEntries: -1})
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func TestPromptCacheSuite(t *testing.T) {
+	suite.Run(t, new(PromptCacheSuite))
+}
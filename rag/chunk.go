@@ -0,0 +1,218 @@
+package rag
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+// Chunk is a piece of a document.
+type Chunk struct {
+	// Source identifies the document, e.g. its file name.
+	Source string `json:"source,omitempty"`
+	// Offset is the byte offset of Text in the document.
+	Offset int    `json:"offset"`
+	Text   string `json:"text"`
+	// Tokens is the number of tokens of Text, not counting special tokens,
+	// when the chunk was made by ChunkByTokens.
+	Tokens int `json:"tokens,omitempty"`
+}
+
+// ChunkBySeparator splits text at every occurrence of sep and joins the
+// parts, separators included, into chunks of at least minSize bytes. The
+// last chunk may be shorter; chunks made only of white space are dropped.
+func ChunkBySeparator(text, sep string, minSize int) []Chunk {
+	if sep == "" {
+		sep = "\n"
+	}
+	var chunks []Chunk
+	start := 0
+	for start < len(text) {
+		end := start
+		for {
+			i := strings.Index(text[end:], sep)
+			if i < 0 {
+				end = len(text)
+				break
+			}
+			end += i + len(sep)
+			if end-start >= minSize {
+				break
+			}
+		}
+		if strings.TrimSpace(text[start:end]) != "" {
+			chunks = append(chunks, Chunk{Offset: start, Text: text[start:end]})
+		}
+		start = end
+	}
+	return chunks
+}
+
+// ChunkBySentences groups consecutive sentences into chunks of at most
+// maxSize bytes. A sentence ends with '.', '!' or '?' followed by white
+// space, or with a blank line; a sentence longer than maxSize becomes a
+// chunk of its own. Leading white space is not part of a chunk.
+func ChunkBySentences(text string, maxSize int) []Chunk {
+	var chunks []Chunk
+	cur := Chunk{Offset: -1}
+	flush := func() {
+		if cur.Offset >= 0 {
+			cur.Text = strings.TrimRightFunc(cur.Text, unicode.IsSpace)
+			chunks = append(chunks, cur)
+		}
+		cur = Chunk{Offset: -1}
+	}
+	for _, s := range splitSentences(text) {
+		if cur.Offset >= 0 && s.Offset+len(s.Text)-cur.Offset > maxSize {
+			flush()
+		}
+		if cur.Offset < 0 {
+			cur.Offset = s.Offset
+		}
+		cur.Text = text[cur.Offset : s.Offset+len(s.Text)]
+	}
+	flush()
+	return chunks
+}
+
+// splitSentences returns the sentences of text, skipping the white space
+// between them.
+func splitSentences(text string) []Chunk {
+	var sentences []Chunk
+	start := -1
+	for i, r := range text {
+		if start < 0 {
+			if unicode.IsSpace(r) {
+				continue
+			}
+			start = i
+		}
+		end := i + len(string(r))
+		var next rune
+		if end < len(text) {
+			next = rune(text[end])
+		}
+		boundary := (r == '.' || r == '!' || r == '?') && (end == len(text) || unicode.IsSpace(next)) ||
+			r == '\n' && next == '\n'
+		if boundary {
+			sentences = append(sentences, Chunk{Offset: start, Text: text[start:end]})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		sentences = append(sentences, Chunk{Offset: start, Text: text[start:]})
+	}
+	return sentences
+}
+
+// ChunkByTokens splits text into chunks of at most maxTokens tokens of
+// model, including the special tokens (such as BOS) added when a chunk is
+// embedded, so every chunk fits an embedding context of maxTokens exactly.
+// Consecutive chunks share overlap tokens, which keeps sentences cut at a
+// boundary retrievable from either side. Chunks are split at token
+// boundaries; Offset and Text refer to the original text whenever the
+// tokens' pieces reproduce it, which holds for the usual tokenizers.
+//
+// It returns nil when maxTokens leaves no room for text or text cannot be
+// tokenized.
+//
+// Example usage:
+//
+//	for _, c := range rag.ChunkByTokens(model, text, 512, 64) {
+//		fmt.Printf("%d tokens at byte %d\n", c.Tokens, c.Offset)
+//	}
+func ChunkByTokens(model *gollama.Model, text string, maxTokens, overlap int) []Chunk {
+	if model == nil || maxTokens <= 0 {
+		return nil
+	}
+	tokens, err := model.Tokenize(text, false, false)
+	if err != nil {
+		return nil
+	}
+	pieces := make([]string, len(tokens))
+	for i, t := range tokens {
+		pieces[i] = gollama.Token_to_piece(model.Handle(), t, false)
+	}
+	count := func(s string) int {
+		tokens, err := model.Tokenize(s, true, false)
+		if err != nil {
+			return math.MaxInt
+		}
+		return len(tokens)
+	}
+	return chunkTokens(text, pieces, count, maxTokens, overlap)
+}
+
+// chunkTokens implements ChunkByTokens for text tokenized into pieces;
+// count returns the number of tokens of a chunk as it is embedded.
+func chunkTokens(text string, pieces []string, count func(string) int, maxTokens, overlap int) []Chunk {
+	// Leave room for the special tokens added to every chunk
+	body := maxTokens - count("")
+	if body <= 0 || len(pieces) == 0 {
+		return nil
+	}
+	overlap = max(0, min(overlap, body-1))
+
+	ends, exact := tokenEnds(text, pieces)
+	span := func(start, end int) Chunk {
+		begin := 0
+		if start > 0 {
+			begin = ends[start-1]
+		}
+		if exact {
+			return Chunk{Offset: begin, Text: text[begin:ends[end-1]], Tokens: end - start}
+		}
+		return Chunk{Offset: begin, Text: strings.Join(pieces[start:end], ""), Tokens: end - start}
+	}
+
+	var chunks []Chunk
+	for start := 0; ; {
+		end := min(start+body, len(pieces))
+		c := span(start, end)
+		// Retokenizing a chunk can merge or split tokens at its edges
+		for end-start > 1 && count(c.Text) > maxTokens {
+			end--
+			c = span(start, end)
+		}
+		chunks = append(chunks, c)
+		if end == len(pieces) {
+			return chunks
+		}
+		start = max(end-overlap, start+1)
+	}
+}
+
+// tokenEnds returns the byte offset in text at which each piece ends. When
+// the pieces do not reproduce text, which happens with tokenizers that add
+// a leading space or normalize the text, the offsets are those of the
+// concatenated pieces and exact is false. A leading space added to the
+// first piece is tolerated.
+func tokenEnds(text string, pieces []string) (ends []int, exact bool) {
+	ends = make([]int, len(pieces))
+	pos := 0
+	for i, p := range pieces {
+		switch {
+		case strings.HasPrefix(text[pos:], p):
+			pos += len(p)
+		case i == 0 && strings.HasPrefix(p, " ") && strings.HasPrefix(text, p[1:]):
+			pos += len(p) - 1
+		default:
+			pos = -1
+		}
+		if pos < 0 {
+			break
+		}
+		ends[i] = pos
+	}
+	if pos == len(text) {
+		return ends, true
+	}
+	n := 0
+	for i, p := range pieces {
+		n += len(p)
+		ends[i] = n
+	}
+	return ends, false
+}
@@ -0,0 +1,129 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ChunkSuite struct{ suite.Suite }
+
+// Every chunk must be found at its offset in the text.
+func (s *ChunkSuite) requireOffsets(text string, chunks []Chunk) {
+	for _, c := range chunks {
+		s.Require().True(strings.HasPrefix(text[c.Offset:], c.Text), "chunk %q at %d", c.Text, c.Offset)
+	}
+}
+
+func (s *ChunkSuite) TestChunkBySeparator() {
+	text := "one\ntwo\nthree\n\n\nfour"
+	chunks := ChunkBySeparator(text, "\n", 6)
+	s.requireOffsets(text, chunks)
+	s.Equal([]Chunk{
+		{Offset: 0, Text: "one\ntwo\n"},
+		{Offset: 8, Text: "three\n"},
+		{Offset: 14, Text: "\n\nfour"},
+	}, chunks)
+
+	s.Len(ChunkBySeparator(text, "\n", 0), 4, "blank parts are dropped")
+	s.Equal([]Chunk{{Offset: 0, Text: text}}, ChunkBySeparator(text, "\n", 1000))
+	s.Empty(ChunkBySeparator("", "\n", 10))
+}
+
+func (s *ChunkSuite) TestChunkBySentences() {
+	text := "First one. Second one!  Third, v1.2 is out?\n\nNew paragraph without end"
+	chunks := ChunkBySentences(text, 25)
+	s.requireOffsets(text, chunks)
+	s.Equal([]string{"First one. Second one!", "Third, v1.2 is out?", "New paragraph without end"}, texts(chunks))
+
+	// A sentence longer than the limit is kept whole
+	s.Equal([]string{"First one.", "Second one!"}, texts(ChunkBySentences("First one. Second one!", 5)))
+	s.Empty(ChunkBySentences("  \n ", 10))
+}
+
+func (s *ChunkSuite) TestSplitSentences() {
+	s.Equal([]string{"a.", "b\n", "c"}, texts(splitSentences("a. b\n\nc")))
+	s.Equal([]string{"3.14 is pi."}, texts(splitSentences("3.14 is pi.")))
+}
+
+// wordPieces tokenizes text into words with their leading spaces, like a
+// BPE tokenizer would.
+func wordPieces(text string) []string {
+	var pieces []string
+	start := 0
+	for i := 1; i <= len(text); i++ {
+		if i == len(text) || text[i] == ' ' {
+			pieces = append(pieces, text[start:i])
+			start = i
+		}
+	}
+	return pieces
+}
+
+// countWords counts the words of text plus a BOS token.
+func countWords(text string) int {
+	return len(strings.Fields(text)) + 1
+}
+
+func (s *ChunkSuite) TestChunkTokens() {
+	text := "a bb ccc dd e ff ggg"
+	chunks := chunkTokens(text, wordPieces(text), countWords, 4, 0)
+	s.requireOffsets(text, chunks)
+	s.Equal([]Chunk{
+		{Offset: 0, Text: "a bb ccc", Tokens: 3},
+		{Offset: 8, Text: " dd e ff", Tokens: 3},
+		{Offset: 16, Text: " ggg", Tokens: 1},
+	}, chunks)
+	for _, c := range chunks {
+		s.LessOrEqual(countWords(c.Text), 4)
+	}
+
+	chunks = chunkTokens(text, wordPieces(text), countWords, 4, 1)
+	s.requireOffsets(text, chunks)
+	s.Equal([]string{"a bb ccc", " ccc dd e", " e ff ggg"}, texts(chunks))
+
+	// The overlap is capped so that chunks always advance
+	s.Len(chunkTokens(text, wordPieces(text), countWords, 3, 10), 6)
+
+	s.Nil(chunkTokens(text, wordPieces(text), countWords, 1, 0), "no room besides BOS")
+	s.Nil(chunkTokens("", nil, countWords, 4, 0))
+}
+
+// A chunk whose retokenized text is longer than the limit is shrunk.
+func (s *ChunkSuite) TestChunkTokensRetokenized() {
+	text := "a bb ccc dd"
+	count := func(t string) int { return len(t)/2 + 1 }
+	chunks := chunkTokens(text, wordPieces(text), count, 3, 0)
+	s.requireOffsets(text, chunks)
+	for _, c := range chunks {
+		s.LessOrEqual(count(c.Text), 3, "chunk %q", c.Text)
+	}
+	s.Equal(text, strings.Join(texts(chunks), ""))
+}
+
+func (s *ChunkSuite) TestTokenEnds() {
+	ends, exact := tokenEnds("ab cd", []string{"ab", " cd"})
+	s.True(exact)
+	s.Equal([]int{2, 5}, ends)
+
+	// A leading space added by the tokenizer is skipped
+	ends, exact = tokenEnds("ab cd", []string{" ab", " cd"})
+	s.True(exact)
+	s.Equal([]int{2, 5}, ends)
+
+	// Normalized text falls back to the offsets of the pieces
+	ends, exact = tokenEnds("AB  cd", []string{"ab", " cd"})
+	s.False(exact)
+	s.Equal([]int{2, 5}, ends)
+}
+
+func texts(chunks []Chunk) []string {
+	var out []string
+	for _, c := range chunks {
+		out = append(out, c.Text)
+	}
+	return out
+}
+
+func TestChunkSuite(t *testing.T) { suite.Run(t, new(ChunkSuite)) }
@@ -0,0 +1,264 @@
+package rag
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	gollama "github.com/dianlight/gollama.cpp"
+	"github.com/dianlight/gollama.cpp/internal/simd"
+)
+
+// Result is a chunk found by a query.
+type Result struct {
+	Chunk
+	// Score is the cosine similarity between the chunk and the query.
+	Score float32
+}
+
+// Index is an in-memory VectorStore searched by cosine similarity. Vectors
+// are stored normalized, so a query costs one dot product per chunk. It is
+// safe for concurrent use.
+type Index struct {
+	mu      sync.RWMutex
+	dim     int
+	entries []indexEntry
+}
+
+// indexEntry is a chunk with its normalized embedding.
+type indexEntry struct {
+	Chunk  Chunk
+	Vector []float32
+}
+
+// indexFile is the gob encoding of an Index.
+type indexFile struct {
+	Version int
+	Dim     int
+	Entries []indexEntry
+}
+
+const indexFileVersion = 1
+
+// NewIndex creates an empty index. Its dimension is set by the first Add.
+func NewIndex() *Index {
+	return &Index{}
+}
+
+// Add stores chunks with their embeddings, which are copied and normalized.
+// The chunks of a document can be added in any number of calls and are
+// removed together by Delete.
+func (ix *Index) Add(chunks []Chunk, embeddings [][]float32) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.addLocked(chunks, embeddings)
+}
+
+// Replace removes the chunks of source, like Delete, and adds chunks in a
+// single update; the index is unchanged when the embeddings are invalid.
+func (ix *Index) Replace(source string, chunks []Chunk, embeddings [][]float32) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if err := ix.checkLocked(chunks, embeddings); err != nil {
+		return err
+	}
+	ix.deleteLocked(source)
+	return ix.addLocked(chunks, embeddings)
+}
+
+// checkLocked validates embeddings against chunks and the index dimension.
+func (ix *Index) checkLocked(chunks []Chunk, embeddings [][]float32) error {
+	if len(chunks) != len(embeddings) {
+		return fmt.Errorf("%w: %d chunks, %d embeddings", gollama.ErrInvalidParameter, len(chunks), len(embeddings))
+	}
+	dim := ix.dim
+	for _, e := range embeddings {
+		if dim == 0 {
+			dim = len(e)
+		}
+		if len(e) == 0 || len(e) != dim {
+			return fmt.Errorf("%w: embedding of %d dimensions, index has %d", gollama.ErrInvalidParameter, len(e), dim)
+		}
+	}
+	return nil
+}
+
+func (ix *Index) addLocked(chunks []Chunk, embeddings [][]float32) error {
+	if err := ix.checkLocked(chunks, embeddings); err != nil {
+		return err
+	}
+	for i, c := range chunks {
+		if ix.dim == 0 {
+			ix.dim = len(embeddings[i])
+		}
+		v := append([]float32(nil), embeddings[i]...)
+		Normalize(v)
+		ix.entries = append(ix.entries, indexEntry{Chunk: c, Vector: v})
+	}
+	return nil
+}
+
+// Delete removes every chunk of source and returns how many were removed.
+func (ix *Index) Delete(source string) (int, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.deleteLocked(source), nil
+}
+
+// Persist does nothing: an Index lives in memory. Use Save or FileStore to
+// keep it.
+func (ix *Index) Persist() error {
+	return nil
+}
+
+func (ix *Index) deleteLocked(source string) int {
+	kept := ix.entries[:0]
+	for _, e := range ix.entries {
+		if e.Chunk.Source != source {
+			kept = append(kept, e)
+		}
+	}
+	n := len(ix.entries) - len(kept)
+	clear(ix.entries[len(kept):])
+	ix.entries = kept
+	return n
+}
+
+// Query returns the k chunks most similar to embedding, most similar first.
+func (ix *Index) Query(embedding []float32, k int) ([]Result, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if len(ix.entries) == 0 || k <= 0 {
+		return nil, nil
+	}
+	if len(embedding) != ix.dim {
+		return nil, fmt.Errorf("%w: query of %d dimensions, index has %d", gollama.ErrInvalidParameter, len(embedding), ix.dim)
+	}
+	q := append([]float32(nil), embedding...)
+	Normalize(q)
+
+	h := &resultHeap{}
+	for _, e := range ix.entries {
+		r := Result{Chunk: e.Chunk, Score: dot(e.Vector, q)}
+		if h.Len() < k {
+			heap.Push(h, r)
+		} else if r.Score > (*h)[0].Score {
+			(*h)[0] = r
+			heap.Fix(h, 0)
+		}
+	}
+	out := make([]Result, h.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(h).(Result)
+	}
+	return out, nil
+}
+
+// Len returns the number of chunks in the index.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.entries)
+}
+
+// Dim returns the dimension of the embeddings, or 0 for an empty index.
+func (ix *Index) Dim() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.dim
+}
+
+// Save writes the index to w in gob encoding.
+func (ix *Index) Save(w io.Writer) error {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(indexFile{Version: indexFileVersion, Dim: ix.dim, Entries: ix.entries})
+}
+
+// LoadIndex reads an index written by Save.
+func LoadIndex(r io.Reader) (*Index, error) {
+	var f indexFile
+	if err := gob.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("%w: %v", gollama.ErrInvalidFileFormat, err)
+	}
+	if f.Version != indexFileVersion {
+		return nil, fmt.Errorf("%w: index version %d", gollama.ErrInvalidFileFormat, f.Version)
+	}
+	// Query assumes every vector has the index dimension
+	for i, e := range f.Entries {
+		if len(e.Vector) == 0 || len(e.Vector) != f.Dim {
+			return nil, fmt.Errorf("%w: entry %d has %d dimensions, index has %d", gollama.ErrInvalidFileFormat, i, len(e.Vector), f.Dim)
+		}
+	}
+	return &Index{dim: f.Dim, entries: f.Entries}, nil
+}
+
+// SaveFile writes the index to path atomically.
+func (ix *Index) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".rag-*")
+	if err != nil {
+		return fmt.Errorf("%w: %v", gollama.ErrFileWriteFailed, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := ix.Save(w); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%w: %v", gollama.ErrFileWriteFailed, err)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%w: %v", gollama.ErrFileWriteFailed, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("%w: %v", gollama.ErrFileWriteFailed, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("%w: %v", gollama.ErrFileWriteFailed, err)
+	}
+	return nil
+}
+
+// LoadIndexFile reads an index written by SaveFile.
+func LoadIndexFile(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", gollama.ErrFileReadFailed, err)
+	}
+	defer f.Close()
+	return LoadIndex(bufio.NewReader(f))
+}
+
+// Normalize scales v in place to unit Euclidean length. A zero vector is
+// left unchanged.
+func Normalize(v []float32) {
+	gollama.Normalize(v)
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, or 0
+// when their lengths differ or either is a zero vector.
+func CosineSimilarity(a, b []float32) float32 {
+	return gollama.Similarity(a, b)
+}
+
+func dot(a, b []float32) float32 {
+	return simd.Dot(a, b)
+}
+
+// resultHeap is a min-heap of results ordered by score.
+type resultHeap []Result
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h[i].Score < h[j].Score }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x any)        { *h = append(*h, x.(Result)) }
+func (h *resultHeap) Pop() any {
+	r := (*h)[len(*h)-1]
+	*h = (*h)[:len(*h)-1]
+	return r
+}
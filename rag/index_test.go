@@ -0,0 +1,183 @@
+package rag
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gollama "github.com/dianlight/gollama.cpp"
+	"github.com/stretchr/testify/suite"
+)
+
+type IndexSuite struct{ suite.Suite }
+
+func (s *IndexSuite) newIndex() *Index {
+	ix := NewIndex()
+	s.Require().NoError(ix.Add(
+		[]Chunk{{Source: "a", Text: "x"}, {Source: "a", Text: "y"}, {Source: "b", Text: "xy"}},
+		[][]float32{{2, 0}, {0, 3}, {1, 1}},
+	))
+	return ix
+}
+
+func (s *IndexSuite) TestQuery() {
+	ix := s.newIndex()
+	res, err := ix.Query([]float32{5, 0}, 2)
+	s.Require().NoError(err)
+	s.Require().Len(res, 2)
+	s.Equal("x", res[0].Text)
+	s.InDelta(1, res[0].Score, 1e-6)
+	s.Equal("xy", res[1].Text)
+	s.InDelta(0.7071, res[1].Score, 1e-4)
+
+	res, err = ix.Query([]float32{0, 1}, 10)
+	s.Require().NoError(err)
+	s.Equal([]string{"y", "xy", "x"}, resultTexts(res))
+
+	_, err = ix.Query([]float32{1, 2, 3}, 1)
+	s.ErrorIs(err, gollama.ErrInvalidParameter)
+}
+
+func (s *IndexSuite) TestAddValidates() {
+	ix := s.newIndex()
+	s.ErrorIs(ix.Add([]Chunk{{}}, nil), gollama.ErrInvalidParameter)
+	s.ErrorIs(ix.Add([]Chunk{{}}, [][]float32{{1, 2, 3}}), gollama.ErrInvalidParameter)
+	s.ErrorIs(NewIndex().Add([]Chunk{{}}, [][]float32{{}}), gollama.ErrInvalidParameter)
+	s.Equal(3, ix.Len())
+	s.Equal(2, ix.Dim())
+}
+
+func (s *IndexSuite) TestDeleteAndReplace() {
+	ix := s.newIndex()
+	n, err := ix.Delete("a")
+	s.Require().NoError(err)
+	s.Equal(2, n)
+	n, _ = ix.Delete("a")
+	s.Zero(n)
+	s.Equal(1, ix.Len())
+
+	s.Require().NoError(ix.Replace("b", []Chunk{{Source: "b", Text: "new"}}, [][]float32{{1, 0}}))
+	res, err := ix.Query([]float32{1, 1}, 5)
+	s.Require().NoError(err)
+	s.Equal([]string{"new"}, resultTexts(res))
+
+	s.Error(ix.Replace("b", []Chunk{{Source: "b"}}, [][]float32{{1}}))
+	s.Equal(1, ix.Len(), "a failed replace leaves the index unchanged")
+}
+
+func (s *IndexSuite) TestSaveLoad() {
+	ix := s.newIndex()
+	var buf bytes.Buffer
+	s.Require().NoError(ix.Save(&buf))
+	loaded, err := LoadIndex(&buf)
+	s.Require().NoError(err)
+	s.Equal(ix.Len(), loaded.Len())
+	s.Equal(ix.Dim(), loaded.Dim())
+
+	path := filepath.Join(s.T().TempDir(), "index.gob")
+	s.Require().NoError(ix.SaveFile(path))
+	loaded, err = LoadIndexFile(path)
+	s.Require().NoError(err)
+	res, err := loaded.Query([]float32{0, 1}, 1)
+	s.Require().NoError(err)
+	s.Equal("y", res[0].Text)
+
+	_, err = LoadIndex(strings.NewReader("not gob"))
+	s.ErrorIs(err, gollama.ErrInvalidFileFormat)
+	_, err = LoadIndexFile(filepath.Join(s.T().TempDir(), "missing"))
+	s.ErrorIs(err, gollama.ErrFileReadFailed)
+}
+
+func (s *IndexSuite) TestLoadRejectsBadVectors() {
+	for _, f := range []indexFile{
+		{Version: indexFileVersion, Dim: 2, Entries: []indexEntry{{Vector: []float32{1, 0}}, {Vector: []float32{1, 0, 0}}}},
+		{Version: indexFileVersion, Dim: 2, Entries: []indexEntry{{Vector: nil}}},
+		{Version: indexFileVersion, Dim: 0, Entries: []indexEntry{{Vector: []float32{1}}}},
+	} {
+		var buf bytes.Buffer
+		s.Require().NoError(gob.NewEncoder(&buf).Encode(f))
+		_, err := LoadIndex(&buf)
+		s.ErrorIs(err, gollama.ErrInvalidFileFormat)
+	}
+}
+
+func (s *IndexSuite) TestNormalize() {
+	v := []float32{3, 4}
+	Normalize(v)
+	s.InDeltaSlice([]float32{0.6, 0.8}, v, 1e-6)
+	zero := []float32{0, 0}
+	Normalize(zero)
+	s.Equal([]float32{0, 0}, zero)
+}
+
+func (s *IndexSuite) TestCosineSimilarity() {
+	s.InDelta(1, CosineSimilarity([]float32{1, 2}, []float32{2, 4}), 1e-6)
+	s.InDelta(-1, CosineSimilarity([]float32{1, 0}, []float32{-3, 0}), 1e-6)
+	s.Zero(CosineSimilarity([]float32{1, 0}, []float32{0, 0}))
+	s.Zero(CosineSimilarity([]float32{1}, []float32{1, 0}))
+}
+
+// fakeEmbedder embeds the counts of 'x' and 'y' in the text.
+type fakeEmbedder struct{ fail bool }
+
+func (e fakeEmbedder) Embed(text string) ([]float32, error) {
+	if e.fail {
+		return nil, errors.New("boom")
+	}
+	return []float32{float32(strings.Count(text, "x")), float32(strings.Count(text, "y"))}, nil
+}
+
+// fakeBatchEmbedder records the batches it embeds.
+type fakeBatchEmbedder struct {
+	fakeEmbedder
+	batches *[][]string
+}
+
+func (e fakeBatchEmbedder) EmbedBatch(texts []string, batchTokens int) ([][]float32, error) {
+	*e.batches = append(*e.batches, texts)
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		out[i], _ = e.Embed(t)
+	}
+	return out, nil
+}
+
+func (s *IndexSuite) TestRetrieverBatches() {
+	var batches [][]string
+	r := NewRetriever(fakeBatchEmbedder{batches: &batches}, nil)
+	s.Require().NoError(r.Add("doc", []Chunk{{Text: "x"}, {Text: "y"}}))
+	s.Equal([][]string{{"x", "y"}}, batches)
+	s.Equal(2, r.Store.(*Index).Len())
+}
+
+func (s *IndexSuite) TestRetriever() {
+	r := NewRetriever(fakeEmbedder{}, nil)
+	s.Require().NoError(r.Add("doc", []Chunk{{Offset: 0, Text: "xxx"}, {Offset: 3, Text: "yy"}}))
+	s.Require().NoError(r.Add("doc", []Chunk{{Offset: 0, Text: "xy"}, {Offset: 2, Text: "y"}}))
+	s.Equal(2, r.Store.(*Index).Len(), "adding a document again replaces it")
+
+	res, err := r.Query("yyy", 1)
+	s.Require().NoError(err)
+	s.Equal(Chunk{Source: "doc", Offset: 2, Text: "y"}, res[0].Chunk)
+
+	r.Embedder = fakeEmbedder{fail: true}
+	s.Error(r.Add("other", []Chunk{{Text: "x"}}))
+	_, err = r.Query("x", 1)
+	s.Error(err)
+	n, err := r.Delete("doc")
+	s.Require().NoError(err)
+	s.Equal(2, n)
+}
+
+func resultTexts(res []Result) []string {
+	var out []string
+	for _, r := range res {
+		out = append(out, r.Text)
+	}
+	return out
+}
+
+func TestIndexSuite(t *testing.T) { suite.Run(t, new(IndexSuite)) }
@@ -0,0 +1,104 @@
+// Package rag implements the retrieval half of retrieval-augmented
+// generation on top of gollama: documents are split into chunks, embedded
+// with an embedding model and stored in a vector index that returns the
+// chunks most similar to a query.
+//
+// Example usage:
+//
+//	session, err := gollama.NewEmbeddingSession(model.Handle(), ctx.Handle())
+//	...
+//	store, err := rag.OpenFileStore("docs.gob")
+//	...
+//	r := rag.NewRetriever(session, store)
+//	err = r.Add("notes.txt", rag.ChunkBySentences(text, 500))
+//	results, err := r.Query("how do I configure the cache?", 3)
+//	for _, res := range results {
+//		fmt.Printf("%.3f %s@%d\n%s\n", res.Score, res.Source, res.Offset, res.Text)
+//	}
+//	err = store.Persist()
+package rag
+
+import "fmt"
+
+// Embedder turns text into an embedding vector. *gollama.EmbeddingSession
+// implements it.
+type Embedder interface {
+	Embed(text string) ([]float32, error)
+}
+
+// batchEmbedder is implemented by embedders that embed several texts per
+// decode, such as *gollama.EmbeddingSession.
+type batchEmbedder interface {
+	EmbedBatch(texts []string, batchTokens int) ([][]float32, error)
+}
+
+// Retriever embeds chunks and queries with an Embedder and keeps them in a
+// VectorStore.
+type Retriever struct {
+	Embedder Embedder
+	Store    VectorStore
+}
+
+// NewRetriever creates a retriever using store, or an empty Index when
+// store is nil.
+func NewRetriever(e Embedder, store VectorStore) *Retriever {
+	if store == nil {
+		store = NewIndex()
+	}
+	return &Retriever{Embedder: e, Store: store}
+}
+
+// Add embeds chunks and adds them to the index as part of the document
+// source, replacing any chunks previously added for it. Embedders with an
+// EmbedBatch method embed all chunks in batches.
+func (r *Retriever) Add(source string, chunks []Chunk) error {
+	embeddings, err := r.embedAll(chunks)
+	if err != nil {
+		return fmt.Errorf("embedding %s: %w", source, err)
+	}
+	docChunks := make([]Chunk, len(chunks))
+	for i, c := range chunks {
+		c.Source = source
+		docChunks[i] = c
+	}
+	if rs, ok := r.Store.(replacer); ok {
+		return rs.Replace(source, docChunks, embeddings)
+	}
+	if _, err := r.Store.Delete(source); err != nil {
+		return err
+	}
+	return r.Store.Add(docChunks, embeddings)
+}
+
+func (r *Retriever) embedAll(chunks []Chunk) ([][]float32, error) {
+	if be, ok := r.Embedder.(batchEmbedder); ok {
+		texts := make([]string, len(chunks))
+		for i, c := range chunks {
+			texts[i] = c.Text
+		}
+		return be.EmbedBatch(texts, 0)
+	}
+	embeddings := make([][]float32, len(chunks))
+	for i, c := range chunks {
+		vec, err := r.Embedder.Embed(c.Text)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		embeddings[i] = vec
+	}
+	return embeddings, nil
+}
+
+// Delete removes the chunks of source from the store.
+func (r *Retriever) Delete(source string) (int, error) {
+	return r.Store.Delete(source)
+}
+
+// Query returns the k chunks most similar to text.
+func (r *Retriever) Query(text string, k int) ([]Result, error) {
+	vec, err := r.Embedder.Embed(text)
+	if err != nil {
+		return nil, fmt.Errorf("embedding query: %w", err)
+	}
+	return r.Store.Query(vec, k)
+}
@@ -0,0 +1,61 @@
+package rag
+
+import (
+	"errors"
+	"os"
+)
+
+// VectorStore stores chunks with their embeddings and finds the chunks most
+// similar to a query embedding. Index keeps them in memory and FileStore
+// on disk; adapters for databases such as pgvector or qdrant implement the
+// same interface.
+//
+// Implementations must be safe for concurrent use.
+type VectorStore interface {
+	// Add stores chunks with their embeddings, one per chunk.
+	Add(chunks []Chunk, embeddings [][]float32) error
+	// Query returns the k chunks most similar to embedding, most similar
+	// first, with their cosine similarity.
+	Query(embedding []float32, k int) ([]Result, error)
+	// Delete removes every chunk of source and returns how many were
+	// removed.
+	Delete(source string) (int, error)
+	// Persist makes the changes durable, for stores that buffer them.
+	Persist() error
+}
+
+// replacer is implemented by stores that can replace the chunks of a
+// document in a single update.
+type replacer interface {
+	Replace(source string, chunks []Chunk, embeddings [][]float32) error
+}
+
+// FileStore is an Index saved to a file: it is loaded when opened and
+// written back atomically by Persist.
+type FileStore struct {
+	*Index
+	path string
+}
+
+// OpenFileStore opens the store saved at path, or creates an empty one
+// when the file does not exist yet.
+func OpenFileStore(path string) (*FileStore, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return &FileStore{Index: NewIndex(), path: path}, nil
+	}
+	ix, err := LoadIndexFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{Index: ix, path: path}, nil
+}
+
+// Path returns the file of the store.
+func (s *FileStore) Path() string {
+	return s.path
+}
+
+// Persist writes the store to its file.
+func (s *FileStore) Persist() error {
+	return s.Index.SaveFile(s.path)
+}
@@ -0,0 +1,62 @@
+package rag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	gollama "github.com/dianlight/gollama.cpp"
+	"github.com/stretchr/testify/suite"
+)
+
+type StoreSuite struct{ suite.Suite }
+
+func (s *StoreSuite) TestFileStore() {
+	path := filepath.Join(s.T().TempDir(), "store.gob")
+	store, err := OpenFileStore(path)
+	s.Require().NoError(err)
+	s.Equal(path, store.Path())
+	s.Zero(store.Len())
+	s.NoFileExists(path, "nothing is written before Persist")
+
+	s.Require().NoError(store.Add([]Chunk{{Source: "a", Text: "x"}, {Source: "b", Text: "y"}}, [][]float32{{1, 0}, {0, 1}}))
+	s.Require().NoError(store.Persist())
+
+	reopened, err := OpenFileStore(path)
+	s.Require().NoError(err)
+	res, err := reopened.Query([]float32{0, 1}, 1)
+	s.Require().NoError(err)
+	s.Equal("y", res[0].Text)
+
+	n, err := reopened.Delete("b")
+	s.Require().NoError(err)
+	s.Equal(1, n)
+	s.Require().NoError(reopened.Persist())
+	reopened, err = OpenFileStore(path)
+	s.Require().NoError(err)
+	s.Equal(1, reopened.Len())
+}
+
+func (s *StoreSuite) TestOpenCorruptFileStore() {
+	path := filepath.Join(s.T().TempDir(), "store.gob")
+	s.Require().NoError(os.WriteFile(path, []byte("garbage"), 0o644))
+	_, err := OpenFileStore(path)
+	s.ErrorIs(err, gollama.ErrInvalidFileFormat)
+}
+
+// deleteAddStore is a VectorStore without Replace.
+type deleteAddStore struct{ VectorStore }
+
+func (s *StoreSuite) TestRetrieverWithStore() {
+	var store VectorStore = deleteAddStore{NewIndex()}
+	r := NewRetriever(fakeEmbedder{}, store)
+	s.Require().NoError(r.Add("doc", []Chunk{{Text: "x"}, {Text: "y"}}))
+	s.Require().NoError(r.Add("doc", []Chunk{{Text: "xy"}}))
+
+	res, err := r.Query("x", 5)
+	s.Require().NoError(err)
+	s.Equal([]string{"xy"}, resultTexts(res))
+	s.NoError(store.Persist())
+}
+
+func TestStoreSuite(t *testing.T) { suite.Run(t, new(StoreSuite)) }
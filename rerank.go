@@ -0,0 +1,131 @@
+package gollama
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RerankContextParams returns a copy of params configured for a reranker
+// (cross-encoder) model such as bge-reranker: embeddings are enabled, rank
+// pooling is selected and NUbatch is raised to NBatch so that a whole
+// query/document pair fits in a single micro-batch.
+func RerankContextParams(params LlamaContextParams) LlamaContextParams {
+	params.Embeddings = 1
+	params.PoolingType = LLAMA_POOLING_TYPE_RANK
+	if params.NUbatch < params.NBatch {
+		params.NUbatch = params.NBatch
+	}
+	return params
+}
+
+// Rerank scores each document against query with a rank-pooling model and
+// returns one relevance score per document, in input order. Higher scores
+// mean more relevant; scores are the raw classifier outputs and are not
+// normalized.
+//
+// ctx must have been created with LLAMA_POOLING_TYPE_RANK (see
+// RerankContextParams). The context memory is cleared before each pair.
+//
+// Example usage:
+//
+//	ctx, _ := gollama.Init_from_model(model, gollama.RerankContextParams(gollama.Context_default_params()))
+//	defer gollama.Free(ctx)
+//
+//	scores, err := gollama.Rerank(ctx, "what is a panda?", docs)
+func Rerank(ctx LlamaContext, query string, documents []string) ([]float32, error) {
+	if ctx == 0 {
+		return nil, ErrContextNotCreated
+	}
+	model, bos, eos, sep, nUbatch, err := rerankSetup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queryTokens, err := Tokenize(model, query, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]float32, len(documents))
+	for i, doc := range documents {
+		docTokens, err := Tokenize(model, doc, false, false)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+
+		tokens := rerankPairTokens(queryTokens, docTokens, bos, eos, sep)
+		if nUbatch > 0 && uint64(len(tokens)) > uint64(nUbatch) {
+			return nil, fmt.Errorf("%w: document %d: pair of %d tokens exceeds n_ubatch %d", ErrInvalidParameter, i, len(tokens), nUbatch)
+		}
+
+		Memory_clear(ctx, true)
+		batch := Batch_get_one(tokens)
+		if batch.NTokens == 0 {
+			return nil, errors.New("failed to create batch for rerank")
+		}
+		if err := Decode(ctx, batch); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+
+		score, err := extractEmbedding(ctx, LLAMA_POOLING_TYPE_RANK, 0, -1, 1)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		scores[i] = score[0]
+	}
+	Memory_clear(ctx, true)
+	return scores, nil
+}
+
+// rerankSetup reads what Rerank needs from ctx: its model, the model's
+// BOS, EOS and SEP tokens, and the context's NUbatch.
+func rerankSetup(ctx LlamaContext) (model LlamaModel, bos, eos, sep LlamaToken, nUbatch uint32, err error) {
+	release, err := acquireNativeCall("llama_get_model")
+	if err != nil {
+		return 0, 0, 0, 0, 0, err
+	}
+	defer release()
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return 0, 0, 0, 0, 0, err
+	}
+	if llamaPoolingType == nil || llamaGetModel == nil || llamaModelGetVocab == nil || llamaNUbatch == nil ||
+		llamaVocabBos == nil || llamaVocabEos == nil || llamaVocabSep == nil {
+		return 0, 0, 0, 0, 0, fmt.Errorf("%w: rerank functions", ErrFunctionNotFound)
+	}
+	if pooling := llamaPoolingType(ctx); pooling != LLAMA_POOLING_TYPE_RANK {
+		return 0, 0, 0, 0, 0, fmt.Errorf("%w: rerank requires LLAMA_POOLING_TYPE_RANK, context uses %d", ErrInvalidParameter, pooling)
+	}
+
+	model = llamaGetModel(ctx)
+	if model == 0 {
+		return 0, 0, 0, 0, 0, ErrModelNotLoaded
+	}
+	if err := checkHandle(handleModel, uintptr(model)); err != nil {
+		return 0, 0, 0, 0, 0, err
+	}
+	vocab := llamaModelGetVocab(model)
+	if vocab == 0 {
+		return 0, 0, 0, 0, 0, errors.New("failed to get vocabulary from model")
+	}
+	return model, llamaVocabBos(vocab), llamaVocabEos(vocab), llamaVocabSep(vocab), llamaNUbatch(ctx), nil
+}
+
+// rerankPairTokens builds the cross-encoder input used by llama.cpp:
+// [BOS] query [EOS] [SEP] document [EOS]. Special tokens the model does not
+// define are omitted.
+func rerankPairTokens(query, document []LlamaToken, bos, eos, sep LlamaToken) []LlamaToken {
+	tokens := make([]LlamaToken, 0, len(query)+len(document)+4)
+	add := func(t LlamaToken) {
+		if t != LLAMA_TOKEN_NULL {
+			tokens = append(tokens, t)
+		}
+	}
+
+	add(bos)
+	tokens = append(tokens, query...)
+	add(eos)
+	add(sep)
+	tokens = append(tokens, document...)
+	add(eos)
+	return tokens
+}
@@ -0,0 +1,50 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RerankSuite struct{ BaseSuite }
+
+func (s *RerankSuite) TestRerankContextParams() {
+	params := ContextDefaultParams()
+	params.NBatch = 512
+	params.NUbatch = 128
+
+	adjusted := RerankContextParams(params)
+	s.Equal(uint8(1), adjusted.Embeddings)
+	s.Equal(LLAMA_POOLING_TYPE_RANK, adjusted.PoolingType)
+	s.Equal(uint32(512), adjusted.NUbatch)
+}
+
+func (s *RerankSuite) TestRerankPairTokens() {
+	tokens := rerankPairTokens([]LlamaToken{10, 11}, []LlamaToken{20}, 0, 2, 3)
+	s.Equal([]LlamaToken{0, 10, 11, 2, 3, 20, 2}, tokens)
+}
+
+func (s *RerankSuite) TestRerankPairTokensSkipsUndefinedSpecials() {
+	tokens := rerankPairTokens([]LlamaToken{10}, []LlamaToken{20}, LLAMA_TOKEN_NULL, 2, LLAMA_TOKEN_NULL)
+	s.Equal([]LlamaToken{10, 2, 20, 2}, tokens)
+}
+
+func (s *RerankSuite) TestRerankRejectsNilContext() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	_, err := Rerank(0, "query", []string{"doc"})
+	s.Require().ErrorIs(err, ErrContextNotCreated)
+}
+
+func (s *RerankSuite) TestRerankRejectsClosedContext() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	registerHandle(handleContext, 0x4680)
+	s.True(closeHandle(handleContext, 0x4680))
+	_, err := Rerank(LlamaContext(0x4680), "query", []string{"doc"})
+	s.ErrorIs(err, ErrClosedHandle)
+}
+
+func TestRerankSuite(t *testing.T) { suite.Run(t, new(RerankSuite)) }
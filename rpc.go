@@ -0,0 +1,253 @@
+package gollama
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/jupiterrider/ffi"
+)
+
+// rpcPluginName is the name of the ggml RPC plugin, libggml-rpc.so and its
+// equivalents, and rpcRegName the name of its registration.
+const (
+	rpcPluginName = "rpc"
+	rpcRegName    = "RPC"
+)
+
+// rpcServers holds the devices of the servers added with AddRpcDevices, by
+// endpoint, since registering a server twice would duplicate its devices.
+var rpcServers = struct {
+	sync.Mutex
+	m map[string][]GgmlBackendDevice
+}{m: make(map[string][]GgmlBackendDevice)}
+
+// AddRpcDevices offloads to remote machines: it adds the devices of the
+// rpc-server instances at endpoints, a comma separated list of host:port
+// addresses, and returns them. The RPC backend is loaded first when needed,
+// from the llama.cpp libraries or else from the CPU build of the targeted
+// release, downloaded to the library cache.
+//
+// The devices are registered with ggml, so models loaded afterwards
+// offload to them with the local devices; pass them to SetDevices to use
+// only some. Adding a server twice returns the devices of the first call.
+//
+// Example usage:
+//
+//	devices, err := gollama.AddRpcDevices("192.168.1.10:50052,192.168.1.11:50052")
+//	if err != nil {
+//		return err
+//	}
+//	params := gollama.Model_default_params()
+//	params.SetDevices(devices)
+func AddRpcDevices(endpoints string) ([]GgmlBackendDevice, error) {
+	var list []string
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint == "" {
+			continue
+		}
+		if err := validateRpcEndpoint(endpoint); err != nil {
+			return nil, err
+		}
+		list = append(list, endpoint)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: no RPC endpoints", ErrMissingParameter)
+	}
+	if err := ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	reg, err := ensureRpcBackend()
+	if err != nil {
+		return nil, err
+	}
+	if ggmlBackendRegGetProcAddress == nil {
+		return nil, fmt.Errorf("ggml_backend_reg_get_proc_address function not available")
+	}
+
+	rpcServers.Lock()
+	defer rpcServers.Unlock()
+	var devices []GgmlBackendDevice
+	for _, endpoint := range list {
+		devs, ok := rpcServers.m[endpoint]
+		if !ok {
+			if devs, err = addRpcServer(reg, endpoint); err != nil {
+				return nil, err
+			}
+			rpcServers.m[endpoint] = devs
+			slog.Info("added RPC server", "endpoint", endpoint, "devices", len(devs))
+		}
+		devices = append(devices, devs...)
+	}
+	return devices, nil
+}
+
+// validateRpcEndpoint checks that endpoint is a host:port address.
+func validateRpcEndpoint(endpoint string) error {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return fmt.Errorf("%w: RPC endpoint %q: %v", ErrInvalidParameter, endpoint, err)
+	}
+	if n, err := strconv.Atoi(port); host == "" || err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("%w: RPC endpoint %q is not host:port", ErrInvalidParameter, endpoint)
+	}
+	return nil
+}
+
+// rpcDialTimeout bounds the reachability check of an RPC server.
+const rpcDialTimeout = 5 * time.Second
+
+// addRpcServer connects to the server at endpoint and registers its
+// devices. Builds before the multi-device RPC protocol expose a device per
+// server through ggml_backend_rpc_add_device instead of a registration.
+func addRpcServer(reg GgmlBackendReg, endpoint string) ([]GgmlBackendDevice, error) {
+	// The RPC backend crashes on a server it cannot connect to
+	conn, err := net.DialTimeout("tcp", endpoint, rpcDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot connect to RPC server %s: %v", ErrBackendInitFailed, endpoint, err)
+	}
+	conn.Close()
+
+	if fn := rpcProcAddress(reg, "ggml_backend_rpc_add_server"); fn != nil {
+		if ggmlBackendRegister == nil || ggmlBackendRegDevCount == nil || ggmlBackendRegDevGet == nil {
+			return nil, fmt.Errorf("%w: ggml backend registration functions", ErrFunctionNotFound)
+		}
+		server, err := ffiRpcAdd(fn, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if server == 0 {
+			return nil, fmt.Errorf("%w: cannot connect to RPC server %s", ErrBackendInitFailed, endpoint)
+		}
+		serverReg := GgmlBackendReg(server)
+		ggmlBackendRegister(serverReg)
+		devices := make([]GgmlBackendDevice, 0, ggmlBackendRegDevCount(serverReg))
+		for i := uint64(0); i < ggmlBackendRegDevCount(serverReg); i++ {
+			devices = append(devices, ggmlBackendRegDevGet(serverReg, i))
+		}
+		return devices, nil
+	}
+
+	fn := rpcProcAddress(reg, "ggml_backend_rpc_add_device")
+	if fn == nil {
+		return nil, fmt.Errorf("%w: RPC backend exports no add_server or add_device function", ErrFunctionNotFound)
+	}
+	if ggmlBackendDeviceRegister == nil {
+		return nil, fmt.Errorf("ggml_backend_device_register function not available")
+	}
+	dev, err := ffiRpcAdd(fn, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if dev == 0 {
+		return nil, fmt.Errorf("%w: cannot connect to RPC server %s", ErrBackendInitFailed, endpoint)
+	}
+	ggmlBackendDeviceRegister(GgmlBackendDevice(dev))
+	return []GgmlBackendDevice{GgmlBackendDevice(dev)}, nil
+}
+
+// rpcProcAddress returns the address of the RPC backend function name, or
+// nil when the backend does not export it.
+func rpcProcAddress(reg GgmlBackendReg, name string) unsafe.Pointer {
+	nameBytes := append([]byte(name), 0)
+	return ggmlBackendRegGetProcAddress(reg, &nameBytes[0])
+}
+
+// ensureRpcBackend returns the registration of the RPC backend, loading
+// its plugin when the llama.cpp libraries do not include it.
+func ensureRpcBackend() (GgmlBackendReg, error) {
+	if reg, err := Ggml_backend_reg_by_name(rpcRegName); err != nil || reg != 0 {
+		return reg, err
+	}
+
+	name := pluginLibraryName(rpcPluginName, runtime.GOOS)
+	path, err := findPluginLibrary(name, backendSearchDirs())
+	if err != nil {
+		if path, err = downloadRpcPlugin(name); err != nil {
+			return 0, fmt.Errorf("%w: RPC: %w", ErrBackendNotAvailable, err)
+		}
+	}
+	reg, err := Ggml_backend_load(path)
+	if err != nil {
+		return 0, fmt.Errorf("%w: RPC: %v", ErrBackendInitFailed, err)
+	}
+	slog.Info("loaded GGML backend", "backend", rpcRegName, "path", path)
+	return reg, nil
+}
+
+// downloadRpcPlugin fetches the plugin name from the default build of the
+// release the loaded library comes from, which includes the RPC backend,
+// and returns its path.
+func downloadRpcPlugin(name string) (string, error) {
+	d, err := ensureDownloader()
+	if err != nil {
+		return "", err
+	}
+	if err := d.checkOnline("download the RPC backend"); err != nil {
+		return "", err
+	}
+
+	libMutex.RLock()
+	version := loaderLibVersion
+	libMutex.RUnlock()
+	if version == "" {
+		version = LlamaCppBuild
+	}
+	release, err := globalLoader.getReleaseForVersion(version)
+	if err != nil {
+		return "", err
+	}
+	pattern, err := d.GetAssetPatternForBackend(runtime.GOOS, runtime.GOARCH, bundledBackend(runtime.GOOS))
+	if err != nil {
+		return "", err
+	}
+	assetName, downloadURL, err := d.FindAssetByPattern(release, pattern)
+	if err != nil {
+		return "", err
+	}
+
+	// If already extracted in cache (by exact asset name), use it
+	extractedDir := filepath.Join(d.cacheDir, strings.TrimSuffix(assetName, ".zip"))
+	if path, err := findPluginLibrary(name, []string{extractedDir}); err == nil {
+		return path, nil
+	}
+	expected, err := d.trustedChecksum(release, assetName)
+	if err != nil {
+		return "", fmt.Errorf("checksum unavailable: %w", err)
+	}
+	extractedDir, _, err = d.DownloadAndExtractWithChecksum(downloadURL, assetName, expected)
+	if err != nil {
+		return "", err
+	}
+	return findPluginLibrary(name, []string{extractedDir})
+}
+
+// forgetRpcServers drops the RPC servers of an unloaded library.
+func forgetRpcServers() {
+	rpcServers.Lock()
+	defer rpcServers.Unlock()
+	rpcServers.m = make(map[string][]GgmlBackendDevice)
+}
+
+// ffiRpcAdd calls an RPC function taking an endpoint and returning a
+// registration or device handle using FFI
+func ffiRpcAdd(fn unsafe.Pointer, endpoint string) (uintptr, error) {
+	var cif ffi.Cif
+	if status := ffi.PrepCif(&cif, ffi.DefaultAbi, 1, &ffi.TypePointer, &ffi.TypePointer); status != ffi.OK {
+		return 0, fmt.Errorf("ffi.PrepCif failed: %s", status.String())
+	}
+	endpointBytes := append([]byte(endpoint), 0)
+	endpointPtr := &endpointBytes[0]
+	var result uintptr
+	ffi.Call(&cif, uintptr(fn), unsafe.Pointer(&result), unsafe.Pointer(&endpointPtr))
+	runtime.KeepAlive(endpointBytes)
+	return result, nil
+}
@@ -0,0 +1,52 @@
+package gollama
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RpcSuite struct{ BaseSuite }
+
+func (s *RpcSuite) TestInvalidEndpoints() {
+	_, err := AddRpcDevices("")
+	s.ErrorIs(err, ErrMissingParameter)
+	_, err = AddRpcDevices(" , ")
+	s.ErrorIs(err, ErrMissingParameter)
+	for _, endpoints := range []string{"localhost", "host:port", ":50052", "10.0.0.1:50052,10.0.0.2:0", "[::1]:70000"} {
+		_, err = AddRpcDevices(endpoints)
+		s.ErrorIs(err, ErrInvalidParameter, endpoints)
+	}
+	s.NoError(validateRpcEndpoint("[::1]:50052"))
+}
+
+func (s *RpcSuite) TestPluginLibraryName() {
+	s.Equal("libggml-rpc.so", pluginLibraryName(rpcPluginName, "linux"))
+	s.Equal("ggml-rpc.dll", pluginLibraryName(rpcPluginName, "windows"))
+	s.Equal("libggml-rpc.dylib", pluginLibraryName(rpcPluginName, "darwin"))
+}
+
+func (s *RpcSuite) TestUnreachableServer() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	// Ggml_backend_load creates the global downloader; keep later cache tests isolated
+	downloader := globalLoader.downloader
+	s.T().Cleanup(func() { globalLoader.downloader = downloader })
+	if _, err := ensureRpcBackend(); err != nil {
+		s.T().Skipf("RPC backend not available: %v", err)
+	}
+	s.True(Supports_rpc())
+
+	// A port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	endpoint := l.Addr().String()
+	s.Require().NoError(l.Close())
+
+	_, err = AddRpcDevices(endpoint)
+	s.ErrorIs(err, ErrBackendInitFailed)
+}
+
+func TestRpcSuite(t *testing.T) { suite.Run(t, new(RpcSuite)) }
@@ -0,0 +1,288 @@
+package gollama
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Sampler constructors return 0 when the library cannot be loaded. The
+// returned samplers are usually added to a chain with Sampler_chain_add,
+// which takes ownership of them.
+
+// Sampler_chain_add appends smpl to chain. The chain takes ownership of smpl.
+func Sampler_chain_add(chain LlamaSampler, smpl LlamaSampler) {
+	if err := ensureLoaded(); err != nil {
+		return
+	}
+	if chain == 0 || smpl == 0 || handleClosed(handleSampler, uintptr(chain)) || handleClosed(handleSampler, uintptr(smpl)) {
+		return
+	}
+	llamaSamplerChainAdd(chain, smpl)
+	// The chain owns smpl from now on
+	allocations.forget(AllocSampler, uintptr(smpl))
+	releaseHandle(handleSampler, uintptr(smpl))
+}
+
+// Sampler_chain_n returns the number of samplers in chain.
+func Sampler_chain_n(chain LlamaSampler) int32 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if chain == 0 || handleClosed(handleSampler, uintptr(chain)) {
+		return 0
+	}
+	return llamaSamplerChainN(chain)
+}
+
+// Sampler_accept informs the sampler that token was selected. Sampler_sample
+// already does this for the token it returns.
+func Sampler_accept(smpl LlamaSampler, token LlamaToken) {
+	if err := ensureLoaded(); err != nil {
+		return
+	}
+	if smpl == 0 || handleClosed(handleSampler, uintptr(smpl)) {
+		return
+	}
+	llamaSamplerAccept(smpl, token)
+}
+
+// Sampler_reset resets the internal state of the sampler (e.g. penalties or
+// mirostat state).
+func Sampler_reset(smpl LlamaSampler) {
+	if err := ensureLoaded(); err != nil {
+		return
+	}
+	if smpl == 0 || handleClosed(handleSampler, uintptr(smpl)) {
+		return
+	}
+	llamaSamplerReset(smpl)
+}
+
+// trackSampler records smpl for teardown and allocation tracking and
+// returns it.
+func trackSampler(smpl LlamaSampler) LlamaSampler {
+	allocations.note(AllocSampler, uintptr(smpl), 0)
+	registerHandle(handleSampler, uintptr(smpl))
+	return smpl
+}
+
+// Sampler_init_dist creates a sampler that picks a token at random according
+// to the token probabilities. It is normally the last sampler of a chain.
+func Sampler_init_dist(seed uint32) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	return trackSampler(llamaSamplerInitDist(seed))
+}
+
+// Sampler_init_top_k creates a top-k sampler.
+func Sampler_init_top_k(k int32) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	return trackSampler(llamaSamplerInitTopK(k))
+}
+
+// Sampler_init_top_p creates a nucleus (top-p) sampler.
+func Sampler_init_top_p(p float32, minKeep uint64) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	return trackSampler(llamaSamplerInitTopP(p, minKeep))
+}
+
+// Sampler_init_min_p creates a min-p sampler.
+func Sampler_init_min_p(p float32, minKeep uint64) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	return trackSampler(llamaSamplerInitMinP(p, minKeep))
+}
+
+// Sampler_init_typical creates a locally typical sampler.
+func Sampler_init_typical(p float32, minKeep uint64) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	return trackSampler(llamaSamplerInitTypical(p, minKeep))
+}
+
+// Sampler_init_temp creates a temperature sampler.
+func Sampler_init_temp(temp float32) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	return trackSampler(llamaSamplerInitTemp(temp))
+}
+
+// Sampler_init_temp_ext creates a dynamic temperature sampler.
+func Sampler_init_temp_ext(temp, delta, exponent float32) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	return trackSampler(llamaSamplerInitTempExt(temp, delta, exponent))
+}
+
+// Sampler_init_mirostat creates a Mirostat 1.0 sampler for a vocabulary of
+// nVocab tokens.
+func Sampler_init_mirostat(nVocab int32, seed uint32, tau, eta float32, m int32) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	return trackSampler(llamaSamplerInitMirostat(nVocab, seed, tau, eta, m))
+}
+
+// Sampler_init_mirostat_v2 creates a Mirostat 2.0 sampler.
+func Sampler_init_mirostat_v2(seed uint32, tau, eta float32) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	return trackSampler(llamaSamplerInitMirostatV2(seed, tau, eta))
+}
+
+// Sampler_init_grammar creates a sampler that constrains output to the GBNF
+// grammar, starting at rule root ("root" when empty). It returns 0 when the
+// grammar cannot be parsed.
+func Sampler_init_grammar(vocab LlamaVocab, grammar, root string) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if vocab == 0 || grammar == "" || llamaSamplerInitGrammar == nil {
+		return 0
+	}
+	if root == "" {
+		root = "root"
+	}
+	grammarBytes := append([]byte(grammar), 0)
+	rootBytes := append([]byte(root), 0)
+	return trackSampler(llamaSamplerInitGrammar(vocab, &grammarBytes[0], &rootBytes[0]))
+}
+
+// Sampler_init_logit_bias creates a sampler adding biases[token] to the
+// logit of each token of a vocabulary of vocabSize tokens. A bias of
+// math.Inf(-1) bans a token; large positive biases force one. Tokens out of
+// range are ignored. It returns 0 when biases is empty.
+//
+// Example usage:
+//
+//	ban := gollama.Sampler_init_logit_bias(model.NVocab, map[gollama.LlamaToken]float32{
+//		model.EOS: float32(math.Inf(-1)),
+//	})
+//	gollama.Sampler_chain_add(chain, ban)
+func Sampler_init_logit_bias(vocabSize int32, biases map[LlamaToken]float32) LlamaSampler {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	entries := logitBiases(vocabSize, biases)
+	if len(entries) == 0 || llamaSamplerInitLogitBias == nil {
+		return 0
+	}
+	// llama.cpp copies the array
+	return trackSampler(llamaSamplerInitLogitBias(vocabSize, int32(len(entries)), &entries[0]))
+}
+
+// logitBiases converts biases to the array llama.cpp expects, ordered by
+// token.
+func logitBiases(vocabSize int32, biases map[LlamaToken]float32) []LlamaLogitBias {
+	entries := make([]LlamaLogitBias, 0, len(biases))
+	for token, bias := range biases {
+		if token >= 0 && int32(token) < vocabSize {
+			entries = append(entries, LlamaLogitBias{Token: token, Bias: bias})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Token < entries[j].Token })
+	return entries
+}
+
+// SamplingParams configures the sampler chain built by NewSamplerChain.
+type SamplingParams struct {
+	// Temperature scales the logits; 0 or less selects greedy decoding
+	Temperature float32 `json:"temperature"`
+	// TopK keeps the k most likely tokens; 0 disables it
+	TopK int32 `json:"top_k"`
+	// TopP keeps the smallest set of tokens whose probabilities add up to
+	// p; 0 or 1 disables it
+	TopP float32 `json:"top_p"`
+	// MinP drops tokens less likely than p times the most likely one; 0
+	// disables it
+	MinP float32 `json:"min_p"`
+	// MirostatTau, when positive, replaces top-k, top-p and min-p with
+	// Mirostat 2.0 sampling targeting this surprise value (5 is typical)
+	MirostatTau float32 `json:"mirostat_tau,omitempty"`
+	// MirostatEta is the Mirostat learning rate; 0 means 0.1
+	MirostatEta float32 `json:"mirostat_eta,omitempty"`
+	// Seed seeds every random pick of the chain, whether made by the dist
+	// or the Mirostat sampler; LLAMA_DEFAULT_SEED picks a random seed
+	Seed uint32 `json:"seed"`
+}
+
+// Validate checks the ranges of p.
+func (p SamplingParams) Validate() error {
+	if p.TopK < 0 {
+		return fmt.Errorf("%w: top_k must be non-negative, got %d", ErrInvalidSamplingParams, p.TopK)
+	}
+	if p.TopP < 0 || p.TopP > 1 {
+		return fmt.Errorf("%w: top_p must be within [0, 1], got %g", ErrInvalidSamplingParams, p.TopP)
+	}
+	if p.MinP < 0 || p.MinP > 1 {
+		return fmt.Errorf("%w: min_p must be within [0, 1], got %g", ErrInvalidSamplingParams, p.MinP)
+	}
+	if p.MirostatTau < 0 || p.MirostatEta < 0 {
+		return fmt.Errorf("%w: mirostat tau and eta must be non-negative, got %g and %g", ErrInvalidSamplingParams, p.MirostatTau, p.MirostatEta)
+	}
+	return nil
+}
+
+// DefaultSamplingParams returns the sampling parameters of the global
+// configuration (see Config.Sampling and WithSampling).
+func DefaultSamplingParams() SamplingParams {
+	if globalConfig == nil {
+		return DefaultConfig().Sampling
+	}
+	return globalConfig.Sampling
+}
+
+// Deterministic reports whether chains built from p always pick the same
+// token from the same logits: they are greedy or have a fixed seed.
+func (p SamplingParams) Deterministic() bool {
+	return p.Temperature <= 0 || p.Seed != LLAMA_DEFAULT_SEED
+}
+
+// NewSamplerChain builds a top-k, top-p, min-p, temperature and dist chain
+// from p, a temperature and Mirostat 2.0 chain when p.MirostatTau is
+// positive, or a greedy chain when p.Temperature is 0 or less. The chain
+// must be released with Sampler_free.
+func NewSamplerChain(p SamplingParams) (LlamaSampler, error) {
+	if err := p.Validate(); err != nil {
+		return 0, err
+	}
+	chain := Sampler_chain_init(Sampler_chain_default_params())
+	if chain == 0 {
+		return 0, fmt.Errorf("%w: failed to create sampler chain", ErrSamplingFailed)
+	}
+	if p.Temperature <= 0 {
+		Sampler_chain_add(chain, Sampler_init_greedy())
+		return chain, nil
+	}
+	if p.MirostatTau > 0 {
+		eta := p.MirostatEta
+		if eta == 0 {
+			eta = 0.1
+		}
+		Sampler_chain_add(chain, Sampler_init_temp(p.Temperature))
+		Sampler_chain_add(chain, Sampler_init_mirostat_v2(p.Seed, p.MirostatTau, eta))
+		return chain, nil
+	}
+	if p.TopK > 0 {
+		Sampler_chain_add(chain, Sampler_init_top_k(p.TopK))
+	}
+	if p.TopP > 0 && p.TopP < 1 {
+		Sampler_chain_add(chain, Sampler_init_top_p(p.TopP, 1))
+	}
+	if p.MinP > 0 {
+		Sampler_chain_add(chain, Sampler_init_min_p(p.MinP, 1))
+	}
+	Sampler_chain_add(chain, Sampler_init_temp(p.Temperature))
+	Sampler_chain_add(chain, Sampler_init_dist(p.Seed))
+	return chain, nil
+}
@@ -0,0 +1,85 @@
+package gollama
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SamplingSuite struct{ BaseSuite }
+
+func (s *SamplingSuite) TestChainOwnsSamplers() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	chain := Sampler_chain_init(Sampler_chain_default_params())
+	s.Require().NotZero(chain)
+
+	Sampler_chain_add(chain, Sampler_init_top_k(40))
+	Sampler_chain_add(chain, Sampler_init_top_p(0.9, 1))
+	Sampler_chain_add(chain, Sampler_init_min_p(0.05, 1))
+	Sampler_chain_add(chain, Sampler_init_temp(0.8))
+	Sampler_chain_add(chain, Sampler_init_dist(42))
+	s.Equal(int32(5), Sampler_chain_n(chain))
+
+	Sampler_reset(chain)
+	Sampler_free(chain)
+}
+
+func (s *SamplingSuite) TestNilSamplersAreIgnored() {
+	Sampler_chain_add(0, 0)
+	Sampler_accept(0, 1)
+	Sampler_reset(0)
+	Sampler_free(0)
+	s.Equal(int32(0), Sampler_chain_n(0))
+}
+
+func (s *SamplingSuite) TestNewSamplerChain() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	chain, err := NewSamplerChain(SamplingParams{Temperature: 0.7, TopK: 40, TopP: 0.9, MinP: 0.05, Seed: 1})
+	s.Require().NoError(err)
+	s.Equal(int32(5), Sampler_chain_n(chain))
+	Sampler_free(chain)
+
+	greedy, err := NewSamplerChain(SamplingParams{Temperature: 0, TopK: 40})
+	s.Require().NoError(err)
+	s.Equal(int32(1), Sampler_chain_n(greedy))
+	Sampler_free(greedy)
+
+	mirostat, err := NewSamplerChain(SamplingParams{Temperature: 0.7, TopK: 40, MirostatTau: 5, Seed: 1})
+	s.Require().NoError(err)
+	s.Equal(int32(2), Sampler_chain_n(mirostat))
+	Sampler_free(mirostat)
+
+	_, err = NewSamplerChain(SamplingParams{Temperature: 1, TopP: 1.5})
+	s.ErrorIs(err, ErrInvalidSamplingParams)
+	_, err = NewSamplerChain(SamplingParams{Temperature: 1, MirostatTau: -1})
+	s.ErrorIs(err, ErrInvalidSamplingParams)
+}
+
+func (s *SamplingSuite) TestLogitBiases() {
+	entries := logitBiases(10, map[LlamaToken]float32{7: -1, 2: float32(math.Inf(-1)), 10: 5, -1: 5})
+	s.Equal([]LlamaLogitBias{{Token: 2, Bias: float32(math.Inf(-1))}, {Token: 7, Bias: -1}}, entries)
+	s.Empty(logitBiases(10, nil))
+}
+
+func (s *SamplingSuite) TestSamplerInitLogitBias() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	s.Zero(Sampler_init_logit_bias(10, nil))
+	bias := Sampler_init_logit_bias(10, map[LlamaToken]float32{3: 2})
+	s.Require().NotZero(bias)
+	Sampler_free(bias)
+}
+
+func (s *SamplingSuite) TestDeterministic() {
+	s.True(SamplingParams{Temperature: 0, Seed: LLAMA_DEFAULT_SEED}.Deterministic())
+	s.True(SamplingParams{Temperature: 0.8, Seed: 7}.Deterministic())
+	s.False(SamplingParams{Temperature: 0.8, Seed: LLAMA_DEFAULT_SEED}.Deterministic())
+}
+
+func TestSamplingSuite(t *testing.T) { suite.Run(t, new(SamplingSuite)) }
@@ -0,0 +1,605 @@
+package gollama
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority is the class of a ScheduledRequest; requests of a higher class
+// take free slots first.
+type Priority int
+
+const (
+	// PriorityBatch is for offline work that may wait and be preempted.
+	PriorityBatch Priority = -1
+	// PriorityNormal is the default.
+	PriorityNormal Priority = 0
+	// PriorityInteractive is for requests a user is waiting on.
+	PriorityInteractive Priority = 1
+)
+
+// SchedulerOptions configures a Scheduler.
+type SchedulerOptions struct {
+	// MaxTokens is the default completion length of a request (default 128).
+	MaxTokens int
+	// Sampling is the default sampling of a request; nil uses
+	// DefaultSamplingParams.
+	Sampling *SamplingParams
+	// PreemptAfter, when positive, lets a request waiting for a slot
+	// preempt a running request of a lower priority that has generated at
+	// least PreemptAfter tokens. The preempted request waits for a slot
+	// again, then decodes its prompt and the tokens generated so far anew
+	// and continues where it stopped.
+	PreemptAfter int
+	// FairnessHalfLife is the half-life of the tokens counted against a
+	// client (see ScheduledRequest.Client); the default is one minute.
+	FairnessHalfLife time.Duration
+}
+
+// ScheduledRequest is a completion request submitted to a Scheduler.
+type ScheduledRequest struct {
+	Prompt []LlamaToken
+	// MaxTokens bounds the completion; 0 uses SchedulerOptions.MaxTokens.
+	MaxTokens int
+	// Sampling overrides SchedulerOptions.Sampling.
+	Sampling *SamplingParams
+	// OnToken, when set, receives every generated token; returning an error
+	// from it ends the request with that error. It runs on the scheduler's
+	// goroutine, so it must not block.
+	OnToken func(LlamaToken) error
+	// Priority orders the requests waiting for a slot, higher first.
+	Priority Priority
+	// Client identifies the sender of the request. Among waiting requests
+	// of the same priority, the one whose client had the fewest tokens
+	// decoded recently goes first, so a client flooding the scheduler
+	// cannot starve the others; requests without a client share one.
+	Client string
+}
+
+// ScheduledResult is the completion of a ScheduledRequest.
+type ScheduledResult struct {
+	Tokens []LlamaToken
+	Text   string
+	// PromptTokens is the number of prompt tokens decoded.
+	PromptTokens int
+	// Stopped reports whether generation ended with an end-of-generation
+	// token rather than at MaxTokens or the end of the slot's context.
+	Stopped bool
+	// Preemptions counts how often the request was preempted.
+	Preemptions int
+}
+
+// Scheduler serves completion requests with continuous batching. Every
+// sequence of the context is a slot; a request takes a free slot as soon
+// as one is available, its prompt tokens are packed into the next decode
+// calls next to the tokens of ongoing generations and the slot is released
+// as soon as the request finishes or its context.Context is cancelled. Each
+// slot has NCtx/NSeqMax tokens of context, as in llama.cpp's server.
+//
+// Waiting requests take free slots by priority, then by the recent token
+// usage of their client, then in arrival order; with PreemptAfter set, a
+// long generation of a lower priority makes room for them.
+//
+// Submit is safe for concurrent use; all decoding happens on a goroutine
+// owned by the scheduler, which must be stopped with Close.
+//
+// Example usage:
+//
+//	params := gollama.Context_default_params()
+//	params.NSeqMax = 8
+//	ctx, err := gollama.NewContext(model, params)
+//	...
+//	sched, err := gollama.NewScheduler(ctx, gollama.SchedulerOptions{MaxTokens: 256})
+//	if err != nil {
+//		return err
+//	}
+//	defer sched.Close()
+//	res, err := sched.Submit(r.Context(), gollama.ScheduledRequest{Prompt: tokens})
+type Scheduler struct {
+	ctx      *Context
+	opts     SchedulerOptions
+	sampling SamplingParams
+	slotCtx  int
+
+	queue   chan *scheduledJob
+	quit    chan struct{}
+	stopped chan struct{}
+	close   sync.Once
+
+	// usage and arrivals belong to the scheduler goroutine
+	usage    clientUsage
+	arrivals uint64
+}
+
+// scheduledJob is a request owned by the scheduler goroutine.
+type scheduledJob struct {
+	ctx      context.Context
+	req      ScheduledRequest
+	sampling SamplingParams
+	done     chan scheduledOutcome
+	// arrival orders jobs of the same priority and client usage
+	arrival uint64
+	// parked holds the state of a preempted job
+	parked *schedSlot
+}
+
+type scheduledOutcome struct {
+	res ScheduledResult
+	err error
+}
+
+// schedSlot is a sequence of the context and the job running in it.
+type schedSlot struct {
+	seqID   LlamaSeqId
+	job     *scheduledJob
+	sampler LlamaSampler
+	// prompt holds the prompt tokens not decoded yet
+	prompt []LlamaToken
+	// pos is the position of the next token to decode
+	pos LlamaPos
+	// next is the sampled token to decode in the next step, valid once
+	// the prompt is decoded
+	next   LlamaToken
+	output int32
+	res    ScheduledResult
+	// replay is the number of leading tokens of prompt decoded again after
+	// a preemption, which PromptTokens does not count
+	replay int
+}
+
+// schedEntry is a token of the next batch.
+type schedEntry struct {
+	slot   int
+	token  LlamaToken
+	pos    LlamaPos
+	logits bool
+}
+
+// NewScheduler creates a scheduler using every sequence of ctx and starts
+// its goroutine.
+func NewScheduler(ctx *Context, opts SchedulerOptions) (*Scheduler, error) {
+	if ctx == nil || ctx.Handle() == 0 {
+		return nil, ErrContextNotCreated
+	}
+	s, err := newScheduler(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	batch, err := NewTokenBatch(max(ctx.NBatch, ctx.NSeqMax), 1)
+	if err != nil {
+		return nil, err
+	}
+	go s.run(batch)
+	return s, nil
+}
+
+func newScheduler(ctx *Context, opts SchedulerOptions) (*Scheduler, error) {
+	if opts.MaxTokens <= 0 {
+		opts.MaxTokens = 128
+	}
+	if opts.FairnessHalfLife <= 0 {
+		opts.FairnessHalfLife = time.Minute
+	}
+	sampling := DefaultSamplingParams()
+	if opts.Sampling != nil {
+		sampling = *opts.Sampling
+	}
+	if err := sampling.Validate(); err != nil {
+		return nil, err
+	}
+	return &Scheduler{
+		ctx:      ctx,
+		opts:     opts,
+		sampling: sampling,
+		slotCtx:  int(ctx.NCtx / max(ctx.NSeqMax, 1)),
+		queue:    make(chan *scheduledJob),
+		quit:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		usage:    clientUsage{halfLife: opts.FairnessHalfLife},
+	}, nil
+}
+
+// Submit queues req and waits for its completion. When ctx is cancelled
+// the request leaves its slot before the next decode and Submit returns
+// the context's error.
+func (s *Scheduler) Submit(ctx context.Context, req ScheduledRequest) (ScheduledResult, error) {
+	if len(req.Prompt) == 0 {
+		return ScheduledResult{}, fmt.Errorf("%w: prompt is empty", ErrInvalidParameter)
+	}
+	if len(req.Prompt) >= s.slotCtx {
+		return ScheduledResult{}, fmt.Errorf("%w: prompt of %d tokens does not fit in a slot of %d tokens",
+			ErrContextFull, len(req.Prompt), s.slotCtx)
+	}
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = s.opts.MaxTokens
+	}
+	sampling := s.sampling
+	if req.Sampling != nil {
+		sampling = *req.Sampling
+		if err := sampling.Validate(); err != nil {
+			return ScheduledResult{}, err
+		}
+	}
+
+	job := &scheduledJob{ctx: ctx, req: req, sampling: sampling, done: make(chan scheduledOutcome, 1)}
+	select {
+	case s.queue <- job:
+	case <-ctx.Done():
+		return ScheduledResult{}, ctx.Err()
+	case <-s.stopped:
+		return ScheduledResult{}, ErrSchedulerClosed
+	}
+	out := <-job.done
+	return out.res, out.err
+}
+
+// Close stops the scheduler, failing the requests in flight with
+// ErrSchedulerClosed, and waits for its goroutine to exit. The context is
+// not freed.
+func (s *Scheduler) Close() {
+	s.close.Do(func() { close(s.quit) })
+	<-s.stopped
+}
+
+// run is the scheduler loop: queue new jobs, admit waiting jobs into free
+// slots, decode one batch and sample every slot whose logits it produced.
+func (s *Scheduler) run(batch *TokenBatch) {
+	defer close(s.stopped)
+	defer batch.Free()
+
+	slots := make([]*schedSlot, s.ctx.NSeqMax)
+	var pending []*scheduledJob
+	active := 0
+	finish := func(job *scheduledJob, slot *schedSlot, err error) {
+		var res ScheduledResult
+		if slot != nil {
+			Sampler_free(slot.sampler)
+			res = slot.res
+			if err == nil {
+				var text strings.Builder
+				for _, token := range res.Tokens {
+					text.WriteString(Token_to_piece(s.ctx.Model().Handle(), token, false))
+				}
+				res.Text = text.String()
+			}
+		}
+		job.done <- scheduledOutcome{res: res, err: err}
+	}
+	retire := func(i int, err error) {
+		slot := slots[i]
+		s.ctx.SeqRm(slot.seqID, 0, -1)
+		finish(slot.job, slot, err)
+		slots[i] = nil
+		active--
+	}
+	defer func() {
+		for i := range slots {
+			if slots[i] != nil {
+				retire(i, ErrSchedulerClosed)
+			}
+		}
+		for _, job := range pending {
+			finish(job, job.parked, ErrSchedulerClosed)
+		}
+	}()
+
+	for {
+		// Queue new jobs, waiting for one when idle
+		if active == 0 && len(pending) == 0 {
+			select {
+			case job := <-s.queue:
+				pending = append(pending, s.arrive(job))
+			case <-s.quit:
+				return
+			}
+		}
+		for queued := true; queued; {
+			select {
+			case job := <-s.queue:
+				pending = append(pending, s.arrive(job))
+			case <-s.quit:
+				return
+			default:
+				queued = false
+			}
+		}
+		waiting := pending[:0]
+		for _, job := range pending {
+			if err := job.ctx.Err(); err != nil {
+				finish(job, job.parked, err)
+			} else {
+				waiting = append(waiting, job)
+			}
+		}
+		pending = waiting
+
+		for i, slot := range slots {
+			if slot != nil && slot.job.ctx.Err() != nil {
+				retire(i, slot.job.ctx.Err())
+			}
+		}
+
+		// Admit waiting jobs, preempting long generations for them
+		now := time.Now()
+		for len(pending) > 0 {
+			k := pickJob(pending, func(client string) float64 { return s.usage.get(client, now) })
+			i := freeSlot(slots)
+			if i < 0 {
+				if i = preemptionVictim(slots, pending[k].req.Priority, s.opts.PreemptAfter); i < 0 {
+					break
+				}
+				pending = append(pending, s.park(slots[i]))
+				slots[i] = nil
+				active--
+			}
+			job := pending[k]
+			pending = append(pending[:k], pending[k+1:]...)
+			if err := s.admit(slots, i, job); err != nil {
+				finish(job, job.parked, err)
+				continue
+			}
+			active++
+		}
+		if active == 0 {
+			continue
+		}
+
+		entries := scheduleStep(slots, batch.Cap())
+		if len(entries) == 0 {
+			continue
+		}
+
+		batch.Clear()
+		decoded := make(map[string]int)
+		for _, e := range entries {
+			slot := slots[e.slot]
+			if slot == nil {
+				continue
+			}
+			if err := batch.Add(e.token, e.pos, []LlamaSeqId{slot.seqID}, e.logits); err != nil {
+				retire(e.slot, err)
+				continue
+			}
+			decoded[slot.job.req.Client]++
+			if e.logits {
+				slot.output = int32(batch.Len() - 1)
+			}
+		}
+		for client, n := range decoded {
+			s.usage.add(client, n, now)
+		}
+		if err := s.ctx.Decode(batch.Batch()); err != nil {
+			// The state of the sequences in the batch is unknown
+			for i, slot := range slots {
+				if slot != nil {
+					retire(i, fmt.Errorf("decoding batch of %d tokens: %w", batch.Len(), err))
+				}
+			}
+			continue
+		}
+
+		for i, slot := range slots {
+			if slot == nil || slot.output < 0 {
+				continue
+			}
+			if err := s.sample(slot); err != nil {
+				retire(i, err)
+			} else if slot.next == LLAMA_TOKEN_NULL {
+				retire(i, nil)
+			}
+		}
+	}
+}
+
+// arrive stamps a new job with its arrival order.
+func (s *Scheduler) arrive(job *scheduledJob) *scheduledJob {
+	s.arrivals++
+	job.arrival = s.arrivals
+	return job
+}
+
+// admit starts job in slot i, resuming it when it was preempted.
+func (s *Scheduler) admit(slots []*schedSlot, i int, job *scheduledJob) error {
+	s.ctx.SeqRm(LlamaSeqId(i), 0, -1)
+	if slot := job.parked; slot != nil {
+		job.parked = nil
+		slot.seqID = LlamaSeqId(i)
+		slots[i] = slot
+		return nil
+	}
+	sampler, err := NewSamplerChain(job.sampling)
+	if err != nil {
+		return err
+	}
+	slots[i] = &schedSlot{seqID: LlamaSeqId(i), job: job, sampler: sampler, prompt: job.req.Prompt, output: -1}
+	return nil
+}
+
+// park preempts slot: its sequence is cleared and its job returned, to wait
+// for a slot again with everything decoded so far as the prompt to replay.
+// The sampler keeps the state of the tokens already accepted.
+func (s *Scheduler) park(slot *schedSlot) *scheduledJob {
+	s.ctx.SeqRm(slot.seqID, 0, -1)
+	// The tokens generated so far include the sampled token not decoded
+	// yet, so replaying them ends with the logits of the next one
+	slot.prompt = append(append([]LlamaToken(nil), slot.job.req.Prompt...), slot.res.Tokens...)
+	slot.replay = len(slot.prompt)
+	slot.pos = 0
+	slot.output = -1
+	slot.res.Preemptions++
+	slot.job.parked = slot
+	return slot.job
+}
+
+// freeSlot returns the index of a free slot, or -1.
+func freeSlot(slots []*schedSlot) int {
+	for i, slot := range slots {
+		if slot == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// pickJob returns the index of the waiting job to admit next: the highest
+// priority, then the client with the lowest usage, then the earliest
+// arrival.
+func pickJob(pending []*scheduledJob, usage func(client string) float64) int {
+	best := 0
+	bestUsage := usage(pending[0].req.Client)
+	for k := 1; k < len(pending); k++ {
+		job, cur := pending[k], pending[best]
+		u := usage(job.req.Client)
+		switch {
+		case job.req.Priority != cur.req.Priority:
+			if job.req.Priority < cur.req.Priority {
+				continue
+			}
+		case u != bestUsage:
+			if u > bestUsage {
+				continue
+			}
+		case job.arrival > cur.arrival:
+			continue
+		}
+		best, bestUsage = k, u
+	}
+	return best
+}
+
+// preemptionVictim returns the slot to preempt for a job of priority p:
+// the generating slot of the lowest priority below p that has generated
+// at least after tokens, the longest generation first, or -1. after <= 0
+// disables preemption.
+func preemptionVictim(slots []*schedSlot, p Priority, after int) int {
+	if after <= 0 {
+		return -1
+	}
+	victim := -1
+	for i, slot := range slots {
+		if slot == nil || slot.job.req.Priority >= p || len(slot.prompt) > 0 || len(slot.res.Tokens) < after {
+			continue
+		}
+		if victim >= 0 {
+			v := slots[victim]
+			if slot.job.req.Priority > v.job.req.Priority ||
+				(slot.job.req.Priority == v.job.req.Priority && len(slot.res.Tokens) <= len(v.res.Tokens)) {
+				continue
+			}
+		}
+		victim = i
+	}
+	return victim
+}
+
+// clientUsage is the number of tokens decoded for each client, halving
+// every halfLife.
+type clientUsage struct {
+	halfLife time.Duration
+	m        map[string]*decayedCount
+}
+
+type decayedCount struct {
+	n  float64
+	at time.Time
+}
+
+func (c *decayedCount) value(now time.Time, halfLife time.Duration) float64 {
+	return c.n * math.Exp2(-float64(now.Sub(c.at))/float64(halfLife))
+}
+
+// get returns the usage of client at now.
+func (u *clientUsage) get(client string, now time.Time) float64 {
+	c, ok := u.m[client]
+	if !ok {
+		return 0
+	}
+	return c.value(now, u.halfLife)
+}
+
+// add counts n tokens decoded for client at now.
+func (u *clientUsage) add(client string, n int, now time.Time) {
+	if u.m == nil {
+		u.m = make(map[string]*decayedCount)
+	}
+	c, ok := u.m[client]
+	if !ok {
+		if len(u.m) >= 1024 {
+			u.prune(now)
+		}
+		c = &decayedCount{}
+		u.m[client] = c
+	}
+	c.n, c.at = c.value(now, u.halfLife)+float64(n), now
+}
+
+// prune forgets the clients whose usage decayed below one token.
+func (u *clientUsage) prune(now time.Time) {
+	for client, c := range u.m {
+		if c.value(now, u.halfLife) < 1 {
+			delete(u.m, client)
+		}
+	}
+}
+
+// sample draws the next token of slot from the batch just decoded. A
+// finished slot is left with next set to LLAMA_TOKEN_NULL.
+func (s *Scheduler) sample(slot *schedSlot) error {
+	token := Sampler_sample(slot.sampler, s.ctx.Handle(), slot.output)
+	slot.output = -1
+	slot.next = LLAMA_TOKEN_NULL
+	if token == LLAMA_TOKEN_NULL {
+		return fmt.Errorf("%w: no token sampled", ErrSamplingFailed)
+	}
+	if s.ctx.Model().IsEOG(token) {
+		slot.res.Stopped = true
+		return nil
+	}
+	slot.res.Tokens = append(slot.res.Tokens, token)
+	if slot.job.req.OnToken != nil {
+		if err := slot.job.req.OnToken(token); err != nil {
+			return err
+		}
+	}
+	if len(slot.res.Tokens) < slot.job.req.MaxTokens && int(slot.pos) < s.slotCtx {
+		slot.next = token
+	}
+	return nil
+}
+
+// scheduleStep picks the tokens of the next batch of at most capacity
+// tokens: first the sampled token of every generating slot, so ongoing
+// generations advance at every step, then prompt tokens of the slots still
+// in prefill, in slot order. Logits are requested for sampled tokens and
+// for the last token of a prompt. The slots' positions and pending prompts
+// are advanced accordingly.
+func scheduleStep(slots []*schedSlot, capacity int) []schedEntry {
+	var entries []schedEntry
+	for i, slot := range slots {
+		if slot == nil || len(slot.prompt) > 0 || slot.res.PromptTokens == 0 || len(entries) == capacity {
+			continue
+		}
+		entries = append(entries, schedEntry{slot: i, token: slot.next, pos: slot.pos, logits: true})
+		slot.pos++
+	}
+	for i, slot := range slots {
+		if slot == nil || len(slot.prompt) == 0 {
+			continue
+		}
+		n := min(len(slot.prompt), capacity-len(entries))
+		for j := 0; j < n; j++ {
+			last := j == len(slot.prompt)-1
+			entries = append(entries, schedEntry{slot: i, token: slot.prompt[j], pos: slot.pos, logits: last})
+			slot.pos++
+		}
+		slot.prompt = slot.prompt[n:]
+		replayed := min(n, slot.replay)
+		slot.replay -= replayed
+		slot.res.PromptTokens += n - replayed
+	}
+	return entries
+}
@@ -0,0 +1,161 @@
+package gollama
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SchedulerSuite struct{ BaseSuite }
+
+func (s *SchedulerSuite) newScheduler() *Scheduler {
+	sched, err := newScheduler(&Context{NCtx: 64, NSeqMax: 4}, SchedulerOptions{})
+	s.Require().NoError(err)
+	return sched
+}
+
+func (s *SchedulerSuite) TestScheduleStep() {
+	generating := &schedSlot{next: 7, pos: 5, res: ScheduledResult{PromptTokens: 5}}
+	prefill := &schedSlot{prompt: []LlamaToken{1, 2, 3, 4}}
+	slots := []*schedSlot{nil, prefill, generating}
+
+	entries := scheduleStep(slots, 3)
+	s.Equal([]schedEntry{
+		{slot: 2, token: 7, pos: 5, logits: true},
+		{slot: 1, token: 1, pos: 0},
+		{slot: 1, token: 2, pos: 1},
+	}, entries)
+	s.Equal(LlamaPos(6), generating.pos)
+	s.Equal([]LlamaToken{3, 4}, prefill.prompt)
+	s.Equal(2, prefill.res.PromptTokens)
+
+	// The rest of the prompt joins the next step, with logits for its
+	// last token
+	generating.next = 8
+	entries = scheduleStep(slots, 8)
+	s.Equal([]schedEntry{
+		{slot: 2, token: 8, pos: 6, logits: true},
+		{slot: 1, token: 3, pos: 2},
+		{slot: 1, token: 4, pos: 3, logits: true},
+	}, entries)
+	s.Empty(prefill.prompt)
+	s.Equal(4, prefill.res.PromptTokens)
+
+	s.Empty(scheduleStep([]*schedSlot{nil, nil}, 8))
+}
+
+func (s *SchedulerSuite) TestScheduleStepReplay() {
+	// A preempted slot decodes its prompt and its first generated token
+	// again; only the tokens past them count as prompt
+	resumed := &schedSlot{prompt: []LlamaToken{1, 2, 3, 9}, replay: 4, res: ScheduledResult{PromptTokens: 3, Tokens: []LlamaToken{9}}}
+	entries := scheduleStep([]*schedSlot{resumed}, 3)
+	s.Len(entries, 3)
+	s.Equal(1, resumed.replay)
+	entries = scheduleStep([]*schedSlot{resumed}, 3)
+	s.Equal([]schedEntry{{slot: 0, token: 9, pos: 3, logits: true}}, entries)
+	s.Zero(resumed.replay)
+	s.Equal(3, resumed.res.PromptTokens)
+}
+
+func (s *SchedulerSuite) TestPickJob() {
+	job := func(p Priority, client string, arrival uint64) *scheduledJob {
+		return &scheduledJob{req: ScheduledRequest{Priority: p, Client: client}, arrival: arrival}
+	}
+	usage := func(client string) float64 {
+		return map[string]float64{"heavy": 100, "light": 10}[client]
+	}
+
+	s.Equal(0, pickJob([]*scheduledJob{job(PriorityNormal, "", 1)}, usage))
+	// Priority first, even over a client with no usage
+	s.Equal(1, pickJob([]*scheduledJob{
+		job(PriorityNormal, "new", 1),
+		job(PriorityInteractive, "heavy", 2),
+		job(PriorityBatch, "new", 0),
+	}, usage))
+	// Then the client with the least usage
+	s.Equal(2, pickJob([]*scheduledJob{
+		job(PriorityNormal, "heavy", 1),
+		job(PriorityNormal, "light", 2),
+		job(PriorityNormal, "new", 3),
+	}, usage))
+	// Then arrival
+	s.Equal(1, pickJob([]*scheduledJob{
+		job(PriorityNormal, "light", 5),
+		job(PriorityNormal, "light", 4),
+		job(PriorityNormal, "heavy", 3),
+	}, usage))
+}
+
+func (s *SchedulerSuite) TestPreemptionVictim() {
+	slot := func(p Priority, generated int) *schedSlot {
+		return &schedSlot{
+			job: &scheduledJob{req: ScheduledRequest{Priority: p}},
+			res: ScheduledResult{PromptTokens: 1, Tokens: make([]LlamaToken, generated)},
+		}
+	}
+	prefill := slot(PriorityBatch, 50)
+	prefill.prompt = []LlamaToken{1}
+	slots := []*schedSlot{
+		slot(PriorityNormal, 40),
+		slot(PriorityBatch, 20),
+		slot(PriorityBatch, 30),
+		prefill,
+		slot(PriorityBatch, 5),
+	}
+
+	s.Equal(-1, preemptionVictim(slots, PriorityInteractive, 0), "disabled")
+	// The lowest priority, then the longest generation
+	s.Equal(2, preemptionVictim(slots, PriorityInteractive, 10))
+	s.Equal(2, preemptionVictim(slots, PriorityNormal, 10))
+	s.Equal(0, preemptionVictim(slots[:2], PriorityInteractive, 25))
+	s.Equal(-1, preemptionVictim(slots, PriorityBatch, 1), "same priority")
+	s.Equal(-1, preemptionVictim(slots, PriorityNormal, 100), "too short")
+}
+
+func (s *SchedulerSuite) TestClientUsageDecays() {
+	u := clientUsage{halfLife: time.Minute}
+	now := time.Now()
+	s.Zero(u.get("a", now))
+
+	u.add("a", 100, now)
+	s.InDelta(100, u.get("a", now), 1e-9)
+	s.InDelta(50, u.get("a", now.Add(time.Minute)), 1e-9)
+	u.add("a", 50, now.Add(time.Minute))
+	s.InDelta(50, u.get("a", now.Add(2*time.Minute)), 1e-9)
+	s.Zero(u.get("b", now))
+
+	u.prune(now.Add(time.Hour))
+	s.Empty(u.m)
+}
+
+func (s *SchedulerSuite) TestSubmitValidation() {
+	sched := s.newScheduler()
+	s.Equal(16, sched.slotCtx)
+
+	_, err := sched.Submit(context.Background(), ScheduledRequest{})
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = sched.Submit(context.Background(), ScheduledRequest{Prompt: make([]LlamaToken, 16)})
+	s.ErrorIs(err, ErrContextFull)
+	_, err = sched.Submit(context.Background(), ScheduledRequest{Prompt: []LlamaToken{1}, Sampling: &SamplingParams{TopK: -1}})
+	s.ErrorIs(err, ErrInvalidSamplingParams)
+
+	// Nobody takes the job: cancellation and Close unblock Submit
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = sched.Submit(ctx, ScheduledRequest{Prompt: []LlamaToken{1}})
+	s.ErrorIs(err, context.Canceled)
+	close(sched.stopped)
+	_, err = sched.Submit(context.Background(), ScheduledRequest{Prompt: []LlamaToken{1}})
+	s.ErrorIs(err, ErrSchedulerClosed)
+}
+
+func (s *SchedulerSuite) TestRequiresContext() {
+	_, err := NewScheduler(nil, SchedulerOptions{})
+	s.ErrorIs(err, ErrContextNotCreated)
+}
+
+func TestSchedulerSuite(t *testing.T) {
+	suite.Run(t, new(SchedulerSuite))
+}
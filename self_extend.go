@@ -0,0 +1,131 @@
+package gollama
+
+import "fmt"
+
+// SelfExtend implements Self-Extend (grouped attention, llama.cpp's
+// --grp-attn-n and --grp-attn-w): as a sequence grows, the positions of
+// older tokens are divided by GroupN in windows of GroupW tokens, so a
+// model sees positions within its training context while the KV cache
+// holds a longer document. Neighbouring tokens keep exact positions and
+// distant ones share grouped positions, which works well enough for tasks
+// such as summarization or retrieval from long inputs without fine-tuning.
+//
+// The context must be created with NCtx large enough for every token (the
+// KV cache is not compressed, only the positions are) and its memory must
+// support shifts (see Memory_can_shift). GroupW must be a multiple of
+// GroupN; GroupN times the model's training context bounds the usable
+// length.
+//
+// Example usage:
+//
+//	ext, err := gollama.NewSelfExtend(ctx, 0, 4, 1024)
+//	if err != nil {
+//		return err
+//	}
+//	nPast, err := ext.DecodeTokens(document, 0)
+//	// sample and call ext.DecodeTokens([]gollama.LlamaToken{tok}, nPast) ...
+type SelfExtend struct {
+	ctx   *Context
+	seqID LlamaSeqId
+
+	// GroupN is the group factor positions are divided by.
+	GroupN int
+	// GroupW is the width of the window grouped at once.
+	GroupW int
+
+	// next is the first position that has not been grouped yet (ga_i in
+	// llama.cpp)
+	next int
+}
+
+// selfExtendOp is a position update of the KV cache: positions in [p0, p1)
+// are increased by delta, or divided by div when div is not 0.
+type selfExtendOp struct {
+	p0, p1 int
+	delta  int
+	div    int
+}
+
+// NewSelfExtend creates a helper that groups the positions of sequence
+// seqID of ctx.
+func NewSelfExtend(ctx *Context, seqID LlamaSeqId, groupN, groupW int) (*SelfExtend, error) {
+	if ctx == nil || ctx.Handle() == 0 {
+		return nil, ErrContextNotCreated
+	}
+	if err := validateSelfExtend(groupN, groupW); err != nil {
+		return nil, err
+	}
+	if !Memory_can_shift(ctx.Handle()) {
+		return nil, fmt.Errorf("%w: the context memory cannot shift positions", ErrInvalidParameter)
+	}
+	return &SelfExtend{ctx: ctx, seqID: seqID, GroupN: groupN, GroupW: groupW}, nil
+}
+
+func validateSelfExtend(groupN, groupW int) error {
+	if groupN < 1 {
+		return fmt.Errorf("%w: group factor must be at least 1, got %d", ErrInvalidParameter, groupN)
+	}
+	if groupW < groupN || groupW%groupN != 0 {
+		return fmt.Errorf("%w: group width %d must be a multiple of the group factor %d", ErrInvalidParameter, groupW, groupN)
+	}
+	return nil
+}
+
+// Reset forgets the grouping done so far, for a sequence that was cleared.
+func (e *SelfExtend) Reset() {
+	e.next = 0
+}
+
+// Apply groups the windows of the sequence that are complete, given the
+// nPast positions in use, and returns the new number of positions, at
+// which decoding continues.
+func (e *SelfExtend) Apply(nPast LlamaPos) LlamaPos {
+	ops, n, next := selfExtendOps(int(nPast), e.next, e.GroupN, e.GroupW)
+	handle := e.ctx.Handle()
+	for _, op := range ops {
+		if op.div > 1 {
+			Memory_seq_div(handle, e.seqID, LlamaPos(op.p0), LlamaPos(op.p1), int32(op.div))
+		} else if op.delta != 0 {
+			Memory_seq_add(handle, e.seqID, LlamaPos(op.p0), LlamaPos(op.p1), LlamaPos(op.delta))
+		}
+	}
+	e.next = next
+	return LlamaPos(n)
+}
+
+// DecodeTokens decodes tokens at nPast in chunks of at most GroupW tokens,
+// grouping positions before each chunk and after the last one. It returns
+// the position for the next token.
+func (e *SelfExtend) DecodeTokens(tokens []LlamaToken, nPast LlamaPos) (LlamaPos, error) {
+	chunk := max(min(int(e.ctx.NBatch), e.GroupW), 1)
+	for start := 0; start < len(tokens); start += chunk {
+		end := min(start+chunk, len(tokens))
+		nPast = e.Apply(nPast)
+		if err := e.ctx.DecodeTokens(tokens[start:end], nPast, e.seqID); err != nil {
+			return nPast, err
+		}
+		nPast += LlamaPos(end - start)
+	}
+	return e.Apply(nPast), nil
+}
+
+// selfExtendOps returns the position updates that group every complete
+// window after position next, as in llama.cpp's main example, together
+// with the new number of positions and the new start of the ungrouped
+// part.
+func selfExtendOps(nPast, next, n, w int) (ops []selfExtendOp, newPast, newNext int) {
+	for nPast >= next+w {
+		ib := (n * next) / w
+		bd := (w / n) * (n - 1)
+		dd := (w / n) - ib*bd - w
+
+		ops = append(ops,
+			selfExtendOp{p0: next, p1: nPast, delta: ib * bd},
+			selfExtendOp{p0: next + ib*bd, p1: next + ib*bd + w, div: n},
+			selfExtendOp{p0: next + ib*bd + w, p1: nPast + ib*bd, delta: dd},
+		)
+		nPast -= bd
+		next += w / n
+	}
+	return ops, nPast, next
+}
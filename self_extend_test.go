@@ -0,0 +1,74 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SelfExtendSuite struct{ BaseSuite }
+
+// applyOps applies the position updates to the positions of the cached
+// tokens, like llama_memory_seq_add and llama_memory_seq_div.
+func applyOps(pos []int, ops []selfExtendOp) {
+	for _, op := range ops {
+		for i, p := range pos {
+			if p < op.p0 || p >= op.p1 {
+				continue
+			}
+			if op.div != 0 {
+				pos[i] = p / op.div
+			} else {
+				pos[i] = p + op.delta
+			}
+		}
+	}
+}
+
+func (s *SelfExtendSuite) TestGroupsCompleteWindows() {
+	pos := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	ops, nPast, next := selfExtendOps(len(pos), 0, 2, 4)
+	applyOps(pos, ops)
+	s.Equal([]int{0, 0, 1, 1, 2, 2, 3, 3}, pos)
+	s.Equal(4, nPast)
+	s.Equal(4, next)
+
+	// Nothing to do until the next window is complete
+	ops, nPast, next = selfExtendOps(nPast+3, next, 2, 4)
+	s.Empty(ops)
+	s.Equal(7, nPast)
+	s.Equal(4, next)
+}
+
+func (s *SelfExtendSuite) TestPositionsStayMonotonic() {
+	const n, w = 4, 16
+	var pos []int
+	nPast, next := 0, 0
+	for i := 0; i < 200; i++ {
+		pos = append(pos, nPast)
+		nPast++
+		var ops []selfExtendOp
+		ops, nPast, next = selfExtendOps(nPast, next, n, w)
+		applyOps(pos, ops)
+	}
+	for i := 1; i < len(pos); i++ {
+		s.LessOrEqual(pos[i-1], pos[i], "position %d", i)
+	}
+	s.Less(pos[len(pos)-1], nPast)
+	s.Less(nPast, 200/n+w+1)
+}
+
+func (s *SelfExtendSuite) TestValidation() {
+	s.NoError(validateSelfExtend(1, 1))
+	s.NoError(validateSelfExtend(4, 512))
+	s.ErrorIs(validateSelfExtend(0, 512), ErrInvalidParameter)
+	s.ErrorIs(validateSelfExtend(4, 510), ErrInvalidParameter)
+	s.ErrorIs(validateSelfExtend(4, 2), ErrInvalidParameter)
+
+	_, err := NewSelfExtend(nil, 0, 4, 512)
+	s.ErrorIs(err, ErrContextNotCreated)
+}
+
+func TestSelfExtendSuite(t *testing.T) {
+	suite.Run(t, new(SelfExtendSuite))
+}
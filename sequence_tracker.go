@@ -0,0 +1,157 @@
+package gollama
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// SequenceTracker records the next position of every sequence of a context,
+// llama.cpp's n_past, so batches are built and checked against one source
+// of truth instead of position counters kept by hand. llama_decode needs
+// the positions of each sequence in a batch to continue, without gaps,
+// where the sequence ended; Validate reports a batch that does not before
+// the decode fails or, worse, corrupts the sequence.
+//
+// The tracker only knows what it is told: call Commit (or Advance) after a
+// successful decode and Truncate after removing positions with SeqRm, or
+// Sync to read the positions back from the context memory.
+//
+// Example usage:
+//
+//	tracker := gollama.NewSequenceTracker(int(ctx.NSeqMax))
+//	for i, tok := range tokens {
+//		_ = batch.Add(tok, tracker.Pos(0)+gollama.LlamaPos(i), []gollama.LlamaSeqId{0}, i == len(tokens)-1)
+//	}
+//	if err := tracker.Validate(batch.Batch()); err != nil {
+//		return err
+//	}
+//	if err := ctx.Decode(batch.Batch()); err != nil {
+//		return err
+//	}
+//	tracker.Commit(batch.Batch())
+type SequenceTracker struct {
+	next []LlamaPos
+}
+
+// NewSequenceTracker creates a tracker for sequences 0 to nSeqMax-1, all
+// empty.
+func NewSequenceTracker(nSeqMax int) *SequenceTracker {
+	return &SequenceTracker{next: make([]LlamaPos, max(nSeqMax, 1))}
+}
+
+// Pos returns the next position of seq, which is also the number of
+// positions it holds, or -1 for a sequence out of range.
+func (t *SequenceTracker) Pos(seq LlamaSeqId) LlamaPos {
+	if !t.valid(seq) {
+		return -1
+	}
+	return t.next[seq]
+}
+
+// Advance records n more positions decoded into seq.
+func (t *SequenceTracker) Advance(seq LlamaSeqId, n int) {
+	if t.valid(seq) && n > 0 {
+		t.next[seq] += LlamaPos(n)
+	}
+}
+
+// Truncate records the removal of the positions of seq from pos on, as
+// done by SeqRm(seq, pos, -1). A negative pos empties the sequence.
+func (t *SequenceTracker) Truncate(seq LlamaSeqId, pos LlamaPos) {
+	if t.valid(seq) {
+		t.next[seq] = min(t.next[seq], max(pos, 0))
+	}
+}
+
+// Reset empties every sequence, as ClearMemory does.
+func (t *SequenceTracker) Reset() {
+	clear(t.next)
+}
+
+// Sync reads the next position of every sequence from the memory of ctx.
+func (t *SequenceTracker) Sync(ctx LlamaContext) {
+	for seq := range t.next {
+		t.next[seq] = Memory_seq_pos_max(ctx, LlamaSeqId(seq)) + 1
+	}
+}
+
+// Validate checks that, for every sequence in batch, the positions of its
+// tokens are exactly the next ones of the sequence, in any order and
+// without duplicates. Errors wrap ErrInvalidParameter and name the first
+// offending token. The tokens of a batch without positions (Batch_get_one)
+// continue sequence 0, as llama.cpp numbers them.
+func (t *SequenceTracker) Validate(batch LlamaBatch) error {
+	seen := make(map[LlamaSeqId]map[LlamaPos]bool)
+	err := forBatchTokens(batch, t.next[0], func(i int, pos LlamaPos, seq LlamaSeqId) error {
+		if !t.valid(seq) {
+			return fmt.Errorf("%w: token %d: sequence %d out of range [0, %d)", ErrInvalidParameter, i, seq, len(t.next))
+		}
+		if pos < t.next[seq] {
+			return fmt.Errorf("%w: token %d: position %d of sequence %d is already decoded (next is %d)", ErrInvalidParameter, i, pos, seq, t.next[seq])
+		}
+		if seen[seq] == nil {
+			seen[seq] = make(map[LlamaPos]bool)
+		}
+		if seen[seq][pos] {
+			return fmt.Errorf("%w: token %d: position %d of sequence %d appears twice", ErrInvalidParameter, i, pos, seq)
+		}
+		seen[seq][pos] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for seq, positions := range seen {
+		for pos := range positions {
+			if pos >= t.next[seq]+LlamaPos(len(positions)) {
+				return fmt.Errorf("%w: sequence %d has a gap: %d positions from %d, but %d among them", ErrInvalidParameter, seq, len(positions), t.next[seq], pos)
+			}
+		}
+	}
+	return nil
+}
+
+// Commit records a decoded batch: every sequence in it continues after the
+// largest position it got.
+func (t *SequenceTracker) Commit(batch LlamaBatch) {
+	_ = forBatchTokens(batch, t.next[0], func(_ int, pos LlamaPos, seq LlamaSeqId) error {
+		if t.valid(seq) {
+			t.next[seq] = max(t.next[seq], pos+1)
+		}
+		return nil
+	})
+}
+
+func (t *SequenceTracker) valid(seq LlamaSeqId) bool {
+	return seq >= 0 && int(seq) < len(t.next)
+}
+
+// forBatchTokens calls fn for every sequence of every token of batch, in
+// order. Like llama_decode, it numbers the tokens of a batch without
+// positions from next, the next position of sequence 0, and puts the
+// tokens of a batch without sequence ids in sequence 0.
+func forBatchTokens(batch LlamaBatch, next LlamaPos, fn func(i int, pos LlamaPos, seq LlamaSeqId) error) error {
+	if batch.NTokens <= 0 {
+		return nil
+	}
+	n := int(batch.NTokens)
+	for i := 0; i < n; i++ {
+		pos := next + LlamaPos(i)
+		if batch.Pos != nil {
+			pos = unsafe.Slice(batch.Pos, n)[i]
+		}
+		if batch.SeqId == nil || batch.NSeqId == nil {
+			if err := fn(i, pos, 0); err != nil {
+				return err
+			}
+			continue
+		}
+		nSeq := int(unsafe.Slice(batch.NSeqId, n)[i])
+		for _, seq := range unsafe.Slice(unsafe.Slice(batch.SeqId, n)[i], nSeq) {
+			if err := fn(i, pos, seq); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
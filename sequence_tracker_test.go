@@ -0,0 +1,88 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SequenceTrackerSuite struct{ BaseSuite }
+
+func (s *SequenceTrackerSuite) SetupTest() {
+	s.BaseSuite.SetupTest()
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+}
+
+// batchOf builds a batch of tokens at the given positions and sequences.
+func (s *SequenceTrackerSuite) batchOf(pos []LlamaPos, seqs [][]LlamaSeqId) *TokenBatch {
+	batch, err := NewTokenBatch(int32(len(pos)), 2)
+	s.Require().NoError(err)
+	for i := range pos {
+		s.Require().NoError(batch.Add(LlamaToken(i), pos[i], seqs[i], false))
+	}
+	return batch
+}
+
+func (s *SequenceTrackerSuite) TestPositions() {
+	t := NewSequenceTracker(2)
+	s.Equal(LlamaPos(0), t.Pos(1))
+	s.Equal(LlamaPos(-1), t.Pos(2))
+	s.Equal(LlamaPos(-1), t.Pos(-1))
+
+	t.Advance(0, 10)
+	t.Advance(0, -3)
+	t.Advance(5, 1)
+	s.Equal(LlamaPos(10), t.Pos(0))
+
+	t.Truncate(0, 12)
+	s.Equal(LlamaPos(10), t.Pos(0))
+	t.Truncate(0, 4)
+	s.Equal(LlamaPos(4), t.Pos(0))
+	t.Truncate(0, -1)
+	s.Equal(LlamaPos(0), t.Pos(0))
+
+	t.Advance(1, 3)
+	t.Reset()
+	s.Equal(LlamaPos(0), t.Pos(1))
+}
+
+func (s *SequenceTrackerSuite) TestValidateAndCommit() {
+	t := NewSequenceTracker(2)
+	t.Advance(0, 3)
+
+	// Sequence 1 shares a token with sequence 0, in any order
+	batch := s.batchOf([]LlamaPos{4, 3, 0}, [][]LlamaSeqId{{0}, {0}, {1, 0}})
+	defer batch.Free()
+	err := t.Validate(batch.Batch())
+	s.ErrorIs(err, ErrInvalidParameter, "position 0 of sequence 0 is decoded")
+
+	ok := s.batchOf([]LlamaPos{4, 3, 0, 1}, [][]LlamaSeqId{{0}, {0}, {1}, {1}})
+	defer ok.Free()
+	s.Require().NoError(t.Validate(ok.Batch()))
+	t.Commit(ok.Batch())
+	s.Equal(LlamaPos(5), t.Pos(0))
+	s.Equal(LlamaPos(2), t.Pos(1))
+
+	for name, bad := range map[string]*TokenBatch{
+		"gap":       s.batchOf([]LlamaPos{5, 7}, [][]LlamaSeqId{{0}, {0}}),
+		"duplicate": s.batchOf([]LlamaPos{5, 5}, [][]LlamaSeqId{{0}, {0}}),
+		"range":     s.batchOf([]LlamaPos{0}, [][]LlamaSeqId{{2}}),
+	} {
+		s.ErrorIs(t.Validate(bad.Batch()), ErrInvalidParameter, name)
+		bad.Free()
+	}
+}
+
+func (s *SequenceTrackerSuite) TestImplicitPositions() {
+	t := NewSequenceTracker(1)
+	t.Advance(0, 2)
+	tokens := []LlamaToken{1, 2, 3}
+	batch := Batch_get_one(tokens)
+	s.NoError(t.Validate(batch))
+	t.Commit(batch)
+	s.Equal(LlamaPos(5), t.Pos(0))
+}
+
+func TestSequenceTrackerSuite(t *testing.T) { suite.Run(t, new(SequenceTrackerSuite)) }
@@ -0,0 +1,437 @@
+package gollama
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+// SpeculativeOptions configures a SpeculativeDecoder.
+type SpeculativeOptions struct {
+	// NDraft is the maximum number of tokens drafted per round (default 8).
+	NDraft int
+	// Temperature of the target distribution; 0 or less selects greedy
+	// decoding, where a draft is accepted only if it is the target's argmax.
+	Temperature float32
+	// Seed seeds the sampling and acceptance tests.
+	Seed int64
+	// NgramMax and NgramMin bound the length of the n-gram matched by
+	// prompt lookup (see NewPromptLookupDecoder); defaults 3 and 1.
+	NgramMax int
+	NgramMin int
+}
+
+// SpeculativeStats reports how well the draft model predicts the target.
+type SpeculativeStats struct {
+	// Rounds is the number of draft/verify rounds.
+	Rounds int
+	// Drafted is the number of tokens proposed by the draft model.
+	Drafted int
+	// Accepted is the number of drafted tokens the target accepted.
+	Accepted int
+	// Generated is the number of tokens produced, including the token the
+	// target samples itself at the end of every round.
+	Generated int
+}
+
+// AcceptanceRate returns the fraction of drafted tokens that were accepted.
+func (s SpeculativeStats) AcceptanceRate() float64 {
+	if s.Drafted == 0 {
+		return 0
+	}
+	return float64(s.Accepted) / float64(s.Drafted)
+}
+
+// SpeculativeDecoder generates text from Target, using the smaller Draft
+// model to propose several tokens that Target verifies in a single decode.
+// Drafts are accepted with probability min(1, p(x)/q(x)) and a rejected
+// draft is replaced by a sample from the residual distribution max(0, p-q),
+// so the output follows the target distribution exactly. Rejected positions
+// are removed from both KV caches with Memory_seq_rm.
+//
+// The decoder uses sequence 0 of both contexts and clears them on Reset.
+// Without a draft model (see NewPromptLookupDecoder) drafts come from
+// prompt lookup instead.
+//
+// Example usage:
+//
+//	dec, err := gollama.NewSpeculativeDecoder(target, draft, gollama.SpeculativeOptions{NDraft: 8})
+//	if err != nil {
+//		return err
+//	}
+//	tokens, err := dec.Generate(prompt, 256, nil)
+//	fmt.Printf("acceptance: %.0f%%\n", 100*dec.Stats().AcceptanceRate())
+type SpeculativeDecoder struct {
+	Target *Context
+	Draft  *Context
+
+	opts  SpeculativeOptions
+	rng   *rand.Rand
+	batch *TokenBatch
+
+	// history holds the prompt and generated tokens. The last token has not
+	// been decoded by either context yet; tgtSeq and dftSeq track the
+	// tokens of history stored in each KV cache, in sequence 0.
+	history []LlamaToken
+	tgtSeq  *SequenceTracker
+	dftSeq  *SequenceTracker
+
+	stats SpeculativeStats
+}
+
+// NewSpeculativeDecoder creates a decoder. target and draft must use the
+// same vocabulary.
+func NewSpeculativeDecoder(target, draft *Context, opts SpeculativeOptions) (*SpeculativeDecoder, error) {
+	if target == nil || draft == nil || target.Handle() == 0 || draft.Handle() == 0 {
+		return nil, ErrContextNotCreated
+	}
+	tm, dm := target.Model(), draft.Model()
+	if tm.NVocab != dm.NVocab || tm.BOS != dm.BOS || tm.EOS != dm.EOS {
+		return nil, fmt.Errorf("%w: draft and target models use different vocabularies", ErrInvalidParameter)
+	}
+	return newSpeculativeDecoder(target, draft, opts)
+}
+
+// NewPromptLookupDecoder creates a decoder that needs no draft model: the
+// drafts are the tokens that followed the most recent earlier occurrence
+// of the last n-gram of the prompt and output, trying NgramMax tokens down
+// to NgramMin. Tasks that copy from their input, such as summarization,
+// extraction or code editing, accept long drafts; otherwise a round costs
+// little more than a normal decode.
+func NewPromptLookupDecoder(target *Context, opts SpeculativeOptions) (*SpeculativeDecoder, error) {
+	if target == nil || target.Handle() == 0 {
+		return nil, ErrContextNotCreated
+	}
+	if opts.NgramMax <= 0 {
+		opts.NgramMax = 3
+	}
+	if opts.NgramMin <= 0 {
+		opts.NgramMin = 1
+	}
+	if opts.NgramMin > opts.NgramMax {
+		return nil, fmt.Errorf("%w: NgramMin %d exceeds NgramMax %d", ErrInvalidParameter, opts.NgramMin, opts.NgramMax)
+	}
+	return newSpeculativeDecoder(target, nil, opts)
+}
+
+func newSpeculativeDecoder(target, draft *Context, opts SpeculativeOptions) (*SpeculativeDecoder, error) {
+	if opts.NDraft <= 0 {
+		opts.NDraft = 8
+	}
+	batch, err := NewTokenBatch(int32(opts.NDraft+1), 1)
+	if err != nil {
+		return nil, err
+	}
+	return &SpeculativeDecoder{
+		Target: target,
+		Draft:  draft,
+		opts:   opts,
+		rng:    rand.New(rand.NewSource(opts.Seed)),
+		batch:  batch,
+		tgtSeq: NewSequenceTracker(1),
+		dftSeq: NewSequenceTracker(1),
+	}, nil
+}
+
+// Reset clears both contexts and starts a new generation from prompt.
+func (d *SpeculativeDecoder) Reset(prompt []LlamaToken) error {
+	if len(prompt) == 0 {
+		return fmt.Errorf("%w: prompt is empty", ErrInvalidParameter)
+	}
+	d.Target.ClearMemory(false)
+	if d.Draft != nil {
+		d.Draft.ClearMemory(false)
+	}
+	d.history = append(d.history[:0], prompt...)
+	d.tgtSeq.Reset()
+	d.dftSeq.Reset()
+	d.stats = SpeculativeStats{}
+	return nil
+}
+
+// Stats returns the statistics since the last Reset.
+func (d *SpeculativeDecoder) Stats() SpeculativeStats {
+	return d.stats
+}
+
+// Step runs one draft/verify round and returns the new tokens: the accepted
+// drafts followed by one token sampled from the target, unless an accepted
+// draft ended generation.
+func (d *SpeculativeDecoder) Step() ([]LlamaToken, error) {
+	if len(d.history) == 0 {
+		return nil, fmt.Errorf("%w: call Reset before Step", ErrInvalidParameter)
+	}
+	base := len(d.history)
+	nCtx := d.Target.NCtx
+	if d.Draft != nil {
+		nCtx = min(nCtx, d.Draft.NCtx)
+	}
+	nDraft := min(d.opts.NDraft, int(nCtx)-base-1)
+	if base >= int(d.Target.NCtx) {
+		return nil, ErrContextFull
+	}
+
+	drafts, qs, err := d.propose(nDraft)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify all drafts with one target decode
+	if err := d.catchUp(d.Target, d.tgtSeq, d.history[:base-1]); err != nil {
+		return nil, fmt.Errorf("target: %w", err)
+	}
+	d.batch.Clear()
+	seq := []LlamaSeqId{0}
+	for i, tok := range append([]LlamaToken{d.history[base-1]}, drafts...) {
+		if err := d.batch.Add(tok, d.tgtSeq.Pos(0)+LlamaPos(i), seq, true); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.tgtSeq.Validate(d.batch.Batch()); err != nil {
+		return nil, fmt.Errorf("target: %w", err)
+	}
+	if err := d.Target.Decode(d.batch.Batch()); err != nil {
+		return nil, fmt.Errorf("target: %w", err)
+	}
+	d.tgtSeq.Commit(d.batch.Batch())
+
+	var accepted []LlamaToken
+	next := LlamaToken(LLAMA_TOKEN_NULL)
+	ended := false
+	for i, tok := range drafts {
+		p := d.distribution(d.Target.Logits(int32(i)))
+		if p == nil {
+			return nil, fmt.Errorf("target: %w", ErrSamplingFailed)
+		}
+		if d.accept(p, qs[i], tok) {
+			accepted = append(accepted, tok)
+			if d.Target.Model().IsEOG(tok) {
+				ended = true
+				break
+			}
+			continue
+		}
+		next = d.sample(residual(p, qs[i]))
+		break
+	}
+	if !ended && next == LLAMA_TOKEN_NULL {
+		p := d.distribution(d.Target.Logits(int32(len(drafts))))
+		if p == nil {
+			return nil, fmt.Errorf("target: %w", ErrSamplingFailed)
+		}
+		next = d.sample(p)
+	}
+
+	// Roll both caches back to the accepted prefix; the draft never
+	// decoded its last draft, so it may hold less already
+	keep := LlamaPos(base + len(accepted))
+	d.tgtSeq.Truncate(0, keep)
+	d.Target.SeqRm(0, d.tgtSeq.Pos(0), -1)
+	if d.Draft != nil {
+		d.dftSeq.Truncate(0, keep)
+		d.Draft.SeqRm(0, d.dftSeq.Pos(0), -1)
+	}
+
+	out := accepted
+	if next != LLAMA_TOKEN_NULL {
+		out = append(out, next)
+	}
+	d.history = append(d.history, out...)
+	d.stats.Rounds++
+	d.stats.Drafted += len(drafts)
+	d.stats.Accepted += len(accepted)
+	d.stats.Generated += len(out)
+	return out, nil
+}
+
+// propose returns up to nDraft draft tokens and the distribution each was
+// drawn from.
+func (d *SpeculativeDecoder) propose(nDraft int) ([]LlamaToken, [][]float64, error) {
+	if d.Draft == nil {
+		drafts := promptLookup(d.history, d.opts.NgramMin, d.opts.NgramMax, nDraft)
+		qs := make([][]float64, len(drafts))
+		for i, tok := range drafts {
+			// A lookup proposes its token with certainty
+			qs[i] = make([]float64, d.Target.Model().NVocab)
+			if int(tok) < len(qs[i]) {
+				qs[i][tok] = 1
+			}
+		}
+		return drafts, qs, nil
+	}
+
+	// Bring the draft up to date and let it propose tokens
+	if err := d.catchUp(d.Draft, d.dftSeq, d.history); err != nil {
+		return nil, nil, fmt.Errorf("draft: %w", err)
+	}
+	var drafts []LlamaToken
+	var qs [][]float64
+	for i := 0; i < nDraft; i++ {
+		q := d.distribution(d.Draft.Logits(-1))
+		if q == nil {
+			return nil, nil, fmt.Errorf("draft: %w", ErrSamplingFailed)
+		}
+		tok := d.sample(q)
+		drafts = append(drafts, tok)
+		qs = append(qs, q)
+		if i == nDraft-1 || d.Target.Model().IsEOG(tok) {
+			break
+		}
+		if err := d.Draft.DecodeTokens([]LlamaToken{tok}, d.dftSeq.Pos(0), 0); err != nil {
+			return nil, nil, fmt.Errorf("draft: %w", err)
+		}
+		d.dftSeq.Advance(0, 1)
+	}
+	return drafts, qs, nil
+}
+
+// catchUp decodes into ctx the tokens of prefix its sequence 0 does not
+// hold yet.
+func (d *SpeculativeDecoder) catchUp(ctx *Context, seq *SequenceTracker, prefix []LlamaToken) error {
+	pos := seq.Pos(0)
+	if int(pos) >= len(prefix) {
+		return nil
+	}
+	if err := ctx.DecodeTokens(prefix[pos:], pos, 0); err != nil {
+		return err
+	}
+	seq.Advance(0, len(prefix)-int(pos))
+	return nil
+}
+
+// promptLookup finds the most recent earlier occurrence of the last n
+// tokens of history, for n from ngramMax down to ngramMin, and returns up
+// to nDraft tokens that followed it.
+func promptLookup(history []LlamaToken, ngramMin, ngramMax, nDraft int) []LlamaToken {
+	if nDraft <= 0 {
+		return nil
+	}
+	for n := min(ngramMax, len(history)-1); n >= max(ngramMin, 1); n-- {
+		key := history[len(history)-n:]
+		for i := len(history) - n - 1; i >= 0; i-- {
+			if slices.Equal(history[i:i+n], key) {
+				end := min(i+n+nDraft, len(history))
+				return append([]LlamaToken(nil), history[i+n:end]...)
+			}
+		}
+	}
+	return nil
+}
+
+// Generate resets the decoder with prompt and produces up to maxTokens
+// tokens, stopping at end of generation. The end-of-generation token is not
+// included. onToken, when set, is called for every token; returning an error
+// stops generation.
+func (d *SpeculativeDecoder) Generate(prompt []LlamaToken, maxTokens int, onToken func(LlamaToken) error) ([]LlamaToken, error) {
+	if err := d.Reset(prompt); err != nil {
+		return nil, err
+	}
+	var out []LlamaToken
+	for len(out) < maxTokens {
+		tokens, err := d.Step()
+		if err != nil {
+			return out, err
+		}
+		for _, tok := range tokens {
+			if d.Target.Model().IsEOG(tok) || len(out) >= maxTokens {
+				return out, nil
+			}
+			out = append(out, tok)
+			if onToken != nil {
+				if err := onToken(tok); err != nil {
+					return out, err
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// Free releases the decoder's batch. The contexts are owned by the caller.
+func (d *SpeculativeDecoder) Free() {
+	if d.batch != nil {
+		d.batch.Free()
+	}
+}
+
+// distribution converts logits to probabilities at the configured
+// temperature. In greedy mode it returns a one-hot distribution.
+func (d *SpeculativeDecoder) distribution(logits []float32) []float64 {
+	if len(logits) == 0 {
+		return nil
+	}
+	p := make([]float64, len(logits))
+	if d.opts.Temperature <= 0 {
+		best := 0
+		for i, l := range logits {
+			if l > logits[best] {
+				best = i
+			}
+		}
+		p[best] = 1
+		return p
+	}
+
+	maxLogit := math.Inf(-1)
+	for _, l := range logits {
+		maxLogit = math.Max(maxLogit, float64(l))
+	}
+	temp := float64(d.opts.Temperature)
+	var sum float64
+	for i, l := range logits {
+		p[i] = math.Exp((float64(l) - maxLogit) / temp)
+		sum += p[i]
+	}
+	for i := range p {
+		p[i] /= sum
+	}
+	return p
+}
+
+// accept decides whether the target keeps draft token tok.
+func (d *SpeculativeDecoder) accept(p, q []float64, tok LlamaToken) bool {
+	if q[tok] <= 0 {
+		return false
+	}
+	ratio := p[tok] / q[tok]
+	return ratio >= 1 || d.rng.Float64() < ratio
+}
+
+// sample draws a token from the probability distribution p.
+func (d *SpeculativeDecoder) sample(p []float64) LlamaToken {
+	r := d.rng.Float64()
+	var sum float64
+	last := 0
+	for i, v := range p {
+		if v <= 0 {
+			continue
+		}
+		sum += v
+		last = i
+		if r < sum {
+			return LlamaToken(i)
+		}
+	}
+	return LlamaToken(last)
+}
+
+// residual returns the normalized distribution max(0, p-q). It falls back
+// to p when the difference vanishes numerically.
+func residual(p, q []float64) []float64 {
+	r := make([]float64, len(p))
+	var sum float64
+	for i := range p {
+		if v := p[i] - q[i]; v > 0 {
+			r[i] = v
+			sum += v
+		}
+	}
+	if sum <= 0 {
+		return p
+	}
+	for i := range r {
+		r[i] /= sum
+	}
+	return r
+}
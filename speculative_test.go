@@ -0,0 +1,88 @@
+package gollama
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SpeculativeSuite struct{ BaseSuite }
+
+func (s *SpeculativeSuite) newDecoder(temp float32) *SpeculativeDecoder {
+	return &SpeculativeDecoder{
+		opts: SpeculativeOptions{Temperature: temp},
+		rng:  rand.New(rand.NewSource(1)),
+	}
+}
+
+func (s *SpeculativeSuite) TestGreedyDistribution() {
+	d := s.newDecoder(0)
+	s.Equal([]float64{0, 0, 1, 0}, d.distribution([]float32{0.1, 2, 3, -1}))
+	s.Nil(d.distribution(nil))
+}
+
+func (s *SpeculativeSuite) TestSoftmax() {
+	p := s.newDecoder(1).distribution([]float32{0, 0, 0, 0})
+	s.InDeltaSlice([]float64{0.25, 0.25, 0.25, 0.25}, p, 1e-9)
+}
+
+func (s *SpeculativeSuite) TestResidual() {
+	r := residual([]float64{0.5, 0.3, 0.2}, []float64{0.7, 0.1, 0.2})
+	s.InDeltaSlice([]float64{0, 1, 0}, r, 1e-9)
+
+	same := []float64{0.5, 0.5}
+	s.Equal(same, residual(same, same))
+}
+
+// The accept/resample scheme must reproduce the target distribution
+// regardless of the draft distribution.
+func (s *SpeculativeSuite) TestOutputFollowsTarget() {
+	d := s.newDecoder(1)
+	p := []float64{0.6, 0.3, 0.1}
+	q := []float64{0.2, 0.2, 0.6}
+
+	const n = 200000
+	counts := make([]float64, len(p))
+	for i := 0; i < n; i++ {
+		tok := d.sample(q)
+		if !d.accept(p, q, tok) {
+			tok = d.sample(residual(p, q))
+		}
+		counts[tok]++
+	}
+	for i := range counts {
+		counts[i] /= n
+	}
+	s.InDeltaSlice(p, counts, 0.01)
+}
+
+func (s *SpeculativeSuite) TestStats() {
+	s.Zero(SpeculativeStats{}.AcceptanceRate())
+	s.InDelta(0.75, SpeculativeStats{Drafted: 8, Accepted: 6}.AcceptanceRate(), 1e-9)
+}
+
+func (s *SpeculativeSuite) TestRequiresContexts() {
+	_, err := NewSpeculativeDecoder(nil, nil, SpeculativeOptions{})
+	s.ErrorIs(err, ErrContextNotCreated)
+}
+
+func (s *SpeculativeSuite) TestPromptLookup() {
+	h := []LlamaToken{1, 2, 3, 4, 5, 9, 2, 3, 7, 2, 3}
+	// The longest match wins over more recent shorter ones
+	s.Equal([]LlamaToken{7, 2}, promptLookup(h, 1, 3, 2))
+	s.Equal([]LlamaToken{7, 2, 3}, promptLookup(h, 1, 3, 8))
+	s.Equal([]LlamaToken{4, 5, 9}, promptLookup([]LlamaToken{1, 2, 3, 4, 5, 9, 1, 2, 3}, 2, 3, 3))
+	s.Equal([]LlamaToken{8, 1}, promptLookup([]LlamaToken{6, 8, 1, 6}, 1, 3, 2))
+	s.Nil(promptLookup([]LlamaToken{1, 2, 3}, 1, 3, 4))
+	s.Nil(promptLookup([]LlamaToken{6, 8, 1, 6}, 2, 3, 4))
+	s.Nil(promptLookup(h, 1, 3, 0))
+	s.Nil(promptLookup(nil, 1, 3, 4))
+}
+
+func (s *SpeculativeSuite) TestPromptLookupRequiresContext() {
+	_, err := NewPromptLookupDecoder(nil, SpeculativeOptions{})
+	s.ErrorIs(err, ErrContextNotCreated)
+}
+
+func TestSpeculativeSuite(t *testing.T) { suite.Run(t, new(SpeculativeSuite)) }
@@ -0,0 +1,65 @@
+package gollama
+
+import "fmt"
+
+// State_seq_get_size returns the number of bytes needed to save the state
+// (KV cache) of sequence seqID.
+func State_seq_get_size(ctx LlamaContext, seqID LlamaSeqId) uint64 {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if ctx == 0 || handleClosed(handleContext, uintptr(ctx)) {
+		return 0
+	}
+	return llamaStateSeqGetSize(ctx, seqID)
+}
+
+// State_seq_get_data copies the state of sequence seqID out of ctx.
+func State_seq_get_data(ctx LlamaContext, seqID LlamaSeqId) ([]byte, error) {
+	release, err := acquireNativeCall("llama_state_seq_get_data")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if ctx == 0 {
+		return nil, ErrContextNotCreated
+	}
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return nil, err
+	}
+
+	size := llamaStateSeqGetSize(ctx, seqID)
+	if size == 0 {
+		return nil, fmt.Errorf("%w: sequence %d has no state", ErrInvalidParameter, seqID)
+	}
+	buf := make([]byte, size)
+	n := llamaStateSeqGetData(ctx, &buf[0], size, seqID)
+	if n == 0 {
+		return nil, fmt.Errorf("failed to copy state of sequence %d", seqID)
+	}
+	allocations.noteState(buf)
+	return buf[:n], nil
+}
+
+// State_seq_set_data loads a state saved with State_seq_get_data into
+// sequence destSeqID. The sequence should be empty beforehand.
+func State_seq_set_data(ctx LlamaContext, data []byte, destSeqID LlamaSeqId) error {
+	release, err := acquireNativeCall("llama_state_seq_set_data")
+	if err != nil {
+		return err
+	}
+	defer release()
+	if ctx == 0 {
+		return ErrContextNotCreated
+	}
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("%w: empty state", ErrInvalidParameter)
+	}
+	if llamaStateSeqSetData(ctx, &data[0], uint64(len(data)), destSeqID) == 0 {
+		return fmt.Errorf("failed to restore state into sequence %d", destSeqID)
+	}
+	return nil
+}
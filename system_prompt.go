@@ -0,0 +1,94 @@
+package gollama
+
+import "fmt"
+
+// SystemPromptSeq is the sequence holding the system prompt of a Context
+// (see Context.SetSystemPrompt). It is reserved while a system prompt is
+// set.
+const SystemPromptSeq LlamaSeqId = 0
+
+// SetSystemPrompt decodes text, with the special tokens of the model, into
+// SystemPromptSeq once; ForkSystemPrompt then starts other sequences from
+// it with Memory_seq_cp, and Generate does so on its own for prompts that
+// start with the system prompt tokens, so the shared prefix is not
+// processed again for every request. Setting the same prompt again does
+// nothing; an empty text removes it. ClearMemory, Reset and SetMode remove
+// it as well.
+//
+// Example usage:
+//
+//	if err := ctx.SetSystemPrompt(system); err != nil {
+//		return err
+//	}
+//	prompt, _ := ctx.Model().Tokenize(system+question, ctx.Model().AddBOS, true)
+//	res, err := ctx.Generate(context.Background(), prompt, gollama.GenerateOptions{SeqID: 1})
+func (c *Context) SetSystemPrompt(text string) error {
+	if c.handle == 0 {
+		return ErrContextNotCreated
+	}
+	if text == "" {
+		c.SeqRm(SystemPromptSeq, 0, -1)
+		c.system = nil
+		return nil
+	}
+	tokens, err := c.model.Tokenize(text, c.model.AddBOS, true)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("%w: system prompt has no tokens", ErrInvalidParameter)
+	}
+	if equalTokens(tokens, c.system) && c.SeqPosMax(SystemPromptSeq) == LlamaPos(len(tokens)-1) {
+		return nil
+	}
+
+	c.system = nil
+	c.SeqRm(SystemPromptSeq, 0, -1)
+	if err := c.DecodeTokens(tokens, 0, SystemPromptSeq); err != nil {
+		c.SeqRm(SystemPromptSeq, 0, -1)
+		return fmt.Errorf("failed to decode system prompt: %w", err)
+	}
+	c.system = tokens
+	return nil
+}
+
+// SystemPrompt returns the tokens of the system prompt, or nil when none
+// is set.
+func (c *Context) SystemPrompt() []LlamaToken {
+	return append([]LlamaToken(nil), c.system...)
+}
+
+// ForkSystemPrompt replaces sequence seqID with a copy of the system
+// prompt and returns the position at which the sequence continues.
+func (c *Context) ForkSystemPrompt(seqID LlamaSeqId) (LlamaPos, error) {
+	if c.handle == 0 {
+		return 0, ErrContextNotCreated
+	}
+	if len(c.system) == 0 {
+		return 0, fmt.Errorf("%w: no system prompt set", ErrInvalidParameter)
+	}
+	if seqID == SystemPromptSeq || seqID < 0 || (c.NSeqMax > 0 && int32(seqID) >= c.NSeqMax) {
+		return 0, fmt.Errorf("%w: sequence %d cannot hold a copy of the system prompt (%d sequences)", ErrInvalidParameter, seqID, c.NSeqMax)
+	}
+	if c.SeqPosMax(SystemPromptSeq) != LlamaPos(len(c.system)-1) {
+		// Something else decoded into or removed from the sequence
+		c.system = nil
+		return 0, fmt.Errorf("%w: the system prompt sequence was modified", ErrInvalidParameter)
+	}
+	c.SeqRm(seqID, 0, -1)
+	Memory_seq_cp(c.handle, SystemPromptSeq, seqID, -1, -1)
+	return LlamaPos(len(c.system)), nil
+}
+
+// systemPrefix returns the length of the system prompt when prompt starts
+// with it and sequence seqID can be forked from it, 0 otherwise.
+func (c *Context) systemPrefix(prompt []LlamaToken, seqID LlamaSeqId) int {
+	n := len(c.system)
+	if n == 0 || seqID == SystemPromptSeq || len(prompt) <= n || !equalTokens(prompt[:n], c.system) {
+		return 0
+	}
+	if c.SeqPosMax(SystemPromptSeq) != LlamaPos(n-1) {
+		return 0
+	}
+	return n
+}
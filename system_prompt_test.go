@@ -0,0 +1,75 @@
+package gollama
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SystemPromptSuite struct{ BaseSuite }
+
+func (s *SystemPromptSuite) TestWithoutContext() {
+	c := &Context{}
+	s.ErrorIs(c.SetSystemPrompt("You are terse."), ErrContextNotCreated)
+	_, err := c.ForkSystemPrompt(1)
+	s.ErrorIs(err, ErrContextNotCreated)
+	s.Nil(c.SystemPrompt())
+}
+
+func (s *SystemPromptSuite) TestSystemPrefix() {
+	c := &Context{system: []LlamaToken{1, 2, 3}}
+	// Without memory the system sequence cannot be checked
+	s.Zero(c.systemPrefix([]LlamaToken{1, 2, 3, 4}, 1))
+	s.Zero(c.systemPrefix([]LlamaToken{1, 2, 3, 4}, SystemPromptSeq))
+	s.Zero(c.systemPrefix([]LlamaToken{1, 2, 3}, 1), "nothing left to decode")
+	s.Zero(c.systemPrefix([]LlamaToken{1, 2, 4, 5}, 1))
+	c.ClearMemory(true)
+	s.Nil(c.SystemPrompt())
+}
+
+func (s *SystemPromptSuite) TestGenerateForksSystemPrompt() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	params := Model_default_params()
+	params.NGpuLayers = 0
+	model, err := LoadModel("./models/tinyllama-1.1b-chat-v1.0.Q2_K.gguf", params)
+	if err != nil {
+		s.T().Skipf("model not available: %v", err)
+	}
+	defer model.Free()
+	ctxParams := Context_default_params()
+	ctxParams.NCtx = 512
+	ctxParams.NSeqMax = 2
+	c, err := NewContext(model, ctxParams)
+	s.Require().NoError(err)
+	defer c.Free()
+
+	const system = "You are a storyteller."
+	prompt, err := model.Tokenize(system+" Once upon a time", model.AddBOS, true)
+	s.Require().NoError(err)
+	sampling := SamplingParams{Temperature: 0, Seed: LLAMA_DEFAULT_SEED}
+	opts := GenerateOptions{MaxTokens: 8, Sampling: &sampling, SeqID: 1}
+	want, err := c.Generate(context.Background(), prompt, opts)
+	s.Require().NoError(err)
+
+	s.Require().NoError(c.SetSystemPrompt(system))
+	n := len(c.SystemPrompt())
+	s.Require().NotZero(n)
+	s.Require().Equal(c.SystemPrompt(), prompt[:n])
+	got, err := c.Generate(context.Background(), prompt, opts)
+	s.Require().NoError(err)
+	s.Equal(want.Tokens, got.Tokens)
+	s.Equal(LlamaPos(n-1), c.SeqPosMax(SystemPromptSeq), "the system prompt is kept")
+
+	pos, err := c.ForkSystemPrompt(1)
+	s.Require().NoError(err)
+	s.Equal(LlamaPos(n), pos)
+	_, err = c.ForkSystemPrompt(SystemPromptSeq)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = c.ForkSystemPrompt(2)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func TestSystemPromptSuite(t *testing.T) { suite.Run(t, new(SystemPromptSuite)) }
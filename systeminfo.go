@@ -0,0 +1,133 @@
+package gollama
+
+import (
+	"runtime"
+	"strings"
+)
+
+// LlamaSystemInfo is the parsed form of Print_system_info, suitable for
+// logging the hardware capabilities an application runs with.
+type LlamaSystemInfo struct {
+	// Raw is the unparsed llama_print_system_info string.
+	Raw string `json:"raw"`
+	// Backends lists the backends that reported features, in report order
+	// (e.g. "CPU", "Metal", "CUDA").
+	Backends []string `json:"backends"`
+	// Features maps each backend to its reported feature values.
+	Features map[string]map[string]string `json:"features"`
+	// Devices lists the ggml backend devices (e.g. "CPU", "Vulkan0").
+	Devices []string `json:"devices,omitempty"`
+	// Threads is the number of logical CPUs available to the process.
+	Threads int `json:"threads"`
+
+	// CPU instruction set extensions
+	AVX    bool `json:"avx"`
+	AVX2   bool `json:"avx2"`
+	AVX512 bool `json:"avx512"`
+	FMA    bool `json:"fma"`
+	F16C   bool `json:"f16c"`
+	NEON   bool `json:"neon"`
+	ARMFMA bool `json:"arm_fma"`
+	SVE    bool `json:"sve"`
+
+	// GPU backends
+	Metal  bool `json:"metal"`
+	CUDA   bool `json:"cuda"`
+	Vulkan bool `json:"vulkan"`
+	HIP    bool `json:"hip"`
+	SYCL   bool `json:"sycl"`
+}
+
+// SystemInfo returns the parsed system information. Backends should be
+// loaded first (see Ggml_backend_load_all); otherwise only device and
+// thread information is available.
+func SystemInfo() (LlamaSystemInfo, error) {
+	if err := ensureLoaded(); err != nil {
+		return LlamaSystemInfo{}, err
+	}
+
+	info := parseSystemInfo(Print_system_info())
+	if count, err := Ggml_backend_dev_count(); err == nil {
+		for i := uint64(0); i < count; i++ {
+			dev, err := Ggml_backend_dev_get(i)
+			if err != nil || dev == 0 {
+				continue
+			}
+			if name, err := Ggml_backend_dev_name(dev); err == nil && name != "" {
+				info.Devices = append(info.Devices, name)
+			}
+		}
+	}
+	for _, dev := range info.Devices {
+		info.markBackend(dev)
+	}
+	return info, nil
+}
+
+// parseSystemInfo parses strings of the form
+// "CPU : SSE3 = 1 | AVX = 1 | ... | Metal : EMBED_LIBRARY = 1 | ...".
+func parseSystemInfo(raw string) LlamaSystemInfo {
+	info := LlamaSystemInfo{
+		Raw:      raw,
+		Features: make(map[string]map[string]string),
+		Threads:  runtime.NumCPU(),
+	}
+
+	backend := ""
+	for _, field := range strings.Split(raw, "|") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		// A new backend section starts with "<name> : "
+		if name, rest, ok := strings.Cut(field, " : "); ok {
+			backend = strings.TrimSpace(name)
+			field = strings.TrimSpace(rest)
+			if _, seen := info.Features[backend]; !seen {
+				info.Features[backend] = make(map[string]string)
+				info.Backends = append(info.Backends, backend)
+				info.markBackend(backend)
+			}
+		}
+		if backend == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		info.Features[backend][strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+
+	if cpu := info.Features["CPU"]; cpu != nil {
+		enabled := func(key string) bool {
+			v, ok := cpu[key]
+			return ok && v != "0"
+		}
+		info.AVX = enabled("AVX")
+		info.AVX2 = enabled("AVX2")
+		info.AVX512 = enabled("AVX512")
+		info.FMA = enabled("FMA")
+		info.F16C = enabled("F16C")
+		info.NEON = enabled("NEON")
+		info.ARMFMA = enabled("ARM_FMA")
+		info.SVE = enabled("SVE")
+	}
+	return info
+}
+
+// markBackend sets the GPU flag matching a backend or device name.
+func (info *LlamaSystemInfo) markBackend(name string) {
+	switch backendForName(name) {
+	case LLAMA_GPU_BACKEND_METAL:
+		info.Metal = true
+	case LLAMA_GPU_BACKEND_CUDA:
+		info.CUDA = true
+	case LLAMA_GPU_BACKEND_VULKAN:
+		info.Vulkan = true
+	case LLAMA_GPU_BACKEND_HIP:
+		info.HIP = true
+	case LLAMA_GPU_BACKEND_SYCL:
+		info.SYCL = true
+	}
+}
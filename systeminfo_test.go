@@ -0,0 +1,91 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SystemInfoSuite struct{ BaseSuite }
+
+func (s *SystemInfoSuite) TestParseCPUReport() {
+	info := parseSystemInfo("CPU : SSE3 = 1 | AVX = 1 | AVX2 = 1 | F16C = 1 | FMA = 1 | AVX512 = 0 | OPENMP = 1 | ")
+	s.Equal([]string{"CPU"}, info.Backends)
+	s.True(info.AVX)
+	s.True(info.AVX2)
+	s.True(info.F16C)
+	s.True(info.FMA)
+	s.False(info.AVX512)
+	s.False(info.NEON)
+	s.Equal("1", info.Features["CPU"]["OPENMP"])
+	s.Positive(info.Threads)
+}
+
+func (s *SystemInfoSuite) TestParseMultipleBackends() {
+	info := parseSystemInfo("Metal : EMBED_LIBRARY = 1 | BF16 = 1 | CPU : NEON = 1 | ARM_FMA = 1 | FP16_VA = 1 | ")
+	s.Equal([]string{"Metal", "CPU"}, info.Backends)
+	s.True(info.Metal)
+	s.True(info.NEON)
+	s.True(info.ARMFMA)
+	s.Equal("1", info.Features["Metal"]["BF16"])
+	s.False(info.CUDA)
+}
+
+func (s *SystemInfoSuite) TestParseEmpty() {
+	info := parseSystemInfo("")
+	s.Empty(info.Backends)
+	s.NotNil(info.Features)
+}
+
+func (s *SystemInfoSuite) TestSystemInfoWithLoadedBackends() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	if err := Ggml_backend_load_all(); err != nil {
+		s.T().Skipf("backends not available: %v", err)
+	}
+	info, err := SystemInfo()
+	s.Require().NoError(err)
+	s.NotEmpty(info.Raw)
+	s.Equal(info.Raw, Print_system_info())
+	s.Contains(info.Backends, "CPU")
+	s.Contains(info.Devices, "CPU")
+}
+
+func (s *SystemInfoSuite) TestLoadedLibraryInfo() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	info, err := LoadedLibraryInfo()
+	s.Require().NoError(err)
+	s.NotEmpty(info.Path)
+	s.Positive(info.Build)
+	s.LessOrEqual(info.LayoutBuild, info.Build)
+	s.NotEmpty(info.GgmlVersion)
+	s.Equal(Print_system_info(), info.SystemInfo)
+
+	if err := Ggml_backend_load_all(); err != nil {
+		s.T().Skipf("backends not available: %v", err)
+	}
+	info, err = LoadedLibraryInfo()
+	s.Require().NoError(err)
+	s.Contains(info.Backends, "CPU")
+}
+
+func (s *SystemInfoSuite) TestLookupSymbols() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	statuses, err := LookupSymbols()
+	s.Require().NoError(err)
+	s.NotEmpty(statuses)
+	for _, st := range statuses {
+		s.True(st.Found, st.Name)
+	}
+
+	statuses, err = LookupSymbols("llama_decode", "llama_no_such_function")
+	s.Require().NoError(err)
+	s.Equal([]SymbolStatus{{"llama_decode", true}, {"llama_no_such_function", false}}, statuses)
+}
+
+func TestSystemInfoSuite(t *testing.T) { suite.Run(t, new(SystemInfoSuite)) }
@@ -0,0 +1,198 @@
+package gollama
+
+import (
+	"fmt"
+	"sync"
+)
+
+// handleKind is a kind of native object registered for teardown. Kinds are
+// freed in declaration order, so objects go before the models they use.
+type handleKind int
+
+const (
+	handleMtmd handleKind = iota
+	handleContext
+	handleSampler
+	handleModel
+	numHandleKinds
+)
+
+// String returns the name of the kind used in errors.
+func (k handleKind) String() string {
+	switch k {
+	case handleMtmd:
+		return "multimodal context"
+	case handleContext:
+		return "context"
+	case handleSampler:
+		return "sampler"
+	case handleModel:
+		return "model"
+	default:
+		return fmt.Sprintf("handleKind(%d)", int(k))
+	}
+}
+
+// liveHandles holds the native objects created through the bindings and not
+// freed yet. It makes the free functions no-ops on handles already freed
+// and lets Backend_free release whatever is still alive, children first.
+// Batches are kept in ownedBatches.
+var liveHandles = struct {
+	sync.Mutex
+	m [numHandleKinds]map[uintptr]struct{}
+}{}
+
+// registerHandle records a new native object.
+func registerHandle(kind handleKind, h uintptr) {
+	if h == 0 {
+		return
+	}
+	liveHandles.Lock()
+	defer liveHandles.Unlock()
+	if liveHandles.m[kind] == nil {
+		liveHandles.m[kind] = make(map[uintptr]struct{})
+	}
+	liveHandles.m[kind][h] = struct{}{}
+	reopenHandle(kind, h)
+}
+
+// releaseHandle forgets h and reports whether it was live, i.e. whether the
+// caller must free it. Concurrent frees of the same handle see true once.
+func releaseHandle(kind handleKind, h uintptr) bool {
+	liveHandles.Lock()
+	defer liveHandles.Unlock()
+	if _, ok := liveHandles.m[kind][h]; !ok {
+		return false
+	}
+	delete(liveHandles.m[kind], h)
+	return true
+}
+
+// closeHandle is releaseHandle for a handle being freed, which calls made
+// with it later must not reach (see checkHandle).
+func closeHandle(kind handleKind, h uintptr) bool {
+	if !releaseHandle(kind, h) {
+		return false
+	}
+	markClosed(kind, h)
+	return true
+}
+
+// maxClosedHandles bounds the freed handles remembered per kind.
+const maxClosedHandles = 4096
+
+// closedHandles holds handles freed through the bindings, oldest first in
+// order. A handle leaves it when the allocator returns the same address
+// for a new object, and the oldest are forgotten past maxClosedHandles, so
+// it catches the common use-after-free and double-free bugs, not every
+// stale handle.
+var closedHandles = struct {
+	sync.RWMutex
+	m     [numHandleKinds]map[uintptr]struct{}
+	order [numHandleKinds][]uintptr
+}{}
+
+// markClosed records h as freed.
+func markClosed(kind handleKind, h uintptr) {
+	closedHandles.Lock()
+	defer closedHandles.Unlock()
+	if closedHandles.m[kind] == nil {
+		closedHandles.m[kind] = make(map[uintptr]struct{})
+	}
+	if _, ok := closedHandles.m[kind][h]; ok {
+		return
+	}
+	if len(closedHandles.order[kind]) >= maxClosedHandles {
+		delete(closedHandles.m[kind], closedHandles.order[kind][0])
+		closedHandles.order[kind] = closedHandles.order[kind][1:]
+	}
+	closedHandles.m[kind][h] = struct{}{}
+	closedHandles.order[kind] = append(closedHandles.order[kind], h)
+}
+
+// reopenHandle forgets that h was freed, because a new object got its
+// address.
+func reopenHandle(kind handleKind, h uintptr) {
+	closedHandles.Lock()
+	defer closedHandles.Unlock()
+	if _, ok := closedHandles.m[kind][h]; !ok {
+		return
+	}
+	delete(closedHandles.m[kind], h)
+	order := closedHandles.order[kind]
+	for i, c := range order {
+		if c == h {
+			closedHandles.order[kind] = append(order[:i], order[i+1:]...)
+			break
+		}
+	}
+}
+
+// handleClosed reports whether h was freed through the bindings.
+func handleClosed(kind handleKind, h uintptr) bool {
+	closedHandles.RLock()
+	defer closedHandles.RUnlock()
+	_, ok := closedHandles.m[kind][h]
+	return ok
+}
+
+// checkHandle returns ErrClosedHandle when h was freed. Handles the
+// bindings never saw pass, so 0 must still be checked by the caller.
+func checkHandle(kind handleKind, h uintptr) error {
+	if h != 0 && handleClosed(kind, h) {
+		return fmt.Errorf("%w: %s 0x%x was freed", ErrClosedHandle, kind, h)
+	}
+	return nil
+}
+
+// handlesOf returns the live handles of kind.
+func handlesOf(kind handleKind) []uintptr {
+	liveHandles.Lock()
+	defer liveHandles.Unlock()
+	hs := make([]uintptr, 0, len(liveHandles.m[kind]))
+	for h := range liveHandles.m[kind] {
+		hs = append(hs, h)
+	}
+	return hs
+}
+
+// freeLiveHandles frees every object still alive: multimodal contexts,
+// contexts, samplers and batches, then the models they were created from.
+func freeLiveHandles() {
+	for _, h := range handlesOf(handleMtmd) {
+		Mtmd_free(MtmdContext(h))
+	}
+	for _, h := range handlesOf(handleContext) {
+		Free(LlamaContext(h))
+	}
+	for _, h := range handlesOf(handleSampler) {
+		Sampler_free(LlamaSampler(h))
+	}
+	for _, b := range ownedBatchList() {
+		Batch_free(b)
+	}
+	for _, h := range handlesOf(handleModel) {
+		Model_free(LlamaModel(h))
+	}
+}
+
+// forgetLiveHandles drops every registered object without freeing it. The
+// objects of an unloaded library cannot be freed through the next one, nor
+// used with it, so they count as closed.
+func forgetLiveHandles() {
+	liveHandles.Lock()
+	live := liveHandles.m
+	for kind := range liveHandles.m {
+		liveHandles.m[kind] = nil
+	}
+	liveHandles.Unlock()
+	for kind, hs := range live {
+		for h := range hs {
+			markClosed(handleKind(kind), h)
+		}
+	}
+
+	ownedBatches.Lock()
+	ownedBatches.m = make(map[uintptr]LlamaBatch)
+	ownedBatches.Unlock()
+}
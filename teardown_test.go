@@ -0,0 +1,149 @@
+package gollama
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TeardownSuite struct{ BaseSuite }
+
+func (s *TeardownSuite) TestReleaseHandleOnce() {
+	registerHandle(handleContext, 0x1234)
+	s.Contains(handlesOf(handleContext), uintptr(0x1234))
+	s.True(releaseHandle(handleContext, 0x1234))
+	s.False(releaseHandle(handleContext, 0x1234))
+	s.False(releaseHandle(handleModel, 0x5678))
+	s.NotContains(handlesOf(handleContext), uintptr(0x1234))
+
+	registerHandle(handleModel, 0)
+	s.Empty(handlesOf(handleModel))
+}
+
+func (s *TeardownSuite) TestClosedHandles() {
+	registerHandle(handleContext, 0x2468)
+	s.NoError(checkHandle(handleContext, 0x2468))
+	s.True(closeHandle(handleContext, 0x2468))
+	s.False(closeHandle(handleContext, 0x2468))
+	err := checkHandle(handleContext, 0x2468)
+	s.ErrorIs(err, ErrClosedHandle)
+	s.Contains(err.Error(), "context 0x2468")
+	s.NoError(checkHandle(handleModel, 0x2468))
+	s.NoError(checkHandle(handleContext, 0))
+
+	// A new object at the same address is valid again
+	registerHandle(handleContext, 0x2468)
+	s.NoError(checkHandle(handleContext, 0x2468))
+	s.True(closeHandle(handleContext, 0x2468))
+
+	// Handles given away are not closed
+	registerHandle(handleSampler, 0x1357)
+	s.True(releaseHandle(handleSampler, 0x1357))
+	s.NoError(checkHandle(handleSampler, 0x1357))
+}
+
+func (s *TeardownSuite) TestClosedHandlesAreBounded() {
+	for h := uintptr(1); h <= maxClosedHandles+1; h++ {
+		markClosed(handleModel, 0x10000+h)
+	}
+	s.False(handleClosed(handleModel, 0x10001))
+	s.True(handleClosed(handleModel, 0x10002))
+	s.True(handleClosed(handleModel, 0x10000+maxClosedHandles+1))
+}
+
+func (s *TeardownSuite) TestCallsWithClosedHandles() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	registerHandle(handleContext, 0x3579)
+	s.True(closeHandle(handleContext, 0x3579))
+	registerHandle(handleModel, 0x3579)
+	s.True(closeHandle(handleModel, 0x3579))
+	ctx, model := LlamaContext(0x3579), LlamaModel(0x3579)
+
+	s.ErrorIs(Decode(ctx, LlamaBatch{}), ErrClosedHandle)
+	s.ErrorIs(Encode(ctx, LlamaBatch{}), ErrClosedHandle)
+	_, err := Logits(ctx)
+	s.ErrorIs(err, ErrClosedHandle)
+	_, err = State_seq_get_data(ctx, 0)
+	s.ErrorIs(err, ErrClosedHandle)
+	_, err = Tokenize(model, "hello", false, false)
+	s.ErrorIs(err, ErrClosedHandle)
+	_, err = Init_from_model(model, Context_default_params())
+	s.ErrorIs(err, ErrClosedHandle)
+	_, err = ModelNEmbd(model)
+	s.ErrorIs(err, ErrClosedHandle)
+	_, err = TokenDataArrayInit(model)
+	s.ErrorIs(err, ErrClosedHandle)
+	s.NotPanics(func() {
+		s.Nil(Get_logits(ctx))
+		s.Zero(N_ctx(ctx))
+		s.False(Memory_seq_rm(ctx, 0, 0, -1))
+		s.Zero(Model_n_embd(model))
+		s.Zero(Vocab_n_tokens(model))
+		s.Equal(LlamaToken(LLAMA_TOKEN_NULL), Sampler_sample(0, ctx, -1))
+		Free(ctx)
+		Model_free(model)
+	})
+}
+
+func (s *TeardownSuite) TestFreeUnknownHandlesIsNoop() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	s.NotPanics(func() {
+		Free(LlamaContext(0x1234))
+		Model_free(LlamaModel(0x1234))
+		Sampler_free(LlamaSampler(0x1234))
+	})
+}
+
+func (s *TeardownSuite) TestBackendFreeReleasesChildren() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	s.Require().NoError(Backend_init())
+
+	chain := Sampler_chain_init(Sampler_chain_default_params())
+	greedy := Sampler_init_greedy()
+	Sampler_chain_add(chain, greedy)
+	batch := Batch_init(4, 0, 1)
+	s.Contains(handlesOf(handleSampler), uintptr(chain))
+	s.NotContains(handlesOf(handleSampler), uintptr(greedy))
+
+	Backend_free()
+	s.Empty(handlesOf(handleSampler))
+	s.Zero(liveBatches())
+
+	// Deferred frees running after Backend_free do nothing
+	s.NotPanics(func() {
+		Sampler_free(greedy)
+		Sampler_free(chain)
+		Batch_free(batch)
+	})
+}
+
+func (s *TeardownSuite) TestBackendFreeBeforeModelAndContext() {
+	modelPath := "./models/tinyllama-1.1b-chat-v1.0.Q2_K.gguf"
+	if _, err := os.Stat(modelPath); err != nil {
+		s.T().Skipf("model not available at %s", modelPath)
+	}
+	s.Require().NoError(Backend_init())
+	model, err := LoadModel(modelPath, Model_default_params())
+	s.Require().NoError(err)
+	params := Context_default_params()
+	params.NCtx = 256
+	ctx, err := NewContext(model, params)
+	s.Require().NoError(err)
+
+	Backend_free()
+	s.Empty(handlesOf(handleContext))
+	s.Empty(handlesOf(handleModel))
+	s.NotPanics(func() {
+		ctx.Free()
+		model.Free()
+	})
+}
+
+func TestTeardownSuite(t *testing.T) { suite.Run(t, new(TeardownSuite)) }
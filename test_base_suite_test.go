@@ -21,6 +21,7 @@ type BaseSuite struct {
 // envKeys are the environment variables we preserve across tests
 var envKeys = []string{
 	"GOLLAMA_CACHE_DIR",
+	"GOLLAMA_USE_SYSTEM_CACHE",
 	"GOLLAMA_LIBRARY_PATH",
 	"GOLLAMA_USE_EMBEDDED",
 	"GOLLAMA_ENABLE_LOGGING",
@@ -0,0 +1,112 @@
+package gollama
+
+import "time"
+
+// processStart is the origin of Time_us when the library is not loaded.
+var processStart = time.Now()
+
+// Time_us returns the current time of the llama.cpp monotonic clock in
+// microseconds. Before the library is loaded it falls back to the time
+// elapsed since the process started, so only compare values obtained
+// while the library stays in the same state.
+func Time_us() int64 {
+	libMutex.RLock()
+	loaded := isLoaded
+	libMutex.RUnlock()
+	if !loaded || llamaTimeUs == nil {
+		return time.Since(processStart).Microseconds()
+	}
+	return llamaTimeUs()
+}
+
+// Timings reports the latency of a generation in the units of PerfStats.
+type Timings struct {
+	PromptTokens int     `json:"prompt_tokens"`
+	PromptMs     float64 `json:"prompt_ms"`
+	// TimeToFirstTokenMs runs from the start of the generation, prompt
+	// processing included, to the first generated token
+	TimeToFirstTokenMs float64 `json:"time_to_first_token_ms"`
+	GeneratedTokens    int     `json:"generated_tokens"`
+	// GenerationMs runs from the end of prompt processing to the last
+	// generated token
+	GenerationMs float64 `json:"generation_ms"`
+	// TokenLatenciesMs holds the time taken by each generated token, since
+	// the previous one or the end of prompt processing
+	TokenLatenciesMs []float64 `json:"token_latencies_ms,omitempty"`
+
+	// PromptTokensPerSecond and TokensPerSecond are 0 when nothing was timed.
+	PromptTokensPerSecond float64 `json:"prompt_tokens_per_second"`
+	TokensPerSecond       float64 `json:"tokens_per_second"`
+}
+
+// Timing measures a generation step by step with Time_us.
+//
+// Example usage:
+//
+//	timing := gollama.NewTiming()
+//	// decode the prompt
+//	timing.PromptProcessed(len(prompt))
+//	for generating {
+//		// sample a token
+//		timing.TokenGenerated()
+//	}
+//	fmt.Printf("%.1f tokens/s\n", timing.Timings().TokensPerSecond)
+type Timing struct {
+	now               func() int64
+	start, prompt     int64
+	last              int64
+	promptTokens      int
+	firstToken        int64
+	latencies         []float64
+	promptDone, began bool
+}
+
+// NewTiming starts timing a generation.
+func NewTiming() *Timing {
+	t := &Timing{now: Time_us}
+	t.start = t.now()
+	t.last = t.start
+	return t
+}
+
+// PromptProcessed records the end of prompt processing.
+func (t *Timing) PromptProcessed(nTokens int) {
+	t.prompt = t.now()
+	t.last = t.prompt
+	t.promptTokens = nTokens
+	t.promptDone = true
+}
+
+// TokenGenerated records a generated token.
+func (t *Timing) TokenGenerated() {
+	now := t.now()
+	if !t.began {
+		t.firstToken = now
+		t.began = true
+	}
+	t.latencies = append(t.latencies, usToMs(now-t.last))
+	t.last = now
+}
+
+// Timings returns the measurements so far.
+func (t *Timing) Timings() Timings {
+	res := Timings{
+		PromptTokens:     t.promptTokens,
+		GeneratedTokens:  len(t.latencies),
+		TokenLatenciesMs: append([]float64(nil), t.latencies...),
+	}
+	if t.promptDone {
+		res.PromptMs = usToMs(t.prompt - t.start)
+		res.GenerationMs = usToMs(t.last - t.prompt)
+	}
+	if t.began {
+		res.TimeToFirstTokenMs = usToMs(t.firstToken - t.start)
+	}
+	res.PromptTokensPerSecond = tokensPerSecond(int32(res.PromptTokens), res.PromptMs)
+	res.TokensPerSecond = tokensPerSecond(int32(res.GeneratedTokens), res.GenerationMs)
+	return res
+}
+
+func usToMs(us int64) float64 {
+	return float64(us) / 1000
+}
@@ -0,0 +1,48 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TimingSuite struct{ BaseSuite }
+
+func (s *TimingSuite) TestTimings() {
+	clock := int64(1_000_000)
+	t := &Timing{now: func() int64 { return clock }}
+	t.start, t.last = clock, clock
+	s.Equal(Timings{TokenLatenciesMs: nil}, t.Timings())
+
+	clock += 200_000
+	t.PromptProcessed(100)
+	clock += 50_000
+	t.TokenGenerated()
+	clock += 30_000
+	t.TokenGenerated()
+	clock += 20_000
+	t.TokenGenerated()
+
+	got := t.Timings()
+	s.Equal(100, got.PromptTokens)
+	s.InDelta(200, got.PromptMs, 1e-9)
+	s.InDelta(250, got.TimeToFirstTokenMs, 1e-9)
+	s.Equal(3, got.GeneratedTokens)
+	s.InDelta(100, got.GenerationMs, 1e-9)
+	s.Equal([]float64{50, 30, 20}, got.TokenLatenciesMs)
+	s.InDelta(500, got.PromptTokensPerSecond, 1e-9)
+	s.InDelta(30, got.TokensPerSecond, 1e-9)
+}
+
+func (s *TimingSuite) TestTimeUs() {
+	first := Time_us()
+	second := Time_us()
+	s.GreaterOrEqual(second, first)
+
+	t := NewTiming()
+	t.PromptProcessed(1)
+	t.TokenGenerated()
+	s.Equal(1, t.Timings().GeneratedTokens)
+}
+
+func TestTimingSuite(t *testing.T) { suite.Run(t, new(TimingSuite)) }
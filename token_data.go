@@ -0,0 +1,106 @@
+package gollama
+
+import (
+	"math"
+	"sort"
+	"unsafe"
+)
+
+// NewTokenDataArray creates a token data array from a row of logits, such
+// as Context.Logits returns; the token id of each entry is its index. When
+// limit is positive and smaller than the row, only the limit tokens with
+// the largest logits are kept, sorted by descending logit. It returns nil
+// for an empty row.
+//
+// The array owns a copy of the logits and can be filtered with
+// ApplySoftmax, TopK and TopP for custom sampling.
+//
+// Example usage:
+//
+//	cur := gollama.NewTokenDataArray(ctx.Logits(-1), 0)
+//	cur.TopK(40)
+//	cur.TopP(0.9, 1)
+//	best := cur.Slice()[0]
+func NewTokenDataArray(logits []float32, limit int) *LlamaTokenDataArray {
+	if len(logits) == 0 {
+		return nil
+	}
+	data := make([]LlamaTokenData, len(logits))
+	for i, l := range logits {
+		data[i] = LlamaTokenData{Id: LlamaToken(i), Logit: l}
+	}
+	arr := &LlamaTokenDataArray{Data: &data[0], Size: uint64(len(data)), Selected: -1}
+	if limit > 0 && limit < len(data) {
+		arr.TopK(limit)
+	}
+	return arr
+}
+
+// Slice returns the entries of the array. The slice aliases the array.
+func (a *LlamaTokenDataArray) Slice() []LlamaTokenData {
+	if a == nil || a.Data == nil || a.Size == 0 {
+		return nil
+	}
+	return unsafe.Slice(a.Data, a.Size)
+}
+
+// sortByLogit sorts the entries by descending logit, unless they are
+// sorted already.
+func (a *LlamaTokenDataArray) sortByLogit() {
+	if a.Sorted != 0 {
+		return
+	}
+	data := a.Slice()
+	sort.SliceStable(data, func(i, j int) bool { return data[i].Logit > data[j].Logit })
+	a.Sorted = 1
+}
+
+// ApplySoftmax sorts the entries by descending logit and sets P to the
+// softmax of the logits, like llama.cpp's softmax sampler.
+func (a *LlamaTokenDataArray) ApplySoftmax() {
+	data := a.Slice()
+	if len(data) == 0 {
+		return
+	}
+	a.sortByLogit()
+	maxLogit := data[0].Logit
+	var sum float64
+	for i := range data {
+		p := math.Exp(float64(data[i].Logit - maxLogit))
+		data[i].P = float32(p)
+		sum += p
+	}
+	for i := range data {
+		data[i].P = float32(float64(data[i].P) / sum)
+	}
+}
+
+// TopK keeps the k entries with the largest logits, sorted by descending
+// logit. k <= 0 leaves the array unchanged.
+func (a *LlamaTokenDataArray) TopK(k int) {
+	if k <= 0 || a.Slice() == nil {
+		return
+	}
+	a.sortByLogit()
+	a.Size = uint64(min(k, int(a.Size)))
+}
+
+// TopP applies nucleus sampling: after ApplySoftmax, only the smallest
+// prefix of entries whose probabilities add up to at least p is kept, and
+// at least minKeep entries. p >= 1 leaves the array unchanged. The
+// probabilities are not renormalized.
+func (a *LlamaTokenDataArray) TopP(p float32, minKeep int) {
+	if p >= 1 || a.Slice() == nil {
+		return
+	}
+	a.ApplySoftmax()
+	data := a.Slice()
+	var cum float32
+	for i := range data {
+		cum += data[i].P
+		if cum >= p && i+1 >= minKeep {
+			a.Size = uint64(i + 1)
+			return
+		}
+	}
+}
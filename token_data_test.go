@@ -0,0 +1,77 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TokenDataSuite struct{ BaseSuite }
+
+func ids(a *LlamaTokenDataArray) []LlamaToken {
+	var out []LlamaToken
+	for _, d := range a.Slice() {
+		out = append(out, d.Id)
+	}
+	return out
+}
+
+func (s *TokenDataSuite) TestNewTokenDataArray() {
+	s.Nil(NewTokenDataArray(nil, 0))
+
+	logits := []float32{0.5, 3, -1, 2}
+	arr := NewTokenDataArray(logits, 0)
+	s.Equal(uint64(4), arr.Size)
+	s.Equal(int64(-1), arr.Selected)
+	s.Equal([]LlamaToken{0, 1, 2, 3}, ids(arr))
+	s.Equal(uint8(0), arr.Sorted)
+
+	// The array owns a copy
+	logits[0] = 100
+	s.Equal(float32(0.5), arr.Slice()[0].Logit)
+
+	arr = NewTokenDataArray([]float32{0.5, 3, -1, 2}, 2)
+	s.Equal([]LlamaToken{1, 3}, ids(arr))
+	s.Equal(uint8(1), arr.Sorted)
+}
+
+func (s *TokenDataSuite) TestApplySoftmax() {
+	arr := NewTokenDataArray([]float32{0, 0, 0, 0}, 0)
+	arr.ApplySoftmax()
+	for _, d := range arr.Slice() {
+		s.InDelta(0.25, d.P, 1e-6)
+	}
+
+	arr = NewTokenDataArray([]float32{1, 1000, 2}, 0)
+	arr.ApplySoftmax()
+	s.Equal(LlamaToken(1), arr.Slice()[0].Id)
+	s.InDelta(1, arr.Slice()[0].P, 1e-6)
+}
+
+func (s *TokenDataSuite) TestTopKAndTopP() {
+	arr := NewTokenDataArray([]float32{0.5, 3, -1, 2, 3.5}, 0)
+	arr.TopK(0)
+	s.Equal(uint64(5), arr.Size)
+	arr.TopK(3)
+	s.Equal([]LlamaToken{4, 1, 3}, ids(arr))
+	arr.TopK(10)
+	s.Equal(uint64(3), arr.Size)
+
+	// Probabilities 0.5, 0.25, 0.25: p=0.6 needs two entries
+	arr = NewTokenDataArray([]float32{0, 0.6931472, 0}, 0)
+	arr.TopP(1, 1)
+	s.Equal(uint64(3), arr.Size)
+	arr.TopP(0.6, 1)
+	s.Equal(uint64(2), arr.Size)
+	s.Equal(LlamaToken(1), arr.Slice()[0].Id)
+	arr.TopP(0.1, 1)
+	s.Equal(uint64(1), arr.Size)
+
+	arr = NewTokenDataArray([]float32{0, 10, 0}, 0)
+	arr.TopP(0.1, 2)
+	s.Equal(uint64(2), arr.Size)
+}
+
+func TestTokenDataSuite(t *testing.T) {
+	suite.Run(t, new(TokenDataSuite))
+}
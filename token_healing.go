@@ -0,0 +1,115 @@
+package gollama
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// TokenPrefixIndex finds the tokens of a vocabulary whose piece starts with
+// a given string, as token healing needs. Model.PrefixIndex builds one per
+// model on first use.
+type TokenPrefixIndex struct {
+	// pieces and tokens are sorted by piece
+	pieces []string
+	tokens []LlamaToken
+}
+
+// NewTokenPrefixIndex indexes the pieces of every token of model. Tokens
+// without a piece, such as control tokens, are not indexed.
+func NewTokenPrefixIndex(model *Model) *TokenPrefixIndex {
+	pieces := make([]string, model.NVocab)
+	for i := range pieces {
+		pieces[i] = Token_to_piece(model.Handle(), LlamaToken(i), false)
+	}
+	return newTokenPrefixIndex(pieces)
+}
+
+// newTokenPrefixIndex indexes pieces, the piece of each token id.
+func newTokenPrefixIndex(pieces []string) *TokenPrefixIndex {
+	ix := &TokenPrefixIndex{}
+	for t, p := range pieces {
+		if p != "" {
+			ix.tokens = append(ix.tokens, LlamaToken(t))
+		}
+	}
+	sort.SliceStable(ix.tokens, func(i, j int) bool { return pieces[ix.tokens[i]] < pieces[ix.tokens[j]] })
+	ix.pieces = make([]string, len(ix.tokens))
+	for i, t := range ix.tokens {
+		ix.pieces[i] = pieces[t]
+	}
+	return ix
+}
+
+// Len returns the number of indexed tokens.
+func (ix *TokenPrefixIndex) Len() int {
+	return len(ix.tokens)
+}
+
+// WithPrefix returns the tokens whose piece starts with prefix, ordered by
+// piece.
+func (ix *TokenPrefixIndex) WithPrefix(prefix string) []LlamaToken {
+	lo := sort.SearchStrings(ix.pieces, prefix)
+	hi := lo
+	for hi < len(ix.pieces) && strings.HasPrefix(ix.pieces[hi], prefix) {
+		hi++
+	}
+	return append([]LlamaToken(nil), ix.tokens[lo:hi]...)
+}
+
+// PrefixIndex returns the prefix index of the model's vocabulary, building
+// it on first use.
+func (m *Model) PrefixIndex() *TokenPrefixIndex {
+	m.prefixOnce.Do(func() { m.prefixIndex = NewTokenPrefixIndex(m) })
+	return m.prefixIndex
+}
+
+// HealPrompt prepares prompt for token healing. A prompt ending mid-word,
+// such as "https://exa", ends with a token ("exa") the model would rarely
+// have produced there, which skews the completion. HealPrompt drops that
+// last token and returns its piece along with the tokens whose piece
+// starts with it; constraining the first generated token to them lets the
+// model pick the natural tokenization ("example"). The piece must then be
+// trimmed from the start of the output.
+//
+// The prompt is returned unchanged, with an empty piece, when it has fewer
+// than two tokens or ends with a token without a piece.
+//
+// Context.Generate does all of this with GenerateOptions.TokenHealing.
+func HealPrompt(model *Model, prompt []LlamaToken) (healed []LlamaToken, piece string, allowed []LlamaToken) {
+	healed, piece = healPrompt(prompt, func(t LlamaToken) string {
+		return Token_to_piece(model.Handle(), t, false)
+	})
+	if piece == "" {
+		return prompt, "", nil
+	}
+	return healed, piece, model.PrefixIndex().WithPrefix(piece)
+}
+
+// healPrompt splits the last token off prompt when it has a piece.
+func healPrompt(prompt []LlamaToken, piece func(LlamaToken) string) ([]LlamaToken, string) {
+	if len(prompt) < 2 {
+		return prompt, ""
+	}
+	p := piece(prompt[len(prompt)-1])
+	if p == "" {
+		return prompt, ""
+	}
+	return prompt[:len(prompt)-1], p
+}
+
+// maskLogits sets the logits of every token but allowed to -Inf.
+func maskLogits(logits []float32, allowed []LlamaToken) {
+	keep := make([]bool, len(logits))
+	for _, t := range allowed {
+		if t >= 0 && int(t) < len(keep) {
+			keep[t] = true
+		}
+	}
+	negInf := float32(math.Inf(-1))
+	for i := range logits {
+		if !keep[i] {
+			logits[i] = negInf
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package gollama
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TokenHealingSuite struct{ BaseSuite }
+
+func (s *TokenHealingSuite) TestPrefixIndex() {
+	ix := newTokenPrefixIndex([]string{"", "ex", "example", " ex", "exa", "b", "exam"})
+	s.Equal(6, ix.Len())
+	s.Equal([]LlamaToken{1, 4, 6, 2}, ix.WithPrefix("ex"))
+	s.Equal([]LlamaToken{4, 6, 2}, ix.WithPrefix("exa"))
+	s.Equal([]LlamaToken{3}, ix.WithPrefix(" "))
+	s.Empty(ix.WithPrefix("z"))
+	s.Len(ix.WithPrefix(""), 6)
+}
+
+func (s *TokenHealingSuite) TestHealPrompt() {
+	pieces := map[LlamaToken]string{1: "", 2: "https", 3: "://", 4: "exa"}
+	piece := func(t LlamaToken) string { return pieces[t] }
+
+	healed, p := healPrompt([]LlamaToken{1, 2, 3, 4}, piece)
+	s.Equal([]LlamaToken{1, 2, 3}, healed)
+	s.Equal("exa", p)
+
+	// A single token or one without a piece is kept
+	healed, p = healPrompt([]LlamaToken{4}, piece)
+	s.Equal([]LlamaToken{4}, healed)
+	s.Empty(p)
+	healed, p = healPrompt([]LlamaToken{2, 1}, piece)
+	s.Equal([]LlamaToken{2, 1}, healed)
+	s.Empty(p)
+}
+
+func (s *TokenHealingSuite) TestMaskLogits() {
+	logits := []float32{1, 2, 3, 4}
+	maskLogits(logits, []LlamaToken{1, 3, 9})
+	s.True(math.IsInf(float64(logits[0]), -1))
+	s.Equal(float32(2), logits[1])
+	s.True(math.IsInf(float64(logits[2]), -1))
+	s.Equal(float32(4), logits[3])
+}
+
+func (s *TokenHealingSuite) TestHealPromptWithModel() {
+	modelPath := "./models/tinyllama-1.1b-chat-v1.0.Q2_K.gguf"
+	if _, err := os.Stat(modelPath); err != nil {
+		s.T().Skipf("Model not available at %s", modelPath)
+	}
+	params := Model_default_params()
+	params.NGpuLayers = 0
+	model, err := LoadModel(modelPath, params)
+	s.Require().NoError(err)
+	defer model.Free()
+
+	prompt, err := model.Tokenize("Visit https://exa", true, false)
+	s.Require().NoError(err)
+	healed, piece, allowed := HealPrompt(model, prompt)
+	s.Equal(prompt[:len(prompt)-1], healed)
+	s.NotEmpty(piece)
+	s.Contains(allowed, prompt[len(prompt)-1])
+	for _, t := range allowed {
+		s.True(strings.HasPrefix(Token_to_piece(model.Handle(), t, false), piece))
+	}
+}
+
+func TestTokenHealingSuite(t *testing.T) {
+	suite.Run(t, new(TokenHealingSuite))
+}
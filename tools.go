@@ -0,0 +1,327 @@
+package gollama
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Tool calls use the Hermes convention understood by most instruction-tuned
+// models (Qwen, Hermes, Mistral fine-tunes, ...): the available tools are
+// listed in the system prompt and the model answers with one or more
+//
+//	<tool_call>{"name": "...", "arguments": {...}}</tool_call>
+//
+// blocks. Because Chat_apply_template only supports llama.cpp's built-in
+// templates, tools are rendered into plain messages before templating.
+const (
+	toolCallOpen  = "<tool_call>"
+	toolCallClose = "</tool_call>"
+)
+
+// Tool describes a function the model may call. The layout matches the
+// OpenAI "tools" request field.
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction is the callable part of a Tool. Parameters is a JSON Schema
+// object describing the arguments.
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a function call produced by the model.
+type ToolCall struct {
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction holds the called function and its JSON arguments.
+type ToolCallFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// NewFunctionTool creates a function tool. parameters is marshaled to JSON
+// and may be a json.RawMessage, a map or a struct describing a JSON Schema.
+func NewFunctionTool(name, description string, parameters any) (Tool, error) {
+	if name == "" {
+		return Tool{}, fmt.Errorf("%w: tool name is empty", ErrInvalidParameter)
+	}
+	tool := Tool{Type: "function", Function: ToolFunction{Name: name, Description: description}}
+	if parameters != nil {
+		raw, err := json.Marshal(parameters)
+		if err != nil {
+			return Tool{}, fmt.Errorf("%w: tool %q parameters: %v", ErrInvalidParameter, name, err)
+		}
+		tool.Function.Parameters = raw
+	}
+	return tool, nil
+}
+
+// DecodeArguments unmarshals the call arguments into v. Arguments encoded as
+// a JSON string, as the OpenAI API sends them, are accepted as well.
+func (c ToolCall) DecodeArguments(v any) error {
+	args := toolArguments(c.Function.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("%w: arguments of %q: %v", ErrInvalidToolCall, c.Function.Name, err)
+	}
+	return nil
+}
+
+// toolArguments unwraps arguments encoded as a JSON string.
+func toolArguments(raw json.RawMessage) json.RawMessage {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '"' {
+		return raw
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil || !json.Valid([]byte(s)) {
+		return raw
+	}
+	return json.RawMessage(s)
+}
+
+// ToolSystemPrompt returns the system prompt section that lists tools and
+// explains the expected tool-call format.
+func ToolSystemPrompt(tools []Tool) (string, error) {
+	if len(tools) == 0 {
+		return "", fmt.Errorf("%w: no tools", ErrInvalidParameter)
+	}
+	var b strings.Builder
+	b.WriteString("You may call one or more functions to assist with the user query.\n\n")
+	b.WriteString("You are provided with function signatures within <tools></tools> XML tags:\n<tools>\n")
+	for _, tool := range tools {
+		if tool.Function.Name == "" {
+			return "", fmt.Errorf("%w: tool name is empty", ErrInvalidParameter)
+		}
+		if tool.Type == "" {
+			tool.Type = "function"
+		}
+		raw, err := json.Marshal(tool)
+		if err != nil {
+			return "", fmt.Errorf("%w: tool %q: %v", ErrInvalidParameter, tool.Function.Name, err)
+		}
+		b.Write(raw)
+		b.WriteByte('\n')
+	}
+	b.WriteString("</tools>\n\n")
+	b.WriteString("For each function call, return a json object with function name and arguments within <tool_call></tool_call> XML tags:\n")
+	b.WriteString(toolCallOpen + "\n{\"name\": <function-name>, \"arguments\": <args-json-object>}\n" + toolCallClose)
+	return b.String(), nil
+}
+
+// ApplyTools rewrites a tool-calling conversation into plain messages that
+// any chat template can format: the tool list is added to the system prompt,
+// assistant tool calls become <tool_call> blocks and "tool" results are
+// wrapped in <tool_response> tags.
+func ApplyTools(messages []ChatMessage, tools []Tool) ([]ChatMessage, error) {
+	out := make([]ChatMessage, 0, len(messages)+1)
+	if len(tools) > 0 {
+		prompt, err := ToolSystemPrompt(tools)
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) > 0 && messages[0].Role == "system" {
+			prompt = messages[0].Content + "\n\n" + prompt
+			messages = messages[1:]
+		}
+		out = append(out, ChatMessage{Role: "system", Content: prompt})
+	}
+
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			var b strings.Builder
+			b.WriteString(msg.Content)
+			for _, call := range msg.ToolCalls {
+				if b.Len() > 0 {
+					b.WriteByte('\n')
+				}
+				args := toolArguments(call.Function.Arguments)
+				if len(args) == 0 {
+					args = json.RawMessage("{}")
+				}
+				name, _ := json.Marshal(call.Function.Name)
+				fmt.Fprintf(&b, "%s\n{\"name\": %s, \"arguments\": %s}\n%s", toolCallOpen, name, args, toolCallClose)
+			}
+			out = append(out, ChatMessage{Role: "assistant", Content: b.String()})
+		case msg.Role == "tool":
+			out = append(out, ChatMessage{Role: "tool", Content: "<tool_response>\n" + msg.Content + "\n</tool_response>"})
+		default:
+			out = append(out, ChatMessage{Role: msg.Role, Content: msg.Content})
+		}
+	}
+	return out, nil
+}
+
+// Chat_apply_template_with_tools is Chat_apply_template for conversations
+// that offer tools; see ApplyTools.
+func Chat_apply_template_with_tools(tmpl string, messages []ChatMessage, tools []Tool, addAssistant bool) (string, error) {
+	plain, err := ApplyTools(messages, tools)
+	if err != nil {
+		return "", err
+	}
+	return Chat_apply_template(tmpl, plain, addAssistant)
+}
+
+// toolCallGrammarRules is a GBNF JSON grammar, adapted from llama.cpp's
+// grammars/json.gbnf.
+const toolCallGrammarRules = `value ::= object | array | string | number | ("true" | "false" | "null")
+object ::= "{" ws ( string ws ":" ws value ( ws "," ws string ws ":" ws value )* )? ws "}"
+array ::= "[" ws ( value ( ws "," ws value )* )? ws "]"
+string ::= "\"" ( [^"\\\x7F\x00-\x1F] | "\\" ( ["\\/bfnrt] | "u" [0-9a-fA-F]{4} ) )* "\""
+number ::= "-"? ( [0-9] | [1-9] [0-9]{0,15} ) ( "." [0-9]+ )? ( [eE] [-+]? [0-9]{1,15} )?
+ws ::= | " " | "\n" [ \t]{0,20}
+`
+
+// ToolCallGrammar returns a GBNF grammar that forces the model to emit one
+// or more tool calls naming one of tools. Use it with Sampler_init_grammar
+// when a tool call is required; leave it out to let the model choose
+// between answering and calling a tool.
+//
+// Example usage:
+//
+//	grammar, err := gollama.ToolCallGrammar(tools)
+//	if err != nil {
+//		return err
+//	}
+//	gollama.Sampler_chain_add(chain, gollama.Sampler_init_grammar(model.Vocab(), grammar, "root"))
+func ToolCallGrammar(tools []Tool) (string, error) {
+	if len(tools) == 0 {
+		return "", fmt.Errorf("%w: no tools", ErrInvalidParameter)
+	}
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Function.Name == "" {
+			return "", fmt.Errorf("%w: tool name is empty", ErrInvalidParameter)
+		}
+		name, _ := json.Marshal(tool.Function.Name)
+		names = append(names, gbnfLiteral(string(name)))
+	}
+
+	var b strings.Builder
+	b.WriteString("root ::= tool-call ( ws tool-call )*\n")
+	fmt.Fprintf(&b, "tool-call ::= %s ws \"{\" ws %s ws \":\" ws tool-name ws \",\" ws %s ws \":\" ws object ws \"}\" ws %s\n",
+		gbnfLiteral(toolCallOpen), gbnfLiteral(`"name"`), gbnfLiteral(`"arguments"`), gbnfLiteral(toolCallClose))
+	fmt.Fprintf(&b, "tool-name ::= %s\n", strings.Join(names, " | "))
+	b.WriteString(toolCallGrammarRules)
+	return b.String(), nil
+}
+
+// gbnfLiteral quotes s as a GBNF string literal.
+func gbnfLiteral(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// ParseToolCalls extracts tool calls from model output. It recognizes
+// <tool_call> blocks as well as a bare JSON object or array of objects with
+// "name" and "arguments" (or "parameters") keys, which some models emit
+// instead. content is the remaining text with the tool calls removed.
+//
+// Example usage:
+//
+//	calls, content, err := gollama.ParseToolCalls(output)
+//	for _, call := range calls {
+//		var args struct{ City string `json:"city"` }
+//		if err := call.DecodeArguments(&args); err != nil {
+//			return err
+//		}
+//	}
+func ParseToolCalls(text string) (calls []ToolCall, content string, err error) {
+	if !strings.Contains(text, toolCallOpen) {
+		if calls, ok := parseBareToolCalls(text); ok {
+			return calls, "", nil
+		}
+		return nil, strings.TrimSpace(text), nil
+	}
+
+	var rest strings.Builder
+	for {
+		start := strings.Index(text, toolCallOpen)
+		if start < 0 {
+			rest.WriteString(text)
+			break
+		}
+		rest.WriteString(text[:start])
+		body := text[start+len(toolCallOpen):]
+		end := strings.Index(body, toolCallClose)
+		if end < 0 {
+			return calls, strings.TrimSpace(rest.String()), fmt.Errorf("%w: unterminated %s block", ErrInvalidToolCall, toolCallOpen)
+		}
+		call, err := parseToolCall([]byte(body[:end]))
+		if err != nil {
+			return calls, strings.TrimSpace(rest.String()), err
+		}
+		call.ID = fmt.Sprintf("call_%d", len(calls))
+		calls = append(calls, call)
+		text = body[end+len(toolCallClose):]
+	}
+	return calls, strings.TrimSpace(rest.String()), nil
+}
+
+// parseBareToolCalls accepts output consisting only of a tool-call JSON
+// object or array, optionally inside a Markdown code fence.
+func parseBareToolCalls(text string) ([]ToolCall, bool) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") && strings.HasSuffix(text, "```") && len(text) >= 6 {
+		text = strings.TrimSpace(text[3 : len(text)-3])
+		text = strings.TrimSpace(strings.TrimPrefix(text, "json"))
+	}
+	if text == "" || (text[0] != '{' && text[0] != '[') {
+		return nil, false
+	}
+
+	var items []json.RawMessage
+	if text[0] == '[' {
+		if err := json.Unmarshal([]byte(text), &items); err != nil || len(items) == 0 {
+			return nil, false
+		}
+	} else {
+		items = []json.RawMessage{json.RawMessage(text)}
+	}
+
+	calls := make([]ToolCall, 0, len(items))
+	for _, item := range items {
+		call, err := parseToolCall(item)
+		if err != nil {
+			return nil, false
+		}
+		call.ID = fmt.Sprintf("call_%d", len(calls))
+		calls = append(calls, call)
+	}
+	return calls, true
+}
+
+func parseToolCall(data []byte) (ToolCall, error) {
+	var raw struct {
+		Name       string          `json:"name"`
+		Arguments  json.RawMessage `json:"arguments"`
+		Parameters json.RawMessage `json:"parameters"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(data), &raw); err != nil {
+		return ToolCall{}, fmt.Errorf("%w: %v", ErrInvalidToolCall, err)
+	}
+	if raw.Name == "" {
+		return ToolCall{}, fmt.Errorf("%w: missing function name", ErrInvalidToolCall)
+	}
+	args := raw.Arguments
+	if len(args) == 0 {
+		args = raw.Parameters
+	}
+	args = toolArguments(args)
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	return ToolCall{Type: "function", Function: ToolCallFunction{Name: raw.Name, Arguments: args}}, nil
+}
@@ -0,0 +1,121 @@
+package gollama
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ToolsSuite struct {
+	BaseSuite
+	tools []Tool
+}
+
+func (s *ToolsSuite) SetupTest() {
+	s.BaseSuite.SetupTest()
+	weather, err := NewFunctionTool("get_weather", "Get the current weather", map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"city": map[string]string{"type": "string"}},
+		"required":   []string{"city"},
+	})
+	s.Require().NoError(err)
+	s.tools = []Tool{weather, {Type: "function", Function: ToolFunction{Name: "get_time"}}}
+}
+
+func (s *ToolsSuite) TestParseTaggedCalls() {
+	out := "Let me check.\n<tool_call>\n{\"name\": \"get_weather\", \"arguments\": {\"city\": \"Rome\"}}\n</tool_call>\n" +
+		"<tool_call>{\"name\": \"get_time\", \"arguments\": {}}</tool_call>"
+	calls, content, err := ParseToolCalls(out)
+	s.Require().NoError(err)
+	s.Equal("Let me check.", content)
+	s.Require().Len(calls, 2)
+	s.Equal("call_0", calls[0].ID)
+	s.Equal("function", calls[0].Type)
+	s.Equal("get_weather", calls[0].Function.Name)
+	s.Equal("get_time", calls[1].Function.Name)
+
+	var args struct {
+		City string `json:"city"`
+	}
+	s.Require().NoError(calls[0].DecodeArguments(&args))
+	s.Equal("Rome", args.City)
+}
+
+func (s *ToolsSuite) TestParseBareJSON() {
+	calls, content, err := ParseToolCalls("```json\n[{\"name\": \"get_time\", \"parameters\": {\"tz\": \"UTC\"}}]\n```")
+	s.Require().NoError(err)
+	s.Empty(content)
+	s.Require().Len(calls, 1)
+	s.JSONEq(`{"tz":"UTC"}`, string(calls[0].Function.Arguments))
+
+	calls, content, err = ParseToolCalls("  The answer is 42. ")
+	s.NoError(err)
+	s.Nil(calls)
+	s.Equal("The answer is 42.", content)
+}
+
+func (s *ToolsSuite) TestParseErrors() {
+	_, _, err := ParseToolCalls("<tool_call>{\"name\": \"get_time\"")
+	s.ErrorIs(err, ErrInvalidToolCall)
+	_, _, err = ParseToolCalls("<tool_call>{\"arguments\": {}}</tool_call>")
+	s.ErrorIs(err, ErrInvalidToolCall)
+	_, _, err = ParseToolCalls("<tool_call>not json</tool_call>")
+	s.ErrorIs(err, ErrInvalidToolCall)
+}
+
+func (s *ToolsSuite) TestStringArguments() {
+	call := ToolCall{Function: ToolCallFunction{Name: "get_weather", Arguments: json.RawMessage(`"{\"city\":\"Oslo\"}"`)}}
+	var args map[string]string
+	s.Require().NoError(call.DecodeArguments(&args))
+	s.Equal("Oslo", args["city"])
+}
+
+func (s *ToolsSuite) TestApplyTools() {
+	messages, err := ApplyTools([]ChatMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Weather in Rome?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{Type: "function", Function: ToolCallFunction{
+			Name: "get_weather", Arguments: json.RawMessage(`{"city":"Rome"}`),
+		}}}},
+		{Role: "tool", ToolCallID: "call_0", Content: `{"temp":21}`},
+	}, s.tools)
+	s.Require().NoError(err)
+	s.Require().Len(messages, 4)
+	s.Equal("system", messages[0].Role)
+	s.True(strings.HasPrefix(messages[0].Content, "Be brief.\n\n"))
+	s.Contains(messages[0].Content, `"name":"get_weather"`)
+	s.Contains(messages[0].Content, `"name":"get_time"`)
+	s.Equal("<tool_call>\n{\"name\": \"get_weather\", \"arguments\": {\"city\":\"Rome\"}}\n</tool_call>", messages[2].Content)
+	s.Equal("<tool_response>\n{\"temp\":21}\n</tool_response>", messages[3].Content)
+
+	// The rendered assistant turn round-trips through the parser
+	calls, _, err := ParseToolCalls(messages[2].Content)
+	s.Require().NoError(err)
+	s.Require().Len(calls, 1)
+	s.Equal("get_weather", calls[0].Function.Name)
+}
+
+func (s *ToolsSuite) TestGrammar() {
+	grammar, err := ToolCallGrammar(s.tools)
+	s.Require().NoError(err)
+	s.Contains(grammar, `tool-name ::= "\"get_weather\"" | "\"get_time\""`)
+	s.Contains(grammar, `"<tool_call>"`)
+	s.Contains(grammar, "object ::=")
+
+	_, err = ToolCallGrammar(nil)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *ToolsSuite) TestTemplateWithTools() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	prompt, err := Chat_apply_template_with_tools("chatml", []ChatMessage{{Role: "user", Content: "Hi"}}, s.tools, true)
+	s.Require().NoError(err)
+	s.True(strings.HasPrefix(prompt, "<|im_start|>system\nYou may call one or more functions"))
+	s.True(strings.HasSuffix(prompt, "<|im_start|>user\nHi<|im_end|>\n<|im_start|>assistant\n"))
+}
+
+func TestToolsSuite(t *testing.T) { suite.Run(t, new(ToolsSuite)) }
@@ -0,0 +1,142 @@
+package gollama
+
+import (
+	"container/heap"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/dianlight/gollama.cpp/internal/simd"
+)
+
+// Vector helpers for embeddings. They use AVX2 and FMA on amd64 CPUs that
+// have them and a portable loop elsewhere; results are float32 sums, so they
+// can differ from a float64 reference in the last digits.
+
+// Similarity returns the cosine similarity of a and b, or 0 when their
+// lengths differ or either is a zero vector.
+func Similarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	return simd.Cosine(a, b)
+}
+
+// Normalize scales v in place to unit Euclidean length, so that the dot
+// product of normalized vectors is their cosine similarity. A zero vector is
+// left unchanged.
+func Normalize(v []float32) {
+	simd.Normalize(v)
+}
+
+// Truncate returns the first dims values of v scaled to unit length, the
+// reduced embedding of a model trained with Matryoshka representation
+// learning (nomic-embed, mxbai-embed, text-embedding-3, ...). Other models
+// lose accuracy quickly when truncated. v is not modified.
+func Truncate(v []float32, dims int) ([]float32, error) {
+	if dims <= 0 || dims > len(v) {
+		return nil, fmt.Errorf("%w: cannot truncate %d dimensions to %d", ErrInvalidParameter, len(v), dims)
+	}
+	out := append([]float32(nil), v[:dims]...)
+	simd.Normalize(out)
+	return out, nil
+}
+
+// MatMulVec returns the dot product of each row of m with v. m holds rows of
+// len(v) values, e.g. normalized embeddings stored contiguously.
+func MatMulVec(m, v []float32) ([]float32, error) {
+	if len(v) == 0 || len(m)%len(v) != 0 {
+		return nil, fmt.Errorf("%w: matrix of %d values for vectors of %d", ErrInvalidParameter, len(m), len(v))
+	}
+	out := make([]float32, len(m)/len(v))
+	simd.MatMulVec(out, m, v)
+	return out, nil
+}
+
+// Match is a row found by SearchTopK.
+type Match struct {
+	// Index is the row of the matrix
+	Index int
+	// Score is the dot product of the row with the query
+	Score float32
+}
+
+// SearchTopK returns, for each query, the k rows of m with the highest dot
+// product, best first. m holds rows of len(query) values; with normalized
+// rows and queries the scores are cosine similarities. Queries are
+// searched in parallel.
+//
+// Example usage:
+//
+//	for _, e := range embeddings {
+//		gollama.Normalize(e)
+//		matrix = append(matrix, e...)
+//	}
+//	matches, err := gollama.SearchTopK(matrix, [][]float32{query}, 5)
+func SearchTopK(m []float32, queries [][]float32, k int) ([][]Match, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("%w: k must be positive, got %d", ErrInvalidParameter, k)
+	}
+	if len(queries) == 0 {
+		return nil, nil
+	}
+	dim := len(queries[0])
+	for _, q := range queries {
+		if len(q) != dim || dim == 0 || len(m)%dim != 0 {
+			return nil, fmt.Errorf("%w: query of %d values for a matrix of %d", ErrInvalidParameter, len(q), len(m))
+		}
+	}
+
+	results := make([][]Match, len(queries))
+	workers := min(runtime.GOMAXPROCS(0), len(queries))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = topK(m, queries[i], k)
+			}
+		}()
+	}
+	for i := range queries {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results, nil
+}
+
+// topK scans the rows of m for the k best matches of q.
+func topK(m, q []float32, k int) []Match {
+	dim := len(q)
+	h := make(matchHeap, 0, min(k, len(m)/dim))
+	for i := 0; i*dim < len(m); i++ {
+		score := simd.Dot(m[i*dim:(i+1)*dim], q)
+		if len(h) < k {
+			heap.Push(&h, Match{Index: i, Score: score})
+		} else if score > h[0].Score {
+			h[0] = Match{Index: i, Score: score}
+			heap.Fix(&h, 0)
+		}
+	}
+	out := make([]Match, len(h))
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(&h).(Match)
+	}
+	return out
+}
+
+// matchHeap is a min-heap of matches ordered by score.
+type matchHeap []Match
+
+func (h matchHeap) Len() int           { return len(h) }
+func (h matchHeap) Less(i, j int) bool { return h[i].Score < h[j].Score }
+func (h matchHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x any)        { *h = append(*h, x.(Match)) }
+func (h *matchHeap) Pop() any {
+	m := (*h)[len(*h)-1]
+	*h = (*h)[:len(*h)-1]
+	return m
+}
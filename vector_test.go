@@ -0,0 +1,80 @@
+package gollama
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type VectorSuite struct{ suite.Suite }
+
+func (s *VectorSuite) TestSimilarity() {
+	s.InDelta(1, Similarity([]float32{1, 2, 3}, []float32{2, 4, 6}), 1e-6)
+	s.InDelta(-1, Similarity([]float32{1, 0}, []float32{-3, 0}), 1e-6)
+	s.Zero(Similarity([]float32{1, 2}, []float32{1, 2, 3}))
+	s.Zero(Similarity([]float32{0, 0}, []float32{1, 2}))
+
+	v := []float32{0, 3, 4}
+	Normalize(v)
+	s.InDeltaSlice([]float32{0, 0.6, 0.8}, v, 1e-6)
+}
+
+func (s *VectorSuite) TestTruncate() {
+	v := []float32{3, 4, 12}
+	out, err := Truncate(v, 2)
+	s.Require().NoError(err)
+	s.InDeltaSlice([]float32{0.6, 0.8}, out, 1e-6)
+	s.Equal([]float32{3, 4, 12}, v)
+
+	out, err = Truncate(v, 3)
+	s.Require().NoError(err)
+	s.InDelta(1, Similarity(v, out), 1e-6)
+
+	_, err = Truncate(v, 0)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = Truncate(v, 4)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *VectorSuite) TestMatMulVec() {
+	out, err := MatMulVec([]float32{1, 0, 0, 1, 1, 1}, []float32{2, 3})
+	s.Require().NoError(err)
+	s.Equal([]float32{2, 3, 5}, out)
+
+	_, err = MatMulVec([]float32{1, 2, 3}, []float32{1, 2})
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = MatMulVec([]float32{1}, nil)
+	s.ErrorIs(err, ErrInvalidParameter)
+}
+
+func (s *VectorSuite) TestSearchTopK() {
+	m := []float32{
+		1, 0,
+		0, 1,
+		0.6, 0.8,
+		-1, 0,
+	}
+	matches, err := SearchTopK(m, [][]float32{{1, 0}, {0, 1}}, 2)
+	s.Require().NoError(err)
+	s.Equal([][]Match{
+		{{Index: 0, Score: 1}, {Index: 2, Score: 0.6}},
+		{{Index: 1, Score: 1}, {Index: 2, Score: 0.8}},
+	}, matches)
+
+	// k larger than the matrix returns every row
+	matches, err = SearchTopK(m, [][]float32{{-1, 0}}, 10)
+	s.Require().NoError(err)
+	s.Len(matches[0], 4)
+	s.Equal(3, matches[0][0].Index)
+	s.Equal(0, matches[0][3].Index)
+
+	_, err = SearchTopK(m, [][]float32{{1, 0, 0}}, 1)
+	s.ErrorIs(err, ErrInvalidParameter)
+	_, err = SearchTopK(m, [][]float32{{1, 0}}, 0)
+	s.ErrorIs(err, ErrInvalidParameter)
+	matches, err = SearchTopK(m, nil, 1)
+	s.NoError(err)
+	s.Empty(matches)
+}
+
+func TestVectorSuite(t *testing.T) { suite.Run(t, new(VectorSuite)) }
@@ -0,0 +1,191 @@
+package gollama
+
+// modelVocab resolves the vocabulary of model, or 0 if the library is not
+// loaded or the model has none.
+func modelVocab(model LlamaModel) LlamaVocab {
+	if err := ensureLoaded(); err != nil {
+		return 0
+	}
+	if model == 0 || handleClosed(handleModel, uintptr(model)) || llamaModelGetVocab == nil {
+		return 0
+	}
+	return llamaModelGetVocab(model)
+}
+
+// Vocab_token_text returns the raw vocabulary text of token (e.g. "▁the" or
+// "<0x0A>"). Use Token_to_piece or Detokenize to get decoded text.
+func Vocab_token_text(model LlamaModel, token LlamaToken) string {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabGetText == nil {
+		return ""
+	}
+	return bytePointerToString(llamaVocabGetText(vocab, token))
+}
+
+// Vocab_token_attr returns the attribute flags of token.
+func Vocab_token_attr(model LlamaModel, token LlamaToken) LlamaTokenAttr {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabGetAttr == nil {
+		return LLAMA_TOKEN_ATTR_UNDEFINED
+	}
+	return llamaVocabGetAttr(vocab, token)
+}
+
+// Vocab_token_score returns the tokenizer score of token.
+func Vocab_token_score(model LlamaModel, token LlamaToken) float32 {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabGetScore == nil {
+		return 0
+	}
+	return llamaVocabGetScore(vocab, token)
+}
+
+// Vocab_is_eog reports whether token ends generation (EOS, EOT, ...).
+func Vocab_is_eog(model LlamaModel, token LlamaToken) bool {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabIsEog == nil {
+		return false
+	}
+	return llamaVocabIsEog(vocab, token)
+}
+
+// Vocab_is_control reports whether token is a control token.
+func Vocab_is_control(model LlamaModel, token LlamaToken) bool {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabIsControl == nil {
+		return false
+	}
+	return llamaVocabIsControl(vocab, token)
+}
+
+// Vocab_bos returns the beginning-of-sequence token of model, or LLAMA_TOKEN_NULL if
+// it has none.
+func Vocab_bos(model LlamaModel) LlamaToken {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabBos == nil {
+		return LLAMA_TOKEN_NULL
+	}
+	return llamaVocabBos(vocab)
+}
+
+// Vocab_eos returns the end-of-sequence token of model, or LLAMA_TOKEN_NULL if
+// it has none.
+func Vocab_eos(model LlamaModel) LlamaToken {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabEos == nil {
+		return LLAMA_TOKEN_NULL
+	}
+	return llamaVocabEos(vocab)
+}
+
+// Vocab_eot returns the end-of-turn token of model, or LLAMA_TOKEN_NULL if
+// it has none.
+func Vocab_eot(model LlamaModel) LlamaToken {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabEot == nil {
+		return LLAMA_TOKEN_NULL
+	}
+	return llamaVocabEot(vocab)
+}
+
+// Vocab_nl returns the newline token of model, or LLAMA_TOKEN_NULL if
+// it has none.
+func Vocab_nl(model LlamaModel) LlamaToken {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabNl == nil {
+		return LLAMA_TOKEN_NULL
+	}
+	return llamaVocabNl(vocab)
+}
+
+// Vocab_pad returns the padding token of model, or LLAMA_TOKEN_NULL if
+// it has none.
+func Vocab_pad(model LlamaModel) LlamaToken {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabPad == nil {
+		return LLAMA_TOKEN_NULL
+	}
+	return llamaVocabPad(vocab)
+}
+
+// Vocab_add_bos reports whether the tokenizer of model expects a BOS token
+// at the start of a prompt. Tokenize adds it when addSpecial is true, so
+// passing this flag follows the model's policy.
+func Vocab_add_bos(model LlamaModel) bool {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabGetAddBos == nil {
+		return false
+	}
+	return llamaVocabGetAddBos(vocab)
+}
+
+// Vocab_add_eos reports whether the tokenizer of model expects an EOS token
+// at the end of its input, as some embedding models do.
+func Vocab_add_eos(model LlamaModel) bool {
+	vocab := modelVocab(model)
+	if vocab == 0 || llamaVocabGetAddEos == nil {
+		return false
+	}
+	return llamaVocabGetAddEos(vocab)
+}
+
+// VocabEntry describes a single vocabulary token.
+type VocabEntry struct {
+	Token LlamaToken
+	Text  string
+	Score float32
+	Attr  LlamaTokenAttr
+}
+
+// VocabIterator walks the vocabulary of a model in token id order. It is
+// meant for analysis tooling; the zero value yields nothing.
+//
+// Example usage:
+//
+//	it := gollama.NewVocabIterator(model)
+//	for it.Next() {
+//		e := it.Entry()
+//		fmt.Println(e.Token, e.Text, e.Score)
+//	}
+type VocabIterator struct {
+	vocab LlamaVocab
+	n     int32
+	next  int32
+	entry VocabEntry
+}
+
+// NewVocabIterator returns an iterator over all tokens of model.
+func NewVocabIterator(model LlamaModel) *VocabIterator {
+	it := &VocabIterator{vocab: modelVocab(model)}
+	if it.vocab != 0 && llamaVocabNTokens != nil {
+		it.n = llamaVocabNTokens(it.vocab)
+	}
+	return it
+}
+
+// Len returns the number of tokens in the vocabulary.
+func (it *VocabIterator) Len() int32 {
+	return it.n
+}
+
+// Next advances to the next token and reports whether one is available.
+func (it *VocabIterator) Next() bool {
+	if it.next >= it.n {
+		return false
+	}
+	token := LlamaToken(it.next)
+	it.next++
+
+	it.entry = VocabEntry{
+		Token: token,
+		Text:  bytePointerToString(llamaVocabGetText(it.vocab, token)),
+		Score: llamaVocabGetScore(it.vocab, token),
+		Attr:  llamaVocabGetAttr(it.vocab, token),
+	}
+	return true
+}
+
+// Entry returns the token the iterator is positioned on.
+func (it *VocabIterator) Entry() VocabEntry {
+	return it.entry
+}
@@ -0,0 +1,106 @@
+package gollama
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type VocabSuite struct{ BaseSuite }
+
+func (s *VocabSuite) TestAccessorsWithoutModel() {
+	s.Equal("", Vocab_token_text(0, 1))
+	s.Equal(LLAMA_TOKEN_ATTR_UNDEFINED, Vocab_token_attr(0, 1))
+	s.Equal(float32(0), Vocab_token_score(0, 1))
+	s.False(Vocab_is_eog(0, 1))
+	s.False(Vocab_is_control(0, 1))
+	for _, f := range []func(LlamaModel) LlamaToken{Vocab_bos, Vocab_eos, Vocab_eot, Vocab_nl, Vocab_pad} {
+		s.Equal(LlamaToken(LLAMA_TOKEN_NULL), f(0))
+	}
+	s.False(Vocab_add_bos(0))
+	s.False(Vocab_add_eos(0))
+}
+
+func (s *VocabSuite) TestIteratorWithoutModelIsEmpty() {
+	it := NewVocabIterator(0)
+	s.Equal(int32(0), it.Len())
+	s.False(it.Next())
+
+	var zero VocabIterator
+	s.False(zero.Next())
+}
+
+func (s *VocabSuite) TestDetokenizeRequiresModel() {
+	if err := ensureLoaded(); err != nil {
+		s.T().Skipf("library not available: %v", err)
+	}
+	_, err := Detokenize(0, []LlamaToken{1}, false, false)
+	s.Require().ErrorIs(err, ErrModelNotLoaded)
+}
+
+func (s *VocabSuite) TestRoundTripWithModel() {
+	modelPath := "./models/tinyllama-1.1b-chat-v1.0.Q2_K.gguf"
+	if _, err := os.Stat(modelPath); err != nil {
+		s.T().Skipf("Model not available at %s", modelPath)
+	}
+	params := Model_default_params()
+	params.NGpuLayers = 0
+	model, err := Model_load_from_file(modelPath, params)
+	s.Require().NoError(err)
+	defer Model_free(model)
+
+	tokens, err := Tokenize(model, "Hello world", false, false)
+	s.Require().NoError(err)
+	text, err := Detokenize(model, tokens, false, false)
+	s.Require().NoError(err)
+	s.Equal("Hello world", text)
+
+	it := NewVocabIterator(model)
+	s.Equal(Vocab_n_tokens(model), it.Len())
+	count := int32(0)
+	for it.Next() {
+		count++
+	}
+	s.Equal(it.Len(), count)
+
+	// TinyLlama uses the llama tokenizer, which adds BOS to prompts
+	s.NotEqual(LlamaToken(LLAMA_TOKEN_NULL), Vocab_bos(model))
+	s.NotEqual(LlamaToken(LLAMA_TOKEN_NULL), Vocab_eos(model))
+	s.True(Vocab_add_bos(model))
+	withBOS, err := Tokenize(model, "Hello world", Vocab_add_bos(model), false)
+	s.Require().NoError(err)
+	s.Equal(Vocab_bos(model), withBOS[0])
+}
+
+func (s *VocabSuite) TestTokenToPieceDecodesPieces() {
+	s.Equal("", Token_to_piece(0, 1, false))
+
+	modelPath := "./models/tinyllama-1.1b-chat-v1.0.Q2_K.gguf"
+	if _, err := os.Stat(modelPath); err != nil {
+		s.T().Skipf("Model not available at %s", modelPath)
+	}
+	params := Model_default_params()
+	params.NGpuLayers = 0
+	model, err := Model_load_from_file(modelPath, params)
+	s.Require().NoError(err)
+	defer Model_free(model)
+
+	tokens, err := Tokenize(model, "Hello world\n", false, false)
+	s.Require().NoError(err)
+	var text string
+	for _, token := range tokens {
+		text += Token_to_piece(model, token, false)
+	}
+	// SentencePiece models prefix the first word with a space
+	s.Equal("Hello world\n", strings.TrimPrefix(text, " "))
+	s.NotContains(text, "▁")
+	s.NotContains(text, "<0x0A>")
+
+	eos := llamaVocabEos(llamaModelGetVocab(model))
+	s.Empty(Token_to_piece(model, eos, false))
+	s.NotEmpty(Token_to_piece(model, eos, true))
+}
+
+func TestVocabSuite(t *testing.T) { suite.Run(t, new(VocabSuite)) }
@@ -0,0 +1,155 @@
+package gollama
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// abortBridge routes ggml_abort_callback invocations to the abort function
+// and watchdog deadline of each context. A single native trampoline is
+// shared by all contexts (purego callbacks cannot be freed); the data
+// pointer carries the context handle.
+var abortBridge struct {
+	once     sync.Once
+	callback uintptr
+	err      error
+
+	mu      sync.Mutex
+	entries map[LlamaContext]*abortEntry
+}
+
+// abortEntry is the abort state of a context.
+type abortEntry struct {
+	abort    func() bool
+	deadline time.Time
+	// fired records that the deadline aborted the running call
+	fired bool
+}
+
+// Set_abort_callback sets a function the backends call while computing a
+// decode or encode on ctx; returning true aborts the call, which then
+// fails and leaves the memory as it was before the call. abort runs on a
+// native thread in the middle of the computation, so it must be fast and
+// must not call into llama.cpp. nil removes it. Backends that cannot be
+// interrupted, such as most GPU backends, only check it between graph
+// computations.
+func Set_abort_callback(ctx LlamaContext, abort func() bool) error {
+	return updateAbortEntry(ctx, func(e *abortEntry) { e.abort = abort })
+}
+
+// Decode_with_timeout decodes batch like Decode, but aborts the
+// computation once timeout has elapsed and then fails with
+// ErrDecodeTimeout. The batch is not added to the memory, so the context
+// stays usable: retry with a smaller batch or more time, or move on. A
+// timeout of 0 or less disables the watchdog.
+//
+// Example usage:
+//
+//	err := gollama.Decode_with_timeout(ctx, batch, 30*time.Second)
+//	if errors.Is(err, gollama.ErrDecodeTimeout) {
+//		// the context is still usable
+//	}
+func Decode_with_timeout(ctx LlamaContext, batch LlamaBatch, timeout time.Duration) error {
+	return withWatchdog(ctx, timeout, "decode", func() error { return Decode(ctx, batch) })
+}
+
+// Encode_with_timeout encodes batch like Encode, with the watchdog of
+// Decode_with_timeout.
+func Encode_with_timeout(ctx LlamaContext, batch LlamaBatch, timeout time.Duration) error {
+	return withWatchdog(ctx, timeout, "encode", func() error { return Encode(ctx, batch) })
+}
+
+// withWatchdog runs call with a deadline timeout from now checked by the
+// abort callback of ctx.
+func withWatchdog(ctx LlamaContext, timeout time.Duration, name string, call func() error) error {
+	if timeout <= 0 {
+		return call()
+	}
+	start := time.Now()
+	if err := updateAbortEntry(ctx, func(e *abortEntry) {
+		e.deadline, e.fired = start.Add(timeout), false
+	}); err != nil {
+		return err
+	}
+	err := call()
+
+	var fired bool
+	_ = updateAbortEntry(ctx, func(e *abortEntry) {
+		fired = e.fired
+		e.deadline, e.fired = time.Time{}, false
+	})
+	if err != nil && fired {
+		return fmt.Errorf("%w: %s aborted after %s (limit %s): %v",
+			ErrDecodeTimeout, name, time.Since(start).Round(time.Millisecond), timeout, err)
+	}
+	return err
+}
+
+// updateAbortEntry applies update to the abort state of ctx and installs
+// the native callback while the state needs it.
+func updateAbortEntry(ctx LlamaContext, update func(*abortEntry)) error {
+	if ctx == 0 {
+		return ErrContextNotCreated
+	}
+	if err := checkHandle(handleContext, uintptr(ctx)); err != nil {
+		return err
+	}
+	if err := ensureLoaded(); err != nil {
+		return err
+	}
+	if llamaSetAbortCallback == nil {
+		return fmt.Errorf("llama_set_abort_callback function not available")
+	}
+	abortBridge.once.Do(func() {
+		abortBridge.callback, abortBridge.err = newAbortCallback()
+	})
+	if abortBridge.err != nil {
+		return abortBridge.err
+	}
+
+	abortBridge.mu.Lock()
+	defer abortBridge.mu.Unlock()
+	if abortBridge.entries == nil {
+		abortBridge.entries = make(map[LlamaContext]*abortEntry)
+	}
+	e, installed := abortBridge.entries[ctx]
+	if !installed {
+		e = &abortEntry{}
+	}
+	update(e)
+	switch active := e.abort != nil || !e.deadline.IsZero(); {
+	case active && !installed:
+		abortBridge.entries[ctx] = e
+		llamaSetAbortCallback(ctx, abortBridge.callback, uintptr(ctx))
+	case !active && installed:
+		delete(abortBridge.entries, ctx)
+		llamaSetAbortCallback(ctx, 0, 0)
+	}
+	return nil
+}
+
+// dispatchAbort answers a native abort check for the context data.
+func dispatchAbort(data uintptr) bool {
+	abortBridge.mu.Lock()
+	e := abortBridge.entries[LlamaContext(data)]
+	if e == nil {
+		abortBridge.mu.Unlock()
+		return false
+	}
+	abort, deadline := e.abort, e.deadline
+	if !deadline.IsZero() && time.Now().After(deadline) {
+		e.fired = true
+		abortBridge.mu.Unlock()
+		return true
+	}
+	abortBridge.mu.Unlock()
+	return abort != nil && abort()
+}
+
+// forgetAbortCallback drops the abort state of a freed context.
+func forgetAbortCallback(ctx LlamaContext) {
+	abortBridge.mu.Lock()
+	defer abortBridge.mu.Unlock()
+	delete(abortBridge.entries, ctx)
+}
@@ -0,0 +1,56 @@
+package gollama
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WatchdogSuite struct{ BaseSuite }
+
+func (s *WatchdogSuite) TestDispatchAbort() {
+	const ctx = LlamaContext(0x1234)
+	abortBridge.mu.Lock()
+	if abortBridge.entries == nil {
+		abortBridge.entries = make(map[LlamaContext]*abortEntry)
+	}
+	entry := &abortEntry{deadline: time.Now().Add(time.Hour)}
+	abortBridge.entries[ctx] = entry
+	abortBridge.mu.Unlock()
+	s.T().Cleanup(func() { forgetAbortCallback(ctx) })
+
+	s.False(dispatchAbort(uintptr(ctx)))
+	s.False(dispatchAbort(uintptr(ctx + 1)))
+
+	calls := 0
+	entry.abort = func() bool { calls++; return calls > 1 }
+	s.False(dispatchAbort(uintptr(ctx)))
+	s.True(dispatchAbort(uintptr(ctx)))
+	s.False(entry.fired, "aborted by the callback, not the deadline")
+
+	entry.deadline = time.Now().Add(-time.Millisecond)
+	s.True(dispatchAbort(uintptr(ctx)))
+	s.True(entry.fired)
+
+	forgetAbortCallback(ctx)
+	s.False(dispatchAbort(uintptr(ctx)))
+}
+
+func (s *WatchdogSuite) TestWithoutContext() {
+	s.ErrorIs(Set_abort_callback(0, func() bool { return true }), ErrContextNotCreated)
+	s.ErrorIs(Decode_with_timeout(0, LlamaBatch{}, time.Second), ErrContextNotCreated)
+
+	// No watchdog: the call runs as is
+	errCall := errors.New("call")
+	s.ErrorIs(withWatchdog(0, 0, "decode", func() error { return errCall }), errCall)
+
+	c := &Context{}
+	c.SetTimeout(-time.Second)
+	s.Zero(c.timeout)
+	c.SetTimeout(time.Second)
+	s.ErrorIs(c.Decode(LlamaBatch{}), ErrContextNotCreated)
+}
+
+func TestWatchdogSuite(t *testing.T) { suite.Run(t, new(WatchdogSuite)) }
@@ -0,0 +1,268 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// ErrWorkerExited is returned by the calls of a Client whose worker
+// process exited, typically because of a native crash. The error names the
+// exit status or signal.
+var ErrWorkerExited = errors.New("worker process exited")
+
+// Options configures Start.
+type Options struct {
+	// Path is the worker executable; the default is gollama-worker looked
+	// up in PATH
+	Path string
+	// Args are passed to the worker
+	Args []string
+	// Env is the environment of the worker; nil inherits the environment
+	// of the current process
+	Env []string
+	// Stderr receives the logs of the worker; the default is os.Stderr
+	Stderr io.Writer
+}
+
+// Client sends requests to a worker process. It is safe for concurrent
+// use; the worker runs the requests one at a time.
+type Client struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *frameWriter
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan Response
+
+	done    chan struct{}
+	exitErr error
+}
+
+// Start launches a worker process. The worker has no model until Load is
+// called. Cancelling ctx kills the worker.
+func Start(ctx context.Context, opts Options) (*Client, error) {
+	path := opts.Path
+	if path == "" {
+		path = "gollama-worker"
+	}
+	path, err := exec.LookPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("worker executable: %w", err)
+	}
+	var stderr io.Writer = os.Stderr
+	if opts.Stderr != nil {
+		// Written by the logs of the worker and by its stray stdout output
+		stderr = &lockedWriter{w: opts.Stderr}
+	}
+
+	cmd := exec.CommandContext(ctx, path, opts.Args...)
+	cmd.Env = opts.Env
+	cmd.Stderr = stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start worker: %w", err)
+	}
+
+	c := &Client{
+		cmd:     cmd,
+		in:      in,
+		out:     &frameWriter{w: in},
+		pending: make(map[uint64]chan Response),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(newFrameReader(out, stderr))
+	return c, nil
+}
+
+// lockedWriter serializes the writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// readLoop dispatches the responses of the worker until it exits, then
+// fails the calls in flight.
+func (c *Client) readLoop(in *frameReader) {
+	for {
+		var resp Response
+		if err := in.read(&resp); err != nil {
+			break
+		}
+		c.mu.Lock()
+		ch := c.pending[resp.ID]
+		if resp.Done {
+			delete(c.pending, resp.ID)
+		}
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- resp
+		}
+	}
+
+	err := c.cmd.Wait()
+	if err == nil {
+		err = errors.New("exit status 0")
+	}
+	c.mu.Lock()
+	c.exitErr = fmt.Errorf("%w: %v", ErrWorkerExited, err)
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// Done is closed when the worker process has exited.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the worker exited, wrapping ErrWorkerExited, or nil while
+// it runs.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exitErr
+}
+
+// Pid returns the process id of the worker.
+func (c *Client) Pid() int {
+	return c.cmd.Process.Pid
+}
+
+// Ping checks that the worker answers requests. The worker answers it
+// without waiting for the request it runs.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.call(ctx, Request{Op: OpPing}, nil)
+	return err
+}
+
+// Load loads a model in the worker, replacing the loaded one.
+func (c *Client) Load(ctx context.Context, req LoadRequest) error {
+	_, err := c.call(ctx, Request{Op: OpLoad, Load: &req}, nil)
+	return err
+}
+
+// Generate generates a completion in the worker. onDelta, when set,
+// receives the text as it is produced. Cancelling ctx cancels the request
+// in the worker.
+func (c *Client) Generate(ctx context.Context, req GenerateRequest, onDelta func(string)) (GenerateResult, error) {
+	resp, err := c.call(ctx, Request{Op: OpGenerate, Generate: &req}, onDelta)
+	var res GenerateResult
+	if resp.Generate != nil {
+		res = *resp.Generate
+	}
+	return res, err
+}
+
+// Embed computes an embedding per text in the worker, which must have
+// loaded its model with Embeddings set.
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := c.call(ctx, Request{Op: OpEmbed, Embed: &EmbedRequest{Texts: texts}}, nil)
+	return resp.Embeddings, err
+}
+
+// Tokenize tokenizes text in the worker.
+func (c *Client) Tokenize(ctx context.Context, text string) ([]int32, error) {
+	resp, err := c.call(ctx, Request{Op: OpTokenize, Tokenize: &TokenizeRequest{Text: text}}, nil)
+	return resp.Tokens, err
+}
+
+// Warm decodes prompts into the prompt cache of the worker, which must have
+// loaded its model with PromptCache set.
+func (c *Client) Warm(ctx context.Context, prompts []string) error {
+	_, err := c.call(ctx, Request{Op: OpWarm, Warm: &WarmRequest{Prompts: prompts}}, nil)
+	return err
+}
+
+// Close stops the worker: its input is closed so it exits once the
+// requests in flight are done.
+func (c *Client) Close() error {
+	err := c.in.Close()
+	<-c.done
+	return err
+}
+
+// Kill stops the worker immediately.
+func (c *Client) Kill() error {
+	err := c.cmd.Process.Kill()
+	<-c.done
+	return err
+}
+
+// call sends req and waits for its final response, passing streamed text
+// to onDelta.
+func (c *Client) call(ctx context.Context, req Request, onDelta func(string)) (Response, error) {
+	ch := make(chan Response, 16)
+	c.mu.Lock()
+	if c.exitErr != nil {
+		c.mu.Unlock()
+		return Response{}, c.exitErr
+	}
+	c.nextID++
+	req.ID = c.nextID
+	c.pending[req.ID] = ch
+	c.mu.Unlock()
+
+	if err := c.out.write(req); err != nil {
+		c.mu.Lock()
+		delete(c.pending, req.ID)
+		c.mu.Unlock()
+		<-c.done
+		return Response{}, c.Err()
+	}
+
+	cancelled := ctx.Done()
+	for {
+		select {
+		case resp, ok := <-ch:
+			if !ok {
+				return Response{}, c.Err()
+			}
+			if !resp.Done {
+				if onDelta != nil && resp.Delta != "" {
+					onDelta(resp.Delta)
+				}
+				continue
+			}
+			if resp.Error != "" {
+				if err := ctx.Err(); err != nil {
+					return resp, err
+				}
+				return resp, errors.New(resp.Error)
+			}
+			return resp, nil
+		case <-cancelled:
+			if req.Op == OpPing {
+				// Nothing to stop: a worker that does not answer is hung
+				c.mu.Lock()
+				delete(c.pending, req.ID)
+				c.mu.Unlock()
+				return Response{}, ctx.Err()
+			}
+			// Keep waiting: the worker answers once the request stopped
+			_ = c.out.write(Request{Op: OpCancel, CancelID: req.ID})
+			cancelled = nil
+		}
+	}
+}
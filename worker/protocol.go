@@ -0,0 +1,199 @@
+// Package worker runs inference in a child process, so a native crash in
+// llama.cpp (a segfault or SIGBUS in libllama) fails the requests in flight
+// instead of killing the Go service.
+//
+// The gollama-worker command serves a model over its standard input and
+// output; Start launches it and returns a Client whose methods send it
+// requests. Messages are JSON objects, one per line, prefixed with
+// FramePrefix so that output the native libraries print on stdout is
+// skipped. Requests carry an ID echoed by every response; a request is
+// answered by zero or more streaming responses and a final one with Done
+// set. Pings and cancels are answered as soon as they are read, even while
+// other requests run or wait.
+//
+// The protocol is JSON rather than protobuf: the messages are small next to
+// the inference they drive, JSON needs no code generation or extra module
+// dependency, and a text line with a marker prefix can be picked out of the
+// log output llama.cpp and ggml write to the same stdout.
+//
+// Example usage:
+//
+//	w, err := worker.Start(ctx, worker.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	defer w.Close()
+//	if err := w.Load(ctx, worker.LoadRequest{Model: "model.gguf", ContextSize: 4096}); err != nil {
+//		return err
+//	}
+//	res, err := w.Generate(ctx, worker.GenerateRequest{Prompt: "Hello", MaxTokens: 64}, nil)
+//	if errors.Is(err, worker.ErrWorkerExited) {
+//		// the worker crashed; start a new one
+//	}
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+// FramePrefix starts every protocol line.
+const FramePrefix = "\x1egollama "
+
+// Request operations.
+const (
+	OpLoad     = "load"
+	OpGenerate = "generate"
+	OpEmbed    = "embed"
+	OpTokenize = "tokenize"
+	OpWarm     = "warm"
+	// OpPing is answered as soon as it is read, even while a request runs
+	OpPing = "ping"
+	// OpCancel cancels the request whose ID is CancelID
+	OpCancel = "cancel"
+)
+
+// Request is a message from the client to the worker. The field matching
+// Op holds its arguments.
+type Request struct {
+	ID       uint64           `json:"id"`
+	Op       string           `json:"op"`
+	Load     *LoadRequest     `json:"load,omitempty"`
+	Generate *GenerateRequest `json:"generate,omitempty"`
+	Embed    *EmbedRequest    `json:"embed,omitempty"`
+	Tokenize *TokenizeRequest `json:"tokenize,omitempty"`
+	Warm     *WarmRequest     `json:"warm,omitempty"`
+	CancelID uint64           `json:"cancel_id,omitempty"`
+}
+
+// Response is a message from the worker answering the request ID.
+type Response struct {
+	ID uint64 `json:"id"`
+	// Done marks the last response of a request
+	Done  bool   `json:"done,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Delta is generated text, streamed before the final response
+	Delta      string          `json:"delta,omitempty"`
+	Generate   *GenerateResult `json:"generate,omitempty"`
+	Embeddings [][]float32     `json:"embeddings,omitempty"`
+	Tokens     []int32         `json:"tokens,omitempty"`
+}
+
+// LoadRequest loads a model, replacing the loaded one.
+type LoadRequest struct {
+	// Model is the path of the GGUF file, as seen by the worker
+	Model     string `json:"model"`
+	GPULayers int    `json:"gpu_layers,omitempty"`
+	// ContextSize and BatchSize default to those of the library
+	ContextSize int `json:"context_size,omitempty"`
+	BatchSize   int `json:"batch_size,omitempty"`
+	// Threads defaults to the library default
+	Threads int `json:"threads,omitempty"`
+	// Embeddings creates the context for Embed instead of Generate
+	Embeddings bool `json:"embeddings,omitempty"`
+	// PromptCache is the number of prompt prefixes whose state is kept in
+	// memory for reuse by Generate and Warm; 0 disables the cache
+	PromptCache int `json:"prompt_cache,omitempty"`
+}
+
+// GenerateRequest generates a completion of Prompt.
+type GenerateRequest struct {
+	Prompt    string   `json:"prompt"`
+	MaxTokens int      `json:"max_tokens,omitempty"`
+	Stop      []string `json:"stop,omitempty"`
+	// Sampling defaults to gollama.DefaultSamplingParams in the worker
+	Sampling *gollama.SamplingParams `json:"sampling,omitempty"`
+}
+
+// GenerateResult is the outcome of a GenerateRequest.
+type GenerateResult struct {
+	Text             string `json:"text"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	// StopReason is a gollama.StopReason name, e.g. "eog"
+	StopReason string `json:"stop_reason"`
+	// Timings measures the generation in the worker
+	Timings gollama.Timings `json:"timings"`
+}
+
+// Usage returns the token counts of the result.
+func (r GenerateResult) Usage() gollama.Usage {
+	return gollama.Usage{
+		PromptTokens:     r.PromptTokens,
+		CompletionTokens: r.CompletionTokens,
+		TotalTokens:      r.PromptTokens + r.CompletionTokens,
+	}
+}
+
+// EmbedRequest computes an embedding per text.
+type EmbedRequest struct {
+	Texts []string `json:"texts"`
+}
+
+// WarmRequest decodes Prompts into the prompt cache, so that generations
+// starting with one of them skip its decoding.
+type WarmRequest struct {
+	Prompts []string `json:"prompts"`
+}
+
+// TokenizeRequest tokenizes Text, adding the special tokens of the model.
+type TokenizeRequest struct {
+	Text string `json:"text"`
+}
+
+// frameWriter writes messages, one per line; it is safe for concurrent
+// use.
+type frameWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (f *frameWriter) write(msg any) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	line := make([]byte, 0, len(FramePrefix)+len(b)+1)
+	line = append(append(append(line, FramePrefix...), b...), '\n')
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.w.Write(line)
+	return err
+}
+
+// frameReader reads messages, passing other lines to other when set.
+type frameReader struct {
+	r     *bufio.Reader
+	other io.Writer
+}
+
+func newFrameReader(r io.Reader, other io.Writer) *frameReader {
+	return &frameReader{r: bufio.NewReaderSize(r, 1<<16), other: other}
+}
+
+func (f *frameReader) read(msg any) error {
+	for {
+		line, err := f.r.ReadBytes('\n')
+		if i := bytes.Index(line, []byte(FramePrefix)); i >= 0 && err == nil {
+			if i > 0 && f.other != nil {
+				_, _ = f.other.Write(append(line[:i:i], '\n'))
+			}
+			if err := json.Unmarshal(line[i+len(FramePrefix):], msg); err != nil {
+				return fmt.Errorf("invalid worker message: %w", err)
+			}
+			return nil
+		}
+		if len(line) > 0 && f.other != nil {
+			_, _ = f.other.Write(line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRestartLimit is returned by a Runtime whose worker crashed more
+	// often than its RestartPolicy allows; the error wraps the last cause.
+	ErrRestartLimit = errors.New("worker restart limit reached")
+	// ErrRuntimeClosed is returned by the calls of a closed Runtime.
+	ErrRuntimeClosed = errors.New("worker runtime closed")
+)
+
+// RestartPolicy bounds the restarts of a Runtime.
+type RestartPolicy struct {
+	// MaxRestarts is the number of restarts allowed within Window before
+	// the Runtime gives up; 0 means 5 and a negative value means no limit
+	MaxRestarts int
+	// Window defaults to 10 minutes
+	Window time.Duration
+	// MinBackoff is the delay before the first restart, doubled by every
+	// restart up to MaxBackoff; they default to 250ms and 30s. A worker
+	// that ran longer than MaxBackoff starts over from MinBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// RuntimeOptions configures NewRuntime.
+type RuntimeOptions struct {
+	// Worker configures the worker processes
+	Worker Options
+	// Load is sent to every worker before it serves requests; a zero Load
+	// leaves the worker without a model
+	Load LoadRequest
+	// WarmPrompts are decoded into the prompt cache of every worker, along
+	// with the prompts given to Runtime.Warm; Load.PromptCache must be set
+	WarmPrompts []string
+	Restart     RestartPolicy
+	// HealthInterval is the period of the pings checking that the worker
+	// answers; the default is 30s and a negative value disables them. A
+	// worker that does not answer within HealthTimeout (default 5s) is
+	// killed and restarted.
+	HealthInterval time.Duration
+	HealthTimeout  time.Duration
+	// OnRestart, when set, is called before each restart with the number of
+	// restarts so far, including this one, and the reason of the restart
+	OnRestart func(restart int, cause error)
+}
+
+// Runtime keeps a worker running: when the worker process exits or stops
+// answering health checks, a new one is started, loads the model again
+// and re-warms its prompt cache. Calls wait for the worker to be ready;
+// calls in flight when a worker dies fail with ErrWorkerExited and are
+// not retried, since a generation may have streamed part of its output.
+// It is safe for concurrent use.
+//
+// Example usage:
+//
+//	rt, err := worker.NewRuntime(ctx, worker.RuntimeOptions{
+//		Load:        worker.LoadRequest{Model: "model.gguf", PromptCache: 8},
+//		WarmPrompts: []string{systemPrompt},
+//		OnRestart: func(n int, cause error) {
+//			log.Printf("worker restart %d: %v", n, cause)
+//		},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer rt.Close()
+//	res, err := rt.Generate(ctx, worker.GenerateRequest{Prompt: systemPrompt + question}, nil)
+type Runtime struct {
+	opts      RuntimeOptions
+	closing   chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	client *Client
+	// ready is closed once client is set or err is final
+	ready    chan struct{}
+	cause    error
+	err      error
+	restarts int
+	warm     []string
+}
+
+// NewRuntime starts a worker, loads opts.Load and warms opts.WarmPrompts;
+// ctx bounds this first start only. The worker is supervised until Close.
+func NewRuntime(ctx context.Context, opts RuntimeOptions) (*Runtime, error) {
+	p := &opts.Restart
+	if p.MaxRestarts == 0 {
+		p.MaxRestarts = 5
+	}
+	if p.Window <= 0 {
+		p.Window = 10 * time.Minute
+	}
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = 250 * time.Millisecond
+	}
+	if p.MaxBackoff < p.MinBackoff {
+		p.MaxBackoff = max(30*time.Second, p.MinBackoff)
+	}
+	if opts.HealthInterval == 0 {
+		opts.HealthInterval = 30 * time.Second
+	}
+	if opts.HealthTimeout <= 0 {
+		opts.HealthTimeout = 5 * time.Second
+	}
+
+	r := &Runtime{
+		opts:    opts,
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+		ready:   make(chan struct{}),
+		warm:    append([]string(nil), opts.WarmPrompts...),
+	}
+	c, err := r.spawn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.client = c
+	close(r.ready)
+	go r.supervise(c)
+	return r, nil
+}
+
+// HealthCheck pings the worker. It fails without waiting while the worker
+// is being restarted, with the reason of the restart.
+func (r *Runtime) HealthCheck(ctx context.Context) error {
+	r.mu.Lock()
+	c, cause, err := r.client, r.cause, r.err
+	r.mu.Unlock()
+	switch {
+	case err != nil:
+		return err
+	case c == nil:
+		return fmt.Errorf("restarting worker: %w", cause)
+	}
+	return c.Ping(ctx)
+}
+
+// Restarts returns the number of workers started after the first one.
+func (r *Runtime) Restarts() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.restarts
+}
+
+// Generate generates a completion like Client.Generate.
+func (r *Runtime) Generate(ctx context.Context, req GenerateRequest, onDelta func(string)) (GenerateResult, error) {
+	c, err := r.current(ctx)
+	if err != nil {
+		return GenerateResult{}, err
+	}
+	return c.Generate(ctx, req, onDelta)
+}
+
+// Embed computes embeddings like Client.Embed.
+func (r *Runtime) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	c, err := r.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Embed(ctx, texts)
+}
+
+// Tokenize tokenizes text like Client.Tokenize.
+func (r *Runtime) Tokenize(ctx context.Context, text string) ([]int32, error) {
+	c, err := r.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Tokenize(ctx, text)
+}
+
+// Warm decodes prompts into the prompt cache of the worker like
+// Client.Warm, and of every worker started after it.
+func (r *Runtime) Warm(ctx context.Context, prompts []string) error {
+	c, err := r.current(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.Warm(ctx, prompts); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.warm = append(r.warm, prompts...)
+	r.mu.Unlock()
+	return nil
+}
+
+// Close stops supervising the worker and closes it.
+func (r *Runtime) Close() error {
+	r.closeOnce.Do(func() { close(r.closing) })
+	<-r.stopped
+	r.mu.Lock()
+	c := r.client
+	r.client, r.err = nil, ErrRuntimeClosed
+	r.mu.Unlock()
+	if c != nil {
+		return c.Close()
+	}
+	return nil
+}
+
+// current waits for a ready worker.
+func (r *Runtime) current(ctx context.Context) (*Client, error) {
+	for {
+		r.mu.Lock()
+		c, ready, err := r.client, r.ready, r.err
+		r.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			select {
+			case <-c.Done():
+				// Exited before the supervisor noticed
+				r.mu.Lock()
+				r.drop(c, c.Err())
+				r.mu.Unlock()
+				continue
+			default:
+				return c, nil
+			}
+		}
+		select {
+		case <-ready:
+		case <-r.closing:
+			return nil, ErrRuntimeClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// spawn starts a worker and prepares it; the worker is killed when ctx is
+// cancelled or the Runtime closed before it is ready.
+func (r *Runtime) spawn(ctx context.Context) (*Client, error) {
+	c, err := Start(context.Background(), r.opts.Worker)
+	if err != nil {
+		return nil, err
+	}
+	prepared := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-r.closing:
+		case <-prepared:
+			return
+		}
+		_ = c.Kill()
+	}()
+	err = r.prepare(ctx, c)
+	close(prepared)
+	if err != nil {
+		_ = c.Kill()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// prepare loads the model and warms the prompt cache of c.
+func (r *Runtime) prepare(ctx context.Context, c *Client) error {
+	if r.opts.Load.Model != "" {
+		if err := c.Load(ctx, r.opts.Load); err != nil {
+			return fmt.Errorf("failed to load model in worker: %w", err)
+		}
+	}
+	r.mu.Lock()
+	warm := append([]string(nil), r.warm...)
+	r.mu.Unlock()
+	if len(warm) > 0 {
+		if err := c.Warm(ctx, warm); err != nil {
+			return fmt.Errorf("failed to warm worker: %w", err)
+		}
+	}
+	return nil
+}
+
+// supervise restarts the worker whenever it dies, following the restart
+// policy, until the Runtime is closed.
+func (r *Runtime) supervise(c *Client) {
+	defer close(r.stopped)
+	policy := r.opts.Restart
+	backoff := policy.MinBackoff
+	var history []time.Time
+	for {
+		started := time.Now()
+		cause := r.watch(c)
+		if cause == nil {
+			return
+		}
+		if time.Since(started) > policy.MaxBackoff {
+			backoff = policy.MinBackoff
+		}
+		r.mu.Lock()
+		r.drop(c, cause)
+		r.mu.Unlock()
+
+		for c = nil; c == nil; {
+			now := time.Now()
+			for len(history) > 0 && now.Sub(history[0]) > policy.Window {
+				history = history[1:]
+			}
+			if policy.MaxRestarts >= 0 && len(history) >= policy.MaxRestarts {
+				r.fail(fmt.Errorf("%w: %d restarts within %s: %w", ErrRestartLimit, len(history), policy.Window, cause))
+				return
+			}
+			select {
+			case <-r.closing:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, policy.MaxBackoff)
+			history = append(history, time.Now())
+
+			r.mu.Lock()
+			r.restarts++
+			n := r.restarts
+			r.mu.Unlock()
+			if r.opts.OnRestart != nil {
+				r.opts.OnRestart(n, cause)
+			}
+			var err error
+			if c, err = r.spawn(context.Background()); err != nil {
+				select {
+				case <-r.closing:
+					return
+				default:
+				}
+				cause = err
+			}
+		}
+
+		r.mu.Lock()
+		r.client, r.cause = c, nil
+		close(r.ready)
+		r.mu.Unlock()
+	}
+}
+
+// watch waits for c to exit or fail a health check and returns why, or nil
+// when the Runtime is closed first.
+func (r *Runtime) watch(c *Client) error {
+	var tick <-chan time.Time
+	if r.opts.HealthInterval > 0 {
+		t := time.NewTicker(r.opts.HealthInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-r.closing:
+			return nil
+		case <-c.Done():
+			return c.Err()
+		case <-tick:
+			ctx, cancel := context.WithTimeout(context.Background(), r.opts.HealthTimeout)
+			err := c.Ping(ctx)
+			cancel()
+			if err != nil && c.Err() == nil {
+				_ = c.Kill()
+				return fmt.Errorf("health check failed: %w", err)
+			}
+		}
+	}
+}
+
+// drop marks the worker c as gone because of cause; r.mu must be held.
+func (r *Runtime) drop(c *Client, cause error) {
+	if r.client == c {
+		r.client, r.ready = nil, make(chan struct{})
+	}
+	if r.client == nil {
+		r.cause = cause
+	}
+}
+
+// fail makes the error of every later call err.
+func (r *Runtime) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+	close(r.ready)
+}
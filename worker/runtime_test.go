@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RuntimeSuite struct{ suite.Suite }
+
+func (s *RuntimeSuite) options() RuntimeOptions {
+	exe, err := os.Executable()
+	s.Require().NoError(err)
+	return RuntimeOptions{
+		Worker: Options{
+			Path: exe,
+			Env:  append(os.Environ(), helperEnv+"=1"),
+		},
+		Load:        LoadRequest{Model: "m.gguf", PromptCache: 4},
+		WarmPrompts: []string{"system"},
+		Restart:     RestartPolicy{MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+	}
+}
+
+func (s *RuntimeSuite) start(opts RuntimeOptions) *Runtime {
+	rt, err := NewRuntime(context.Background(), opts)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = rt.Close() })
+	return rt
+}
+
+// state returns the model and warmed prompts of the current worker.
+func (s *RuntimeSuite) state(rt *Runtime) string {
+	res, err := rt.Generate(context.Background(), GenerateRequest{Prompt: "state"}, nil)
+	s.Require().NoError(err)
+	return res.Text
+}
+
+func (s *RuntimeSuite) TestRestartReloadsAndWarms() {
+	var mu sync.Mutex
+	var causes []error
+	opts := s.options()
+	opts.OnRestart = func(n int, cause error) {
+		mu.Lock()
+		defer mu.Unlock()
+		causes = append(causes, cause)
+	}
+	rt := s.start(opts)
+	ctx := context.Background()
+	s.Require().NoError(rt.HealthCheck(ctx))
+	s.Require().NoError(rt.Warm(ctx, []string{"few-shot"}))
+	s.Equal("m.gguf system,few-shot", s.state(rt))
+
+	_, err := rt.Generate(ctx, GenerateRequest{Prompt: "crash"}, nil)
+	s.ErrorIs(err, ErrWorkerExited)
+	s.Equal("m.gguf system,few-shot", s.state(rt), "the new worker is loaded and warmed")
+	s.NoError(rt.HealthCheck(ctx))
+	s.Equal(1, rt.Restarts())
+	mu.Lock()
+	defer mu.Unlock()
+	s.Require().Len(causes, 1)
+	s.ErrorIs(causes[0], ErrWorkerExited)
+}
+
+func (s *RuntimeSuite) TestRestartLimit() {
+	opts := s.options()
+	opts.Restart.MaxRestarts = 1
+	rt := s.start(opts)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err := rt.Generate(ctx, GenerateRequest{Prompt: "crash"}, nil)
+		s.ErrorIs(err, ErrWorkerExited)
+	}
+	_, err := rt.Generate(ctx, GenerateRequest{Prompt: "state"}, nil)
+	s.ErrorIs(err, ErrRestartLimit)
+	s.ErrorIs(err, ErrWorkerExited, "the limit error wraps the last cause")
+	s.ErrorIs(rt.HealthCheck(ctx), ErrRestartLimit)
+	s.Equal(1, rt.Restarts())
+}
+
+func (s *RuntimeSuite) TestFailedLoad() {
+	opts := s.options()
+	opts.Load = LoadRequest{}
+	opts.WarmPrompts = []string{"system"}
+	_, err := NewRuntime(context.Background(), opts)
+	s.ErrorContains(err, "no model")
+}
+
+func (s *RuntimeSuite) TestClose() {
+	rt := s.start(s.options())
+	s.Require().NoError(rt.Close())
+	s.ErrorIs(rt.HealthCheck(context.Background()), ErrRuntimeClosed)
+	_, err := rt.Tokenize(context.Background(), "x")
+	s.ErrorIs(err, ErrRuntimeClosed)
+}
+
+func TestRuntimeSuite(t *testing.T) { suite.Run(t, new(RuntimeSuite)) }
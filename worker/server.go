@@ -0,0 +1,345 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	gollama "github.com/dianlight/gollama.cpp"
+)
+
+// Handler executes the requests of a worker. Calls are serialized: a
+// handler runs one request at a time.
+type Handler interface {
+	Load(req LoadRequest) error
+	// Generate streams the generated text to onDelta
+	Generate(ctx context.Context, req GenerateRequest, onDelta func(string) error) (GenerateResult, error)
+	Embed(ctx context.Context, req EmbedRequest) ([][]float32, error)
+	Tokenize(req TokenizeRequest) ([]int32, error)
+	Warm(ctx context.Context, req WarmRequest) error
+}
+
+// Serve reads requests from r and writes the responses to w until r is
+// closed. Requests run one at a time, in order; a cancel request aborts the
+// request it names, whether running or queued, and a ping is answered
+// right away.
+func Serve(r io.Reader, w io.Writer, h Handler) error {
+	return newServer(w, h).serve(newFrameReader(r, os.Stderr))
+}
+
+// server holds the state of Serve. The reader never waits for the handler:
+// requests are queued without bound, so pings and cancels are read and
+// answered while earlier requests run.
+type server struct {
+	h   Handler
+	out *frameWriter
+
+	mu sync.Mutex
+	// inflight holds the requests queued or running, by ID
+	inflight map[uint64]*queued
+	queue    []*queued
+	closed   bool
+	wake     chan struct{}
+}
+
+// queued is a request in flight.
+type queued struct {
+	req    Request
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newServer(w io.Writer, h Handler) *server {
+	return &server{
+		h:        h,
+		out:      &frameWriter{w: w},
+		inflight: make(map[uint64]*queued),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (s *server) serve(in *frameReader) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run()
+	}()
+
+	var err error
+	for {
+		var req Request
+		if err = in.read(&req); err != nil {
+			break
+		}
+		switch req.Op {
+		case OpPing:
+			_ = s.out.write(Response{ID: req.ID, Done: true})
+		case OpCancel:
+			s.cancel(req.CancelID)
+		default:
+			s.enqueue(req)
+		}
+	}
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.signal()
+	<-done
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// enqueue queues req; its context is created now so that a cancel can
+// reach it before it starts.
+func (s *server) enqueue(req Request) {
+	q := &queued{req: req}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.inflight[req.ID] = q
+	s.queue = append(s.queue, q)
+	s.mu.Unlock()
+	s.signal()
+}
+
+// cancel aborts the request id if it is in flight; a cancel for a request
+// that has finished, or was never sent, is ignored.
+func (s *server) cancel(id uint64) {
+	s.mu.Lock()
+	q := s.inflight[id]
+	s.mu.Unlock()
+	if q != nil {
+		q.cancel()
+	}
+}
+
+func (s *server) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run handles the queued requests until the reader is done and the queue
+// is empty.
+func (s *server) run() {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return
+			}
+			<-s.wake
+			continue
+		}
+		q := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		resp := handle(q.ctx, s.h, q.req, s.out)
+		resp.ID, resp.Done = q.req.ID, true
+		_ = s.out.write(resp)
+
+		s.mu.Lock()
+		if s.inflight[q.req.ID] == q {
+			delete(s.inflight, q.req.ID)
+		}
+		s.mu.Unlock()
+		q.cancel()
+	}
+}
+
+// handle runs req and returns its final response.
+func handle(ctx context.Context, h Handler, req Request, out *frameWriter) Response {
+	var resp Response
+	var err error
+	if err = ctx.Err(); err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	switch {
+	case req.Op == OpLoad && req.Load != nil:
+		err = h.Load(*req.Load)
+	case req.Op == OpGenerate && req.Generate != nil:
+		var res GenerateResult
+		res, err = h.Generate(ctx, *req.Generate, func(delta string) error {
+			return out.write(Response{ID: req.ID, Delta: delta})
+		})
+		resp.Generate = &res
+	case req.Op == OpEmbed && req.Embed != nil:
+		resp.Embeddings, err = h.Embed(ctx, *req.Embed)
+	case req.Op == OpTokenize && req.Tokenize != nil:
+		resp.Tokens, err = h.Tokenize(*req.Tokenize)
+	case req.Op == OpWarm && req.Warm != nil:
+		err = h.Warm(ctx, *req.Warm)
+	default:
+		err = fmt.Errorf("%w: unknown request %q", gollama.ErrInvalidParameter, req.Op)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+// ModelHandler serves a model with the gollama bindings. It is what the
+// gollama-worker command runs.
+type ModelHandler struct {
+	model     *gollama.Model
+	ctx       *gollama.Context
+	embedding *gollama.EmbeddingSession
+	cache     *gollama.PromptCache
+}
+
+// Load loads the model of req, freeing the previous one.
+func (m *ModelHandler) Load(req LoadRequest) error {
+	if req.Model == "" {
+		return fmt.Errorf("%w: model path", gollama.ErrMissingParameter)
+	}
+	m.Close()
+
+	modelParams := gollama.Model_default_params()
+	modelParams.NGpuLayers = int32(req.GPULayers)
+	model, err := gollama.LoadModel(req.Model, modelParams)
+	if err != nil {
+		return err
+	}
+	ctxParams := gollama.Context_default_params()
+	if req.ContextSize > 0 {
+		ctxParams.NCtx = uint32(req.ContextSize)
+	}
+	if req.BatchSize > 0 {
+		ctxParams.NBatch = uint32(req.BatchSize)
+	}
+	if req.Threads > 0 {
+		ctxParams.NThreads = int32(req.Threads)
+		ctxParams.NThreadsBatch = int32(req.Threads)
+	}
+	if req.Embeddings {
+		ctxParams.Embeddings = 1
+	}
+	ctx, err := gollama.NewContext(model, ctxParams)
+	if err != nil {
+		model.Free()
+		return err
+	}
+	m.model, m.ctx = model, ctx
+	if req.PromptCache > 0 && !req.Embeddings {
+		if m.cache, err = gollama.NewPromptCache(gollama.PromptCacheOptions{MaxEntries: req.PromptCache, Namespace: req.Model}); err != nil {
+			m.Close()
+			return err
+		}
+	}
+	if req.Embeddings {
+		if m.embedding, err = gollama.NewEmbeddingSession(model.Handle(), ctx.Handle()); err != nil {
+			m.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// Generate generates a completion of req.Prompt with a cleared context.
+func (m *ModelHandler) Generate(ctx context.Context, req GenerateRequest, onDelta func(string) error) (GenerateResult, error) {
+	if m.ctx == nil {
+		return GenerateResult{}, gollama.ErrModelNotLoaded
+	}
+	tokens, err := m.model.Tokenize(req.Prompt, m.model.AddBOS, true)
+	if err != nil {
+		return GenerateResult{}, err
+	}
+	if m.cache == nil {
+		m.ctx.ClearMemory(true)
+	}
+	res, err := m.ctx.Generate(ctx, tokens, gollama.GenerateOptions{
+		MaxTokens:   req.MaxTokens,
+		Stop:        req.Stop,
+		Sampling:    req.Sampling,
+		PromptCache: m.cache,
+		OnText:      onDelta,
+	})
+	return GenerateResult{
+		Text:             res.Text,
+		PromptTokens:     res.PromptTokens,
+		CompletionTokens: res.CompletionTokens,
+		StopReason:       res.StopReason.String(),
+		Timings:          res.Timings,
+	}, err
+}
+
+// Embed embeds every text of req.
+func (m *ModelHandler) Embed(ctx context.Context, req EmbedRequest) ([][]float32, error) {
+	if m.embedding == nil {
+		return nil, fmt.Errorf("%w: load the model with Embeddings set", gollama.ErrModelNotLoaded)
+	}
+	out := make([][]float32, len(req.Texts))
+	for i, text := range req.Texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vec, err := m.embedding.Embed(text)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = vec
+	}
+	return out, nil
+}
+
+// Tokenize tokenizes req.Text.
+func (m *ModelHandler) Tokenize(req TokenizeRequest) ([]int32, error) {
+	if m.model == nil {
+		return nil, gollama.ErrModelNotLoaded
+	}
+	tokens, err := m.model.Tokenize(req.Text, m.model.AddBOS, true)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]int32, len(tokens))
+	for i, t := range tokens {
+		out[i] = int32(t)
+	}
+	return out, nil
+}
+
+// Warm decodes every prompt of req into the prompt cache.
+func (m *ModelHandler) Warm(ctx context.Context, req WarmRequest) error {
+	if m.cache == nil {
+		return fmt.Errorf("%w: load the model with a PromptCache", gollama.ErrModelNotLoaded)
+	}
+	for _, prompt := range req.Prompts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tokens, err := m.model.Tokenize(prompt, m.model.AddBOS, true)
+		if err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		if _, err := m.cache.Prefill(m.ctx, 0, tokens); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close frees the loaded model, if any.
+func (m *ModelHandler) Close() {
+	m.embedding, m.cache = nil, nil
+	if m.ctx != nil {
+		m.ctx.Free()
+		m.ctx = nil
+	}
+	if m.model != nil {
+		m.model.Free()
+		m.model = nil
+	}
+}
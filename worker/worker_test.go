@@ -0,0 +1,289 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	gollama "github.com/dianlight/gollama.cpp"
+	"github.com/stretchr/testify/suite"
+)
+
+// helperEnv makes the test binary act as a worker serving fakeHandler.
+const helperEnv = "GOLLAMA_WORKER_TEST_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(helperEnv) == "1" {
+		if err := Serve(os.Stdin, os.Stdout, &fakeHandler{}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeHandler generates the words of the prompt. The prompt "crash" exits
+// like a native crash would, "slow" generates until cancelled and "state"
+// returns the loaded model and the warmed prompts.
+type fakeHandler struct {
+	model  string
+	warmed []string
+}
+
+func (h *fakeHandler) Load(req LoadRequest) error {
+	if req.Model == "" {
+		return errors.New("no model")
+	}
+	h.model = req.Model
+	return nil
+}
+
+func (h *fakeHandler) Generate(ctx context.Context, req GenerateRequest, onDelta func(string) error) (GenerateResult, error) {
+	switch req.Prompt {
+	case "crash":
+		os.Exit(3)
+	case "state":
+		return GenerateResult{Text: h.model + " " + strings.Join(h.warmed, ",")}, nil
+	case "slow":
+		for {
+			select {
+			case <-ctx.Done():
+				return GenerateResult{}, ctx.Err()
+			case <-time.After(5 * time.Millisecond):
+				if err := onDelta("."); err != nil {
+					return GenerateResult{}, err
+				}
+			}
+		}
+	}
+	var text strings.Builder
+	for i, word := range strings.Fields(req.Prompt) {
+		// Output of the native libraries shares stdout with the protocol
+		fmt.Print("native noise ")
+		if i > 0 {
+			word = " " + word
+		}
+		text.WriteString(word)
+		if err := onDelta(word); err != nil {
+			return GenerateResult{}, err
+		}
+	}
+	n := len(strings.Fields(req.Prompt))
+	return GenerateResult{
+		Text:             text.String(),
+		PromptTokens:     1,
+		CompletionTokens: n,
+		StopReason:       "eog",
+		Timings:          gollama.Timings{PromptTokens: 1, GeneratedTokens: n},
+	}, nil
+}
+
+func (h *fakeHandler) Embed(ctx context.Context, req EmbedRequest) ([][]float32, error) {
+	out := make([][]float32, len(req.Texts))
+	for i, text := range req.Texts {
+		out[i] = []float32{float32(len(text))}
+	}
+	return out, nil
+}
+
+func (h *fakeHandler) Tokenize(req TokenizeRequest) ([]int32, error) {
+	return []int32{int32(len(req.Text))}, nil
+}
+
+func (h *fakeHandler) Warm(ctx context.Context, req WarmRequest) error {
+	if h.model == "" {
+		return errors.New("no model")
+	}
+	h.warmed = append(h.warmed, req.Prompts...)
+	return nil
+}
+
+type WorkerSuite struct{ suite.Suite }
+
+func (s *WorkerSuite) start() *Client {
+	exe, err := os.Executable()
+	s.Require().NoError(err)
+	var stderr bytes.Buffer
+	c, err := Start(context.Background(), Options{
+		Path:   exe,
+		Env:    append(os.Environ(), helperEnv+"=1"),
+		Stderr: &stderr,
+	})
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = c.Kill() })
+	return c
+}
+
+func (s *WorkerSuite) TestRequests() {
+	c := s.start()
+	ctx := context.Background()
+	s.Require().NoError(c.Ping(ctx))
+	s.Require().NoError(c.Load(ctx, LoadRequest{Model: "m.gguf"}))
+	s.EqualError(c.Load(ctx, LoadRequest{}), "no model")
+
+	var deltas []string
+	res, err := c.Generate(ctx, GenerateRequest{Prompt: "hello from the worker"}, func(d string) { deltas = append(deltas, d) })
+	s.Require().NoError(err)
+	s.Equal("hello from the worker", res.Text)
+	s.Equal("eog", res.StopReason)
+	s.Equal(gollama.Usage{PromptTokens: 1, CompletionTokens: 4, TotalTokens: 5}, res.Usage())
+	s.Equal(4, res.Timings.GeneratedTokens)
+	s.Equal([]string{"hello", " from", " the", " worker"}, deltas)
+
+	embeddings, err := c.Embed(ctx, []string{"a", "abc"})
+	s.Require().NoError(err)
+	s.Equal([][]float32{{1}, {3}}, embeddings)
+	tokens, err := c.Tokenize(ctx, "abcd")
+	s.Require().NoError(err)
+	s.Equal([]int32{4}, tokens)
+
+	s.NoError(c.Close())
+	s.ErrorIs(c.Ping(ctx), ErrWorkerExited)
+}
+
+func (s *WorkerSuite) TestCancel() {
+	c := s.start()
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := c.Generate(ctx, GenerateRequest{Prompt: "slow"}, func(string) { cancel() })
+	s.ErrorIs(err, context.Canceled)
+	s.NoError(c.Ping(context.Background()), "the worker serves the next request")
+}
+
+func (s *WorkerSuite) TestCrash() {
+	c := s.start()
+	ctx := context.Background()
+	_, err := c.Generate(ctx, GenerateRequest{Prompt: "crash"}, nil)
+	s.ErrorIs(err, ErrWorkerExited)
+	s.Contains(err.Error(), "exit status 3")
+	<-c.Done()
+	s.ErrorIs(c.Err(), ErrWorkerExited)
+	s.ErrorIs(c.Ping(ctx), ErrWorkerExited)
+}
+
+func (s *WorkerSuite) TestMissingExecutable() {
+	_, err := Start(context.Background(), Options{Path: "gollama-worker-does-not-exist"})
+	s.Error(err)
+}
+
+func (s *WorkerSuite) TestFraming() {
+	var buf bytes.Buffer
+	w := &frameWriter{w: &buf}
+	s.Require().NoError(w.write(Response{ID: 7, Delta: "x\ny"}))
+	input := "log line\nnoise" + buf.String()
+	var other bytes.Buffer
+	var resp Response
+	s.Require().NoError(newFrameReader(strings.NewReader(input), &other).read(&resp))
+	s.Equal(Response{ID: 7, Delta: "x\ny"}, resp)
+	s.Equal("log line\nnoise\n", other.String())
+}
+
+// blockingHandler generates once release is closed.
+type blockingHandler struct {
+	fakeHandler
+	release chan struct{}
+}
+
+func (h *blockingHandler) Generate(ctx context.Context, req GenerateRequest, onDelta func(string) error) (GenerateResult, error) {
+	select {
+	case <-h.release:
+		return GenerateResult{Text: req.Prompt}, nil
+	case <-ctx.Done():
+		return GenerateResult{}, ctx.Err()
+	}
+}
+
+// serveInProcess runs a server for h over pipes, returning a writer of
+// requests and a reader of responses.
+func (s *WorkerSuite) serveInProcess(h Handler) (*server, *frameWriter, *frameReader) {
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	srv := newServer(respW, h)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = srv.serve(newFrameReader(reqR, nil))
+		_ = respW.Close()
+	}()
+	s.T().Cleanup(func() {
+		_ = reqW.Close()
+		go func() { _, _ = io.Copy(io.Discard, respR) }()
+		<-done
+	})
+	return srv, &frameWriter{w: reqW}, newFrameReader(respR, nil)
+}
+
+func (s *WorkerSuite) TestPingWhileQueueIsFull() {
+	h := &blockingHandler{release: make(chan struct{})}
+	_, in, out := s.serveInProcess(h)
+	const queued = 200
+	go func() {
+		for id := uint64(1); id <= queued; id++ {
+			_ = in.write(Request{ID: id, Op: OpGenerate, Generate: &GenerateRequest{Prompt: "p"}})
+		}
+		_ = in.write(Request{ID: 1000, Op: OpPing})
+	}()
+
+	var resp Response
+	s.Require().NoError(out.read(&resp))
+	s.Equal(Response{ID: 1000, Done: true}, resp, "the ping is answered behind a backlog of requests")
+
+	close(h.release)
+	for id := uint64(1); id <= queued; id++ {
+		s.Require().NoError(out.read(&resp))
+		s.Equal(id, resp.ID)
+		s.Empty(resp.Error)
+	}
+}
+
+func (s *WorkerSuite) TestCancelQueuedRequest() {
+	h := &blockingHandler{release: make(chan struct{})}
+	_, in, out := s.serveInProcess(h)
+	s.Require().NoError(in.write(Request{ID: 1, Op: OpGenerate, Generate: &GenerateRequest{Prompt: "running"}}))
+	s.Require().NoError(in.write(Request{ID: 2, Op: OpGenerate, Generate: &GenerateRequest{Prompt: "queued"}}))
+	s.Require().NoError(in.write(Request{ID: 3, Op: OpCancel, CancelID: 2}))
+	s.Require().NoError(in.write(Request{ID: 4, Op: OpPing}))
+
+	var resp Response
+	s.Require().NoError(out.read(&resp))
+	s.Equal(uint64(4), resp.ID)
+	close(h.release)
+	s.Require().NoError(out.read(&resp))
+	s.Equal(uint64(1), resp.ID)
+	s.Equal("running", resp.Generate.Text)
+	s.Require().NoError(out.read(&resp))
+	s.Equal(uint64(2), resp.ID)
+	s.Equal(context.Canceled.Error(), resp.Error)
+}
+
+func (s *WorkerSuite) TestStaleCancelIsIgnored() {
+	srv, in, out := s.serveInProcess(&fakeHandler{})
+	s.Require().NoError(in.write(Request{ID: 1, Op: OpTokenize, Tokenize: &TokenizeRequest{Text: "ab"}}))
+	var resp Response
+	s.Require().NoError(out.read(&resp))
+	s.Equal(uint64(1), resp.ID)
+
+	// Cancels for a finished request and an unknown one
+	s.Require().NoError(in.write(Request{ID: 2, Op: OpCancel, CancelID: 1}))
+	s.Require().NoError(in.write(Request{ID: 3, Op: OpCancel, CancelID: 99}))
+	s.Require().NoError(in.write(Request{ID: 4, Op: OpPing}))
+	s.Require().NoError(out.read(&resp))
+	s.Equal(uint64(4), resp.ID)
+
+	srv.mu.Lock()
+	s.Empty(srv.inflight, "no cancel is recorded for requests not in flight")
+	srv.mu.Unlock()
+
+	s.Require().NoError(in.write(Request{ID: 1, Op: OpTokenize, Tokenize: &TokenizeRequest{Text: "abc"}}))
+	s.Require().NoError(out.read(&resp))
+	s.Empty(resp.Error, "a reused ID is not cancelled by the earlier cancel")
+	s.Equal([]int32{3}, resp.Tokens)
+}
+
+func TestWorkerSuite(t *testing.T) { suite.Run(t, new(WorkerSuite)) }